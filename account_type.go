@@ -0,0 +1,206 @@
+package arus
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// AccountType is the kind of account a BankAccount is, which decides where
+// transactions imported from it belong.
+type AccountType int
+
+const (
+	// Not known; DetectAccountType may still recognise it
+	UnspecifiedAccount AccountType = iota
+	CheckingAccount
+	SavingsAccount
+	// Brokerage or custodian account holding securities
+	CustodianAccount
+	EWalletAccount
+	// Charges are paid later, see CreditCard
+	CreditCardAccount
+)
+
+var accountTypeCodes = enumCodes[AccountType]{
+	name: "account type",
+	codes: map[AccountType]string{
+		UnspecifiedAccount: "unspecified",
+		CheckingAccount:    "checking",
+		SavingsAccount:     "savings",
+		CustodianAccount:   "custodian",
+		EWalletAccount:     "e-wallet",
+		CreditCardAccount:  "credit-card",
+	},
+	unknown: UnspecifiedAccount,
+}
+
+// ParseAccountType reads an account type code, returning
+// UnspecifiedAccount for codes this version does not know.
+func ParseAccountType(code string) AccountType {
+	return accountTypeCodes.parse(code)
+}
+
+func (t AccountType) Code() string {
+	return accountTypeCodes.code(t)
+}
+
+func (t AccountType) String() string {
+	return t.Code()
+}
+
+func (t AccountType) MarshalText() ([]byte, error) {
+	return []byte(t.Code()), nil
+}
+
+func (t *AccountType) UnmarshalText(text []byte) error {
+	*t = accountTypeCodes.parse(string(text))
+	return nil
+}
+
+func (t AccountType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Code())
+}
+
+func (t *AccountType) UnmarshalJSON(data []byte) error {
+	value, err := accountTypeCodes.unmarshalJSON(data)
+	*t = value
+	return err
+}
+
+func (t AccountType) Value() (driver.Value, error) {
+	return t.Code(), nil
+}
+
+func (t *AccountType) Scan(src any) error {
+	value, err := accountTypeCodes.scan(src)
+	*t = value
+	return err
+}
+
+// Category returns the category transactions of this kind of account are
+// routed to, if the account type decides it. Custodian accounts hold
+// investments and savings accounts savings; checking accounts and e-wallets
+// can back any category.
+func (t AccountType) Category() (CategoryType, bool) {
+	switch t {
+	case CustodianAccount:
+		return Investment, true
+	case SavingsAccount:
+		return Savings, true
+	default:
+		return UnknownCategory, false
+	}
+}
+
+// Words in bank names that give away the kind of institution. They are
+// matched against whole words of the name, so "Bank Danamon" is not taken
+// for DANA.
+var accountTypeHints = []struct {
+	Type  AccountType
+	Words []string
+}{
+	{CustodianAccount, []string{"securities", "sekuritas", "brokerage", "custodian", "custody", "investment", "investments", "capital markets"}},
+	{EWalletAccount, []string{"wallet", "ewallet", "gopay", "ovo", "dana", "paypal", "shopeepay"}},
+}
+
+// nameWords splits a name or description into its lowercase words.
+func nameWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+}
+
+// containsPhrase reports whether the words of phrase appear in words one
+// after another.
+func containsPhrase(words []string, phrase string) bool {
+	want := strings.Fields(phrase)
+	for i := 0; i+len(want) <= len(words); i++ {
+		if slices.Equal(words[i:i+len(want)], want) {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectAccountType returns the account's type, or guesses it from the
+// bank's name when unspecified: brokers and custodians are told apart from
+// banks, and e-wallet providers from both. Banks are not guessed further,
+// since the same bank offers checking and savings accounts.
+func DetectAccountType(account BankAccount) AccountType {
+	if account.Type != UnspecifiedAccount {
+		return account.Type
+	}
+	words := nameWords(account.BankName)
+	for _, hint := range accountTypeHints {
+		for _, phrase := range hint.Words {
+			if containsPhrase(words, phrase) {
+				return hint.Type
+			}
+		}
+	}
+	return UnspecifiedAccount
+}
+
+// RouteAccount returns the category backing the account. Accounts not
+// linked yet are linked to the category their (detected) type routes to;
+// other unlinked accounts are refused.
+func (u *User) RouteAccount(account BankAccount) (*Category, error) {
+	if category := u.CategoryFor(account); category != nil {
+		return category, nil
+	}
+	categoryType, ok := DetectAccountType(account).Category()
+	if !ok {
+		return nil, &AccountNotLinkedError{BankAccount: account}
+	}
+	category, exists := u.Categories[categoryType]
+	if !exists {
+		return nil, &CategoryNotFoundError{Category: categoryType}
+	}
+	account.Type = DetectAccountType(account)
+	category.AddAccount(account)
+	return category, nil
+}
+
+// deductionOrderFor returns the categories debits on the account are taken
+// from. Money leaving a custodian or savings account leaves that category;
+// everything else goes through DefaultDeductionOrder.
+func (u *User) deductionOrderFor(account BankAccount) []CategoryType {
+	if categoryType, ok := DetectAccountType(account).Category(); ok {
+		if category := u.CategoryFor(account); category != nil && category.Type == categoryType {
+			return []CategoryType{categoryType}
+		}
+	}
+	return DefaultDeductionOrder
+}
+
+// RouteBankAccount links the account to the category its type routes to,
+// unless it is linked already, and returns the account's category.
+func (s *FinanceService) RouteBankAccount(ctx context.Context, userID string, account BankAccount) (CategoryType, error) {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return UnknownCategory, err
+	}
+	if category := user.CategoryFor(account); category != nil {
+		return category.Type, nil
+	}
+	if err := s.quotaFor(userID).Check(QuotaLinkedAccounts, user.LinkedAccountCount(), 1); err != nil {
+		return UnknownCategory, err
+	}
+	category, err := user.RouteAccount(account)
+	if err != nil {
+		return UnknownCategory, err
+	}
+
+	if err := s.save(ctx, user, "route_bank_account"); err != nil {
+		return UnknownCategory, err
+	}
+	s.Telemetry.Track(ctx, "accounts", "route", userID, map[string]string{
+		"category": category.Type.String(),
+		"type":     DetectAccountType(account).Code(),
+	})
+	return category.Type, nil
+}
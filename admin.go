@@ -0,0 +1,239 @@
+package arus
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// AdminAction records a change an administrator made to a tenant. It is
+// recorded before the change is made; when the change then fails, a second
+// entry records why.
+type AdminAction struct {
+	ID     string
+	Admin  string
+	Action string
+	UserID string
+	At     time.Time
+	Detail string
+	// Why the action failed, on the entry recorded after a failed attempt
+	Error string `json:",omitempty"`
+}
+
+// AdminActionLog is an append-only record of administrator actions.
+type AdminActionLog interface {
+	Record(ctx context.Context, action AdminAction) error
+	// Actions returns every recorded action, oldest first.
+	Actions(ctx context.Context) ([]AdminAction, error)
+}
+
+type InMemoryAdminActionLog struct {
+	mu      sync.RWMutex
+	actions []AdminAction
+}
+
+func NewInMemoryAdminActionLog() *InMemoryAdminActionLog {
+	return &InMemoryAdminActionLog{}
+}
+
+func (l *InMemoryAdminActionLog) Record(ctx context.Context, action AdminAction) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.actions = append(l.actions, action)
+	return nil
+}
+
+func (l *InMemoryAdminActionLog) Actions(ctx context.Context) ([]AdminAction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return append([]AdminAction(nil), l.actions...), nil
+}
+
+// SQLAdminActionLog keeps the admin action log in the admin_actions table,
+// so it outlives the process.
+type SQLAdminActionLog struct {
+	db      *sql.DB
+	dialect SQLDialect
+}
+
+func NewSQLAdminActionLog(ctx context.Context, db *sql.DB, dialect SQLDialect) (*SQLAdminActionLog, error) {
+	if err := checkSchema(ctx, db); err != nil {
+		return nil, err
+	}
+	return &SQLAdminActionLog{db: db, dialect: dialect}, nil
+}
+
+func (l *SQLAdminActionLog) Record(ctx context.Context, action AdminAction) error {
+	_, err := l.db.ExecContext(ctx, l.dialect.rebind(`INSERT INTO admin_actions (id, admin, action, user_id, at, detail, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`),
+		action.ID, action.Admin, action.Action, action.UserID, action.At.UTC().Format(sqlDateLayout), action.Detail, action.Error)
+	return err
+}
+
+func (l *SQLAdminActionLog) Actions(ctx context.Context) ([]AdminAction, error) {
+	rows, err := l.db.QueryContext(ctx, `SELECT id, admin, action, user_id, at, detail, error FROM admin_actions ORDER BY at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var actions []AdminAction
+	for rows.Next() {
+		var action AdminAction
+		var at string
+		if err := rows.Scan(&action.ID, &action.Admin, &action.Action, &action.UserID, &at, &action.Detail, &action.Error); err != nil {
+			return nil, err
+		}
+		if action.At, err = time.Parse(sqlDateLayout, at); err != nil {
+			return nil, fmt.Errorf("decoding admin action time: %w", err)
+		}
+		actions = append(actions, action)
+	}
+	return actions, rows.Err()
+}
+
+// SystemMetrics describe everything a hosted instance manages.
+type SystemMetrics struct {
+	Users         int
+	ArchivedUsers int
+	// Every transaction ever recorded, archived periods included
+	Transactions int
+	// Total category balance per currency
+	Balances map[string]decimal.Decimal
+}
+
+// Admin manages tenants on behalf of administrators. Every change is
+// recorded in Actions under the acting administrator's name before it is
+// made; checking that they are an administrator is up to the caller.
+type Admin struct {
+	Service *FinanceService
+	Actions AdminActionLog
+}
+
+func NewAdmin(service *FinanceService, actions AdminActionLog) *Admin {
+	return &Admin{Service: service, Actions: actions}
+}
+
+// perform records the action, then makes the change. Nothing is changed
+// when the action cannot be recorded, so no change goes unaudited; a failed
+// change is recorded as well.
+func (a *Admin) perform(ctx context.Context, admin, action, userID, detail string, change func() error) error {
+	a.Service.log().InfoContext(ctx, "admin action", "admin", admin, LogKeyOperation, action, LogKeyUserID, userID)
+	entry := AdminAction{
+		ID:     NewID(),
+		Admin:  admin,
+		Action: action,
+		UserID: userID,
+		At:     a.Service.now(),
+		Detail: detail,
+	}
+	if err := a.Actions.Record(ctx, entry); err != nil {
+		return fmt.Errorf("recording admin action: %w", err)
+	}
+
+	err := change()
+	if err != nil {
+		entry.ID, entry.At, entry.Error = NewID(), a.Service.now(), err.Error()
+		if recordErr := a.Actions.Record(ctx, entry); recordErr != nil {
+			a.Service.log().ErrorContext(ctx, "recording failed admin action", LogKeyOperation, action, LogKeyUserID, userID, "error", recordErr)
+		}
+	}
+	return err
+}
+
+// CreateUser creates a user, onboarded with the country's profile unless
+// country is empty.
+func (a *Admin) CreateUser(ctx context.Context, admin, country string) (*User, error) {
+	// Built before it is saved, so the action is recorded under its ID
+	user := NewUser("")
+	if country != "" {
+		profile, ok := LookupCountryProfile(country)
+		if !ok {
+			return nil, fmt.Errorf("unknown country profile %q", country)
+		}
+		profile.Apply(user)
+	}
+	err := a.perform(ctx, admin, "create_user", user.ID, country, func() error {
+		return a.Service.save(ctx, user, "admin_create_user")
+	})
+	if err != nil {
+		return nil, err
+	}
+	a.Service.Telemetry.Track(ctx, "users", "create", user.ID, nil)
+	return user, nil
+}
+
+// DisableUser archives the user, recording why.
+func (a *Admin) DisableUser(ctx context.Context, admin, userID, reason string) error {
+	return a.perform(ctx, admin, "disable_user", userID, reason, func() error {
+		return a.Service.ArchiveUser(ctx, userID)
+	})
+}
+
+// EnableUser restores a disabled user.
+func (a *Admin) EnableUser(ctx context.Context, admin, userID string) error {
+	return a.perform(ctx, admin, "enable_user", userID, "", func() error {
+		_, err := a.Service.RestoreUser(ctx, userID)
+		return err
+	})
+}
+
+// ResetAllocationRules ends the user's allocation rules now, so later
+// incomes are refused until the user plans their allocation again.
+func (a *Admin) ResetAllocationRules(ctx context.Context, admin, userID string) error {
+	return a.perform(ctx, admin, "reset_allocation_rules", userID, "", func() error {
+		defer a.Service.lockUser(userID)()
+
+		user, err := a.Service.UserRepo.GetByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		// Ended rather than removed, so earlier incomes keep their split
+		if err := user.PlanAllocationRules(a.Service.now(), nil); err != nil {
+			return err
+		}
+		return a.Service.save(ctx, user, "admin_reset_allocation_rules")
+	})
+}
+
+// Metrics totals users, transactions and managed balances per currency
+// across every user, archived ones included.
+func (a *Admin) Metrics(ctx context.Context) (SystemMetrics, error) {
+	iterator, ok := a.Service.UserRepo.(UserIterator)
+	if !ok {
+		return SystemMetrics{}, errors.New("repository does not support iterating users")
+	}
+
+	metrics := SystemMetrics{Balances: make(map[string]decimal.Decimal)}
+	err := iterator.ForEach(ctx, func(user *User) error {
+		metrics.Users++
+		metrics.Transactions += user.TransactionCount()
+		for _, category := range user.Categories {
+			currency := category.Balance.Currency
+			metrics.Balances[currency] = metrics.Balances[currency].Add(category.Balance.Amount)
+		}
+		if user.Archived() {
+			metrics.ArchivedUsers++
+		}
+		return nil
+	})
+	if err != nil {
+		return SystemMetrics{}, err
+	}
+	return metrics, nil
+}
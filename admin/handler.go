@@ -0,0 +1,225 @@
+// Package admin serves the tenant management API of hosted instances to
+// administrators.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/dnswd/arus"
+	"github.com/dnswd/arus/openapi"
+)
+
+// Largest request body the handler accepts
+const maxRequestBytes = 1 << 16
+
+type createUserRequest struct {
+	Country string `json:",omitempty"`
+}
+
+type disableUserRequest struct {
+	Reason string `json:",omitempty"`
+}
+
+// Handler serves the admin API:
+//
+//	POST /users                              create a user
+//	POST /users/{id}/disable                 archive a user
+//	POST /users/{id}/enable                  restore a user
+//	POST /users/{id}/reset-allocation-rules  clear a user's allocation rules
+//	GET  /metrics                            system-wide totals
+//	GET  /actions                            the admin action log
+//
+// Authorize names the administrator making a request, and fails for anyone
+// else; every request is refused with 403 Forbidden when it fails.
+type Handler struct {
+	Admin     *arus.Admin
+	Authorize func(r *http.Request) (admin string, err error)
+
+	mux *http.ServeMux
+}
+
+func NewHandler(admin *arus.Admin, authorize func(r *http.Request) (string, error)) *Handler {
+	h := &Handler{Admin: admin, Authorize: authorize, mux: http.NewServeMux()}
+	h.mux.HandleFunc("POST /users", h.createUser)
+	h.mux.HandleFunc("POST /users/{id}/disable", h.disableUser)
+	h.mux.HandleFunc("POST /users/{id}/enable", h.enableUser)
+	h.mux.HandleFunc("POST /users/{id}/reset-allocation-rules", h.resetAllocationRules)
+	h.mux.HandleFunc("GET /metrics", h.metrics)
+	h.mux.HandleFunc("GET /actions", h.actions)
+	return h
+}
+
+// Describe adds the admin API to doc.
+func (h *Handler) Describe(doc *openapi.Document, prefix string) {
+	tags := []string{"admin"}
+	forbidden := openapi.Response{Description: "Not an administrator"}
+	notFound := openapi.Response{Description: "No such user"}
+	conflict := openapi.Response{Description: "The user is already in that state"}
+	doc.Add(http.MethodPost, prefix+"/users", openapi.Operation{
+		OperationID: "createUser",
+		Summary:     "Create a user",
+		Tags:        tags,
+		RequestBody: &openapi.RequestBody{Content: doc.JSON(createUserRequest{})},
+		Responses: map[string]openapi.Response{
+			"201": {Description: "The created user", Content: doc.JSON(arus.UserView{})},
+			"403": forbidden,
+		},
+	})
+	doc.Add(http.MethodPost, prefix+"/users/{id}/disable", openapi.Operation{
+		OperationID: "disableUser",
+		Summary:     "Archive a user",
+		Tags:        tags,
+		RequestBody: &openapi.RequestBody{Content: doc.JSON(disableUserRequest{})},
+		Responses: map[string]openapi.Response{
+			"204": {Description: "Archived"},
+			"403": forbidden,
+			"404": notFound,
+			"409": conflict,
+		},
+	})
+	doc.Add(http.MethodPost, prefix+"/users/{id}/enable", openapi.Operation{
+		OperationID: "enableUser",
+		Summary:     "Restore a user",
+		Tags:        tags,
+		Responses: map[string]openapi.Response{
+			"204": {Description: "Restored"},
+			"403": forbidden,
+			"404": notFound,
+			"409": conflict,
+		},
+	})
+	doc.Add(http.MethodPost, prefix+"/users/{id}/reset-allocation-rules", openapi.Operation{
+		OperationID: "resetAllocationRules",
+		Summary:     "Clear a user's allocation rules",
+		Tags:        tags,
+		Responses: map[string]openapi.Response{
+			"204": {Description: "Cleared"},
+			"403": forbidden,
+			"404": notFound,
+		},
+	})
+	doc.Add(http.MethodGet, prefix+"/metrics", openapi.Operation{
+		OperationID: "metrics",
+		Summary:     "System-wide totals",
+		Tags:        tags,
+		Responses: map[string]openapi.Response{
+			"200": {Description: "The totals", Content: doc.JSON(arus.SystemMetrics{})},
+			"403": forbidden,
+		},
+	})
+	doc.Add(http.MethodGet, prefix+"/actions", openapi.Operation{
+		OperationID: "actions",
+		Summary:     "The admin action log, oldest first",
+		Tags:        tags,
+		Responses: map[string]openapi.Response{
+			"200": {Description: "The actions", Content: doc.JSON([]arus.AdminAction{})},
+			"403": forbidden,
+		},
+	})
+}
+
+type adminKey struct{}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	admin, err := h.Authorize(r)
+	if err != nil || admin == "" {
+		http.Error(w, "admin role required", http.StatusForbidden)
+		return
+	}
+	h.mux.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminKey{}, admin)))
+}
+
+func adminOf(r *http.Request) string {
+	return r.Context().Value(adminKey{}).(string)
+}
+
+func (h *Handler) createUser(w http.ResponseWriter, r *http.Request) {
+	var req createUserRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	user, err := h.Admin.CreateUser(r.Context(), adminOf(r), req.Country)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, arus.NewUserView(user, arus.AudienceAdvisor))
+}
+
+func (h *Handler) disableUser(w http.ResponseWriter, r *http.Request) {
+	var req disableUserRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if err := h.Admin.DisableUser(r.Context(), adminOf(r), r.PathValue("id"), req.Reason); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) enableUser(w http.ResponseWriter, r *http.Request) {
+	if err := h.Admin.EnableUser(r.Context(), adminOf(r), r.PathValue("id")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) resetAllocationRules(w http.ResponseWriter, r *http.Request) {
+	if err := h.Admin.ResetAllocationRules(r.Context(), adminOf(r), r.PathValue("id")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) metrics(w http.ResponseWriter, r *http.Request) {
+	metrics, err := h.Admin.Metrics(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, metrics)
+}
+
+func (h *Handler) actions(w http.ResponseWriter, r *http.Request) {
+	actions, err := h.Admin.Actions.Actions(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, actions)
+}
+
+// decode reads an optional JSON body into v, answering 400 Bad Request when
+// it is malformed.
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes)).Decode(v)
+	if err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, arus.ErrUserArchived), errors.Is(err, arus.ErrUserNotArchived):
+		status = http.StatusConflict
+	case errors.Is(err, arus.ErrUserNotFound):
+		status = http.StatusNotFound
+	}
+	http.Error(w, err.Error(), status)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,111 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dnswd/arus"
+)
+
+// newTestHandler serves the admin API over an in-memory repository holding
+// user "u1", archived when archived is set. Requests are made by "root" when
+// they carry an X-Admin header.
+func newTestHandler(t *testing.T, archived bool) (*Handler, *arus.InMemoryAdminActionLog) {
+	t.Helper()
+	ctx := context.Background()
+	repo := arus.NewInMemoryUserRepository()
+	if err := repo.Save(ctx, arus.NewUser("u1")); err != nil {
+		t.Fatal(err)
+	}
+	if archived {
+		if err := repo.Archive(ctx, "u1", time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	actions := arus.NewInMemoryAdminActionLog()
+	admin := arus.NewAdmin(&arus.FinanceService{UserRepo: repo}, actions)
+	return NewHandler(admin, func(r *http.Request) (string, error) {
+		if r.Header.Get("X-Admin") == "" {
+			return "", errors.New("not an administrator")
+		}
+		return "root", nil
+	}), actions
+}
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		anyone   bool
+		archived bool
+		method   string
+		path     string
+		body     string
+		want     int
+		// Action recorded by the request, if any
+		wantAction string
+	}{
+		{name: "not an administrator", anyone: true, method: http.MethodGet, path: "/metrics", want: http.StatusForbidden},
+		{name: "create a user", method: http.MethodPost, path: "/users", want: http.StatusCreated, wantAction: "create_user"},
+		{name: "create a user in a country", method: http.MethodPost, path: "/users", body: `{"Country":"ID"}`, want: http.StatusCreated, wantAction: "create_user"},
+		{name: "malformed body", method: http.MethodPost, path: "/users", body: `{"Country":`, want: http.StatusBadRequest},
+		{name: "disable a user", method: http.MethodPost, path: "/users/u1/disable", body: `{"Reason":"abuse"}`, want: http.StatusNoContent, wantAction: "disable_user"},
+		{name: "disable a disabled user", archived: true, method: http.MethodPost, path: "/users/u1/disable", want: http.StatusConflict, wantAction: "disable_user"},
+		{name: "disable a missing user", method: http.MethodPost, path: "/users/nobody/disable", want: http.StatusNotFound, wantAction: "disable_user"},
+		{name: "enable a disabled user", archived: true, method: http.MethodPost, path: "/users/u1/enable", want: http.StatusNoContent, wantAction: "enable_user"},
+		{name: "enable an enabled user", method: http.MethodPost, path: "/users/u1/enable", want: http.StatusConflict, wantAction: "enable_user"},
+		{name: "reset allocation rules", method: http.MethodPost, path: "/users/u1/reset-allocation-rules", want: http.StatusNoContent, wantAction: "reset_allocation_rules"},
+		{name: "metrics", method: http.MethodGet, path: "/metrics", want: http.StatusOK},
+		{name: "action log", method: http.MethodGet, path: "/actions", want: http.StatusOK},
+		{name: "wrong method", method: http.MethodGet, path: "/users", want: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, actions := newTestHandler(t, tt.archived)
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if !tt.anyone {
+				req.Header.Set("X-Admin", "1")
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("%s %s = %d %s, want %d", tt.method, tt.path, rec.Code, rec.Body, tt.want)
+			}
+			recorded, err := actions.Actions(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantAction == "" {
+				if len(recorded) != 0 {
+					t.Errorf("recorded %v, want no action", recorded)
+				}
+				return
+			}
+			if len(recorded) == 0 || recorded[0].Action != tt.wantAction || recorded[0].Admin != "root" {
+				t.Errorf("recorded %v, want %s by root", recorded, tt.wantAction)
+			}
+		})
+	}
+}
+
+func TestHandlerMetrics(t *testing.T) {
+	h, _ := newTestHandler(t, true)
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("X-Admin", "1")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var metrics arus.SystemMetrics
+	if err := json.NewDecoder(rec.Body).Decode(&metrics); err != nil {
+		t.Fatal(err)
+	}
+	if metrics.Users != 1 || metrics.ArchivedUsers != 1 || metrics.Transactions != 0 {
+		t.Errorf("metrics %+v, want one archived user without transactions", metrics)
+	}
+}
@@ -0,0 +1,725 @@
+package arus
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Repositories for the parts of a user kept apart from the user document.
+// Each Save replaces everything stored for the user; saving nothing clears
+// it.
+type (
+	StatementRepository interface {
+		SaveStatements(ctx context.Context, userID string, statements []StatementRecord) error
+		Statements(ctx context.Context, userID string) ([]StatementRecord, error)
+	}
+
+	// ReconciliationRepository keeps each account's latest unbalanced
+	// reconciliation run.
+	ReconciliationRepository interface {
+		SaveReconciliations(ctx context.Context, userID string, reconciliations []Reconciliation) error
+		Reconciliations(ctx context.Context, userID string) ([]Reconciliation, error)
+	}
+
+	GoalRepository interface {
+		SaveGoals(ctx context.Context, userID string, goals []Goal) error
+		Goals(ctx context.Context, userID string) ([]Goal, error)
+	}
+
+	// RecurringRuleRepository keeps the schedules incomes are allocated on.
+	RecurringRuleRepository interface {
+		SaveRecurringRules(ctx context.Context, userID string, rules []ScheduledIncome) error
+		RecurringRules(ctx context.Context, userID string) ([]ScheduledIncome, error)
+	}
+)
+
+// How far back AggregateUserRepository.GetByID loads transactions unless
+// told otherwise: a year, which most changes and reports stay within
+const DefaultTransactionWindow = 366 * 24 * time.Hour
+
+// AggregateUserRepository stores a user across several repositories: the
+// transactions, statements, reconciliations, goals and recurring rules in
+// their own, and the rest of the user in Users. Each nil repository leaves
+// its part in the user document. GetByID reassembles the user with only
+// its recent transactions; the service loads older ones from the
+// repository when a report or change needs them.
+//
+// Saves write only the transactions added, changed or removed since the
+// user was loaded. They are atomic when the repositories share a database,
+// as those of NewSQLAggregateUserRepository do; otherwise the parts are
+// saved before the user document, so a failed save can leave them ahead of
+// it.
+type AggregateUserRepository struct {
+	// Encrypts bank account numbers at rest, in the user document and every
+	// part that holds them; nil stores them in plain
+	Keys KeyManager
+
+	Users           UserRepository
+	Transactions    TransactionRepository
+	Statements      StatementRepository
+	Reconciliations ReconciliationRepository
+	Goals           GoalRepository
+	RecurringRules  RecurringRuleRepository
+
+	// How far back GetByID loads transactions, from the start of the
+	// user's month then; zero uses DefaultTransactionWindow
+	Window time.Duration
+	// Source of the current time the window ends at; nil uses the wall clock
+	Clock Clock
+
+	// Database the repositories share, whose transactions saves run in
+	db *sql.DB
+}
+
+// NewSQLAggregateUserRepository stores every part of users in its own table
+// of db, whose schema must be up to date; see Migrate. Account numbers are
+// encrypted under keys, unless nil.
+func NewSQLAggregateUserRepository(ctx context.Context, db *sql.DB, dialect SQLDialect, keys KeyManager) (*AggregateUserRepository, error) {
+	users, err := NewSQLUserRepository(ctx, db, dialect)
+	if err != nil {
+		return nil, err
+	}
+	r := &AggregateUserRepository{Keys: keys, Users: users, db: db}
+	if r.Transactions, err = NewSQLTransactionRepository(ctx, db, dialect); err != nil {
+		return nil, err
+	}
+	if r.Statements, err = NewSQLStatementRepository(ctx, db, dialect); err != nil {
+		return nil, err
+	}
+	if r.Reconciliations, err = NewSQLReconciliationRepository(ctx, db, dialect); err != nil {
+		return nil, err
+	}
+	if r.Goals, err = NewSQLGoalRepository(ctx, db, dialect); err != nil {
+		return nil, err
+	}
+	if r.RecurringRules, err = NewSQLRecurringRuleRepository(ctx, db, dialect); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *AggregateUserRepository) GetByID(ctx context.Context, id string) (*User, error) {
+	user, err := r.Users.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// load fills in the parts of user kept in the other repositories.
+func (r *AggregateUserRepository) load(ctx context.Context, user *User) error {
+	var err error
+	if r.Transactions != nil {
+		if err := r.loadRecent(ctx, user); err != nil {
+			return err
+		}
+	}
+	if r.Statements != nil {
+		if user.StatementHistory, err = r.Statements.Statements(ctx, user.ID); err != nil {
+			return fmt.Errorf("loading statements of user %s: %w", user.ID, err)
+		}
+	}
+	if r.Reconciliations != nil {
+		if user.OpenReconciliations, err = r.Reconciliations.Reconciliations(ctx, user.ID); err != nil {
+			return fmt.Errorf("loading reconciliations of user %s: %w", user.ID, err)
+		}
+	}
+	if r.Goals != nil {
+		if user.Goals, err = r.Goals.Goals(ctx, user.ID); err != nil {
+			return fmt.Errorf("loading goals of user %s: %w", user.ID, err)
+		}
+	}
+	if r.RecurringRules != nil {
+		if user.ScheduledIncomes, err = r.RecurringRules.RecurringRules(ctx, user.ID); err != nil {
+			return fmt.Errorf("loading recurring rules of user %s: %w", user.ID, err)
+		}
+	}
+	if r.Keys != nil {
+		return decryptAccountNumbers(ctx, r.Keys, user)
+	}
+	return nil
+}
+
+func (r *AggregateUserRepository) transactionRepository() TransactionRepository {
+	return r.Transactions
+}
+
+// Latest date a transaction can have, ending the period of recent ones
+var endOfTime = time.Date(9999, time.December, 31, 23, 59, 59, 0, time.UTC)
+
+// loadRecent fills in the user's transactions dated from the start of its
+// month Window ago. Monthly totals and review items keyed by position are
+// rebuilt from the whole history, so users whose need rebuilding get all of
+// theirs, as do documents still carrying the transactions stored before
+// they were kept apart; the next save moves those into the repository.
+func (r *AggregateUserRepository) loadRecent(ctx context.Context, user *User) error {
+	inline := [2][]Transaction{user.Incomes, user.Expenses}
+	user.Incomes, user.Expenses = []Transaction{}, []Transaction{}
+	user.stored, user.historyFrom, user.unloaded = map[string]string{}, time.Time{}, 0
+
+	if len(inline[0]) > 0 || len(inline[1]) > 0 || !user.totalsCurrent() || user.unresolvedReviewItems() {
+		if err := r.loadTransactions(ctx, user, TransactionQuery{}); err != nil {
+			return err
+		}
+	} else {
+		window := r.Window
+		if window <= 0 {
+			window = DefaultTransactionWindow
+		}
+		since := user.MonthlyPeriodOf(clockOrSystem(r.Clock).Now().Add(-window)).StartDate
+		if err := r.loadTransactions(ctx, user, TransactionQuery{Period: &Period{StartDate: since, EndDate: endOfTime}}); err != nil {
+			return err
+		}
+		before := TransactionQuery{Period: &Period{EndDate: since.Add(-time.Nanosecond)}, Limit: 1}
+		for _, kind := range []TransactionKind{TransactionIncome, TransactionExpense} {
+			page, err := r.Transactions.QueryTransactions(ctx, user.ID, kind, before)
+			if err != nil {
+				return fmt.Errorf("counting %s transactions of user %s: %w", kind, user.ID, err)
+			}
+			user.unloaded += page.TotalCount
+		}
+		if user.unloaded > 0 {
+			user.historyFrom = since
+		}
+	}
+
+	// Untracked, so saved into the repository
+	user.Incomes = append(user.Incomes, notLoaded(inline[0], user.Incomes)...)
+	user.Expenses = append(user.Expenses, notLoaded(inline[1], user.Expenses)...)
+	slices.SortStableFunc(user.Incomes, compareTransactions)
+	slices.SortStableFunc(user.Expenses, compareTransactions)
+	user.resolveReviewItems()
+	return nil
+}
+
+// loadTransactions adds the user's stored transactions matching query that
+// were not loaded yet, keeping each kind in date order. Those loaded and
+// since removed from the user stay out.
+func (r *AggregateUserRepository) loadTransactions(ctx context.Context, user *User, query TransactionQuery) error {
+	if r.Transactions == nil {
+		return nil
+	}
+	var loaded [2][]Transaction
+	for i, kind := range []TransactionKind{TransactionIncome, TransactionExpense} {
+		page, err := r.Transactions.QueryTransactions(ctx, user.ID, kind, query)
+		if err != nil {
+			return fmt.Errorf("loading %s transactions of user %s: %w", kind, user.ID, err)
+		}
+		loaded[i] = slices.DeleteFunc(notLoaded(page.Transactions, user.transactionsOf(kind)), func(tx Transaction) bool {
+			_, seen := user.stored[tx.ID]
+			return seen
+		})
+	}
+	if query.Period == nil && !query.filtered() {
+		user.historyFrom, user.unloaded = time.Time{}, 0
+	}
+	if len(loaded[0]) == 0 && len(loaded[1]) == 0 {
+		return nil
+	}
+
+	fingerprints, err := fingerprintTransactions(loaded[0], loaded[1])
+	if err != nil {
+		return err
+	}
+	stored := maps.Clone(user.stored)
+	if stored == nil {
+		stored = make(map[string]string)
+	}
+	maps.Copy(stored, fingerprints)
+	user.stored = stored
+	user.unloaded = max(user.unloaded-len(fingerprints), 0)
+
+	// Held transactions come after loaded ones of the same date, which
+	// were recorded before them
+	user.Incomes = slices.Concat(loaded[0], user.Incomes)
+	user.Expenses = slices.Concat(loaded[1], user.Expenses)
+	slices.SortStableFunc(user.Incomes, compareTransactions)
+	slices.SortStableFunc(user.Expenses, compareTransactions)
+	return nil
+}
+
+// fingerprintTransactions hashes the encoding of each transaction, by ID,
+// for saves to tell which changed.
+func fingerprintTransactions(lists ...[]Transaction) (map[string]string, error) {
+	fingerprints := make(map[string]string)
+	for _, transactions := range lists {
+		for _, tx := range transactions {
+			data, err := json.Marshal(tx)
+			if err != nil {
+				return nil, fmt.Errorf("encoding transaction %s: %w", tx.ID, err)
+			}
+			sum := sha256.Sum256(data)
+			fingerprints[tx.ID] = string(sum[:])
+		}
+	}
+	return fingerprints, nil
+}
+
+// inTx runs fn in one database transaction when the repositories share a
+// database, so what fn saves commits or fails as a whole.
+func (r *AggregateUserRepository) inTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if r.db == nil {
+		return fn(ctx)
+	}
+	return inSQLTx(ctx, r.db, func(ctx context.Context, _ *sql.Tx) error { return fn(ctx) })
+}
+
+func (r *AggregateUserRepository) Save(ctx context.Context, user *User) error {
+	var stored map[string]string
+	err := r.inTx(ctx, func(ctx context.Context) error {
+		var err error
+		stored, err = r.save(ctx, user)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if r.Transactions != nil {
+		user.stored = stored
+	}
+	return nil
+}
+
+// save saves the user and returns the fingerprints of its transactions as
+// stored.
+func (r *AggregateUserRepository) save(ctx context.Context, user *User) (map[string]string, error) {
+	var stored map[string]string
+	if r.Transactions != nil {
+		var err error
+		if stored, err = r.saveTransactions(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+
+	document := *user
+	if r.Transactions != nil {
+		document.Incomes, document.Expenses = nil, nil
+	}
+	if r.Keys != nil {
+		// Transactions hold no account numbers, and are left out of the
+		// copy encrypting makes
+		encrypted, err := encryptAccountNumbers(ctx, r.Keys, &document)
+		if err != nil {
+			return nil, err
+		}
+		document = *encrypted
+	}
+	if err := r.saveParts(ctx, &document); err != nil {
+		return nil, err
+	}
+
+	if r.Statements != nil {
+		document.StatementHistory = nil
+	}
+	if r.Reconciliations != nil {
+		document.OpenReconciliations = nil
+	}
+	if r.Goals != nil {
+		document.Goals = nil
+	}
+	if r.RecurringRules != nil {
+		document.ScheduledIncomes = nil
+	}
+	return stored, r.Users.Save(ctx, &document)
+}
+
+// replace saves user, loaded from another repository with all of its
+// transactions, in place of whatever this one holds for it.
+func (r *AggregateUserRepository) replace(ctx context.Context, user *User) error {
+	copied := *user
+	copied.stored, copied.historyFrom, copied.unloaded = nil, time.Time{}, 0
+	return r.inTx(ctx, func(ctx context.Context) error {
+		if r.Transactions != nil {
+			if err := r.Transactions.DeleteTransactions(ctx, user.ID); err != nil {
+				return err
+			}
+		}
+		_, err := r.save(ctx, &copied)
+		return err
+	})
+}
+
+// saveTransactions writes the user's transactions that are new or changed
+// since it was loaded, and deletes those loaded that it no longer holds. A
+// user not loaded from the repository has all of its transactions written.
+func (r *AggregateUserRepository) saveTransactions(ctx context.Context, user *User) (map[string]string, error) {
+	stored, err := fingerprintTransactions(user.Incomes, user.Expenses)
+	if err != nil {
+		return nil, err
+	}
+	changed := func(transactions []Transaction) []Transaction {
+		var changed []Transaction
+		for _, tx := range transactions {
+			if fingerprint, loaded := user.stored[tx.ID]; !loaded || fingerprint != stored[tx.ID] {
+				changed = append(changed, tx)
+			}
+		}
+		return changed
+	}
+	if err := r.Transactions.SaveTransactions(ctx, user.ID, TransactionIncome, changed(user.Incomes)...); err != nil {
+		return nil, err
+	}
+	if err := r.Transactions.SaveTransactions(ctx, user.ID, TransactionExpense, changed(user.Expenses)...); err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for id := range user.stored {
+		if _, held := stored[id]; !held {
+			removed = append(removed, id)
+		}
+	}
+	if len(removed) > 0 {
+		slices.Sort(removed)
+		if err := r.Transactions.DeleteTransactions(ctx, user.ID, removed...); err != nil {
+			return nil, err
+		}
+	}
+	return stored, nil
+}
+
+// saveParts saves the parts of user kept in the other repositories, apart
+// from its transactions.
+func (r *AggregateUserRepository) saveParts(ctx context.Context, user *User) error {
+	if r.Statements != nil {
+		if err := r.Statements.SaveStatements(ctx, user.ID, user.StatementHistory); err != nil {
+			return err
+		}
+	}
+	if r.Reconciliations != nil {
+		if err := r.Reconciliations.SaveReconciliations(ctx, user.ID, user.OpenReconciliations); err != nil {
+			return err
+		}
+	}
+	if r.Goals != nil {
+		if err := r.Goals.SaveGoals(ctx, user.ID, user.Goals); err != nil {
+			return err
+		}
+	}
+	if r.RecurringRules != nil {
+		if err := r.RecurringRules.SaveRecurringRules(ctx, user.ID, user.ScheduledIncomes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *AggregateUserRepository) ForEach(ctx context.Context, fn func(user *User) error) error {
+	iterator, ok := r.Users.(UserIterator)
+	if !ok {
+		return errors.New("repository does not support iterating users")
+	}
+	return iterator.ForEach(ctx, func(user *User) error {
+		if err := r.load(ctx, user); err != nil {
+			return err
+		}
+		return fn(user)
+	})
+}
+
+func (r *AggregateUserRepository) archive() (UserArchive, error) {
+	archive, ok := r.Users.(UserArchive)
+	if !ok {
+		return nil, errors.New("repository does not support archiving users")
+	}
+	return archive, nil
+}
+
+func (r *AggregateUserRepository) Archive(ctx context.Context, id string, at time.Time) error {
+	archive, err := r.archive()
+	if err != nil {
+		return err
+	}
+	return archive.Archive(ctx, id, at)
+}
+
+func (r *AggregateUserRepository) Restore(ctx context.Context, id string) (*User, error) {
+	archive, err := r.archive()
+	if err != nil {
+		return nil, err
+	}
+	user, err := archive.Restore(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Delete removes the user and every part of it.
+func (r *AggregateUserRepository) Delete(ctx context.Context, id string) error {
+	archive, err := r.archive()
+	if err != nil {
+		return err
+	}
+	return r.inTx(ctx, func(ctx context.Context) error {
+		if err := archive.Delete(ctx, id); err != nil {
+			return err
+		}
+		if r.Transactions != nil {
+			if err := r.Transactions.DeleteTransactions(ctx, id); err != nil {
+				return err
+			}
+		}
+		// Saving an empty user clears the other parts
+		return r.saveParts(ctx, &User{ID: id})
+	})
+}
+
+// inMemoryLists keeps a list per user as JSON, so like a database it hands
+// out copies.
+type inMemoryLists[T any] struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+func (l *inMemoryLists[T]) replace(ctx context.Context, userID string, items []T) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.data == nil {
+		l.data = make(map[string][]byte)
+	}
+	if len(items) == 0 {
+		delete(l.data, userID)
+		return nil
+	}
+	l.data[userID] = data
+	return nil
+}
+
+func (l *inMemoryLists[T]) list(ctx context.Context, userID string) ([]T, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l.mu.RLock()
+	data, exists := l.data[userID]
+	l.mu.RUnlock()
+
+	if !exists {
+		return nil, nil
+	}
+	var items []T
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+type InMemoryStatementRepository struct {
+	lists inMemoryLists[StatementRecord]
+}
+
+func NewInMemoryStatementRepository() *InMemoryStatementRepository {
+	return &InMemoryStatementRepository{}
+}
+
+func (r *InMemoryStatementRepository) SaveStatements(ctx context.Context, userID string, statements []StatementRecord) error {
+	return r.lists.replace(ctx, userID, statements)
+}
+
+func (r *InMemoryStatementRepository) Statements(ctx context.Context, userID string) ([]StatementRecord, error) {
+	return r.lists.list(ctx, userID)
+}
+
+type InMemoryReconciliationRepository struct{ lists inMemoryLists[Reconciliation] }
+
+func NewInMemoryReconciliationRepository() *InMemoryReconciliationRepository {
+	return &InMemoryReconciliationRepository{}
+}
+
+func (r *InMemoryReconciliationRepository) SaveReconciliations(ctx context.Context, userID string, reconciliations []Reconciliation) error {
+	return r.lists.replace(ctx, userID, reconciliations)
+}
+
+func (r *InMemoryReconciliationRepository) Reconciliations(ctx context.Context, userID string) ([]Reconciliation, error) {
+	return r.lists.list(ctx, userID)
+}
+
+type InMemoryGoalRepository struct{ lists inMemoryLists[Goal] }
+
+func NewInMemoryGoalRepository() *InMemoryGoalRepository {
+	return &InMemoryGoalRepository{}
+}
+
+func (r *InMemoryGoalRepository) SaveGoals(ctx context.Context, userID string, goals []Goal) error {
+	return r.lists.replace(ctx, userID, goals)
+}
+
+func (r *InMemoryGoalRepository) Goals(ctx context.Context, userID string) ([]Goal, error) {
+	return r.lists.list(ctx, userID)
+}
+
+type InMemoryRecurringRuleRepository struct {
+	lists inMemoryLists[ScheduledIncome]
+}
+
+func NewInMemoryRecurringRuleRepository() *InMemoryRecurringRuleRepository {
+	return &InMemoryRecurringRuleRepository{}
+}
+
+func (r *InMemoryRecurringRuleRepository) SaveRecurringRules(ctx context.Context, userID string, rules []ScheduledIncome) error {
+	return r.lists.replace(ctx, userID, rules)
+}
+
+func (r *InMemoryRecurringRuleRepository) RecurringRules(ctx context.Context, userID string) ([]ScheduledIncome, error) {
+	return r.lists.list(ctx, userID)
+}
+
+// sqlLists keeps a list per user in table, one JSON document per row in
+// list order.
+type sqlLists[T any] struct {
+	db      *sql.DB
+	dialect SQLDialect
+	table   string
+}
+
+func newSQLLists[T any](ctx context.Context, db *sql.DB, dialect SQLDialect, table string) (sqlLists[T], error) {
+	if err := checkSchema(ctx, db); err != nil {
+		return sqlLists[T]{}, err
+	}
+	return sqlLists[T]{db: db, dialect: dialect, table: table}, nil
+}
+
+func (l sqlLists[T]) replace(ctx context.Context, userID string, items []T) error {
+	return inSQLTx(ctx, l.db, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, l.dialect.rebind(`DELETE FROM `+l.table+` WHERE user_id = ?`), userID); err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		stmt, err := tx.PrepareContext(ctx, l.dialect.rebind(`INSERT INTO `+l.table+` (user_id, position, data) VALUES (?, ?, ?)`))
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for i, item := range items {
+			data, err := json.Marshal(item)
+			if err != nil {
+				return fmt.Errorf("encoding %s of user %s: %w", l.table, userID, err)
+			}
+			if _, err := stmt.ExecContext(ctx, userID, i, string(data)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (l sqlLists[T]) list(ctx context.Context, userID string) ([]T, error) {
+	rows, err := l.db.QueryContext(ctx, l.dialect.rebind(`SELECT data FROM `+l.table+` WHERE user_id = ? ORDER BY position`), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []T
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var item T
+		if err := json.Unmarshal([]byte(data), &item); err != nil {
+			return nil, fmt.Errorf("decoding %s of user %s: %w", l.table, userID, err)
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+type SQLStatementRepository struct{ lists sqlLists[StatementRecord] }
+
+func NewSQLStatementRepository(ctx context.Context, db *sql.DB, dialect SQLDialect) (*SQLStatementRepository, error) {
+	lists, err := newSQLLists[StatementRecord](ctx, db, dialect, "statements")
+	if err != nil {
+		return nil, err
+	}
+	return &SQLStatementRepository{lists: lists}, nil
+}
+
+func (r *SQLStatementRepository) SaveStatements(ctx context.Context, userID string, statements []StatementRecord) error {
+	return r.lists.replace(ctx, userID, statements)
+}
+
+func (r *SQLStatementRepository) Statements(ctx context.Context, userID string) ([]StatementRecord, error) {
+	return r.lists.list(ctx, userID)
+}
+
+type SQLReconciliationRepository struct{ lists sqlLists[Reconciliation] }
+
+func NewSQLReconciliationRepository(ctx context.Context, db *sql.DB, dialect SQLDialect) (*SQLReconciliationRepository, error) {
+	lists, err := newSQLLists[Reconciliation](ctx, db, dialect, "reconciliations")
+	if err != nil {
+		return nil, err
+	}
+	return &SQLReconciliationRepository{lists: lists}, nil
+}
+
+func (r *SQLReconciliationRepository) SaveReconciliations(ctx context.Context, userID string, reconciliations []Reconciliation) error {
+	return r.lists.replace(ctx, userID, reconciliations)
+}
+
+func (r *SQLReconciliationRepository) Reconciliations(ctx context.Context, userID string) ([]Reconciliation, error) {
+	return r.lists.list(ctx, userID)
+}
+
+type SQLGoalRepository struct{ lists sqlLists[Goal] }
+
+func NewSQLGoalRepository(ctx context.Context, db *sql.DB, dialect SQLDialect) (*SQLGoalRepository, error) {
+	lists, err := newSQLLists[Goal](ctx, db, dialect, "goals")
+	if err != nil {
+		return nil, err
+	}
+	return &SQLGoalRepository{lists: lists}, nil
+}
+
+func (r *SQLGoalRepository) SaveGoals(ctx context.Context, userID string, goals []Goal) error {
+	return r.lists.replace(ctx, userID, goals)
+}
+
+func (r *SQLGoalRepository) Goals(ctx context.Context, userID string) ([]Goal, error) {
+	return r.lists.list(ctx, userID)
+}
+
+type SQLRecurringRuleRepository struct{ lists sqlLists[ScheduledIncome] }
+
+func NewSQLRecurringRuleRepository(ctx context.Context, db *sql.DB, dialect SQLDialect) (*SQLRecurringRuleRepository, error) {
+	lists, err := newSQLLists[ScheduledIncome](ctx, db, dialect, "recurring_rules")
+	if err != nil {
+		return nil, err
+	}
+	return &SQLRecurringRuleRepository{lists: lists}, nil
+}
+
+func (r *SQLRecurringRuleRepository) SaveRecurringRules(ctx context.Context, userID string, rules []ScheduledIncome) error {
+	return r.lists.replace(ctx, userID, rules)
+}
+
+func (r *SQLRecurringRuleRepository) RecurringRules(ctx context.Context, userID string) ([]ScheduledIncome, error) {
+	return r.lists.list(ctx, userID)
+}
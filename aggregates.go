@@ -0,0 +1,197 @@
+package arus
+
+import (
+	"context"
+	"time"
+)
+
+// PeriodTotals are the precomputed totals of a period. Unlike a
+// PeriodSummary they don't list the transactions, so reading them does not
+// depend on the size of the history.
+type PeriodTotals struct {
+	Period       Period
+	TotalIncome  Money
+	TotalExpense Money
+	Net          Money
+	// How much each category covered of the period's expenses, as positive
+	// amounts
+	Deductions map[CategoryType]Money
+	Incomes    int
+	Expenses   int
+	// Totals of transactions in other currencies, which are left out of the
+	// totals above, by currency
+	Foreign map[string]CurrencyTotals `json:",omitempty"`
+}
+
+// CurrencyTotals are the totals of a period's transactions in one currency.
+type CurrencyTotals struct {
+	TotalIncome  Money
+	TotalExpense Money
+	Net          Money
+}
+
+// addForeign adds amount, in a currency other than the one of the totals
+// being added up, to the totals of its own currency.
+func addForeign(foreign map[string]CurrencyTotals, amount Money, expense bool) map[string]CurrencyTotals {
+	if foreign == nil {
+		foreign = make(map[string]CurrencyTotals)
+	}
+	totals, exists := foreign[amount.Currency]
+	if !exists {
+		zero := NewMoneyZero(amount.Currency)
+		totals = CurrencyTotals{TotalIncome: zero, TotalExpense: zero, Net: zero}
+	}
+	if expense {
+		totals.TotalExpense = totals.TotalExpense.Add(amount)
+	} else {
+		totals.TotalIncome = totals.TotalIncome.Add(amount)
+	}
+	totals.Net = totals.TotalIncome.Add(totals.TotalExpense)
+	foreign[amount.Currency] = totals
+	return foreign
+}
+
+// MonthlyTotals are the user's totals per month, kept up to date as
+// transactions are recorded. Months are keyed by their start date and cut
+// with the time zone and fiscal month start they were built with.
+type MonthlyTotals struct {
+	Timezone         string
+	FiscalMonthStart int
+	Months           map[string]PeriodTotals
+}
+
+func monthKey(period Period) string {
+	return period.StartDate.Format(time.DateOnly)
+}
+
+// totalsCurrent reports whether the user's monthly totals match their
+// history and period settings.
+func (u *User) totalsCurrent() bool {
+	return u.Totals != nil && u.Totals.Timezone == u.Timezone && u.Totals.FiscalMonthStart == u.FiscalMonthStart
+}
+
+// RebuildTotals recomputes the monthly totals from the history, as needed
+// after the period settings change. Months before the loaded history keep
+// their totals, which only stay right while the settings do.
+func (u *User) RebuildTotals() {
+	months := make(map[string]PeriodTotals)
+	if !u.historyFrom.IsZero() && u.totalsCurrent() {
+		loadedFrom := monthKey(u.MonthlyPeriodOf(u.historyFrom))
+		for key, totals := range u.Totals.Months {
+			if key < loadedFrom {
+				months[key] = totals
+			}
+		}
+	}
+	u.Totals = &MonthlyTotals{
+		Timezone:         u.Timezone,
+		FiscalMonthStart: u.FiscalMonthStart,
+		Months:           months,
+	}
+	for _, income := range u.Incomes {
+		u.addToTotals(income, false)
+	}
+	for _, expense := range u.Expenses {
+		u.addToTotals(expense, true)
+	}
+	// Archived months keep the totals they were archived with
+	for _, archived := range u.ArchivedPeriods {
+		key := monthKey(archived.Period)
+		if _, exists := u.Totals.Months[key]; !exists {
+			u.Totals.Months[key] = archived.Totals
+		}
+	}
+}
+
+// recordTotals adds a transaction that was just appended to the history. If
+// the totals are missing or stale they are rebuilt, which counts it too.
+func (u *User) recordTotals(tx Transaction, expense bool) {
+	if !u.totalsCurrent() {
+		u.RebuildTotals()
+		return
+	}
+	u.addToTotals(tx, expense)
+}
+
+func (u *User) addToTotals(tx Transaction, expense bool) {
+	if !tx.Counts() {
+		return
+	}
+	period := u.MonthlyPeriodOf(tx.Date)
+	key := monthKey(period)
+	totals, exists := u.Totals.Months[key]
+	if !exists {
+		currency := u.Currency()
+		totals = PeriodTotals{
+			Period:       period,
+			TotalIncome:  NewMoneyZero(currency),
+			TotalExpense: NewMoneyZero(currency),
+			Net:          NewMoneyZero(currency),
+			Deductions:   make(map[CategoryType]Money),
+		}
+	}
+
+	if tx.Amount.Currency != totals.TotalIncome.Currency {
+		totals.Foreign = addForeign(totals.Foreign, tx.Spent(), expense)
+		if expense {
+			totals.Expenses++
+		} else {
+			totals.Incomes++
+		}
+	} else if expense {
+		totals.TotalExpense = totals.TotalExpense.Add(tx.Spent())
+		totals.Expenses++
+		for _, deduction := range tx.Deductions {
+			total, ok := totals.Deductions[deduction.Category]
+			if !ok {
+				total = NewMoneyZero(deduction.Amount.Currency)
+			}
+			totals.Deductions[deduction.Category] = total.Add(deduction.Amount)
+		}
+	} else {
+		totals.TotalIncome = totals.TotalIncome.Add(tx.Amount)
+		totals.Incomes++
+	}
+	totals.Net = totals.TotalIncome.Add(totals.TotalExpense)
+	u.Totals.Months[key] = totals
+}
+
+// MonthTotals returns the totals of the user's month. They are read from
+// the monthly totals when those are current and computed from the history
+// otherwise.
+func (u *User) MonthTotals(year int, month time.Month) PeriodTotals {
+	period := u.MonthlyPeriod(year, month)
+	if !u.totalsCurrent() {
+		summary := u.GetPeriodSummary(period)
+		return PeriodTotals{
+			Period:       period,
+			TotalIncome:  summary.TotalIncome,
+			TotalExpense: summary.TotalExpense,
+			Net:          summary.Net,
+			Deductions:   summary.Deductions,
+			Incomes:      len(summary.Incomes),
+			Expenses:     len(summary.Expenses),
+			Foreign:      summary.Foreign,
+		}
+	}
+
+	totals, exists := u.Totals.Months[monthKey(period)]
+	if !exists {
+		zero := NewMoneyZero(u.Currency())
+		return PeriodTotals{Period: period, TotalIncome: zero, TotalExpense: zero, Net: zero, Deductions: map[CategoryType]Money{}}
+	}
+	totals.TotalIncome = totals.TotalIncome.Round()
+	totals.TotalExpense = totals.TotalExpense.Round()
+	totals.Net = totals.Net.Round()
+	return totals
+}
+
+func (s *FinanceService) MonthTotals(ctx context.Context, userID string, year int, month time.Month) (PeriodTotals, error) {
+	defer s.readLockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return PeriodTotals{}, err
+	}
+	return user.MonthTotals(year, month), nil
+}
@@ -0,0 +1,126 @@
+package arus
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Events buffered for the alert dispatcher before it starts missing them
+const alertBuffer = 256
+
+// UpcomingBill is a recurring bill falling due soon, announced with
+// EventBillUpcoming.
+type UpcomingBill struct {
+	BillID  string `json:",omitempty"`
+	Name    string
+	Amount  Money
+	Due     time.Time
+	Autopay bool `json:",omitempty"`
+}
+
+// Alert returns the notification telling the user about event, and false
+// for events that are not worth interrupting them for.
+func Alert(event Event) (Notification, bool) {
+	switch data := event.Data.(type) {
+	case Transaction:
+		switch event.Type {
+		case EventBudgetExceeded:
+			over := data.Amount.Abs().Subtract(data.DeductedFrom(Expense))
+			return Notification{
+				Subject: "You went over your spending budget",
+				Body: fmt.Sprintf("%s of %s (%s) was not covered by your Expense category and came out of your other categories.",
+					over.String(), alertDescription(data), data.Amount.Abs().String()),
+			}, true
+		case EventEmergencyTapped:
+			return Notification{
+				Subject: "Your emergency fund was tapped",
+				Body: fmt.Sprintf("%s of %s came out of your emergency fund.",
+					data.DeductedFrom(Emergency).String(), alertDescription(data)),
+			}, true
+		}
+	case Reconciliation:
+		if event.Type == EventReconciled && !data.Balanced() {
+			return Notification{
+				Subject: "Your balances don't match your bank",
+				Body: fmt.Sprintf("%s reports %s but %s is tracked for it, a difference of %s.",
+					data.BankAccount.Masked(), data.Actual.String(), data.Tracked.String(), data.Difference.String()),
+			}, true
+		}
+	case Goal:
+		if event.Type == EventGoalReached {
+			return Notification{
+				Subject: "Goal reached: " + data.Name,
+				Body:    fmt.Sprintf("You have saved %s for %s.", data.Target.String(), data.Name),
+			}, true
+		}
+	case UpcomingBill:
+		if event.Type == EventBillUpcoming {
+			return Notification{
+				Subject: "Upcoming bill: " + data.Name,
+				Body:    fmt.Sprintf("%s of %s is due on %s.", data.Name, data.Amount.String(), data.Due.Format("2006-01-02")),
+			}, true
+		}
+	case LowBalance:
+		if event.Type == EventLowBalance {
+			return Notification{
+				Subject: "Your " + data.Category.String() + " balance is low",
+				Body: fmt.Sprintf("Your %s category is down to %s, below the %s you set as its low balance.",
+					data.Category, data.Balance.String(), data.Threshold.String()),
+			}, true
+		}
+	case BillCalendar:
+		if event.Type == EventBillsUncovered && !data.Covered() {
+			first := data.Uncovered[0]
+			return Notification{
+				Subject: "You can't cover your upcoming bills",
+				Body: fmt.Sprintf("Your Expense category is %s short of the bills due by %s, starting with %s due on %s.",
+					data.Shortfalls[0].String(), data.Until.Format("2006-01-02"), first.Name, first.Due.Format("2006-01-02")),
+			}, true
+		}
+	}
+	return Notification{}, false
+}
+
+func alertDescription(tx Transaction) string {
+	if tx.Description == "" {
+		return "an expense on " + tx.Date.Format("2006-01-02")
+	}
+	return fmt.Sprintf("%q", tx.Description)
+}
+
+// AlertDispatcher delivers alerts about every user's ledger events to
+// notification channels, such as email and push.
+type AlertDispatcher struct {
+	Events *EventBus
+	// Every alert goes to every channel
+	Notifiers []Notifier
+	// Told about failed deliveries; nil ignores them
+	OnError func(error)
+}
+
+// Run delivers alerts until ctx is cancelled. Deliveries happen outside the
+// ledger, so a slow channel only delays alerts; past alertBuffer pending
+// events, new ones are missed.
+func (d *AlertDispatcher) Run(ctx context.Context) {
+	events, cancel := d.Events.SubscribeAll(alertBuffer)
+	defer cancel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			notification, ok := Alert(event)
+			if !ok {
+				continue
+			}
+			for _, notifier := range d.Notifiers {
+				err := notifier.Notify(ctx, event.UserID, notification)
+				if err != nil && d.OnError != nil {
+					d.OnError(fmt.Errorf("alerting user %s of %s: %w", event.UserID, event.Type, err))
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package arus
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// InEffect reports whether the rule applies to incomes dated date.
+func (r AllocationRule) InEffect(date time.Time) bool {
+	if !r.EffectiveFrom.IsZero() && date.Before(r.EffectiveFrom) {
+		return false
+	}
+	return r.EffectiveUntil.IsZero() || date.Before(r.EffectiveUntil)
+}
+
+// RulesAt returns the allocation rules in effect for an income dated date.
+func (u *User) RulesAt(date time.Time) []AllocationRule {
+	var rules []AllocationRule
+	for _, rule := range u.AllocationRules {
+		if rule.InEffect(date) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// PlanAllocationRules replaces the allocation rules from a date on, e.g.
+// "starting January, save 30%". Rules in effect at from end there, rules
+// planned to start later are dropped, and earlier ones are kept, so
+// incomes dated before from are still allocated the old way.
+func (u *User) PlanAllocationRules(from time.Time, rules []AllocationRule) error {
+	if from.IsZero() {
+		return errors.New("planned allocation rules need a start date")
+	}
+	total := decimal.Zero
+	for _, rule := range rules {
+		if _, exists := u.Categories[rule.CategoryType]; !exists {
+			return &CategoryNotFoundError{Category: rule.CategoryType}
+		}
+		if rule.Percentage.IsNegative() {
+			return errors.New("allocation percentages must not be negative")
+		}
+		if !rule.EffectiveUntil.IsZero() && !rule.EffectiveUntil.After(from) {
+			return errors.New("planned allocation rules must end after they start")
+		}
+		total = total.Add(rule.Percentage)
+	}
+	if total.GreaterThan(decimal.NewFromInt(1)) {
+		return errors.New("total allocation percentages exceed 100%")
+	}
+
+	var kept []AllocationRule
+	for _, rule := range u.AllocationRules {
+		if !rule.EffectiveFrom.IsZero() && !rule.EffectiveFrom.Before(from) {
+			continue
+		}
+		if rule.EffectiveUntil.IsZero() || rule.EffectiveUntil.After(from) {
+			rule.EffectiveUntil = from
+		}
+		kept = append(kept, rule)
+	}
+	for _, rule := range rules {
+		rule.EffectiveFrom = from
+		kept = append(kept, rule)
+	}
+	u.AllocationRules = kept
+	return nil
+}
+
+// PlanAllocationRules sets the allocation rules incomes dated from on are
+// allocated with. A zero from means now.
+func (s *FinanceService) PlanAllocationRules(ctx context.Context, userID string, from time.Time, rules []AllocationRule) error {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if from.IsZero() {
+		from = s.now()
+	}
+	if err := user.PlanAllocationRules(from, rules); err != nil {
+		return err
+	}
+
+	if err := s.save(ctx, user, "plan_allocation_rules"); err != nil {
+		return err
+	}
+	s.log().InfoContext(ctx, "planned allocation rules", LogKeyUserID, userID, "from", from)
+	s.Telemetry.Track(ctx, "allocation", "plan_rules", userID, nil)
+	return nil
+}
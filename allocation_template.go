@@ -0,0 +1,257 @@
+package arus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// TemplateBucket is one share of an allocation template, such as "needs"
+// in 50/30/20. Category is where the bucket goes unless mapped elsewhere.
+type TemplateBucket struct {
+	Name       string
+	Percentage decimal.Decimal
+	Category   CategoryType
+}
+
+// AllocationTemplate is a named split of income into buckets that applying
+// turns into the user's allocation rules.
+type AllocationTemplate struct {
+	Name        string
+	Description string `json:",omitempty"`
+	Buckets     []TemplateBucket
+}
+
+func (t AllocationTemplate) Validate() error {
+	if strings.TrimSpace(t.Name) == "" {
+		return errors.New("allocation template name is required")
+	}
+	if len(t.Buckets) == 0 {
+		return fmt.Errorf("allocation template %s has no buckets", t.Name)
+	}
+	total := decimal.Zero
+	seen := make(map[string]bool)
+	for _, bucket := range t.Buckets {
+		key := strings.ToLower(bucket.Name)
+		if key == "" || seen[key] {
+			return fmt.Errorf("allocation template %s has a missing or duplicate bucket name %q", t.Name, bucket.Name)
+		}
+		seen[key] = true
+		if !bucket.Percentage.IsPositive() {
+			return fmt.Errorf("bucket %s of allocation template %s must have a positive percentage", bucket.Name, t.Name)
+		}
+		total = total.Add(bucket.Percentage)
+	}
+	if total.GreaterThan(decimal.NewFromInt(1)) {
+		return fmt.Errorf("allocation template %s allocates more than 100%%", t.Name)
+	}
+	return nil
+}
+
+// Rules returns the allocation rules of the template, with buckets sent to
+// the categories in mapping (keyed by bucket name, case-insensitively) or
+// else to their default category. Buckets sharing a category are merged
+// into one rule.
+func (t AllocationTemplate) Rules(mapping map[string]CategoryType) ([]AllocationRule, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	mapped := make(map[string]CategoryType, len(mapping))
+	for name, category := range mapping {
+		mapped[strings.ToLower(name)] = category
+	}
+
+	var rules []AllocationRule
+	for _, bucket := range t.Buckets {
+		category := bucket.Category
+		if target, ok := mapped[strings.ToLower(bucket.Name)]; ok {
+			category = target
+			delete(mapped, strings.ToLower(bucket.Name))
+		}
+		i := slices.IndexFunc(rules, func(r AllocationRule) bool { return r.CategoryType == category })
+		if i < 0 {
+			rules = append(rules, AllocationRule{CategoryType: category, Percentage: bucket.Percentage})
+			continue
+		}
+		rules[i].Percentage = rules[i].Percentage.Add(bucket.Percentage)
+	}
+	for name := range mapped {
+		return nil, fmt.Errorf("allocation template %s has no bucket %q", t.Name, name)
+	}
+	return rules, nil
+}
+
+var (
+	templateMu          sync.RWMutex
+	allocationTemplates = map[string]AllocationTemplate{
+		"50/30/20": {
+			Name:        "50/30/20",
+			Description: "Half on needs, 30% on wants, 20% saved",
+			Buckets: []TemplateBucket{
+				{Name: "needs", Percentage: decimal.NewFromFloat(0.5), Category: Expense},
+				{Name: "wants", Percentage: decimal.NewFromFloat(0.3), Category: Expense},
+				{Name: "savings", Percentage: decimal.NewFromFloat(0.2), Category: Savings},
+			},
+		},
+		"60/20/20": {
+			Name:        "60/20/20",
+			Description: "60% on needs, 20% on wants, 20% saved; for high fixed costs",
+			Buckets: []TemplateBucket{
+				{Name: "needs", Percentage: decimal.NewFromFloat(0.6), Category: Expense},
+				{Name: "wants", Percentage: decimal.NewFromFloat(0.2), Category: Expense},
+				{Name: "savings", Percentage: decimal.NewFromFloat(0.2), Category: Savings},
+			},
+		},
+		"conscious-spending": {
+			Name:        "conscious-spending",
+			Description: "Fixed costs first, then investments and savings; the rest is guilt-free spending",
+			Buckets: []TemplateBucket{
+				{Name: "fixed costs", Percentage: decimal.NewFromFloat(0.55), Category: Expense},
+				{Name: "investments", Percentage: decimal.NewFromFloat(0.1), Category: Investment},
+				{Name: "savings", Percentage: decimal.NewFromFloat(0.1), Category: Savings},
+				{Name: "guilt-free spending", Percentage: decimal.NewFromFloat(0.25), Category: Expense},
+			},
+		},
+	}
+)
+
+// RegisterAllocationTemplate adds or replaces a template in the library
+// offered to every user.
+func RegisterAllocationTemplate(template AllocationTemplate) error {
+	if err := template.Validate(); err != nil {
+		return err
+	}
+	templateMu.Lock()
+	defer templateMu.Unlock()
+
+	allocationTemplates[strings.ToLower(template.Name)] = template
+	return nil
+}
+
+func LookupAllocationTemplate(name string) (AllocationTemplate, bool) {
+	templateMu.RLock()
+	defer templateMu.RUnlock()
+
+	template, ok := allocationTemplates[strings.ToLower(name)]
+	return template, ok
+}
+
+// AvailableAllocationTemplates returns the library, by name, followed by
+// the user's own templates.
+func (u *User) AvailableAllocationTemplates() []AllocationTemplate {
+	templateMu.RLock()
+	templates := make([]AllocationTemplate, 0, len(allocationTemplates)+len(u.AllocationTemplates))
+	for _, template := range allocationTemplates {
+		templates = append(templates, template)
+	}
+	templateMu.RUnlock()
+
+	slices.SortFunc(templates, func(a, b AllocationTemplate) int { return strings.Compare(a.Name, b.Name) })
+	return append(templates, u.AllocationTemplates...)
+}
+
+// AllocationTemplate returns the user's own template of that name, or else
+// the library's.
+func (u *User) AllocationTemplate(name string) (AllocationTemplate, error) {
+	for _, template := range u.AllocationTemplates {
+		if strings.EqualFold(template.Name, name) {
+			return template, nil
+		}
+	}
+	if template, ok := LookupAllocationTemplate(name); ok {
+		return template, nil
+	}
+	return AllocationTemplate{}, fmt.Errorf("allocation template %q not found", name)
+}
+
+// SaveAllocationTemplate saves a custom template, replacing the user's
+// template of the same name.
+func (u *User) SaveAllocationTemplate(template AllocationTemplate) error {
+	if err := template.Validate(); err != nil {
+		return err
+	}
+	i := slices.IndexFunc(u.AllocationTemplates, func(t AllocationTemplate) bool {
+		return strings.EqualFold(t.Name, template.Name)
+	})
+	if i < 0 {
+		u.AllocationTemplates = append(u.AllocationTemplates, template)
+		return nil
+	}
+	u.AllocationTemplates[i] = template
+	return nil
+}
+
+// ApplyAllocationTemplate plans the named template's rules, see
+// AllocationTemplate.Rules, to apply from the given time on. Earlier
+// incomes keep the rules in effect when they were received, as with
+// PlanAllocationRules.
+func (u *User) ApplyAllocationTemplate(name string, mapping map[string]CategoryType, from time.Time) ([]AllocationRule, error) {
+	template, err := u.AllocationTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := template.Rules(mapping)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.PlanAllocationRules(from, rules); err != nil {
+		return nil, err
+	}
+	return u.RulesAt(from), nil
+}
+
+func (s *FinanceService) AllocationTemplates(ctx context.Context, userID string) ([]AllocationTemplate, error) {
+	defer s.readLockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return user.AvailableAllocationTemplates(), nil
+}
+
+func (s *FinanceService) SaveAllocationTemplate(ctx context.Context, userID string, template AllocationTemplate) error {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := user.SaveAllocationTemplate(template); err != nil {
+		return err
+	}
+
+	if err := s.save(ctx, user, "save_allocation_template"); err != nil {
+		return err
+	}
+	s.Telemetry.Track(ctx, "allocation", "save_template", userID, nil)
+	return nil
+}
+
+// ApplyAllocationTemplate sets the user's allocation rules from a template.
+// mapping sends template buckets to categories other than their default.
+func (s *FinanceService) ApplyAllocationTemplate(ctx context.Context, userID, name string, mapping map[string]CategoryType) ([]AllocationRule, error) {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := user.ApplyAllocationTemplate(name, mapping, s.now())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.save(ctx, user, "apply_allocation_template"); err != nil {
+		return nil, err
+	}
+	s.log().InfoContext(ctx, "applied allocation template", LogKeyUserID, userID, "template", name)
+	s.Telemetry.Track(ctx, "allocation", "apply_template", userID, map[string]string{"template": name})
+	return rules, nil
+}
@@ -0,0 +1,181 @@
+package arus
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Transactions older than this are locked by default.
+const DefaultLockWindow = 90 * 24 * time.Hour
+
+// TransactionEdit is a change to a transaction's descriptive fields. Nil
+// fields are left unchanged. Amounts and dates are never edited; a wrong
+// amount is corrected by recording an offsetting transaction.
+type TransactionEdit struct {
+	Description *string
+	Tags        []string
+	Merchant    *string `json:",omitempty"`
+	Notes       *string `json:",omitempty"`
+}
+
+// IsEmpty reports whether the edit changes nothing.
+func (e TransactionEdit) IsEmpty() bool {
+	return e.Description == nil && e.Tags == nil && e.Merchant == nil && e.Notes == nil
+}
+
+func (e TransactionEdit) apply(tx *Transaction) {
+	if e.Description != nil {
+		tx.Description = *e.Description
+	}
+	if e.Tags != nil {
+		tx.Tags = slices.Clone(e.Tags)
+	}
+	if e.Merchant != nil {
+		tx.Merchant = *e.Merchant
+	}
+	if e.Notes != nil {
+		tx.Notes = *e.Notes
+	}
+}
+
+// Amendment records a change to a locked transaction. The transaction itself
+// is left as it was, so data already exported or shared stays consistent
+// with what the system shows, and the change is visible next to it.
+type Amendment struct {
+	ID            string
+	TransactionID string
+	At            time.Time
+	Reason        string
+	Edit          TransactionEdit
+}
+
+// LockedAt returns when tx becomes locked, or the zero time when locking is
+// disabled.
+func (u *User) LockedAt(tx Transaction) time.Time {
+	if u.LockWindow <= 0 {
+		return time.Time{}
+	}
+	return tx.Date.Add(u.LockWindow)
+}
+
+func (u *User) IsLocked(tx Transaction, now time.Time) bool {
+	lockedAt := u.LockedAt(tx)
+	return !lockedAt.IsZero() && !now.Before(lockedAt)
+}
+
+func (u *User) transaction(id string) (*Transaction, error) {
+	for _, transactions := range [][]Transaction{u.Incomes, u.Expenses} {
+		for i := range transactions {
+			if transactions[i].recordedAs(id) {
+				return &transactions[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrTransactionNotFound, id)
+}
+
+// EditTransaction changes the transaction in place. Transactions that are
+// locked at now are rejected with a TransactionLockedError.
+func (u *User) EditTransaction(id string, edit TransactionEdit, now time.Time) error {
+	tx, err := u.transaction(id)
+	if err != nil {
+		return err
+	}
+	if u.IsLocked(*tx, now) {
+		return &TransactionLockedError{TransactionID: id, LockedSince: u.LockedAt(*tx)}
+	}
+	edit.apply(tx)
+	return nil
+}
+
+// AmendTransaction records an amendment to the transaction without changing
+// it.
+func (u *User) AmendTransaction(id string, edit TransactionEdit, reason string, now time.Time) (Amendment, error) {
+	if _, err := u.transaction(id); err != nil {
+		return Amendment{}, err
+	}
+	amendment := Amendment{
+		ID:            NewID(),
+		TransactionID: id,
+		At:            now,
+		Reason:        reason,
+		Edit:          edit,
+	}
+	u.Amendments = append(u.Amendments, amendment)
+	return amendment, nil
+}
+
+// TransactionAmendments returns the amendments to a transaction, oldest
+// first.
+func (u *User) TransactionAmendments(id string) []Amendment {
+	var amendments []Amendment
+	for _, amendment := range u.Amendments {
+		if amendment.TransactionID == id {
+			amendments = append(amendments, amendment)
+		}
+	}
+	return amendments
+}
+
+// AmendedTransaction returns the transaction with its amendments applied.
+func (u *User) AmendedTransaction(id string) (Transaction, error) {
+	tx, err := u.transaction(id)
+	if err != nil {
+		return Transaction{}, err
+	}
+	amended := *tx
+	for _, amendment := range u.TransactionAmendments(id) {
+		amendment.Edit.apply(&amended)
+	}
+	return amended, nil
+}
+
+// EditTransaction changes a transaction in place while it is inside the
+// user's lock window. It is UpdateTransaction without the result.
+func (s *FinanceService) EditTransaction(ctx context.Context, userID, transactionID string, edit TransactionEdit) error {
+	_, err := s.UpdateTransaction(ctx, userID, transactionID, edit)
+	return err
+}
+
+func (s *FinanceService) AmendTransaction(ctx context.Context, userID, transactionID string, edit TransactionEdit, reason string) (Amendment, error) {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return Amendment{}, err
+	}
+	if err := s.loadTransactionIDs(ctx, user, transactionID); err != nil {
+		return Amendment{}, err
+	}
+
+	amendment, err := user.AmendTransaction(transactionID, edit, reason, s.now())
+	if err != nil {
+		return Amendment{}, err
+	}
+
+	if err := s.save(ctx, user, "amend_transaction"); err != nil {
+		return Amendment{}, err
+	}
+	s.Telemetry.Track(ctx, "transactions", "amend", userID, nil)
+	return amendment, nil
+}
+
+// SetLockWindow changes how long transactions stay editable in place. Zero
+// disables locking.
+func (s *FinanceService) SetLockWindow(ctx context.Context, userID string, window time.Duration) error {
+	if window < 0 {
+		return fmt.Errorf("lock window must not be negative")
+	}
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	user.LockWindow = window
+
+	return s.save(ctx, user, "set_lock_window")
+}
@@ -0,0 +1,248 @@
+package arus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// How long archived users are kept before they can be purged
+const DefaultArchiveRetention = 30 * 24 * time.Hour
+
+// UserArchive is implemented by repositories that can soft-delete users.
+// Archived users are kept, and listed by ForEach, but GetByID reports them
+// with a UserArchivedError until they are restored.
+type UserArchive interface {
+	Archive(ctx context.Context, id string, at time.Time) error
+	Restore(ctx context.Context, id string) (*User, error)
+	// Delete removes the user permanently.
+	Delete(ctx context.Context, id string) error
+}
+
+func (u *User) Archived() bool {
+	return !u.ArchivedAt.IsZero()
+}
+
+func (r *InMemoryUserRepository) Archive(ctx context.Context, id string, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, exists := r.data[id]
+	if !exists {
+		return ErrUserNotFound
+	}
+	if user.Archived() {
+		return &UserArchivedError{UserID: id, ArchivedAt: user.ArchivedAt}
+	}
+	user.ArchivedAt = at
+	return nil
+}
+
+func (r *InMemoryUserRepository) Restore(ctx context.Context, id string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, exists := r.data[id]
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+	if !user.Archived() {
+		return nil, fmt.Errorf("restoring user %s: %w", id, ErrUserNotArchived)
+	}
+	user.ArchivedAt = time.Time{}
+	return user.clone()
+}
+
+func (r *InMemoryUserRepository) Delete(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.data[id]; !exists {
+		return ErrUserNotFound
+	}
+	delete(r.data, id)
+	return nil
+}
+
+func (s *FinanceService) archive() (UserArchive, error) {
+	archive, ok := s.UserRepo.(UserArchive)
+	if !ok {
+		return nil, errors.New("repository does not support archiving users")
+	}
+	return archive, nil
+}
+
+// ArchiveUser soft-deletes the user. The user can be restored until purged.
+func (s *FinanceService) ArchiveUser(ctx context.Context, userID string) error {
+	archive, err := s.archive()
+	if err != nil {
+		return err
+	}
+	defer s.lockUser(userID)()
+
+	if err := archive.Archive(ctx, userID, s.now()); err != nil {
+		return err
+	}
+	s.log().InfoContext(ctx, "archived user", LogKeyUserID, userID)
+	s.Telemetry.Track(ctx, "users", "archive", userID, nil)
+	return nil
+}
+
+func (s *FinanceService) RestoreUser(ctx context.Context, userID string) (*User, error) {
+	archive, err := s.archive()
+	if err != nil {
+		return nil, err
+	}
+	defer s.lockUser(userID)()
+
+	user, err := archive.Restore(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	s.log().InfoContext(ctx, "restored user", LogKeyUserID, userID)
+	s.Telemetry.Track(ctx, "users", "restore", userID, nil)
+	return user, nil
+}
+
+// PurgeArchivedUsers permanently deletes users archived longer than
+// retention ago; zero retention means DefaultArchiveRetention. Along with
+// each user go their books and everything stored under their IDs apart
+// from the user document: attachments, cold-archived periods, the
+// transaction repository's copy and the audit log. It returns how many
+// users were deleted.
+func (s *FinanceService) PurgeArchivedUsers(ctx context.Context, retention time.Duration) (int, error) {
+	archive, err := s.archive()
+	if err != nil {
+		return 0, err
+	}
+	iterator, ok := s.UserRepo.(UserIterator)
+	if !ok {
+		return 0, errors.New("repository does not support iterating users")
+	}
+	if retention <= 0 {
+		retention = DefaultArchiveRetention
+	}
+	cutoff := s.now().Add(-retention)
+
+	var expired []*User
+	books := make(map[string][]*User)
+	err = iterator.ForEach(ctx, func(user *User) error {
+		if user.Archived() && user.ArchivedAt.Before(cutoff) {
+			expired = append(expired, user)
+		}
+		if user.BookOf != "" {
+			books[user.BookOf] = append(books[user.BookOf], user)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, user := range expired {
+		ok, err := s.purgeUser(ctx, archive, user, books[user.ID])
+		if err != nil {
+			return purged, fmt.Errorf("purging user %s: %w", user.ID, err)
+		}
+		if ok {
+			purged++
+			s.log().InfoContext(ctx, "purged archived user", LogKeyUserID, user.ID, "books", len(books[user.ID]))
+		}
+	}
+	return purged, nil
+}
+
+// purgeUser deletes the archived user and their books under the user's
+// lock, reporting false when the user was restored meanwhile. The user
+// document goes last, so a failed purge is retried by the next one.
+func (s *FinanceService) purgeUser(ctx context.Context, archive UserArchive, user *User, books []*User) (bool, error) {
+	defer s.lockUser(user.ID)()
+
+	var archived *UserArchivedError
+	if _, err := s.UserRepo.GetByID(ctx, user.ID); !errors.As(err, &archived) {
+		// Restored, or purged by someone else
+		if errors.Is(err, ErrUserNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	for _, book := range books {
+		err := func() error {
+			defer s.lockUser(book.ID)()
+			if err := s.deleteUserData(ctx, book); err != nil {
+				return err
+			}
+			if err := archive.Delete(ctx, book.ID); err != nil && !errors.Is(err, ErrUserNotFound) {
+				return err
+			}
+			return nil
+		}()
+		if err != nil {
+			return false, fmt.Errorf("book %s: %w", book.ID, err)
+		}
+	}
+	if err := s.deleteUserData(ctx, user); err != nil {
+		return false, err
+	}
+	return true, archive.Delete(ctx, user.ID)
+}
+
+// deleteUserData deletes what is stored for the user apart from the user
+// document and its transactions, which go with it.
+func (s *FinanceService) deleteUserData(ctx context.Context, user *User) error {
+	if err := s.loadHistory(ctx, user); err != nil {
+		return err
+	}
+	transactions := slices.Concat(user.Incomes, user.Expenses)
+	for _, archived := range user.ArchivedPeriods {
+		if s.Cold == nil {
+			break
+		}
+		period, err := s.loadPeriodArchive(ctx, archived)
+		if errors.Is(err, ErrBlobNotFound) {
+			// Deleted by an earlier purge that failed later on
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		transactions = append(transactions, slices.Concat(period.Incomes, period.Expenses)...)
+	}
+	if s.Blobs != nil {
+		for _, tx := range transactions {
+			for _, attachment := range tx.Attachments {
+				if err := s.Blobs.Delete(ctx, attachment.Key); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if s.Cold != nil {
+		for _, archived := range user.ArchivedPeriods {
+			if err := s.Cold.Store.Delete(ctx, archived.Key); err != nil {
+				return err
+			}
+		}
+	}
+	if s.Audit != nil {
+		if err := s.Audit.Delete(ctx, user.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
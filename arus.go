@@ -0,0 +1,1329 @@
+package arus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Money
+type Money struct {
+	Amount   decimal.Decimal
+	Currency string
+}
+
+func NewMoney(amount decimal.Decimal, currency string) Money {
+	return Money{
+		Amount:   amount,
+		Currency: currency,
+	}
+}
+
+func NewMoneyZero(currency string) Money {
+	return Money{
+		Amount:   decimal.Zero,
+		Currency: currency,
+	}
+}
+
+// Add returns the sum of m and other, which must be in m's currency; sums
+// of amounts that may be in several currencies check their currencies
+// first.
+func (m Money) Add(other Money) Money {
+	return Money{Amount: m.Amount.Add(other.Amount), Currency: m.Currency}
+}
+
+func (m Money) Subtract(other Money) Money {
+	if other.IsNegative() {
+		return Money{Amount: m.Amount.Sub(other.Amount.Abs()), Currency: m.Currency}
+	}
+	return Money{Amount: m.Amount.Sub(other.Amount), Currency: m.Currency}
+}
+
+func (m Money) Abs() Money {
+	return Money{Amount: m.Amount.Abs(), Currency: m.Currency}
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount.IsZero()
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount.IsNegative()
+}
+
+// Allocate splits m across ratios without losing or creating minor units.
+// Each share is rounded down to the minor unit and the leftover units go, one
+// at a time, to the shares with the largest rounding loss (earliest ratio
+// first on ties), so the shares always sum exactly to m rounded to its
+// currency's minor unit.
+func (m Money) Allocate(ratios ...decimal.Decimal) ([]Money, error) {
+	if len(ratios) == 0 {
+		return nil, errors.New("allocate requires at least one ratio")
+	}
+
+	total := decimal.Zero
+	for _, ratio := range ratios {
+		if ratio.IsNegative() {
+			return nil, errors.New("allocation ratios must not be negative")
+		}
+		total = total.Add(ratio)
+	}
+	if !total.IsPositive() {
+		return nil, errors.New("allocation ratios must not all be zero")
+	}
+
+	places := MinorUnits(m.Currency)
+	amount := m.Round().Amount.Abs()
+	unit := decimal.New(1, -places)
+	shares := make([]decimal.Decimal, len(ratios))
+	losses := make([]decimal.Decimal, len(ratios))
+	allocated := decimal.Zero
+	for i, ratio := range ratios {
+		exact := amount.Mul(ratio).Div(total)
+		shares[i] = exact.RoundDown(places)
+		losses[i] = exact.Sub(shares[i])
+		allocated = allocated.Add(shares[i])
+	}
+
+	order := make([]int, len(ratios))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return losses[order[a]].GreaterThan(losses[order[b]])
+	})
+	for i := 0; allocated.LessThan(amount); i = (i + 1) % len(order) {
+		shares[order[i]] = shares[order[i]].Add(unit)
+		allocated = allocated.Add(unit)
+	}
+
+	result := make([]Money, len(ratios))
+	for i, share := range shares {
+		if m.IsNegative() {
+			share = share.Neg()
+		}
+		result[i] = Money{Amount: share, Currency: m.Currency}
+	}
+	return result, nil
+}
+
+// Category type
+type CategoryType int
+
+const (
+	Expense CategoryType = iota
+	Emergency
+	Savings
+	// Held in brokerage or custodian accounts; it has to be liquidated into
+	// another category before it can be spent
+	Investment
+	// Income not assigned to an envelope yet, in envelope allocation mode
+	ToBudget
+	// Shortfalls of expenses no category could cover, parked by the user's
+	// OverdraftPolicy; its balance is what the user owes
+	Owed
+	// Cash on hand, withdrawn from the other categories and spent by the
+	// cash expenses the user logs
+	Cash
+)
+
+func (c CategoryType) String() string {
+	names := [...]string{"Expense", "Emergency", "Savings", "Investment", "To Budget", "Owed", "Cash"}
+	if c < 0 || int(c) >= len(names) {
+		return "Unknown"
+	}
+	return names[c]
+}
+
+// Allocation Rule
+type AllocationRule struct {
+	CategoryType CategoryType
+	Percentage   decimal.Decimal
+	// Incomes dated from EffectiveFrom up to (excluding) EffectiveUntil use
+	// the rule; zero times leave either end open
+	EffectiveFrom  time.Time
+	EffectiveUntil time.Time
+}
+
+// Bank
+type BankAccount struct {
+	AccountNumber string
+	BankName      string
+	// Kind of account; not part of the account's identity
+	Type AccountType `json:",omitempty"`
+	// Currency the account is held in; empty means the category's
+	Currency string `json:",omitempty"`
+}
+
+func (b BankAccount) Equal(other BankAccount) bool {
+	return b.AccountNumber == other.AccountNumber && b.BankName == other.BankName
+}
+
+// Bank account backing a category, with its own tracked balance
+type CategoryAccount struct {
+	BankAccount BankAccount
+	Balance     Money
+}
+
+// User's Category
+type Category struct {
+	Type CategoryType
+	// Balance in the category's main currency
+	Balance Money
+	// Balances held in other currencies, keyed by currency, such as an IDR
+	// account in a USD category. They are converted only for reporting.
+	Foreign     map[string]Money `json:",omitempty"`
+	Accounts    []*CategoryAccount
+	DebitPolicy DebitPolicy
+	// Reserve the deduction cascade leaves in the category, in the
+	// currency it is set in; nil means none
+	Floor *Money `json:",omitempty"`
+	// Balance below which the category is low; nil means never
+	LowBalance *LowBalanceThreshold `json:",omitempty"`
+}
+
+func NewCategory(categoryType CategoryType, currency string, accounts ...BankAccount) *Category {
+	category := &Category{
+		Type:        categoryType,
+		Balance:     NewMoneyZero(currency),
+		DebitPolicy: LargestFirst{},
+	}
+	for _, account := range accounts {
+		category.AddAccount(account)
+	}
+	return category
+}
+
+// AddAccount links a bank account to the category. Accounts in another
+// currency than the category's make it hold that currency too.
+func (c *Category) AddAccount(account BankAccount) *CategoryAccount {
+	if existing := c.Account(account); existing != nil {
+		return existing
+	}
+	currency := account.Currency
+	if currency == "" {
+		currency = c.Balance.Currency
+	}
+	c.HoldCurrency(currency)
+	categoryAccount := &CategoryAccount{
+		BankAccount: account,
+		Balance:     NewMoneyZero(currency),
+	}
+	// The first account in a currency holds what the category tracked
+	// without one
+	if len(c.accountsIn(currency)) == 0 {
+		categoryAccount.Balance = c.BalanceIn(currency)
+	}
+	c.Accounts = append(c.Accounts, categoryAccount)
+	return categoryAccount
+}
+
+func (c *Category) Account(account BankAccount) *CategoryAccount {
+	for _, a := range c.Accounts {
+		if a.BankAccount.Equal(account) {
+			return a
+		}
+	}
+	return nil
+}
+
+// checkCurrency accepts amounts in the category's main currency or in one
+// of the currencies it holds.
+func (c *Category) checkCurrency(amount Money) error {
+	if c.Balance.Currency == "" || amount.Currency == c.Balance.Currency {
+		return nil
+	}
+	if _, held := c.Foreign[amount.Currency]; !held {
+		return &CurrencyMismatchError{Expected: c.Balance.Currency, Got: amount.Currency}
+	}
+	return nil
+}
+
+// Credit adds amount to the category's primary (first) account in the
+// amount's currency.
+func (c *Category) Credit(amount Money) error {
+	if err := c.checkCurrency(amount); err != nil {
+		return err
+	}
+	if accounts := c.accountsIn(amount.Currency); len(accounts) > 0 {
+		accounts[0].Balance = accounts[0].Balance.Add(amount)
+	}
+	c.setBalance(c.BalanceIn(amount.Currency).Add(amount))
+	return nil
+}
+
+func (c *Category) CreditAccount(account BankAccount, amount Money) error {
+	categoryAccount := c.Account(account)
+	if categoryAccount == nil {
+		return &AccountNotLinkedError{BankAccount: account, Category: &c.Type}
+	}
+	if categoryAccount.Balance.Currency != "" && categoryAccount.Balance.Currency != amount.Currency {
+		return &CurrencyMismatchError{Expected: categoryAccount.Balance.Currency, Got: amount.Currency}
+	}
+	categoryAccount.Balance = categoryAccount.Balance.Add(amount)
+	c.setBalance(c.BalanceIn(amount.Currency).Add(amount))
+	return nil
+}
+
+// Debit removes amount from the category's balance in the amount's
+// currency, splitting it across the backing accounts in that currency
+// according to the category's DebitPolicy.
+func (c *Category) Debit(amount Money) error {
+	amount = amount.Abs()
+	if err := c.checkCurrency(amount); err != nil {
+		return err
+	}
+	balance := c.BalanceIn(amount.Currency)
+	if balance.Amount.LessThan(amount.Amount) {
+		return &InsufficientFundsError{Category: &c.Type, Needed: amount, Available: balance}
+	}
+	accounts := c.accountsIn(amount.Currency)
+	if len(accounts) == 0 {
+		c.setBalance(balance.Subtract(amount))
+		return nil
+	}
+
+	policy := c.DebitPolicy
+	if policy == nil {
+		policy = LargestFirst{}
+	}
+	portions, err := policy.Split(accounts, amount)
+	if err != nil {
+		var insufficient *InsufficientFundsError
+		if errors.As(err, &insufficient) {
+			insufficient.Category = &c.Type
+		}
+		return err
+	}
+
+	for i, portion := range portions {
+		accounts[i].Balance = accounts[i].Balance.Subtract(portion)
+	}
+	c.setBalance(balance.Subtract(amount))
+	return nil
+}
+
+func (c *Category) DebitAccount(account BankAccount, amount Money) error {
+	amount = amount.Abs()
+	categoryAccount := c.Account(account)
+	if categoryAccount == nil {
+		return &AccountNotLinkedError{BankAccount: account, Category: &c.Type}
+	}
+	if categoryAccount.Balance.Currency != "" && categoryAccount.Balance.Currency != amount.Currency {
+		return &CurrencyMismatchError{Expected: categoryAccount.Balance.Currency, Got: amount.Currency}
+	}
+	if categoryAccount.Balance.Amount.LessThan(amount.Amount) {
+		return &InsufficientFundsError{
+			Category:  &c.Type,
+			Account:   &categoryAccount.BankAccount,
+			Needed:    amount,
+			Available: categoryAccount.Balance,
+		}
+	}
+	categoryAccount.Balance = categoryAccount.Balance.Subtract(amount)
+	c.setBalance(c.BalanceIn(amount.Currency).Subtract(amount))
+	return nil
+}
+
+// Reconciliation result of a single bank account
+type Reconciliation struct {
+	Category    CategoryType
+	BankAccount BankAccount
+	Tracked     Money
+	Actual      Money
+	Difference  Money
+}
+
+func (r Reconciliation) Balanced() bool {
+	return r.Difference.IsZero()
+}
+
+// Reconcile compares the tracked balance of a backing account with the
+// balance reported by the bank.
+func (c *Category) Reconcile(account BankAccount, actual Money) (Reconciliation, error) {
+	categoryAccount := c.Account(account)
+	if categoryAccount == nil {
+		return Reconciliation{}, &AccountNotLinkedError{BankAccount: account, Category: &c.Type}
+	}
+	return Reconciliation{
+		Category:    c.Type,
+		BankAccount: account,
+		Tracked:     categoryAccount.Balance,
+		Actual:      actual,
+		Difference:  actual.Subtract(categoryAccount.Balance),
+	}, nil
+}
+
+type Transaction struct {
+	ID          string
+	Amount      Money
+	Date        time.Time
+	Description string
+	// Who the transaction was with, when known
+	Merchant string `json:",omitempty"`
+	// Name of the bank the transaction was imported from
+	Bank string `json:",omitempty"`
+	// The user's own remarks
+	Notes          string `json:",omitempty"`
+	Tags           []string
+	Classification *Classification
+	// For incomes, where the money came from
+	Source IncomeSource `json:",omitempty"`
+	// For incomes, how much each category received
+	Allocations []Allocation
+	// For expenses, how much each category covered; negative for refunds,
+	// whose amounts are credited back
+	Deductions []Deduction
+	// For refunds and settlements, the ID of the expense they give money
+	// back for
+	RefundOf string `json:",omitempty"`
+	// For shared expenses, the parts others owe the user
+	Shares []ExpenseShare `json:",omitempty"`
+	// For settlements of a shared expense, who paid their share back
+	Settles string `json:",omitempty"`
+	// For business expenses someone else pays back, the claim for them
+	Reimbursement *Reimbursement    `json:",omitempty"`
+	Status        TransactionStatus `json:",omitempty"`
+	// For expenses imported pending, the ID of the posted line that
+	// settled them, when it differs from theirs
+	PostedID string `json:",omitempty"`
+	// Set when the transaction was converted from another currency
+	FX *Conversion `json:",omitempty"`
+	// Receipts and other files kept with the transaction
+	Attachments []Attachment `json:",omitempty"`
+}
+
+// Part of an income credited to a single category
+type Allocation struct {
+	Category CategoryType
+	Amount   Money
+	// Set when the amount was routed by the user's WindfallRule
+	Windfall bool
+}
+
+// Part of an expense covered by a single category
+type Deduction struct {
+	Category CategoryType
+	Amount   Money
+	// Set when the amount overdrew the category under the user's
+	// OverdraftPolicy
+	Overdraft bool `json:",omitempty"`
+}
+
+// DeductedFrom returns how much of the expense the category covered.
+func (t Transaction) DeductedFrom(category CategoryType) Money {
+	total := NewMoneyZero(t.Amount.Currency)
+	for _, deduction := range t.Deductions {
+		if deduction.Category == category {
+			total = total.Add(deduction.Amount)
+		}
+	}
+	return total
+}
+
+func NewTransaction(amount Money, date time.Time, description string) Transaction {
+	return Transaction{
+		ID:          NewID(),
+		Amount:      amount,
+		Date:        date,
+		Description: description,
+	}
+}
+
+func NewIncome(amount Money, date time.Time, description string) Transaction {
+	return Transaction{
+		ID:          NewID(),
+		Amount:      amount,
+		Date:        date,
+		Description: description,
+	}
+}
+
+func NewExpense(amount Money, date time.Time, description string) Transaction {
+	return Transaction{
+		ID:          NewID(),
+		Amount:      Money{Amount: amount.Amount.Neg(), Currency: amount.Currency},
+		Date:        date,
+		Description: description,
+	}
+}
+
+type User struct {
+	ID              string
+	Categories      map[CategoryType]*Category
+	AllocationRules []AllocationRule
+	// Custom allocation templates saved by the user
+	AllocationTemplates []AllocationTemplate
+	Incomes             []Transaction
+	Expenses            []Transaction
+	ClassificationRules []ClassificationRule
+	ReviewThreshold     decimal.Decimal
+	ReviewQueue         []ReviewItem
+	Rounding            RoundingLedger
+	ReportSubscriptions []ReportSubscription
+	// How incomes are split across categories
+	AllocationMode AllocationMode `json:",omitempty"`
+	// Money moved between envelopes in envelope mode
+	EnvelopeAssignments []EnvelopeAssignment
+	// Transactions older than this can only be changed through amendments;
+	// zero disables locking
+	LockWindow time.Duration
+	Amendments []Amendment
+	// Latest unbalanced reconciliation of each backing account
+	OpenReconciliations []Reconciliation
+	// Periods covered by the statements imported for each account
+	StatementHistory []StatementRecord
+	// IANA time zone periods are built in; empty means UTC
+	Timezone string
+	// Day of the month fiscal months start on; 0 or 1 means calendar months
+	FiscalMonthStart int
+	// Optional rule routing part of above-average incomes to a category
+	WindfallRule *WindfallRule
+	// What to do with expenses the categories cannot cover; nil rejects them
+	OverdraftPolicy *OverdraftPolicy `json:",omitempty"`
+	// Country profile chosen at onboarding, if any
+	Country string
+	// Precomputed monthly totals; nil until the first transaction
+	Totals *MonthlyTotals
+	// When the user was soft-deleted; zero while the user is active
+	ArchivedAt time.Time
+	// Interest paid on category balances
+	YieldRules []YieldRule
+	// Securities held in the Investment category and the trades behind them
+	Holdings []Holding
+	Trades   []Trade
+	// Money the user owes
+	Loans       []Loan
+	CreditCards []CreditCard
+	// Incomes allocated automatically on a schedule, such as payday
+	ScheduledIncomes []ScheduledIncome
+	// Bills expected to fall due
+	Bills []Bill `json:",omitempty"`
+	Goals []Goal
+	// Whether AdjustAllocations may change the allocation rules for goals
+	AutoAdjustAllocation bool
+	// First day of the tax year; a zero month uses the country profile's
+	TaxYearStartMonth time.Month `json:",omitempty"`
+	TaxYearStartDay   int        `json:",omitempty"`
+	// Tags marking expenses as tax-deductible; empty uses
+	// DefaultDeductibleTags
+	DeductibleTags []string `json:",omitempty"`
+	// Deductions moved between categories after the fact
+	Recategorizations []Recategorization `json:",omitempty"`
+	// Closed periods whose transactions were moved to cold storage
+	ArchivedPeriods []ArchivedPeriod `json:",omitempty"`
+	// Corrections recorded by RepairBalances
+	BalanceAdjustments []BalanceAdjustment `json:",omitempty"`
+	// Saved ways of reading bank statements
+	ImportProfiles []ImportProfile `json:",omitempty"`
+	// Statements received by email waiting to be imported
+	QueuedStatements []QueuedStatement `json:",omitempty"`
+	// Cash taken out of the other categories, and the counts of it
+	CashWithdrawals []CashWithdrawal `json:",omitempty"`
+	CashAdjustments []CashAdjustment `json:",omitempty"`
+	// The user's other books; see Book
+	Books []Book `json:",omitempty"`
+	// ID of the user this user keeps a book for; empty for users in their
+	// own right
+	BookOf        string         `json:",omitempty"`
+	BookTransfers []BookTransfer `json:",omitempty"`
+	// Where the user's ledger events are delivered; see WebhookDispatcher
+	Webhooks []Webhook `json:",omitempty"`
+
+	// Fingerprints of the transactions as an AggregateUserRepository
+	// loaded them, by ID, so its Save writes only what changed; nil when
+	// the user was not loaded by one. Never modified, only replaced.
+	stored map[string]string
+	// Date the loaded transactions start at; zero when all are loaded
+	historyFrom time.Time
+	// Stored transactions dated before historyFrom
+	unloaded int
+}
+
+// NewUser creates a user with the default categories. An empty id is
+// replaced with a generated one.
+func NewUser(id string) *User {
+	if id == "" {
+		id = NewID()
+	}
+	return &User{
+		ID: id,
+		Categories: map[CategoryType]*Category{
+			Expense: NewCategory(Expense, "USD", BankAccount{
+				AccountNumber: "EXP123",
+				BankName:      "Expense Bank",
+			}),
+			Emergency: NewCategory(Emergency, "USD", BankAccount{
+				AccountNumber: "EMG123",
+				BankName:      "Emergency Bank",
+			}),
+			Savings: NewCategory(Savings, "USD", BankAccount{
+				AccountNumber: "SAV123",
+				BankName:      "Savings Bank",
+			}),
+			Investment: NewCategory(Investment, "USD"),
+		},
+		AllocationRules:     []AllocationRule{},
+		Incomes:             []Transaction{},
+		Expenses:            []Transaction{},
+		ClassificationRules: []ClassificationRule{},
+		ReviewThreshold:     DefaultReviewThreshold,
+		ReviewQueue:         []ReviewItem{},
+		LockWindow:          DefaultLockWindow,
+	}
+}
+
+// addNewCategories adds the default categories introduced after the user
+// was stored, such as Investment.
+func (u *User) addNewCategories() {
+	if u.Categories == nil {
+		return
+	}
+	if _, exists := u.Categories[Investment]; !exists {
+		u.Categories[Investment] = NewCategory(Investment, u.Currency())
+	}
+}
+
+func (u *User) AllocateIncome(income Money, date time.Time, description string) error {
+	if err := u.checkNotArchived(date); err != nil {
+		return err
+	}
+	if u.AllocationMode == EnvelopeAllocation {
+		return u.allocateToBudget(income, date, description)
+	}
+
+	totalPercentage := decimal.Zero
+
+	rules := u.RulesAt(date)
+	if len(rules) < 1 {
+		return ErrNoAllocationRules
+	}
+
+	// Calculate total percentages
+	for _, rule := range rules {
+		totalPercentage = totalPercentage.Add(rule.Percentage)
+	}
+
+	if totalPercentage.GreaterThan(decimal.NewFromInt(1)) {
+		return errors.New("total allocation percentages exceed 100%")
+	}
+
+	ratios := make([]decimal.Decimal, len(rules))
+	for i, rule := range rules {
+		category, exists := u.Categories[rule.CategoryType]
+		if !exists {
+			return &CategoryNotFoundError{Category: rule.CategoryType}
+		}
+		if err := category.checkCurrency(income); err != nil {
+			return err
+		}
+		ratios[i] = rule.Percentage
+	}
+
+	// Take the windfall off the top; the rules split what is left
+	windfall, err := u.windfall(income)
+	if err != nil {
+		return err
+	}
+	regular := Money{Amount: income.Amount.Sub(windfall.Amount), Currency: income.Currency}
+
+	newIncome := NewTransaction(income, date, description)
+
+	// Split the allocated part of the income penny-exactly across the rules
+	exact := Money{Amount: regular.Amount.Mul(totalPercentage), Currency: income.Currency}
+	allocations, err := exact.Round().Allocate(ratios...)
+	if err != nil {
+		return err
+	}
+
+	if windfall.Amount.IsPositive() {
+		if err := u.Categories[u.WindfallRule.Category].Credit(windfall); err != nil {
+			return err
+		}
+		newIncome.Allocations = append(newIncome.Allocations, Allocation{
+			Category: u.WindfallRule.Category,
+			Amount:   windfall,
+			Windfall: true,
+		})
+	}
+
+	// Allocate income to categories
+	for i, rule := range rules {
+		if err := u.Categories[rule.CategoryType].Credit(allocations[i]); err != nil {
+			return err
+		}
+		newIncome.Allocations = append(newIncome.Allocations, Allocation{Category: rule.CategoryType, Amount: allocations[i]})
+	}
+	u.Rounding.Record(exact, date, RoundingAllocation, newIncome.ID)
+
+	// Record the income
+	u.Incomes = append(u.Incomes, newIncome)
+	u.recordTotals(newIncome, false)
+
+	return nil
+}
+
+// Order in which categories cover an expense by default
+var DefaultDeductionOrder = []CategoryType{Expense, Emergency, Savings}
+
+func (u *User) ProcessExpense(expense Transaction) error {
+	return u.ProcessExpenseFrom(expense, DefaultDeductionOrder...)
+}
+
+// ProcessExpenseFrom deducts the expense from the given categories, draining
+// each one before moving on to the next.
+func (u *User) ProcessExpenseFrom(expense Transaction, deductionOrder ...CategoryType) error {
+	if err := u.checkNotArchived(expense.Date); err != nil {
+		return err
+	}
+	if expense.ID == "" {
+		expense.ID = NewID()
+	}
+	if err := expense.validateShares(); err != nil {
+		return err
+	}
+
+	deductions, err := u.deduct(expense.Amount.Abs(), deductionOrder)
+	if err != nil {
+		return err
+	}
+	expense.Deductions = append(expense.Deductions, deductions...)
+
+	u.Expenses = append(u.Expenses, expense)
+	u.recordTotals(expense, true)
+	u.classifyExpense(len(u.Expenses) - 1)
+
+	return nil
+}
+
+// deduct debits amount from the categories in order, draining each one
+// before moving on to the next, and returns what each covered.
+func (u *User) deduct(amount Money, deductionOrder []CategoryType) ([]Deduction, error) {
+	amountToDeduct := amount
+	var deductions []Deduction
+
+	held := func(categoryType CategoryType) bool {
+		category := u.Categories[categoryType]
+		return category != nil && category.checkCurrency(amount) == nil
+	}
+	if !slices.ContainsFunc(deductionOrder, held) {
+		return nil, &CurrencyMismatchError{Expected: u.Currency(), Got: amount.Currency}
+	}
+
+	// Check the categories can cover the expense before debiting any of
+	// them, so a rejected expense leaves the balances untouched
+	available := decimal.Zero
+	for _, categoryType := range deductionOrder {
+		if category := u.Categories[categoryType]; category != nil {
+			available = available.Add(category.spendable(amount.Currency).Amount)
+		}
+	}
+	if available.LessThan(amountToDeduct.Amount) {
+		if err := u.checkOverdraft(amount, Money{Amount: available, Currency: amount.Currency}); err != nil {
+			var insufficient *InsufficientFundsError
+			if errors.As(err, &insufficient) {
+				insufficient.Floors = u.floorsHolding(amount.Currency, deductionOrder)
+			}
+			return nil, err
+		}
+	}
+
+	for _, categoryType := range deductionOrder {
+		category := u.Categories[categoryType]
+		if category == nil {
+			continue
+		}
+		balance := category.spendable(amount.Currency)
+		if !balance.Amount.IsPositive() {
+			continue
+		}
+
+		if balance.Amount.GreaterThanOrEqual(amountToDeduct.Amount) {
+			if err := category.Debit(amountToDeduct); err != nil {
+				return nil, err
+			}
+			deductions = append(deductions, Deduction{Category: categoryType, Amount: amountToDeduct})
+			amountToDeduct = Money{Amount: decimal.Zero, Currency: amountToDeduct.Currency}
+			break
+		} else {
+			deductibleAmount := balance
+			if err := category.Debit(deductibleAmount); err != nil {
+				return nil, err
+			}
+			deductions = append(deductions, Deduction{Category: categoryType, Amount: deductibleAmount})
+			amountToDeduct = amountToDeduct.Subtract(deductibleAmount)
+		}
+	}
+
+	if amountToDeduct.Amount.GreaterThan(decimal.Zero) {
+		deduction, err := u.overdraw(amountToDeduct)
+		if err != nil {
+			return nil, err
+		}
+		deductions = append(deductions, deduction)
+	}
+	return deductions, nil
+}
+
+// Expense returns the recorded expense with the given ID.
+func (u *User) Expense(id string) (*Transaction, error) {
+	for i := range u.Expenses {
+		if u.Expenses[i].recordedAs(id) {
+			return &u.Expenses[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrExpenseNotFound, id)
+}
+
+// PeriodSummary is the income and expense activity of a user in a period.
+// Expenses keep their recorded (negative) sign, so TotalExpense is negative
+// and Net is simply TotalIncome + TotalExpense.
+type PeriodSummary struct {
+	Period      Period
+	TotalIncome Money
+	Incomes     []Transaction
+	// Income totals by source; incomes without a source are left out
+	IncomeBySource map[IncomeSource]Money `json:",omitempty"`
+	TotalExpense   Money
+	Expenses       []Transaction
+	Net            Money
+	// How much each category covered of the period's expenses, as positive
+	// amounts
+	Deductions map[CategoryType]Money
+	// Net amount rounded away in the period, booked to the rounding ledger
+	RoundingDifference Money
+	// Net realized gain (negative for a loss) on currency conversions
+	FXGainLoss Money
+	// Totals of incomes and expenses in other currencies than the user's,
+	// which are left out of the totals above, by currency
+	Foreign map[string]CurrencyTotals `json:",omitempty"`
+}
+
+// Currency returns the currency of the user's Expense category, which is
+// used for summaries.
+func (u *User) Currency() string {
+	if category, exists := u.Categories[Expense]; exists && category.Balance.Currency != "" {
+		return category.Balance.Currency
+	}
+	return "USD"
+}
+
+func (u *User) GetPeriodSummary(period Period) PeriodSummary {
+	inPeriod := func(transactions []Transaction) []Transaction {
+		var matching []Transaction
+		for _, tx := range transactions {
+			if period.Contains(tx.Date) {
+				matching = append(matching, tx)
+			}
+		}
+		return matching
+	}
+	return u.summarize(period, inPeriod(u.Incomes), inPeriod(u.Expenses))
+}
+
+// summarize totals the period's incomes and expenses, which the caller has
+// already narrowed down to the period.
+func (u *User) summarize(period Period, incomesInPeriod, expensesInPeriod []Transaction) PeriodSummary {
+	expensesInPeriod = slices.DeleteFunc(slices.Clone(expensesInPeriod), func(tx Transaction) bool { return !tx.Counts() })
+	currency := u.Currency()
+	totalExpense := NewMoneyZero(currency)
+	deductions := make(map[CategoryType]Money)
+	var foreign map[string]CurrencyTotals
+
+	for _, expense := range expensesInPeriod {
+		if expense.Amount.Currency != currency {
+			foreign = addForeign(foreign, expense.Spent(), true)
+			continue
+		}
+		totalExpense = totalExpense.Add(expense.Spent())
+
+		for _, deduction := range expense.Deductions {
+			total, ok := deductions[deduction.Category]
+			if !ok {
+				total = NewMoneyZero(deduction.Amount.Currency)
+			}
+			deductions[deduction.Category] = total.Add(deduction.Amount)
+		}
+	}
+
+	totalIncome := NewMoneyZero(currency)
+	for _, income := range incomesInPeriod {
+		if income.Amount.Currency != currency {
+			foreign = addForeign(foreign, income.Amount, false)
+			continue
+		}
+		totalIncome = totalIncome.Add(income.Amount)
+	}
+
+	return PeriodSummary{
+		Period:         period,
+		TotalIncome:    totalIncome.Round(),
+		Incomes:        incomesInPeriod,
+		IncomeBySource: incomeBySource(incomesInPeriod, currency),
+		TotalExpense:   totalExpense.Round(),
+		Expenses:       expensesInPeriod,
+		Net:            totalIncome.Add(totalExpense).Round(),
+		Deductions:     deductions,
+
+		RoundingDifference: u.Rounding.Total(period, currency),
+		FXGainLoss:         fxGainLoss(currency, incomesInPeriod, expensesInPeriod, period),
+		Foreign:            foreign,
+	}
+}
+
+func (u *User) CategoryFor(account BankAccount) *Category {
+	for _, c := range u.Categories {
+		if c.Account(account) != nil {
+			return c
+		}
+	}
+	return nil
+}
+
+// ReconcileAccount reconciles a backing account and keeps the result in
+// OpenReconciliations until the account balances again.
+func (u *User) ReconcileAccount(account BankAccount, actual Money) (Reconciliation, error) {
+	category := u.CategoryFor(account)
+	if category == nil {
+		return Reconciliation{}, &AccountNotLinkedError{BankAccount: account}
+	}
+	reconciliation, err := category.Reconcile(account, actual)
+	if err != nil {
+		return Reconciliation{}, err
+	}
+
+	u.OpenReconciliations = slices.DeleteFunc(u.OpenReconciliations, func(r Reconciliation) bool {
+		return r.BankAccount.Equal(account)
+	})
+	if !reconciliation.Balanced() {
+		u.OpenReconciliations = append(u.OpenReconciliations, reconciliation)
+	}
+	return reconciliation, nil
+}
+
+// ProcessAccountStatement records the statement's debits as expenses. An
+// account not linked yet is routed by its type, see RouteAccount; debits on
+// custodian and savings accounts only draw on their own category. Debits
+// paying a credit card bill settle the card instead. Statements of a credit
+// card record the charges that were not recorded yet.
+func (u *User) ProcessAccountStatement(ctx context.Context, statement AccountStatement) error {
+	if err := statement.Validate(); err != nil {
+		return err
+	}
+
+	// Either every expense on the statement is recorded or none is
+	trial, err := u.clone()
+	if err != nil {
+		return err
+	}
+	if trial.creditCard(statement.BankAccount) != nil {
+		if err := trial.processCardStatement(statement); err != nil {
+			return err
+		}
+		trial.recordStatement(statement)
+		*u = *trial
+		return nil
+	}
+	if _, err := trial.RouteAccount(statement.BankAccount); err != nil {
+		return err
+	}
+	if _, err := trial.processStatementDebits(ctx, statement); err != nil {
+		return err
+	}
+	trial.recordStatement(statement)
+	*u = *trial
+	return nil
+}
+
+// processStatementDebits records the debits of a statement of a linked bank
+// account. Card bill payments settle the card and cash withdrawals move
+// money into Cash, while e-wallet top-ups are left out; the rest are
+// recorded as expenses in one batch. Credits, top-ups and lines recorded
+// before are skipped. On failure the user may be left part way, so callers
+// work on a copy.
+func (u *User) processStatementDebits(ctx context.Context, statement AccountStatement) (BatchReport, error) {
+	transfers := func() int {
+		n := len(u.CashWithdrawals)
+		for _, card := range u.CreditCards {
+			n += len(card.Payments)
+		}
+		return n
+	}
+	before := transfers()
+	var expenses []Transaction
+	for _, line := range statement.Lines {
+		if !line.IsDebit() || u.walletTopUp(statement.BankAccount, line) != nil {
+			continue
+		}
+		if card := u.cardPayment(line); card != nil {
+			if err := u.payStatementCard(card, line, statement.transaction(line)); err != nil {
+				return BatchReport{}, err
+			}
+			continue
+		}
+		if isCashWithdrawal(line) {
+			if err := u.withdrawStatementCash(statement.BankAccount, line, statement.transaction(line)); err != nil {
+				return BatchReport{}, err
+			}
+			continue
+		}
+		expenses = append(expenses, statement.transaction(line))
+	}
+	report, err := u.ProcessExpenseBatch(ctx, expenses, u.deductionOrderFor(statement.BankAccount)...)
+	if err != nil {
+		return report, err
+	}
+	// Lines neither recorded as expenses nor applied as transfers were skipped
+	applied := transfers() - before
+	report.Applied += applied
+	report.Skipped += len(statement.Lines) - len(expenses) - applied
+	return report, nil
+}
+
+type UserRepository interface {
+	GetByID(ctx context.Context, id string) (*User, error)
+	Save(ctx context.Context, user *User) error
+}
+
+// UserIterator is implemented by repositories that can enumerate every user
+// they hold, one at a time. Archived users are included.
+type UserIterator interface {
+	ForEach(ctx context.Context, fn func(user *User) error) error
+}
+
+// InMemoryUserRepository keeps users in memory. It stores and returns deep
+// copies, so like a database it only changes on Save: changing a user
+// without saving it leaves the stored user as it was.
+type InMemoryUserRepository struct {
+	data map[string]*User
+	mu   sync.RWMutex
+}
+
+func NewInMemoryUserRepository() *InMemoryUserRepository {
+	return &InMemoryUserRepository{
+		data: make(map[string]*User),
+	}
+}
+
+func (r *InMemoryUserRepository) GetByID(ctx context.Context, id string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, exists := r.data[id]
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+	if user.Archived() {
+		return nil, &UserArchivedError{UserID: id, ArchivedAt: user.ArchivedAt}
+	}
+	return user.clone()
+}
+
+func (r *InMemoryUserRepository) Save(ctx context.Context, user *User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	stored, err := user.clone()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.data[user.ID] = stored
+	return nil
+}
+
+func (r *InMemoryUserRepository) ForEach(ctx context.Context, fn func(user *User) error) error {
+	r.mu.RLock()
+	users := make([]*User, 0, len(r.data))
+	for _, user := range r.data {
+		users = append(users, user)
+	}
+	r.mu.RUnlock()
+
+	for _, user := range users {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		user, err := user.clone()
+		if err != nil {
+			return err
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type FinanceService struct {
+	UserRepo UserRepository
+	// Per-user limits for hosted instances; nil means unlimited
+	Quotas QuotaPolicy
+	// Opt-in usage analytics; nil disables it
+	Telemetry *Telemetry
+	// History of state changes used for time-travel reads; nil disables it
+	Audit AuditLog
+	// Source of the current time; nil uses the wall clock
+	Clock Clock
+	// Contributors to users' inboxes; nil uses DefaultInboxSources
+	InboxSources []InboxSource
+	// Receives ledger changes for realtime clients; nil disables events
+	Events *EventBus
+	// Tracer for service spans; nil uses the global OpenTelemetry provider
+	Tracer trace.Tracer
+	// Structured logger for operations; nil disables logging
+	Logger *slog.Logger
+	// Remembers idempotency keys so retried mutations apply once; nil
+	// ignores keys
+	Idempotency IdempotencyStore
+	// Current prices of held securities; nil means holdings can't be traded
+	// or valued
+	Prices PriceProvider
+	// Where attachment contents are kept; nil means files can't be attached
+	Blobs BlobStore
+	// Converts balances held in several currencies for reports; nil means
+	// they can't be converted
+	Rates ExchangeRateProvider
+	// Rates of past days, used to convert backdated transactions and past
+	// periods; nil converts them at current rates, and past periods can't
+	// be reported in another currency
+	HistoricalRates HistoricalRateProvider
+	// Where closed periods are archived; nil keeps every transaction in
+	// the user
+	Cold *ColdArchive
+
+	locks userLocks
+}
+
+func (s *FinanceService) now() time.Time {
+	return clockOrSystem(s.Clock).Now()
+}
+
+// CreateUser creates and stores a user with a generated ID.
+func (s *FinanceService) CreateUser(ctx context.Context) (*User, error) {
+	user := NewUser("")
+	if err := s.save(ctx, user, "create_user"); err != nil {
+		return nil, err
+	}
+	s.Telemetry.Track(ctx, "users", "create", user.ID, nil)
+	return user, nil
+}
+
+func (s *FinanceService) AllocateIncome(ctx context.Context, userID string, income Money) error {
+	return s.AllocateIncomeFrom(ctx, userID, income, UnspecifiedSource)
+}
+
+func (s *FinanceService) GetPeriodSummary(ctx context.Context, userID string, period Period) (PeriodSummary, error) {
+	user, err := s.readUserFor(ctx, userID, period)
+	if err != nil {
+		return PeriodSummary{}, err
+	}
+	return user.GetPeriodSummary(period), nil
+}
+
+func (s *FinanceService) CheckIncomeStatus(ctx context.Context, userID string, period Period) (IncomeStatus, error) {
+	user, err := s.readUserFor(ctx, userID, period)
+	if err != nil {
+		return IncomeStatus{}, err
+	}
+	return user.CheckIncomeStatus(period), nil
+}
+
+// ExpenseDeductions returns which categories covered the expense, in the
+// order they were drawn from.
+func (s *FinanceService) ExpenseDeductions(ctx context.Context, userID, expenseID string) ([]Deduction, error) {
+	defer s.readLockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.loadTransactionIDs(ctx, user, expenseID); err != nil {
+		return nil, err
+	}
+	expense, err := user.Expense(expenseID)
+	if err != nil {
+		return nil, err
+	}
+	return expense.Deductions, nil
+}
+
+// Optional settings for recording a single expense
+type ExpenseOptions struct {
+	// Charge the expense to this category only, instead of cascading
+	// through DefaultDeductionOrder
+	Category *CategoryType
+	Tags     []string
+	// What was paid, when the expense was paid in another currency than
+	// the amount charged, e.g. 50 EUR charged as 55.20 USD
+	Original *Money
+	// Parts of the expense others owe, when the user paid for them too
+	Shares []ExpenseShare
+}
+
+// ProcessExpense records a single expense for the user, e.g. a coffee
+// purchase entered by hand. A zero date means now.
+func (s *FinanceService) ProcessExpense(ctx context.Context, userID string, amount Money, date time.Time, description string, opts ExpenseOptions) (err error) {
+	ctx, span := s.startSpan(ctx, "ProcessExpense", userID)
+	defer endSpan(span, &err)
+
+	fingerprint := []string{amount.Amount.String(), amount.Currency, date.String(), description}
+	if opts.Category != nil {
+		fingerprint = append(fingerprint, opts.Category.String())
+	}
+	if opts.Original != nil {
+		fingerprint = append(fingerprint, opts.Original.String())
+	}
+	claim, err := s.claimIdempotencyKey(ctx, userID, "process_expense", fingerprint...)
+	if err != nil || claim.isReplay() {
+		return err
+	}
+	defer claim.settle(ctx, &err)
+
+	var market *ExchangeRate
+	if opts.Original != nil {
+		if market, err = s.marketRate(ctx, opts.Original.Currency, amount.Currency, date); err != nil {
+			return err
+		}
+	}
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.quotaFor(userID).Check(QuotaTransactions, user.TransactionCount(), 1); err != nil {
+		return err
+	}
+
+	if date.IsZero() {
+		date = s.now()
+	}
+	expense := NewExpense(amount.Abs(), date, description)
+	expense.Tags = opts.Tags
+	expense.Shares = opts.Shares
+	if opts.Original != nil {
+		original := Money{Amount: opts.Original.Amount.Abs().Neg(), Currency: opts.Original.Currency}
+		conversion, err := NewConversion(original, expense.Amount, market)
+		if err != nil {
+			return err
+		}
+		expense.FX = &conversion
+	}
+
+	deductionOrder := DefaultDeductionOrder
+	if opts.Category != nil {
+		if _, exists := user.Categories[*opts.Category]; !exists {
+			return &CategoryNotFoundError{Category: *opts.Category}
+		}
+		deductionOrder = []CategoryType{*opts.Category}
+	}
+
+	if err := user.ProcessExpenseFrom(expense, deductionOrder...); err != nil {
+		return err
+	}
+
+	if err := s.save(ctx, user, "process_expense"); err != nil {
+		return err
+	}
+	recorded := user.Expenses[len(user.Expenses)-1]
+	s.log().InfoContext(ctx, "processed expense",
+		LogKeyUserID, userID, LogKeyTransactionID, recorded.ID, "amount", recorded.Amount.String(),
+		"categories", len(recorded.Deductions))
+	s.publishLedger(user, recorded)
+	properties := map[string]string{"override": strconv.FormatBool(opts.Category != nil)}
+	s.Telemetry.Track(ctx, "expenses", "process_expense", userID, properties)
+	return nil
+}
+
+func (s *FinanceService) ReconcileAccount(ctx context.Context, userID string, account BankAccount, actual Money) (_ Reconciliation, err error) {
+	ctx, span := s.startSpan(ctx, "ReconcileAccount", userID, attribute.String("arus.account", account.Masked()))
+	defer endSpan(span, &err)
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return Reconciliation{}, err
+	}
+
+	reconciliation, err := user.ReconcileAccount(account, actual)
+	if err != nil {
+		return Reconciliation{}, err
+	}
+
+	if err := s.save(ctx, user, "reconcile_account"); err != nil {
+		return Reconciliation{}, err
+	}
+	s.log().InfoContext(ctx, "reconciled account",
+		LogKeyUserID, userID, "account", account,
+		"balanced", reconciliation.Balanced(), "difference", reconciliation.Difference.String())
+	s.publish(userID, EventReconciled, reconciliation)
+	s.Telemetry.Track(ctx, "reconciliation", "reconcile", userID, nil)
+	return reconciliation, nil
+}
+
+func (s *FinanceService) ProcessAccountStatement(ctx context.Context, userID string, statement AccountStatement) (err error) {
+	ctx, span := s.startSpan(ctx, "ProcessAccountStatement", userID,
+		attribute.String("arus.account", statement.BankAccount.Masked()),
+		attribute.Int("arus.statement_lines", len(statement.Lines)))
+	defer endSpan(span, &err)
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.loadStatement(ctx, user, statement.BankAccount, statement.Lines); err != nil {
+		return err
+	}
+
+	if err := s.quotaFor(userID).Check(QuotaTransactions, user.TransactionCount(), len(statement.Expenses())); err != nil {
+		return err
+	}
+	if user.CategoryFor(statement.BankAccount) == nil && user.creditCard(statement.BankAccount) == nil {
+		if err := s.quotaFor(userID).Check(QuotaLinkedAccounts, user.LinkedAccountCount(), 1); err != nil {
+			return err
+		}
+	}
+
+	recorded, pending := len(user.Expenses), user.pendingIDs()
+	log := s.log().With(LogKeyUserID, userID, "account", statement.BankAccount)
+	if err := user.ProcessAccountStatement(ctx, statement); err != nil {
+		log.WarnContext(ctx, "statement import failed", "lines", len(statement.Lines), "error", err)
+		return err
+	}
+
+	if err := s.save(ctx, user, "process_statement"); err != nil {
+		return err
+	}
+	changed := append(user.settledSince(pending), user.Expenses[recorded:]...)
+	log.InfoContext(ctx, "imported statement", "lines", len(statement.Lines), "expenses", len(user.Expenses)-recorded)
+	s.publishLedger(user, changed...)
+	s.Telemetry.Track(ctx, "statements", "process_statement", userID, map[string]string{
+		"lines": strconv.Itoa(len(statement.Lines)),
+	})
+	return nil
+}
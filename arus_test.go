@@ -0,0 +1,33 @@
+package arus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// money parses amount, failing the test if it is not a decimal.
+func money(t *testing.T, amount, currency string) Money {
+	t.Helper()
+	parsed, err := decimal.NewFromString(amount)
+	if err != nil {
+		t.Fatalf("parsing amount %q: %v", amount, err)
+	}
+	return NewMoney(parsed, currency)
+}
+
+// newFundedUser returns a user splitting income evenly between Expense and
+// Savings, with income of amount USD allocated on date.
+func newFundedUser(t *testing.T, id, amount string, date time.Time) *User {
+	t.Helper()
+	user := NewUser(id)
+	user.AllocationRules = []AllocationRule{
+		{CategoryType: Expense, Percentage: decimal.NewFromFloat(0.5)},
+		{CategoryType: Savings, Percentage: decimal.NewFromFloat(0.5)},
+	}
+	if err := user.AllocateIncome(money(t, amount, "USD"), date, "salary"); err != nil {
+		t.Fatalf("allocating income: %v", err)
+	}
+	return user
+}
@@ -0,0 +1,234 @@
+package arus
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Largest file that can be attached to a transaction
+const MaxAttachmentSize = 10 << 20
+
+// Content types accepted as attachments: receipt photos and scans
+var AttachmentContentTypes = []string{"image/jpeg", "image/png", "image/webp", "image/heic", "application/pdf"}
+
+// BlobStore keeps the contents of attachments under keys of
+// slash-separated segments.
+type BlobStore interface {
+	// Put stores the content under key, replacing any blob already there.
+	Put(ctx context.Context, key string, content io.Reader, contentType string) error
+	// Get opens the blob under key; a missing blob is ErrBlobNotFound.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob under key; a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Attachment describes a file attached to a transaction. The content
+// itself lives in the service's BlobStore under Key.
+type Attachment struct {
+	ID          string
+	Name        string
+	ContentType string
+	Size        int64
+	// Hex-encoded SHA-256 of the content
+	SHA256     string
+	Key        string
+	UploadedAt time.Time
+}
+
+func (tx Transaction) attachment(id string) (int, error) {
+	i := slices.IndexFunc(tx.Attachments, func(a Attachment) bool { return a.ID == id })
+	if i < 0 {
+		return -1, fmt.Errorf("%w: %s", ErrAttachmentNotFound, id)
+	}
+	return i, nil
+}
+
+// Attachment returns the metadata of one of the transaction's attachments.
+func (tx Transaction) Attachment(id string) (Attachment, error) {
+	i, err := tx.attachment(id)
+	if err != nil {
+		return Attachment{}, err
+	}
+	return tx.Attachments[i], nil
+}
+
+// attachmentContentType returns the content type of an attachment, sniffed
+// from the content when the caller did not give one.
+func attachmentContentType(contentType string, content []byte) (string, error) {
+	if contentType == "" {
+		contentType = http.DetectContentType(content)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("%w: content type %q: %v", ErrInvalidAttachment, contentType, err)
+	}
+	if !slices.Contains(AttachmentContentTypes, mediaType) {
+		return "", fmt.Errorf("%w: content type %s can't be attached", ErrInvalidAttachment, mediaType)
+	}
+	return mediaType, nil
+}
+
+// attachmentName strips any directories from an uploaded file's name.
+func attachmentName(name string) string {
+	name = path.Base(strings.ReplaceAll(strings.TrimSpace(name), `\`, "/"))
+	if name == "." || name == "/" {
+		return "attachment"
+	}
+	return name
+}
+
+func (s *FinanceService) blobs() (BlobStore, error) {
+	if s.Blobs == nil {
+		return nil, errors.New("no blob store configured for attachments")
+	}
+	return s.Blobs, nil
+}
+
+// AttachFile stores content and attaches it to the transaction. Files can
+// be attached to locked transactions too, as receipts often turn up late
+// and do not change the ledger.
+func (s *FinanceService) AttachFile(ctx context.Context, userID, transactionID, name, contentType string, content io.Reader) (Attachment, error) {
+	blobs, err := s.blobs()
+	if err != nil {
+		return Attachment{}, err
+	}
+	data, err := io.ReadAll(io.LimitReader(content, MaxAttachmentSize+1))
+	if err != nil {
+		return Attachment{}, err
+	}
+	if len(data) == 0 {
+		return Attachment{}, fmt.Errorf("%w: file is empty", ErrInvalidAttachment)
+	}
+	if len(data) > MaxAttachmentSize {
+		return Attachment{}, fmt.Errorf("%w: file is larger than %d bytes", ErrInvalidAttachment, MaxAttachmentSize)
+	}
+	contentType, err = attachmentContentType(contentType, data)
+	if err != nil {
+		return Attachment{}, err
+	}
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return Attachment{}, err
+	}
+	if err := s.loadTransactionIDs(ctx, user, transactionID); err != nil {
+		return Attachment{}, err
+	}
+	tx, err := user.transaction(transactionID)
+	if err != nil {
+		return Attachment{}, err
+	}
+
+	sum := sha256.Sum256(data)
+	attachment := Attachment{
+		ID:          NewID(),
+		Name:        attachmentName(name),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		SHA256:      hex.EncodeToString(sum[:]),
+		UploadedAt:  s.now(),
+	}
+	attachment.Key = path.Join(userID, transactionID, attachment.ID)
+	if err := blobs.Put(ctx, attachment.Key, bytes.NewReader(data), contentType); err != nil {
+		return Attachment{}, err
+	}
+	tx.Attachments = append(tx.Attachments, attachment)
+
+	if err := s.save(ctx, user, "attach_file"); err != nil {
+		// Don't leave a blob nothing refers to
+		blobs.Delete(context.WithoutCancel(ctx), attachment.Key)
+		return Attachment{}, err
+	}
+	s.log().InfoContext(ctx, "attached file",
+		LogKeyUserID, userID, LogKeyTransactionID, transactionID, "attachment_id", attachment.ID, "size", attachment.Size)
+	s.Telemetry.Track(ctx, "transactions", "attach", userID, map[string]string{"content_type": contentType})
+	return attachment, nil
+}
+
+// OpenAttachment returns an attachment and its content, which the caller
+// must close.
+func (s *FinanceService) OpenAttachment(ctx context.Context, userID, transactionID, attachmentID string) (Attachment, io.ReadCloser, error) {
+	blobs, err := s.blobs()
+	if err != nil {
+		return Attachment{}, nil, err
+	}
+	attachment, err := s.attachment(ctx, userID, transactionID, attachmentID)
+	if err != nil {
+		return Attachment{}, nil, err
+	}
+	content, err := blobs.Get(ctx, attachment.Key)
+	if err != nil {
+		return Attachment{}, nil, err
+	}
+	return attachment, content, nil
+}
+
+func (s *FinanceService) attachment(ctx context.Context, userID, transactionID, attachmentID string) (Attachment, error) {
+	defer s.readLockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return Attachment{}, err
+	}
+	if err := s.loadTransactionIDs(ctx, user, transactionID); err != nil {
+		return Attachment{}, err
+	}
+	tx, err := user.transaction(transactionID)
+	if err != nil {
+		return Attachment{}, err
+	}
+	return tx.Attachment(attachmentID)
+}
+
+// RemoveAttachment detaches the file from the transaction and deletes its
+// content.
+func (s *FinanceService) RemoveAttachment(ctx context.Context, userID, transactionID, attachmentID string) error {
+	blobs, err := s.blobs()
+	if err != nil {
+		return err
+	}
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.loadTransactionIDs(ctx, user, transactionID); err != nil {
+		return err
+	}
+	tx, err := user.transaction(transactionID)
+	if err != nil {
+		return err
+	}
+	i, err := tx.attachment(attachmentID)
+	if err != nil {
+		return err
+	}
+	attachment := tx.Attachments[i]
+	tx.Attachments = slices.Delete(tx.Attachments, i, i+1)
+
+	if err := s.save(ctx, user, "remove_attachment"); err != nil {
+		return err
+	}
+	// The metadata is gone, so a blob left behind is only wasted space
+	if err := blobs.Delete(ctx, attachment.Key); err != nil {
+		s.log().WarnContext(ctx, "deleting attachment content failed",
+			LogKeyUserID, userID, LogKeyTransactionID, transactionID, "attachment_id", attachmentID, "error", err)
+	}
+	s.Telemetry.Track(ctx, "transactions", "remove_attachment", userID, nil)
+	return nil
+}
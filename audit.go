@@ -0,0 +1,150 @@
+package arus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrNoHistory = errors.New("no recorded state at or before the requested time")
+
+// AuditEntry is a snapshot of a user's full state right after an operation
+// changed it.
+type AuditEntry struct {
+	ID        string
+	UserID    string
+	Operation string
+	At        time.Time
+	State     json.RawMessage
+}
+
+func (e AuditEntry) User() (*User, error) {
+	return decodeUser(string(e.State))
+}
+
+// AuditLog is an append-only history of user state changes.
+type AuditLog interface {
+	Append(ctx context.Context, entry AuditEntry) error
+	// Entries returns the user's entries ordered by time, oldest first.
+	Entries(ctx context.Context, userID string) ([]AuditEntry, error)
+	// Delete removes the user's entries, when the user is purged.
+	Delete(ctx context.Context, userID string) error
+}
+
+type InMemoryAuditLog struct {
+	entries map[string][]AuditEntry
+	mu      sync.RWMutex
+}
+
+func NewInMemoryAuditLog() *InMemoryAuditLog {
+	return &InMemoryAuditLog{
+		entries: make(map[string][]AuditEntry),
+	}
+}
+
+func (l *InMemoryAuditLog) Append(ctx context.Context, entry AuditEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := append(l.entries[entry.UserID], entry)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].At.Before(entries[j].At)
+	})
+	l.entries[entry.UserID] = entries
+	return nil
+}
+
+func (l *InMemoryAuditLog) Entries(ctx context.Context, userID string) ([]AuditEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return append([]AuditEntry(nil), l.entries[userID]...), nil
+}
+
+func (l *InMemoryAuditLog) Delete(ctx context.Context, userID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.entries, userID)
+	return nil
+}
+
+// NewAuditEntry snapshots user as it is now.
+func NewAuditEntry(user *User, operation string, at time.Time) (AuditEntry, error) {
+	state, err := json.Marshal(user)
+	if err != nil {
+		return AuditEntry{}, fmt.Errorf("snapshotting user %s: %w", user.ID, err)
+	}
+	return AuditEntry{
+		ID:        NewID(),
+		UserID:    user.ID,
+		Operation: operation,
+		At:        at,
+		State:     state,
+	}, nil
+}
+
+// save persists user and, when an audit log is configured, records the
+// resulting state under operation.
+func (s *FinanceService) save(ctx context.Context, user *User, operation string) error {
+	reached := user.markReachedGoals(s.now())
+	if err := s.UserRepo.Save(ctx, user); err != nil {
+		s.log().ErrorContext(ctx, "saving user failed", LogKeyUserID, user.ID, LogKeyOperation, operation, "error", err)
+		return err
+	}
+	s.log().DebugContext(ctx, "saved user", LogKeyUserID, user.ID, LogKeyOperation, operation)
+	for _, goal := range reached {
+		s.publish(user.ID, EventGoalReached, goal)
+	}
+	if s.Audit == nil {
+		return nil
+	}
+
+	// Snapshots hold the full state, older transactions included
+	if err := s.loadHistory(ctx, user); err != nil {
+		return err
+	}
+	entry, err := NewAuditEntry(user, operation, s.now())
+	if err != nil {
+		return err
+	}
+	return s.Audit.Append(ctx, entry)
+}
+
+// AsOf returns the user's full state (balances, rules, history) as it was at
+// t, from the most recent audit snapshot taken at or before t.
+func (s *FinanceService) AsOf(ctx context.Context, userID string, t time.Time) (*User, error) {
+	if s.Audit == nil {
+		return nil, ErrNoHistory
+	}
+
+	entries, err := s.Audit.Entries(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Entries are oldest first; find the last one not after t
+	i := sort.Search(len(entries), func(i int) bool {
+		return entries[i].At.After(t)
+	})
+	if i == 0 {
+		return nil, ErrNoHistory
+	}
+	return entries[i-1].User()
+}
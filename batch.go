@@ -0,0 +1,202 @@
+package arus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Outcomes of a single expense in a batch
+type BatchItemStatus string
+
+const (
+	BatchApplied BatchItemStatus = "applied"
+	BatchSkipped BatchItemStatus = "skipped"
+	BatchFailed  BatchItemStatus = "failed"
+)
+
+// BatchItemResult is the outcome of the expense at Index of a batch.
+type BatchItemResult struct {
+	Index         int
+	TransactionID string
+	Status        BatchItemStatus
+	Reason        string
+}
+
+// BatchReport lists the outcome of every expense of a batch, in order.
+type BatchReport struct {
+	Items   []BatchItemResult
+	Applied int
+	Skipped int
+	Failed  int
+}
+
+func (r *BatchReport) add(result BatchItemResult) {
+	r.Items = append(r.Items, result)
+	switch result.Status {
+	case BatchApplied:
+		r.Applied++
+	case BatchSkipped:
+		r.Skipped++
+	case BatchFailed:
+		r.Failed++
+	}
+}
+
+// BatchRejectedError reports a batch that was not applied because some of
+// its expenses failed. It unwraps to the first failure.
+type BatchRejectedError struct {
+	Failed int
+	Total  int
+	First  error
+}
+
+func (e *BatchRejectedError) Error() string {
+	return fmt.Sprintf("batch rejected: %d of %d expenses failed, first: %v", e.Failed, e.Total, e.First)
+}
+
+func (e *BatchRejectedError) Is(target error) bool {
+	return target == ErrBatchRejected
+}
+
+func (e *BatchRejectedError) Unwrap() error {
+	return e.First
+}
+
+// clone returns a deep copy of the user.
+func (u *User) clone() (*User, error) {
+	state, err := json.Marshal(u)
+	if err != nil {
+		return nil, fmt.Errorf("copying user %s: %w", u.ID, err)
+	}
+	clone, err := decodeUser(string(state))
+	if err != nil {
+		return nil, err
+	}
+	// A copy applied in place of the user is saved as the user would be
+	clone.stored, clone.historyFrom, clone.unloaded = u.stored, u.historyFrom, u.unloaded
+	return clone, nil
+}
+
+// applyExpense records one expense of a batch and reports its outcome,
+// returning the failure, if any, as well.
+func (u *User) applyExpense(expense Transaction, deductionOrder []CategoryType) (BatchItemResult, error) {
+	result := BatchItemResult{TransactionID: expense.ID, Status: BatchApplied}
+	_, lookupErr := u.Expense(expense.ID)
+	pending := u.pendingExpenseFor(expense)
+
+	var err error
+	switch {
+	case expense.Amount.IsZero():
+		result.Status, result.Reason = BatchSkipped, "zero amount"
+	case lookupErr == nil:
+		result.Status, result.Reason = BatchSkipped, "already recorded"
+	case expense.Status == Posted && pending >= 0:
+		result.TransactionID = u.Expenses[pending].ID
+		err = u.postExpense(pending, expense)
+	default:
+		err = u.ProcessExpenseFrom(expense, deductionOrder...)
+	}
+	if err != nil {
+		result.Status, result.Reason = BatchFailed, err.Error()
+	}
+	return result, err
+}
+
+// ProcessExpenseBatch records the expenses in order through deductionOrder,
+// or DefaultDeductionOrder when none is given, all or nothing. Every expense is tried against the
+// balances left by the ones before it; when any fails, none is recorded,
+// and the report says why each failed and which would have applied.
+// Zero expenses and expenses whose ID is already recorded are skipped.
+// Posted expenses that settle a pending one replace it instead of being
+// recorded again.
+func (u *User) ProcessExpenseBatch(ctx context.Context, expenses []Transaction, deductionOrder ...CategoryType) (BatchReport, error) {
+	if len(deductionOrder) == 0 {
+		deductionOrder = DefaultDeductionOrder
+	}
+	trial, err := u.clone()
+	if err != nil {
+		return BatchReport{}, err
+	}
+
+	var report BatchReport
+	var first error
+	for i, expense := range expenses {
+		if err := ctx.Err(); err != nil {
+			return BatchReport{}, err
+		}
+		if expense.ID == "" {
+			expense.ID = NewID()
+		}
+		result, err := trial.applyExpense(expense, deductionOrder)
+		if err != nil && first == nil {
+			first = err
+		}
+		result.Index = i
+		report.add(result)
+	}
+
+	if report.Failed > 0 {
+		for i := range report.Items {
+			if report.Items[i].Status == BatchApplied {
+				report.Items[i].Status = BatchSkipped
+				report.Items[i].Reason = "not applied because other expenses in the batch failed"
+				report.Applied--
+				report.Skipped++
+			}
+		}
+		return report, &BatchRejectedError{Failed: report.Failed, Total: len(expenses), First: first}
+	}
+
+	*u = *trial
+	return report, nil
+}
+
+// ProcessExpenseBatch records the expenses for the user all or nothing; see
+// User.ProcessExpenseBatch. The report is returned even when the batch is
+// rejected.
+func (s *FinanceService) ProcessExpenseBatch(ctx context.Context, userID string, expenses []Transaction, deductionOrder ...CategoryType) (_ BatchReport, err error) {
+	ctx, span := s.startSpan(ctx, "ProcessExpenseBatch", userID, attribute.Int("arus.batch_size", len(expenses)))
+	defer endSpan(span, &err)
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return BatchReport{}, err
+	}
+	dates := make([]time.Time, len(expenses))
+	for i, expense := range expenses {
+		dates[i] = expense.Date
+	}
+	if err := s.loadAround(ctx, user, dates...); err != nil {
+		return BatchReport{}, err
+	}
+
+	if err := s.quotaFor(userID).Check(QuotaTransactions, user.TransactionCount(), len(expenses)); err != nil {
+		return BatchReport{}, err
+	}
+
+	recorded, pending := len(user.Expenses), user.pendingIDs()
+	log := s.log().With(LogKeyUserID, userID)
+	report, err := user.ProcessExpenseBatch(ctx, expenses, deductionOrder...)
+	if err != nil {
+		log.WarnContext(ctx, "expense batch rejected", "failed", report.Failed, "expenses", len(expenses), "error", err)
+		return report, err
+	}
+
+	if err := s.save(ctx, user, "process_expense_batch"); err != nil {
+		return BatchReport{}, err
+	}
+	changed := append(user.settledSince(pending), user.Expenses[recorded:]...)
+	log.InfoContext(ctx, "processed expense batch", "applied", report.Applied, "skipped", report.Skipped)
+	s.publishLedger(user, changed...)
+	s.Telemetry.Track(ctx, "expenses", "process_expense_batch", userID, map[string]string{
+		"expenses": strconv.Itoa(len(expenses)),
+	})
+	return report, nil
+}
@@ -0,0 +1,387 @@
+package arus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults of a BillReminder
+const (
+	DefaultBillReminderLead = 3 * 24 * time.Hour
+	DefaultBillHorizonDays  = 30
+)
+
+// Bill is a bill the user expects, such as rent or a phone plan. Recurring
+// bills carry the rule they recur on, as a cron expression like those of
+// scheduled incomes; paying one moves Due to its next occurrence.
+type Bill struct {
+	ID     string
+	Name   string
+	Amount Money
+	// Date the bill falls due next; bills stay due until paid
+	Due time.Time
+	// Rule the bill recurs on, such as "0 0 1 * *" for the 1st of every
+	// month; empty for a one-off bill
+	Cron string `json:",omitempty"`
+	// The bank pays the bill when due, so it only needs the money there
+	Autopay bool `json:",omitempty"`
+	// Due dates the user was reminded of, and warned they could not cover
+	RemindedFor time.Time `json:",omitempty"`
+	WarnedFor   time.Time `json:",omitempty"`
+}
+
+func (b Bill) Validate() error {
+	if strings.TrimSpace(b.Name) == "" {
+		return errors.New("bill name is required")
+	}
+	if !b.Amount.Amount.IsPositive() {
+		return fmt.Errorf("bill %s must have a positive amount", b.Name)
+	}
+	if b.Due.IsZero() {
+		return fmt.Errorf("bill %s has no due date", b.Name)
+	}
+	if b.Cron != "" {
+		if _, err := ParseCron(b.Cron); err != nil {
+			return fmt.Errorf("bill %s: %w", b.Name, err)
+		}
+	}
+	return nil
+}
+
+// upcoming returns the bill falling due at due.
+func (b Bill) upcoming(due time.Time) UpcomingBill {
+	return UpcomingBill{BillID: b.ID, Name: b.Name, Amount: b.Amount, Due: due, Autopay: b.Autopay}
+}
+
+// occurrences returns the bill each time it falls due up to until: its
+// current due date, then the dates its rule gives.
+func (b Bill) occurrences(until time.Time, loc *time.Location) []UpcomingBill {
+	var bills []UpcomingBill
+	schedule, err := ParseCron(b.Cron)
+	for due := b.Due; !due.IsZero() && !due.After(until); {
+		bills = append(bills, b.upcoming(due))
+		if b.Cron == "" || err != nil {
+			break
+		}
+		due = schedule.Next(due, loc)
+	}
+	return bills
+}
+
+// next returns the date the bill falls due after its current due date, or
+// the zero time for one-off bills.
+func (b Bill) next(loc *time.Location) time.Time {
+	if b.Cron == "" {
+		return time.Time{}
+	}
+	schedule, err := ParseCron(b.Cron)
+	if err != nil {
+		return time.Time{}
+	}
+	return schedule.Next(b.Due, loc)
+}
+
+func (u *User) bill(id string) (int, error) {
+	i := slices.IndexFunc(u.Bills, func(b Bill) bool { return b.ID == id })
+	if i < 0 {
+		return -1, fmt.Errorf("bill %s not found", id)
+	}
+	return i, nil
+}
+
+// PayBill marks the bill's current due date paid: recurring bills fall due
+// next on their rule's following date, one-off bills are removed. Paying
+// does not record the expense, which comes from the statement or is logged
+// like any other.
+func (u *User) PayBill(id string) (Bill, error) {
+	i, err := u.bill(id)
+	if err != nil {
+		return Bill{}, err
+	}
+	bill := &u.Bills[i]
+	next := bill.next(u.Location())
+	if next.IsZero() {
+		paid := *bill
+		u.Bills = slices.Delete(u.Bills, i, i+1)
+		return paid, nil
+	}
+	bill.Due = next
+	return *bill, nil
+}
+
+// BillCalendar is the bills falling due over a period and whether the
+// Expense category can pay them.
+type BillCalendar struct {
+	From  time.Time
+	Until time.Time
+	// Bills by due date, overdue ones first
+	Bills []UpcomingBill
+	// Of the bills, by currency
+	Totals []Money
+	// How far the totals exceed what the Expense category can spend, for
+	// the currencies it cannot cover
+	Shortfalls []Money `json:",omitempty"`
+	// Bills falling due once the Expense balance in their currency has
+	// run out
+	Uncovered []UpcomingBill `json:",omitempty"`
+}
+
+func (c BillCalendar) Covered() bool {
+	return len(c.Uncovered) == 0
+}
+
+// BillCalendar returns the bills falling due in the days from from,
+// including ones still unpaid from before, and checks them against what
+// the Expense category can spend.
+func (u *User) BillCalendar(from time.Time, days int) BillCalendar {
+	calendar := BillCalendar{From: from, Until: from.AddDate(0, 0, days)}
+	for _, bill := range u.Bills {
+		calendar.Bills = append(calendar.Bills, bill.occurrences(calendar.Until, u.Location())...)
+	}
+	slices.SortStableFunc(calendar.Bills, func(a, b UpcomingBill) int { return a.Due.Compare(b.Due) })
+
+	available := func(currency string) Money {
+		if category, exists := u.Categories[Expense]; exists {
+			return category.spendable(currency)
+		}
+		return NewMoneyZero(currency)
+	}
+	totals := make(map[string]Money)
+	var currencies []string
+	for _, bill := range calendar.Bills {
+		currency := bill.Amount.Currency
+		total, seen := totals[currency]
+		if !seen {
+			currencies = append(currencies, currency)
+			total = NewMoneyZero(currency)
+		}
+		totals[currency] = total.Add(bill.Amount)
+		if totals[currency].Amount.GreaterThan(available(currency).Amount) {
+			calendar.Uncovered = append(calendar.Uncovered, bill)
+		}
+	}
+	for _, currency := range currencies {
+		calendar.Totals = append(calendar.Totals, totals[currency])
+		if shortfall := totals[currency].Subtract(available(currency)); shortfall.Amount.IsPositive() {
+			calendar.Shortfalls = append(calendar.Shortfalls, shortfall)
+		}
+	}
+	return calendar
+}
+
+// AddBill adds a bill for the user. A recurring bill without a due date
+// falls due on its rule's next date.
+func (s *FinanceService) AddBill(ctx context.Context, userID string, bill Bill) (Bill, error) {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return Bill{}, err
+	}
+	bill.ID = NewID()
+	if bill.Due.IsZero() && bill.Cron != "" {
+		if schedule, err := ParseCron(bill.Cron); err == nil {
+			bill.Due = schedule.Next(s.now(), user.Location())
+		}
+	}
+	bill.RemindedFor, bill.WarnedFor = time.Time{}, time.Time{}
+	if err := bill.Validate(); err != nil {
+		return Bill{}, err
+	}
+	user.Bills = append(user.Bills, bill)
+
+	if err := s.save(ctx, user, "add_bill"); err != nil {
+		return Bill{}, err
+	}
+	s.Telemetry.Track(ctx, "bills", "add", userID, map[string]string{"recurring": strconv.FormatBool(bill.Cron != "")})
+	return bill, nil
+}
+
+func (s *FinanceService) Bills(ctx context.Context, userID string) ([]Bill, error) {
+	user, err := s.readUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return user.Bills, nil
+}
+
+func (s *FinanceService) RemoveBill(ctx context.Context, userID, billID string) error {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	i, err := user.bill(billID)
+	if err != nil {
+		return err
+	}
+	user.Bills = slices.Delete(user.Bills, i, i+1)
+
+	return s.save(ctx, user, "remove_bill")
+}
+
+func (s *FinanceService) PayBill(ctx context.Context, userID, billID string) (Bill, error) {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return Bill{}, err
+	}
+	bill, err := user.PayBill(billID)
+	if err != nil {
+		return Bill{}, err
+	}
+
+	if err := s.save(ctx, user, "pay_bill"); err != nil {
+		return Bill{}, err
+	}
+	s.Telemetry.Track(ctx, "bills", "pay", userID, nil)
+	return bill, nil
+}
+
+// BillCalendar returns the user's bills over the next days, such as 30 or
+// 60, starting today.
+func (s *FinanceService) BillCalendar(ctx context.Context, userID string, days int) (BillCalendar, error) {
+	if days < 1 {
+		return BillCalendar{}, errors.New("bill calendar must span at least a day")
+	}
+	user, err := s.readUser(ctx, userID)
+	if err != nil {
+		return BillCalendar{}, err
+	}
+	now := s.now().In(user.Location())
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	return user.BillCalendar(today, days), nil
+}
+
+// BillReminder announces bills falling due soon with EventBillUpcoming, and
+// warns with EventBillsUncovered when the Expense category will not cover
+// the bills of the coming days. Autopay bills past due are taken as paid.
+type BillReminder struct {
+	Service *FinanceService
+	Users   UserIterator
+	// How long before a bill falls due it is announced; zero means
+	// DefaultBillReminderLead
+	Lead time.Duration
+	// Days of bills checked against the Expense balance; zero means
+	// DefaultBillHorizonDays
+	HorizonDays int
+}
+
+// RunDue reminds every user with bills of what falls due from now.
+func (r *BillReminder) RunDue(ctx context.Context, now time.Time) error {
+	var due []string
+	err := r.Users.ForEach(ctx, func(user *User) error {
+		if !user.Archived() && len(user.Bills) > 0 {
+			due = append(due, user.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, userID := range due {
+		if err := r.runUser(ctx, userID, now); err != nil {
+			errs = append(errs, fmt.Errorf("reminding user %s of bills: %w", userID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *BillReminder) runUser(ctx context.Context, userID string, now time.Time) error {
+	s := r.Service
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	lead := r.Lead
+	if lead == 0 {
+		lead = DefaultBillReminderLead
+	}
+	horizon := r.HorizonDays
+	if horizon == 0 {
+		horizon = DefaultBillHorizonDays
+	}
+
+	changed := false
+	for _, bill := range slices.Clone(user.Bills) {
+		if !bill.Autopay {
+			continue
+		}
+		for {
+			i, err := user.bill(bill.ID)
+			if err != nil || user.Bills[i].Due.After(now) {
+				break
+			}
+			if _, err := user.PayBill(bill.ID); err != nil {
+				return err
+			}
+			changed = true
+		}
+	}
+
+	var reminders []UpcomingBill
+	for i := range user.Bills {
+		bill := &user.Bills[i]
+		if bill.Due.After(now.Add(lead)) || bill.RemindedFor.Equal(bill.Due) {
+			continue
+		}
+		bill.RemindedFor = bill.Due
+		reminders = append(reminders, bill.upcoming(bill.Due))
+		changed = true
+	}
+
+	// Warned once for the first bill that cannot be paid, until a later
+	// one becomes the first
+	calendar := user.BillCalendar(now, horizon)
+	warn := false
+	if !calendar.Covered() {
+		first := calendar.Uncovered[0]
+		if i, err := user.bill(first.BillID); err == nil && !user.Bills[i].WarnedFor.Equal(first.Due) {
+			user.Bills[i].WarnedFor = first.Due
+			warn, changed = true, true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	if err := s.save(ctx, user, "remind_bills"); err != nil {
+		return err
+	}
+	for _, bill := range reminders {
+		s.publish(userID, EventBillUpcoming, bill)
+	}
+	if warn {
+		s.log().WarnContext(ctx, "bills not covered", LogKeyUserID, userID, "uncovered", len(calendar.Uncovered))
+		s.publish(userID, EventBillsUncovered, calendar)
+	}
+	return nil
+}
+
+// Run calls RunDue every interval until ctx is cancelled.
+func (r *BillReminder) Run(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.RunDue(ctx, r.Service.now()); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
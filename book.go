@@ -0,0 +1,222 @@
+package arus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Node name used in flow reports for money moved between a user's books
+const FlowBookTransfers = "Book transfers"
+
+// BookTransfersAccount is where money transferred between books comes from
+// and goes to, so neither book counts it as income or spending.
+var BookTransfersAccount = LedgerAccount{Class: LedgerEquity, Name: FlowBookTransfers}
+
+// Book is one of a user's independent sets of books, such as for a small
+// business or a rental property, besides their personal finances. Each
+// book is kept as a user of its own, with its own categories, rules and
+// history, so every FinanceService method and report works on a book by
+// its ID.
+type Book struct {
+	// ID of the user keeping the book
+	ID   string
+	Name string
+}
+
+// BookTransfer is money moved explicitly between two books of the same
+// user, recorded in both. Amount is signed: negative in the book the money
+// left, positive in the one it arrived in.
+type BookTransfer struct {
+	ID   string
+	Date time.Time
+	// Book on the other side of the transfer
+	Counterparty string
+	// Category of this book the money left or arrived in
+	Category    CategoryType
+	Amount      Money
+	Description string `json:",omitempty"`
+}
+
+// BookTransferOrder asks for money to be moved between books, naming each
+// by its ID; the user's own ID names their personal book.
+type BookTransferOrder struct {
+	From         string
+	FromCategory CategoryType
+	To           string
+	ToCategory   CategoryType
+	Amount       Money
+	Description  string
+}
+
+// book returns the user's book of that ID, their own ID included.
+func (u *User) book(id string) (Book, error) {
+	if id == u.ID {
+		return Book{ID: u.ID, Name: "Personal"}, nil
+	}
+	i := slices.IndexFunc(u.Books, func(b Book) bool { return b.ID == id })
+	if i < 0 {
+		return Book{}, fmt.Errorf("book %s not found", id)
+	}
+	return u.Books[i], nil
+}
+
+// transferBook moves the signed amount in or out of the category and
+// records the transfer.
+func (u *User) transferBook(transfer BookTransfer) error {
+	category, exists := u.Categories[transfer.Category]
+	if !exists {
+		return &CategoryNotFoundError{Category: transfer.Category}
+	}
+	var err error
+	if transfer.Amount.IsNegative() {
+		err = category.Debit(transfer.Amount)
+	} else {
+		err = category.Credit(transfer.Amount)
+	}
+	if err != nil {
+		return err
+	}
+	u.BookTransfers = append(u.BookTransfers, transfer)
+	return nil
+}
+
+// CreateBook starts a new book for the user, with the default categories
+// and the user's country profile, if they chose one.
+func (s *FinanceService) CreateBook(ctx context.Context, userID, name string) (Book, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Book{}, errors.New("book name is required")
+	}
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return Book{}, err
+	}
+	if user.BookOf != "" {
+		return Book{}, errors.New("books cannot have books of their own")
+	}
+	if slices.ContainsFunc(user.Books, func(b Book) bool { return strings.EqualFold(b.Name, name) }) {
+		return Book{}, fmt.Errorf("book %q already exists", name)
+	}
+
+	keeper := NewUser("")
+	keeper.BookOf = user.ID
+	keeper.Timezone = user.Timezone
+	if profile, ok := user.Profile(); ok {
+		profile.Apply(keeper)
+	}
+	if err := s.save(ctx, keeper, "create_book"); err != nil {
+		return Book{}, err
+	}
+	book := Book{ID: keeper.ID, Name: name}
+	user.Books = append(user.Books, book)
+
+	if err := s.save(ctx, user, "create_book"); err != nil {
+		return Book{}, err
+	}
+	s.Telemetry.Track(ctx, "books", "create", userID, nil)
+	return book, nil
+}
+
+func (s *FinanceService) Books(ctx context.Context, userID string) ([]Book, error) {
+	user, err := s.readUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return user.Books, nil
+}
+
+// TransferBetweenBooks moves money from a category of one of the user's
+// books to a category of another, recording the transfer in both. Neither
+// book counts it as income or spending. Should the receiving book fail to
+// save, the sending book is saved back as it was.
+func (s *FinanceService) TransferBetweenBooks(ctx context.Context, userID string, order BookTransferOrder) (_ BookTransfer, err error) {
+	ctx, span := s.startSpan(ctx, "TransferBetweenBooks", userID)
+	defer endSpan(span, &err)
+
+	if !order.Amount.Amount.IsPositive() {
+		return BookTransfer{}, errors.New("transferred amount must be positive")
+	}
+	if order.From == order.To {
+		return BookTransfer{}, errors.New("money must be transferred to another book")
+	}
+	owner, err := s.readUser(ctx, userID)
+	if err != nil {
+		return BookTransfer{}, err
+	}
+	if _, err := owner.book(order.From); err != nil {
+		return BookTransfer{}, err
+	}
+	if _, err := owner.book(order.To); err != nil {
+		return BookTransfer{}, err
+	}
+
+	// Locked in a fixed order, so concurrent transfers between the same
+	// books cannot deadlock
+	first, second := order.From, order.To
+	if second < first {
+		first, second = second, first
+	}
+	defer s.lockUser(first)()
+	defer s.lockUser(second)()
+
+	from, err := s.UserRepo.GetByID(ctx, order.From)
+	if err != nil {
+		return BookTransfer{}, err
+	}
+	to, err := s.UserRepo.GetByID(ctx, order.To)
+	if err != nil {
+		return BookTransfer{}, err
+	}
+	original, err := from.clone()
+	if err != nil {
+		return BookTransfer{}, err
+	}
+
+	date := s.now()
+	id := NewID()
+	sent := BookTransfer{
+		ID:           id,
+		Date:         date,
+		Counterparty: order.To,
+		Category:     order.FromCategory,
+		Amount:       Money{Amount: order.Amount.Amount.Neg(), Currency: order.Amount.Currency},
+		Description:  order.Description,
+	}
+	received := BookTransfer{
+		ID:           id,
+		Date:         date,
+		Counterparty: order.From,
+		Category:     order.ToCategory,
+		Amount:       order.Amount,
+		Description:  order.Description,
+	}
+	if err := from.transferBook(sent); err != nil {
+		return BookTransfer{}, err
+	}
+	if err := to.transferBook(received); err != nil {
+		return BookTransfer{}, err
+	}
+
+	if err := s.save(ctx, from, "transfer_between_books"); err != nil {
+		return BookTransfer{}, err
+	}
+	if err := s.save(ctx, to, "transfer_between_books"); err != nil {
+		if restoreErr := s.save(ctx, original, "restore_book_transfer"); restoreErr != nil {
+			return BookTransfer{}, errors.Join(err, restoreErr)
+		}
+		return BookTransfer{}, err
+	}
+	s.log().InfoContext(ctx, "transferred between books",
+		LogKeyUserID, userID, "from", order.From, "to", order.To, "amount", order.Amount.String())
+	s.publish(order.From, EventBalancesUpdated, NewBalancesSnapshot(from))
+	s.publish(order.To, EventBalancesUpdated, NewBalancesSnapshot(to))
+	s.Telemetry.Track(ctx, "books", "transfer", userID, nil)
+	return sent, nil
+}
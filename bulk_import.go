@@ -0,0 +1,257 @@
+package arus
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Expenses written per batch by a StatementImport unless set otherwise
+const DefaultImportBatchSize = 500
+
+// StatementReader yields statement lines one at a time. Read returns io.EOF
+// after the last line.
+type StatementReader interface {
+	Read() (StatementLine, error)
+}
+
+// CSVStatementReader reads statement lines from CSV whose header row names
+// date, description and amount columns, and optionally reference and status
+// columns. A status of "pending" marks authorizations not settled yet.
+// Amounts are written in Locale's conventions, debits negative unless Sign
+// says otherwise. NewCSVStatementReaderFor reads statements laid out as an
+// ImportProfile says instead.
+type CSVStatementReader struct {
+	Locale Locale
+	// Layout of the date column; empty means 2006-01-02
+	DateLayout string
+	Sign       AmountSign
+
+	csv     *csv.Reader
+	columns map[string]int
+	// Rows left to skip before the first line
+	skip int
+}
+
+func NewCSVStatementReader(r io.Reader, locale Locale) *CSVStatementReader {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+	reader.TrimLeadingSpace = true
+	return &CSVStatementReader{Locale: locale, csv: reader}
+}
+
+func (c *CSVStatementReader) readHeader() error {
+	header, err := c.csv.Read()
+	if err == io.EOF {
+		return errors.New("statement has no header row")
+	}
+	if err != nil {
+		return err
+	}
+	c.columns = make(map[string]int, len(header))
+	for i, name := range header {
+		c.columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"date", "description", "amount"} {
+		if _, ok := c.columns[required]; !ok {
+			return fmt.Errorf("statement has no %s column", required)
+		}
+	}
+	return nil
+}
+
+func (c *CSVStatementReader) Read() (StatementLine, error) {
+	for ; c.skip > 0; c.skip-- {
+		if _, err := c.csv.Read(); err != nil {
+			return StatementLine{}, err
+		}
+	}
+	if c.columns == nil {
+		if err := c.readHeader(); err != nil {
+			return StatementLine{}, err
+		}
+	}
+
+	record, err := c.csv.Read()
+	if err != nil {
+		return StatementLine{}, err
+	}
+	row, _ := c.csv.FieldPos(0)
+	field := func(name string) string {
+		i, ok := c.columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return record[i]
+	}
+
+	layout := c.DateLayout
+	if layout == "" {
+		layout = time.DateOnly
+	}
+	date, err := time.Parse(layout, field("date"))
+	if err != nil {
+		return StatementLine{}, fmt.Errorf("row %d: invalid date: %w", row, err)
+	}
+	amount, err := ParseMoney(field("amount"), c.Locale)
+	if err != nil {
+		return StatementLine{}, fmt.Errorf("row %d: %w", row, err)
+	}
+	if c.Sign == DebitsPositive {
+		amount.Amount = amount.Amount.Neg()
+	}
+	return StatementLine{
+		Date:        date,
+		Description: field("description"),
+		Amount:      amount,
+		Reference:   field("reference"),
+		Status:      transactionStatusCodes.parse(field("status")),
+	}, nil
+}
+
+// ImportProgress counts what an import has done so far. Credit lines and
+// lines recorded before are counted as skipped.
+type ImportProgress struct {
+	Lines   int
+	Applied int
+	Skipped int
+	Batches int
+}
+
+// StatementImport streams long statement histories, such as several years
+// exported at once, into a user's ledger. Only one batch of lines is held
+// in memory at a time besides the user. Each batch is applied atomically
+// and its transactions written as it is, while the user is saved once at
+// the end, or with the batches applied so far when one fails. Lines without
+// IDs get ones derived from the line, as in the ImportPipeline, so running
+// the import again after a failure skips what was already recorded.
+type StatementImport struct {
+	Service   *FinanceService
+	BatchSize int
+	// Called after every batch; nil reports nothing
+	Progress func(progress ImportProgress)
+}
+
+func NewStatementImport(service *FinanceService) *StatementImport {
+	return &StatementImport{Service: service, BatchSize: DefaultImportBatchSize}
+}
+
+// importLines records a batch of lines of the account's statement like
+// ProcessAccountStatement does, without checking balances or recording the
+// statement.
+func (u *User) importLines(ctx context.Context, account BankAccount, lines []StatementLine) (BatchReport, error) {
+	statement := AccountStatement{BankAccount: account, Lines: lines}
+	if u.creditCard(account) != nil {
+		return u.chargeCardLines(statement)
+	}
+	return u.processStatementDebits(ctx, statement)
+}
+
+// Run imports every line of the statement of account into the user's
+// ledger and returns the final progress, which is also returned on failure.
+// An account not linked yet is routed by its type, see RouteAccount. The
+// user stays locked until the import is done.
+func (im *StatementImport) Run(ctx context.Context, userID string, account BankAccount, statement StatementReader) (progress ImportProgress, err error) {
+	s := im.Service
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return progress, err
+	}
+	routed := false
+	if user.creditCard(account) == nil && user.CategoryFor(account) == nil {
+		if err := s.quotaFor(userID).Check(QuotaLinkedAccounts, user.LinkedAccountCount(), 1); err != nil {
+			return progress, err
+		}
+		if _, err := user.RouteAccount(account); err != nil {
+			return progress, err
+		}
+		routed = true
+	}
+
+	// Whatever was applied is saved, whether the import finishes or not
+	var covered Period
+	defer func() {
+		if progress.Batches == 0 && !routed {
+			return
+		}
+		if err == nil && progress.Lines > 0 {
+			user.StatementHistory = append(user.StatementHistory, StatementRecord{BankAccount: account, Period: covered})
+		}
+		if saveErr := s.save(ctx, user, "import_statement"); saveErr != nil {
+			err = errors.Join(err, saveErr)
+			return
+		}
+		s.publish(userID, EventBalancesUpdated, NewBalancesSnapshot(user))
+	}()
+
+	size := im.BatchSize
+	if size <= 0 {
+		size = DefaultImportBatchSize
+	}
+	batch := make([]StatementLine, 0, size)
+	key := account.AccountNumber + "@" + account.BankName
+	seen := make(map[string]int)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := s.loadStatement(ctx, user, account, batch); err != nil {
+			return err
+		}
+		if err := s.quotaFor(userID).Check(QuotaTransactions, user.TransactionCount(), len(batch)); err != nil {
+			return err
+		}
+		trial, err := user.clone()
+		if err != nil {
+			return err
+		}
+		report, err := trial.importLines(ctx, account, batch)
+		if err != nil {
+			return fmt.Errorf("batch %d ending at line %d: %w", progress.Batches+1, progress.Lines, err)
+		}
+		user = trial
+		progress.Applied += report.Applied
+		progress.Skipped += report.Skipped
+		progress.Batches++
+		batch = batch[:0]
+		if im.Progress != nil {
+			im.Progress(progress)
+		}
+		return nil
+	}
+
+	for {
+		line, err := statement.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return progress, err
+		}
+		progress.Lines++
+		if covered.StartDate.IsZero() || line.Date.Before(covered.StartDate) {
+			covered.StartDate = line.Date
+		}
+		if line.Date.After(covered.EndDate) {
+			covered.EndDate = line.Date
+		}
+
+		if line.ID == "" {
+			line.ID = derivedLineID("stmt-", key, line, seen)
+		}
+		batch = append(batch, line)
+		if len(batch) == size {
+			if err := flush(); err != nil {
+				return progress, err
+			}
+		}
+	}
+	return progress, flush()
+}
@@ -0,0 +1,185 @@
+package arus
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Phrases banks describe cash withdrawals with, besides "ATM"
+var cashWithdrawalPhrases = []string{"cash withdrawal", "tarik tunai", "penarikan tunai"}
+
+// CashWithdrawal moves money from a bank-backed category into Cash, as an
+// ATM withdrawal does. It is a transfer, not spending: the cash is spent by
+// the expenses the user logs against Cash.
+type CashWithdrawal struct {
+	// ID of the statement line the withdrawal was read from, if any
+	ID   string
+	Date time.Time
+	From CategoryType
+	// Always positive
+	Amount      Money
+	Description string `json:",omitempty"`
+}
+
+// CashAdjustment trues up the Cash balance to the cash the user counted.
+// Amount is signed: negative for cash spent without being logged, positive
+// for cash found.
+type CashAdjustment struct {
+	ID      string
+	Date    time.Time
+	Amount  Money
+	Counted Money
+	Reason  string `json:",omitempty"`
+}
+
+// isCashWithdrawal reports whether a bank statement debit takes out cash.
+func isCashWithdrawal(line StatementLine) bool {
+	description := strings.ToLower(line.Description)
+	words := strings.FieldsFunc(description, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	return slices.Contains(words, "atm") || slices.ContainsFunc(cashWithdrawalPhrases, func(phrase string) bool {
+		return strings.Contains(description, phrase)
+	})
+}
+
+// cash returns the user's Cash category, adding it the first time cash is
+// withdrawn.
+func (u *User) cash(currency string) *Category {
+	if _, exists := u.Categories[Cash]; !exists {
+		u.Categories[Cash] = NewCategory(Cash, currency)
+	}
+	u.Categories[Cash].HoldCurrency(currency)
+	return u.Categories[Cash]
+}
+
+// WithdrawCash moves amount from the category into Cash.
+func (u *User) WithdrawCash(from CategoryType, amount Money, date time.Time, description string) (CashWithdrawal, error) {
+	if !amount.Amount.IsPositive() {
+		return CashWithdrawal{}, errors.New("withdrawn amount must be positive")
+	}
+	if from == Cash {
+		return CashWithdrawal{}, errors.New("cash must be withdrawn from another category")
+	}
+	source, exists := u.Categories[from]
+	if !exists {
+		return CashWithdrawal{}, &CategoryNotFoundError{Category: from}
+	}
+	if err := source.Debit(amount); err != nil {
+		return CashWithdrawal{}, err
+	}
+	withdrawal := CashWithdrawal{ID: NewID(), Date: date, From: from, Amount: amount, Description: description}
+	return withdrawal, u.addCashWithdrawal(withdrawal)
+}
+
+// withdrawStatementCash moves an ATM withdrawal on the account's statement
+// from the account's category into Cash, once per line.
+func (u *User) withdrawStatementCash(account BankAccount, line StatementLine, tx Transaction) error {
+	if slices.ContainsFunc(u.CashWithdrawals, func(w CashWithdrawal) bool { return w.ID == tx.ID }) {
+		return nil
+	}
+	category := u.CategoryFor(account)
+	if category == nil {
+		return &AccountNotLinkedError{BankAccount: account}
+	}
+	amount := line.Amount.Abs()
+	if err := category.Debit(amount); err != nil {
+		return err
+	}
+	return u.addCashWithdrawal(CashWithdrawal{ID: tx.ID, Date: line.Date, From: category.Type, Amount: amount, Description: line.Description})
+}
+
+func (u *User) addCashWithdrawal(withdrawal CashWithdrawal) error {
+	if err := u.cash(withdrawal.Amount.Currency).Credit(withdrawal.Amount); err != nil {
+		return err
+	}
+	u.CashWithdrawals = append(u.CashWithdrawals, withdrawal)
+	return nil
+}
+
+// TrueUpCash sets the Cash balance in the counted amount's currency to it,
+// recording the difference as an adjustment. Cash that went missing counts
+// as spent. It returns a zero adjustment when the balance already matches.
+func (u *User) TrueUpCash(counted Money, date time.Time, reason string) (CashAdjustment, error) {
+	if counted.IsNegative() {
+		return CashAdjustment{}, errors.New("counted cash must not be negative")
+	}
+	category, exists := u.Categories[Cash]
+	if !exists {
+		return CashAdjustment{}, &CategoryNotFoundError{Category: Cash}
+	}
+	if err := category.checkCurrency(counted); err != nil {
+		return CashAdjustment{}, err
+	}
+	balance := category.BalanceIn(counted.Currency)
+	difference := Money{Amount: counted.Amount.Sub(balance.Amount), Currency: counted.Currency}
+	if difference.IsZero() {
+		return CashAdjustment{}, nil
+	}
+	var err error
+	if difference.IsNegative() {
+		err = category.Debit(difference)
+	} else {
+		err = category.Credit(difference)
+	}
+	if err != nil {
+		return CashAdjustment{}, err
+	}
+	adjustment := CashAdjustment{ID: NewID(), Date: date, Amount: difference, Counted: counted, Reason: reason}
+	u.CashAdjustments = append(u.CashAdjustments, adjustment)
+	return adjustment, nil
+}
+
+// WithdrawCash moves amount from the category into the user's Cash
+// category, for withdrawals not on an imported statement. Cash expenses are
+// logged with ProcessExpense and ExpenseOptions.Category set to Cash.
+func (s *FinanceService) WithdrawCash(ctx context.Context, userID string, from CategoryType, amount Money, description string) (CashWithdrawal, error) {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return CashWithdrawal{}, err
+	}
+	withdrawal, err := user.WithdrawCash(from, amount, s.now(), description)
+	if err != nil {
+		return CashWithdrawal{}, err
+	}
+
+	if err := s.save(ctx, user, "withdraw_cash"); err != nil {
+		return CashWithdrawal{}, err
+	}
+	s.log().InfoContext(ctx, "withdrew cash",
+		LogKeyUserID, userID, "from", from.String(), "amount", amount.String())
+	s.publish(userID, EventBalancesUpdated, NewBalancesSnapshot(user))
+	s.Telemetry.Track(ctx, "cash", "withdraw", userID, nil)
+	return withdrawal, nil
+}
+
+// TrueUpCash sets the user's Cash balance to the cash they counted, as they
+// might every week or so to catch the spending they did not log.
+func (s *FinanceService) TrueUpCash(ctx context.Context, userID string, counted Money, reason string) (CashAdjustment, error) {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return CashAdjustment{}, err
+	}
+	adjustment, err := user.TrueUpCash(counted, s.now(), reason)
+	if err != nil {
+		return CashAdjustment{}, err
+	}
+	if adjustment.Amount.IsZero() {
+		return adjustment, nil
+	}
+
+	if err := s.save(ctx, user, "true_up_cash"); err != nil {
+		return CashAdjustment{}, err
+	}
+	s.log().InfoContext(ctx, "trued up cash",
+		LogKeyUserID, userID, "counted", counted.String(), "adjustment", adjustment.Amount.String())
+	s.publish(userID, EventBalancesUpdated, NewBalancesSnapshot(user))
+	s.Telemetry.Track(ctx, "cash", "true_up", userID, nil)
+	return adjustment, nil
+}
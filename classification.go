@@ -0,0 +1,316 @@
+package arus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Auto-applied classifications below this confidence are queued for review.
+var DefaultReviewThreshold = decimal.NewFromFloat(0.8)
+
+// Classification records tags that were applied automatically, along with how
+// confident the classifier was and which rule produced them.
+type Classification struct {
+	Tags       []string
+	Confidence decimal.Decimal
+	Rule       string
+	Reviewed   bool
+}
+
+// ClassificationRule tags transactions whose description contains Pattern.
+// Accepted and Rejected count review outcomes and drive the rule's confidence.
+type ClassificationRule struct {
+	Pattern  string
+	Tags     []string
+	Accepted int
+	Rejected int
+}
+
+func (r ClassificationRule) Confidence() decimal.Decimal {
+	accepted := decimal.NewFromInt(int64(r.Accepted + 1))
+	total := decimal.NewFromInt(int64(r.Accepted + r.Rejected + 2))
+	return accepted.DivRound(total, 4)
+}
+
+func (r ClassificationRule) Matches(description string) bool {
+	return r.Pattern != "" && strings.Contains(normalizeDescription(description), r.Pattern)
+}
+
+// Classifier suggests tags for a transaction.
+type Classifier interface {
+	Classify(tx Transaction) (Classification, bool)
+}
+
+// RuleClassifier picks the most confident matching rule, preferring longer
+// (more specific) patterns on ties.
+type RuleClassifier struct {
+	Rules []ClassificationRule
+}
+
+func (c RuleClassifier) Classify(tx Transaction) (Classification, bool) {
+	var best *ClassificationRule
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+		if !rule.Matches(tx.Description) {
+			continue
+		}
+		if best == nil ||
+			rule.Confidence().GreaterThan(best.Confidence()) ||
+			(rule.Confidence().Equal(best.Confidence()) && len(rule.Pattern) > len(best.Pattern)) {
+			best = rule
+		}
+	}
+	if best == nil {
+		return Classification{}, false
+	}
+	return Classification{
+		Tags:       slices.Clone(best.Tags),
+		Confidence: best.Confidence(),
+		Rule:       best.Pattern,
+	}, true
+}
+
+// Expense waiting for the user to accept or correct its classification
+type ReviewItem struct {
+	ID        string
+	ExpenseID string
+	Suggested Classification
+
+	// Position of the expense, which items stored before they were keyed by
+	// ExpenseID point at, until resolved
+	legacyIndex *int
+}
+
+type reviewItemAlias ReviewItem
+
+type reviewItemJSON struct {
+	*reviewItemAlias
+	ExpenseIndex *int `json:",omitempty"`
+}
+
+// MarshalJSON keeps the position of items not resolved yet, so saving the
+// user does not lose which expense they are about.
+func (r ReviewItem) MarshalJSON() ([]byte, error) {
+	return json.Marshal(reviewItemJSON{reviewItemAlias: (*reviewItemAlias)(&r), ExpenseIndex: r.legacyIndex})
+}
+
+func (r *ReviewItem) UnmarshalJSON(data []byte) error {
+	decoded := reviewItemJSON{reviewItemAlias: (*reviewItemAlias)(r)}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	if r.ExpenseID == "" {
+		r.legacyIndex = decoded.ExpenseIndex
+	}
+	return nil
+}
+
+// resolveReviewItems keys the review items stored by expense position by
+// the ID of that expense instead. Items pointing past the loaded expenses
+// wait for the next call, once the rest are loaded.
+func (u *User) resolveReviewItems() {
+	for i := range u.ReviewQueue {
+		item := &u.ReviewQueue[i]
+		if item.legacyIndex != nil && *item.legacyIndex >= 0 && *item.legacyIndex < len(u.Expenses) {
+			item.ExpenseID = u.Expenses[*item.legacyIndex].ID
+			item.legacyIndex = nil
+		}
+	}
+}
+
+// unresolvedReviewItems reports whether review items are still keyed by
+// expense position.
+func (u *User) unresolvedReviewItems() bool {
+	return slices.ContainsFunc(u.ReviewQueue, func(item ReviewItem) bool { return item.legacyIndex != nil })
+}
+
+// reviewedExpenseIDs returns the IDs of the expenses under review.
+func (u *User) reviewedExpenseIDs() []string {
+	ids := make([]string, 0, len(u.ReviewQueue))
+	for _, item := range u.ReviewQueue {
+		ids = append(ids, item.ExpenseID)
+	}
+	return ids
+}
+
+func (u *User) classifyExpense(index int) {
+	expense := &u.Expenses[index]
+	if len(expense.Tags) > 0 {
+		return
+	}
+
+	classification, ok := RuleClassifier{Rules: u.ClassificationRules}.Classify(*expense)
+	if !ok {
+		return
+	}
+	expense.Tags = classification.Tags
+	expense.Classification = &classification
+
+	if classification.Confidence.LessThan(u.ReviewThreshold) {
+		u.ReviewQueue = append(u.ReviewQueue, ReviewItem{
+			ID:        NewID(),
+			ExpenseID: expense.ID,
+			Suggested: classification,
+		})
+	}
+}
+
+func (u *User) reviewItem(id string) (int, ReviewItem, error) {
+	for i, item := range u.ReviewQueue {
+		if item.ID == id {
+			return i, item, nil
+		}
+	}
+	return -1, ReviewItem{}, fmt.Errorf("review item %s not found", id)
+}
+
+// AcceptClassification confirms the suggested tags and reinforces the rule
+// that produced them.
+func (u *User) AcceptClassification(id string) error {
+	position, item, err := u.reviewItem(id)
+	if err != nil {
+		return err
+	}
+
+	expense, err := u.Expense(item.ExpenseID)
+	if err != nil {
+		return err
+	}
+
+	if rule := u.classificationRule(item.Suggested.Rule); rule != nil {
+		rule.Accepted++
+	}
+	if expense.Classification != nil {
+		expense.Classification.Reviewed = true
+	}
+
+	u.ReviewQueue = slices.Delete(u.ReviewQueue, position, position+1)
+	return nil
+}
+
+// CorrectClassification replaces the suggested tags, penalizes the rule that
+// suggested them, and learns a rule for the expense description so similar
+// expenses are tagged correctly next time.
+func (u *User) CorrectClassification(id string, tags []string) error {
+	position, item, err := u.reviewItem(id)
+	if err != nil {
+		return err
+	}
+
+	expense, err := u.Expense(item.ExpenseID)
+	if err != nil {
+		return err
+	}
+
+	if rule := u.classificationRule(item.Suggested.Rule); rule != nil && !slices.Equal(rule.Tags, tags) {
+		rule.Rejected++
+	}
+
+	expense.Tags = slices.Clone(tags)
+	if expense.Classification != nil {
+		expense.Classification.Reviewed = true
+	}
+	u.LearnClassification(expense.Description, tags)
+
+	u.ReviewQueue = slices.Delete(u.ReviewQueue, position, position+1)
+	return nil
+}
+
+// LearnClassification records that descriptions like this one carry tags.
+func (u *User) LearnClassification(description string, tags []string) {
+	pattern := normalizeDescription(description)
+	if pattern == "" {
+		return
+	}
+
+	if rule := u.classificationRule(pattern); rule != nil {
+		if slices.Equal(rule.Tags, tags) {
+			rule.Accepted++
+			return
+		}
+		rule.Tags = slices.Clone(tags)
+		rule.Accepted, rule.Rejected = 1, 0
+		return
+	}
+
+	u.ClassificationRules = append(u.ClassificationRules, ClassificationRule{
+		Pattern:  pattern,
+		Tags:     slices.Clone(tags),
+		Accepted: 1,
+	})
+}
+
+func (u *User) classificationRule(pattern string) *ClassificationRule {
+	if pattern == "" {
+		return nil
+	}
+	for i := range u.ClassificationRules {
+		if u.ClassificationRules[i].Pattern == pattern {
+			return &u.ClassificationRules[i]
+		}
+	}
+	return nil
+}
+
+func normalizeDescription(description string) string {
+	return strings.ToLower(strings.Join(strings.Fields(description), " "))
+}
+
+func (s *FinanceService) ReviewQueue(ctx context.Context, userID string) ([]ReviewItem, error) {
+	defer s.readLockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return user.ReviewQueue, nil
+}
+
+func (s *FinanceService) AcceptClassification(ctx context.Context, userID string, itemID string) error {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.loadTransactionIDs(ctx, user, user.reviewedExpenseIDs()...); err != nil {
+		return err
+	}
+
+	if err := user.AcceptClassification(itemID); err != nil {
+		return err
+	}
+
+	if err := s.save(ctx, user, "accept_classification"); err != nil {
+		return err
+	}
+	s.Telemetry.Track(ctx, "classification", "accept", userID, nil)
+	return nil
+}
+
+func (s *FinanceService) CorrectClassification(ctx context.Context, userID string, itemID string, tags []string) error {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.loadTransactionIDs(ctx, user, user.reviewedExpenseIDs()...); err != nil {
+		return err
+	}
+
+	if err := user.CorrectClassification(itemID, tags); err != nil {
+		return err
+	}
+
+	if err := s.save(ctx, user, "correct_classification"); err != nil {
+		return err
+	}
+	s.Telemetry.Track(ctx, "classification", "correct", userID, nil)
+	return nil
+}
@@ -0,0 +1,294 @@
+// Package client calls the GraphQL API of an arus instance from other Go
+// services, with typed methods, retries and idempotency keys.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dnswd/arus"
+)
+
+// Delays before each retry of a failed request unless set otherwise
+var DefaultRetryDelays = []time.Duration{200 * time.Millisecond, time.Second, 5 * time.Second}
+
+// Client calls the GraphQL endpoint at Endpoint. Requests that don't reach
+// the server, fail with a 5xx or 429 status, or find their idempotency key
+// still in progress are retried after RetryDelays. Every mutation carries
+// an idempotency key, the same across its retries, so it is applied once;
+// the key is taken from the context when set with arus.WithIdempotencyKey,
+// and generated otherwise.
+type Client struct {
+	Endpoint string
+	// Nil uses http.DefaultClient
+	HTTPClient *http.Client
+	// Sent with every request, such as an Authorization header
+	Header http.Header
+	// Nil uses DefaultRetryDelays; empty disables retries
+	RetryDelays []time.Duration
+}
+
+func NewClient(endpoint string) *Client {
+	return &Client{Endpoint: endpoint}
+}
+
+// Error is the errors the API reported for a request. It matches the arus
+// errors it reports with errors.Is, such as arus.ErrInsufficientFunds.
+type Error struct {
+	Messages []string
+}
+
+func (e *Error) Error() string {
+	return "arus: " + strings.Join(e.Messages, "; ")
+}
+
+func (e *Error) Is(target error) bool {
+	for _, message := range e.Messages {
+		if strings.Contains(message, target.Error()) {
+			return true
+		}
+	}
+	return false
+}
+
+// StatusError is a response other than 200 OK.
+type StatusError struct {
+	StatusCode int
+	Body       string
+	// From the Retry-After header of 429 and 503 responses
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("arus: %s: %s", http.StatusText(e.StatusCode), e.Body)
+}
+
+type request struct {
+	Query     string         `json:"query"`
+	Variables map[string]any `json:"variables,omitempty"`
+}
+
+type response struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// retryable reports whether a failed attempt may be repeated, and after
+// how long at least.
+func retryable(err error) (time.Duration, bool) {
+	switch err := err.(type) {
+	case *StatusError:
+		return err.RetryAfter, err.StatusCode == http.StatusTooManyRequests || err.StatusCode >= 500
+	case *Error:
+		return 0, err.Is(arus.ErrRequestInProgress)
+	}
+	return 0, true
+}
+
+// do runs the query and decodes its data into out, retrying failures.
+func (c *Client) do(ctx context.Context, query string, variables map[string]any, mutation bool, out any) error {
+	body, err := json.Marshal(request{Query: query, Variables: variables})
+	if err != nil {
+		return err
+	}
+	var key string
+	if mutation {
+		var ok bool
+		if key, ok = arus.IdempotencyKeyFrom(ctx); !ok {
+			key = arus.NewID()
+		}
+	}
+
+	delays := c.RetryDelays
+	if delays == nil {
+		delays = DefaultRetryDelays
+	}
+	for attempt := 0; ; attempt++ {
+		err = c.attempt(ctx, body, key, out)
+		if err == nil || ctx.Err() != nil || attempt == len(delays) {
+			return err
+		}
+		wait, ok := retryable(err)
+		if !ok {
+			return err
+		}
+		timer := time.NewTimer(max(wait, delays[attempt]))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, body []byte, key string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, values := range c.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(arus.IdempotencyKeyHeader, key)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		text, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		statusErr := &StatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(text))}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			statusErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return statusErr
+	}
+
+	var decoded response
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return fmt.Errorf("arus: decoding response: %w", err)
+	}
+	if len(decoded.Errors) > 0 {
+		apiErr := &Error{}
+		for _, e := range decoded.Errors {
+			apiErr.Messages = append(apiErr.Messages, e.Message)
+		}
+		return apiErr
+	}
+	return json.Unmarshal(decoded.Data, out)
+}
+
+// AllocateIncome allocates an income across the user's categories by
+// their rules.
+func (c *Client) AllocateIncome(ctx context.Context, userID string, income arus.Money) error {
+	return c.AllocateIncomeFrom(ctx, userID, income, arus.UnspecifiedSource)
+}
+
+// AllocateIncomeFrom allocates an income like AllocateIncome, recording
+// where it came from.
+func (c *Client) AllocateIncomeFrom(ctx context.Context, userID string, income arus.Money, source arus.IncomeSource) error {
+	const query = `mutation($userId: ID!, $amount: String!, $currency: String!, $source: String) {
+		allocateIncome(userId: $userId, amount: $amount, currency: $currency, source: $source) { id }
+	}`
+	variables := map[string]any{
+		"userId":   userID,
+		"amount":   income.Amount.String(),
+		"currency": income.Currency,
+	}
+	if source != arus.UnspecifiedSource {
+		variables["source"] = source.Code()
+	}
+	var data struct {
+		AllocateIncome *struct{ ID string }
+	}
+	if err := c.do(ctx, query, variables, true, &data); err != nil {
+		return err
+	}
+	if data.AllocateIncome == nil {
+		return arus.ErrUserNotFound
+	}
+	return nil
+}
+
+// ImportStatement imports a CSV statement of the bank account, with date,
+// description and amount columns written in locale's conventions; the zero
+// Locale means en-US.
+func (c *Client) ImportStatement(ctx context.Context, userID string, account arus.BankAccount, statement io.Reader, locale arus.Locale) (arus.ImportProgress, error) {
+	const query = `mutation($userId: ID!, $accountNumber: String!, $bankName: String, $accountType: String, $statement: String!, $locale: String) {
+		importStatement(userId: $userId, accountNumber: $accountNumber, bankName: $bankName,
+			accountType: $accountType, statement: $statement, locale: $locale) {
+			lines applied skipped batches
+		}
+	}`
+	content, err := io.ReadAll(statement)
+	if err != nil {
+		return arus.ImportProgress{}, err
+	}
+	variables := map[string]any{
+		"userId":        userID,
+		"accountNumber": account.AccountNumber,
+		"bankName":      account.BankName,
+		"statement":     string(content),
+	}
+	if locale.Tag != "" {
+		variables["locale"] = locale.Tag
+	}
+	if account.Type != arus.UnspecifiedAccount {
+		variables["accountType"] = account.Type.Code()
+	}
+	var data struct {
+		ImportStatement arus.ImportProgress
+	}
+	err = c.do(ctx, query, variables, true, &data)
+	return data.ImportStatement, err
+}
+
+// GetSummary returns the summary of a month of the user the client is
+// authenticated as, in their time zone and fiscal month scheme. The
+// summary's transactions are not included.
+func (c *Client) GetSummary(ctx context.Context, year int, month time.Month) (arus.PeriodSummary, error) {
+	const query = `query($year: Int!, $month: Int!) {
+		user {
+			summary(year: $year, month: $month) {
+				period { startDate endDate }
+				totalIncome { amount currency }
+				totalExpense { amount currency }
+				net { amount currency }
+				roundingDifference { amount currency }
+				fxGainLoss { amount currency }
+				deductions { category amount { amount currency } }
+				incomeBySource { source amount { amount currency } }
+			}
+		}
+	}`
+	var data struct {
+		User *struct {
+			Summary struct {
+				arus.PeriodSummary
+				Deductions     []arus.Deduction
+				IncomeBySource []struct {
+					Source arus.IncomeSource
+					Amount arus.Money
+				}
+			}
+		}
+	}
+	err := c.do(ctx, query, map[string]any{"year": year, "month": int(month)}, false, &data)
+	if err != nil {
+		return arus.PeriodSummary{}, err
+	}
+	if data.User == nil {
+		return arus.PeriodSummary{}, arus.ErrUserNotFound
+	}
+	summary := data.User.Summary.PeriodSummary
+	summary.Deductions = make(map[arus.CategoryType]arus.Money, len(data.User.Summary.Deductions))
+	for _, deduction := range data.User.Summary.Deductions {
+		summary.Deductions[deduction.Category] = deduction.Amount
+	}
+	if len(data.User.Summary.IncomeBySource) > 0 {
+		summary.IncomeBySource = make(map[arus.IncomeSource]arus.Money, len(data.User.Summary.IncomeBySource))
+		for _, total := range data.User.Summary.IncomeBySource {
+			summary.IncomeBySource[total.Source] = total.Amount
+		}
+	}
+	return summary, nil
+}
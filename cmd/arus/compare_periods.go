@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/dnswd/arus"
+)
+
+func runComparePeriods(ctx context.Context, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("compare-periods", flag.ContinueOnError)
+	backend := flags.String("backend", "sqlite", "storage backend (sqlite, postgres)")
+	dsn := flags.String("dsn", "", "connection string")
+	autoMigrate := flags.Bool("auto-migrate", true, "apply pending schema migrations first")
+	userID := flags.String("user", "", "user to report on")
+	month := flags.String("month", "", "month to compare, as YYYY-MM; the current month if empty")
+	against := flags.String("against", "previous", "month to compare with: previous, last-year or YYYY-MM")
+	localeTag := flags.String("locale", "", "locale amounts are written in; the user's if empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *userID == "" {
+		return errors.New("--user is required")
+	}
+	var current time.Time
+	if *month != "" {
+		parsed, err := time.Parse("2006-01", *month)
+		if err != nil {
+			return fmt.Errorf("invalid --month %q: %w", *month, err)
+		}
+		current = parsed
+	}
+
+	store, db, err := arus.OpenSQLBackend(ctx, *backend, *dsn, arus.SQLBackendOptions{AutoMigrate: *autoMigrate})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	service := &arus.FinanceService{UserRepo: store.Users}
+	user, err := store.Users.GetByID(ctx, *userID)
+	if err != nil {
+		return err
+	}
+	locale := user.Locale()
+	if *localeTag != "" {
+		var ok bool
+		if locale, ok = arus.LookupLocale(*localeTag); !ok {
+			return fmt.Errorf("unknown locale %q", *localeTag)
+		}
+	}
+
+	date := time.Now()
+	if !current.IsZero() {
+		date = user.MonthlyPeriod(current.Year(), current.Month()).StartDate
+	}
+	var comparison arus.PeriodComparison
+	switch *against {
+	case "previous":
+		period := user.MonthlyPeriodOf(date)
+		comparison, err = service.ComparePeriods(ctx, *userID, period.Previous(), period)
+	case "last-year":
+		comparison, err = service.CompareWithLastYear(ctx, *userID, date)
+	default:
+		base, parseErr := time.Parse("2006-01", *against)
+		if parseErr != nil {
+			return fmt.Errorf("invalid --against %q: want previous, last-year or YYYY-MM", *against)
+		}
+		comparison, err = service.ComparePeriods(ctx, *userID, user.MonthlyPeriod(base.Year(), base.Month()), user.MonthlyPeriodOf(date))
+	}
+	if err != nil {
+		return err
+	}
+	return comparison.Render(stdout, locale)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"os"
+
+	"github.com/dnswd/arus"
+)
+
+func runExportLedger(ctx context.Context, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("export-ledger", flag.ContinueOnError)
+	backend := flags.String("backend", "sqlite", "storage backend (sqlite, postgres)")
+	dsn := flags.String("dsn", "", "connection string")
+	autoMigrate := flags.Bool("auto-migrate", true, "apply pending schema migrations first")
+	userID := flags.String("user", "", "user whose ledger to export")
+	format := flags.String("format", string(arus.LedgerBeancount), "beancount, gnucash-accounts or gnucash-transactions")
+	out := flags.String("out", "", "file to write; stdout if empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *userID == "" {
+		return errors.New("--user is required")
+	}
+
+	store, db, err := arus.OpenSQLBackend(ctx, *backend, *dsn, arus.SQLBackendOptions{AutoMigrate: *autoMigrate})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	service := &arus.FinanceService{UserRepo: store.Users}
+
+	if *out == "" {
+		return service.ExportLedger(ctx, *userID, arus.LedgerFormat(*format), stdout)
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := service.ExportLedger(ctx, *userID, arus.LedgerFormat(*format), f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
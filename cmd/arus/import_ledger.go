@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dnswd/arus"
+)
+
+func runImportLedger(ctx context.Context, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("import-ledger", flag.ContinueOnError)
+	backend := flags.String("backend", "sqlite", "storage backend (sqlite, postgres)")
+	dsn := flags.String("dsn", "", "connection string")
+	autoMigrate := flags.Bool("auto-migrate", true, "apply pending schema migrations first")
+	userID := flags.String("user", "", "user to import into")
+	file := flags.String("file", "", "Beancount or ledger-cli file")
+	accounts := make(map[string]arus.CategoryType)
+	flags.Func("map", "map an account and its children to a category, as Assets:Bank:Savings=savings; repeatable", func(value string) error {
+		account, code, found := strings.Cut(value, "=")
+		category := arus.ParseCategoryType(code)
+		if !found || account == "" || category == arus.UnknownCategory {
+			return fmt.Errorf("want <account>=<category>, got %q", value)
+		}
+		accounts[account] = category
+		return nil
+	})
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *userID == "" || *file == "" {
+		return errors.New("--user and --file are required")
+	}
+
+	store, db, err := arus.OpenSQLBackend(ctx, *backend, *dsn, arus.SQLBackendOptions{AutoMigrate: *autoMigrate})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	service := &arus.FinanceService{UserRepo: store.Users}
+	report, err := service.ImportPlaintext(ctx, *userID, f, accounts)
+	if err != nil {
+		return err
+	}
+	for _, skipped := range report.Skipped {
+		fmt.Fprintf(stdout, "skipped line %d %q: %s\n", skipped.Line, skipped.Description, skipped.Reason)
+	}
+	fmt.Fprintf(stdout, "imported %d incomes and %d expenses, skipped %d transactions\n",
+		len(report.Incomes), len(report.Expenses), len(report.Skipped))
+	return nil
+}
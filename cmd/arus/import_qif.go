@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dnswd/arus"
+)
+
+func runImportQIF(ctx context.Context, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("import-qif", flag.ContinueOnError)
+	backend := flags.String("backend", "sqlite", "storage backend (sqlite, postgres)")
+	dsn := flags.String("dsn", "", "connection string")
+	autoMigrate := flags.Bool("auto-migrate", true, "apply pending schema migrations first")
+	userID := flags.String("user", "", "user to import into")
+	file := flags.String("file", "", "QIF file exported by Quicken or MS Money")
+	localeTag := flags.String("locale", arus.LocaleEnUS.Tag, "locale amounts are written in")
+	dayFirst := flags.Bool("day-first", false, "dates are written day first")
+	accounts := make(map[string]arus.BankAccount)
+	flags.Func("map", "import a QIF account into a linked account, as Checking=12345678@Mandiri; an empty name maps transactions outside any account; repeatable", func(value string) error {
+		name, account, found := strings.Cut(value, "=")
+		number, bank, _ := strings.Cut(account, "@")
+		if !found || number == "" {
+			return fmt.Errorf("want <account>=<number>@<bank>, got %q", value)
+		}
+		accounts[name] = arus.BankAccount{AccountNumber: number, BankName: bank}
+		return nil
+	})
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *userID == "" || *file == "" || len(accounts) == 0 {
+		return errors.New("--user, --file and --map are required")
+	}
+	locale, ok := arus.LookupLocale(*localeTag)
+	if !ok {
+		return fmt.Errorf("unknown locale %q", *localeTag)
+	}
+
+	store, db, err := arus.OpenSQLBackend(ctx, *backend, *dsn, arus.SQLBackendOptions{AutoMigrate: *autoMigrate})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	service := &arus.FinanceService{UserRepo: store.Users}
+	lines, err := service.ImportQIF(ctx, *userID, f, arus.QIFOptions{Locale: locale, DayFirst: *dayFirst}, accounts)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "imported %d lines\n", lines)
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dnswd/arus"
+)
+
+func runImportStatement(ctx context.Context, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("import-statement", flag.ContinueOnError)
+	backend := flags.String("backend", "sqlite", "storage backend (sqlite, postgres)")
+	dsn := flags.String("dsn", "", "connection string")
+	autoMigrate := flags.Bool("auto-migrate", true, "apply pending schema migrations first")
+	userID := flags.String("user", "", "user to import into")
+	accountNumber := flags.String("account", "", "number of the linked bank account")
+	bankName := flags.String("bank", "", "name of the bank holding the account")
+	accountType := flags.String("account-type", "", "checking, savings, custodian or e-wallet; detected from the bank name if empty")
+	file := flags.String("file", "", "CSV statement with date, description and amount columns")
+	localeTag := flags.String("locale", arus.LocaleEnUS.Tag, "locale amounts are written in")
+	batchSize := flags.Int("batch", arus.DefaultImportBatchSize, "expenses applied per batch")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *userID == "" || *accountNumber == "" || *file == "" {
+		return errors.New("--user, --account and --file are required")
+	}
+	locale, ok := arus.LookupLocale(*localeTag)
+	if !ok {
+		return fmt.Errorf("unknown locale %q", *localeTag)
+	}
+
+	store, db, err := arus.OpenSQLBackend(ctx, *backend, *dsn, arus.SQLBackendOptions{AutoMigrate: *autoMigrate})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	im := arus.NewStatementImport(&arus.FinanceService{UserRepo: store.Users})
+	im.BatchSize = *batchSize
+	im.Progress = func(progress arus.ImportProgress) {
+		fmt.Fprintf(stdout, "read %d lines, applied %d expenses\n", progress.Lines, progress.Applied)
+	}
+
+	account := arus.BankAccount{AccountNumber: *accountNumber, BankName: *bankName, Type: arus.ParseAccountType(*accountType)}
+	progress, err := im.Run(ctx, *userID, account, arus.NewCSVStatementReader(f, locale))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "imported %d lines: %d expenses applied, %d skipped\n", progress.Lines, progress.Applied, progress.Skipped)
+	return nil
+}
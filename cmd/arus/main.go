@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/dnswd/arus"
+	"github.com/dnswd/arus/scenario"
+	"github.com/shopspring/decimal"
+)
+
+// newLogger logs to stderr at the level named by LOG_LEVEL (debug, info,
+// warn, error), info by default.
+func newLogger() *slog.Logger {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(os.Getenv("LOG_LEVEL"))); err != nil {
+		level = slog.LevelInfo
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+}
+
+func main() {
+	slog.SetDefault(newLogger())
+
+	if len(os.Args) > 1 {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		var err error
+		switch os.Args[1] {
+		case "migrate":
+			err = runMigrate(ctx, os.Args[2:], os.Stdout)
+		case "migrate-data":
+			err = runMigrateData(ctx, os.Args[2:], os.Stdout)
+		case "import-statement":
+			err = runImportStatement(ctx, os.Args[2:], os.Stdout)
+		case "compare-periods":
+			err = runComparePeriods(ctx, os.Args[2:], os.Stdout)
+		case "tax-summary":
+			err = runTaxSummary(ctx, os.Args[2:], os.Stdout)
+		case "import-ledger":
+			err = runImportLedger(ctx, os.Args[2:], os.Stdout)
+		case "import-qif":
+			err = runImportQIF(ctx, os.Args[2:], os.Stdout)
+		case "export-ledger":
+			err = runExportLedger(ctx, os.Args[2:], os.Stdout)
+		case "verify":
+			err = runVerify(ctx, os.Args[2:], os.Stdout)
+		case "scenarios":
+			if !scenario.RunAll(ctx, os.Stdout, scenario.DesignScenarios()...) {
+				err = errors.New("some scenarios failed")
+			}
+		default:
+			err = fmt.Errorf("unknown command %q", os.Args[1])
+		}
+		if err != nil {
+			stop()
+			slog.Error("command failed", "command", os.Args[1], "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	ctx := context.Background()
+	repo := arus.NewInMemoryUserRepository()
+
+	// Create a new user
+	user := arus.NewUser("user123")
+	slog.Info("creating user", arus.LogKeyUserID, user.ID)
+
+	user.AllocationRules = []arus.AllocationRule{
+		{CategoryType: arus.Expense, Percentage: decimal.NewFromFloat(0.5)},
+		{CategoryType: arus.Emergency, Percentage: decimal.NewFromFloat(0.3)},
+		{CategoryType: arus.Savings, Percentage: decimal.NewFromFloat(0.2)},
+	}
+
+	period := arus.CreateMonthlyPeriod(2023, time.September)
+
+	income := arus.Money{Amount: decimal.NewFromInt(1000), Currency: "USD"}
+	err := user.AllocateIncome(income, time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC), "September Salary")
+	if err != nil {
+		slog.Warn("allocating income failed", arus.LogKeyUserID, user.ID, "error", err)
+	}
+
+	jcart, _ := json.Marshal(arus.NewUserView(user, arus.AudienceOwner))
+	slog.Debug("user state", arus.LogKeyUserID, user.ID, "state", json.RawMessage(jcart))
+
+	expenseAmount := arus.Money{Amount: decimal.NewFromInt(900), Currency: "USD"}
+	expense := arus.NewExpense(expenseAmount, time.Date(2023, 9, 15, 0, 0, 0, 0, time.UTC), "Car Repair")
+	if err := user.ProcessExpense(expense); err != nil {
+		slog.Warn("processing expense failed", arus.LogKeyUserID, user.ID, arus.LogKeyTransactionID, expense.ID, "error", err)
+	}
+
+	// Save after the last change, so what is reported is what was stored
+	if err := repo.Save(ctx, user); err != nil {
+		slog.Error("saving user failed", arus.LogKeyUserID, user.ID, "error", err)
+		os.Exit(1)
+	}
+
+	// Retrieve the user
+	user, err = repo.GetByID(ctx, "user123")
+	if err != nil {
+		slog.Error("retrieving user failed", arus.LogKeyUserID, "user123", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("retrieved user", arus.LogKeyUserID, user.ID)
+
+	jcart, _ = json.Marshal(arus.NewUserView(user, arus.AudienceOwner))
+	slog.Debug("user state", arus.LogKeyUserID, user.ID, "state", json.RawMessage(jcart))
+
+	// Get expense summary
+	summary := user.GetPeriodSummary(period)
+	fmt.Printf("Total Expenses: %s\n", summary.TotalExpense.Format(arus.LocaleEnUS))
+	for _, e := range summary.Expenses {
+		fmt.Printf(" - %s: %s on %s\n", e.Description, e.Amount.Format(arus.LocaleEnUS), e.Date.Format("2006-01-02"))
+		for _, d := range e.Deductions {
+			fmt.Printf("     from %s: %s\n", d.Category, d.Amount.Format(arus.LocaleEnUS))
+		}
+	}
+
+	// Get income summary
+	fmt.Printf("Total Income: %s\n", summary.TotalIncome.Format(arus.LocaleEnUS))
+	for _, i := range summary.Incomes {
+		fmt.Printf(" - %s: %s on %s\n", i.Description, i.Amount.Format(arus.LocaleEnUS), i.Date.Format("2006-01-02"))
+	}
+
+	// Check income status
+	status := user.CheckIncomeStatus(period)
+	fmt.Printf("Income Status: %s\n", status)
+}
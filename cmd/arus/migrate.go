@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dnswd/arus"
+)
+
+func runMigrate(ctx context.Context, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	backend := flags.String("backend", "sqlite", "storage backend (sqlite, postgres)")
+	dsn := flags.String("dsn", "", "connection string")
+	status := flags.Bool("status", false, "list the migrations and whether they are applied, without applying any")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, dialect, err := arus.OpenSQLDatabase(*backend, *dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if *status {
+		states, err := arus.MigrationStatus(ctx, db)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		for _, state := range states {
+			applied := "pending"
+			if !state.Pending() {
+				applied = "applied " + state.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", state.Version, state.Name, applied)
+		}
+		return w.Flush()
+	}
+
+	applied, err := arus.Migrate(ctx, db, dialect)
+	for _, migration := range applied {
+		fmt.Fprintf(stdout, "applied %04d %s\n", migration.Version, migration.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		fmt.Fprintln(stdout, "schema is up to date")
+	}
+	return nil
+}
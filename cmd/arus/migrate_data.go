@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/dnswd/arus"
+)
+
+func runMigrateData(ctx context.Context, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("migrate-data", flag.ContinueOnError)
+	from := flags.String("from", "", "source backend (sqlite, postgres)")
+	to := flags.String("to", "", "destination backend (sqlite, postgres)")
+	fromDSN := flags.String("from-dsn", "", "source connection string")
+	toDSN := flags.String("to-dsn", "", "destination connection string")
+	autoMigrate := flags.Bool("auto-migrate", true, "apply pending schema migrations to both backends first")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *from == "" || *to == "" {
+		return errors.New("both --from and --to are required")
+	}
+
+	source, sourceDB, err := arus.OpenSQLBackend(ctx, *from, *fromDSN, arus.SQLBackendOptions{AutoMigrate: *autoMigrate})
+	if err != nil {
+		return fmt.Errorf("opening source: %w", err)
+	}
+	defer sourceDB.Close()
+
+	destination, destinationDB, err := arus.OpenSQLBackend(ctx, *to, *toDSN, arus.SQLBackendOptions{AutoMigrate: *autoMigrate})
+	if err != nil {
+		return fmt.Errorf("opening destination: %w", err)
+	}
+	defer destinationDB.Close()
+
+	digest, err := arus.MigrateData(ctx, source, destination, func(user *arus.User) {
+		fmt.Fprintln(stdout, "migrated user", user.ID)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "verified %d users, %d transactions, %d exchange rates and %d admin actions\n",
+		digest.Rows(arus.TableUsers), digest.Rows(arus.TableTransactions),
+		digest.Rows(arus.TableExchangeRates), digest.Rows(arus.TableAdminActions))
+	return nil
+}
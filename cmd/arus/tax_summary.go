@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/dnswd/arus"
+)
+
+func runTaxSummary(ctx context.Context, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("tax-summary", flag.ContinueOnError)
+	backend := flags.String("backend", "sqlite", "storage backend (sqlite, postgres)")
+	dsn := flags.String("dsn", "", "connection string")
+	autoMigrate := flags.Bool("auto-migrate", true, "apply pending schema migrations first")
+	userID := flags.String("user", "", "user to report on")
+	year := flags.Int("year", 0, "calendar year the tax year starts in; the current tax year if 0")
+	groupBy := flags.String("group-by", string(arus.GroupByTag), "group deductible expenses by tag or merchant")
+	format := flags.String("format", "csv", "csv or pdf")
+	out := flags.String("out", "", "file to write; stdout if empty")
+	localeTag := flags.String("locale", "", "locale amounts are written in on PDFs; the user's if empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *userID == "" {
+		return errors.New("--user is required")
+	}
+	if *format != "csv" && *format != "pdf" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	store, db, err := arus.OpenSQLBackend(ctx, *backend, *dsn, arus.SQLBackendOptions{AutoMigrate: *autoMigrate})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	service := &arus.FinanceService{UserRepo: store.Users}
+	user, err := store.Users.GetByID(ctx, *userID)
+	if err != nil {
+		return err
+	}
+	locale := user.Locale()
+	if *localeTag != "" {
+		var ok bool
+		if locale, ok = arus.LookupLocale(*localeTag); !ok {
+			return fmt.Errorf("unknown locale %q", *localeTag)
+		}
+	}
+	if *year == 0 {
+		*year = user.TaxYearOf(time.Now()).StartDate.Year()
+	}
+	summary, err := service.TaxSummary(ctx, *userID, *year, arus.TaxGrouping(*groupBy))
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		return writeTaxSummary(stdout, summary, *format, locale)
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := writeTaxSummary(f, summary, *format, locale); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeTaxSummary(w io.Writer, summary arus.TaxSummary, format string, locale arus.Locale) error {
+	if format == "pdf" {
+		return summary.WritePDF(w, locale)
+	}
+	return summary.WriteCSV(w)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+
+	"github.com/dnswd/arus"
+)
+
+func runVerify(ctx context.Context, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	backend := flags.String("backend", "sqlite", "storage backend (sqlite, postgres)")
+	dsn := flags.String("dsn", "", "connection string")
+	autoMigrate := flags.Bool("auto-migrate", true, "apply pending schema migrations first")
+	userID := flags.String("user", "", "user to verify; every active user if empty")
+	repair := flags.Bool("repair", false, "correct drifted balances with adjustment entries")
+	reason := flags.String("reason", "balance verification", "reason recorded on the adjustments")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	store, db, err := arus.OpenSQLBackend(ctx, *backend, *dsn, arus.SQLBackendOptions{AutoMigrate: *autoMigrate})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	service := &arus.FinanceService{UserRepo: store.Users}
+
+	drifted := make(map[string][]arus.BalanceDrift)
+	var verifyErr error
+	if *userID != "" {
+		drifts, err := service.VerifyBalances(ctx, *userID)
+		if err != nil {
+			return err
+		}
+		if len(drifts) > 0 {
+			drifted[*userID] = drifts
+		}
+	} else {
+		// Report what could be verified even when some users could not
+		drifted, verifyErr = service.VerifyAllBalances(ctx)
+		if drifted == nil {
+			return verifyErr
+		}
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(drifted)) {
+		for _, drift := range drifted[id] {
+			fmt.Fprintf(stdout, "%s\t%s\tdrift %s\n", id, drift, drift.Drift().StringFixed())
+		}
+		if !*repair {
+			continue
+		}
+		adjustments, err := service.RepairBalances(ctx, id, *reason)
+		if err != nil {
+			return fmt.Errorf("repairing balances of user %s: %w", id, err)
+		}
+		fmt.Fprintf(stdout, "%s\trecorded %d adjustments\n", id, len(adjustments))
+	}
+	if verifyErr != nil {
+		return verifyErr
+	}
+	if len(drifted) == 0 {
+		fmt.Fprintln(stdout, "balances match their history")
+	} else if !*repair {
+		return fmt.Errorf("%d users have drifted balances", len(drifted))
+	}
+	return nil
+}
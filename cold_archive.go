@@ -0,0 +1,367 @@
+package arus
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Version of the period archive format written by ArchiveClosedPeriods.
+// Archives of this version or older can be read back.
+const PeriodArchiveFormat = 1
+
+// How long after a period ends it is archived by default
+const DefaultColdArchiveAfter = 365 * 24 * time.Hour
+
+// ColdArchive moves the transactions of closed periods out of the user and
+// into object storage, such as an S3BlobStore pointed at S3, or at GCS
+// through its S3-compatible API, keeping the hot database small.
+type ColdArchive struct {
+	Store BlobStore
+	// How long after a period ends it is archived; zero uses
+	// DefaultColdArchiveAfter. Periods are never archived before the
+	// user's lock window has closed them.
+	After time.Duration
+}
+
+// ArchivedPeriod is a monthly period whose transactions are in cold
+// storage under Key.
+type ArchivedPeriod struct {
+	Period   Period
+	Key      string
+	Incomes  int
+	Expenses int
+	// The period's totals when it was archived
+	Totals PeriodTotals
+	// Hex-encoded SHA-256 of the stored archive
+	SHA256     string
+	ArchivedAt time.Time
+}
+
+// PeriodArchive is what is stored for an archived period, as gzipped JSON.
+type PeriodArchive struct {
+	Format     int
+	UserID     string
+	Period     Period
+	Totals     PeriodTotals
+	Incomes    []Transaction
+	Expenses   []Transaction
+	ArchivedAt time.Time
+}
+
+// checkNotArchived rejects recording a transaction dated in an archived
+// period, whose totals can no longer change.
+func (u *User) checkNotArchived(date time.Time) error {
+	for _, archived := range u.ArchivedPeriods {
+		if archived.Period.Contains(date) {
+			return fmt.Errorf("%w: %s", ErrPeriodArchived, archived.Period.StartDate.Format("January 2006"))
+		}
+	}
+	return nil
+}
+
+func (u *User) archivedPeriod(period Period) bool {
+	return slices.ContainsFunc(u.ArchivedPeriods, func(archived ArchivedPeriod) bool {
+		return archived.Period.StartDate.Equal(period.StartDate)
+	})
+}
+
+// closedPeriods returns the monthly periods with transactions that ended
+// before cutoff and can be archived, oldest first. Periods with pending
+// transactions wait until they settle.
+func (u *User) closedPeriods(cutoff time.Time) []Period {
+	var periods []Period
+	blocked := make(map[time.Time]bool)
+	for _, transactions := range [][]Transaction{u.Incomes, u.Expenses} {
+		for _, tx := range transactions {
+			period := u.MonthlyPeriodOf(tx.Date)
+			if !period.EndDate.Before(cutoff) || u.archivedPeriod(period) {
+				continue
+			}
+			if tx.Status == Pending {
+				blocked[period.StartDate] = true
+			}
+			if !slices.ContainsFunc(periods, func(p Period) bool { return p.StartDate.Equal(period.StartDate) }) {
+				periods = append(periods, period)
+			}
+		}
+	}
+	periods = slices.DeleteFunc(periods, func(p Period) bool { return blocked[p.StartDate] })
+	slices.SortFunc(periods, func(a, b Period) int { return a.StartDate.Compare(b.StartDate) })
+	return periods
+}
+
+func periodArchiveKey(userID string, period Period) string {
+	return fmt.Sprintf("archives/%s/%s.v%d.json.gz", userID, period.StartDate.Format(time.DateOnly), PeriodArchiveFormat)
+}
+
+func encodePeriodArchive(archive PeriodArchive) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(gz).Encode(archive); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodePeriodArchive(data []byte) (PeriodArchive, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return PeriodArchive{}, err
+	}
+	defer gz.Close()
+
+	var archive PeriodArchive
+	if err := json.NewDecoder(gz).Decode(&archive); err != nil {
+		return PeriodArchive{}, err
+	}
+	if archive.Format < 1 || archive.Format > PeriodArchiveFormat {
+		return PeriodArchive{}, fmt.Errorf("unsupported period archive format %d", archive.Format)
+	}
+	return archive, nil
+}
+
+// ArchiveClosedPeriods moves the transactions of the user's closed monthly
+// periods to cold storage, one archive per period, and returns the periods
+// archived. Reports on archived periods read them back on demand.
+func (s *FinanceService) ArchiveClosedPeriods(ctx context.Context, userID string) (_ []ArchivedPeriod, err error) {
+	ctx, span := s.startSpan(ctx, "ArchiveClosedPeriods", userID)
+	defer endSpan(span, &err)
+
+	if s.Cold == nil {
+		return nil, errors.New("no cold archive configured")
+	}
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.loadHistory(ctx, user); err != nil {
+		return nil, err
+	}
+	after := s.Cold.After
+	if after <= 0 {
+		after = DefaultColdArchiveAfter
+	}
+	after = max(after, user.LockWindow)
+	periods := user.closedPeriods(s.now().Add(-after))
+	// Left behind by an earlier run whose prune failed
+	stray := user.archivedLeftovers()
+	if len(periods) == 0 && len(stray) == 0 {
+		return nil, nil
+	}
+	if !user.totalsCurrent() {
+		user.RebuildTotals()
+	}
+
+	var archived []ArchivedPeriod
+	moved := stray
+	inArchivedPeriod := func(tx Transaction) bool { return user.checkNotArchived(tx.Date) != nil }
+	user.Incomes = slices.DeleteFunc(user.Incomes, inArchivedPeriod)
+	user.Expenses = slices.DeleteFunc(user.Expenses, inArchivedPeriod)
+	for _, period := range periods {
+		inPeriod := func(tx Transaction) bool { return period.Contains(tx.Date) }
+		archive := PeriodArchive{
+			Format:     PeriodArchiveFormat,
+			UserID:     userID,
+			Period:     period,
+			Totals:     user.Totals.Months[monthKey(period)],
+			Incomes:    transactionsIn(user.Incomes, period),
+			Expenses:   transactionsIn(user.Expenses, period),
+			ArchivedAt: s.now(),
+		}
+		data, err := encodePeriodArchive(archive)
+		if err != nil {
+			return nil, fmt.Errorf("encoding archive of %s: %w", period.StartDate.Format(time.DateOnly), err)
+		}
+		// Stored before the transactions leave the user, so a failure
+		// loses nothing; a retry overwrites the same key
+		key := periodArchiveKey(userID, period)
+		if err := s.Cold.Store.Put(ctx, key, bytes.NewReader(data), "application/gzip"); err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		archived = append(archived, ArchivedPeriod{
+			Period:     period,
+			Key:        key,
+			Incomes:    len(archive.Incomes),
+			Expenses:   len(archive.Expenses),
+			Totals:     archive.Totals,
+			SHA256:     hex.EncodeToString(sum[:]),
+			ArchivedAt: archive.ArchivedAt,
+		})
+		for _, tx := range slices.Concat(archive.Incomes, archive.Expenses) {
+			moved = append(moved, tx.ID)
+		}
+		user.Incomes = slices.DeleteFunc(user.Incomes, inPeriod)
+		user.Expenses = slices.DeleteFunc(user.Expenses, inPeriod)
+	}
+	user.ArchivedPeriods = append(user.ArchivedPeriods, archived...)
+
+	if err := s.save(ctx, user, "archive_periods"); err != nil {
+		return nil, err
+	}
+	s.log().InfoContext(ctx, "archived closed periods",
+		LogKeyUserID, userID, "periods", len(archived), "transactions", len(moved))
+	s.Telemetry.Track(ctx, "archive", "periods", userID, map[string]string{
+		"periods": strconv.Itoa(len(archived)),
+	})
+	return archived, nil
+}
+
+// archivedLeftovers returns the IDs of transactions still held by the user
+// in periods already archived, which a failed prune leaves behind.
+func (u *User) archivedLeftovers() []string {
+	var ids []string
+	for _, transactions := range [][]Transaction{u.Incomes, u.Expenses} {
+		for _, tx := range transactions {
+			if u.checkNotArchived(tx.Date) != nil {
+				ids = append(ids, tx.ID)
+			}
+		}
+	}
+	return ids
+}
+
+func transactionsIn(transactions []Transaction, period Period) []Transaction {
+	var matching []Transaction
+	for _, tx := range transactions {
+		if period.Contains(tx.Date) {
+			matching = append(matching, tx)
+		}
+	}
+	return matching
+}
+
+// ArchiveAllClosedPeriods runs ArchiveClosedPeriods for every active user,
+// e.g. from a nightly job. It returns how many periods were archived.
+func (s *FinanceService) ArchiveAllClosedPeriods(ctx context.Context) (int, error) {
+	iterator, ok := s.UserRepo.(UserIterator)
+	if !ok {
+		return 0, errors.New("repository does not support iterating users")
+	}
+
+	var userIDs []string
+	err := iterator.ForEach(ctx, func(user *User) error {
+		if !user.Archived() {
+			userIDs = append(userIDs, user.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	var errs []error
+	for _, userID := range userIDs {
+		archived, err := s.ArchiveClosedPeriods(ctx, userID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("archiving periods of user %s: %w", userID, err))
+			continue
+		}
+		count += len(archived)
+	}
+	return count, errors.Join(errs...)
+}
+
+// loadPeriodArchive reads an archived period back from cold storage.
+func (s *FinanceService) loadPeriodArchive(ctx context.Context, archived ArchivedPeriod) (PeriodArchive, error) {
+	if s.Cold == nil {
+		return PeriodArchive{}, fmt.Errorf("%w: no cold archive configured to read %s", ErrPeriodArchived,
+			archived.Period.StartDate.Format("January 2006"))
+	}
+	blob, err := s.Cold.Store.Get(ctx, archived.Key)
+	if err != nil {
+		return PeriodArchive{}, err
+	}
+	defer blob.Close()
+
+	data, err := io.ReadAll(blob)
+	if err != nil {
+		return PeriodArchive{}, err
+	}
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != archived.SHA256 {
+		return PeriodArchive{}, fmt.Errorf("archive %s is corrupt: checksum mismatch", archived.Key)
+	}
+	return decodePeriodArchive(data)
+}
+
+// archivedTransactions reads back the transactions of the user's archived
+// periods that overlap any of periods, oldest first.
+func (s *FinanceService) archivedTransactions(ctx context.Context, user *User, periods ...Period) (incomes, expenses []Transaction, err error) {
+	for _, archived := range user.ArchivedPeriods {
+		overlaps := slices.ContainsFunc(periods, func(p Period) bool {
+			return !archived.Period.StartDate.After(p.EndDate) && !p.StartDate.After(archived.Period.EndDate)
+		})
+		if !overlaps {
+			continue
+		}
+		archive, err := s.loadPeriodArchive(ctx, archived)
+		if err != nil {
+			return nil, nil, err
+		}
+		incomes = append(incomes, archive.Incomes...)
+		expenses = append(expenses, archive.Expenses...)
+	}
+	sortByDate := func(a, b Transaction) int { return a.Date.Compare(b.Date) }
+	slices.SortStableFunc(incomes, sortByDate)
+	slices.SortStableFunc(expenses, sortByDate)
+	return incomes, expenses, nil
+}
+
+// rehydrate loads the transactions of the periods into user, a copy loaded
+// for a report, and puts those of archived periods overlapping them back
+// too. It is not saved, so the transactions stay archived.
+func (s *FinanceService) rehydrate(ctx context.Context, user *User, periods ...Period) error {
+	if err := s.loadPeriods(ctx, user, periods...); err != nil {
+		return err
+	}
+	incomes, expenses, err := s.archivedTransactions(ctx, user, periods...)
+	if err != nil {
+		return err
+	}
+	// Archived periods are older than anything the user still holds
+	user.Incomes = append(notLoaded(incomes, user.Incomes), user.Incomes...)
+	user.Expenses = append(notLoaded(expenses, user.Expenses), user.Expenses...)
+	return nil
+}
+
+// notLoaded drops the transactions also in loaded, such as archived ones a
+// failed prune left in the repository, whose archived copy would count
+// them twice.
+func notLoaded(archived, loaded []Transaction) []Transaction {
+	held := make(map[string]bool, len(loaded))
+	for _, tx := range loaded {
+		held[tx.ID] = true
+	}
+	return slices.DeleteFunc(archived, func(tx Transaction) bool { return held[tx.ID] })
+}
+
+// readUserFor loads a copy of the user with the transactions of periods,
+// archived ones read back too, for reports on them.
+func (s *FinanceService) readUserFor(ctx context.Context, userID string, periods ...Period) (*User, error) {
+	defer s.readLockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.rehydrate(ctx, user, periods...); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
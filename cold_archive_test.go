@@ -0,0 +1,167 @@
+package arus
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestArchiveClosedPeriods(t *testing.T) {
+	start := time.Date(2022, time.January, 5, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2024, time.January, 15, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		after time.Duration
+		// Month whose expense is left pending, if any
+		pending      time.Month
+		wantArchived int
+	}{
+		{name: "periods closed a year ago", wantArchived: 12},
+		{name: "shorter age", after: 180 * 24 * time.Hour, wantArchived: 18},
+		{name: "never before the lock window", after: 24 * time.Hour, wantArchived: 21},
+		{name: "pending transactions hold their period back", pending: time.March, wantArchived: 11},
+	}
+	repos := []struct {
+		name string
+		open func(t *testing.T) UserRepository
+	}{
+		{"in memory", func(*testing.T) UserRepository { return NewInMemoryUserRepository() }},
+		{"sqlite", func(t *testing.T) UserRepository { return openTestStore(t, SQLBackendOptions{}).Users }},
+	}
+	for _, repo := range repos {
+		for _, tt := range tests {
+			t.Run(repo.name+"/"+tt.name, func(t *testing.T) {
+				ctx := context.Background()
+				users := repo.open(t)
+				blobs := NewDiskBlobStore(t.TempDir())
+				service := &FinanceService{
+					UserRepo: users,
+					Clock:    NewFakeClock(now),
+					Cold:     &ColdArchive{Store: blobs, After: tt.after},
+				}
+
+				user := newFundedUser(t, "u1", "100", start)
+				var months []Period
+				for month := range 24 {
+					date := start.AddDate(0, month, 0)
+					months = append(months, user.MonthlyPeriodOf(date))
+					if month > 0 {
+						if err := user.AllocateIncome(money(t, "100", "USD"), date, "salary"); err != nil {
+							t.Fatal(err)
+						}
+					}
+					if err := user.ProcessExpense(NewExpense(money(t, "30", "USD"), date.AddDate(0, 0, 5), "rent")); err != nil {
+						t.Fatal(err)
+					}
+					if date.Year() == 2022 && date.Month() == tt.pending {
+						user.Expenses[len(user.Expenses)-1].Status = Pending
+					}
+				}
+				if err := users.Save(ctx, user); err != nil {
+					t.Fatal(err)
+				}
+				var before []PeriodSummary
+				for _, month := range months {
+					before = append(before, user.GetPeriodSummary(month))
+				}
+
+				archived, err := service.ArchiveClosedPeriods(ctx, "u1")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(archived) != tt.wantArchived {
+					t.Fatalf("archived %d periods, want %d", len(archived), tt.wantArchived)
+				}
+
+				for i, month := range months {
+					got, err := service.GetPeriodSummary(ctx, "u1", month)
+					if err != nil {
+						t.Fatalf("summary of %s: %v", month.StartDate.Format("2006-01"), err)
+					}
+					if !got.TotalIncome.Amount.Equal(before[i].TotalIncome.Amount) ||
+						!got.TotalExpense.Amount.Equal(before[i].TotalExpense.Amount) ||
+						len(got.Expenses) != len(before[i].Expenses) {
+						t.Errorf("summary of %s read back %s in and %s out, want %s and %s",
+							month.StartDate.Format("2006-01"), got.TotalIncome, got.TotalExpense,
+							before[i].TotalIncome, before[i].TotalExpense)
+					}
+				}
+
+				stored, err := users.GetByID(ctx, "u1")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := service.loadHistory(ctx, stored); err != nil {
+					t.Fatal(err)
+				}
+				if held, want := len(stored.Incomes), 24-tt.wantArchived; held != want {
+					t.Errorf("user holds %d incomes after archiving, want %d", held, want)
+				}
+				if count := stored.TransactionCount(); count != 48 {
+					t.Errorf("TransactionCount = %d, want 48", count)
+				}
+
+				first := archived[0].Period.StartDate.AddDate(0, 0, 3)
+				err = service.ProcessExpense(ctx, "u1", money(t, "1", "USD"), first, "late", ExpenseOptions{})
+				if !errors.Is(err, ErrPeriodArchived) {
+					t.Errorf("recording an expense in an archived period returned %v, want ErrPeriodArchived", err)
+				}
+
+				again, err := service.ArchiveClosedPeriods(ctx, "u1")
+				if err != nil || len(again) != 0 {
+					t.Errorf("archiving again archived %d periods, %v; want none", len(again), err)
+				}
+			})
+		}
+	}
+}
+
+func TestArchivedPeriodReadErrors(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2022, time.January, 5, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		// Breaks the archive of the first period, stored under path
+		corrupt func(t *testing.T, service *FinanceService, path string)
+	}{
+		{name: "changed archive", corrupt: func(t *testing.T, _ *FinanceService, path string) {
+			if err := os.WriteFile(path, []byte("tampered"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{name: "missing archive", corrupt: func(t *testing.T, _ *FinanceService, path string) {
+			if err := os.Remove(path); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{name: "no cold archive configured", corrupt: func(_ *testing.T, service *FinanceService, _ string) {
+			service.Cold = nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			users := NewInMemoryUserRepository()
+			service := &FinanceService{
+				UserRepo: users,
+				Clock:    NewFakeClock(start.AddDate(2, 0, 0)),
+				Cold:     &ColdArchive{Store: NewDiskBlobStore(dir)},
+			}
+			if err := users.Save(ctx, newFundedUser(t, "u1", "100", start)); err != nil {
+				t.Fatal(err)
+			}
+			archived, err := service.ArchiveClosedPeriods(ctx, "u1")
+			if err != nil || len(archived) != 1 {
+				t.Fatalf("archived %v, %v; want one period", archived, err)
+			}
+
+			tt.corrupt(t, service, filepath.Join(dir, filepath.FromSlash(archived[0].Key)))
+			if _, err := service.GetPeriodSummary(ctx, "u1", archived[0].Period); err == nil {
+				t.Error("read back the summary of a period whose archive can't be read")
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package arus
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ComparisonRow is one figure of two periods side by side.
+type ComparisonRow struct {
+	Label string
+	// Set on the rows of a category's spending
+	Category *CategoryType `json:",omitempty"`
+	Base     Money
+	Current  Money
+}
+
+// Change is how much the figure moved from the base period.
+func (r ComparisonRow) Change() Money {
+	return Money{Amount: r.Current.Amount.Sub(r.Base.Amount), Currency: r.Current.Currency}
+}
+
+// PercentChange is the change relative to the base period, e.g. 12.5 for
+// 12.5% more. It returns false when the base figure is zero.
+func (r ComparisonRow) PercentChange() (decimal.Decimal, bool) {
+	if r.Base.Amount.IsZero() {
+		return decimal.Zero, false
+	}
+	return r.Change().Amount.Div(r.Base.Amount.Abs()).Mul(decimal.NewFromInt(100)).Round(1), true
+}
+
+// PeriodComparison compares the figures of two periods: income, spending,
+// the spending covered by each category, and net.
+type PeriodComparison struct {
+	Base    Period
+	Current Period
+	Rows    []ComparisonRow
+}
+
+// ComparePeriods compares current with base, such as a month with the one
+// before.
+func (u *User) ComparePeriods(base, current Period) PeriodComparison {
+	before, after := u.GetPeriodSummary(base), u.GetPeriodSummary(current)
+	comparison := PeriodComparison{Base: base, Current: current}
+	add := func(label string, category *CategoryType, base, current Money) {
+		comparison.Rows = append(comparison.Rows, ComparisonRow{Label: label, Category: category, Base: base, Current: current})
+	}
+
+	add("Income", nil, before.TotalIncome, after.TotalIncome)
+	add("Spending", nil, before.TotalExpense.Abs(), after.TotalExpense.Abs())
+	categories := slices.Sorted(maps.Keys(before.Deductions))
+	for categoryType := range after.Deductions {
+		if _, seen := before.Deductions[categoryType]; !seen {
+			categories = append(categories, categoryType)
+		}
+	}
+	slices.Sort(categories)
+	zero := NewMoneyZero(u.Currency())
+	for _, categoryType := range categories {
+		add(categoryType.String()+" spending", &categoryType,
+			orZero(before.Deductions[categoryType], zero), orZero(after.Deductions[categoryType], zero))
+	}
+	add("Net", nil, before.Net, after.Net)
+	return comparison
+}
+
+// orZero returns m, or zero when m is unset.
+func orZero(m, zero Money) Money {
+	if m.Currency == "" {
+		return zero
+	}
+	return m
+}
+
+// CompareWithPreviousMonth compares the monthly period containing date with
+// the one before it.
+func (u *User) CompareWithPreviousMonth(date time.Time) PeriodComparison {
+	period := u.MonthlyPeriodOf(date)
+	return u.ComparePeriods(period.Previous(), period)
+}
+
+// CompareWithLastYear compares the monthly period containing date with the
+// same month a year earlier.
+func (u *User) CompareWithLastYear(date time.Time) PeriodComparison {
+	period := u.MonthlyPeriodOf(date)
+	return u.ComparePeriods(u.MonthlyPeriodOf(period.StartDate.AddDate(-1, 0, 0)), period)
+}
+
+// Render writes the comparison as a table.
+func (c PeriodComparison) Render(w io.Writer, locale Locale) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "\t%s\t%s\tChange\t%%\t\n", c.Base.StartDate.Format("Jan 2006"), c.Current.StartDate.Format("Jan 2006"))
+	for _, row := range c.Rows {
+		percent := "-"
+		if change, ok := row.PercentChange(); ok {
+			percent = change.StringFixed(1) + "%"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t\n", row.Label,
+			row.Base.Format(locale), row.Current.Format(locale), row.Change().Format(locale), percent)
+	}
+	return tw.Flush()
+}
+
+func (s *FinanceService) ComparePeriods(ctx context.Context, userID string, base, current Period) (PeriodComparison, error) {
+	user, err := s.readUserFor(ctx, userID, base, current)
+	if err != nil {
+		return PeriodComparison{}, err
+	}
+	return user.ComparePeriods(base, current), nil
+}
+
+// CompareWithLastYear compares the user's month containing date with the
+// same month a year earlier.
+func (s *FinanceService) CompareWithLastYear(ctx context.Context, userID string, date time.Time) (PeriodComparison, error) {
+	user, err := s.readUser(ctx, userID)
+	if err != nil {
+		return PeriodComparison{}, err
+	}
+	current := user.MonthlyPeriodOf(date)
+	if err := s.rehydrate(ctx, user, current, user.MonthlyPeriodOf(current.StartDate.AddDate(-1, 0, 0))); err != nil {
+		return PeriodComparison{}, err
+	}
+	return user.CompareWithLastYear(date), nil
+}
@@ -0,0 +1,69 @@
+package arus
+
+import "sync"
+
+// userLocks serializes changes to each user within a process, so concurrent
+// calls for the same user cannot interleave their read, change and save.
+// Other users are not held up.
+type userLocks struct {
+	mu    sync.Mutex
+	locks map[string]*userLock
+}
+
+type userLock struct {
+	sync.RWMutex
+	// Callers holding or waiting for the lock
+	refs int
+}
+
+// acquire locks the user for writing, or for reading when shared, and
+// returns the function that unlocks it.
+func (l *userLocks) acquire(userID string, shared bool) (unlock func()) {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*userLock)
+	}
+	lock, exists := l.locks[userID]
+	if !exists {
+		lock = &userLock{}
+		l.locks[userID] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	if shared {
+		lock.RLock()
+	} else {
+		lock.Lock()
+	}
+
+	return func() {
+		if shared {
+			lock.RUnlock()
+		} else {
+			lock.Unlock()
+		}
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		lock.refs--
+		if lock.refs == 0 {
+			delete(l.locks, userID)
+		}
+	}
+}
+
+// lockUser holds the user exclusively until the returned function is
+// called. Use it around every load, change and save of a user:
+//
+//	defer s.lockUser(userID)()
+func (s *FinanceService) lockUser(userID string) func() {
+	return s.locks.acquire(userID, false)
+}
+
+// readLockUser holds the user against changes, but not against other
+// readers, until the returned function is called.
+func (s *FinanceService) readLockUser(userID string) func() {
+	return s.locks.acquire(userID, true)
+}
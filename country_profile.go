@@ -0,0 +1,231 @@
+package arus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How often a user's salary typically arrives
+type SalaryCadence int
+
+const (
+	SalaryMonthly SalaryCadence = iota
+	SalarySemiMonthly
+	SalaryBiweekly
+	SalaryWeekly
+)
+
+func (c SalaryCadence) String() string {
+	names := [...]string{"Monthly", "SemiMonthly", "Biweekly", "Weekly"}
+	if c < 0 || int(c) >= len(names) {
+		return "Unknown"
+	}
+	return names[c]
+}
+
+// Holiday recurring on the same date every year
+type Holiday struct {
+	Month time.Month
+	Day   int
+	Name  string
+}
+
+// HolidayCalendar lists a country's fixed-date public holidays. Movable
+// holidays (Easter, lunar new year, Eid) differ every year and are not
+// included.
+type HolidayCalendar struct {
+	Holidays []Holiday
+}
+
+// Holiday returns the holiday falling on date, if any.
+func (c HolidayCalendar) Holiday(date time.Time) (Holiday, bool) {
+	for _, holiday := range c.Holidays {
+		if date.Month() == holiday.Month && date.Day() == holiday.Day {
+			return holiday, true
+		}
+	}
+	return Holiday{}, false
+}
+
+// IsBusinessDay reports whether date is neither a weekend nor a holiday.
+func (c HolidayCalendar) IsBusinessDay(date time.Time) bool {
+	if date.Weekday() == time.Saturday || date.Weekday() == time.Sunday {
+		return false
+	}
+	_, holiday := c.Holiday(date)
+	return !holiday
+}
+
+// CountryProfile holds the regional defaults applied when a user onboards.
+type CountryProfile struct {
+	// ISO 3166-1 alpha-2 code
+	Code          string
+	Name          string
+	Currency      string
+	Locale        Locale
+	Timezone      string
+	WeekStart     time.Weekday
+	SalaryCadence SalaryCadence
+	// Day of the month pay periods (fiscal months) start on; 1 means
+	// calendar months
+	FiscalMonthStart int
+	// First day of the tax year
+	TaxYearStartMonth time.Month
+	TaxYearStartDay   int
+	Holidays          HolidayCalendar
+}
+
+// TaxYear returns the tax year starting in the given calendar year.
+func (p CountryProfile) TaxYear(year int) Period {
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	start := time.Date(year, p.TaxYearStartMonth, p.TaxYearStartDay, 0, 0, 0, 0, loc)
+	return periodUntil(start, start.AddDate(1, 0, 0))
+}
+
+// ReportSchedule is the profile's default delivery schedule for a report:
+// weekly reports go out at the start of the local week.
+func (p CountryProfile) ReportSchedule(kind ReportKind) ReportSchedule {
+	schedule := DefaultReportSchedule(kind)
+	if schedule.Interval == Weekly {
+		schedule.Weekday = p.WeekStart
+	}
+	return schedule
+}
+
+// Apply configures a new user with the profile's currency, time zone and
+// period scheme. Categories that already hold money keep their currency.
+func (p CountryProfile) Apply(user *User) {
+	user.Country = p.Code
+	user.Timezone = p.Timezone
+	user.FiscalMonthStart = p.FiscalMonthStart
+
+	for _, category := range user.Categories {
+		if !category.Balance.IsZero() {
+			continue
+		}
+		category.Balance = NewMoneyZero(p.Currency)
+		for _, account := range category.Accounts {
+			account.Balance = NewMoneyZero(p.Currency)
+		}
+	}
+}
+
+var (
+	profileMu       sync.RWMutex
+	countryProfiles = map[string]CountryProfile{
+		"US": {
+			Code: "US", Name: "United States", Currency: "USD", Locale: LocaleEnUS,
+			Timezone: "America/New_York", WeekStart: time.Sunday, SalaryCadence: SalaryBiweekly,
+			FiscalMonthStart: 1, TaxYearStartMonth: time.January, TaxYearStartDay: 1,
+			Holidays: HolidayCalendar{Holidays: []Holiday{
+				{time.January, 1, "New Year's Day"},
+				{time.June, 19, "Juneteenth"},
+				{time.July, 4, "Independence Day"},
+				{time.November, 11, "Veterans Day"},
+				{time.December, 25, "Christmas Day"},
+			}},
+		},
+		"GB": {
+			Code: "GB", Name: "United Kingdom", Currency: "GBP", Locale: LocaleEnGB,
+			Timezone: "Europe/London", WeekStart: time.Monday, SalaryCadence: SalaryMonthly,
+			FiscalMonthStart: 1, TaxYearStartMonth: time.April, TaxYearStartDay: 6,
+			Holidays: HolidayCalendar{Holidays: []Holiday{
+				{time.January, 1, "New Year's Day"},
+				{time.December, 25, "Christmas Day"},
+				{time.December, 26, "Boxing Day"},
+			}},
+		},
+		"ID": {
+			Code: "ID", Name: "Indonesia", Currency: "IDR", Locale: LocaleIdID,
+			Timezone: "Asia/Jakarta", WeekStart: time.Monday, SalaryCadence: SalaryMonthly,
+			FiscalMonthStart: 25, TaxYearStartMonth: time.January, TaxYearStartDay: 1,
+			Holidays: HolidayCalendar{Holidays: []Holiday{
+				{time.January, 1, "Tahun Baru Masehi"},
+				{time.May, 1, "Hari Buruh"},
+				{time.June, 1, "Hari Lahir Pancasila"},
+				{time.August, 17, "Hari Kemerdekaan"},
+				{time.December, 25, "Hari Natal"},
+			}},
+		},
+		"DE": {
+			Code: "DE", Name: "Germany", Currency: "EUR", Locale: LocaleDeDE,
+			Timezone: "Europe/Berlin", WeekStart: time.Monday, SalaryCadence: SalaryMonthly,
+			FiscalMonthStart: 1, TaxYearStartMonth: time.January, TaxYearStartDay: 1,
+			Holidays: HolidayCalendar{Holidays: []Holiday{
+				{time.January, 1, "Neujahr"},
+				{time.May, 1, "Tag der Arbeit"},
+				{time.October, 3, "Tag der Deutschen Einheit"},
+				{time.December, 25, "Erster Weihnachtstag"},
+				{time.December, 26, "Zweiter Weihnachtstag"},
+			}},
+		},
+		"JP": {
+			Code: "JP", Name: "Japan", Currency: "JPY", Locale: LocaleJaJP,
+			Timezone: "Asia/Tokyo", WeekStart: time.Sunday, SalaryCadence: SalaryMonthly,
+			FiscalMonthStart: 25, TaxYearStartMonth: time.January, TaxYearStartDay: 1,
+			Holidays: HolidayCalendar{Holidays: []Holiday{
+				{time.January, 1, "元日"},
+				{time.February, 11, "建国記念の日"},
+				{time.May, 3, "憲法記念日"},
+				{time.May, 5, "こどもの日"},
+				{time.November, 3, "文化の日"},
+			}},
+		},
+	}
+)
+
+// RegisterCountryProfile adds or replaces a country profile.
+func RegisterCountryProfile(profile CountryProfile) {
+	profileMu.Lock()
+	defer profileMu.Unlock()
+
+	profile.Code = strings.ToUpper(profile.Code)
+	countryProfiles[profile.Code] = profile
+}
+
+func LookupCountryProfile(code string) (CountryProfile, bool) {
+	profileMu.RLock()
+	defer profileMu.RUnlock()
+
+	profile, ok := countryProfiles[strings.ToUpper(code)]
+	return profile, ok
+}
+
+// Profile returns the user's country profile, if they chose one.
+func (u *User) Profile() (CountryProfile, bool) {
+	if u.Country == "" {
+		return CountryProfile{}, false
+	}
+	return LookupCountryProfile(u.Country)
+}
+
+// Locale returns the locale amounts are shown in for the user.
+func (u *User) Locale() Locale {
+	if profile, ok := u.Profile(); ok {
+		return profile.Locale
+	}
+	return LocaleEnUS
+}
+
+// Onboard creates a user pre-configured for a country.
+func (s *FinanceService) Onboard(ctx context.Context, country string) (*User, error) {
+	profile, ok := LookupCountryProfile(country)
+	if !ok {
+		return nil, fmt.Errorf("unknown country profile %q", country)
+	}
+
+	user := NewUser("")
+	profile.Apply(user)
+
+	if err := s.save(ctx, user, "onboard"); err != nil {
+		return nil, err
+	}
+	s.Telemetry.Track(ctx, "users", "onboard", user.ID, map[string]string{"country": profile.Code})
+	return user, nil
+}
@@ -0,0 +1,478 @@
+package arus
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Days a card statement line may be posted before or after the charge was
+// recorded and still match it
+const cardPostingLag = 3 * 24 * time.Hour
+
+// CreditCard is a card whose charges are expenses when they are made, while
+// the money only leaves the bank when the bill is paid. Paying the bill is
+// a transfer that settles what the card owes, not a second expense.
+type CreditCard struct {
+	Account BankAccount
+	// Day of the month billing cycles start on (1-28)
+	CycleStartDay int
+	// Owed on the card: charges minus payments
+	Balance  Money
+	Cycles   []BillingCycle
+	Payments []CardPayment `json:",omitempty"`
+}
+
+// CardPayment is money paid off the card, from a bank statement or recorded
+// by hand.
+type CardPayment struct {
+	// ID of the statement line the payment was read from, if any
+	ID     string
+	Date   time.Time
+	Amount Money
+}
+
+// BillingCycle is what was charged to a card during one cycle.
+type BillingCycle struct {
+	Period Period
+	// IDs of the expenses charged in the cycle
+	Charges []string
+	Total   Money
+	// Balance of the cycle's statement, once imported; what is due
+	StatementBalance *Money `json:",omitempty"`
+	Paid             Money
+}
+
+// Due is what is left to pay of the cycle: its statement balance, or its
+// charges before the statement arrived, minus payments.
+func (c BillingCycle) Due() Money {
+	due := c.Total
+	if c.StatementBalance != nil {
+		due = *c.StatementBalance
+	}
+	return due.Subtract(c.Paid)
+}
+
+// CardChargeMatch pairs a card statement line with the expense recorded for
+// it.
+type CardChargeMatch struct {
+	Line          StatementLine
+	TransactionID string
+}
+
+// CardStatementMatch compares a card statement with the charges recorded in
+// its billing cycle.
+type CardStatementMatch struct {
+	Cycle   Period
+	Matched []CardChargeMatch
+	// On the statement but never recorded
+	Missing []StatementLine
+	// Recorded in the cycle but not on the statement (yet)
+	Unbilled []string
+}
+
+func (m CardStatementMatch) Balanced() bool {
+	return len(m.Missing) == 0 && len(m.Unbilled) == 0
+}
+
+// cycleOf returns the billing cycle containing date. Issuers close
+// statements by calendar date, taken in UTC.
+func (c *CreditCard) cycleOf(date time.Time) Period {
+	date = date.UTC()
+	period, _ := CreateFiscalMonthPeriod(date.Year(), date.Month(), c.CycleStartDay, time.UTC)
+	if date.Before(period.StartDate) {
+		period = period.Previous()
+	}
+	return period
+}
+
+// cycle returns the billing cycle containing date, starting it if needed.
+func (c *CreditCard) cycle(date time.Time) *BillingCycle {
+	period := c.cycleOf(date)
+	for i := range c.Cycles {
+		if c.Cycles[i].Period.Equal(period) {
+			return &c.Cycles[i]
+		}
+	}
+	c.Cycles = append(c.Cycles, BillingCycle{
+		Period: period,
+		Total:  NewMoneyZero(c.Balance.Currency),
+		Paid:   NewMoneyZero(c.Balance.Currency),
+	})
+	slices.SortFunc(c.Cycles, func(a, b BillingCycle) int {
+		return a.Period.StartDate.Compare(b.Period.StartDate)
+	})
+	for i := range c.Cycles {
+		if c.Cycles[i].Period.Equal(period) {
+			return &c.Cycles[i]
+		}
+	}
+	return nil
+}
+
+func (u *User) creditCard(account BankAccount) *CreditCard {
+	for i := range u.CreditCards {
+		if u.CreditCards[i].Account.Equal(account) {
+			return &u.CreditCards[i]
+		}
+	}
+	return nil
+}
+
+// AddCreditCard starts tracking a card whose billing cycles start on
+// cycleStartDay.
+func (u *User) AddCreditCard(account BankAccount, cycleStartDay int) error {
+	if cycleStartDay < 1 || cycleStartDay > 28 {
+		return fmt.Errorf("billing cycle start day %d must be between 1 and 28", cycleStartDay)
+	}
+	if u.creditCard(account) != nil {
+		return nil
+	}
+	account.Type = CreditCardAccount
+	u.CreditCards = append(u.CreditCards, CreditCard{
+		Account:       account,
+		CycleStartDay: cycleStartDay,
+		Balance:       NewMoneyZero(u.Currency()),
+	})
+	return nil
+}
+
+// ChargeCard records an expense paid with the card. It counts against the
+// budget right away, through DefaultDeductionOrder, and is added to what
+// the card owes.
+func (u *User) ChargeCard(account BankAccount, expense Transaction) error {
+	card := u.creditCard(account)
+	if card == nil {
+		return fmt.Errorf("%w: %s", ErrCardNotFound, account.Masked())
+	}
+	if expense.ID == "" {
+		expense.ID = NewID()
+	}
+	if err := u.ProcessExpense(expense); err != nil {
+		return err
+	}
+
+	charge := expense.Amount.Abs()
+	card.Balance = card.Balance.Add(charge)
+	cycle := card.cycle(expense.Date)
+	cycle.Charges = append(cycle.Charges, expense.ID)
+	cycle.Total = cycle.Total.Add(charge)
+	return nil
+}
+
+// PayCard records paying amount off the card, settling the oldest cycles
+// first. The budget is not charged again: the charges already were.
+func (u *User) PayCard(account BankAccount, amount Money, date time.Time) error {
+	card := u.creditCard(account)
+	if card == nil {
+		return fmt.Errorf("%w: %s", ErrCardNotFound, account.Masked())
+	}
+	return card.pay(CardPayment{ID: NewID(), Date: date, Amount: amount.Abs()})
+}
+
+// payStatementCard records a bank statement debit paying off the card, once
+// per line.
+func (u *User) payStatementCard(card *CreditCard, line StatementLine, tx Transaction) error {
+	if slices.ContainsFunc(card.Payments, func(p CardPayment) bool { return p.ID == tx.ID }) {
+		return nil
+	}
+	return card.pay(CardPayment{ID: tx.ID, Date: line.Date, Amount: line.Amount.Abs()})
+}
+
+func (c *CreditCard) pay(payment CardPayment) error {
+	amount := payment.Amount
+	if amount.Currency != c.Balance.Currency {
+		return &CurrencyMismatchError{Expected: c.Balance.Currency, Got: amount.Currency}
+	}
+
+	c.Balance = c.Balance.Subtract(amount)
+	c.Payments = append(c.Payments, payment)
+	remaining := amount
+	for i := range c.Cycles {
+		due := c.Cycles[i].Due()
+		if !due.Amount.IsPositive() || !remaining.Amount.IsPositive() {
+			continue
+		}
+		paid := due
+		if remaining.Amount.LessThan(due.Amount) {
+			paid = remaining
+		}
+		c.Cycles[i].Paid = c.Cycles[i].Paid.Add(paid)
+		remaining = remaining.Subtract(paid)
+	}
+	return nil
+}
+
+// Words bank statements describe card bill payments with
+var cardPaymentWords = []string{"payment", "pymt", "autopay", "epay", "pembayaran", "bayar"}
+
+// cardPayment returns the card a bank statement debit pays off: the card
+// already paid from the line, or one owing at least the debit that either
+// has a closed cycle whose amount due equals it or that the debit names as
+// a payment, so minimum and partial payments are found too.
+func (u *User) cardPayment(line StatementLine) *CreditCard {
+	for i := range u.CreditCards {
+		if line.ID != "" && slices.ContainsFunc(u.CreditCards[i].Payments, func(p CardPayment) bool { return p.ID == line.ID }) {
+			return &u.CreditCards[i]
+		}
+	}
+	amount := line.Amount.Abs()
+	for i := range u.CreditCards {
+		card := &u.CreditCards[i]
+		if amount.Currency != card.Balance.Currency || amount.Amount.GreaterThan(card.Balance.Amount) {
+			continue
+		}
+		if card.namedBy(line) {
+			return card
+		}
+		for _, cycle := range card.Cycles {
+			if cycle.Period.EndDate.Before(line.Date) && cycle.Due().Amount.Equal(amount.Amount) {
+				return card
+			}
+		}
+	}
+	return nil
+}
+
+// namedBy reports whether the line describes a payment to the card, naming
+// its issuer or the last digits of its number.
+func (c *CreditCard) namedBy(line StatementLine) bool {
+	words := strings.FieldsFunc(strings.ToLower(line.Description), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if !slices.ContainsFunc(cardPaymentWords, func(word string) bool { return slices.Contains(words, word) }) {
+		return false
+	}
+	issuer := strings.Fields(strings.ToLower(c.Account.BankName))
+	if len(issuer) > 0 && !slices.ContainsFunc(issuer, func(word string) bool { return !slices.Contains(words, word) }) {
+		return true
+	}
+	number := c.Account.AccountNumber
+	return len(number) >= 4 && slices.Contains(words, number[len(number)-4:])
+}
+
+// MatchCardStatement matches the debits on a card statement against the
+// charges recorded in the billing cycle the statement closes. Lines match
+// charges of the same amount recorded up to three days apart, to allow for
+// posting delays.
+func (u *User) MatchCardStatement(statement AccountStatement) (CardStatementMatch, error) {
+	card := u.creditCard(statement.BankAccount)
+	if card == nil {
+		return CardStatementMatch{}, fmt.Errorf("%w: %s", ErrCardNotFound, statement.BankAccount.Masked())
+	}
+	closing := statement.Period.EndDate
+	if closing.IsZero() {
+		for _, line := range statement.Lines {
+			if line.Date.After(closing) {
+				closing = line.Date
+			}
+		}
+	}
+	period := card.cycleOf(closing)
+	match := CardStatementMatch{Cycle: period}
+
+	var charges []Transaction
+	for _, cycle := range card.Cycles {
+		if !cycle.Period.Equal(period) {
+			continue
+		}
+		for _, id := range cycle.Charges {
+			if expense, err := u.Expense(id); err == nil {
+				charges = append(charges, *expense)
+			}
+		}
+	}
+
+	matched := make(map[string]bool)
+	for _, line := range statement.Lines {
+		if !line.IsDebit() {
+			continue
+		}
+		i := slices.IndexFunc(charges, func(charge Transaction) bool {
+			lag := charge.Date.Sub(line.Date).Abs()
+			return !matched[charge.ID] && lag <= cardPostingLag && charge.Amount.Abs().Amount.Equal(line.Amount.Abs().Amount)
+		})
+		if i < 0 {
+			match.Missing = append(match.Missing, line)
+			continue
+		}
+		matched[charges[i].ID] = true
+		match.Matched = append(match.Matched, CardChargeMatch{Line: line, TransactionID: charges[i].ID})
+	}
+	for _, charge := range charges {
+		if !matched[charge.ID] {
+			match.Unbilled = append(match.Unbilled, charge.ID)
+		}
+	}
+	return match, nil
+}
+
+// processCardStatement records the charges on a card statement that were
+// not recorded yet and sets the cycle's statement balance.
+func (u *User) processCardStatement(statement AccountStatement) error {
+	match, err := u.MatchCardStatement(statement)
+	if err != nil {
+		return err
+	}
+	for _, line := range match.Missing {
+		if err := u.ChargeCard(statement.BankAccount, statement.transaction(line)); err != nil {
+			return err
+		}
+	}
+
+	card := u.creditCard(statement.BankAccount)
+	cycle := card.cycle(match.Cycle.StartDate)
+	balance := NewMoneyZero(card.Balance.Currency)
+	if statement.HasBalances() {
+		balance = statement.ClosingBalance.Abs()
+	} else {
+		// Charges are debits, so what is owed is the negated sum
+		for _, line := range statement.Lines {
+			balance.Amount = balance.Amount.Sub(line.Amount.Amount)
+		}
+	}
+	cycle.StatementBalance = &balance
+	return nil
+}
+
+// chargeCardLines records the charges on lines of a card's statement that
+// were not recorded yet, matching the lines of each billing cycle against
+// the charges recorded in it. Unlike processCardStatement it leaves the
+// cycles' statement balances alone, as the lines need not cover whole
+// cycles. Credits are skipped.
+func (u *User) chargeCardLines(statement AccountStatement) (BatchReport, error) {
+	card := u.creditCard(statement.BankAccount)
+	if card == nil {
+		return BatchReport{}, fmt.Errorf("%w: %s", ErrCardNotFound, statement.BankAccount.Masked())
+	}
+	var report BatchReport
+	var cycles []Period
+	var lines [][]StatementLine
+	for _, line := range statement.Lines {
+		if !line.IsDebit() {
+			report.Skipped++
+			continue
+		}
+		period := card.cycleOf(line.Date)
+		i := slices.IndexFunc(cycles, period.Equal)
+		if i < 0 {
+			cycles, lines = append(cycles, period), append(lines, nil)
+			i = len(cycles) - 1
+		}
+		lines[i] = append(lines[i], line)
+	}
+	for i := range cycles {
+		match, err := u.MatchCardStatement(AccountStatement{BankAccount: statement.BankAccount, Lines: lines[i]})
+		if err != nil {
+			return BatchReport{}, err
+		}
+		for _, line := range match.Missing {
+			if err := u.ChargeCard(statement.BankAccount, statement.transaction(line)); err != nil {
+				return BatchReport{}, err
+			}
+			report.Applied++
+		}
+		report.Skipped += len(match.Matched)
+	}
+	return report, nil
+}
+
+func (s *FinanceService) AddCreditCard(ctx context.Context, userID string, account BankAccount, cycleStartDay int) error {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.creditCard(account) != nil {
+		return nil
+	}
+	if err := s.quotaFor(userID).Check(QuotaLinkedAccounts, user.LinkedAccountCount(), 1); err != nil {
+		return err
+	}
+	if err := user.AddCreditCard(account, cycleStartDay); err != nil {
+		return err
+	}
+
+	if err := s.save(ctx, user, "add_credit_card"); err != nil {
+		return err
+	}
+	s.Telemetry.Track(ctx, "cards", "add", userID, nil)
+	return nil
+}
+
+// ChargeCard records an expense paid with the card. A zero date means now.
+func (s *FinanceService) ChargeCard(ctx context.Context, userID string, account BankAccount, amount Money, date time.Time, description string) (err error) {
+	ctx, span := s.startSpan(ctx, "ChargeCard", userID)
+	defer endSpan(span, &err)
+
+	claim, err := s.claimIdempotencyKey(ctx, userID, "charge_card",
+		account.AccountNumber, amount.Amount.String(), amount.Currency, date.String(), description)
+	if err != nil || claim.isReplay() {
+		return err
+	}
+	defer claim.settle(ctx, &err)
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.quotaFor(userID).Check(QuotaTransactions, user.TransactionCount(), 1); err != nil {
+		return err
+	}
+
+	if date.IsZero() {
+		date = s.now()
+	}
+	if err := user.ChargeCard(account, NewExpense(amount.Abs(), date, description)); err != nil {
+		return err
+	}
+
+	if err := s.save(ctx, user, "charge_card"); err != nil {
+		return err
+	}
+	recorded := user.Expenses[len(user.Expenses)-1]
+	s.log().InfoContext(ctx, "charged card",
+		LogKeyUserID, userID, LogKeyTransactionID, recorded.ID, "account", account, "amount", recorded.Amount.String())
+	s.publishLedger(user, recorded)
+	s.Telemetry.Track(ctx, "cards", "charge", userID, nil)
+	return nil
+}
+
+// PayCard records a card bill payment made outside a bank statement import.
+func (s *FinanceService) PayCard(ctx context.Context, userID string, account BankAccount, amount Money) error {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := user.PayCard(account, amount, s.now()); err != nil {
+		return err
+	}
+
+	if err := s.save(ctx, user, "pay_card"); err != nil {
+		return err
+	}
+	s.log().InfoContext(ctx, "paid card", LogKeyUserID, userID, "account", account, "amount", amount.String())
+	s.Telemetry.Track(ctx, "cards", "pay", userID, nil)
+	return nil
+}
+
+func (s *FinanceService) MatchCardStatement(ctx context.Context, userID string, statement AccountStatement) (CardStatementMatch, error) {
+	defer s.readLockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return CardStatementMatch{}, err
+	}
+	if err := s.loadStatement(ctx, user, statement.BankAccount, statement.Lines); err != nil {
+		return CardStatementMatch{}, err
+	}
+	return user.MatchCardStatement(statement)
+}
@@ -0,0 +1,128 @@
+package arus
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/shopspring/decimal"
+)
+
+// Currency describes how amounts in a currency are rounded.
+type Currency struct {
+	Code string
+	// Decimal places of the currency's minor unit (ISO 4217 exponent)
+	MinorUnits int32
+	Symbol     string
+}
+
+// RoundingMode controls how amounts are rounded to a currency's minor unit.
+type RoundingMode int
+
+const (
+	RoundHalfEven RoundingMode = iota
+	RoundHalfUp
+	RoundDown
+	RoundUp
+)
+
+func (r RoundingMode) String() string {
+	return [...]string{"HalfEven", "HalfUp", "Down", "Up"}[r]
+}
+
+func (r RoundingMode) Round(amount decimal.Decimal, places int32) decimal.Decimal {
+	switch r {
+	case RoundHalfUp:
+		return amount.Round(places)
+	case RoundDown:
+		return amount.RoundDown(places)
+	case RoundUp:
+		return amount.RoundUp(places)
+	default:
+		return amount.RoundBank(places)
+	}
+}
+
+// Minor units used for currencies missing from the registry
+const defaultMinorUnits = 2
+
+var (
+	currencyMu sync.RWMutex
+	currencies = map[string]Currency{
+		"USD": {Code: "USD", MinorUnits: 2, Symbol: "$"},
+		"EUR": {Code: "EUR", MinorUnits: 2, Symbol: "€"},
+		"GBP": {Code: "GBP", MinorUnits: 2, Symbol: "£"},
+		"AUD": {Code: "AUD", MinorUnits: 2, Symbol: "A$"},
+		"SGD": {Code: "SGD", MinorUnits: 2, Symbol: "S$"},
+		"MYR": {Code: "MYR", MinorUnits: 2, Symbol: "RM"},
+		"CNY": {Code: "CNY", MinorUnits: 2, Symbol: "CN¥"},
+		"JPY": {Code: "JPY", MinorUnits: 0, Symbol: "¥"},
+		"KRW": {Code: "KRW", MinorUnits: 0, Symbol: "₩"},
+		"VND": {Code: "VND", MinorUnits: 0, Symbol: "₫"},
+		// ISO 4217 lists two minor units for IDR, but sen are not used in
+		// practice and banks report whole rupiah.
+		"IDR": {Code: "IDR", MinorUnits: 0, Symbol: "Rp"},
+		"BHD": {Code: "BHD", MinorUnits: 3, Symbol: "BD"},
+		"KWD": {Code: "KWD", MinorUnits: 3, Symbol: "KD"},
+	}
+	roundingMode = RoundHalfEven
+)
+
+// RegisterCurrency adds or replaces a currency in the registry.
+func RegisterCurrency(currency Currency) {
+	currencyMu.Lock()
+	defer currencyMu.Unlock()
+
+	currency.Code = strings.ToUpper(currency.Code)
+	currencies[currency.Code] = currency
+}
+
+func LookupCurrency(code string) (Currency, bool) {
+	currencyMu.RLock()
+	defer currencyMu.RUnlock()
+
+	currency, ok := currencies[strings.ToUpper(code)]
+	return currency, ok
+}
+
+// MinorUnits returns the number of decimal places for code, falling back to
+// two for unregistered currencies.
+func MinorUnits(code string) int32 {
+	if currency, ok := LookupCurrency(code); ok {
+		return currency.MinorUnits
+	}
+	return defaultMinorUnits
+}
+
+// SetRoundingMode changes the rounding mode used by Money.Round.
+func SetRoundingMode(mode RoundingMode) {
+	currencyMu.Lock()
+	defer currencyMu.Unlock()
+
+	roundingMode = mode
+}
+
+func CurrentRoundingMode() RoundingMode {
+	currencyMu.RLock()
+	defer currencyMu.RUnlock()
+
+	return roundingMode
+}
+
+// Round rounds m to its currency's minor unit using the configured mode.
+func (m Money) Round() Money {
+	return m.RoundWith(CurrentRoundingMode())
+}
+
+func (m Money) RoundWith(mode RoundingMode) Money {
+	return Money{Amount: mode.Round(m.Amount, MinorUnits(m.Currency)), Currency: m.Currency}
+}
+
+// StringFixed renders the amount with exactly the currency's minor units.
+func (m Money) StringFixed() string {
+	return m.Round().Amount.StringFixed(MinorUnits(m.Currency))
+}
+
+func (m Money) String() string {
+	return fmt.Sprintf("%s %s", m.StringFixed(), m.Currency)
+}
@@ -0,0 +1,157 @@
+package arus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestMoneyRoundWith(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount string
+		code   string
+		mode   RoundingMode
+		want   string
+	}{
+		{"half even rounds ties to even", "1.005", "USD", RoundHalfEven, "1.00"},
+		{"half even rounds up past half", "1.0051", "USD", RoundHalfEven, "1.01"},
+		{"half up rounds ties up", "1.005", "USD", RoundHalfUp, "1.01"},
+		{"half up rounds negative ties away from zero", "-1.005", "USD", RoundHalfUp, "-1.01"},
+		{"down truncates", "1.009", "USD", RoundDown, "1.00"},
+		{"up rounds any remainder up", "1.001", "USD", RoundUp, "1.01"},
+		{"zero minor units", "100.5", "JPY", RoundHalfEven, "100"},
+		{"zero minor units half up", "100.5", "JPY", RoundHalfUp, "101"},
+		{"IDR is kept in whole rupiah", "15000.4", "IDR", RoundHalfUp, "15000"},
+		{"three minor units", "1.2345", "BHD", RoundHalfEven, "1.234"},
+		{"three minor units half up", "1.2345", "KWD", RoundHalfUp, "1.235"},
+		{"unregistered currency uses two places", "2.345", "XYZ", RoundHalfUp, "2.35"},
+		{"currency code is case insensitive", "100.5", "jpy", RoundHalfUp, "101"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := money(t, tt.amount, tt.code).RoundWith(tt.mode)
+			if want := money(t, tt.want, tt.code); !got.Amount.Equal(want.Amount) || got.Currency != tt.code {
+				t.Errorf("%s %s rounded %s = %s, want %s", tt.amount, tt.code, tt.mode, got, want)
+			}
+		})
+	}
+}
+
+func TestMoneyStringFixed(t *testing.T) {
+	tests := []struct {
+		amount string
+		code   string
+		want   string
+	}{
+		{"12.5", "USD", "12.50"},
+		{"12.345", "USD", "12.34"},
+		{"1234.5", "JPY", "1234"},
+		{"0.1", "BHD", "0.100"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.amount+" "+tt.code, func(t *testing.T) {
+			if got := money(t, tt.amount, tt.code).StringFixed(); got != tt.want {
+				t.Errorf("StringFixed() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  string
+		code    string
+		ratios  []int64
+		want    []string
+		wantErr bool
+	}{
+		{name: "even split", amount: "90", code: "USD", ratios: []int64{1, 1, 1}, want: []string{"30", "30", "30"}},
+		{name: "leftover cent goes first", amount: "100", code: "USD", ratios: []int64{1, 1, 1}, want: []string{"33.34", "33.33", "33.33"}},
+		{name: "leftover goes to largest loss", amount: "1000", code: "JPY", ratios: []int64{1, 2}, want: []string{"333", "667"}},
+		{name: "amount is rounded first", amount: "0.055", code: "USD", ratios: []int64{1, 1}, want: []string{"0.03", "0.03"}},
+		{name: "zero ratio gets nothing", amount: "10", code: "USD", ratios: []int64{0, 1}, want: []string{"0", "10"}},
+		{name: "negative amounts keep their sign", amount: "-10", code: "USD", ratios: []int64{1, 2}, want: []string{"-3.33", "-6.67"}},
+		{name: "no ratios", amount: "10", code: "USD", wantErr: true},
+		{name: "negative ratio", amount: "10", code: "USD", ratios: []int64{1, -1}, wantErr: true},
+		{name: "all ratios zero", amount: "10", code: "USD", ratios: []int64{0, 0}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ratios := make([]decimal.Decimal, len(tt.ratios))
+			for i, ratio := range tt.ratios {
+				ratios[i] = decimal.NewFromInt(ratio)
+			}
+			amount := money(t, tt.amount, tt.code)
+			shares, err := amount.Allocate(ratios...)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Allocate(%v) = %v, want an error", tt.ratios, shares)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Allocate(%v): %v", tt.ratios, err)
+			}
+			if len(shares) != len(tt.want) {
+				t.Fatalf("Allocate(%v) returned %d shares, want %d", tt.ratios, len(shares), len(tt.want))
+			}
+			total := NewMoneyZero(tt.code)
+			for i, share := range shares {
+				if want := money(t, tt.want[i], tt.code); !share.Amount.Equal(want.Amount) {
+					t.Errorf("share %d = %s, want %s", i, share, want)
+				}
+				total = total.Add(share)
+			}
+			if rounded := amount.Round(); !total.Amount.Equal(rounded.Amount) {
+				t.Errorf("shares sum to %s, want %s", total, rounded)
+			}
+		})
+	}
+}
+
+func TestRoundingLedgerRecord(t *testing.T) {
+	date := time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		exact       string
+		code        string
+		want        string
+		wantResidue string
+	}{
+		{name: "already rounded", exact: "10.00", code: "USD", want: "10.00"},
+		{name: "rounded down", exact: "10.004", code: "USD", want: "10.00", wantResidue: "0.004"},
+		{name: "rounded up", exact: "10.006", code: "USD", want: "10.01", wantResidue: "-0.004"},
+		{name: "zero minor units", exact: "99.6", code: "JPY", want: "100", wantResidue: "-0.4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ledger RoundingLedger
+			got := ledger.Record(money(t, tt.exact, tt.code), date, RoundingFX, "conversion")
+			if want := money(t, tt.want, tt.code); !got.Amount.Equal(want.Amount) {
+				t.Errorf("Record(%s) = %s, want %s", tt.exact, got, want)
+			}
+			if tt.wantResidue == "" {
+				if len(ledger.Entries) != 0 {
+					t.Errorf("booked %v, want no entries", ledger.Entries)
+				}
+				return
+			}
+			if len(ledger.Entries) != 1 {
+				t.Fatalf("booked %d entries, want 1", len(ledger.Entries))
+			}
+			residue := money(t, tt.wantResidue, tt.code)
+			if entry := ledger.Entries[0]; !entry.Residue.Amount.Equal(residue.Amount) || entry.Source != RoundingFX {
+				t.Errorf("booked %+v, want a %s residue of %s", entry, RoundingFX, residue.Amount)
+			}
+			if total := ledger.Total(CreateMonthlyPeriod(2024, time.March), tt.code); !total.Amount.Equal(residue.Amount) {
+				t.Errorf("Total = %s, want %s", total, residue)
+			}
+			if total := ledger.Total(CreateMonthlyPeriod(2024, time.April), tt.code); !total.IsZero() {
+				t.Errorf("Total of the next month = %s, want zero", total)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package arus
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/shopspring/decimal"
+)
+
+// DebitPolicy decides how a debit is split across the bank accounts backing a
+// category. Split returns one portion per account, in the same order as
+// accounts, summing to amount.
+type DebitPolicy interface {
+	Split(accounts []*CategoryAccount, amount Money) ([]Money, error)
+}
+
+// LargestFirst drains the account with the largest balance first, then the
+// next largest, until the amount is covered.
+type LargestFirst struct{}
+
+func (LargestFirst) Split(accounts []*CategoryAccount, amount Money) ([]Money, error) {
+	order := make([]int, len(accounts))
+	for i := range accounts {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return accounts[order[a]].Balance.Amount.GreaterThan(accounts[order[b]].Balance.Amount)
+	})
+
+	portions := zeroPortions(accounts, amount.Currency)
+	remaining := amount.Amount
+	for _, i := range order {
+		if !remaining.IsPositive() {
+			break
+		}
+		available := accounts[i].Balance.Amount
+		if !available.IsPositive() {
+			continue
+		}
+		take := decimal.Min(available, remaining)
+		portions[i] = Money{Amount: take, Currency: amount.Currency}
+		remaining = remaining.Sub(take)
+	}
+
+	if remaining.IsPositive() {
+		return nil, &InsufficientFundsError{
+			Needed:    amount,
+			Available: Money{Amount: amount.Amount.Sub(remaining), Currency: amount.Currency},
+		}
+	}
+	return portions, nil
+}
+
+// SpecificAccount debits a single account only.
+type SpecificAccount struct {
+	BankAccount BankAccount
+}
+
+func (p SpecificAccount) Split(accounts []*CategoryAccount, amount Money) ([]Money, error) {
+	portions := zeroPortions(accounts, amount.Currency)
+	for i, account := range accounts {
+		if !account.BankAccount.Equal(p.BankAccount) {
+			continue
+		}
+		if account.Balance.Amount.LessThan(amount.Amount) {
+			return nil, &InsufficientFundsError{Account: &account.BankAccount, Needed: amount, Available: account.Balance}
+		}
+		portions[i] = amount
+		return portions, nil
+	}
+	return nil, &AccountNotLinkedError{BankAccount: p.BankAccount}
+}
+
+// Proportional debits every account in proportion to its share of the total
+// balance. Any rounding residue is taken from the largest account.
+type Proportional struct{}
+
+func (Proportional) Split(accounts []*CategoryAccount, amount Money) ([]Money, error) {
+	total := decimal.Zero
+	largest := -1
+	for i, account := range accounts {
+		if !account.Balance.Amount.IsPositive() {
+			continue
+		}
+		total = total.Add(account.Balance.Amount)
+		if largest < 0 || account.Balance.Amount.GreaterThan(accounts[largest].Balance.Amount) {
+			largest = i
+		}
+	}
+	if total.LessThan(amount.Amount) {
+		return nil, &InsufficientFundsError{Needed: amount, Available: Money{Amount: total, Currency: amount.Currency}}
+	}
+
+	portions := zeroPortions(accounts, amount.Currency)
+	allocated := decimal.Zero
+	for i, account := range accounts {
+		if !account.Balance.Amount.IsPositive() {
+			continue
+		}
+		share := amount.Amount.Mul(account.Balance.Amount).Div(total).RoundDown(MinorUnits(amount.Currency))
+		portions[i] = Money{Amount: share, Currency: amount.Currency}
+		allocated = allocated.Add(share)
+	}
+	if largest >= 0 {
+		residue := amount.Amount.Sub(allocated)
+		portions[largest] = Money{Amount: portions[largest].Amount.Add(residue), Currency: amount.Currency}
+	}
+	return portions, nil
+}
+
+func zeroPortions(accounts []*CategoryAccount, currency string) []Money {
+	portions := make([]Money, len(accounts))
+	for i := range portions {
+		portions[i] = NewMoneyZero(currency)
+	}
+	return portions
+}
+
+type debitPolicyJSON struct {
+	Kind        string
+	BankAccount *BankAccount `json:",omitempty"`
+}
+
+func encodeDebitPolicy(policy DebitPolicy) (debitPolicyJSON, error) {
+	switch p := policy.(type) {
+	case nil, LargestFirst:
+		return debitPolicyJSON{Kind: "largest-first"}, nil
+	case Proportional:
+		return debitPolicyJSON{Kind: "proportional"}, nil
+	case SpecificAccount:
+		return debitPolicyJSON{Kind: "specific-account", BankAccount: &p.BankAccount}, nil
+	default:
+		return debitPolicyJSON{}, fmt.Errorf("debit policy %T cannot be serialized", policy)
+	}
+}
+
+func decodeDebitPolicy(encoded debitPolicyJSON) (DebitPolicy, error) {
+	switch encoded.Kind {
+	case "", "largest-first":
+		return LargestFirst{}, nil
+	case "proportional":
+		return Proportional{}, nil
+	case "specific-account":
+		if encoded.BankAccount == nil {
+			return nil, errors.New("specific-account debit policy requires a bank account")
+		}
+		return SpecificAccount{BankAccount: *encoded.BankAccount}, nil
+	default:
+		return nil, fmt.Errorf("unknown debit policy %q", encoded.Kind)
+	}
+}
+
+type categoryAlias Category
+
+type categoryJSON struct {
+	*categoryAlias
+	DebitPolicy debitPolicyJSON
+}
+
+func (c Category) MarshalJSON() ([]byte, error) {
+	policy, err := encodeDebitPolicy(c.DebitPolicy)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(categoryJSON{categoryAlias: (*categoryAlias)(&c), DebitPolicy: policy})
+}
+
+func (c *Category) UnmarshalJSON(data []byte) error {
+	decoded := categoryJSON{categoryAlias: (*categoryAlias)(c)}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	policy, err := decodeDebitPolicy(decoded.DebitPolicy)
+	if err != nil {
+		return err
+	}
+	c.DebitPolicy = policy
+	return nil
+}
@@ -0,0 +1,107 @@
+package arus
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestDebitPolicySplit(t *testing.T) {
+	first := BankAccount{AccountNumber: "A1", BankName: "Bank"}
+	second := BankAccount{AccountNumber: "B2", BankName: "Bank"}
+	third := BankAccount{AccountNumber: "C3", BankName: "Bank"}
+	tests := []struct {
+		name     string
+		policy   DebitPolicy
+		balances []string
+		amount   string
+		want     []string
+		// Error Split must return, checked with errors.As
+		wantErr any
+	}{
+		{name: "largest first drains the largest", policy: LargestFirst{}, balances: []string{"50", "200", "100"}, amount: "150", want: []string{"0", "150", "0"}},
+		{name: "largest first moves on to the next", policy: LargestFirst{}, balances: []string{"50", "200", "100"}, amount: "260", want: []string{"0", "200", "60"}},
+		{name: "largest first skips empty accounts", policy: LargestFirst{}, balances: []string{"0", "-5", "30"}, amount: "30", want: []string{"0", "0", "30"}},
+		{name: "largest first short of funds", policy: LargestFirst{}, balances: []string{"50", "20", "10"}, amount: "90", wantErr: new(*InsufficientFundsError)},
+		{name: "specific account", policy: SpecificAccount{BankAccount: second}, balances: []string{"50", "200", "100"}, amount: "120", want: []string{"0", "120", "0"}},
+		{name: "specific account short of funds", policy: SpecificAccount{BankAccount: first}, balances: []string{"50", "200", "100"}, amount: "60", wantErr: new(*InsufficientFundsError)},
+		{name: "specific account not linked", policy: SpecificAccount{BankAccount: BankAccount{AccountNumber: "Z9"}}, balances: []string{"50", "200", "100"}, amount: "10", wantErr: new(*AccountNotLinkedError)},
+		{name: "proportional", policy: Proportional{}, balances: []string{"100", "300", "0"}, amount: "40", want: []string{"10", "30", "0"}},
+		{name: "proportional residue to the largest", policy: Proportional{}, balances: []string{"100", "100", "110"}, amount: "100", want: []string{"32.25", "32.25", "35.50"}},
+		{name: "proportional short of funds", policy: Proportional{}, balances: []string{"10", "10", "10"}, amount: "31", wantErr: new(*InsufficientFundsError)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accounts := make([]*CategoryAccount, len(tt.balances))
+			for i, bank := range []BankAccount{first, second, third} {
+				accounts[i] = &CategoryAccount{BankAccount: bank, Balance: money(t, tt.balances[i], "USD")}
+			}
+			amount := money(t, tt.amount, "USD")
+
+			portions, err := tt.policy.Split(accounts, amount)
+			if tt.wantErr != nil {
+				if !errors.As(err, tt.wantErr) {
+					t.Fatalf("Split = %v, %v; want a %T", portions, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Split: %v", err)
+			}
+			total := NewMoneyZero("USD")
+			for i, portion := range portions {
+				if want := money(t, tt.want[i], "USD"); !portion.Amount.Equal(want.Amount) || portion.Currency != "USD" {
+					t.Errorf("portion %d = %s, want %s", i, portion, want)
+				}
+				total = total.Add(portion)
+			}
+			if !total.Amount.Equal(amount.Amount) {
+				t.Errorf("portions sum to %s, want %s", total, amount)
+			}
+		})
+	}
+}
+
+func TestDebitPolicyJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy DebitPolicy
+		want   DebitPolicy
+	}{
+		{"nil is largest first", nil, LargestFirst{}},
+		{"largest first", LargestFirst{}, LargestFirst{}},
+		{"proportional", Proportional{}, Proportional{}},
+		{"specific account", SpecificAccount{BankAccount: BankAccount{AccountNumber: "A1", BankName: "Bank"}},
+			SpecificAccount{BankAccount: BankAccount{AccountNumber: "A1", BankName: "Bank"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			category := NewCategory(Expense, "USD")
+			category.DebitPolicy = tt.policy
+			data, err := json.Marshal(category)
+			if err != nil {
+				t.Fatalf("encoding: %v", err)
+			}
+			var decoded Category
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("decoding %s: %v", data, err)
+			}
+			if decoded.DebitPolicy != tt.want {
+				t.Errorf("decoded policy %#v, want %#v", decoded.DebitPolicy, tt.want)
+			}
+		})
+	}
+
+	t.Run("unknown policy", func(t *testing.T) {
+		var decoded Category
+		if err := json.Unmarshal([]byte(`{"Type":0,"DebitPolicy":{"Kind":"random"}}`), &decoded); err == nil {
+			t.Errorf("decoding an unknown policy succeeded with %#v", decoded.DebitPolicy)
+		}
+	})
+	t.Run("specific account without an account", func(t *testing.T) {
+		var decoded Category
+		if err := json.Unmarshal([]byte(`{"Type":0,"DebitPolicy":{"Kind":"specific-account"}}`), &decoded); err == nil {
+			t.Errorf("decoding succeeded with %#v", decoded.DebitPolicy)
+		}
+	})
+}
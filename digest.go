@@ -0,0 +1,110 @@
+package arus
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Relative change from the previous month worth pointing out in a digest
+var notableChange = decimal.NewFromFloat(0.25)
+
+// SavingsRate is the share of the period's income that was not spent. It
+// returns false for periods without income.
+func (s PeriodSummary) SavingsRate() (decimal.Decimal, bool) {
+	if !s.TotalIncome.Amount.IsPositive() {
+		return decimal.Zero, false
+	}
+	return s.Net.Amount.Div(s.TotalIncome.Amount), true
+}
+
+// DigestChange is a figure that moved notably since the previous month.
+type DigestChange struct {
+	Label    string
+	Previous Money
+	Current  Money
+}
+
+// Change is the relative change, e.g. 0.3 for 30% more.
+func (c DigestChange) Change() decimal.Decimal {
+	return c.Current.Amount.Sub(c.Previous.Amount).Div(c.Previous.Amount)
+}
+
+// PeriodDigest recaps a closed period.
+type PeriodDigest struct {
+	Summary  PeriodSummary
+	Previous PeriodSummary
+	// Spending covered by each category, as positive amounts
+	Spending map[CategoryType]Money
+	Changes  []DigestChange
+}
+
+// PeriodDigest compares the period with the one before it. Income,
+// spending and each category's spending are notable changes when they
+// moved by a quarter or more.
+func (u *User) PeriodDigest(period Period) PeriodDigest {
+	digest := PeriodDigest{
+		Summary:  u.GetPeriodSummary(period),
+		Previous: u.GetPeriodSummary(period.Previous()),
+	}
+	digest.Spending = digest.Summary.Deductions
+
+	compare := func(label string, previous, current Money) {
+		if !previous.Amount.IsPositive() || previous.Currency != current.Currency {
+			return
+		}
+		change := DigestChange{Label: label, Previous: previous, Current: current}
+		if change.Change().Abs().GreaterThanOrEqual(notableChange) {
+			digest.Changes = append(digest.Changes, change)
+		}
+	}
+	compare("Income", digest.Previous.TotalIncome, digest.Summary.TotalIncome)
+	compare("Spending", digest.Previous.TotalExpense.Abs(), digest.Summary.TotalExpense.Abs())
+	categories := slices.Sorted(maps.Keys(digest.Previous.Deductions))
+	for _, categoryType := range categories {
+		current, ok := digest.Spending[categoryType]
+		if !ok {
+			current = NewMoneyZero(digest.Previous.Deductions[categoryType].Currency)
+		}
+		compare(categoryType.String()+" spending", digest.Previous.Deductions[categoryType], current)
+	}
+	return digest
+}
+
+func monthlyDigestReport(user *User, period Period) Notification {
+	digest := user.PeriodDigest(period)
+	summary := digest.Summary
+	locale := user.Locale()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "How %s went:\n", period.StartDate.Format("January 2006"))
+	fmt.Fprintf(&b, "Income: %s\n", summary.TotalIncome.Format(locale))
+	fmt.Fprintf(&b, "Spent: %s\n", summary.TotalExpense.Abs().Format(locale))
+	for _, currency := range slices.Sorted(maps.Keys(summary.Foreign)) {
+		totals := summary.Foreign[currency]
+		fmt.Fprintf(&b, "In %s: %s income, %s spent\n", currency, totals.TotalIncome.Format(locale), totals.TotalExpense.Abs().Format(locale))
+	}
+	for _, categoryType := range slices.Sorted(maps.Keys(digest.Spending)) {
+		fmt.Fprintf(&b, " - from %s: %s\n", categoryType.String(), digest.Spending[categoryType].Format(locale))
+	}
+	if rate, ok := summary.SavingsRate(); ok {
+		fmt.Fprintf(&b, "Savings rate: %s%%\n", rate.Mul(decimal.NewFromInt(100)).StringFixed(1))
+	}
+
+	if len(digest.Changes) > 0 {
+		b.WriteString("Compared with the month before:\n")
+	}
+	for _, change := range digest.Changes {
+		direction := "up"
+		if change.Change().IsNegative() {
+			direction = "down"
+		}
+		fmt.Fprintf(&b, " - %s %s %s%%, from %s to %s\n", change.Label, direction,
+			change.Change().Abs().Mul(decimal.NewFromInt(100)).StringFixed(0),
+			change.Previous.Format(locale), change.Current.Format(locale))
+	}
+	return Notification{Subject: "Your monthly digest", Body: b.String()}
+}
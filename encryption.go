@@ -0,0 +1,225 @@
+package arus
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Prefix of encrypted account numbers, followed by the wrapped data key and
+// the sealed number, both base64
+const encryptedPrefix = "enc:v1:"
+
+// Masked returns the account number with all but the last four digits
+// hidden, e.g. "****3123", for display and logs.
+func (b BankAccount) Masked() string {
+	const visible = 4
+	if len(b.AccountNumber) <= visible {
+		return "****"
+	}
+	return "****" + b.AccountNumber[len(b.AccountNumber)-visible:]
+}
+
+// LogValue keeps full account numbers out of structured logs.
+func (b BankAccount) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("number", b.Masked()), slog.String("bank", b.BankName))
+}
+
+// KeyManager issues data keys for envelope encryption, typically backed by
+// a cloud KMS that keeps the master key. Data keys are stored wrapped, next
+// to what they encrypt.
+type KeyManager interface {
+	// GenerateDataKey returns a new data key in plain and wrapped form.
+	GenerateDataKey(ctx context.Context) (plaintext, wrapped []byte, err error)
+	DecryptDataKey(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// LocalKeyManager wraps data keys with a master key held in memory, for
+// development and self-hosted instances without a KMS.
+type LocalKeyManager struct {
+	master cipher.AEAD
+}
+
+// NewLocalKeyManager takes a 32-byte AES-256 master key.
+func NewLocalKeyManager(masterKey []byte) (*LocalKeyManager, error) {
+	if len(masterKey) != 32 {
+		return nil, errors.New("master key must be 32 bytes")
+	}
+	aead, err := newAEAD(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalKeyManager{master: aead}, nil
+}
+
+func (m *LocalKeyManager) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, err
+	}
+	wrapped, err := seal(m.master, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, wrapped, nil
+}
+
+func (m *LocalKeyManager) DecryptDataKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	return open(m.master, wrapped)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext, prefixing the random nonce.
+func seal(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(aead cipher.AEAD, sealed []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// mapAccountNumbers replaces every stored bank account number of the user
+// with fn's result.
+func (u *User) mapAccountNumbers(fn func(number string) (string, error)) error {
+	mapAccount := func(account *BankAccount) error {
+		number, err := fn(account.AccountNumber)
+		if err != nil {
+			return err
+		}
+		account.AccountNumber = number
+		return nil
+	}
+
+	for _, category := range u.Categories {
+		for _, account := range category.Accounts {
+			if err := mapAccount(&account.BankAccount); err != nil {
+				return err
+			}
+		}
+		if policy, ok := category.DebitPolicy.(SpecificAccount); ok {
+			if err := mapAccount(&policy.BankAccount); err != nil {
+				return err
+			}
+			category.DebitPolicy = policy
+		}
+	}
+	for i := range u.OpenReconciliations {
+		if err := mapAccount(&u.OpenReconciliations[i].BankAccount); err != nil {
+			return err
+		}
+	}
+	for i := range u.CreditCards {
+		if err := mapAccount(&u.CreditCards[i].Account); err != nil {
+			return err
+		}
+	}
+	for i := range u.StatementHistory {
+		if err := mapAccount(&u.StatementHistory[i].BankAccount); err != nil {
+			return err
+		}
+	}
+	for i := range u.QueuedStatements {
+		if err := mapAccount(&u.QueuedStatements[i].BankAccount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encryptAccountNumbers returns a copy of the user with its account numbers
+// encrypted under one new data key.
+func encryptAccountNumbers(ctx context.Context, keys KeyManager, user *User) (*User, error) {
+	encrypted, err := user.clone()
+	if err != nil {
+		return nil, err
+	}
+	key, wrapped, err := keys.GenerateDataKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("generating data key: %w", err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	header := encryptedPrefix + base64.RawStdEncoding.EncodeToString(wrapped) + ":"
+
+	err = encrypted.mapAccountNumbers(func(number string) (string, error) {
+		sealed, err := seal(aead, []byte(number))
+		if err != nil {
+			return "", err
+		}
+		return header + base64.RawStdEncoding.EncodeToString(sealed), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encrypting account numbers of user %s: %w", user.ID, err)
+	}
+	return encrypted, nil
+}
+
+// decryptAccountNumbers decrypts the user's account numbers in place.
+// Numbers stored before encryption was enabled are left as they are.
+func decryptAccountNumbers(ctx context.Context, keys KeyManager, user *User) error {
+	ciphers := make(map[string]cipher.AEAD)
+
+	err := user.mapAccountNumbers(func(number string) (string, error) {
+		encoded, ok := strings.CutPrefix(number, encryptedPrefix)
+		if !ok {
+			return number, nil
+		}
+		wrappedKey, sealedNumber, ok := strings.Cut(encoded, ":")
+		if !ok {
+			return "", errors.New("malformed encrypted account number")
+		}
+
+		aead, cached := ciphers[wrappedKey]
+		if !cached {
+			wrapped, err := base64.RawStdEncoding.DecodeString(wrappedKey)
+			if err != nil {
+				return "", err
+			}
+			key, err := keys.DecryptDataKey(ctx, wrapped)
+			if err != nil {
+				return "", fmt.Errorf("decrypting data key: %w", err)
+			}
+			if aead, err = newAEAD(key); err != nil {
+				return "", err
+			}
+			ciphers[wrappedKey] = aead
+		}
+
+		sealed, err := base64.RawStdEncoding.DecodeString(sealedNumber)
+		if err != nil {
+			return "", err
+		}
+		plaintext, err := open(aead, sealed)
+		if err != nil {
+			return "", err
+		}
+		return string(plaintext), nil
+	})
+	if err != nil {
+		return fmt.Errorf("decrypting account numbers of user %s: %w", user.ID, err)
+	}
+	return nil
+}
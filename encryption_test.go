@@ -0,0 +1,162 @@
+package arus
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// storedDocuments returns every JSON document the data store's database
+// holds for users, concatenated.
+func storedDocuments(t *testing.T, store DataStore) string {
+	t.Helper()
+	var b strings.Builder
+	for _, table := range []string{TableUsers, TableStatements, TableReconciliations, TableGoals, TableRecurringRules} {
+		rows, err := store.Users.db.Query(`SELECT data FROM ` + table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+			var data string
+			if err := rows.Scan(&data); err != nil {
+				t.Fatal(err)
+			}
+			b.WriteString(data)
+		}
+		if err := rows.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b.String()
+}
+
+func TestAccountNumberEncryptionRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	date := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	card := BankAccount{AccountNumber: "4111111111111111", BankName: "Card Bank"}
+	tests := []struct {
+		name string
+		// Adds an account numbered number to the user, somewhere it is stored
+		add    func(t *testing.T, user *User, number string)
+		number string
+		// Reads the number back from the user
+		read func(user *User) string
+	}{
+		{
+			name:   "category account",
+			number: "900100200",
+			add: func(t *testing.T, user *User, number string) {
+				user.Categories[Savings].AddAccount(BankAccount{AccountNumber: number, BankName: "Extra Bank"})
+			},
+			read: func(user *User) string {
+				accounts := user.Categories[Savings].Accounts
+				return accounts[len(accounts)-1].BankAccount.AccountNumber
+			},
+		},
+		{
+			name:   "debit policy",
+			number: "EXP123",
+			add: func(t *testing.T, user *User, number string) {
+				user.Categories[Expense].DebitPolicy = SpecificAccount{BankAccount: BankAccount{AccountNumber: number, BankName: "Expense Bank"}}
+			},
+			read: func(user *User) string {
+				return user.Categories[Expense].DebitPolicy.(SpecificAccount).BankAccount.AccountNumber
+			},
+		},
+		{
+			name:   "open reconciliation",
+			number: "SAV123",
+			add: func(t *testing.T, user *User, number string) {
+				account := BankAccount{AccountNumber: number, BankName: "Savings Bank"}
+				if _, err := user.ReconcileAccount(account, money(t, "1", "USD")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			read: func(user *User) string {
+				return user.OpenReconciliations[0].BankAccount.AccountNumber
+			},
+		},
+		{
+			name:   "statement history",
+			number: "700800900",
+			add: func(t *testing.T, user *User, number string) {
+				user.StatementHistory = append(user.StatementHistory, StatementRecord{
+					BankAccount: BankAccount{AccountNumber: number, BankName: "Statement Bank"},
+					Period:      CreateMonthlyPeriod(2024, time.February),
+				})
+			},
+			read: func(user *User) string {
+				return user.StatementHistory[0].BankAccount.AccountNumber
+			},
+		},
+		{
+			name:   "credit card",
+			number: card.AccountNumber,
+			add: func(t *testing.T, user *User, number string) {
+				user.CreditCards = append(user.CreditCards, CreditCard{Account: card, CycleStartDay: 1, Balance: NewMoneyZero("USD")})
+			},
+			read: func(user *User) string {
+				return user.CreditCards[0].Account.AccountNumber
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := NewLocalKeyManager(bytes.Repeat([]byte{7}, 32))
+			if err != nil {
+				t.Fatal(err)
+			}
+			store := openTestStore(t, SQLBackendOptions{Keys: keys})
+			user := newFundedUser(t, "u1", "1000", date)
+			tt.add(t, user, tt.number)
+			if err := store.Users.Save(ctx, user); err != nil {
+				t.Fatal(err)
+			}
+
+			if stored := storedDocuments(t, store); strings.Contains(stored, tt.number) {
+				t.Errorf("account number %s is stored in plain", tt.number)
+			}
+			if got := tt.read(user); got != tt.number {
+				t.Errorf("saving changed the user's account number to %q", got)
+			}
+			loaded, err := store.Users.GetByID(ctx, "u1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.read(loaded); got != tt.number {
+				t.Errorf("read back account number %q, want %q", got, tt.number)
+			}
+
+			// Another master key can't read the numbers back
+			other, err := NewLocalKeyManager(bytes.Repeat([]byte{8}, 32))
+			if err != nil {
+				t.Fatal(err)
+			}
+			store.Users.Keys = other
+			if _, err := store.Users.GetByID(ctx, "u1"); err == nil {
+				t.Error("read the user back under another master key")
+			}
+		})
+	}
+
+	t.Run("numbers stored before encryption read back", func(t *testing.T) {
+		store := openTestStore(t, SQLBackendOptions{})
+		if err := store.Users.Save(ctx, newFundedUser(t, "u1", "1000", date)); err != nil {
+			t.Fatal(err)
+		}
+		keys, err := NewLocalKeyManager(bytes.Repeat([]byte{7}, 32))
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.Users.Keys = keys
+		loaded, err := store.Users.GetByID(ctx, "u1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := loaded.Categories[Savings].Accounts[0].BankAccount.AccountNumber; got != "SAV123" {
+			t.Errorf("read back account number %q, want SAV123", got)
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package arus
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// enumCodes maps an enum's values to the stable string codes used when
+// serializing it. Codes must never change once released; values written by
+// newer versions that this version does not know decode to unknown instead
+// of failing.
+type enumCodes[T ~int] struct {
+	name    string
+	codes   map[T]string
+	unknown T
+}
+
+func (e enumCodes[T]) code(value T) string {
+	if code, ok := e.codes[value]; ok {
+		return code
+	}
+	return "unknown"
+}
+
+func (e enumCodes[T]) parse(text string) T {
+	text = strings.ToLower(strings.TrimSpace(text))
+	for value, code := range e.codes {
+		if code == text {
+			return value
+		}
+	}
+	// Data written before codes were introduced stored the raw integer
+	if n, err := strconv.Atoi(text); err == nil {
+		if _, ok := e.codes[T(n)]; ok {
+			return T(n)
+		}
+	}
+	return e.unknown
+}
+
+func (e enumCodes[T]) unmarshalJSON(data []byte) (T, error) {
+	var code string
+	if err := json.Unmarshal(data, &code); err == nil {
+		return e.parse(code), nil
+	}
+	var n int
+	if err := json.Unmarshal(data, &n); err == nil {
+		return e.parse(strconv.Itoa(n)), nil
+	}
+	return e.unknown, fmt.Errorf("invalid %s %s", e.name, data)
+}
+
+func (e enumCodes[T]) scan(src any) (T, error) {
+	switch v := src.(type) {
+	case string:
+		return e.parse(v), nil
+	case []byte:
+		return e.parse(string(v)), nil
+	case int64:
+		return e.parse(strconv.FormatInt(v, 10)), nil
+	case nil:
+		return e.unknown, nil
+	default:
+		return e.unknown, fmt.Errorf("cannot scan %T into %s", src, e.name)
+	}
+}
+
+// Value of CategoryType for data written by a newer version
+const UnknownCategory CategoryType = -1
+
+var categoryTypeCodes = enumCodes[CategoryType]{
+	name: "category type",
+	codes: map[CategoryType]string{
+		Expense:    "expense",
+		Emergency:  "emergency",
+		Savings:    "savings",
+		Investment: "investment",
+		ToBudget:   "to-budget",
+		Owed:       "owed",
+		Cash:       "cash",
+	},
+	unknown: UnknownCategory,
+}
+
+// ParseCategoryType reads a category type code, returning UnknownCategory
+// for codes this version does not know.
+func ParseCategoryType(code string) CategoryType {
+	return categoryTypeCodes.parse(code)
+}
+
+func (c CategoryType) Code() string {
+	return categoryTypeCodes.code(c)
+}
+
+// MarshalText is also used by encoding/json for map keys, so
+// map[CategoryType]... serializes with codes too.
+func (c CategoryType) MarshalText() ([]byte, error) {
+	return []byte(c.Code()), nil
+}
+
+func (c *CategoryType) UnmarshalText(text []byte) error {
+	*c = categoryTypeCodes.parse(string(text))
+	return nil
+}
+
+func (c CategoryType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.Code())
+}
+
+func (c *CategoryType) UnmarshalJSON(data []byte) error {
+	value, err := categoryTypeCodes.unmarshalJSON(data)
+	*c = value
+	return err
+}
+
+func (c CategoryType) Value() (driver.Value, error) {
+	return c.Code(), nil
+}
+
+func (c *CategoryType) Scan(src any) error {
+	value, err := categoryTypeCodes.scan(src)
+	*c = value
+	return err
+}
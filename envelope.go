@@ -0,0 +1,197 @@
+package arus
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// AllocationMode is how a user's incomes are split across categories.
+type AllocationMode int
+
+const (
+	// Incomes are split by the user's AllocationRules
+	PercentageAllocation AllocationMode = iota
+	// Zero-based budgeting: incomes land in the ToBudget category and the
+	// user assigns every unit of them to envelopes (categories) by hand
+	EnvelopeAllocation
+)
+
+var allocationModeCodes = enumCodes[AllocationMode]{
+	name: "allocation mode",
+	codes: map[AllocationMode]string{
+		PercentageAllocation: "percentage",
+		EnvelopeAllocation:   "envelope",
+	},
+	unknown: PercentageAllocation,
+}
+
+// ParseAllocationMode reads an allocation mode code, returning
+// PercentageAllocation for codes this version does not know.
+func ParseAllocationMode(code string) AllocationMode {
+	return allocationModeCodes.parse(code)
+}
+
+func (m AllocationMode) Code() string {
+	return allocationModeCodes.code(m)
+}
+
+func (m AllocationMode) String() string {
+	return m.Code()
+}
+
+func (m AllocationMode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.Code())
+}
+
+func (m *AllocationMode) UnmarshalJSON(data []byte) error {
+	value, err := allocationModeCodes.unmarshalJSON(data)
+	*m = value
+	return err
+}
+
+func (m AllocationMode) Value() (driver.Value, error) {
+	return m.Code(), nil
+}
+
+func (m *AllocationMode) Scan(src any) error {
+	value, err := allocationModeCodes.scan(src)
+	*m = value
+	return err
+}
+
+// EnvelopeAssignment is money moved from one envelope to another, usually
+// out of ToBudget.
+type EnvelopeAssignment struct {
+	Date   time.Time
+	From   CategoryType
+	To     CategoryType
+	Amount Money
+}
+
+// SetAllocationMode switches how the user's incomes are allocated. Envelope
+// mode adds the ToBudget category if the user does not have it; leaving it
+// requires ToBudget to be empty, so no income is left unassigned.
+func (u *User) SetAllocationMode(mode AllocationMode) error {
+	switch mode {
+	case EnvelopeAllocation:
+		if _, exists := u.Categories[ToBudget]; !exists {
+			u.Categories[ToBudget] = NewCategory(ToBudget, u.Currency())
+		}
+	case PercentageAllocation:
+		if unassigned := u.Unassigned(); !unassigned.IsZero() {
+			return fmt.Errorf("%s is still to be budgeted; assign it before leaving envelope mode", unassigned.StringFixed())
+		}
+	default:
+		return fmt.Errorf("unknown allocation mode %d", mode)
+	}
+	u.AllocationMode = mode
+	return nil
+}
+
+// Unassigned is the income waiting in ToBudget to be assigned.
+func (u *User) Unassigned() Money {
+	if category, exists := u.Categories[ToBudget]; exists {
+		return category.Balance
+	}
+	return NewMoneyZero(u.Currency())
+}
+
+// allocateToBudget records the income as landing entirely in ToBudget.
+func (u *User) allocateToBudget(income Money, date time.Time, description string) error {
+	category, exists := u.Categories[ToBudget]
+	if !exists {
+		return &CategoryNotFoundError{Category: ToBudget}
+	}
+	if err := category.Credit(income); err != nil {
+		return err
+	}
+	newIncome := NewTransaction(income, date, description)
+	newIncome.Allocations = []Allocation{{Category: ToBudget, Amount: income}}
+
+	u.Incomes = append(u.Incomes, newIncome)
+	u.recordTotals(newIncome, false)
+	return nil
+}
+
+// AssignFunds moves amount from one envelope to another; assigning income
+// moves it out of ToBudget, and moving it back unassigns it.
+func (u *User) AssignFunds(from, to CategoryType, amount Money, date time.Time) (EnvelopeAssignment, error) {
+	if u.AllocationMode != EnvelopeAllocation {
+		return EnvelopeAssignment{}, errors.New("funds can only be assigned in envelope mode")
+	}
+	if !amount.Amount.IsPositive() {
+		return EnvelopeAssignment{}, errors.New("assigned amount must be positive")
+	}
+	if from == to {
+		return EnvelopeAssignment{}, errors.New("funds must be assigned to a different envelope")
+	}
+	source, exists := u.Categories[from]
+	if !exists {
+		return EnvelopeAssignment{}, &CategoryNotFoundError{Category: from}
+	}
+	target, exists := u.Categories[to]
+	if !exists {
+		return EnvelopeAssignment{}, &CategoryNotFoundError{Category: to}
+	}
+	if err := target.checkCurrency(amount); err != nil {
+		return EnvelopeAssignment{}, err
+	}
+	if err := source.Debit(amount); err != nil {
+		return EnvelopeAssignment{}, err
+	}
+	if err := target.Credit(amount); err != nil {
+		return EnvelopeAssignment{}, err
+	}
+
+	assignment := EnvelopeAssignment{Date: date, From: from, To: to, Amount: amount}
+	u.EnvelopeAssignments = append(u.EnvelopeAssignments, assignment)
+	return assignment, nil
+}
+
+func (s *FinanceService) SetAllocationMode(ctx context.Context, userID string, mode AllocationMode) error {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.AllocationMode == mode {
+		return nil
+	}
+	if err := user.SetAllocationMode(mode); err != nil {
+		return err
+	}
+
+	if err := s.save(ctx, user, "set_allocation_mode"); err != nil {
+		return err
+	}
+	s.Telemetry.Track(ctx, "allocation", "set_mode", userID, map[string]string{"mode": mode.Code()})
+	return nil
+}
+
+// AssignFunds moves amount between the user's envelopes, e.g. from ToBudget
+// to Expense.
+func (s *FinanceService) AssignFunds(ctx context.Context, userID string, from, to CategoryType, amount Money) (EnvelopeAssignment, error) {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return EnvelopeAssignment{}, err
+	}
+	assignment, err := user.AssignFunds(from, to, amount, s.now())
+	if err != nil {
+		return EnvelopeAssignment{}, err
+	}
+
+	if err := s.save(ctx, user, "assign_funds"); err != nil {
+		return EnvelopeAssignment{}, err
+	}
+	s.log().InfoContext(ctx, "assigned funds",
+		LogKeyUserID, userID, "from", from.String(), "to", to.String(), "amount", amount.String())
+	s.Telemetry.Track(ctx, "allocation", "assign", userID, nil)
+	return assignment, nil
+}
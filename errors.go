@@ -0,0 +1,158 @@
+package arus
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Sentinel errors callers can match with errors.Is. The typed errors below
+// match the corresponding sentinel too.
+var (
+	ErrUserNotFound         = errors.New("user not found")
+	ErrInsufficientFunds    = errors.New("insufficient funds")
+	ErrCurrencyMismatch     = errors.New("currency mismatch")
+	ErrNoAllocationRules    = errors.New("user does not have allocation planned")
+	ErrCategoryNotFound     = errors.New("category does not exist")
+	ErrAccountNotLinked     = errors.New("bank account is not linked")
+	ErrQuotaExceeded        = errors.New("quota exceeded")
+	ErrExpenseNotFound      = errors.New("expense not found")
+	ErrTransactionNotFound  = errors.New("transaction not found")
+	ErrTransactionLocked    = errors.New("transaction is locked")
+	ErrIdempotencyKeyReused = errors.New("idempotency key was used for a different request")
+	ErrRequestInProgress    = errors.New("request with this idempotency key is in progress")
+	ErrBatchRejected        = errors.New("batch rejected")
+	ErrUserArchived         = errors.New("user is archived")
+	ErrUserNotArchived      = errors.New("user is not archived")
+	ErrHoldingNotFound      = errors.New("holding not found")
+	ErrInsufficientUnits    = errors.New("not enough units held")
+	ErrLoanNotFound         = errors.New("loan not found")
+	ErrCardNotFound         = errors.New("credit card not found")
+	ErrAttachmentNotFound   = errors.New("attachment not found")
+	ErrInvalidAttachment    = errors.New("invalid attachment")
+	ErrBlobNotFound         = errors.New("blob not found")
+	ErrPeriodArchived       = errors.New("period is archived")
+	ErrUnknownSender        = errors.New("sender matches no linked bank")
+	ErrStatementNotQueued   = errors.New("statement is not queued")
+)
+
+// InsufficientFundsError reports a debit that could not be covered. Category
+// is nil when the shortfall is across the whole deduction cascade.
+type InsufficientFundsError struct {
+	Category  *CategoryType
+	Account   *BankAccount
+	Needed    Money
+	Available Money
+	// Categories whose reserve floors held back money the debit needed
+	Floors []CategoryType
+}
+
+func (e *InsufficientFundsError) Error() string {
+	message := e.message()
+	if len(e.Floors) > 0 {
+		names := make([]string, len(e.Floors))
+		for i, floor := range e.Floors {
+			names[i] = floor.String()
+		}
+		message += fmt.Sprintf(" (held back by the reserve floor of %s)", strings.Join(names, ", "))
+	}
+	return message
+}
+
+func (e *InsufficientFundsError) message() string {
+	switch {
+	case e.Account != nil && e.Category != nil:
+		return fmt.Sprintf("insufficient funds in account %s of category %s: needed %s, available %s",
+			e.Account.Masked(), e.Category.String(), e.Needed.StringFixed(), e.Available.StringFixed())
+	case e.Account != nil:
+		return fmt.Sprintf("insufficient funds in account %s: needed %s, available %s",
+			e.Account.Masked(), e.Needed.StringFixed(), e.Available.StringFixed())
+	case e.Category != nil:
+		return fmt.Sprintf("insufficient funds in category %s: needed %s, available %s",
+			e.Category.String(), e.Needed.StringFixed(), e.Available.StringFixed())
+	default:
+		return fmt.Sprintf("insufficient funds across all categories: needed %s, available %s",
+			e.Needed.StringFixed(), e.Available.StringFixed())
+	}
+}
+
+func (e *InsufficientFundsError) Is(target error) bool {
+	return target == ErrInsufficientFunds
+}
+
+type CurrencyMismatchError struct {
+	Expected string
+	Got      string
+}
+
+func (e *CurrencyMismatchError) Error() string {
+	return fmt.Sprintf("currency mismatch: expected %s, got %s", e.Expected, e.Got)
+}
+
+func (e *CurrencyMismatchError) Is(target error) bool {
+	return target == ErrCurrencyMismatch
+}
+
+type CategoryNotFoundError struct {
+	Category CategoryType
+}
+
+func (e *CategoryNotFoundError) Error() string {
+	return fmt.Sprintf("category %s does not exist", e.Category.String())
+}
+
+func (e *CategoryNotFoundError) Is(target error) bool {
+	return target == ErrCategoryNotFound
+}
+
+type AccountNotLinkedError struct {
+	BankAccount BankAccount
+	// Nil when the account is not linked to any of the user's categories
+	Category *CategoryType
+}
+
+func (e *AccountNotLinkedError) Error() string {
+	if e.Category == nil {
+		return fmt.Sprintf("no category associated with bank account %s at %s",
+			e.BankAccount.Masked(), e.BankAccount.BankName)
+	}
+	return fmt.Sprintf("bank account %s at %s is not linked to category %s",
+		e.BankAccount.Masked(), e.BankAccount.BankName, e.Category.String())
+}
+
+func (e *AccountNotLinkedError) Is(target error) bool {
+	return target == ErrAccountNotLinked
+}
+
+// TransactionLockedError reports an in-place change to a transaction older
+// than the user's lock window. Such changes must be recorded as amendments.
+type TransactionLockedError struct {
+	TransactionID string
+	LockedSince   time.Time
+}
+
+func (e *TransactionLockedError) Error() string {
+	return fmt.Sprintf("transaction %s is locked since %s and can only be amended",
+		e.TransactionID, e.LockedSince.Format("2006-01-02"))
+}
+
+func (e *TransactionLockedError) Is(target error) bool {
+	return target == ErrTransactionLocked
+}
+
+// UserArchivedError reports a lookup of an archived user. It matches both
+// ErrUserArchived and ErrUserNotFound, since archived users are deleted as
+// far as most callers are concerned.
+type UserArchivedError struct {
+	UserID     string
+	ArchivedAt time.Time
+}
+
+func (e *UserArchivedError) Error() string {
+	return fmt.Sprintf("user %s is archived since %s", e.UserID, e.ArchivedAt.Format("2006-01-02"))
+}
+
+func (e *UserArchivedError) Is(target error) bool {
+	return target == ErrUserArchived || target == ErrUserNotFound
+}
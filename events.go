@@ -0,0 +1,161 @@
+package arus
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Kinds of ledger events
+const (
+	EventTransactionRecorded = "transaction.recorded"
+	EventTransactionUpdated  = "transaction.updated"
+	EventBalancesUpdated     = "balances.updated"
+	EventReconciled          = "account.reconciled"
+	EventTradeRecorded       = "holding.traded"
+	EventBudgetExceeded      = "budget.exceeded"
+	EventEmergencyTapped     = "emergency.tapped"
+	EventOverdrawn           = "balance.overdrawn"
+	EventGoalReached         = "goal.reached"
+	EventBillUpcoming        = "bill.upcoming"
+	EventBillsUncovered      = "bills.uncovered"
+	EventLowBalance          = "balance.low"
+)
+
+// Event is a change to a user's ledger. Data is a Transaction, a
+// BalancesSnapshot, a Reconciliation, a Trade, a Goal, an UpcomingBill, a
+// BillCalendar or a LowBalance, depending on Type; budget, emergency and
+// overdraft events carry the expense.
+type Event struct {
+	ID     string
+	Type   string
+	UserID string
+	At     time.Time
+	Data   any
+}
+
+// BalancesSnapshot is every category balance right after a change.
+type BalancesSnapshot struct {
+	Balances map[CategoryType]Money
+}
+
+func NewBalancesSnapshot(user *User) BalancesSnapshot {
+	balances := make(map[CategoryType]Money, len(user.Categories))
+	for categoryType, category := range user.Categories {
+		balances[categoryType] = category.Balance
+	}
+	return BalancesSnapshot{Balances: balances}
+}
+
+// Balances returns the user's current category balances, read under the
+// user's lock so a change in progress is not seen halfway.
+func (s *FinanceService) Balances(ctx context.Context, userID string) (BalancesSnapshot, error) {
+	user, err := s.readUser(ctx, userID)
+	if err != nil {
+		return BalancesSnapshot{}, err
+	}
+	return NewBalancesSnapshot(user), nil
+}
+
+// EventBus fans ledger events out to in-process subscribers, such as
+// realtime streams to dashboards.
+type EventBus struct {
+	mu          sync.RWMutex
+	subscribers map[int]subscriber
+	next        int
+}
+
+type subscriber struct {
+	userID string
+	events chan Event
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[int]subscriber)}
+}
+
+// Subscribe receives the events of one user until cancel is called. A
+// subscriber that falls more than buffer events behind misses events rather
+// than slowing down the ledger.
+func (b *EventBus) Subscribe(userID string, buffer int) (events <-chan Event, cancel func()) {
+	return b.subscribe(userID, buffer)
+}
+
+// SubscribeAll receives the events of every user, e.g. for alerts.
+func (b *EventBus) SubscribeAll(buffer int) (events <-chan Event, cancel func()) {
+	return b.subscribe("", buffer)
+}
+
+func (b *EventBus) subscribe(userID string, buffer int) (events <-chan Event, cancel func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.next
+	b.next++
+	ch := make(chan Event, buffer)
+	b.subscribers[id] = subscriber{userID: userID, events: ch}
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			delete(b.subscribers, id)
+			close(ch)
+		})
+	}
+}
+
+func (b *EventBus) Publish(event Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, s := range b.subscribers {
+		if s.userID != "" && s.userID != event.UserID {
+			continue
+		}
+		select {
+		case s.events <- event:
+		default:
+		}
+	}
+}
+
+// publish sends an event about the user when an event bus is configured.
+func (s *FinanceService) publish(userID, eventType string, data any) {
+	if s.Events == nil {
+		return
+	}
+	s.Events.Publish(Event{
+		ID:     NewID(),
+		Type:   eventType,
+		UserID: userID,
+		At:     s.now(),
+		Data:   data,
+	})
+}
+
+// publishLedger announces newly recorded transactions and the resulting
+// balances. Expenses that ran past the Expense category, drew on the
+// emergency fund or overdrew a category are announced too.
+func (s *FinanceService) publishLedger(user *User, recorded ...Transaction) {
+	for _, tx := range recorded {
+		s.publish(user.ID, EventTransactionRecorded, tx)
+		if !tx.Amount.IsNegative() || !tx.Counts() {
+			continue
+		}
+		if covered := tx.DeductedFrom(Expense); covered.Amount.IsPositive() && covered.Amount.LessThan(tx.Amount.Abs().Amount) {
+			s.publish(user.ID, EventBudgetExceeded, tx)
+		}
+		if tx.DeductedFrom(Emergency).Amount.IsPositive() {
+			s.publish(user.ID, EventEmergencyTapped, tx)
+		}
+		if slices.ContainsFunc(tx.Deductions, func(d Deduction) bool { return d.Overdraft }) {
+			s.publish(user.ID, EventOverdrawn, tx)
+		}
+	}
+	s.publishLowBalances(user, recorded)
+	s.publish(user.ID, EventBalancesUpdated, NewBalancesSnapshot(user))
+}
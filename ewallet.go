@@ -0,0 +1,309 @@
+package arus
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// EWalletKind is what an e-wallet transaction did with the money.
+type EWalletKind string
+
+const (
+	// Paid a merchant or sent money to someone
+	EWalletPayment EWalletKind = "payment"
+	// Money paid back by a merchant
+	EWalletRefund EWalletKind = "refund"
+	// Money sent to the wallet by someone else
+	EWalletReceived EWalletKind = "received"
+	// Loaded from one of the user's bank accounts or cards
+	EWalletTopUp EWalletKind = "top-up"
+	// Cashed out to one of the user's bank accounts
+	EWalletWithdrawal EWalletKind = "withdrawal"
+)
+
+// IsTransfer reports whether the kind moves the user's own money between
+// the wallet and a bank, which is neither spent nor earned.
+func (k EWalletKind) IsTransfer() bool {
+	return k == EWalletTopUp || k == EWalletWithdrawal
+}
+
+// EWalletTransaction is one transaction of an e-wallet's history.
+type EWalletTransaction struct {
+	// Provider's ID of the transaction, if the export has one
+	ID   string `json:",omitempty"`
+	Time time.Time
+	Kind EWalletKind
+	// Money moved, positive whichever way it went
+	Amount      Money
+	Description string
+	Status      TransactionStatus
+}
+
+// line returns the transaction as a line of the wallet's statement:
+// payments debit it, refunds and money received credit it.
+func (t EWalletTransaction) line() StatementLine {
+	amount := t.Amount.Abs()
+	if t.Kind == EWalletPayment {
+		amount.Amount = amount.Amount.Neg()
+	}
+	return StatementLine{
+		Date:        t.Time,
+		Description: t.Description,
+		Amount:      amount,
+		Reference:   t.ID,
+		Status:      t.Status,
+	}
+}
+
+// EWalletConnector reads the transaction history an e-wallet provider
+// exports, such as GoPay's.
+type EWalletConnector interface {
+	// Provider names the e-wallet, as in the BankName of its accounts
+	Provider() string
+	ReadExport(r io.Reader) ([]EWalletTransaction, error)
+}
+
+// CSVWalletExport reads e-wallet exports in CSV with a header row. Amounts
+// are read unsigned; the kind column says which way the money went.
+type CSVWalletExport struct {
+	Name string
+	// Header of the column holding each of date, description, amount,
+	// kind, and optionally id and status, compared case-insensitively
+	Columns map[string]string
+	// Layout of the date column; empty means 2006-01-02
+	DateLayout string
+	Locale     Locale
+	// Kind each value of the kind column means, by lower-case value; rows
+	// of other kinds are refused
+	Kinds map[string]EWalletKind
+	// Status each value of the status column means, by lower-case value;
+	// rows with other statuses, such as failed ones, are left out
+	Statuses map[string]TransactionStatus
+}
+
+// GoPayExport reads the transaction history GoPay exports from its app.
+var GoPayExport = &CSVWalletExport{
+	Name: "GoPay",
+	Columns: map[string]string{
+		"date":        "Transaction Date",
+		"description": "Description",
+		"amount":      "Amount",
+		"kind":        "Transaction Type",
+		"id":          "Transaction ID",
+		"status":      "Status",
+	},
+	DateLayout: "02/01/2006 15:04",
+	Locale:     LocaleIdID,
+	Kinds: map[string]EWalletKind{
+		"payment":     EWalletPayment,
+		"transfer":    EWalletPayment,
+		"refund":      EWalletRefund,
+		"cashback":    EWalletRefund,
+		"receive":     EWalletReceived,
+		"top up":      EWalletTopUp,
+		"withdraw":    EWalletWithdrawal,
+		"bank payout": EWalletWithdrawal,
+	},
+	Statuses: map[string]TransactionStatus{
+		"success":    Posted,
+		"completed":  Posted,
+		"pending":    Pending,
+		"processing": Pending,
+	},
+}
+
+// DefaultEWalletConnectors are the connectors EWalletConnectorFor looks
+// through.
+var DefaultEWalletConnectors = []EWalletConnector{GoPayExport}
+
+// EWalletConnectorFor returns the default connector for the account's
+// e-wallet provider.
+func EWalletConnectorFor(account BankAccount) (EWalletConnector, bool) {
+	for _, connector := range DefaultEWalletConnectors {
+		if strings.EqualFold(connector.Provider(), strings.TrimSpace(account.BankName)) {
+			return connector, true
+		}
+	}
+	return nil, false
+}
+
+func (e *CSVWalletExport) Provider() string {
+	return e.Name
+}
+
+func (e *CSVWalletExport) ReadExport(r io.Reader) ([]EWalletTransaction, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%s export has no header row", e.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int, len(e.Columns))
+	for i, name := range header {
+		for field, column := range e.Columns {
+			if strings.EqualFold(strings.TrimSpace(name), column) {
+				columns[field] = i
+			}
+		}
+	}
+	for _, required := range []string{"date", "description", "amount", "kind"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("%s export has no %s column", e.Name, e.Columns[required])
+		}
+	}
+
+	layout := e.DateLayout
+	if layout == "" {
+		layout = time.DateOnly
+	}
+	var transactions []EWalletTransaction
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return transactions, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		row, _ := reader.FieldPos(0)
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		status := Posted
+		if _, ok := columns["status"]; ok {
+			if status, ok = e.Statuses[strings.ToLower(field("status"))]; !ok {
+				continue
+			}
+		}
+		kind, ok := e.Kinds[strings.ToLower(field("kind"))]
+		if !ok {
+			return nil, fmt.Errorf("row %d: unknown transaction type %q", row, field("kind"))
+		}
+		date, err := time.Parse(layout, field("date"))
+		if err != nil {
+			return nil, fmt.Errorf("row %d: invalid date: %w", row, err)
+		}
+		amount, err := ParseMoney(field("amount"), e.Locale)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", row, err)
+		}
+		transactions = append(transactions, EWalletTransaction{
+			ID:          field("id"),
+			Time:        date,
+			Kind:        kind,
+			Amount:      amount.Abs(),
+			Description: field("description"),
+			Status:      status,
+		})
+	}
+}
+
+// EWalletStatement returns the wallet's history as a statement of the
+// account. Top-ups and withdrawals are transfers and have no line, so only
+// payments are recorded as expenses. Lines take the provider's transaction
+// IDs, or IDs derived from the line when the export has none, so importing
+// overlapping exports records each transaction once.
+func EWalletStatement(account BankAccount, transactions []EWalletTransaction) AccountStatement {
+	statement := AccountStatement{BankAccount: account}
+	key := strings.ToLower(account.AccountNumber + "@" + account.BankName)
+	seen := make(map[string]int)
+	for _, transaction := range transactions {
+		if transaction.Kind.IsTransfer() {
+			continue
+		}
+		line := transaction.line()
+		if transaction.ID != "" {
+			line.ID = "ewallet-" + strings.ToLower(account.BankName) + "-" + transaction.ID
+		} else {
+			line.ID = derivedLineID("ewallet-", key, line, seen)
+		}
+		statement.Lines = append(statement.Lines, line)
+	}
+	return statement
+}
+
+// EWalletImport counts what ImportEWallet read.
+type EWalletImport struct {
+	Payments  int
+	Credits   int
+	Transfers int
+}
+
+// ImportEWallet reads the export with the connector and processes it like
+// ProcessAccountStatement into the e-wallet account, which must be linked
+// to a category. Payments are recorded as expenses; top-ups and
+// withdrawals are transfers between the user's own accounts and are not.
+// Top-ups on bank statements are left out likewise, see walletTopUp.
+func (s *FinanceService) ImportEWallet(ctx context.Context, userID string, account BankAccount, connector EWalletConnector, export io.Reader) (EWalletImport, error) {
+	if account.Type == UnspecifiedAccount {
+		account.Type = EWalletAccount
+	}
+	if account.Type != EWalletAccount {
+		return EWalletImport{}, fmt.Errorf("account %s is not an e-wallet", account.Masked())
+	}
+	transactions, err := connector.ReadExport(export)
+	if err != nil {
+		return EWalletImport{}, fmt.Errorf("%s export: %w", connector.Provider(), err)
+	}
+	if len(transactions) == 0 {
+		return EWalletImport{}, errors.New("e-wallet export has no transactions")
+	}
+
+	var report EWalletImport
+	for _, transaction := range transactions {
+		switch {
+		case transaction.Kind.IsTransfer():
+			report.Transfers++
+		case transaction.Kind == EWalletPayment:
+			report.Payments++
+		default:
+			report.Credits++
+		}
+	}
+	statement := EWalletStatement(account, transactions)
+	if len(statement.Lines) == 0 {
+		return report, nil
+	}
+	if err := s.ProcessAccountStatement(ctx, userID, statement); err != nil {
+		return EWalletImport{}, err
+	}
+	return report, nil
+}
+
+// Words banks describe e-wallet top-ups with
+var topUpWords = []string{"top up", "topup", "top-up", "isi saldo", "reload"}
+
+// walletTopUp returns the linked e-wallet a bank statement debit tops up:
+// one whose provider a top-up's description names. The wallet's own
+// payments are what count as spending, so the top-up is a transfer.
+func (u *User) walletTopUp(statementAccount BankAccount, line StatementLine) *BankAccount {
+	if DetectAccountType(statementAccount) == EWalletAccount {
+		return nil
+	}
+	description := strings.ToLower(line.Description)
+	if !slices.ContainsFunc(topUpWords, func(word string) bool { return strings.Contains(description, word) }) {
+		return nil
+	}
+	words := nameWords(description)
+	for _, account := range u.linkedAccounts() {
+		provider := strings.Join(nameWords(account.BankName), " ")
+		if DetectAccountType(account) == EWalletAccount && provider != "" && containsPhrase(words, provider) {
+			return &account
+		}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package arus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+var ErrRateUnavailable = errors.New("exchange rate unavailable")
+
+// ExchangeRate converts From into To: 1 From = Rate To.
+type ExchangeRate struct {
+	From      string
+	To        string
+	Rate      decimal.Decimal
+	FetchedAt time.Time
+	// Day a historical rate applies to; zero for current rates
+	Date time.Time
+	// Set when the upstream could not be reached and a cached rate older
+	// than the TTL was served instead
+	Stale bool
+}
+
+// Convert converts amount (in r.From) into r.To.
+func (r ExchangeRate) Convert(amount Money) (Money, error) {
+	if amount.Currency != r.From {
+		return Money{}, &CurrencyMismatchError{Expected: r.From, Got: amount.Currency}
+	}
+	return Money{Amount: amount.Amount.Mul(r.Rate), Currency: r.To}.Round(), nil
+}
+
+// ExchangeRateProvider looks up the current rate between two currencies.
+type ExchangeRateProvider interface {
+	Rate(ctx context.Context, from, to string) (ExchangeRate, error)
+}
+
+// StaticRates serves fixed rates, e.g. configured by hand for offline use.
+type StaticRates map[string]decimal.Decimal
+
+func (s StaticRates) Rate(ctx context.Context, from, to string) (ExchangeRate, error) {
+	if from == to {
+		return ExchangeRate{From: from, To: to, Rate: decimal.NewFromInt(1), FetchedAt: time.Now()}, nil
+	}
+	rate, ok := s[rateKey(from, to)]
+	if !ok {
+		return ExchangeRate{}, fmt.Errorf("%w: %s to %s", ErrRateUnavailable, from, to)
+	}
+	return ExchangeRate{From: from, To: to, Rate: rate, FetchedAt: time.Now()}, nil
+}
+
+func rateKey(from, to string) string {
+	return strings.ToUpper(from) + "/" + strings.ToUpper(to)
+}
+
+// RateCache stores the last known rate per currency pair.
+type RateCache interface {
+	Get(from, to string) (ExchangeRate, bool)
+	Put(rate ExchangeRate) error
+}
+
+type InMemoryRateCache struct {
+	rates map[string]ExchangeRate
+	mu    sync.RWMutex
+}
+
+func NewInMemoryRateCache() *InMemoryRateCache {
+	return &InMemoryRateCache{
+		rates: make(map[string]ExchangeRate),
+	}
+}
+
+func (c *InMemoryRateCache) Get(from, to string) (ExchangeRate, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	rate, ok := c.rates[rateKey(from, to)]
+	return rate, ok
+}
+
+func (c *InMemoryRateCache) Put(rate ExchangeRate) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rates[rateKey(rate.From, rate.To)] = rate
+	return nil
+}
+
+// FileRateCache keeps rates in a JSON file so the last known rates survive
+// restarts and are available when starting up offline.
+type FileRateCache struct {
+	path  string
+	rates map[string]ExchangeRate
+	mu    sync.RWMutex
+}
+
+func NewFileRateCache(path string) (*FileRateCache, error) {
+	c := &FileRateCache{path: path, rates: make(map[string]ExchangeRate)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &c.rates); err != nil {
+		return nil, fmt.Errorf("reading rate cache %s: %w", path, err)
+	}
+	return c, nil
+}
+
+func (c *FileRateCache) Get(from, to string) (ExchangeRate, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	rate, ok := c.rates[rateKey(from, to)]
+	return rate, ok
+}
+
+func (c *FileRateCache) Put(rate ExchangeRate) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rate.Stale = false
+	c.rates[rateKey(rate.From, rate.To)] = rate
+
+	data, err := json.MarshalIndent(c.rates, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first so a crash never leaves a torn cache
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".rates-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// CachedRateProvider serves rates from Cache while they are younger than
+// TTL and refreshes them from Upstream otherwise. When Upstream fails, the
+// last known rate is served with Stale set, so imports and reports keep
+// working through network outages.
+type CachedRateProvider struct {
+	Upstream ExchangeRateProvider
+	Cache    RateCache
+	TTL      time.Duration
+	// Source of the current time for TTL checks; nil uses the wall clock
+	Clock Clock
+}
+
+func NewCachedRateProvider(upstream ExchangeRateProvider, cache RateCache, ttl time.Duration) *CachedRateProvider {
+	return &CachedRateProvider{Upstream: upstream, Cache: cache, TTL: ttl}
+}
+
+func (p *CachedRateProvider) Rate(ctx context.Context, from, to string) (ExchangeRate, error) {
+	cached, found := p.Cache.Get(from, to)
+	if found && clockOrSystem(p.Clock).Now().Sub(cached.FetchedAt) < p.TTL {
+		return cached, nil
+	}
+
+	fresh, err := p.Upstream.Rate(ctx, from, to)
+	if err == nil {
+		// A cache that cannot be written only costs us the offline
+		// fallback, so it must not fail the lookup.
+		_ = p.Cache.Put(fresh)
+		return fresh, nil
+	}
+
+	if found {
+		cached.Stale = true
+		return cached, nil
+	}
+	return ExchangeRate{}, err
+}
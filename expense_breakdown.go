@@ -0,0 +1,134 @@
+package arus
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"github.com/shopspring/decimal"
+)
+
+// Labels used in expense breakdowns for expenses without a tag or merchant
+const (
+	BreakdownUntagged        = "untagged"
+	BreakdownUnknownMerchant = "unknown merchant"
+)
+
+// TreemapNode is a node of a treemap: its value is the sum of its
+// children's, largest first.
+type TreemapNode struct {
+	Name     string
+	Value    Money
+	Children []TreemapNode
+}
+
+// PieSlice is a part of a pie chart, with its share of the whole.
+type PieSlice struct {
+	Label string
+	Value Money
+	// Fraction of the whole, between 0 and 1
+	Share decimal.Decimal
+}
+
+// spendingEntries returns the Journal entries in period that pay for
+// spending or debt in the user's currency, with the expense behind each.
+func (u *User) spendingEntries(period Period) ([]LedgerEntry, map[string]Transaction) {
+	expenses := make(map[string]Transaction)
+	for _, expense := range u.Expenses {
+		if period.Contains(expense.Date) {
+			expenses[expense.ID] = expense
+		}
+	}
+	var entries []LedgerEntry
+	for _, entry := range u.Journal() {
+		if !period.Contains(entry.Date) || entry.Amount.Currency != u.Currency() {
+			continue
+		}
+		if entry.Debit == SpendingAccount || entry.Debit == DebtAccount {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, expenses
+}
+
+// ExpenseTreemap breaks the period's spending down by the category that
+// covered it, then by the expense's first tag, then by merchant, falling
+// back to the description. Spending in other currencies than the user's is
+// left out.
+func (u *User) ExpenseTreemap(period Period) TreemapNode {
+	entries, expenses := u.spendingEntries(period)
+	root := TreemapNode{Name: FlowSpending, Value: NewMoneyZero(u.Currency())}
+	for _, entry := range entries {
+		expense := expenses[entry.Source]
+		tag := BreakdownUntagged
+		if len(expense.Tags) > 0 {
+			tag = expense.Tags[0]
+		}
+		merchant := cmp.Or(expense.Merchant, expense.Description, BreakdownUnknownMerchant)
+		root.add([]string{entry.Credit.Name, tag, merchant}, entry.Amount)
+	}
+	root.sort()
+	return root
+}
+
+// add adds amount to the node and to the descendants along path, creating
+// them as needed.
+func (n *TreemapNode) add(path []string, amount Money) {
+	n.Value = n.Value.Add(amount)
+	if len(path) == 0 {
+		return
+	}
+	i := slices.IndexFunc(n.Children, func(child TreemapNode) bool { return child.Name == path[0] })
+	if i < 0 {
+		n.Children = append(n.Children, TreemapNode{Name: path[0], Value: NewMoneyZero(amount.Currency)})
+		i = len(n.Children) - 1
+	}
+	n.Children[i].add(path[1:], amount)
+}
+
+func (n *TreemapNode) sort() {
+	slices.SortFunc(n.Children, func(a, b TreemapNode) int {
+		return cmp.Or(b.Value.Amount.Cmp(a.Value.Amount), cmp.Compare(a.Name, b.Name))
+	})
+	for i := range n.Children {
+		n.Children[i].sort()
+	}
+}
+
+// Pie returns the node's children as slices of a pie chart.
+func (n TreemapNode) Pie() []PieSlice {
+	pie := make([]PieSlice, len(n.Children))
+	for i, child := range n.Children {
+		pie[i] = PieSlice{Label: child.Name, Value: child.Value, Share: decimal.Zero}
+		if n.Value.Amount.IsPositive() {
+			pie[i].Share = child.Value.Amount.DivRound(n.Value.Amount, 4)
+		}
+	}
+	return pie
+}
+
+// ExpensePie returns the shares of the period's spending covered by each
+// category, largest first.
+func (u *User) ExpensePie(period Period) []PieSlice {
+	return u.ExpenseTreemap(period).Pie()
+}
+
+// ExpenseTreemap breaks the user's spending in period down, see
+// User.ExpenseTreemap.
+func (s *FinanceService) ExpenseTreemap(ctx context.Context, userID string, period Period) (TreemapNode, error) {
+	user, err := s.readUserFor(ctx, userID, period)
+	if err != nil {
+		return TreemapNode{}, err
+	}
+	return user.ExpenseTreemap(period), nil
+}
+
+// ExpensePie returns the shares of the user's spending in period covered
+// by each category.
+func (s *FinanceService) ExpensePie(ctx context.Context, userID string, period Period) ([]PieSlice, error) {
+	treemap, err := s.ExpenseTreemap(ctx, userID, period)
+	if err != nil {
+		return nil, err
+	}
+	return treemap.Pie(), nil
+}
@@ -0,0 +1,192 @@
+// Package fixtures builds arus users, transactions and services for tests.
+//
+//	user := fixtures.NewTestUser().
+//		WithRules(fixtures.Rule(arus.Expense, "0.5"), fixtures.Rule(arus.Savings, "0.5")).
+//		WithIncomes(fixtures.Income("1000", fixtures.Date(2024, 1, 1))).
+//		WithExpenses(fixtures.Expense("200", fixtures.Date(2024, 1, 5))).
+//		MustBuild(t)
+package fixtures
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dnswd/arus"
+	"github.com/shopspring/decimal"
+)
+
+// Epoch is the default time of fixture clocks.
+var Epoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Currency used by fixture amounts unless given explicitly
+const DefaultCurrency = "USD"
+
+// Date returns midnight UTC of the given day.
+func Date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// Money parses amount, e.g. "12.50", panicking on malformed input.
+func Money(amount, currency string) arus.Money {
+	return arus.NewMoney(decimal.RequireFromString(amount), currency)
+}
+
+// USD is Money in US dollars.
+func USD(amount string) arus.Money {
+	return Money(amount, "USD")
+}
+
+// Rule allocates percentage (e.g. "0.2") of each income to category.
+func Rule(category arus.CategoryType, percentage string) arus.AllocationRule {
+	return arus.AllocationRule{CategoryType: category, Percentage: decimal.RequireFromString(percentage)}
+}
+
+// Income is an income of amount in DefaultCurrency.
+func Income(amount string, date time.Time) arus.Transaction {
+	return arus.NewIncome(Money(amount, DefaultCurrency), date, "Income")
+}
+
+// Expense is an expense of amount in DefaultCurrency, recorded as negative
+// like arus.NewExpense does.
+func Expense(amount string, date time.Time, tags ...string) arus.Transaction {
+	expense := arus.NewExpense(Money(amount, DefaultCurrency), date, "Expense")
+	expense.Tags = tags
+	return expense
+}
+
+// SequentialIDs generates IDs "<prefix>-1", "<prefix>-2", ...
+type SequentialIDs struct {
+	Prefix string
+
+	mu   sync.Mutex
+	next int
+}
+
+func NewSequentialIDs(prefix string) *SequentialIDs {
+	return &SequentialIDs{Prefix: prefix}
+}
+
+func (g *SequentialIDs) NewID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.next++
+	return fmt.Sprintf("%s-%d", g.Prefix, g.next)
+}
+
+// DeterministicIDs makes arus generate sequential IDs for the rest of the
+// test and restores the previous generator afterwards. Tests using it must
+// not run in parallel.
+func DeterministicIDs(t testing.TB) *SequentialIDs {
+	t.Helper()
+
+	previous := arus.CurrentIDGenerator()
+	generator := NewSequentialIDs("id")
+	arus.SetIDGenerator(generator)
+	t.Cleanup(func() { arus.SetIDGenerator(previous) })
+	return generator
+}
+
+// Clock returns a fake clock set to Epoch.
+func Clock() *arus.FakeClock {
+	return arus.NewFakeClock(Epoch)
+}
+
+// UserBuilder builds a user step by step. Incomes are allocated and expenses
+// processed in the order they are added, exactly as the service would.
+type UserBuilder struct {
+	user  *arus.User
+	steps []func(user *arus.User) error
+}
+
+// NewTestUser starts a user with ID "test-user" and the default categories.
+func NewTestUser() *UserBuilder {
+	return &UserBuilder{user: arus.NewUser("test-user")}
+}
+
+func (b *UserBuilder) WithID(id string) *UserBuilder {
+	b.user.ID = id
+	return b
+}
+
+func (b *UserBuilder) WithRules(rules ...arus.AllocationRule) *UserBuilder {
+	b.user.AllocationRules = append(b.user.AllocationRules, rules...)
+	return b
+}
+
+// WithBalance credits amount to the category directly, without an income.
+func (b *UserBuilder) WithBalance(category arus.CategoryType, amount arus.Money) *UserBuilder {
+	b.steps = append(b.steps, func(user *arus.User) error {
+		c, exists := user.Categories[category]
+		if !exists {
+			return &arus.CategoryNotFoundError{Category: category}
+		}
+		return c.Credit(amount)
+	})
+	return b
+}
+
+// WithIncomes allocates each income by the user's rules.
+func (b *UserBuilder) WithIncomes(incomes ...arus.Transaction) *UserBuilder {
+	for _, income := range incomes {
+		b.steps = append(b.steps, func(user *arus.User) error {
+			return user.AllocateIncome(income.Amount, income.Date, income.Description)
+		})
+	}
+	return b
+}
+
+// WithExpenses processes each expense through the deduction cascade.
+func (b *UserBuilder) WithExpenses(expenses ...arus.Transaction) *UserBuilder {
+	for _, expense := range expenses {
+		b.steps = append(b.steps, func(user *arus.User) error {
+			return user.ProcessExpense(expense)
+		})
+	}
+	return b
+}
+
+func (b *UserBuilder) WithClassificationRules(rules ...arus.ClassificationRule) *UserBuilder {
+	b.user.ClassificationRules = append(b.user.ClassificationRules, rules...)
+	return b
+}
+
+// Build applies the queued steps and returns the user.
+func (b *UserBuilder) Build() (*arus.User, error) {
+	for i, step := range b.steps {
+		if err := step(b.user); err != nil {
+			return nil, fmt.Errorf("fixture step %d: %w", i+1, err)
+		}
+	}
+	b.steps = nil
+	return b.user, nil
+}
+
+// MustBuild is Build that fails the test on error.
+func (b *UserBuilder) MustBuild(t testing.TB) *arus.User {
+	t.Helper()
+
+	user, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// NewService returns a service backed by an in-memory repository holding
+// users, with a fake clock set to Epoch.
+func NewService(t testing.TB, users ...*arus.User) (*arus.FinanceService, *arus.FakeClock) {
+	t.Helper()
+
+	repo := arus.NewInMemoryUserRepository()
+	for _, user := range users {
+		if err := repo.Save(context.Background(), user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clock := Clock()
+	return &arus.FinanceService{UserRepo: repo, Clock: clock}, clock
+}
@@ -0,0 +1,175 @@
+package arus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Conversion records that a transaction changed currency: Original was
+// converted into the transaction's Amount at Rate, as when income arrives
+// in EUR and is allocated in USD, or a USD card pays in IDR. Original has
+// the same sign as the transaction's Amount.
+type Conversion struct {
+	Original Money
+	Rate     decimal.Decimal
+	// Market rate at the time of the conversion; zero when it was not known
+	MarketRate decimal.Decimal
+	// Realized gain over converting at MarketRate: positive when the
+	// conversion came out ahead, negative for a loss such as a bank's
+	// spread. Zero when the market rate was not known.
+	Gain Money
+}
+
+// NewConversion describes original converted into converted, against the
+// market rate when given.
+func NewConversion(original, converted Money, market *ExchangeRate) (Conversion, error) {
+	if original.Currency == converted.Currency {
+		return Conversion{}, fmt.Errorf("conversion from %s to itself", original.Currency)
+	}
+	if original.Amount.IsZero() {
+		return Conversion{}, errors.New("converted amount must not be zero")
+	}
+	conversion := Conversion{
+		Original: original,
+		Rate:     converted.Amount.Div(original.Amount).Abs(),
+		Gain:     NewMoneyZero(converted.Currency),
+	}
+	if market != nil {
+		atMarket, err := market.Convert(original)
+		if err != nil {
+			return Conversion{}, err
+		}
+		if atMarket.Currency != converted.Currency {
+			return Conversion{}, &CurrencyMismatchError{Expected: converted.Currency, Got: atMarket.Currency}
+		}
+		conversion.MarketRate = market.Rate
+		conversion.Gain = Money{Amount: converted.Amount.Sub(atMarket.Amount), Currency: converted.Currency}.Round()
+	}
+	return conversion, nil
+}
+
+// FXGainLoss is the net realized gain (negative for a loss) on the
+// currency conversions of transactions in period.
+func (u *User) FXGainLoss(period Period) Money {
+	return fxGainLoss(u.Currency(), u.Incomes, u.Expenses, period)
+}
+
+func fxGainLoss(currency string, incomes, expenses []Transaction, period Period) Money {
+	total := NewMoneyZero(currency)
+	for _, transactions := range [][]Transaction{incomes, expenses} {
+		for _, tx := range transactions {
+			if tx.FX != nil && tx.Counts() && period.Contains(tx.Date) {
+				total = total.Add(tx.FX.Gain)
+			}
+		}
+	}
+	return total
+}
+
+// marketRate looks up the rate on the day of date: from the historical
+// rates for past days when configured, and the current rates otherwise. It
+// returns nil when no rates are configured.
+func (s *FinanceService) marketRate(ctx context.Context, from, to string, date time.Time) (*ExchangeRate, error) {
+	if s.HistoricalRates != nil && rateDay(date).Before(rateDay(s.now())) {
+		rate, err := s.HistoricalRates.RateOn(ctx, from, to, date)
+		if err != nil {
+			return nil, err
+		}
+		return &rate, nil
+	}
+	if s.Rates == nil {
+		return nil, nil
+	}
+	rate, err := s.Rates.Rate(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return &rate, nil
+}
+
+// convert describes original converted into converted. A zero converted
+// amount means converting at the market rate, in currency.
+func (s *FinanceService) convert(ctx context.Context, original, converted Money, currency string) (Conversion, Money, error) {
+	if converted.Currency == "" {
+		converted.Currency = currency
+	}
+	market, err := s.marketRate(ctx, original.Currency, converted.Currency, s.now())
+	if err != nil {
+		return Conversion{}, Money{}, err
+	}
+	if converted.Amount.IsZero() {
+		if market == nil {
+			return Conversion{}, Money{}, errors.New("no exchange rates configured to convert " + original.Currency)
+		}
+		if converted, err = market.Convert(original); err != nil {
+			return Conversion{}, Money{}, err
+		}
+	}
+	conversion, err := NewConversion(original, converted, market)
+	if err != nil {
+		return Conversion{}, Money{}, err
+	}
+	return conversion, converted, nil
+}
+
+// AllocateConvertedIncome allocates income that arrived in another
+// currency: original is what was paid and converted what it became, e.g.
+// what the bank credited. A zero converted amount converts original into
+// the user's currency at the market rate. The conversion and its realized
+// gain or loss against the market rate are recorded on the income.
+func (s *FinanceService) AllocateConvertedIncome(ctx context.Context, userID string, original, converted Money) (err error) {
+	ctx, span := s.startSpan(ctx, "AllocateConvertedIncome", userID)
+	defer endSpan(span, &err)
+
+	if !original.Amount.IsPositive() {
+		return errors.New("income must be positive")
+	}
+	currency := converted.Currency
+	if currency == "" {
+		user, err := s.readUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+		currency = user.Currency()
+	}
+	// Rates are looked up before taking the user, as they may be fetched
+	// over the network
+	conversion, converted, err := s.convert(ctx, original, converted, currency)
+	if err != nil {
+		return err
+	}
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.loadIncomeBaseline(ctx, user, converted.Currency); err != nil {
+		return err
+	}
+	if err := s.quotaFor(userID).Check(QuotaTransactions, user.TransactionCount(), 1); err != nil {
+		return err
+	}
+	if err := user.AllocateIncome(converted, s.now(), ""); err != nil {
+		return err
+	}
+	user.Incomes[len(user.Incomes)-1].FX = &conversion
+
+	if err := s.save(ctx, user, "allocate_converted_income"); err != nil {
+		return err
+	}
+	recorded := user.Incomes[len(user.Incomes)-1]
+	s.log().InfoContext(ctx, "allocated converted income",
+		LogKeyUserID, userID, LogKeyTransactionID, recorded.ID,
+		"original", original.String(), "amount", recorded.Amount.String(), "fx_gain", conversion.Gain.String())
+	s.publishLedger(user, recorded)
+	s.Telemetry.Track(ctx, "allocation", "allocate_converted_income", userID, map[string]string{
+		"from": original.Currency, "to": converted.Currency,
+	})
+	return nil
+}
@@ -0,0 +1,394 @@
+package arus
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Complete monthly periods averaged to estimate monthly income for goals
+const goalIncomeLookback = 3
+
+// Goal is an amount to have in a category by a deadline, such as a house
+// deposit in Savings. Goals sharing a category are funded from its balance
+// in priority order.
+type Goal struct {
+	ID       string
+	Name     string
+	Category CategoryType
+	Target   Money
+	Deadline time.Time
+	// Lower numbers are funded first
+	Priority int
+	// When the goal was first fully funded; zero until then
+	ReachedAt time.Time
+}
+
+func (g Goal) Validate() error {
+	if g.Name == "" {
+		return errors.New("goal name is required")
+	}
+	if !g.Target.Amount.IsPositive() {
+		return errors.New("goal target must be positive")
+	}
+	if g.Deadline.IsZero() {
+		return errors.New("goal deadline is required")
+	}
+	return nil
+}
+
+// GoalProjection is where a goal stands and what it needs each month from
+// the next period until its deadline.
+type GoalProjection struct {
+	Goal    Goal
+	Balance Money
+	// Monthly contribution that reaches the target by the deadline
+	Needed Money
+	// Share of monthly income suggested for the goal
+	Percentage decimal.Decimal
+	// False when the suggested share falls short of Needed
+	OnTrack bool
+}
+
+func (p GoalProjection) Reached() bool {
+	return !p.Balance.Amount.LessThan(p.Goal.Target.Amount)
+}
+
+// AllocationSuggestion is a set of allocation rules that keeps the user's
+// goals on track, starting with the period From.
+type AllocationSuggestion struct {
+	From time.Time
+	// Estimated monthly income the percentages are based on
+	Income Money
+	Rules  []AllocationRule
+	Goals  []GoalProjection
+}
+
+// Changes reports whether the suggested rules differ from rules.
+func (s AllocationSuggestion) Changes(rules []AllocationRule) bool {
+	return !slices.EqualFunc(s.Rules, rules, func(a, b AllocationRule) bool {
+		return a.CategoryType == b.CategoryType && a.Percentage.Equal(b.Percentage)
+	})
+}
+
+// goalsByPriority returns the goals in the order they are funded: by
+// priority, then by deadline.
+func (u *User) goalsByPriority() []Goal {
+	goals := slices.Clone(u.Goals)
+	slices.SortStableFunc(goals, func(a, b Goal) int {
+		return cmp.Or(cmp.Compare(a.Priority, b.Priority), a.Deadline.Compare(b.Deadline))
+	})
+	return goals
+}
+
+// GoalBalances returns how much of each goal is funded: each category's
+// balance covers its goals in priority order.
+func (u *User) GoalBalances() map[string]Money {
+	available := make(map[CategoryType]Money)
+	balances := make(map[string]Money, len(u.Goals))
+	for _, goal := range u.goalsByPriority() {
+		left, seen := available[goal.Category]
+		if !seen {
+			left = NewMoneyZero(goal.Target.Currency)
+			if category, exists := u.Categories[goal.Category]; exists && category.Balance.Currency == goal.Target.Currency {
+				left = category.Balance
+			}
+		}
+		funded := left
+		if funded.Amount.GreaterThan(goal.Target.Amount) {
+			funded = goal.Target
+		}
+		if funded.IsNegative() {
+			funded = NewMoneyZero(goal.Target.Currency)
+		}
+		balances[goal.ID] = funded
+		available[goal.Category] = Money{Amount: left.Amount.Sub(funded.Amount), Currency: left.Currency}
+	}
+	return balances
+}
+
+// markReachedGoals stamps the goals fully funded for the first time and
+// returns them.
+func (u *User) markReachedGoals(now time.Time) []Goal {
+	if len(u.Goals) == 0 {
+		return nil
+	}
+	var reached []Goal
+	balances := u.GoalBalances()
+	for i := range u.Goals {
+		goal := &u.Goals[i]
+		if goal.ReachedAt.IsZero() && !balances[goal.ID].Amount.LessThan(goal.Target.Amount) {
+			goal.ReachedAt = now
+			reached = append(reached, *goal)
+		}
+	}
+	return reached
+}
+
+// monthlyIncome averages the income of the complete monthly periods before
+// the one containing now that had any.
+func (u *User) monthlyIncome(now time.Time) (Money, bool) {
+	currency := u.Currency()
+	total := NewMoneyZero(currency)
+	months := 0
+	period := u.MonthlyPeriodOf(now)
+	for range goalIncomeLookback {
+		period = period.Previous()
+		income := NewMoneyZero(currency)
+		for _, tx := range u.Incomes {
+			if period.Contains(tx.Date) && tx.Amount.Currency == currency && !isInterest(tx) {
+				income = income.Add(tx.Amount)
+			}
+		}
+		if income.Amount.IsPositive() {
+			total = total.Add(income)
+			months++
+		}
+	}
+	if months == 0 {
+		return Money{}, false
+	}
+	return Money{Amount: total.Amount.Div(decimal.NewFromInt(int64(months))), Currency: currency}, true
+}
+
+// SuggestAllocation works out allocation rules, from the period after the
+// one containing now, that fund every goal by its deadline out of the
+// user's average monthly income. Goals are funded in priority order; each
+// goal category gets at least its current share, and the other categories
+// give up what the goals need in proportion to their shares. Goals that no
+// longer fit are reported as off track.
+func (u *User) SuggestAllocation(now time.Time) (AllocationSuggestion, error) {
+	if len(u.Goals) == 0 {
+		return AllocationSuggestion{}, errors.New("user has no goals")
+	}
+	income, ok := u.monthlyIncome(now)
+	if !ok {
+		return AllocationSuggestion{}, errors.New("no income history to plan goals against")
+	}
+	from := u.MonthlyPeriodOf(now).Next()
+	suggestion := AllocationSuggestion{From: from.StartDate, Income: income}
+
+	one := decimal.NewFromInt(1)
+	room := one
+	shares := make(map[CategoryType]decimal.Decimal)
+	balances := u.GoalBalances()
+	for _, goal := range u.goalsByPriority() {
+		projection := GoalProjection{
+			Goal:       goal,
+			Balance:    balances[goal.ID],
+			Needed:     NewMoneyZero(goal.Target.Currency),
+			Percentage: decimal.Zero,
+			OnTrack:    true,
+		}
+		if !projection.Reached() {
+			months := 0
+			for period := from; period.StartDate.Before(goal.Deadline); period = period.Next() {
+				months++
+			}
+			remaining := goal.Target.Amount.Sub(projection.Balance.Amount)
+			if months == 0 || goal.Target.Currency != income.Currency {
+				projection.OnTrack = false
+			} else {
+				projection.Needed = Money{Amount: remaining.Div(decimal.NewFromInt(int64(months))), Currency: goal.Target.Currency}.Round()
+				projection.Percentage = projection.Needed.Amount.Div(income.Amount).RoundCeil(4)
+				if projection.Percentage.GreaterThan(room) {
+					projection.Percentage = room
+					projection.OnTrack = false
+				}
+			}
+		}
+		room = room.Sub(projection.Percentage)
+		shares[goal.Category] = shares[goal.Category].Add(projection.Percentage)
+		suggestion.Goals = append(suggestion.Goals, projection)
+	}
+
+	current := u.RulesAt(from.StartDate)
+	goalTotal, otherTotal := decimal.Zero, decimal.Zero
+	for _, rule := range current {
+		if share, isGoal := shares[rule.CategoryType]; isGoal {
+			shares[rule.CategoryType] = decimal.Max(share, rule.Percentage)
+		} else {
+			otherTotal = otherTotal.Add(rule.Percentage)
+		}
+	}
+	for _, share := range shares {
+		goalTotal = goalTotal.Add(share)
+	}
+	scale := one
+	if free := one.Sub(goalTotal); otherTotal.GreaterThan(free) {
+		scale = decimal.Max(free, decimal.Zero).Div(otherTotal)
+	}
+
+	added := make(map[CategoryType]bool)
+	for _, rule := range current {
+		percentage := rule.Percentage.Mul(scale).RoundFloor(4)
+		if share, isGoal := shares[rule.CategoryType]; isGoal {
+			percentage = share
+		}
+		added[rule.CategoryType] = true
+		suggestion.Rules = append(suggestion.Rules, AllocationRule{CategoryType: rule.CategoryType, Percentage: percentage})
+	}
+	for _, goal := range u.goalsByPriority() {
+		if !added[goal.Category] && shares[goal.Category].IsPositive() {
+			added[goal.Category] = true
+			suggestion.Rules = append(suggestion.Rules, AllocationRule{CategoryType: goal.Category, Percentage: shares[goal.Category]})
+		}
+	}
+	return suggestion, nil
+}
+
+func (u *User) goal(id string) (int, error) {
+	i := slices.IndexFunc(u.Goals, func(g Goal) bool { return g.ID == id })
+	if i < 0 {
+		return -1, fmt.Errorf("goal %s not found", id)
+	}
+	return i, nil
+}
+
+func (s *FinanceService) AddGoal(ctx context.Context, userID string, goal Goal) (Goal, error) {
+	if err := goal.Validate(); err != nil {
+		return Goal{}, err
+	}
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return Goal{}, err
+	}
+	if _, exists := user.Categories[goal.Category]; !exists {
+		return Goal{}, &CategoryNotFoundError{Category: goal.Category}
+	}
+	goal.ID = NewID()
+	goal.ReachedAt = time.Time{}
+	user.Goals = append(user.Goals, goal)
+
+	if err := s.save(ctx, user, "add_goal"); err != nil {
+		return Goal{}, err
+	}
+	s.Telemetry.Track(ctx, "goals", "add", userID, nil)
+	return goal, nil
+}
+
+func (s *FinanceService) RemoveGoal(ctx context.Context, userID, goalID string) error {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	i, err := user.goal(goalID)
+	if err != nil {
+		return err
+	}
+	user.Goals = slices.Delete(user.Goals, i, i+1)
+
+	return s.save(ctx, user, "remove_goal")
+}
+
+// SetAutoAdjustAllocation opts the user in or out of having the goal
+// allocation suggestion applied by AdjustAllocations.
+func (s *FinanceService) SetAutoAdjustAllocation(ctx context.Context, userID string, enabled bool) error {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	user.AutoAdjustAllocation = enabled
+
+	return s.save(ctx, user, "set_auto_adjust_allocation")
+}
+
+// loadIncomeHistory loads the user's transactions of the periods before
+// now's that SuggestAllocation averages income over.
+func (s *FinanceService) loadIncomeHistory(ctx context.Context, user *User, now time.Time) error {
+	period := user.MonthlyPeriodOf(now)
+	for range goalIncomeLookback {
+		period = period.Previous()
+	}
+	return s.loadSince(ctx, user, period.StartDate)
+}
+
+func (s *FinanceService) SuggestAllocation(ctx context.Context, userID string) (AllocationSuggestion, error) {
+	defer s.readLockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return AllocationSuggestion{}, err
+	}
+	now := s.now()
+	if err := s.loadIncomeHistory(ctx, user, now); err != nil {
+		return AllocationSuggestion{}, err
+	}
+	return user.SuggestAllocation(now)
+}
+
+// AdjustAllocation plans the user's goal allocation suggestion from the
+// next period and returns it, reporting whether it changed the rules.
+func (s *FinanceService) AdjustAllocation(ctx context.Context, userID string) (AllocationSuggestion, bool, error) {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return AllocationSuggestion{}, false, err
+	}
+	now := s.now()
+	if err := s.loadIncomeHistory(ctx, user, now); err != nil {
+		return AllocationSuggestion{}, false, err
+	}
+	suggestion, err := user.SuggestAllocation(now)
+	if err != nil || !suggestion.Changes(user.RulesAt(suggestion.From)) {
+		return suggestion, false, err
+	}
+	if err := user.PlanAllocationRules(suggestion.From, suggestion.Rules); err != nil {
+		return AllocationSuggestion{}, false, err
+	}
+
+	if err := s.save(ctx, user, "adjust_allocation"); err != nil {
+		return AllocationSuggestion{}, false, err
+	}
+	s.log().InfoContext(ctx, "adjusted allocation for goals", LogKeyUserID, userID, "from", suggestion.From)
+	s.Telemetry.Track(ctx, "goals", "adjust_allocation", userID, nil)
+	return suggestion, true, nil
+}
+
+// AdjustAllocations runs AdjustAllocation for every active user who opted
+// in, e.g. from a job at the end of each period. It returns how many users'
+// rules changed.
+func (s *FinanceService) AdjustAllocations(ctx context.Context) (int, error) {
+	iterator, ok := s.UserRepo.(UserIterator)
+	if !ok {
+		return 0, errors.New("repository does not support iterating users")
+	}
+
+	var userIDs []string
+	err := iterator.ForEach(ctx, func(user *User) error {
+		if user.AutoAdjustAllocation && len(user.Goals) > 0 && !user.Archived() {
+			userIDs = append(userIDs, user.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	adjusted := 0
+	var errs []error
+	for _, userID := range userIDs {
+		_, changed, err := s.AdjustAllocation(ctx, userID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("adjusting allocation for user %s: %w", userID, err))
+			continue
+		}
+		if changed {
+			adjusted++
+		}
+	}
+	return adjusted, errors.Join(errs...)
+}
@@ -0,0 +1,180 @@
+package graphql
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/dnswd/arus"
+	"github.com/dnswd/arus/openapi"
+)
+
+// AttachmentHandler moves attachment contents, which don't fit in GraphQL
+// responses, over plain HTTP next to the GraphQL endpoint:
+//
+//	POST   /users/{user}/transactions/{tx}/attachments        attach the request body
+//	GET    /users/{user}/transactions/{tx}/attachments/{id}   download an attachment
+//	DELETE /users/{user}/transactions/{tx}/attachments/{id}   remove an attachment
+//
+// Uploads take the file's type from the Content-Type header and its name
+// from the "name" query parameter. Attachment metadata is listed on the
+// Transaction type of the schema.
+//
+// UserID identifies the requesting user, typically from the authenticated
+// session; requests fail with 401 Unauthorized when it fails, and with 403
+// Forbidden when the path names another user.
+type AttachmentHandler struct {
+	Service *arus.FinanceService
+	UserID  func(r *http.Request) (string, error)
+
+	mux *http.ServeMux
+}
+
+func NewAttachmentHandler(service *arus.FinanceService, userID func(r *http.Request) (string, error)) *AttachmentHandler {
+	h := &AttachmentHandler{Service: service, UserID: userID, mux: http.NewServeMux()}
+	h.mux.HandleFunc("POST /users/{user}/transactions/{tx}/attachments", h.attach)
+	h.mux.HandleFunc("GET /users/{user}/transactions/{tx}/attachments/{id}", h.download)
+	h.mux.HandleFunc("DELETE /users/{user}/transactions/{tx}/attachments/{id}", h.remove)
+	return h
+}
+
+func (h *AttachmentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.UserID(r)
+	if err != nil || userID == "" {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+	h.mux.ServeHTTP(w, r.WithContext(withRequestUser(r.Context(), userID)))
+}
+
+// owner returns the user named by the request's path, refusing the request
+// when that is not the requesting user.
+func owner(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userID := r.PathValue("user")
+	if userID != requestUser(r.Context()) {
+		http.Error(w, "attachments of another user", http.StatusForbidden)
+		return "", false
+	}
+	return userID, true
+}
+
+// Describe adds the attachment routes to doc.
+func (h *AttachmentHandler) Describe(doc *openapi.Document, prefix string) {
+	tags := []string{"attachments"}
+	notFound := openapi.Response{Description: "No such user, transaction or attachment"}
+	unauthorized := openapi.Response{Description: "Not authenticated"}
+	forbidden := openapi.Response{Description: "The path names another user"}
+	binary := &openapi.Schema{Type: "string", Format: "binary"}
+	content := make(map[string]openapi.MediaType)
+	for _, contentType := range arus.AttachmentContentTypes {
+		content[contentType] = openapi.MediaType{Schema: binary}
+	}
+	path := prefix + "/users/{user}/transactions/{tx}/attachments"
+	doc.Add(http.MethodPost, path, openapi.Operation{
+		OperationID: "attachFile",
+		Summary:     "Attach the request body to a transaction",
+		Tags:        tags,
+		Parameters: []openapi.Parameter{
+			{Name: "name", In: "query", Description: "File name", Schema: &openapi.Schema{Type: "string"}},
+		},
+		RequestBody: &openapi.RequestBody{Required: true, Content: content},
+		Responses: map[string]openapi.Response{
+			"201": {Description: "The attachment", Content: doc.JSON(arus.Attachment{})},
+			"400": {Description: "Unsupported content type"},
+			"401": unauthorized,
+			"403": forbidden,
+			"404": notFound,
+			"413": {Description: "Attachment too large"},
+		},
+	})
+	doc.Add(http.MethodGet, path+"/{id}", openapi.Operation{
+		OperationID: "downloadAttachment",
+		Summary:     "Download an attachment",
+		Tags:        tags,
+		Responses: map[string]openapi.Response{
+			"200": {Description: "The attachment's content", Content: content},
+			"401": unauthorized,
+			"403": forbidden,
+			"404": notFound,
+		},
+	})
+	doc.Add(http.MethodDelete, path+"/{id}", openapi.Operation{
+		OperationID: "removeAttachment",
+		Summary:     "Remove an attachment",
+		Tags:        tags,
+		Responses: map[string]openapi.Response{
+			"204": {Description: "Removed"},
+			"401": unauthorized,
+			"403": forbidden,
+			"404": notFound,
+		},
+	})
+}
+
+func (h *AttachmentHandler) attach(w http.ResponseWriter, r *http.Request) {
+	userID, ok := owner(w, r)
+	if !ok {
+		return
+	}
+	body := http.MaxBytesReader(w, r.Body, arus.MaxAttachmentSize)
+	attachment, err := h.Service.AttachFile(r.Context(), userID, r.PathValue("tx"),
+		r.URL.Query().Get("name"), r.Header.Get("Content-Type"), body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "attachment too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(attachment)
+}
+
+func (h *AttachmentHandler) download(w http.ResponseWriter, r *http.Request) {
+	userID, ok := owner(w, r)
+	if !ok {
+		return
+	}
+	attachment, content, err := h.Service.OpenAttachment(r.Context(), userID, r.PathValue("tx"), r.PathValue("id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": attachment.Name}))
+	w.Header().Set("ETag", strconv.Quote(attachment.SHA256))
+	io.Copy(w, content)
+}
+
+func (h *AttachmentHandler) remove(w http.ResponseWriter, r *http.Request) {
+	userID, ok := owner(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Service.RemoveAttachment(r.Context(), userID, r.PathValue("tx"), r.PathValue("id")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, arus.ErrInvalidAttachment):
+		status = http.StatusBadRequest
+	case errors.Is(err, arus.ErrUserNotFound), errors.Is(err, arus.ErrTransactionNotFound),
+		errors.Is(err, arus.ErrAttachmentNotFound), errors.Is(err, arus.ErrBlobNotFound):
+		status = http.StatusNotFound
+	}
+	http.Error(w, err.Error(), status)
+}
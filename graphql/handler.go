@@ -0,0 +1,165 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/dnswd/arus"
+	"github.com/dnswd/arus/openapi"
+	gql "github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+// Largest request body the handler accepts
+const maxRequestBytes = 1 << 20
+
+type request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+// Handler serves GraphQL requests over HTTP: a JSON POST body or a GET query
+// string with query, operationName and variables. Mutations are only run
+// from POST requests, so links and prefetching cannot trigger them. An
+// Idempotency-Key header makes the request's mutations safe to retry.
+//
+// UserID identifies the requesting user, typically from the authenticated
+// session; requests fail with 401 Unauthorized when it fails. The schema
+// resolves the user field to that user and refuses operations on others.
+type Handler struct {
+	Schema gql.Schema
+	UserID func(r *http.Request) (string, error)
+}
+
+func NewHandler(schema gql.Schema, userID func(r *http.Request) (string, error)) *Handler {
+	return &Handler{Schema: schema, UserID: userID}
+}
+
+type requestUserKey struct{}
+
+func withRequestUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, requestUserKey{}, userID)
+}
+
+// requestUser returns the ID of the user making the request, empty when
+// the request did not come through a handler that identified them.
+func requestUser(ctx context.Context) string {
+	userID, _ := ctx.Value(requestUserKey{}).(string)
+	return userID
+}
+
+// Describe adds the GraphQL endpoint to doc at prefix. The schema itself is
+// better read by introspection than from OpenAPI.
+func (h *Handler) Describe(doc *openapi.Document, prefix string) {
+	if prefix == "" {
+		prefix = "/"
+	}
+	result := openapi.Response{Description: "The result of the operation", Content: doc.JSON(gql.Result{})}
+	doc.Add(http.MethodPost, prefix, openapi.Operation{
+		OperationID: "graphql",
+		Summary:     "Run a GraphQL operation",
+		Tags:        []string{"graphql"},
+		Parameters: []openapi.Parameter{{
+			Name:        arus.IdempotencyKeyHeader,
+			In:          "header",
+			Description: "Makes the operation's mutations safe to retry with the same key",
+			Schema:      &openapi.Schema{Type: "string"},
+		}},
+		RequestBody: &openapi.RequestBody{Required: true, Content: doc.JSON(request{})},
+		Responses: map[string]openapi.Response{
+			"200": result,
+			"400": {Description: "Malformed request"},
+			"401": {Description: "Not authenticated"},
+		},
+	})
+	doc.Add(http.MethodGet, prefix, openapi.Operation{
+		OperationID: "graphqlQuery",
+		Summary:     "Run a GraphQL query given in the query string",
+		Tags:        []string{"graphql"},
+		Parameters: []openapi.Parameter{
+			{Name: "query", In: "query", Required: true, Schema: &openapi.Schema{Type: "string"}},
+			{Name: "operationName", In: "query", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "variables", In: "query", Description: "JSON object of variables", Schema: &openapi.Schema{Type: "string"}},
+		},
+		Responses: map[string]openapi.Response{
+			"200": result,
+			"400": {Description: "Malformed variables"},
+			"401": {Description: "Not authenticated"},
+			"405": {Description: "The operation is a mutation, which must be sent with POST"},
+		},
+	})
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.UserID(r)
+	if err != nil || userID == "" {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	var req request
+	switch r.Method {
+	case http.MethodGet:
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if variables := r.URL.Query().Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				http.Error(w, "invalid variables", http.StatusBadRequest)
+				return
+			}
+		}
+		if isMutation(req.Query, req.OperationName) {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "mutations must be sent with POST", http.StatusMethodNotAllowed)
+			return
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes)).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := withRequestUser(r.Context(), userID)
+	if key := r.Header.Get(arus.IdempotencyKeyHeader); key != "" {
+		ctx = arus.WithIdempotencyKey(ctx, key)
+	}
+	result := gql.Do(gql.Params{
+		Schema:         h.Schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        ctx,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// isMutation reports whether the document's operation to run is a
+// mutation. Without an operation name any mutation counts, as the document
+// may only hold one operation. Documents that do not parse are left for the
+// executor to reject.
+func isMutation(query, operationName string) bool {
+	document, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		return false
+	}
+	for _, definition := range document.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok || operation.Operation != ast.OperationTypeMutation {
+			continue
+		}
+		if operationName == "" || operation.Name != nil && operation.Name.Value == operationName {
+			return true
+		}
+	}
+	return false
+}
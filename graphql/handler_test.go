@@ -0,0 +1,141 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dnswd/arus"
+	"github.com/shopspring/decimal"
+)
+
+const allocateIncome = `mutation Allocate { allocateIncome(userId: "u1", amount: "100", currency: "USD") { id } }`
+
+// newTestHandler serves the schema over an in-memory repository holding
+// user "u1", who splits income evenly between Expense and Savings. Requests
+// are made by the user named in their X-User header.
+func newTestHandler(t *testing.T) (*Handler, arus.UserRepository) {
+	t.Helper()
+	repo := arus.NewInMemoryUserRepository()
+	user := arus.NewUser("u1")
+	user.AllocationRules = []arus.AllocationRule{
+		{CategoryType: arus.Expense, Percentage: decimal.NewFromFloat(0.5)},
+		{CategoryType: arus.Savings, Percentage: decimal.NewFromFloat(0.5)},
+	}
+	if err := repo.Save(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	service := &arus.FinanceService{
+		UserRepo:    repo,
+		Idempotency: arus.NewMemoryIdempotencyStore(time.Hour),
+	}
+	schema, err := NewSchema(service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewHandler(schema, func(r *http.Request) (string, error) {
+		if id := r.Header.Get("X-User"); id != "" {
+			return id, nil
+		}
+		return "", errors.New("not signed in")
+	}), repo
+}
+
+func TestHandler(t *testing.T) {
+	post := func(query string) string {
+		body, _ := json.Marshal(request{Query: query})
+		return string(body)
+	}
+	get := func(query, variables string) string {
+		values := url.Values{"query": {query}}
+		if variables != "" {
+			values.Set("variables", variables)
+		}
+		return "/?" + values.Encode()
+	}
+	tests := []struct {
+		name   string
+		user   string
+		method string
+		target string
+		body   string
+		want   int
+		// Text the response body must contain
+		wantBody string
+	}{
+		{name: "not signed in", method: http.MethodPost, target: "/", body: post(`{ user { id } }`), want: http.StatusUnauthorized},
+		{name: "query by POST", user: "u1", method: http.MethodPost, target: "/", body: post(`{ user { id } }`), want: http.StatusOK, wantBody: `"id":"u1"`},
+		{name: "query by GET", user: "u1", method: http.MethodGet, target: get(`{ user { id } }`, ""), want: http.StatusOK, wantBody: `"id":"u1"`},
+		{name: "GET variables", user: "u1", method: http.MethodGet, target: get(`query($id: ID!) { billCalendar(userId: $id) { from } }`, `{"id":"u1"}`), want: http.StatusOK, wantBody: `"billCalendar":{"from"`},
+		{name: "malformed GET variables", user: "u1", method: http.MethodGet, target: get(`{ user { id } }`, `{`), want: http.StatusBadRequest},
+		{name: "mutation by GET", user: "u1", method: http.MethodGet, target: get(allocateIncome, ""), want: http.StatusMethodNotAllowed},
+		{name: "mutation by POST", user: "u1", method: http.MethodPost, target: "/", body: post(allocateIncome), want: http.StatusOK, wantBody: `"allocateIncome":{"id":"u1"}`},
+		{name: "malformed POST body", user: "u1", method: http.MethodPost, target: "/", body: `{"query":`, want: http.StatusBadRequest},
+		{name: "other method", user: "u1", method: http.MethodPut, target: "/", body: post(`{ user { id } }`), want: http.StatusMethodNotAllowed},
+		{name: "another user's data", user: "u2", method: http.MethodPost, target: "/", body: post(allocateIncome), want: http.StatusOK, wantBody: errNotRequestUser.Error()},
+		{name: "unknown user", user: "u2", method: http.MethodPost, target: "/", body: post(`{ user { id } }`), want: http.StatusOK, wantBody: `"user":null`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandler(t)
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.user != "" {
+				req.Header.Set("X-User", tt.user)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("%s %s = %d %s, want %d", tt.method, tt.target, rec.Code, rec.Body, tt.want)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("response %s, want it to contain %s", rec.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestHandlerIdempotencyKey(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+		// Incomes allocated after every request is made
+		want int
+	}{
+		{"without a key", []string{"", ""}, 2},
+		{"retried with one key", []string{"k1", "k1"}, 1},
+		{"with two keys", []string{"k1", "k2"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, repo := newTestHandler(t)
+			for _, key := range tt.keys {
+				body, _ := json.Marshal(request{Query: allocateIncome})
+				req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(body)))
+				req.Header.Set("X-User", "u1")
+				if key != "" {
+					req.Header.Set(arus.IdempotencyKeyHeader, key)
+				}
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, req)
+				if strings.Contains(rec.Body.String(), `"errors"`) {
+					t.Fatalf("allocating income: %s", rec.Body)
+				}
+			}
+
+			user, err := repo.GetByID(context.Background(), "u1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(user.Incomes); got != tt.want {
+				t.Errorf("allocated %d incomes, want %d", got, tt.want)
+			}
+		})
+	}
+}
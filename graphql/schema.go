@@ -0,0 +1,888 @@
+// Package graphql exposes users, categories, transactions, period summaries
+// and Sankey flows to dashboard clients over a GraphQL schema, which also
+// takes incomes and statement imports, and the contents of transaction
+// attachments over plain HTTP.
+package graphql
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dnswd/arus"
+	gql "github.com/graphql-go/graphql"
+	"github.com/shopspring/decimal"
+)
+
+// Page size used when a connection field is queried without "first"
+const DefaultPageSize = 50
+
+var moneyType = gql.NewObject(gql.ObjectConfig{
+	Name: "Money",
+	Fields: gql.Fields{
+		"amount": &gql.Field{
+			Type:        gql.NewNonNull(gql.String),
+			Description: "Decimal amount, kept as a string to avoid float rounding",
+			Resolve: func(p gql.ResolveParams) (any, error) {
+				return p.Source.(arus.Money).StringFixed(), nil
+			},
+		},
+		"currency": &gql.Field{Type: gql.NewNonNull(gql.String)},
+		"formatted": &gql.Field{
+			Type: gql.NewNonNull(gql.String),
+			Args: gql.FieldConfigArgument{
+				"locale": &gql.ArgumentConfig{Type: gql.String, Description: `BCP 47 tag such as "id-ID"`},
+			},
+			Resolve: func(p gql.ResolveParams) (any, error) {
+				locale := arus.LocaleEnUS
+				if tag, ok := p.Args["locale"].(string); ok {
+					found, exists := arus.LookupLocale(tag)
+					if !exists {
+						return nil, errors.New("unknown locale " + tag)
+					}
+					locale = found
+				}
+				return p.Source.(arus.Money).Format(locale), nil
+			},
+		},
+	},
+})
+
+var periodType = gql.NewObject(gql.ObjectConfig{
+	Name: "Period",
+	Fields: gql.Fields{
+		"startDate": &gql.Field{Type: gql.NewNonNull(gql.DateTime)},
+		"endDate":   &gql.Field{Type: gql.NewNonNull(gql.DateTime)},
+	},
+})
+
+// categoryField resolves a CategoryType field of the source to its code.
+func categoryField(get func(source any) arus.CategoryType) *gql.Field {
+	return &gql.Field{
+		Type: gql.NewNonNull(gql.String),
+		Resolve: func(p gql.ResolveParams) (any, error) {
+			return get(p.Source).Code(), nil
+		},
+	}
+}
+
+var bankAccountType = gql.NewObject(gql.ObjectConfig{
+	Name: "BankAccount",
+	Fields: gql.Fields{
+		"accountNumber": &gql.Field{
+			Type:        gql.NewNonNull(gql.String),
+			Description: "Masked to the last four digits",
+			Resolve: func(p gql.ResolveParams) (any, error) {
+				return p.Source.(arus.BankAccount).Masked(), nil
+			},
+		},
+		"bankName": &gql.Field{Type: gql.NewNonNull(gql.String)},
+		"type": &gql.Field{
+			Type:        gql.NewNonNull(gql.String),
+			Description: "Account type code, detected from the bank name when not set",
+			Resolve: func(p gql.ResolveParams) (any, error) {
+				return arus.DetectAccountType(p.Source.(arus.BankAccount)).Code(), nil
+			},
+		},
+	},
+})
+
+var categoryAccountType = gql.NewObject(gql.ObjectConfig{
+	Name: "CategoryAccount",
+	Fields: gql.Fields{
+		"bankAccount": &gql.Field{Type: gql.NewNonNull(bankAccountType)},
+		"balance":     &gql.Field{Type: gql.NewNonNull(moneyType)},
+	},
+})
+
+var categoryType = gql.NewObject(gql.ObjectConfig{
+	Name: "Category",
+	Fields: gql.Fields{
+		"type":     categoryField(func(source any) arus.CategoryType { return source.(*arus.Category).Type }),
+		"balance":  &gql.Field{Type: gql.NewNonNull(moneyType)},
+		"accounts": &gql.Field{Type: gql.NewList(gql.NewNonNull(categoryAccountType))},
+	},
+})
+
+var allocationType = gql.NewObject(gql.ObjectConfig{
+	Name: "Allocation",
+	Fields: gql.Fields{
+		"category": categoryField(func(source any) arus.CategoryType { return source.(arus.Allocation).Category }),
+		"amount":   &gql.Field{Type: gql.NewNonNull(moneyType)},
+		"windfall": &gql.Field{Type: gql.NewNonNull(gql.Boolean)},
+	},
+})
+
+var deductionType = gql.NewObject(gql.ObjectConfig{
+	Name: "Deduction",
+	Fields: gql.Fields{
+		"category": categoryField(func(source any) arus.CategoryType { return source.(arus.Deduction).Category }),
+		"amount":   &gql.Field{Type: gql.NewNonNull(moneyType)},
+	},
+})
+
+var attachmentType = gql.NewObject(gql.ObjectConfig{
+	Name: "Attachment",
+	Fields: gql.Fields{
+		"id":          &gql.Field{Type: gql.NewNonNull(gql.ID)},
+		"name":        &gql.Field{Type: gql.NewNonNull(gql.String)},
+		"contentType": &gql.Field{Type: gql.NewNonNull(gql.String)},
+		"size":        &gql.Field{Type: gql.NewNonNull(gql.Int), Description: "Size in bytes"},
+		"uploadedAt":  &gql.Field{Type: gql.NewNonNull(gql.DateTime)},
+	},
+})
+
+var queuedStatementType = gql.NewObject(gql.ObjectConfig{
+	Name: "QueuedStatement",
+	Fields: gql.Fields{
+		"id":   &gql.Field{Type: gql.NewNonNull(gql.ID)},
+		"name": &gql.Field{Type: gql.NewNonNull(gql.String)},
+		"bankName": &gql.Field{
+			Type: gql.NewNonNull(gql.String),
+			Resolve: func(p gql.ResolveParams) (any, error) {
+				return p.Source.(arus.QueuedStatement).BankAccount.BankName, nil
+			},
+		},
+		"account": &gql.Field{
+			Type:        gql.NewNonNull(gql.String),
+			Description: "Masked number of the account the statement will be imported into",
+			Resolve: func(p gql.ResolveParams) (any, error) {
+				return p.Source.(arus.QueuedStatement).BankAccount.Masked(), nil
+			},
+		},
+		"from":       &gql.Field{Type: gql.NewNonNull(gql.String)},
+		"subject":    &gql.Field{Type: gql.String},
+		"receivedAt": &gql.Field{Type: gql.NewNonNull(gql.DateTime)},
+	},
+})
+
+var upcomingBillType = gql.NewObject(gql.ObjectConfig{
+	Name: "UpcomingBill",
+	Fields: gql.Fields{
+		"billId":  &gql.Field{Type: gql.NewNonNull(gql.ID)},
+		"name":    &gql.Field{Type: gql.NewNonNull(gql.String)},
+		"amount":  &gql.Field{Type: gql.NewNonNull(moneyType)},
+		"due":     &gql.Field{Type: gql.NewNonNull(gql.DateTime)},
+		"autopay": &gql.Field{Type: gql.NewNonNull(gql.Boolean)},
+	},
+})
+
+var billCalendarType = gql.NewObject(gql.ObjectConfig{
+	Name: "BillCalendar",
+	Fields: gql.Fields{
+		"from":  &gql.Field{Type: gql.NewNonNull(gql.DateTime)},
+		"until": &gql.Field{Type: gql.NewNonNull(gql.DateTime)},
+		"bills": &gql.Field{
+			Type:        gql.NewList(gql.NewNonNull(upcomingBillType)),
+			Description: "Bills by due date, unpaid ones from before the calendar first",
+		},
+		"totals": &gql.Field{Type: gql.NewList(gql.NewNonNull(moneyType))},
+		"shortfalls": &gql.Field{
+			Type:        gql.NewList(gql.NewNonNull(moneyType)),
+			Description: "How far the totals exceed what the Expense category can spend",
+		},
+		"uncovered": &gql.Field{
+			Type:        gql.NewList(gql.NewNonNull(upcomingBillType)),
+			Description: "Bills falling due once the Expense balance has run out",
+		},
+		"covered": &gql.Field{
+			Type: gql.NewNonNull(gql.Boolean),
+			Resolve: func(p gql.ResolveParams) (any, error) {
+				return p.Source.(arus.BillCalendar).Covered(), nil
+			},
+		},
+	},
+})
+
+var expenseShareType = gql.NewObject(gql.ObjectConfig{
+	Name: "ExpenseShare",
+	Fields: gql.Fields{
+		"with":   &gql.Field{Type: gql.NewNonNull(gql.String)},
+		"amount": &gql.Field{Type: gql.NewNonNull(moneyType)},
+	},
+})
+
+var reimbursementType = gql.NewObject(gql.ObjectConfig{
+	Name: "Reimbursement",
+	Fields: gql.Fields{
+		"from": &gql.Field{Type: gql.NewNonNull(gql.String)},
+		"status": &gql.Field{
+			Type:        gql.NewNonNull(gql.String),
+			Description: "reimbursable, submitted, approved or paid",
+			Resolve: func(p gql.ResolveParams) (any, error) {
+				return p.Source.(*arus.Reimbursement).Status.Code(), nil
+			},
+		},
+		"updated": &gql.Field{Type: gql.NewNonNull(gql.DateTime)},
+		"paymentId": &gql.Field{
+			Type: gql.ID,
+			Resolve: func(p gql.ResolveParams) (any, error) {
+				if id := p.Source.(*arus.Reimbursement).PaymentID; id != "" {
+					return id, nil
+				}
+				return nil, nil
+			},
+		},
+	},
+})
+
+var transactionType = gql.NewObject(gql.ObjectConfig{
+	Name: "Transaction",
+	Fields: gql.Fields{
+		"id":          &gql.Field{Type: gql.NewNonNull(gql.ID)},
+		"amount":      &gql.Field{Type: gql.NewNonNull(moneyType)},
+		"date":        &gql.Field{Type: gql.NewNonNull(gql.DateTime)},
+		"description": &gql.Field{Type: gql.NewNonNull(gql.String)},
+		"merchant":    &gql.Field{Type: gql.String},
+		"notes":       &gql.Field{Type: gql.String},
+		"tags":        &gql.Field{Type: gql.NewList(gql.NewNonNull(gql.String))},
+		"source": &gql.Field{
+			Type:        gql.String,
+			Description: "Income source code, such as employer or rental; null when not known",
+			Resolve: func(p gql.ResolveParams) (any, error) {
+				if source := p.Source.(arus.Transaction).Source; source != arus.UnspecifiedSource {
+					return source.Code(), nil
+				}
+				return nil, nil
+			},
+		},
+		"allocations": &gql.Field{Type: gql.NewList(gql.NewNonNull(allocationType))},
+		"deductions":  &gql.Field{Type: gql.NewList(gql.NewNonNull(deductionType))},
+		"shares": &gql.Field{
+			Type:        gql.NewList(gql.NewNonNull(expenseShareType)),
+			Description: "For shared expenses, the parts others owe",
+		},
+		"refundOf": &gql.Field{
+			Type:        gql.ID,
+			Description: "For refunds, the expense they give money back for",
+			Resolve: func(p gql.ResolveParams) (any, error) {
+				if id := p.Source.(arus.Transaction).RefundOf; id != "" {
+					return id, nil
+				}
+				return nil, nil
+			},
+		},
+		"reimbursement": &gql.Field{
+			Type:        reimbursementType,
+			Description: "For business expenses someone else pays back, the claim for them",
+		},
+		"attachments": &gql.Field{
+			Type:        gql.NewList(gql.NewNonNull(attachmentType)),
+			Description: "Files kept with the transaction; contents are served by AttachmentHandler",
+		},
+	},
+})
+
+var transactionConnectionType = gql.NewObject(gql.ObjectConfig{
+	Name: "TransactionConnection",
+	Fields: gql.Fields{
+		"nodes": &gql.Field{
+			Type: gql.NewList(gql.NewNonNull(transactionType)),
+			Resolve: func(p gql.ResolveParams) (any, error) {
+				return p.Source.(arus.TransactionPage).Transactions, nil
+			},
+		},
+		"nextCursor": &gql.Field{
+			Type:        gql.String,
+			Description: "Pass as \"after\" to fetch the next page; null on the last page",
+			Resolve: func(p gql.ResolveParams) (any, error) {
+				if next := p.Source.(arus.TransactionPage).NextCursor; next != "" {
+					return next, nil
+				}
+				return nil, nil
+			},
+		},
+		"totalCount": &gql.Field{Type: gql.NewNonNull(gql.Int)},
+	},
+})
+
+// incomeSourceTotal is one entry of PeriodSummary.IncomeBySource.
+type incomeSourceTotal struct {
+	Source arus.IncomeSource
+	Amount arus.Money
+}
+
+var incomeSourceTotalType = gql.NewObject(gql.ObjectConfig{
+	Name: "IncomeSourceTotal",
+	Fields: gql.Fields{
+		"source": &gql.Field{
+			Type: gql.NewNonNull(gql.String),
+			Resolve: func(p gql.ResolveParams) (any, error) {
+				return p.Source.(incomeSourceTotal).Source.Code(), nil
+			},
+		},
+		"amount": &gql.Field{Type: gql.NewNonNull(moneyType)},
+	},
+})
+
+var periodSummaryType = gql.NewObject(gql.ObjectConfig{
+	Name: "PeriodSummary",
+	Fields: gql.Fields{
+		"period":             &gql.Field{Type: gql.NewNonNull(periodType)},
+		"totalIncome":        &gql.Field{Type: gql.NewNonNull(moneyType)},
+		"totalExpense":       &gql.Field{Type: gql.NewNonNull(moneyType)},
+		"net":                &gql.Field{Type: gql.NewNonNull(moneyType)},
+		"roundingDifference": &gql.Field{Type: gql.NewNonNull(moneyType)},
+		"fxGainLoss": &gql.Field{
+			Type:        gql.NewNonNull(moneyType),
+			Description: "Net realized gain on currency conversions; negative for a loss",
+		},
+		"deductions": &gql.Field{
+			Type:        gql.NewList(gql.NewNonNull(deductionType)),
+			Description: "How much each category covered of the period's expenses",
+			Resolve: func(p gql.ResolveParams) (any, error) {
+				totals := p.Source.(arus.PeriodSummary).Deductions
+				deductions := make([]arus.Deduction, 0, len(totals))
+				for category, amount := range totals {
+					deductions = append(deductions, arus.Deduction{Category: category, Amount: amount})
+				}
+				sort.Slice(deductions, func(i, j int) bool { return deductions[i].Category < deductions[j].Category })
+				return deductions, nil
+			},
+		},
+		"incomeBySource": &gql.Field{
+			Type:        gql.NewList(gql.NewNonNull(incomeSourceTotalType)),
+			Description: "Income totals by source; incomes without a source are left out",
+			Resolve: func(p gql.ResolveParams) (any, error) {
+				totals := p.Source.(arus.PeriodSummary).IncomeBySource
+				bySource := make([]incomeSourceTotal, 0, len(totals))
+				for source, amount := range totals {
+					bySource = append(bySource, incomeSourceTotal{Source: source, Amount: amount})
+				}
+				sort.Slice(bySource, func(i, j int) bool { return bySource[i].Source < bySource[j].Source })
+				return bySource, nil
+			},
+		},
+	},
+})
+
+var sankeyFlowType = gql.NewObject(gql.ObjectConfig{
+	Name: "SankeyFlow",
+	Fields: gql.Fields{
+		"source": &gql.Field{Type: gql.NewNonNull(gql.String)},
+		"target": &gql.Field{Type: gql.NewNonNull(gql.String)},
+		"value":  &gql.Field{Type: gql.NewNonNull(moneyType)},
+	},
+})
+
+// Arguments selecting one of the user's months, in their time zone and
+// fiscal month scheme
+var monthArgs = gql.FieldConfigArgument{
+	"year":  &gql.ArgumentConfig{Type: gql.NewNonNull(gql.Int)},
+	"month": &gql.ArgumentConfig{Type: gql.NewNonNull(gql.Int)},
+}
+
+func monthOf(user *arus.User, args map[string]any) (arus.Period, error) {
+	month := args["month"].(int)
+	if month < 1 || month > 12 {
+		return arus.Period{}, errors.New("month must be between 1 and 12")
+	}
+	return user.MonthlyPeriod(args["year"].(int), time.Month(month)), nil
+}
+
+// transactionsField pages through the user's incomes or expenses,
+// optionally limited to one month.
+func transactionsField(service *arus.FinanceService, kind arus.TransactionKind) *gql.Field {
+	return &gql.Field{
+		Type: gql.NewNonNull(transactionConnectionType),
+		Args: gql.FieldConfigArgument{
+			"first": &gql.ArgumentConfig{Type: gql.Int, DefaultValue: DefaultPageSize},
+			"after": &gql.ArgumentConfig{Type: gql.String},
+			"year":  &gql.ArgumentConfig{Type: gql.Int},
+			"month": &gql.ArgumentConfig{Type: gql.Int},
+		},
+		Resolve: func(p gql.ResolveParams) (any, error) {
+			user := p.Source.(*arus.User)
+			query := arus.TransactionQuery{Limit: p.Args["first"].(int)}
+			query.Cursor, _ = p.Args["after"].(string)
+
+			if _, ok := p.Args["year"]; ok {
+				if _, ok := p.Args["month"]; !ok {
+					return nil, errors.New("year and month must be given together")
+				}
+				period, err := monthOf(user, p.Args)
+				if err != nil {
+					return nil, err
+				}
+				query.Period = &period
+			}
+			return service.QueryTransactions(p.Context, user.ID, kind, query)
+		},
+	}
+}
+
+// Arguments of the transactions query
+var transactionQueryArgs = gql.FieldConfigArgument{
+	"userId":     &gql.ArgumentConfig{Type: gql.NewNonNull(gql.ID)},
+	"kind":       &gql.ArgumentConfig{Type: gql.String, DefaultValue: string(arus.TransactionExpense), Description: "income or expense"},
+	"first":      &gql.ArgumentConfig{Type: gql.Int, DefaultValue: DefaultPageSize},
+	"after":      &gql.ArgumentConfig{Type: gql.String},
+	"year":       &gql.ArgumentConfig{Type: gql.Int},
+	"month":      &gql.ArgumentConfig{Type: gql.Int},
+	"category":   &gql.ArgumentConfig{Type: gql.String, Description: "Category code the transactions touched"},
+	"tag":        &gql.ArgumentConfig{Type: gql.String},
+	"bank":       &gql.ArgumentConfig{Type: gql.String, Description: "Name of the bank the transactions were imported from"},
+	"minAmount":  &gql.ArgumentConfig{Type: gql.String, Description: "Least size of the amount, inclusive"},
+	"maxAmount":  &gql.ArgumentConfig{Type: gql.String, Description: "Greatest size of the amount, inclusive"},
+	"sort":       &gql.ArgumentConfig{Type: gql.String, DefaultValue: arus.SortByDate.Code(), Description: "date or amount"},
+	"descending": &gql.ArgumentConfig{Type: gql.Boolean, DefaultValue: false},
+}
+
+// transactionQueryOf reads a TransactionQuery from the arguments.
+func transactionQueryOf(user *arus.User, args map[string]any) (arus.TransactionQuery, error) {
+	query := arus.TransactionQuery{
+		Sort:       arus.ParseTransactionSort(args["sort"].(string)),
+		Descending: args["descending"].(bool),
+		Limit:      args["first"].(int),
+	}
+	query.Cursor, _ = args["after"].(string)
+	query.Tag, _ = args["tag"].(string)
+	query.Bank, _ = args["bank"].(string)
+
+	_, hasYear := args["year"]
+	_, hasMonth := args["month"]
+	if hasYear != hasMonth {
+		return arus.TransactionQuery{}, errors.New("year and month must be given together")
+	}
+	if hasYear {
+		period, err := monthOf(user, args)
+		if err != nil {
+			return arus.TransactionQuery{}, err
+		}
+		query.Period = &period
+	}
+	if code, ok := args["category"].(string); ok {
+		category := arus.ParseCategoryType(code)
+		if category == arus.UnknownCategory {
+			return arus.TransactionQuery{}, errors.New("unknown category " + code)
+		}
+		query.Category = &category
+	}
+	for name, bound := range map[string]**decimal.Decimal{"minAmount": &query.MinAmount, "maxAmount": &query.MaxAmount} {
+		text, ok := args[name].(string)
+		if !ok {
+			continue
+		}
+		amount, err := decimal.NewFromString(text)
+		if err != nil {
+			return arus.TransactionQuery{}, errors.New("invalid " + name)
+		}
+		*bound = &amount
+	}
+	return query, nil
+}
+
+// newUserType returns the User type, whose history and reports are read
+// through service.
+func newUserType(service *arus.FinanceService) *gql.Object {
+	return gql.NewObject(gql.ObjectConfig{
+		Name: "User",
+		Fields: gql.Fields{
+			"id":       &gql.Field{Type: gql.NewNonNull(gql.ID)},
+			"country":  &gql.Field{Type: gql.String},
+			"timezone": &gql.Field{Type: gql.String},
+			"categories": &gql.Field{
+				Type: gql.NewList(gql.NewNonNull(categoryType)),
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					user := p.Source.(*arus.User)
+					categories := make([]*arus.Category, 0, len(user.Categories))
+					for _, category := range user.Categories {
+						categories = append(categories, category)
+					}
+					sort.Slice(categories, func(i, j int) bool { return categories[i].Type < categories[j].Type })
+					return categories, nil
+				},
+			},
+			"incomes":  transactionsField(service, arus.TransactionIncome),
+			"expenses": transactionsField(service, arus.TransactionExpense),
+			"queuedStatements": &gql.Field{
+				Type:        gql.NewList(gql.NewNonNull(queuedStatementType)),
+				Description: "Statements received by email waiting to be imported",
+			},
+			"summary": &gql.Field{
+				Type: gql.NewNonNull(periodSummaryType),
+				Args: monthArgs,
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					user := p.Source.(*arus.User)
+					period, err := monthOf(user, p.Args)
+					if err != nil {
+						return nil, err
+					}
+					return service.GetPeriodSummary(p.Context, user.ID, period)
+				},
+			},
+			"sankeyFlows": &gql.Field{
+				Type: gql.NewList(gql.NewNonNull(sankeyFlowType)),
+				Args: monthArgs,
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					user := p.Source.(*arus.User)
+					period, err := monthOf(user, p.Args)
+					if err != nil {
+						return nil, err
+					}
+					return service.SankeyFlows(p.Context, user.ID, period)
+				},
+			},
+			"sankeyChart": &gql.Field{
+				Type:        gql.NewNonNull(gql.String),
+				Description: "The month's Sankey flows rendered as d3, plotly or mermaid.",
+				Args: gql.FieldConfigArgument{
+					"year":   monthArgs["year"],
+					"month":  monthArgs["month"],
+					"format": &gql.ArgumentConfig{Type: gql.NewNonNull(gql.String)},
+				},
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					user := p.Source.(*arus.User)
+					period, err := monthOf(user, p.Args)
+					if err != nil {
+						return nil, err
+					}
+					flows, err := service.SankeyFlows(p.Context, user.ID, period)
+					if err != nil {
+						return nil, err
+					}
+					var b strings.Builder
+					if err := arus.RenderSankey(&b, flows, arus.SankeyFormat(p.Args["format"].(string))); err != nil {
+						return nil, err
+					}
+					return b.String(), nil
+				},
+			},
+		},
+	})
+}
+
+var importProgressType = gql.NewObject(gql.ObjectConfig{
+	Name: "ImportProgress",
+	Fields: gql.Fields{
+		"lines":   &gql.Field{Type: gql.NewNonNull(gql.Int)},
+		"applied": &gql.Field{Type: gql.NewNonNull(gql.Int)},
+		"skipped": &gql.Field{Type: gql.NewNonNull(gql.Int), Description: "Credit lines and duplicates"},
+		"batches": &gql.Field{Type: gql.NewNonNull(gql.Int)},
+	},
+})
+
+var incomePreviewType = gql.NewObject(gql.ObjectConfig{
+	Name: "IncomePreview",
+	Fields: gql.Fields{
+		"income":             &gql.Field{Type: gql.NewNonNull(moneyType)},
+		"allocations":        &gql.Field{Type: gql.NewList(gql.NewNonNull(allocationType))},
+		"unallocated":        &gql.Field{Type: gql.NewNonNull(moneyType)},
+		"roundingDifference": &gql.Field{Type: gql.NewNonNull(moneyType)},
+		"balances": &gql.Field{
+			Type:        gql.NewList(gql.NewNonNull(categoryType)),
+			Description: "Category balances right after the allocation",
+			Resolve: func(p gql.ResolveParams) (any, error) {
+				balances := p.Source.(arus.IncomePreview).Balances
+				categories := make([]*arus.Category, 0, len(balances))
+				for categoryType, balance := range balances {
+					categories = append(categories, &arus.Category{Type: categoryType, Balance: balance})
+				}
+				sort.Slice(categories, func(i, j int) bool { return categories[i].Type < categories[j].Type })
+				return categories, nil
+			},
+		},
+	},
+})
+
+// Arguments giving an amount of money
+var moneyArgs = gql.FieldConfigArgument{
+	"amount":   &gql.ArgumentConfig{Type: gql.NewNonNull(gql.String), Description: "Decimal amount"},
+	"currency": &gql.ArgumentConfig{Type: gql.NewNonNull(gql.String)},
+}
+
+// Arguments of the mutations moving a reimbursement claim along
+var reimbursementArgs = gql.FieldConfigArgument{
+	"userId":    &gql.ArgumentConfig{Type: gql.NewNonNull(gql.ID)},
+	"expenseId": &gql.ArgumentConfig{Type: gql.NewNonNull(gql.ID)},
+}
+
+func moneyOf(args map[string]any) (arus.Money, error) {
+	amount, err := decimal.NewFromString(args["amount"].(string))
+	if err != nil {
+		return arus.Money{}, errors.New("invalid amount")
+	}
+	return arus.NewMoney(amount, args["currency"].(string)), nil
+}
+
+// NewSchema builds the schema over the service's users. The user field and
+// the operations taking a userId are limited to the user Handler identified
+// as making the request. Mutations honor the idempotency key Handler takes
+// from the Idempotency-Key header.
+func NewSchema(service *arus.FinanceService) (gql.Schema, error) {
+	userType := newUserType(service)
+	query := gql.NewObject(gql.ObjectConfig{
+		Name: "Query",
+		Fields: requestUserOnly(gql.Fields{
+			"user": &gql.Field{
+				Type:        userType,
+				Description: "The user making the request.",
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					user, err := service.UserRepo.GetByID(p.Context, requestUser(p.Context))
+					if errors.Is(err, arus.ErrUserNotFound) {
+						return nil, nil
+					}
+					return user, err
+				},
+			},
+			"transactions": &gql.Field{
+				Type:        transactionConnectionType,
+				Description: "Page through a user's incomes or expenses, filtered and sorted by the transaction store; null when the user does not exist.",
+				Args:        transactionQueryArgs,
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					userID := p.Args["userId"].(string)
+					user, err := service.UserRepo.GetByID(p.Context, userID)
+					if errors.Is(err, arus.ErrUserNotFound) {
+						return nil, nil
+					}
+					if err != nil {
+						return nil, err
+					}
+					query, err := transactionQueryOf(user, p.Args)
+					if err != nil {
+						return nil, err
+					}
+					kind := arus.TransactionKind(p.Args["kind"].(string))
+					if kind != arus.TransactionIncome && kind != arus.TransactionExpense {
+						return nil, errors.New("kind must be income or expense")
+					}
+					return service.QueryTransactions(p.Context, userID, kind, query)
+				},
+			},
+			"allocationPreview": &gql.Field{
+				Type:        incomePreviewType,
+				Description: "What allocating an income now would credit to each category, without allocating it.",
+				Args: gql.FieldConfigArgument{
+					"userId":   &gql.ArgumentConfig{Type: gql.NewNonNull(gql.ID)},
+					"amount":   moneyArgs["amount"],
+					"currency": moneyArgs["currency"],
+				},
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					income, err := moneyOf(p.Args)
+					if err != nil {
+						return nil, err
+					}
+					return service.AllocateIncomePreview(p.Context, p.Args["userId"].(string), income)
+				},
+			},
+			"billCalendar": &gql.Field{
+				Type:        billCalendarType,
+				Description: "The user's bills falling due over the coming days, and whether the Expense category covers them.",
+				Args: gql.FieldConfigArgument{
+					"userId": &gql.ArgumentConfig{Type: gql.NewNonNull(gql.ID)},
+					"days":   &gql.ArgumentConfig{Type: gql.Int, DefaultValue: arus.DefaultBillHorizonDays},
+				},
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					return service.BillCalendar(p.Context, p.Args["userId"].(string), p.Args["days"].(int))
+				},
+			},
+		}),
+	})
+	mutation := gql.NewObject(gql.ObjectConfig{
+		Name: "Mutation",
+		Fields: requestUserOnly(gql.Fields{
+			"allocateIncome": &gql.Field{
+				Type:        userType,
+				Description: "Allocate an income across the user's categories by their rules.",
+				Args: gql.FieldConfigArgument{
+					"userId":   &gql.ArgumentConfig{Type: gql.NewNonNull(gql.ID)},
+					"amount":   moneyArgs["amount"],
+					"currency": moneyArgs["currency"],
+					"source":   &gql.ArgumentConfig{Type: gql.String, Description: "employer, client, rental, dividends or other"},
+				},
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					userID := p.Args["userId"].(string)
+					income, err := moneyOf(p.Args)
+					if err != nil {
+						return nil, err
+					}
+					source := arus.UnspecifiedSource
+					if code, ok := p.Args["source"].(string); ok {
+						source = arus.ParseIncomeSource(code)
+					}
+					if err := service.AllocateIncomeFrom(p.Context, userID, income, source); err != nil {
+						return nil, err
+					}
+					return service.UserRepo.GetByID(p.Context, userID)
+				},
+			},
+			"importStatement": &gql.Field{
+				Type:        gql.NewNonNull(importProgressType),
+				Description: "Import a CSV statement of a bank account with date, description and amount columns, or laid out as one of the user's import profiles says.",
+				Args: gql.FieldConfigArgument{
+					"userId":        &gql.ArgumentConfig{Type: gql.NewNonNull(gql.ID)},
+					"accountNumber": &gql.ArgumentConfig{Type: gql.NewNonNull(gql.String)},
+					"bankName":      &gql.ArgumentConfig{Type: gql.String},
+					"accountType":   &gql.ArgumentConfig{Type: gql.String, Description: "checking, savings, custodian or e-wallet"},
+					"statement":     &gql.ArgumentConfig{Type: gql.NewNonNull(gql.String)},
+					"locale":        &gql.ArgumentConfig{Type: gql.String, Description: `BCP 47 tag amounts are written in; the profile's or "en-US" by default`},
+					"profile":       &gql.ArgumentConfig{Type: gql.String, Description: "Name of the import profile to read the statement with; the bank's profile, if any, by default"},
+				},
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					userID := p.Args["userId"].(string)
+					bankName, _ := p.Args["bankName"].(string)
+					accountType, _ := p.Args["accountType"].(string)
+					account := arus.BankAccount{
+						AccountNumber: p.Args["accountNumber"].(string),
+						BankName:      bankName,
+						Type:          arus.ParseAccountType(accountType),
+					}
+
+					user, err := service.UserRepo.GetByID(p.Context, userID)
+					if err != nil {
+						return nil, err
+					}
+					profile, found := user.ImportProfileFor(bankName)
+					if name, ok := p.Args["profile"].(string); ok {
+						if profile, err = user.ImportProfile(name); err != nil {
+							return nil, err
+						}
+						found = true
+					}
+					statement := arus.NewCSVStatementReader(strings.NewReader(p.Args["statement"].(string)), arus.LocaleEnUS)
+					if found {
+						if statement, err = arus.NewCSVStatementReaderFor(strings.NewReader(p.Args["statement"].(string)), profile); err != nil {
+							return nil, err
+						}
+					}
+					if tag, ok := p.Args["locale"].(string); ok {
+						locale, exists := arus.LookupLocale(tag)
+						if !exists {
+							return nil, errors.New("unknown locale " + tag)
+						}
+						statement.Locale = locale
+					}
+					return arus.NewStatementImport(service).Run(p.Context, userID, account, statement)
+				},
+			},
+			"importQueuedStatement": &gql.Field{
+				Type:        gql.NewNonNull(importProgressType),
+				Description: "Import a statement received by email into the account it was matched to.",
+				Args: gql.FieldConfigArgument{
+					"userId": &gql.ArgumentConfig{Type: gql.NewNonNull(gql.ID)},
+					"id":     &gql.ArgumentConfig{Type: gql.NewNonNull(gql.ID)},
+				},
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					return service.ImportQueuedStatement(p.Context, p.Args["userId"].(string), p.Args["id"].(string))
+				},
+			},
+			"discardQueuedStatement": &gql.Field{
+				Type:        gql.NewNonNull(gql.Boolean),
+				Description: "Drop a statement received by email without importing it.",
+				Args: gql.FieldConfigArgument{
+					"userId": &gql.ArgumentConfig{Type: gql.NewNonNull(gql.ID)},
+					"id":     &gql.ArgumentConfig{Type: gql.NewNonNull(gql.ID)},
+				},
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					err := service.DiscardQueuedStatement(p.Context, p.Args["userId"].(string), p.Args["id"].(string))
+					return err == nil, err
+				},
+			},
+			"refundExpense": &gql.Field{
+				Type:        gql.NewNonNull(transactionType),
+				Description: "Credit a refund of an expense back to the categories that covered it.",
+				Args: gql.FieldConfigArgument{
+					"userId":      &gql.ArgumentConfig{Type: gql.NewNonNull(gql.ID)},
+					"expenseId":   &gql.ArgumentConfig{Type: gql.NewNonNull(gql.ID)},
+					"amount":      moneyArgs["amount"],
+					"currency":    moneyArgs["currency"],
+					"description": &gql.ArgumentConfig{Type: gql.String},
+				},
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					amount, err := moneyOf(p.Args)
+					if err != nil {
+						return nil, err
+					}
+					description, _ := p.Args["description"].(string)
+					return service.RefundExpense(p.Context, p.Args["userId"].(string), p.Args["expenseId"].(string), amount, description)
+				},
+			},
+			"settleShare": &gql.Field{
+				Type:        gql.NewNonNull(transactionType),
+				Description: "Record someone paying back their share of a shared expense.",
+				Args: gql.FieldConfigArgument{
+					"userId":    &gql.ArgumentConfig{Type: gql.NewNonNull(gql.ID)},
+					"expenseId": &gql.ArgumentConfig{Type: gql.NewNonNull(gql.ID)},
+					"with":      &gql.ArgumentConfig{Type: gql.NewNonNull(gql.String)},
+					"amount":    moneyArgs["amount"],
+					"currency":  moneyArgs["currency"],
+				},
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					amount, err := moneyOf(p.Args)
+					if err != nil {
+						return nil, err
+					}
+					return service.SettleShare(p.Context, p.Args["userId"].(string), p.Args["expenseId"].(string), p.Args["with"].(string), amount)
+				},
+			},
+			"markReimbursable": &gql.Field{
+				Type:        gql.NewNonNull(transactionType),
+				Description: "Mark an expense as a business expense someone else pays back.",
+				Args: gql.FieldConfigArgument{
+					"userId":    &gql.ArgumentConfig{Type: gql.NewNonNull(gql.ID)},
+					"expenseId": &gql.ArgumentConfig{Type: gql.NewNonNull(gql.ID)},
+					"from":      &gql.ArgumentConfig{Type: gql.NewNonNull(gql.String)},
+				},
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					return service.MarkReimbursable(p.Context, p.Args["userId"].(string), p.Args["expenseId"].(string), p.Args["from"].(string))
+				},
+			},
+			"submitReimbursement": &gql.Field{
+				Type:        gql.NewNonNull(transactionType),
+				Description: "Record the reimbursement of an expense as claimed.",
+				Args:        reimbursementArgs,
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					return service.SubmitReimbursement(p.Context, p.Args["userId"].(string), p.Args["expenseId"].(string))
+				},
+			},
+			"approveReimbursement": &gql.Field{
+				Type:        gql.NewNonNull(transactionType),
+				Description: "Record the reimbursement of an expense as agreed to be paid.",
+				Args:        reimbursementArgs,
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					return service.ApproveReimbursement(p.Context, p.Args["userId"].(string), p.Args["expenseId"].(string))
+				},
+			},
+			"payReimbursement": &gql.Field{
+				Type:        gql.NewNonNull(transactionType),
+				Description: "Credit a reimbursement paid back to the categories that covered the expense.",
+				Args: gql.FieldConfigArgument{
+					"userId":    &gql.ArgumentConfig{Type: gql.NewNonNull(gql.ID)},
+					"expenseId": &gql.ArgumentConfig{Type: gql.NewNonNull(gql.ID)},
+					"amount":    moneyArgs["amount"],
+					"currency":  moneyArgs["currency"],
+				},
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					amount, err := moneyOf(p.Args)
+					if err != nil {
+						return nil, err
+					}
+					return service.PayReimbursement(p.Context, p.Args["userId"].(string), p.Args["expenseId"].(string), amount)
+				},
+			},
+		}),
+	})
+	return gql.NewSchema(gql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+// Error of operations on a user other than the one making the request
+var errNotRequestUser = errors.New("userId is not the requesting user")
+
+// requestUserOnly makes the fields taking a userId argument fail unless it
+// names the user making the request.
+func requestUserOnly(fields gql.Fields) gql.Fields {
+	for _, field := range fields {
+		if _, ok := field.Args["userId"]; !ok {
+			continue
+		}
+		resolve := field.Resolve
+		field.Resolve = func(p gql.ResolveParams) (any, error) {
+			if p.Args["userId"].(string) != requestUser(p.Context) {
+				return nil, errNotRequestUser
+			}
+			return resolve(p)
+		}
+	}
+	return fields
+}
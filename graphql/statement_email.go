@@ -0,0 +1,88 @@
+package graphql
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/dnswd/arus"
+	"github.com/dnswd/arus/openapi"
+)
+
+// StatementEmailHandler receives bank statements users forward by email,
+// for inbound mail providers that post each message as raw MIME:
+//
+//	POST /statement-emails   queue the CSV statements attached to the email
+//
+// The user is named by the tag of the address the email was sent to, as in
+// statements+{user}@example.com. Authorize checks the request comes from
+// the mail provider, such as by its signature or a shared secret; every
+// request is refused with 403 Forbidden when it fails. Queued statements
+// are imported or discarded through the schema's mutations.
+type StatementEmailHandler struct {
+	Service   *arus.FinanceService
+	Authorize func(r *http.Request) error
+}
+
+func NewStatementEmailHandler(service *arus.FinanceService, authorize func(r *http.Request) error) *StatementEmailHandler {
+	return &StatementEmailHandler{Service: service, Authorize: authorize}
+}
+
+// Describe adds the inbound email route to doc.
+func (h *StatementEmailHandler) Describe(doc *openapi.Document, prefix string) {
+	doc.Add(http.MethodPost, prefix+"/statement-emails", openapi.Operation{
+		OperationID: "receiveStatementEmail",
+		Summary:     "Queue the statements attached to a forwarded bank email",
+		Tags:        []string{"statements"},
+		RequestBody: &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{
+			"message/rfc822": {Schema: &openapi.Schema{Type: "string", Format: "binary"}},
+		}},
+		Responses: map[string]openapi.Response{
+			"201": {Description: "The queued statements", Content: doc.JSON([]arus.QueuedStatement{})},
+			"400": {Description: "Malformed email"},
+			"403": {Description: "Not sent by the mail provider"},
+			"404": {Description: "No such user"},
+			"413": {Description: "Email too large"},
+			"422": {Description: "No CSV statement attached, or the sender matches no linked bank"},
+		},
+	})
+}
+
+func (h *StatementEmailHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h.Authorize(r); err != nil {
+		http.Error(w, "unknown mail provider", http.StatusForbidden)
+		return
+	}
+	if r.Method != http.MethodPost || r.URL.Path != "/statement-emails" {
+		http.NotFound(w, r)
+		return
+	}
+
+	email, err := arus.ParseStatementEmail(http.MaxBytesReader(w, r.Body, arus.MaxStatementEmailSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "email too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	userID, ok := email.UserID()
+	if !ok {
+		http.Error(w, "email is not addressed to a user", http.StatusNotFound)
+		return
+	}
+	queued, err := h.Service.QueueStatementEmail(r.Context(), userID, email)
+	if err != nil {
+		if errors.Is(err, arus.ErrInvalidAttachment) || errors.Is(err, arus.ErrUnknownSender) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(queued)
+}
@@ -0,0 +1,195 @@
+package arus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Targets a period is scored against
+var (
+	targetSavingsRate     = decimal.NewFromFloat(0.2)
+	targetExpenseRatio    = decimal.NewFromFloat(0.5)
+	targetEmergencyMonths = decimal.NewFromInt(6)
+)
+
+// Weights of the parts of the health score, out of 100
+const (
+	savingsWeight   = 40
+	emergencyWeight = 40
+	expenseWeight   = 20
+)
+
+// Periods averaged for the monthly spending emergency coverage is measured
+// against, counting back from the measured one
+const coverageLookback = 3
+
+// HealthMetrics are the derived measures of one period's finances.
+type HealthMetrics struct {
+	Period Period
+	// Share of income not spent, and spending as a share of income; both
+	// zero when HasIncome is false
+	SavingsRate  decimal.Decimal
+	ExpenseRatio decimal.Decimal
+	HasIncome    bool
+	// Months of average spending the emergency fund covered at the end of
+	// the period
+	EmergencyMonths decimal.Decimal
+	// Composite score from 0 to 100
+	Score int
+	// Why the score is what it is, one line per part
+	Explanations []string
+}
+
+// categoryBalanceAt reconstructs a category's balance at t from its current
+// balance and the allocations and deductions recorded since.
+func (u *User) categoryBalanceAt(categoryType CategoryType, t time.Time) Money {
+	category, exists := u.Categories[categoryType]
+	if !exists {
+		return NewMoneyZero(u.Currency())
+	}
+	balance := category.Balance.Amount
+	for _, income := range u.Incomes {
+		if !income.Date.After(t) {
+			continue
+		}
+		for _, allocation := range income.Allocations {
+			if allocation.Category == categoryType && allocation.Amount.Currency == category.Balance.Currency {
+				balance = balance.Sub(allocation.Amount.Amount)
+			}
+		}
+	}
+	for _, expense := range u.Expenses {
+		if expense.Date.After(t) && expense.Counts() && expense.Amount.Currency == category.Balance.Currency {
+			balance = balance.Add(expense.DeductedFrom(categoryType).Amount)
+		}
+	}
+	return Money{Amount: balance, Currency: category.Balance.Currency}
+}
+
+// score scales value linearly from 0 at zero to weight at target.
+func score(value, target decimal.Decimal, weight int) decimal.Decimal {
+	if !value.IsPositive() {
+		return decimal.Zero
+	}
+	return decimal.Min(value.Div(target), decimal.NewFromInt(1)).Mul(decimal.NewFromInt(int64(weight)))
+}
+
+func percent(d decimal.Decimal) string {
+	return d.Mul(decimal.NewFromInt(100)).StringFixed(0) + "%"
+}
+
+// HealthMetrics measures the period: savings rate, spending against
+// income, and how many months of spending the emergency fund covers. The
+// score weighs a 20% savings rate, spending at most half of income and six
+// months of emergency cover as full marks.
+func (u *User) HealthMetrics(period Period) HealthMetrics {
+	summary := u.GetPeriodSummary(period)
+	metrics := HealthMetrics{Period: period}
+	total := decimal.Zero
+
+	if rate, ok := summary.SavingsRate(); ok {
+		metrics.HasIncome = true
+		metrics.SavingsRate = rate
+		metrics.ExpenseRatio = summary.TotalExpense.Amount.Abs().Div(summary.TotalIncome.Amount)
+		total = total.Add(score(rate, targetSavingsRate, savingsWeight))
+		// Scores full marks at the target ratio and none at 100%
+		headroom := decimal.NewFromInt(1).Sub(metrics.ExpenseRatio)
+		total = total.Add(score(headroom, decimal.NewFromInt(1).Sub(targetExpenseRatio), expenseWeight))
+
+		metrics.Explanations = append(metrics.Explanations,
+			fmt.Sprintf("You saved %s of your income; %s or more scores full marks.", percent(rate), percent(targetSavingsRate)),
+			fmt.Sprintf("You spent %s of your income; up to %s scores full marks.", percent(metrics.ExpenseRatio), percent(targetExpenseRatio)))
+	} else {
+		metrics.Explanations = append(metrics.Explanations, "No income was recorded, so savings and spending score nothing.")
+	}
+
+	// Months without spending are left out, e.g. before the user joined
+	spending := decimal.Zero
+	months := 0
+	p := period
+	for range coverageLookback {
+		if spent := u.GetPeriodSummary(p).TotalExpense.Amount.Abs(); spent.IsPositive() {
+			spending = spending.Add(spent)
+			months++
+		}
+		p = p.Previous()
+	}
+	monthly := decimal.Zero
+	if months > 0 {
+		monthly = spending.Div(decimal.NewFromInt(int64(months)))
+	}
+	emergency := u.categoryBalanceAt(Emergency, period.EndDate)
+	switch {
+	case monthly.IsPositive():
+		metrics.EmergencyMonths = emergency.Amount.Div(monthly).Round(1)
+		total = total.Add(score(metrics.EmergencyMonths, targetEmergencyMonths, emergencyWeight))
+		metrics.Explanations = append(metrics.Explanations,
+			fmt.Sprintf("Your emergency fund covers %s months of spending; %s months scores full marks.",
+				metrics.EmergencyMonths.StringFixed(1), targetEmergencyMonths.String()))
+	case emergency.Amount.IsPositive():
+		// Nothing spent: any emergency fund is enough
+		total = total.Add(decimal.NewFromInt(emergencyWeight))
+		metrics.Explanations = append(metrics.Explanations, "Your emergency fund covers all of your (zero) spending.")
+	default:
+		metrics.Explanations = append(metrics.Explanations, "You have no emergency fund.")
+	}
+
+	metrics.Score = int(total.Round(0).IntPart())
+	return metrics
+}
+
+// HealthTrend returns the metrics of the count periods ending with period,
+// oldest first.
+func (u *User) HealthTrend(period Period, count int) []HealthMetrics {
+	trend := make([]HealthMetrics, count)
+	for i := count - 1; i >= 0; i-- {
+		trend[i] = u.HealthMetrics(period)
+		period = period.Previous()
+	}
+	return trend
+}
+
+func healthReport(user *User, period Period) Notification {
+	trend := user.HealthTrend(period, 3)
+	latest := trend[len(trend)-1]
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Your financial health score for %s is %d out of 100.\n",
+		period.StartDate.Format("January 2006"), latest.Score)
+	for _, explanation := range latest.Explanations {
+		fmt.Fprintf(&b, " - %s\n", explanation)
+	}
+	b.WriteString("Recent months:\n")
+	for _, metrics := range trend {
+		fmt.Fprintf(&b, " - %s: %d\n", metrics.Period.StartDate.Format("January 2006"), metrics.Score)
+	}
+	return Notification{Subject: "Your financial health score", Body: b.String()}
+}
+
+// HealthTrend returns the health metrics of the user's last months monthly
+// periods, oldest first, ending with the current one.
+func (s *FinanceService) HealthTrend(ctx context.Context, userID string, months int) ([]HealthMetrics, error) {
+	if months < 1 {
+		return nil, fmt.Errorf("months must be positive, got %d", months)
+	}
+	defer s.readLockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	// The oldest period's emergency cover averages spending before it too
+	period := user.MonthlyPeriodOf(s.now())
+	oldest := period
+	for range months - 1 + coverageLookback {
+		oldest = oldest.Previous()
+	}
+	if err := s.loadSince(ctx, user, oldest.StartDate); err != nil {
+		return nil, err
+	}
+	return user.HealthTrend(period, months), nil
+}
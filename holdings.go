@@ -0,0 +1,322 @@
+package arus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+var ErrPriceUnavailable = errors.New("price unavailable")
+
+// PriceProvider looks up the current price of one unit of a security.
+type PriceProvider interface {
+	Price(ctx context.Context, ticker string) (Money, error)
+}
+
+// StaticPrices serves fixed prices per ticker, e.g. entered by hand for
+// securities without a market feed.
+type StaticPrices map[string]Money
+
+func (s StaticPrices) Price(ctx context.Context, ticker string) (Money, error) {
+	price, ok := s[normalizeTicker(ticker)]
+	if !ok {
+		return Money{}, fmt.Errorf("%w: %s", ErrPriceUnavailable, ticker)
+	}
+	return price, nil
+}
+
+func normalizeTicker(ticker string) string {
+	return strings.ToUpper(strings.TrimSpace(ticker))
+}
+
+// Holding is a position in one security held in the Investment category.
+// CostBasis is the total paid for the units still held, at their average
+// cost.
+type Holding struct {
+	Ticker    string
+	Units     decimal.Decimal
+	CostBasis Money
+}
+
+// Trade is a purchase or sale of a holding. Purchases are paid with the
+// Investment category's uninvested cash. Sales are liquidations: the
+// proceeds leave Investment for Target, and RealizedGain is the difference
+// between the proceeds and the cost basis of the units sold.
+type Trade struct {
+	ID     string
+	Date   time.Time
+	Ticker string
+	// Positive for purchases, negative for sales
+	Units decimal.Decimal
+	Price Money
+	// Price times units, always positive
+	Amount Money
+	// Set for sales only
+	Target       *CategoryType `json:",omitempty"`
+	RealizedGain Money
+}
+
+func (t Trade) IsSale() bool {
+	return t.Units.IsNegative()
+}
+
+// HoldingValue is a holding marked to the market.
+type HoldingValue struct {
+	Holding
+	Price          Money
+	MarketValue    Money
+	UnrealizedGain Money
+}
+
+func (u *User) holding(ticker string) (int, bool) {
+	i := slices.IndexFunc(u.Holdings, func(h Holding) bool { return h.Ticker == ticker })
+	return i, i >= 0
+}
+
+func (u *User) investmentCategory() (*Category, error) {
+	category, exists := u.Categories[Investment]
+	if !exists {
+		return nil, &CategoryNotFoundError{Category: Investment}
+	}
+	return category, nil
+}
+
+// InvestedCost is the cost basis of every holding, the part of the
+// Investment balance that is not cash.
+func (u *User) InvestedCost() Money {
+	total := NewMoneyZero(u.Currency())
+	for _, holding := range u.Holdings {
+		total = total.Add(holding.CostBasis)
+	}
+	return total
+}
+
+// BuyHolding buys units of ticker at price with the Investment category's
+// uninvested cash.
+func (u *User) BuyHolding(ticker string, units decimal.Decimal, price Money, date time.Time) (Trade, error) {
+	ticker = normalizeTicker(ticker)
+	if ticker == "" {
+		return Trade{}, errors.New("ticker is required")
+	}
+	if !units.IsPositive() || !price.Amount.IsPositive() {
+		return Trade{}, errors.New("units and price must be positive")
+	}
+	category, err := u.investmentCategory()
+	if err != nil {
+		return Trade{}, err
+	}
+	if err := category.checkCurrency(price); err != nil {
+		return Trade{}, err
+	}
+
+	cost := Money{Amount: price.Amount.Mul(units), Currency: price.Currency}.Round()
+	cash := category.Balance.Subtract(u.InvestedCost())
+	if cash.Amount.LessThan(cost.Amount) {
+		investment := Investment
+		return Trade{}, &InsufficientFundsError{Category: &investment, Needed: cost, Available: cash}
+	}
+
+	i, exists := u.holding(ticker)
+	if !exists {
+		u.Holdings = append(u.Holdings, Holding{Ticker: ticker, Units: decimal.Zero, CostBasis: NewMoneyZero(cost.Currency)})
+		i = len(u.Holdings) - 1
+	}
+	u.Holdings[i].Units = u.Holdings[i].Units.Add(units)
+	u.Holdings[i].CostBasis = u.Holdings[i].CostBasis.Add(cost)
+
+	trade := Trade{
+		ID:           NewID(),
+		Date:         date,
+		Ticker:       ticker,
+		Units:        units,
+		Price:        price,
+		Amount:       cost,
+		RealizedGain: NewMoneyZero(cost.Currency),
+	}
+	u.Trades = append(u.Trades, trade)
+	return trade, nil
+}
+
+// SellHolding sells units of ticker at price and moves the proceeds to
+// target, usually Savings: investments are liquidated into another category
+// before they can be spent. The gain or loss against the average cost is
+// booked to Investment first, so it leaves only its cost basis behind.
+func (u *User) SellHolding(ticker string, units decimal.Decimal, price Money, target CategoryType, date time.Time) (Trade, error) {
+	ticker = normalizeTicker(ticker)
+	if !units.IsPositive() || !price.Amount.IsPositive() {
+		return Trade{}, errors.New("units and price must be positive")
+	}
+	if target == Investment {
+		return Trade{}, errors.New("proceeds must leave the Investment category")
+	}
+	category, err := u.investmentCategory()
+	if err != nil {
+		return Trade{}, err
+	}
+	destination, exists := u.Categories[target]
+	if !exists {
+		return Trade{}, &CategoryNotFoundError{Category: target}
+	}
+	if err := category.checkCurrency(price); err != nil {
+		return Trade{}, err
+	}
+	i, exists := u.holding(ticker)
+	if !exists {
+		return Trade{}, fmt.Errorf("%w: %s", ErrHoldingNotFound, ticker)
+	}
+	holding := u.Holdings[i]
+	if units.GreaterThan(holding.Units) {
+		return Trade{}, fmt.Errorf("%w: selling %s of %s units of %s",
+			ErrInsufficientUnits, units.String(), holding.Units.String(), ticker)
+	}
+
+	proceeds := Money{Amount: price.Amount.Mul(units), Currency: price.Currency}.Round()
+	soldCost := holding.CostBasis
+	if units.LessThan(holding.Units) {
+		soldCost = Money{Amount: holding.CostBasis.Amount.Mul(units).Div(holding.Units), Currency: price.Currency}.Round()
+	}
+	gain := proceeds.Subtract(soldCost)
+
+	if gain.Amount.IsPositive() {
+		err = category.Credit(gain)
+	} else if gain.Amount.IsNegative() {
+		err = category.Debit(gain)
+	}
+	if err != nil {
+		return Trade{}, err
+	}
+	if err := category.Debit(proceeds); err != nil {
+		return Trade{}, err
+	}
+	if err := destination.Credit(proceeds); err != nil {
+		return Trade{}, err
+	}
+
+	holding.Units = holding.Units.Sub(units)
+	holding.CostBasis = holding.CostBasis.Subtract(soldCost)
+	if holding.Units.IsZero() {
+		u.Holdings = slices.Delete(u.Holdings, i, i+1)
+	} else {
+		u.Holdings[i] = holding
+	}
+
+	trade := Trade{
+		ID:           NewID(),
+		Date:         date,
+		Ticker:       ticker,
+		Units:        units.Neg(),
+		Price:        price,
+		Amount:       proceeds,
+		Target:       &target,
+		RealizedGain: gain,
+	}
+	u.Trades = append(u.Trades, trade)
+	return trade, nil
+}
+
+func (s *FinanceService) price(ctx context.Context, ticker string) (Money, error) {
+	if s.Prices == nil {
+		return Money{}, fmt.Errorf("%w: no price provider configured", ErrPriceUnavailable)
+	}
+	return s.Prices.Price(ctx, normalizeTicker(ticker))
+}
+
+// BuyHolding buys units of ticker at the current price.
+func (s *FinanceService) BuyHolding(ctx context.Context, userID, ticker string, units decimal.Decimal) (_ Trade, err error) {
+	ctx, span := s.startSpan(ctx, "BuyHolding", userID)
+	defer endSpan(span, &err)
+
+	price, err := s.price(ctx, ticker)
+	if err != nil {
+		return Trade{}, err
+	}
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return Trade{}, err
+	}
+	trade, err := user.BuyHolding(ticker, units, price, s.now())
+	if err != nil {
+		return Trade{}, err
+	}
+
+	if err := s.save(ctx, user, "buy_holding"); err != nil {
+		return Trade{}, err
+	}
+	s.log().InfoContext(ctx, "bought holding",
+		LogKeyUserID, userID, LogKeyTransactionID, trade.ID, "ticker", trade.Ticker,
+		"units", trade.Units.String(), "amount", trade.Amount.String())
+	s.publish(userID, EventTradeRecorded, trade)
+	s.Telemetry.Track(ctx, "holdings", "buy", userID, nil)
+	return trade, nil
+}
+
+// SellHolding sells units of ticker at the current price, liquidating the
+// proceeds into target.
+func (s *FinanceService) SellHolding(ctx context.Context, userID, ticker string, units decimal.Decimal, target CategoryType) (_ Trade, err error) {
+	ctx, span := s.startSpan(ctx, "SellHolding", userID)
+	defer endSpan(span, &err)
+
+	price, err := s.price(ctx, ticker)
+	if err != nil {
+		return Trade{}, err
+	}
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return Trade{}, err
+	}
+	trade, err := user.SellHolding(ticker, units, price, target, s.now())
+	if err != nil {
+		return Trade{}, err
+	}
+
+	if err := s.save(ctx, user, "sell_holding"); err != nil {
+		return Trade{}, err
+	}
+	s.log().InfoContext(ctx, "sold holding",
+		LogKeyUserID, userID, LogKeyTransactionID, trade.ID, "ticker", trade.Ticker,
+		"units", trade.Units.String(), "amount", trade.Amount.String(), "gain", trade.RealizedGain.String())
+	s.publish(userID, EventTradeRecorded, trade)
+	s.publish(userID, EventBalancesUpdated, NewBalancesSnapshot(user))
+	s.Telemetry.Track(ctx, "holdings", "sell", userID, map[string]string{
+		"target": target.String(),
+	})
+	return trade, nil
+}
+
+// HoldingValues marks the user's holdings to the current prices.
+func (s *FinanceService) HoldingValues(ctx context.Context, userID string) ([]HoldingValue, error) {
+	user, err := func() (*User, error) {
+		defer s.readLockUser(userID)()
+		return s.UserRepo.GetByID(ctx, userID)
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]HoldingValue, 0, len(user.Holdings))
+	for _, holding := range user.Holdings {
+		price, err := s.price(ctx, holding.Ticker)
+		if err != nil {
+			return nil, err
+		}
+		value := Money{Amount: price.Amount.Mul(holding.Units), Currency: price.Currency}.Round()
+		values = append(values, HoldingValue{
+			Holding:        holding,
+			Price:          price,
+			MarketValue:    value,
+			UnrealizedGain: value.Subtract(holding.CostBasis),
+		})
+	}
+	return values, nil
+}
@@ -0,0 +1,188 @@
+package arus
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"sync"
+)
+
+// IDGenerator produces unique entity IDs. Both built-in generators produce
+// IDs that sort lexicographically in creation order, which keeps
+// time-ordered storage backends' indexes append-only.
+type IDGenerator interface {
+	NewID() string
+}
+
+var (
+	idMu        sync.RWMutex
+	idGenerator IDGenerator = NewUUIDv7Generator()
+)
+
+// SetIDGenerator changes the generator used for new users and transactions.
+func SetIDGenerator(generator IDGenerator) {
+	idMu.Lock()
+	defer idMu.Unlock()
+
+	idGenerator = generator
+}
+
+// CurrentIDGenerator returns the generator used for new IDs.
+func CurrentIDGenerator() IDGenerator {
+	idMu.RLock()
+	defer idMu.RUnlock()
+
+	return idGenerator
+}
+
+// NewID returns an ID from the configured generator.
+func NewID() string {
+	idMu.RLock()
+	generator := idGenerator
+	idMu.RUnlock()
+
+	return generator.NewID()
+}
+
+// UUIDv7Generator generates RFC 9562 version 7 UUIDs. IDs created within
+// the same millisecond use a counter in the rand_a bits so they stay ordered.
+// With a fake Clock and a seeded Random it generates the same IDs on every
+// run.
+type UUIDv7Generator struct {
+	// Source of the timestamps; nil uses the wall clock
+	Clock Clock
+	// Source of the random bits; nil uses crypto/rand
+	Random io.Reader
+
+	mu      sync.Mutex
+	lastMs  int64
+	counter uint16
+}
+
+func NewUUIDv7Generator() *UUIDv7Generator {
+	return &UUIDv7Generator{}
+}
+
+func (g *UUIDv7Generator) NewID() string {
+	g.mu.Lock()
+	var id [16]byte
+	if _, err := io.ReadFull(randomOrCrypto(g.Random), id[:]); err != nil {
+		g.mu.Unlock()
+		panic(err)
+	}
+	ms := clockOrSystem(g.Clock).Now().UnixMilli()
+	if ms <= g.lastMs {
+		ms = g.lastMs
+		g.counter++
+		if g.counter > 0x0fff {
+			ms++
+			g.counter = 0
+		}
+	} else {
+		// Start from a random point in the lower half so there is room to
+		// count up within the millisecond.
+		g.counter = binary.BigEndian.Uint16(id[6:8]) & 0x07ff
+	}
+	g.lastMs = ms
+	counter := g.counter
+	g.mu.Unlock()
+
+	id[0] = byte(ms >> 40)
+	id[1] = byte(ms >> 32)
+	id[2] = byte(ms >> 24)
+	id[3] = byte(ms >> 16)
+	id[4] = byte(ms >> 8)
+	id[5] = byte(ms)
+	id[6] = 0x70 | byte(counter>>8)
+	id[7] = byte(counter)
+	id[8] = 0x80 | (id[8] & 0x3f)
+
+	var buf [36]byte
+	hex.Encode(buf[0:8], id[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], id[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], id[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], id[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], id[10:])
+	return string(buf[:])
+}
+
+// ULIDGenerator generates ULIDs: a 48-bit millisecond timestamp followed by
+// 80 random bits, in Crockford base32. IDs created within the same
+// millisecond increment the random part so they stay ordered.
+type ULIDGenerator struct {
+	// Source of the timestamps; nil uses the wall clock
+	Clock Clock
+	// Source of the random bits; nil uses crypto/rand
+	Random io.Reader
+
+	mu     sync.Mutex
+	lastMs int64
+	last   [10]byte
+}
+
+func NewULIDGenerator() *ULIDGenerator {
+	return &ULIDGenerator{}
+}
+
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func (g *ULIDGenerator) NewID() string {
+	g.mu.Lock()
+	ms := clockOrSystem(g.Clock).Now().UnixMilli()
+	if ms <= g.lastMs {
+		ms = g.lastMs
+		if !incrementBytes(g.last[:]) {
+			ms++
+		}
+	} else if _, err := io.ReadFull(randomOrCrypto(g.Random), g.last[:]); err != nil {
+		g.mu.Unlock()
+		panic(err)
+	}
+	g.lastMs = ms
+
+	var id [16]byte
+	id[0] = byte(ms >> 40)
+	id[1] = byte(ms >> 32)
+	id[2] = byte(ms >> 24)
+	id[3] = byte(ms >> 16)
+	id[4] = byte(ms >> 8)
+	id[5] = byte(ms)
+	copy(id[6:], g.last[:])
+	g.mu.Unlock()
+
+	// 128 bits encode to 26 characters of 5 bits each, most significant first
+	// (the first character only carries 3 bits).
+	var out [26]byte
+	hi := binary.BigEndian.Uint64(id[0:8])
+	lo := binary.BigEndian.Uint64(id[8:16])
+	for i := 25; i >= 0; i-- {
+		out[i] = crockfordAlphabet[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// randomOrCrypto returns random, falling back to crypto/rand when nil.
+func randomOrCrypto(random io.Reader) io.Reader {
+	if random == nil {
+		return rand.Reader
+	}
+	return random
+}
+
+// incrementBytes adds one to a big-endian number, reporting false on overflow.
+func incrementBytes(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,203 @@
+package arus
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTP header clients send their idempotency key in
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// How long keys are remembered unless the store says otherwise
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+type idempotencyKeyContextKey struct{}
+
+// WithIdempotencyKey marks the mutation made with ctx as retryable: repeating
+// it with the same key, for instance after a timeout on a flaky mobile
+// network, applies it only once.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyContextKey{}, key)
+}
+
+func IdempotencyKeyFrom(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(idempotencyKeyContextKey{}).(string)
+	return key, ok && key != ""
+}
+
+// IdempotencyRecord is what a store remembers about a key. Fingerprint
+// identifies the request the key was first used for.
+type IdempotencyRecord struct {
+	Fingerprint string
+	Completed   bool
+	// JSON of what the completed mutation returned, given back to replays
+	Result  []byte `json:",omitempty"`
+	Expires time.Time
+}
+
+// IdempotencyStore remembers idempotency keys. Claim reserves an unused key
+// and reports true; for a key in use it returns the existing record. A
+// claimed key is then either completed with the mutation's result, when it
+// succeeded, or released so the client can retry.
+type IdempotencyStore interface {
+	Claim(ctx context.Context, key, fingerprint string) (IdempotencyRecord, bool, error)
+	Complete(ctx context.Context, key string, result []byte) error
+	Release(ctx context.Context, key string) error
+}
+
+// MemoryIdempotencyStore keeps keys in memory for TTL after they are
+// claimed, which suits a single instance.
+type MemoryIdempotencyStore struct {
+	TTL time.Duration
+	// Source of the current time; nil uses the wall clock
+	Clock Clock
+
+	mu      sync.Mutex
+	records map[string]IdempotencyRecord
+}
+
+func NewMemoryIdempotencyStore(ttl time.Duration) *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{TTL: ttl, records: make(map[string]IdempotencyRecord)}
+}
+
+func (m *MemoryIdempotencyStore) Claim(ctx context.Context, key, fingerprint string) (IdempotencyRecord, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return IdempotencyRecord{}, false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := clockOrSystem(m.Clock).Now()
+	for k, record := range m.records {
+		if !now.Before(record.Expires) {
+			delete(m.records, k)
+		}
+	}
+
+	if record, exists := m.records[key]; exists {
+		return record, false, nil
+	}
+
+	ttl := m.TTL
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+	if m.records == nil {
+		m.records = make(map[string]IdempotencyRecord)
+	}
+	m.records[key] = IdempotencyRecord{Fingerprint: fingerprint, Expires: now.Add(ttl)}
+	return IdempotencyRecord{}, true, nil
+}
+
+func (m *MemoryIdempotencyStore) Complete(ctx context.Context, key string, result []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if record, exists := m.records[key]; exists {
+		record.Completed = true
+		record.Result = result
+		m.records[key] = record
+	}
+	return nil
+}
+
+func (m *MemoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.records, key)
+	return nil
+}
+
+// idempotencyClaim is a key held for the duration of one mutation. A nil
+// claim means the mutation is not idempotent.
+type idempotencyClaim struct {
+	store    IdempotencyStore
+	key      string
+	replayed bool
+	// What the mutation returned: recorded on completion, or read back
+	// from the record on a replay
+	result any
+	stored []byte
+}
+
+// claimIdempotencyKey claims the context's idempotency key for an operation
+// on the user.
+func (s *FinanceService) claimIdempotencyKey(ctx context.Context, userID, operation string, request ...string) (*idempotencyClaim, error) {
+	key, ok := IdempotencyKeyFrom(ctx)
+	if !ok || s.Idempotency == nil {
+		return nil, nil
+	}
+
+	// Keys are chosen by clients, so scope them to the user
+	key = userID + "/" + key
+	sum := sha256.Sum256([]byte(operation + "\x00" + strings.Join(request, "\x00")))
+	fingerprint := hex.EncodeToString(sum[:])
+
+	record, claimed, err := s.Idempotency.Claim(ctx, key, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		switch {
+		case record.Fingerprint != fingerprint:
+			return nil, fmt.Errorf("%s: %w", operation, ErrIdempotencyKeyReused)
+		case !record.Completed:
+			return nil, fmt.Errorf("%s: %w", operation, ErrRequestInProgress)
+		}
+		s.log().InfoContext(ctx, "replayed idempotent request", LogKeyUserID, userID, LogKeyOperation, operation)
+		return &idempotencyClaim{replayed: true, stored: record.Result}, nil
+	}
+	return &idempotencyClaim{store: s.Idempotency, key: key}, nil
+}
+
+// isReplay reports whether the request already succeeded, in which case the
+// caller must return without applying it again.
+func (c *idempotencyClaim) isReplay() bool {
+	return c != nil && c.replayed
+}
+
+// keep records the mutation's result, returned to later replays.
+func (c *idempotencyClaim) keep(result any) {
+	if c != nil {
+		c.result = result
+	}
+}
+
+// replay decodes the result kept by the request being replayed into
+// result. Mutations that keep nothing leave it unchanged.
+func (c *idempotencyClaim) replay(result any) error {
+	if len(c.stored) == 0 {
+		return nil
+	}
+	return json.Unmarshal(c.stored, result)
+}
+
+// settle completes the claim when *err is nil and releases it otherwise.
+// Call it deferred with the address of a named error result.
+func (c *idempotencyClaim) settle(ctx context.Context, err *error) {
+	if c == nil || c.replayed {
+		return
+	}
+	if *err != nil {
+		c.store.Release(ctx, c.key)
+		return
+	}
+	var result []byte
+	if c.result != nil {
+		var marshalErr error
+		if result, marshalErr = json.Marshal(c.result); marshalErr != nil && *err == nil {
+			*err = marshalErr
+		}
+	}
+	if completeErr := c.store.Complete(ctx, c.key, result); *err == nil {
+		*err = completeErr
+	}
+}
@@ -0,0 +1,156 @@
+package arus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIdempotentExpenseReplay(t *testing.T) {
+	start := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	date := start.Add(time.Hour)
+
+	// Expense request made by a test step
+	type request struct {
+		user   string
+		key    string
+		amount string
+		// Time passed since the previous request
+		after time.Duration
+		// Error the request must return, checked with errors.Is
+		wantErr error
+		// Whether the request must fail, with any error
+		wantFail bool
+	}
+	tests := []struct {
+		name     string
+		requests []request
+		// Expenses recorded per user
+		want map[string]int
+	}{
+		{
+			name:     "without a key every request applies",
+			requests: []request{{user: "alice", amount: "10"}, {user: "alice", amount: "10"}},
+			want:     map[string]int{"alice": 2},
+		},
+		{
+			name:     "a retry with the same key applies once",
+			requests: []request{{user: "alice", key: "k1", amount: "10"}, {user: "alice", key: "k1", amount: "10"}},
+			want:     map[string]int{"alice": 1},
+		},
+		{
+			name:     "different keys apply separately",
+			requests: []request{{user: "alice", key: "k1", amount: "10"}, {user: "alice", key: "k2", amount: "10"}},
+			want:     map[string]int{"alice": 2},
+		},
+		{
+			name:     "a key reused for another request fails",
+			requests: []request{{user: "alice", key: "k1", amount: "10"}, {user: "alice", key: "k1", amount: "20", wantErr: ErrIdempotencyKeyReused}},
+			want:     map[string]int{"alice": 1},
+		},
+		{
+			name:     "keys are scoped to the user",
+			requests: []request{{user: "alice", key: "k1", amount: "10"}, {user: "bob", key: "k1", amount: "10"}},
+			want:     map[string]int{"alice": 1, "bob": 1},
+		},
+		{
+			name: "a failed request releases its key",
+			requests: []request{
+				{user: "alice", key: "k1", amount: "5000", wantFail: true},
+				{user: "alice", key: "k1", amount: "10"},
+			},
+			want: map[string]int{"alice": 1},
+		},
+		{
+			name: "an expired key applies again",
+			requests: []request{
+				{user: "alice", key: "k1", amount: "10"},
+				{user: "alice", key: "k1", amount: "10", after: 2 * time.Hour},
+			},
+			want: map[string]int{"alice": 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			clock := NewFakeClock(start)
+			repo := NewInMemoryUserRepository()
+			store := NewMemoryIdempotencyStore(time.Hour)
+			store.Clock = clock
+			service := &FinanceService{UserRepo: repo, Clock: clock, Idempotency: store}
+			for id := range tt.want {
+				if err := repo.Save(ctx, newFundedUser(t, id, "1000", start)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for i, req := range tt.requests {
+				clock.Advance(req.after)
+				ctx := ctx
+				if req.key != "" {
+					ctx = WithIdempotencyKey(ctx, req.key)
+				}
+				err := service.ProcessExpense(ctx, req.user, money(t, req.amount, "USD"), date, "groceries", ExpenseOptions{})
+				switch {
+				case req.wantErr != nil:
+					if !errors.Is(err, req.wantErr) {
+						t.Fatalf("request %d returned %v, want %v", i, err, req.wantErr)
+					}
+				case req.wantFail:
+					if err == nil {
+						t.Fatalf("request %d succeeded, want an error", i)
+					}
+				case err != nil:
+					t.Fatalf("request %d: %v", i, err)
+				}
+			}
+
+			for id, want := range tt.want {
+				user, err := repo.GetByID(ctx, id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := len(user.Expenses); got != want {
+					t.Errorf("user %s has %d expenses, want %d", id, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestIdempotentRefundReplayReturnsTheRefund(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	repo := NewInMemoryUserRepository()
+	service := &FinanceService{UserRepo: repo, Clock: NewFakeClock(start), Idempotency: NewMemoryIdempotencyStore(time.Hour)}
+	user := newFundedUser(t, "alice", "1000", start)
+	expense := NewExpense(money(t, "100", "USD"), start, "shoes")
+	if err := user.ProcessExpense(expense); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Save(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	keyed := WithIdempotencyKey(ctx, "refund-1")
+	first, err := service.RefundExpense(keyed, "alice", expense.ID, money(t, "40", "USD"), "returned")
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := service.RefundExpense(keyed, "alice", expense.ID, money(t, "40", "USD"), "returned")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed.ID != first.ID || !replayed.Amount.Amount.Equal(first.Amount.Amount) {
+		t.Errorf("replay returned %+v, want the first refund %+v", replayed, first)
+	}
+
+	stored, err := repo.GetByID(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refunds := stored.Refunds(expense.ID); len(refunds) != 1 {
+		t.Errorf("expense has %d refunds, want 1", len(refunds))
+	}
+}
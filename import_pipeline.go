@@ -0,0 +1,244 @@
+package arus
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// ImportStep names a built-in stage of an ImportPipeline.
+type ImportStep string
+
+// Built-in stages of an ImportPipeline, in the order they run
+const (
+	// Reads the lines of the statement
+	ParseStep ImportStep = "parse"
+	// Tidies descriptions
+	NormalizeStep ImportStep = "normalize"
+	// Gives lines stable IDs and drops those already recorded
+	DedupeStep ImportStep = "dedupe"
+	// Tags lines; untagged lines are tagged by the user's classification
+	// rules when recorded
+	CategorizeStep ImportStep = "categorize"
+	// Checks the lines add up to the statement's balances
+	ReconcileStep ImportStep = "reconcile"
+	// Records the statement, see FinanceService.ProcessAccountStatement
+	PersistStep ImportStep = "persist"
+)
+
+// ImportBatch is a statement on its way through an ImportPipeline. Stages
+// change it in place.
+type ImportBatch struct {
+	UserID string
+	// Read by the parse stage into Statement
+	Source    StatementReader
+	Statement AccountStatement
+	// Lines stages dropped, and why
+	Skipped []SkippedLine
+}
+
+type SkippedLine struct {
+	Line   StatementLine
+	Reason string
+}
+
+// Skip drops the statement's lines for which skip returns a reason.
+func (b *ImportBatch) Skip(skip func(line StatementLine) string) {
+	b.Statement.Lines = slices.DeleteFunc(b.Statement.Lines, func(line StatementLine) bool {
+		reason := skip(line)
+		if reason != "" {
+			b.Skipped = append(b.Skipped, SkippedLine{Line: line, Reason: reason})
+		}
+		return reason != ""
+	})
+}
+
+// ImportStage is one step of an ImportPipeline.
+type ImportStage interface {
+	Process(ctx context.Context, batch *ImportBatch) error
+}
+
+// ImportStageFunc adapts a function to an ImportStage.
+type ImportStageFunc func(ctx context.Context, batch *ImportBatch) error
+
+func (f ImportStageFunc) Process(ctx context.Context, batch *ImportBatch) error {
+	return f(ctx, batch)
+}
+
+// NormalizeLines returns a stage rewriting every line with normalize, such
+// as one stripping the reference a bank puts before descriptions.
+func NormalizeLines(normalize func(line StatementLine) StatementLine) ImportStage {
+	return ImportStageFunc(func(ctx context.Context, batch *ImportBatch) error {
+		for i, line := range batch.Statement.Lines {
+			batch.Statement.Lines[i] = normalize(line)
+		}
+		return nil
+	})
+}
+
+// ClassifyLines returns a stage tagging the untagged lines the classifier
+// recognizes.
+func ClassifyLines(classifier Classifier) ImportStage {
+	return ImportStageFunc(func(ctx context.Context, batch *ImportBatch) error {
+		for i, line := range batch.Statement.Lines {
+			if len(line.Tags) > 0 {
+				continue
+			}
+			if classification, ok := classifier.Classify(line.Transaction()); ok {
+				batch.Statement.Lines[i].Tags = classification.Tags
+			}
+		}
+		return nil
+	})
+}
+
+type importStage struct {
+	step  ImportStep
+	stage ImportStage
+}
+
+// ImportPipeline imports a statement through a series of stages: parse,
+// normalize, dedupe, categorize, reconcile and persist. Stages can be
+// added after any built-in one, or replace it, so an import can be
+// adjusted without rewriting it:
+//
+//	pipeline := arus.NewImportPipeline(service)
+//	pipeline.Use(arus.NormalizeStep, arus.NormalizeLines(stripReference))
+//
+// The whole statement is held in memory; StatementImport streams long
+// histories instead.
+type ImportPipeline struct {
+	Service *FinanceService
+
+	stages []importStage
+}
+
+func NewImportPipeline(service *FinanceService) *ImportPipeline {
+	p := &ImportPipeline{Service: service}
+	p.stages = []importStage{
+		{ParseStep, ImportStageFunc(parseLines)},
+		{NormalizeStep, NormalizeLines(normalizeLine)},
+		{DedupeStep, ImportStageFunc(p.dedupe)},
+		{CategorizeStep, nil},
+		{ReconcileStep, ImportStageFunc(reconcileLines)},
+		{PersistStep, ImportStageFunc(p.persist)},
+	}
+	return p
+}
+
+// Use adds stage to run after the built-in step, following any stages
+// added there earlier.
+func (p *ImportPipeline) Use(after ImportStep, stage ImportStage) error {
+	i := slices.IndexFunc(p.stages, func(s importStage) bool { return s.step == after })
+	if i < 0 {
+		return fmt.Errorf("unknown import step %q", after)
+	}
+	for i+1 < len(p.stages) && p.stages[i+1].step == "" {
+		i++
+	}
+	p.stages = slices.Insert(p.stages, i+1, importStage{stage: stage})
+	return nil
+}
+
+// Replace swaps the built-in step for stage; nil skips the step.
+func (p *ImportPipeline) Replace(step ImportStep, stage ImportStage) error {
+	i := slices.IndexFunc(p.stages, func(s importStage) bool { return s.step == step })
+	if i < 0 {
+		return fmt.Errorf("unknown import step %q", step)
+	}
+	p.stages[i].stage = stage
+	return nil
+}
+
+// Run imports the statement of the account into the user's ledger and
+// returns the batch as the last stage left it, which is also returned on
+// failure.
+func (p *ImportPipeline) Run(ctx context.Context, userID string, account BankAccount, statement StatementReader) (ImportBatch, error) {
+	batch := ImportBatch{UserID: userID, Source: statement, Statement: AccountStatement{BankAccount: account}}
+	for _, stage := range p.stages {
+		if stage.stage == nil {
+			continue
+		}
+		if err := stage.stage.Process(ctx, &batch); err != nil {
+			if stage.step != "" {
+				return batch, fmt.Errorf("%s: %w", stage.step, err)
+			}
+			return batch, err
+		}
+	}
+	return batch, nil
+}
+
+func parseLines(ctx context.Context, batch *ImportBatch) error {
+	for {
+		line, err := batch.Source.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		batch.Statement.Lines = append(batch.Statement.Lines, line)
+	}
+}
+
+// normalizeLine collapses the runs of spaces banks pad descriptions with.
+func normalizeLine(line StatementLine) StatementLine {
+	line.Description = strings.Join(strings.Fields(line.Description), " ")
+	line.Reference = strings.TrimSpace(line.Reference)
+	return line
+}
+
+// dedupe gives lines without an ID one derived from the line, see
+// derivedLineID, and skips those the user already recorded.
+func (p *ImportPipeline) dedupe(ctx context.Context, batch *ImportBatch) error {
+	user, err := p.Service.readUser(ctx, batch.UserID)
+	if err != nil {
+		return err
+	}
+	account := batch.Statement.BankAccount
+	seen := make(map[string]int)
+	for i, line := range batch.Statement.Lines {
+		if line.ID == "" {
+			batch.Statement.Lines[i].ID = derivedLineID("stmt-", account.AccountNumber+"@"+account.BankName, line, seen)
+		}
+	}
+	ids := make([]string, len(batch.Statement.Lines))
+	for i, line := range batch.Statement.Lines {
+		ids[i] = line.ID
+	}
+	if err := p.Service.loadTransactionIDs(ctx, user, ids...); err != nil {
+		return err
+	}
+	batch.Skip(func(line StatementLine) string {
+		if _, err := user.transaction(line.ID); err == nil {
+			return "already recorded"
+		}
+		return ""
+	})
+	return nil
+}
+
+// reconcileLines validates the statement with the lines skipped so far,
+// which are on it all the same.
+func reconcileLines(ctx context.Context, batch *ImportBatch) error {
+	statement := batch.Statement
+	statement.Lines = slices.Clone(statement.Lines)
+	for _, skipped := range batch.Skipped {
+		statement.Lines = append(statement.Lines, skipped.Line)
+	}
+	return statement.Validate()
+}
+
+// persist records the lines left. The balances were checked against every
+// line by the reconcile stage, so they are left out.
+func (p *ImportPipeline) persist(ctx context.Context, batch *ImportBatch) error {
+	if len(batch.Statement.Lines) == 0 {
+		return nil
+	}
+	statement := batch.Statement
+	statement.OpeningBalance, statement.ClosingBalance = Money{}, Money{}
+	return p.Service.ProcessAccountStatement(ctx, batch.UserID, statement)
+}
@@ -0,0 +1,268 @@
+package arus
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// AmountSign is which way a statement writes money leaving the account.
+type AmountSign int
+
+const (
+	// Debits are negative and credits positive, as most bank exports write
+	// them
+	DebitsNegative AmountSign = iota
+	// Debits are positive and credits negative, as card statements often
+	// write them
+	DebitsPositive
+)
+
+var amountSignCodes = enumCodes[AmountSign]{
+	name: "amount sign",
+	codes: map[AmountSign]string{
+		DebitsNegative: "debits-negative",
+		DebitsPositive: "debits-positive",
+	},
+	unknown: DebitsNegative,
+}
+
+// ParseAmountSign reads an amount sign code, returning DebitsNegative for
+// codes this version does not know.
+func ParseAmountSign(code string) AmountSign {
+	return amountSignCodes.parse(code)
+}
+
+func (s AmountSign) Code() string {
+	return amountSignCodes.code(s)
+}
+
+func (s AmountSign) String() string {
+	return s.Code()
+}
+
+func (s AmountSign) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Code())
+}
+
+func (s *AmountSign) UnmarshalJSON(data []byte) error {
+	value, err := amountSignCodes.unmarshalJSON(data)
+	*s = value
+	return err
+}
+
+func (s AmountSign) Value() (driver.Value, error) {
+	return s.Code(), nil
+}
+
+func (s *AmountSign) Scan(src any) error {
+	value, err := amountSignCodes.scan(src)
+	*s = value
+	return err
+}
+
+// Fields a statement column can hold
+var statementFields = []string{"date", "description", "amount", "reference", "status"}
+
+// Character encodings statements can be written in, by name
+var statementEncodings = map[string]encoding.Encoding{
+	// Also drops the byte order mark some banks start their exports with
+	"utf-8":        unicode.UTF8BOM,
+	"utf-16":       unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM),
+	"windows-1252": charmap.Windows1252,
+	"iso-8859-1":   charmap.ISO8859_1,
+	"iso-8859-15":  charmap.ISO8859_15,
+}
+
+// ImportProfile is a saved way of reading one bank's CSV statements, such
+// as "Bank Mandiri CSV", so repeat imports need no configuring.
+type ImportProfile struct {
+	Name string
+	// Bank whose statements the profile reads; imports from its accounts
+	// use the profile unless told otherwise
+	Bank string `json:",omitempty"`
+	// Addresses or domains the bank emails statements from, such as
+	// bankmandiri.co.id
+	Senders []string `json:",omitempty"`
+	// Field each column holds, in column order, with "" for columns to
+	// ignore; empty reads the fields from the header row by name
+	Columns []string `json:",omitempty"`
+	// Rows before the first line, skipped when Columns is set
+	HeaderRows int `json:",omitempty"`
+	// Layout of the date column; empty means 2006-01-02
+	DateLayout string `json:",omitempty"`
+	// BCP 47 tag amounts are written in; empty means en-US
+	Locale string     `json:",omitempty"`
+	Sign   AmountSign `json:",omitempty"`
+	// Character encoding of the statement; empty means utf-8
+	Encoding string `json:",omitempty"`
+}
+
+func (p ImportProfile) Validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return errors.New("import profile name is required")
+	}
+	if len(p.Columns) > 0 {
+		for i, field := range p.Columns {
+			if field == "" {
+				continue
+			}
+			if !slices.Contains(statementFields, field) {
+				return fmt.Errorf("import profile %s maps column %d to unknown field %q", p.Name, i+1, field)
+			}
+			if slices.Contains(p.Columns[:i], field) {
+				return fmt.Errorf("import profile %s maps more than one column to %s", p.Name, field)
+			}
+		}
+		for _, required := range statementFields[:3] {
+			if !slices.Contains(p.Columns, required) {
+				return fmt.Errorf("import profile %s has no %s column", p.Name, required)
+			}
+		}
+	}
+	if len(p.Senders) > 0 && p.Bank == "" {
+		return fmt.Errorf("import profile %s must name the bank its senders belong to", p.Name)
+	}
+	if p.HeaderRows < 0 {
+		return fmt.Errorf("import profile %s must not skip a negative number of rows", p.Name)
+	}
+	if _, ok := LookupLocale(p.Locale); p.Locale != "" && !ok {
+		return fmt.Errorf("import profile %s has unknown locale %s", p.Name, p.Locale)
+	}
+	if _, ok := statementEncodings[strings.ToLower(p.Encoding)]; p.Encoding != "" && !ok {
+		return fmt.Errorf("import profile %s has unknown encoding %s", p.Name, p.Encoding)
+	}
+	return nil
+}
+
+// NewCSVStatementReaderFor reads a statement the way the profile says it
+// is written.
+func NewCSVStatementReaderFor(r io.Reader, profile ImportProfile) (*CSVStatementReader, error) {
+	if err := profile.Validate(); err != nil {
+		return nil, err
+	}
+	locale := LocaleEnUS
+	if profile.Locale != "" {
+		locale, _ = LookupLocale(profile.Locale)
+	}
+	if profile.Encoding != "" {
+		r = statementEncodings[strings.ToLower(profile.Encoding)].NewDecoder().Reader(r)
+	}
+
+	reader := NewCSVStatementReader(r, locale)
+	reader.DateLayout = profile.DateLayout
+	reader.Sign = profile.Sign
+	if len(profile.Columns) > 0 {
+		reader.csv.FieldsPerRecord = -1
+		reader.skip = profile.HeaderRows
+		reader.columns = make(map[string]int, len(profile.Columns))
+		for i, field := range profile.Columns {
+			if field != "" {
+				reader.columns[field] = i
+			}
+		}
+	}
+	return reader, nil
+}
+
+// ImportProfile returns the user's import profile of that name.
+func (u *User) ImportProfile(name string) (ImportProfile, error) {
+	for _, profile := range u.ImportProfiles {
+		if strings.EqualFold(profile.Name, name) {
+			return profile, nil
+		}
+	}
+	return ImportProfile{}, fmt.Errorf("import profile %q not found", name)
+}
+
+// ImportProfileFor returns the user's first import profile for the bank.
+func (u *User) ImportProfileFor(bank string) (ImportProfile, bool) {
+	for _, profile := range u.ImportProfiles {
+		if bank != "" && strings.EqualFold(profile.Bank, bank) {
+			return profile, true
+		}
+	}
+	return ImportProfile{}, false
+}
+
+// SaveImportProfile saves the profile, replacing the user's profile of the
+// same name.
+func (u *User) SaveImportProfile(profile ImportProfile) error {
+	if err := profile.Validate(); err != nil {
+		return err
+	}
+	i := slices.IndexFunc(u.ImportProfiles, func(p ImportProfile) bool {
+		return strings.EqualFold(p.Name, profile.Name)
+	})
+	if i < 0 {
+		u.ImportProfiles = append(u.ImportProfiles, profile)
+		return nil
+	}
+	u.ImportProfiles[i] = profile
+	return nil
+}
+
+// DeleteImportProfile removes the user's import profile of that name.
+func (u *User) DeleteImportProfile(name string) error {
+	i := slices.IndexFunc(u.ImportProfiles, func(p ImportProfile) bool {
+		return strings.EqualFold(p.Name, name)
+	})
+	if i < 0 {
+		return fmt.Errorf("import profile %q not found", name)
+	}
+	u.ImportProfiles = slices.Delete(u.ImportProfiles, i, i+1)
+	return nil
+}
+
+func (s *FinanceService) ImportProfiles(ctx context.Context, userID string) ([]ImportProfile, error) {
+	user, err := s.readUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return user.ImportProfiles, nil
+}
+
+func (s *FinanceService) SaveImportProfile(ctx context.Context, userID string, profile ImportProfile) error {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := user.SaveImportProfile(profile); err != nil {
+		return err
+	}
+
+	if err := s.save(ctx, user, "save_import_profile"); err != nil {
+		return err
+	}
+	s.Telemetry.Track(ctx, "import", "save_profile", userID, nil)
+	return nil
+}
+
+func (s *FinanceService) DeleteImportProfile(ctx context.Context, userID, name string) error {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := user.DeleteImportProfile(name); err != nil {
+		return err
+	}
+
+	if err := s.save(ctx, user, "delete_import_profile"); err != nil {
+		return err
+	}
+	s.Telemetry.Track(ctx, "import", "delete_profile", userID, nil)
+	return nil
+}
@@ -0,0 +1,138 @@
+package arus
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// InboxItemKind identifies what kind of action an inbox item asks for.
+// Features outside this package can add their own kinds through an
+// InboxSource.
+type InboxItemKind string
+
+const (
+	InboxReview         InboxItemKind = "review"
+	InboxReconciliation InboxItemKind = "reconciliation"
+)
+
+// Default priorities of built-in items; higher comes first
+const (
+	ReconciliationPriority = 80
+	ReviewPriority         = 50
+)
+
+// InboxItem is something that needs the user's attention. Reference is the
+// ID (or account number) of the thing to act on.
+type InboxItem struct {
+	Kind      InboxItemKind
+	Reference string
+	Title     string
+	Priority  int
+	// When the item should be dealt with by; zero when there is no deadline
+	Due time.Time
+}
+
+// InboxSource contributes items to a user's inbox.
+type InboxSource interface {
+	InboxItems(user *User, now time.Time) []InboxItem
+}
+
+// InboxSourceFunc adapts a function to an InboxSource.
+type InboxSourceFunc func(user *User, now time.Time) []InboxItem
+
+func (f InboxSourceFunc) InboxItems(user *User, now time.Time) []InboxItem {
+	return f(user, now)
+}
+
+// Sources used when the service does not configure its own
+var DefaultInboxSources = []InboxSource{
+	InboxSourceFunc(reviewInboxItems),
+	InboxSourceFunc(reconciliationInboxItems),
+	InboxSourceFunc(statementInboxItems),
+	InboxSourceFunc(lowBalanceInboxItems),
+}
+
+// Inbox is every pending action of a user, most urgent first.
+type Inbox struct {
+	Items  []InboxItem
+	Counts map[InboxItemKind]int
+}
+
+// Review items are due before their expense locks, since tags can only be
+// amended after that.
+func reviewInboxItems(user *User, now time.Time) []InboxItem {
+	items := make([]InboxItem, 0, len(user.ReviewQueue))
+	for _, review := range user.ReviewQueue {
+		item := InboxItem{
+			Kind:      InboxReview,
+			Reference: review.ID,
+			Title:     "Review suggested tags",
+			Priority:  ReviewPriority,
+		}
+		if expense, err := user.Expense(review.ExpenseID); err == nil {
+			item.Title = fmt.Sprintf("Review tags of %q", expense.Description)
+			item.Due = user.LockedAt(*expense)
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func reconciliationInboxItems(user *User, now time.Time) []InboxItem {
+	items := make([]InboxItem, 0, len(user.OpenReconciliations))
+	for _, reconciliation := range user.OpenReconciliations {
+		items = append(items, InboxItem{
+			Kind:      InboxReconciliation,
+			Reference: reconciliation.BankAccount.AccountNumber,
+			Title: fmt.Sprintf("Account %s at %s is off by %s",
+				reconciliation.BankAccount.Masked(), reconciliation.BankAccount.BankName,
+				reconciliation.Difference.Format(LocaleEnUS)),
+			Priority: ReconciliationPriority,
+		})
+	}
+	return items
+}
+
+// Inbox collects the items of every source and orders them by priority,
+// then by due date (items without one last).
+func (u *User) Inbox(now time.Time, sources ...InboxSource) Inbox {
+	inbox := Inbox{Counts: make(map[InboxItemKind]int)}
+	for _, source := range sources {
+		for _, item := range source.InboxItems(u, now) {
+			inbox.Items = append(inbox.Items, item)
+			inbox.Counts[item.Kind]++
+		}
+	}
+
+	sort.SliceStable(inbox.Items, func(i, j int) bool {
+		a, b := inbox.Items[i], inbox.Items[j]
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		if a.Due.IsZero() != b.Due.IsZero() {
+			return !a.Due.IsZero()
+		}
+		return a.Due.Before(b.Due)
+	})
+	return inbox
+}
+
+func (s *FinanceService) Inbox(ctx context.Context, userID string) (Inbox, error) {
+	defer s.readLockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return Inbox{}, err
+	}
+	if err := s.loadTransactionIDs(ctx, user, user.reviewedExpenseIDs()...); err != nil {
+		return Inbox{}, err
+	}
+
+	sources := s.InboxSources
+	if sources == nil {
+		sources = DefaultInboxSources
+	}
+	return user.Inbox(s.now(), sources...), nil
+}
@@ -0,0 +1,384 @@
+package arus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/bits"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Runs kept per scheduled income
+const incomeRunHistory = 24
+
+// How often a failed scheduled income is retried before waiting for its
+// next scheduled run, and the delay before each retry
+var incomeRetryDelays = []time.Duration{5 * time.Minute, 30 * time.Minute, 2 * time.Hour, 12 * time.Hour}
+
+// CronSchedule is a standard five-field cron expression: minute, hour, day
+// of month, month and day of week. Fields take *, numbers, ranges (1-5),
+// lists (1,15) and steps (*/2, 1-10/3). When both day fields are
+// restricted, a day matching either runs, as in cron.
+type CronSchedule struct {
+	Expr string
+
+	minutes, hours, days, months, weekdays uint64
+	anyDay, anyWeekday                     bool
+}
+
+// ParseCron parses a cron expression such as "0 0 25 * *", midnight on the
+// 25th of every month.
+func ParseCron(expr string) (CronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return CronSchedule{}, fmt.Errorf("cron expression %q must have 5 fields", expr)
+	}
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+	var sets [5]uint64
+	for i, field := range fields {
+		set, err := parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return CronSchedule{}, fmt.Errorf("cron expression %q: %w", expr, err)
+		}
+		sets[i] = set
+	}
+	return CronSchedule{
+		Expr:       expr,
+		minutes:    sets[0],
+		hours:      sets[1],
+		days:       sets[2],
+		months:     sets[3],
+		weekdays:   sets[4],
+		anyDay:     strings.HasPrefix(fields[2], "*"),
+		anyWeekday: strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+func parseCronField(field string, low, high int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+			step = n
+		}
+
+		start, end := low, high
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			n, err := strconv.Atoi(from)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", from)
+			}
+			start, end = n, n
+			if isRange {
+				if end, err = strconv.Atoi(to); err != nil {
+					return 0, fmt.Errorf("invalid value %q", to)
+				}
+			} else if hasStep {
+				end = high
+			}
+		}
+		if start < low || end > high || start > end {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, low, high)
+		}
+		for n := start; n <= end; n += step {
+			set |= 1 << n
+		}
+	}
+	return set, nil
+}
+
+func (c CronSchedule) dayMatches(day time.Time) bool {
+	if c.months&(1<<int(day.Month())) == 0 {
+		return false
+	}
+	dayOfMonth := c.days&(1<<day.Day()) != 0
+	weekday := c.weekdays&(1<<int(day.Weekday())) != 0
+	switch {
+	case c.anyDay && c.anyWeekday:
+		return true
+	case c.anyDay:
+		return weekday
+	case c.anyWeekday:
+		return dayOfMonth
+	default:
+		return dayOfMonth || weekday
+	}
+}
+
+// Next returns the first run strictly after after, in loc. It returns the
+// zero time when the expression never matches, such as "0 0 31 2 *".
+func (c CronSchedule) Next(after time.Time, loc *time.Location) time.Time {
+	after = after.In(locationOrUTC(loc)).Truncate(time.Minute)
+	day := time.Date(after.Year(), after.Month(), after.Day(), 0, 0, 0, 0, after.Location())
+	// Every day and month combination comes round within eight years
+	for range 8 * 366 {
+		if c.dayMatches(day) {
+			for hour := range 24 {
+				if c.hours&(1<<hour) == 0 {
+					continue
+				}
+				for minutes := c.minutes; minutes != 0; minutes &= minutes - 1 {
+					minute := bits.TrailingZeros64(minutes)
+					run := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, day.Location())
+					if run.After(after) {
+						return run
+					}
+				}
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return time.Time{}
+}
+
+// IncomeRun is one attempt at a scheduled income.
+type IncomeRun struct {
+	At            time.Time
+	TransactionID string `json:",omitempty"`
+	Error         string `json:",omitempty"`
+}
+
+// ScheduledIncome allocates Amount automatically on a cron schedule in the
+// user's time zone, such as a paycheck arriving on payday. Failed runs are
+// retried with backoff before waiting for the next scheduled run.
+type ScheduledIncome struct {
+	ID          string
+	Cron        string
+	Amount      Money
+	Description string
+	NextRun     time.Time
+	// Failed attempts since the last scheduled run
+	Retries int
+	// Latest runs, oldest first
+	Runs []IncomeRun
+}
+
+func (s ScheduledIncome) schedule() (CronSchedule, error) {
+	return ParseCron(s.Cron)
+}
+
+func (u *User) scheduledIncome(id string) (int, error) {
+	i := slices.IndexFunc(u.ScheduledIncomes, func(s ScheduledIncome) bool { return s.ID == id })
+	if i < 0 {
+		return -1, fmt.Errorf("scheduled income %s not found", id)
+	}
+	return i, nil
+}
+
+// ScheduleIncome allocates amount to the user on the cron schedule.
+func (s *FinanceService) ScheduleIncome(ctx context.Context, userID, cron string, amount Money, description string) (ScheduledIncome, error) {
+	schedule, err := ParseCron(cron)
+	if err != nil {
+		return ScheduledIncome{}, err
+	}
+	if !amount.Amount.IsPositive() {
+		return ScheduledIncome{}, errors.New("scheduled income must be positive")
+	}
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return ScheduledIncome{}, err
+	}
+	next := schedule.Next(s.now(), user.Location())
+	if next.IsZero() {
+		return ScheduledIncome{}, fmt.Errorf("cron expression %q never runs", cron)
+	}
+	income := ScheduledIncome{
+		ID:          NewID(),
+		Cron:        schedule.Expr,
+		Amount:      amount,
+		Description: description,
+		NextRun:     next,
+	}
+	user.ScheduledIncomes = append(user.ScheduledIncomes, income)
+
+	if err := s.save(ctx, user, "schedule_income"); err != nil {
+		return ScheduledIncome{}, err
+	}
+	s.Telemetry.Track(ctx, "income_schedule", "schedule", userID, nil)
+	return income, nil
+}
+
+func (s *FinanceService) ScheduledIncomes(ctx context.Context, userID string) ([]ScheduledIncome, error) {
+	defer s.readLockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return user.ScheduledIncomes, nil
+}
+
+func (s *FinanceService) UnscheduleIncome(ctx context.Context, userID, scheduleID string) error {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	i, err := user.scheduledIncome(scheduleID)
+	if err != nil {
+		return err
+	}
+	user.ScheduledIncomes = slices.Delete(user.ScheduledIncomes, i, i+1)
+
+	return s.save(ctx, user, "unschedule_income")
+}
+
+// IncomeScheduler allocates due scheduled incomes.
+type IncomeScheduler struct {
+	Service *FinanceService
+	Users   UserIterator
+}
+
+// RunDue allocates every scheduled income due at now. Failures are recorded
+// in the run history and retried later.
+func (r *IncomeScheduler) RunDue(ctx context.Context, now time.Time) error {
+	var due []string
+	err := r.Users.ForEach(ctx, func(user *User) error {
+		if user.Archived() {
+			return nil
+		}
+		for _, income := range user.ScheduledIncomes {
+			if !income.NextRun.After(now) {
+				due = append(due, user.ID)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, userID := range due {
+		failures, err := r.runUser(ctx, userID, now)
+		if err != nil {
+			return err
+		}
+		errs = append(errs, failures...)
+	}
+	return errors.Join(errs...)
+}
+
+// runUser allocates the user's due incomes while holding the user. It
+// returns the allocation failures, and an error only when the user cannot
+// be loaded or saved.
+func (r *IncomeScheduler) runUser(ctx context.Context, userID string, now time.Time) (failures []error, err error) {
+	s := r.Service
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, income := range user.ScheduledIncomes {
+		if !income.NextRun.After(now) {
+			if err := s.loadIncomeBaseline(ctx, user, income.Amount.Currency); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var recorded []Transaction
+	ran := false
+	for i := range user.ScheduledIncomes {
+		income := &user.ScheduledIncomes[i]
+		if income.NextRun.After(now) {
+			continue
+		}
+		ran = true
+
+		run := IncomeRun{At: now}
+		tx, err := r.allocate(user, *income, now)
+		if err == nil {
+			run.TransactionID = tx.ID
+			recorded = append(recorded, tx)
+		} else {
+			run.Error = err.Error()
+			s.log().WarnContext(ctx, "scheduled income failed",
+				LogKeyUserID, userID, "schedule_id", income.ID, "retries", income.Retries, "error", err)
+			failures = append(failures, fmt.Errorf("user %s scheduled income %s: %w", userID, income.ID, err))
+		}
+		income.Runs = append(income.Runs, run)
+		if len(income.Runs) > incomeRunHistory {
+			income.Runs = income.Runs[len(income.Runs)-incomeRunHistory:]
+		}
+
+		if err != nil && income.Retries < len(incomeRetryDelays) {
+			income.NextRun = now.Add(incomeRetryDelays[income.Retries])
+			income.Retries++
+			continue
+		}
+		income.Retries = 0
+		schedule, parseErr := income.schedule()
+		if parseErr != nil {
+			return failures, parseErr
+		}
+		income.NextRun = schedule.Next(now, user.Location())
+	}
+	if !ran {
+		return nil, nil
+	}
+
+	if err := s.save(ctx, user, "run_scheduled_income"); err != nil {
+		return failures, err
+	}
+	if len(recorded) > 0 {
+		for _, tx := range recorded {
+			s.log().InfoContext(ctx, "allocated scheduled income",
+				LogKeyUserID, userID, LogKeyTransactionID, tx.ID, "amount", tx.Amount.String())
+		}
+		s.publishLedger(user, recorded...)
+	}
+	return failures, nil
+}
+
+// allocate allocates the scheduled income on a copy of the user, so a
+// failed allocation leaves the balances as they were.
+func (r *IncomeScheduler) allocate(user *User, income ScheduledIncome, now time.Time) (Transaction, error) {
+	if err := r.Service.quotaFor(user.ID).Check(QuotaTransactions, user.TransactionCount(), 1); err != nil {
+		return Transaction{}, err
+	}
+	trial, err := user.clone()
+	if err != nil {
+		return Transaction{}, err
+	}
+	if err := trial.AllocateIncome(income.Amount, now, income.Description); err != nil {
+		return Transaction{}, err
+	}
+	// Keep the schedules being updated by the caller
+	trial.ScheduledIncomes = user.ScheduledIncomes
+	*user = *trial
+	return user.Incomes[len(user.Incomes)-1], nil
+}
+
+// Run calls RunDue every interval until ctx is cancelled. Due times are
+// checked against the service's clock rather than the ticker's.
+func (r *IncomeScheduler) Run(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.RunDue(ctx, r.Service.now()); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package arus
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// IncomeSource is where an income came from, so salary can be told apart
+// from side income in summaries and flow reports.
+type IncomeSource int
+
+const (
+	UnspecifiedSource IncomeSource = iota
+	// Salary and wages
+	EmployerSource
+	// Freelance and consulting work
+	ClientSource
+	RentalSource
+	// Dividends and other payouts of holdings
+	DividendSource
+	OtherSource
+)
+
+var incomeSourceCodes = enumCodes[IncomeSource]{
+	name: "income source",
+	codes: map[IncomeSource]string{
+		UnspecifiedSource: "unspecified",
+		EmployerSource:    "employer",
+		ClientSource:      "client",
+		RentalSource:      "rental",
+		DividendSource:    "dividends",
+		OtherSource:       "other",
+	},
+	unknown: OtherSource,
+}
+
+// ParseIncomeSource reads an income source code, returning OtherSource for
+// codes this version does not know.
+func ParseIncomeSource(code string) IncomeSource {
+	return incomeSourceCodes.parse(code)
+}
+
+func (s IncomeSource) Code() string {
+	return incomeSourceCodes.code(s)
+}
+
+func (s IncomeSource) String() string {
+	return s.Code()
+}
+
+// Name is the source's node name in flow reports.
+func (s IncomeSource) Name() string {
+	names := map[IncomeSource]string{
+		UnspecifiedSource: "Unspecified income",
+		EmployerSource:    "Employer",
+		ClientSource:      "Clients",
+		RentalSource:      "Rental",
+		DividendSource:    "Dividends",
+		OtherSource:       "Other income",
+	}
+	if name, ok := names[s]; ok {
+		return name
+	}
+	return names[OtherSource]
+}
+
+// MarshalText is also used by encoding/json for map keys, so
+// map[IncomeSource]... serializes with codes too.
+func (s IncomeSource) MarshalText() ([]byte, error) {
+	return []byte(s.Code()), nil
+}
+
+func (s *IncomeSource) UnmarshalText(text []byte) error {
+	*s = incomeSourceCodes.parse(string(text))
+	return nil
+}
+
+func (s IncomeSource) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Code())
+}
+
+func (s *IncomeSource) UnmarshalJSON(data []byte) error {
+	value, err := incomeSourceCodes.unmarshalJSON(data)
+	*s = value
+	return err
+}
+
+func (s IncomeSource) Value() (driver.Value, error) {
+	return s.Code(), nil
+}
+
+func (s *IncomeSource) Scan(src any) error {
+	value, err := incomeSourceCodes.scan(src)
+	*s = value
+	return err
+}
+
+// AllocateIncomeFrom allocates the income like AllocateIncome and records
+// where it came from.
+func (u *User) AllocateIncomeFrom(income Money, date time.Time, description string, source IncomeSource) error {
+	if err := u.AllocateIncome(income, date, description); err != nil {
+		return err
+	}
+	u.Incomes[len(u.Incomes)-1].Source = source
+	return nil
+}
+
+// incomeBySource totals the incomes in currency by their source, leaving
+// out incomes without one.
+func incomeBySource(incomes []Transaction, currency string) map[IncomeSource]Money {
+	totals := make(map[IncomeSource]Money)
+	for _, income := range incomes {
+		if income.Source == UnspecifiedSource || income.Amount.Currency != currency {
+			continue
+		}
+		total, ok := totals[income.Source]
+		if !ok {
+			total = NewMoneyZero(currency)
+		}
+		totals[income.Source] = total.Add(income.Amount)
+	}
+	return totals
+}
+
+// AllocateIncomeFrom allocates an income like AllocateIncome, recording
+// where it came from.
+func (s *FinanceService) AllocateIncomeFrom(ctx context.Context, userID string, income Money, source IncomeSource) (err error) {
+	ctx, span := s.startSpan(ctx, "AllocateIncome", userID)
+	defer endSpan(span, &err)
+
+	claim, err := s.claimIdempotencyKey(ctx, userID, "allocate_income", income.Amount.String(), income.Currency, source.Code())
+	if err != nil || claim.isReplay() {
+		return err
+	}
+	defer claim.settle(ctx, &err)
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.loadIncomeBaseline(ctx, user, income.Currency); err != nil {
+		return err
+	}
+
+	if err := s.quotaFor(userID).Check(QuotaTransactions, user.TransactionCount(), 1); err != nil {
+		return err
+	}
+
+	if err := user.AllocateIncomeFrom(income, s.now(), "", source); err != nil {
+		return err
+	}
+
+	if err := s.save(ctx, user, "allocate_income"); err != nil {
+		return err
+	}
+	recorded := user.Incomes[len(user.Incomes)-1]
+	s.log().InfoContext(ctx, "allocated income",
+		LogKeyUserID, userID, LogKeyTransactionID, recorded.ID, "amount", recorded.Amount.String())
+	s.publishLedger(user, recorded)
+	s.Telemetry.Track(ctx, "allocation", "allocate_income", userID, map[string]string{
+		"rules":  strconv.Itoa(len(user.AllocationRules)),
+		"source": source.Code(),
+	})
+	return nil
+}
@@ -0,0 +1,101 @@
+package arus
+
+import (
+	"fmt"
+	"strings"
+)
+
+// IncomeStatusKind classifies how a period's expenses were covered, from
+// best to worst.
+type IncomeStatusKind int
+
+const (
+	// Income covered all expenses
+	Healthy IncomeStatusKind = iota
+	// Expenses exceeded income, but the Expense fund absorbed it
+	Deficit
+	// Emergency funds were tapped to cover expenses
+	EmergencyUsed
+	// The cascade reached Savings to cover expenses
+	SavingsUsed
+)
+
+func (k IncomeStatusKind) String() string {
+	names := [...]string{"Healthy", "Deficit", "EmergencyUsed", "SavingsUsed"}
+	if k < 0 || int(k) >= len(names) {
+		return "Unknown"
+	}
+	return names[k]
+}
+
+// IncomeStatus is the outcome of evaluating a period. Amounts are positive
+// magnitudes.
+type IncomeStatus struct {
+	Kind          IncomeStatusKind
+	Period        Period
+	TotalIncome   Money
+	TotalExpense  Money
+	EmergencyUsed Money
+	SavingsUsed   Money
+	// How much expenses exceeded income; zero when income covered them
+	Shortfall Money
+}
+
+func (s IncomeStatus) String() string {
+	switch s.Kind {
+	case EmergencyUsed, SavingsUsed:
+		var funds []string
+		if s.EmergencyUsed.Amount.IsPositive() {
+			funds = append(funds, "Emergency funds ("+s.EmergencyUsed.Format(LocaleEnUS)+")")
+		}
+		if s.SavingsUsed.Amount.IsPositive() {
+			funds = append(funds, "Savings funds ("+s.SavingsUsed.Format(LocaleEnUS)+")")
+		}
+		return fmt.Sprintf("Warning: You have used %s to cover your expenses. "+
+			"Consider adjusting your lifestyle or increasing your income.", strings.Join(funds, " and "))
+	case Deficit:
+		return fmt.Sprintf("Your expenses exceed your income by %s.", s.Shortfall.Format(LocaleEnUS))
+	default:
+		return "Your income covers your expenses."
+	}
+}
+
+// CheckIncomeStatus evaluates the period from the deductions recorded on its
+// expenses: which funds were actually tapped, and whether income covered
+// spending.
+func (u *User) CheckIncomeStatus(period Period) IncomeStatus {
+	summary := u.GetPeriodSummary(period)
+	currency := u.Currency()
+
+	status := IncomeStatus{
+		Period:        period,
+		TotalIncome:   summary.TotalIncome.Abs(),
+		TotalExpense:  summary.TotalExpense.Abs(),
+		EmergencyUsed: NewMoneyZero(currency),
+		SavingsUsed:   NewMoneyZero(currency),
+		Shortfall:     NewMoneyZero(currency),
+	}
+
+	if used, ok := summary.Deductions[Emergency]; ok {
+		status.EmergencyUsed = used
+	}
+	if used, ok := summary.Deductions[Savings]; ok {
+		status.SavingsUsed = used
+	}
+
+	if status.TotalExpense.Amount.GreaterThan(status.TotalIncome.Amount) {
+		status.Shortfall = status.TotalExpense.Subtract(status.TotalIncome)
+	}
+
+	switch {
+	case status.SavingsUsed.Amount.IsPositive():
+		status.Kind = SavingsUsed
+	case status.EmergencyUsed.Amount.IsPositive():
+		status.Kind = EmergencyUsed
+	case status.Shortfall.Amount.IsPositive():
+		status.Kind = Deficit
+	default:
+		status.Kind = Healthy
+	}
+	return status
+}
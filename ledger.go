@@ -0,0 +1,257 @@
+package arus
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// LedgerClass is the kind of a ledger account, which decides the side its
+// balance normally sits on.
+type LedgerClass int
+
+const (
+	// Money the user holds: the categories
+	LedgerAssets LedgerClass = iota
+	// Money the user owes
+	LedgerLiabilities
+	LedgerEquity
+	// Where money comes from
+	LedgerIncome
+	// Where money goes
+	LedgerExpenses
+)
+
+var ledgerClassCodes = enumCodes[LedgerClass]{
+	name: "ledger class",
+	codes: map[LedgerClass]string{
+		LedgerAssets:      "assets",
+		LedgerLiabilities: "liabilities",
+		LedgerEquity:      "equity",
+		LedgerIncome:      "income",
+		LedgerExpenses:    "expenses",
+	},
+	unknown: LedgerAssets,
+}
+
+func (c LedgerClass) Code() string {
+	return ledgerClassCodes.code(c)
+}
+
+// String returns the name of the class's root account, such as "Assets".
+func (c LedgerClass) String() string {
+	names := [...]string{"Assets", "Liabilities", "Equity", "Income", "Expenses"}
+	if c < 0 || int(c) >= len(names) {
+		return "Unknown"
+	}
+	return names[c]
+}
+
+// LedgerAccount is an account of the user's double-entry ledger. Name is
+// also the account's node in flow reports.
+type LedgerAccount struct {
+	Class LedgerClass
+	Name  string
+}
+
+// String returns the account's full name, such as "Assets:Savings"; an
+// account named after its class is the root account itself.
+func (a LedgerAccount) String() string {
+	if a.Name == a.Class.String() {
+		return a.Name
+	}
+	return a.Class.String() + ":" + a.Name
+}
+
+// Ledger accounts besides the categories
+var (
+	IncomeAccount        = LedgerAccount{Class: LedgerIncome, Name: FlowIncome}
+	SpendingAccount      = LedgerAccount{Class: LedgerExpenses, Name: FlowSpending}
+	DebtAccount          = LedgerAccount{Class: LedgerLiabilities, Name: FlowDebt}
+	FXGainAccount        = LedgerAccount{Class: LedgerIncome, Name: FlowFXGain}
+	FXLossAccount        = LedgerAccount{Class: LedgerExpenses, Name: FlowFXLoss}
+	CapitalGainsAccount  = LedgerAccount{Class: LedgerIncome, Name: FlowCapitalGains}
+	CapitalLossesAccount = LedgerAccount{Class: LedgerExpenses, Name: FlowCapitalLosses}
+)
+
+// CategoryLedgerAccount returns the account holding the category's
+// balance: an asset, except for Owed, which is a liability.
+func CategoryLedgerAccount(category CategoryType) LedgerAccount {
+	if category == Owed {
+		return LedgerAccount{Class: LedgerLiabilities, Name: category.String()}
+	}
+	return LedgerAccount{Class: LedgerAssets, Name: category.String()}
+}
+
+// LedgerEntry is one flow of money: Amount is debited to Debit and credited
+// to Credit, so every entry balances.
+type LedgerEntry struct {
+	// ID of the transaction or trade behind the entry; empty for envelope
+	// assignments
+	Source      string
+	Date        time.Time
+	Description string
+	Debit       LedgerAccount
+	Credit      LedgerAccount
+	// Always positive
+	Amount Money
+}
+
+// LedgerBalance is an account's balance in one currency: its debits minus
+// its credits, so assets and expenses are normally positive and income
+// negative.
+type LedgerBalance struct {
+	Account LedgerAccount
+	Balance Money
+}
+
+// Journal returns the user's history as double-entry ledger entries,
+// oldest first:
+//   - incomes credit Income and debit the categories they were allocated to
+//   - expenses credit the categories that covered them and debit Spending,
+//     or Debt for loan payments
+//   - envelope assignments move money between categories
+//   - cash withdrawals move money into Cash; truing up Cash debits
+//     Spending with the cash gone missing, or credits it with cash found
+//   - transfers from and to the user's other books go through Book
+//     transfers
+//   - sales credit Investment with the proceeds and debit the target, with
+//     the realized gain credited to Capital gains (a loss is debited to
+//     Capital losses)
+//   - realized gains on currency conversions are credited to FX gain and
+//     debited to Income, as the converted amounts already include them;
+//     losses go the other way through FX loss
+//
+// Voided expenses and BalanceAdjustments are not part of it.
+func (u *User) Journal() []LedgerEntry {
+	return u.journal(u.Incomes, u.Expenses)
+}
+
+func (u *User) journal(incomes, expenses []Transaction) []LedgerEntry {
+	var entries []LedgerEntry
+	add := func(source string, date time.Time, description string, debit, credit LedgerAccount, amount Money) {
+		if amount.IsNegative() {
+			debit, credit = credit, debit
+			amount = amount.Abs()
+		}
+		if amount.IsZero() {
+			return
+		}
+		entries = append(entries, LedgerEntry{
+			Source:      source,
+			Date:        date,
+			Description: description,
+			Debit:       debit,
+			Credit:      credit,
+			Amount:      amount,
+		})
+	}
+	fx := func(tx Transaction) {
+		if tx.FX != nil {
+			add(tx.ID, tx.Date, tx.Description, IncomeAccount, FXGainAccount, tx.FX.Gain)
+		}
+	}
+
+	for _, income := range incomes {
+		for _, allocation := range income.Allocations {
+			add(income.ID, income.Date, income.Description, CategoryLedgerAccount(allocation.Category), IncomeAccount, allocation.Amount)
+		}
+		fx(income)
+	}
+	loanPayments := u.loanPayments()
+	for _, expense := range expenses {
+		if !expense.Counts() {
+			continue
+		}
+		target := SpendingAccount
+		if loanPayments[expense.ID] {
+			target = DebtAccount
+		}
+		if expense.Settles != "" {
+			target = ReceivableAccount
+		}
+		for _, deduction := range expense.Deductions {
+			if deduction.Amount.IsNegative() {
+				// Refunds credit the spending back to the category, and
+				// settlements what the category was owed
+				add(expense.ID, expense.Date, expense.Description, CategoryLedgerAccount(deduction.Category), target, deduction.Amount.Abs())
+				continue
+			}
+			add(expense.ID, expense.Date, expense.Description, target, CategoryLedgerAccount(deduction.Category), deduction.Amount.Abs())
+		}
+		// Others' shares are owed to the user rather than spent
+		shared := Money{Amount: expense.Spent().Amount.Sub(expense.Amount.Amount), Currency: expense.Amount.Currency}
+		if shared.Amount.IsPositive() {
+			add(expense.ID, expense.Date, expense.Description, ReceivableAccount, target, shared)
+		}
+		fx(expense)
+	}
+	for _, assignment := range u.EnvelopeAssignments {
+		add("", assignment.Date, "", CategoryLedgerAccount(assignment.To), CategoryLedgerAccount(assignment.From), assignment.Amount)
+	}
+	cash := CategoryLedgerAccount(Cash)
+	for _, withdrawal := range u.CashWithdrawals {
+		add(withdrawal.ID, withdrawal.Date, withdrawal.Description, cash, CategoryLedgerAccount(withdrawal.From), withdrawal.Amount)
+	}
+	for _, adjustment := range u.CashAdjustments {
+		add(adjustment.ID, adjustment.Date, adjustment.Reason, cash, SpendingAccount, adjustment.Amount)
+	}
+	for _, transfer := range u.BookTransfers {
+		add(transfer.ID, transfer.Date, transfer.Description, CategoryLedgerAccount(transfer.Category), BookTransfersAccount, transfer.Amount)
+	}
+	investment := CategoryLedgerAccount(Investment)
+	for _, trade := range u.Trades {
+		if !trade.IsSale() || trade.Target == nil {
+			continue
+		}
+		description := "Sale of " + trade.Ticker
+		if trade.RealizedGain.IsNegative() {
+			add(trade.ID, trade.Date, description, CapitalLossesAccount, investment, trade.RealizedGain.Abs())
+		} else {
+			add(trade.ID, trade.Date, description, investment, CapitalGainsAccount, trade.RealizedGain)
+		}
+		add(trade.ID, trade.Date, description, CategoryLedgerAccount(*trade.Target), investment, trade.Amount)
+	}
+
+	slices.SortStableFunc(entries, func(a, b LedgerEntry) int { return a.Date.Compare(b.Date) })
+	return entries
+}
+
+// LedgerBalances adds entries up into the balance of each account in each
+// currency, sorted by account and currency.
+func LedgerBalances(entries []LedgerEntry) []LedgerBalance {
+	totals := ledgerTotals(entries)
+	balances := make([]LedgerBalance, 0, len(totals))
+	for account, byCurrency := range totals {
+		for _, balance := range byCurrency {
+			balances = append(balances, LedgerBalance{Account: account, Balance: balance})
+		}
+	}
+	slices.SortFunc(balances, func(a, b LedgerBalance) int {
+		return cmp.Or(
+			cmp.Compare(a.Account.Class, b.Account.Class),
+			cmp.Compare(a.Account.Name, b.Account.Name),
+			cmp.Compare(a.Balance.Currency, b.Balance.Currency),
+		)
+	})
+	return balances
+}
+
+func ledgerTotals(entries []LedgerEntry) map[LedgerAccount]map[string]Money {
+	totals := make(map[LedgerAccount]map[string]Money)
+	add := func(account LedgerAccount, amount Money) {
+		if totals[account] == nil {
+			totals[account] = make(map[string]Money)
+		}
+		current, exists := totals[account][amount.Currency]
+		if !exists {
+			current = NewMoneyZero(amount.Currency)
+		}
+		totals[account][amount.Currency] = Money{Amount: current.Amount.Add(amount.Amount), Currency: amount.Currency}
+	}
+	for _, entry := range entries {
+		add(entry.Debit, entry.Amount)
+		add(entry.Credit, Money{Amount: entry.Amount.Amount.Neg(), Currency: entry.Amount.Currency})
+	}
+	return totals
+}
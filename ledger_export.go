@@ -0,0 +1,261 @@
+package arus
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// LedgerFormat is a format the ledger can be exported in.
+type LedgerFormat string
+
+const (
+	// Beancount plain-text ledger, accounts opened where first used
+	LedgerBeancount LedgerFormat = "beancount"
+	// GnuCash chart of accounts, for File > Import > Import Accounts from CSV
+	LedgerGnuCashAccounts LedgerFormat = "gnucash-accounts"
+	// GnuCash transactions in the layout of GnuCash's own CSV export, for
+	// its transaction importer's "GnuCash Export Format" preset
+	LedgerGnuCashTransactions LedgerFormat = "gnucash-transactions"
+)
+
+// ledgerPath is the account's full name in exported ledgers. Accounting
+// tools expect every account below a root, so an account named after its
+// class, such as Income, is exported as Income:Income.
+func ledgerPath(account LedgerAccount) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-':
+			return r
+		case r == ' ':
+			return '-'
+		}
+		return -1
+	}, account.Name)
+	return account.Class.String() + ":" + name
+}
+
+type ledgerPosting struct {
+	Account LedgerAccount
+	// Positive for debits
+	Amount Money
+}
+
+// ledgerTransaction is the entries of one source in one currency, as a
+// single transaction of several postings.
+type ledgerTransaction struct {
+	Source      string
+	Date        time.Time
+	Description string
+	Currency    string
+	Postings    []ledgerPosting
+}
+
+// ledgerTransactions groups entries by source and currency, merging the
+// postings to the same account. Envelope assignments stay one transaction
+// each.
+func ledgerTransactions(entries []LedgerEntry) []ledgerTransaction {
+	var transactions []ledgerTransaction
+	index := make(map[[2]string]int)
+	post := func(tx *ledgerTransaction, account LedgerAccount, amount Money) {
+		for i := range tx.Postings {
+			if tx.Postings[i].Account == account {
+				tx.Postings[i].Amount = Money{Amount: tx.Postings[i].Amount.Amount.Add(amount.Amount), Currency: amount.Currency}
+				return
+			}
+		}
+		tx.Postings = append(tx.Postings, ledgerPosting{Account: account, Amount: amount})
+	}
+	for _, entry := range entries {
+		key := [2]string{entry.Source, entry.Amount.Currency}
+		i, exists := index[key]
+		if !exists || entry.Source == "" {
+			transactions = append(transactions, ledgerTransaction{
+				Source:      entry.Source,
+				Date:        entry.Date,
+				Description: entry.Description,
+				Currency:    entry.Amount.Currency,
+			})
+			i = len(transactions) - 1
+			index[key] = i
+		}
+		post(&transactions[i], entry.Debit, entry.Amount)
+		post(&transactions[i], entry.Credit, Money{Amount: entry.Amount.Amount.Neg(), Currency: entry.Amount.Currency})
+	}
+	for i := range transactions {
+		transactions[i].Postings = slices.DeleteFunc(transactions[i].Postings, func(p ledgerPosting) bool {
+			return p.Amount.IsZero()
+		})
+	}
+	return transactions
+}
+
+func ledgerTransactionDescription(tx ledgerTransaction) string {
+	if tx.Description != "" {
+		return tx.Description
+	}
+	if tx.Source == "" {
+		return "Envelope assignment"
+	}
+	return "Transaction " + tx.Source
+}
+
+// WriteBeancount writes entries as a Beancount ledger: an open directive
+// for each account on the day it is first used, then one transaction per
+// source, tagged with the source's ID.
+func WriteBeancount(w io.Writer, entries []LedgerEntry) error {
+	transactions := ledgerTransactions(entries)
+
+	var opened []string
+	openedOn := make(map[string]time.Time)
+	for _, tx := range transactions {
+		for _, posting := range tx.Postings {
+			path := ledgerPath(posting.Account)
+			if _, exists := openedOn[path]; !exists {
+				opened = append(opened, path)
+				openedOn[path] = tx.Date
+			}
+		}
+	}
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", " ")
+
+	var b strings.Builder
+	for _, path := range opened {
+		fmt.Fprintf(&b, "%s open %s\n", openedOn[path].Format(time.DateOnly), path)
+	}
+	for _, tx := range transactions {
+		fmt.Fprintf(&b, "\n%s * \"%s\"\n", tx.Date.Format(time.DateOnly), quote.Replace(ledgerTransactionDescription(tx)))
+		if tx.Source != "" {
+			fmt.Fprintf(&b, "  source: \"%s\"\n", quote.Replace(tx.Source))
+		}
+		for _, posting := range tx.Postings {
+			fmt.Fprintf(&b, "  %-40s %15s %s\n", ledgerPath(posting.Account), posting.Amount.StringFixed(), posting.Amount.Currency)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// gnuCashPath is the GnuCash account holding account's money in currency.
+// GnuCash accounts hold a single currency, so money in currencies other
+// than the main one is kept in a child account named after the currency.
+func gnuCashPath(account LedgerAccount, currency, mainCurrency string) string {
+	path := ledgerPath(account)
+	if currency != mainCurrency {
+		path += ":" + currency
+	}
+	return path
+}
+
+var gnuCashAccountTypes = map[LedgerClass]string{
+	LedgerAssets:      "ASSET",
+	LedgerLiabilities: "LIABILITY",
+	LedgerEquity:      "EQUITY",
+	LedgerIncome:      "INCOME",
+	LedgerExpenses:    "EXPENSE",
+}
+
+// WriteGnuCashAccounts writes the chart of accounts entries use as a
+// GnuCash account import CSV, parents first. Roots and the parents of
+// currency accounts are placeholders.
+func WriteGnuCashAccounts(w io.Writer, entries []LedgerEntry, mainCurrency string) error {
+	type account struct {
+		class       LedgerClass
+		currency    string
+		placeholder bool
+	}
+	accounts := make(map[string]account)
+	var paths []string
+	declare := func(path string, class LedgerClass, currency string, placeholder bool) {
+		if existing, exists := accounts[path]; exists {
+			existing.placeholder = existing.placeholder && placeholder
+			accounts[path] = existing
+			return
+		}
+		accounts[path] = account{class: class, currency: currency, placeholder: placeholder}
+		paths = append(paths, path)
+	}
+	for _, balance := range LedgerBalances(entries) {
+		class, currency := balance.Account.Class, balance.Balance.Currency
+		declare(class.String(), class, mainCurrency, true)
+		if currency != mainCurrency {
+			declare(ledgerPath(balance.Account), class, mainCurrency, true)
+		}
+		declare(gnuCashPath(balance.Account, currency, mainCurrency), class, currency, false)
+	}
+	slices.Sort(paths)
+
+	out := csv.NewWriter(w)
+	out.Write([]string{"type", "full_name", "name", "code", "description", "color", "notes",
+		"commoditym", "commodityn", "hidden", "tax", "place_holder"})
+	for _, path := range paths {
+		a := accounts[path]
+		placeholder := "F"
+		if a.placeholder {
+			placeholder = "T"
+		}
+		name := path[strings.LastIndex(path, ":")+1:]
+		out.Write([]string{gnuCashAccountTypes[a.class], path, name, "", "", "", "",
+			"CURRENCY", a.currency, "F", "F", placeholder})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// WriteGnuCashTransactions writes entries as GnuCash transactions, one row
+// per split, in the columns of GnuCash's own CSV export.
+func WriteGnuCashTransactions(w io.Writer, entries []LedgerEntry, mainCurrency string) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"Date", "Transaction ID", "Number", "Description", "Notes", "Commodity/Currency",
+		"Void Reason", "Action", "Memo", "Full Account Name", "Account Name", "Amount With Sym", "Amount Num.",
+		"Value With Sym", "Value Num.", "Reconcile", "Reconcile Date", "Rate/Price"})
+	for i, tx := range ledgerTransactions(entries) {
+		id := tx.Source
+		if id == "" {
+			id = fmt.Sprintf("assignment-%d", i+1)
+		}
+		for _, posting := range tx.Postings {
+			path := gnuCashPath(posting.Account, posting.Amount.Currency, mainCurrency)
+			amount := posting.Amount.StringFixed()
+			out.Write([]string{tx.Date.Format(time.DateOnly), id, "", ledgerTransactionDescription(tx), "",
+				"CURRENCY::" + tx.Currency, "", "", "", path, path[strings.LastIndex(path, ":")+1:],
+				amount + " " + posting.Amount.Currency, amount, amount + " " + tx.Currency, amount, "n", "", "1"})
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// ExportLedger writes the user's Journal, archived periods included, to w
+// in format.
+func (s *FinanceService) ExportLedger(ctx context.Context, userID string, format LedgerFormat, w io.Writer) (err error) {
+	ctx, span := s.startSpan(ctx, "ExportLedger", userID)
+	defer endSpan(span, &err)
+
+	user, err := s.readUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.loadHistory(ctx, user); err != nil {
+		return err
+	}
+	incomes, expenses, err := s.allArchivedTransactions(ctx, user)
+	if err != nil {
+		return err
+	}
+	entries := user.journal(slices.Concat(incomes, user.Incomes), slices.Concat(expenses, user.Expenses))
+
+	switch format {
+	case LedgerBeancount:
+		return WriteBeancount(w, entries)
+	case LedgerGnuCashAccounts:
+		return WriteGnuCashAccounts(w, entries, user.Currency())
+	case LedgerGnuCashTransactions:
+		return WriteGnuCashTransactions(w, entries, user.Currency())
+	}
+	return fmt.Errorf("unknown ledger format %q", format)
+}
@@ -0,0 +1,305 @@
+package arus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Node name of loan repayments in flow reports
+const FlowDebt = "Debt"
+
+// Longest amortization schedule built, in months
+const maxScheduleMonths = 50 * 12
+
+// Loan is money the user owes, such as a mortgage or a car loan. Payments
+// are expenses paid out of the Expense category; each first covers the
+// interest accrued since the previous payment and then reduces Balance.
+type Loan struct {
+	ID        string
+	Name      string
+	Principal Money
+	// Outstanding principal
+	Balance Money
+	// Annual interest rate, e.g. 0.06 for 6%
+	APR            decimal.Decimal
+	MinimumPayment Money
+	StartDate      time.Time
+	Payments       []LoanPayment
+	// Interest left unpaid by payments smaller than the interest due, owed
+	// on top of the next payment's
+	AccruedInterest Money
+}
+
+// LoanPayment is a payment on a loan, split into interest and principal.
+// TransactionID is the expense that paid it.
+type LoanPayment struct {
+	TransactionID string
+	Date          time.Time
+	Amount        Money
+	Interest      Money
+	Principal     Money
+}
+
+// AmortizationRow is one monthly payment of a loan's schedule.
+type AmortizationRow struct {
+	Number    int
+	Date      time.Time
+	Payment   Money
+	Interest  Money
+	Principal Money
+	// Outstanding principal after the payment
+	Balance Money
+}
+
+func (l Loan) Validate() error {
+	if l.Name == "" {
+		return errors.New("loan name is required")
+	}
+	if !l.Principal.Amount.IsPositive() {
+		return errors.New("loan principal must be positive")
+	}
+	if l.APR.IsNegative() {
+		return errors.New("loan APR must not be negative")
+	}
+	if l.MinimumPayment.IsNegative() || l.MinimumPayment.Currency != l.Principal.Currency {
+		return errors.New("loan minimum payment must be a non-negative amount in the principal's currency")
+	}
+	return nil
+}
+
+func (l Loan) Repaid() bool {
+	return !l.Balance.Amount.IsPositive() && !l.accrued().Amount.IsPositive()
+}
+
+// accrued returns the interest left unpaid so far, which loans stored
+// before it was kept don't have.
+func (l Loan) accrued() Money {
+	if l.AccruedInterest.Currency == "" {
+		return NewMoneyZero(l.Balance.Currency)
+	}
+	return l.AccruedInterest
+}
+
+// lastPaid is when interest was last settled.
+func (l Loan) lastPaid() time.Time {
+	if len(l.Payments) == 0 {
+		return l.StartDate
+	}
+	return l.Payments[len(l.Payments)-1].Date
+}
+
+// InterestDue is the interest accrued on the balance between the last
+// payment (or the start of the loan) and date, by the day, plus what
+// earlier payments left unpaid.
+func (l Loan) InterestDue(date time.Time) Money {
+	days := date.Sub(l.lastPaid()).Hours() / 24
+	if days <= 0 || l.Repaid() {
+		return l.accrued()
+	}
+	rate := l.APR.Mul(decimal.NewFromFloat(days / 365))
+	return Money{Amount: l.Balance.Amount.Mul(rate), Currency: l.Balance.Currency}.Round().Add(l.accrued())
+}
+
+// Schedule returns the monthly payments that repay the loan from its
+// current balance when paying the minimum payment each month, starting a
+// month after from. Interest is charged at APR/12 per month.
+func (l Loan) Schedule(from time.Time) ([]AmortizationRow, error) {
+	monthlyRate := l.APR.Div(decimal.NewFromInt(12))
+	balance := l.Balance
+	var rows []AmortizationRow
+	for month := 1; balance.Amount.IsPositive(); month++ {
+		if month > maxScheduleMonths {
+			return nil, fmt.Errorf("loan %s is not repaid within %d years at the minimum payment", l.Name, maxScheduleMonths/12)
+		}
+		interest := Money{Amount: balance.Amount.Mul(monthlyRate), Currency: balance.Currency}.Round()
+		if month == 1 {
+			interest = interest.Add(l.accrued())
+		}
+		payment := l.MinimumPayment
+		if !payment.Amount.GreaterThan(interest.Amount) {
+			return nil, fmt.Errorf("minimum payment %s of loan %s does not cover its interest", payment.StringFixed(), l.Name)
+		}
+		if owed := balance.Add(interest); payment.Amount.GreaterThan(owed.Amount) {
+			payment = owed
+		}
+		principal := payment.Subtract(interest)
+		balance = balance.Subtract(principal)
+		rows = append(rows, AmortizationRow{
+			Number:    month,
+			Date:      from.AddDate(0, month, 0),
+			Payment:   payment,
+			Interest:  interest,
+			Principal: principal,
+			Balance:   balance,
+		})
+	}
+	return rows, nil
+}
+
+func (u *User) loan(id string) (int, error) {
+	i := slices.IndexFunc(u.Loans, func(l Loan) bool { return l.ID == id })
+	if i < 0 {
+		return -1, fmt.Errorf("%w: %s", ErrLoanNotFound, id)
+	}
+	return i, nil
+}
+
+// PayLoan pays amount towards the loan out of the Expense category,
+// recording the payment as an expense.
+func (u *User) PayLoan(loanID string, amount Money, date time.Time) (LoanPayment, error) {
+	i, err := u.loan(loanID)
+	if err != nil {
+		return LoanPayment{}, err
+	}
+	loan := u.Loans[i]
+	if !amount.Amount.IsPositive() {
+		return LoanPayment{}, errors.New("loan payment must be positive")
+	}
+	if amount.Currency != loan.Balance.Currency {
+		return LoanPayment{}, &CurrencyMismatchError{Expected: loan.Balance.Currency, Got: amount.Currency}
+	}
+
+	interest := loan.InterestDue(date)
+	if owed := loan.Balance.Add(interest); amount.Amount.GreaterThan(owed.Amount) {
+		return LoanPayment{}, fmt.Errorf("payment %s exceeds the %s owed on loan %s",
+			amount.StringFixed(), owed.StringFixed(), loan.Name)
+	}
+	// Payments smaller than the interest due leave the rest to accrue
+	unpaid := NewMoneyZero(interest.Currency)
+	if interest.Amount.GreaterThan(amount.Amount) {
+		unpaid = interest.Subtract(amount)
+		interest = amount
+	}
+
+	expense := NewExpense(amount, date, "Payment on "+loan.Name)
+	if err := u.ProcessExpenseFrom(expense, Expense); err != nil {
+		return LoanPayment{}, err
+	}
+
+	payment := LoanPayment{
+		TransactionID: expense.ID,
+		Date:          date,
+		Amount:        amount,
+		Interest:      interest,
+		Principal:     amount.Subtract(interest),
+	}
+	loan.Balance = loan.Balance.Subtract(payment.Principal)
+	loan.AccruedInterest = unpaid
+	loan.Payments = append(loan.Payments, payment)
+	u.Loans[i] = loan
+	return payment, nil
+}
+
+// loanPayments returns the IDs of the expenses that paid loans.
+func (u *User) loanPayments() map[string]bool {
+	ids := make(map[string]bool)
+	for _, loan := range u.Loans {
+		for _, payment := range loan.Payments {
+			ids[payment.TransactionID] = true
+		}
+	}
+	return ids
+}
+
+// TotalDebt is the outstanding principal and unpaid interest of every loan
+// in currency.
+func (u *User) TotalDebt(currency string) Money {
+	total := NewMoneyZero(currency)
+	for _, loan := range u.Loans {
+		if loan.Balance.Currency == currency {
+			total = total.Add(loan.Balance).Add(loan.accrued())
+		}
+	}
+	return total
+}
+
+// AddLoan starts tracking a loan. A zero start date means now.
+func (s *FinanceService) AddLoan(ctx context.Context, userID string, loan Loan) (Loan, error) {
+	if err := loan.Validate(); err != nil {
+		return Loan{}, err
+	}
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return Loan{}, err
+	}
+
+	loan.ID = NewID()
+	loan.Balance = loan.Principal
+	loan.Payments = nil
+	if loan.StartDate.IsZero() {
+		loan.StartDate = s.now()
+	}
+	user.Loans = append(user.Loans, loan)
+
+	if err := s.save(ctx, user, "add_loan"); err != nil {
+		return Loan{}, err
+	}
+	s.Telemetry.Track(ctx, "loans", "add", userID, nil)
+	return loan, nil
+}
+
+func (s *FinanceService) PayLoan(ctx context.Context, userID, loanID string, amount Money) (_ LoanPayment, err error) {
+	ctx, span := s.startSpan(ctx, "PayLoan", userID)
+	defer endSpan(span, &err)
+
+	claim, err := s.claimIdempotencyKey(ctx, userID, "pay_loan", loanID, amount.Amount.String(), amount.Currency)
+	if err != nil {
+		return LoanPayment{}, err
+	}
+	if claim.isReplay() {
+		// The payment was recorded by the first request
+		var payment LoanPayment
+		return payment, claim.replay(&payment)
+	}
+	defer claim.settle(ctx, &err)
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return LoanPayment{}, err
+	}
+	if err := s.quotaFor(userID).Check(QuotaTransactions, user.TransactionCount(), 1); err != nil {
+		return LoanPayment{}, err
+	}
+
+	payment, err := user.PayLoan(loanID, amount, s.now())
+	if err != nil {
+		return LoanPayment{}, err
+	}
+
+	if err := s.save(ctx, user, "pay_loan"); err != nil {
+		return LoanPayment{}, err
+	}
+	claim.keep(payment)
+	recorded := user.Expenses[len(user.Expenses)-1]
+	s.log().InfoContext(ctx, "paid loan",
+		LogKeyUserID, userID, LogKeyTransactionID, recorded.ID, "amount", payment.Amount.String(),
+		"interest", payment.Interest.String())
+	s.publishLedger(user, recorded)
+	s.Telemetry.Track(ctx, "loans", "pay", userID, nil)
+	return payment, nil
+}
+
+// LoanSchedule returns the amortization schedule of the loan from now.
+func (s *FinanceService) LoanSchedule(ctx context.Context, userID, loanID string) ([]AmortizationRow, error) {
+	defer s.readLockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	i, err := user.loan(loanID)
+	if err != nil {
+		return nil, err
+	}
+	return user.Loans[i].Schedule(s.now())
+}
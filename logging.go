@@ -0,0 +1,23 @@
+package arus
+
+import (
+	"io"
+	"log/slog"
+)
+
+// Attribute keys shared by arus log records
+const (
+	LogKeyUserID        = "user_id"
+	LogKeyTransactionID = "transaction_id"
+	LogKeyOperation     = "operation"
+)
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// log returns the service's logger, or one that discards everything.
+func (s *FinanceService) log() *slog.Logger {
+	if s.Logger == nil {
+		return discardLogger
+	}
+	return s.Logger
+}
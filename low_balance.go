@@ -0,0 +1,190 @@
+package arus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	InboxLowBalance    InboxItemKind = "low-balance"
+	LowBalancePriority               = 60
+)
+
+// LowBalanceThreshold is the balance below which a category is low: a fixed
+// Amount, or a Percentage of what the category was budgeted for the month.
+type LowBalanceThreshold struct {
+	Amount *Money `json:",omitempty"`
+	// Fraction of the month's allocations and envelope assignments to the
+	// category, as in allocation rules: 0.2 is low below a fifth of them
+	Percentage *decimal.Decimal `json:",omitempty"`
+}
+
+// LowBalance is a category whose balance is below its threshold, announced
+// with EventLowBalance when a debit takes it there.
+type LowBalance struct {
+	Category  CategoryType
+	Balance   Money
+	Threshold Money
+	// Expense that took the balance below the threshold
+	TransactionID string `json:",omitempty"`
+}
+
+// SetLowBalance sets the threshold below which the category is low; nil
+// removes it.
+func (c *Category) SetLowBalance(threshold *LowBalanceThreshold) error {
+	if threshold != nil {
+		switch {
+		case (threshold.Amount == nil) == (threshold.Percentage == nil):
+			return errors.New("low balance threshold needs either an amount or a percentage")
+		case threshold.Amount != nil:
+			if threshold.Amount.Amount.IsNegative() {
+				return errors.New("low balance threshold must not be negative")
+			}
+			if err := c.checkCurrency(*threshold.Amount); err != nil {
+				return err
+			}
+		case !threshold.Percentage.IsPositive() || threshold.Percentage.GreaterThan(decimal.NewFromInt(1)):
+			return fmt.Errorf("low balance percentage %s must be above 0 and at most 1", threshold.Percentage)
+		}
+	}
+	c.LowBalance = threshold
+	return nil
+}
+
+// lowBalanceThreshold returns the balance below which the category is low
+// in the month of now, and false when it has no threshold. Percentages of a
+// month with nothing budgeted yet give none.
+func (u *User) lowBalanceThreshold(category *Category, now time.Time) (Money, bool) {
+	threshold := category.LowBalance
+	switch {
+	case threshold == nil:
+		return Money{}, false
+	case threshold.Amount != nil:
+		return *threshold.Amount, true
+	case threshold.Percentage == nil:
+		return Money{}, false
+	}
+
+	period := u.MonthlyPeriodOf(now)
+	budget := NewMoneyZero(category.Balance.Currency)
+	for _, income := range u.Incomes {
+		if !period.Contains(income.Date) {
+			continue
+		}
+		for _, allocation := range income.Allocations {
+			if allocation.Category == category.Type && allocation.Amount.Currency == budget.Currency {
+				budget = budget.Add(allocation.Amount)
+			}
+		}
+	}
+	for _, assignment := range u.EnvelopeAssignments {
+		if assignment.To == category.Type && period.Contains(assignment.Date) && assignment.Amount.Currency == budget.Currency {
+			budget = budget.Add(assignment.Amount)
+		}
+	}
+	if !budget.Amount.IsPositive() {
+		return Money{}, false
+	}
+	return Money{Amount: budget.Amount.Mul(*threshold.Percentage), Currency: budget.Currency}.Round(), true
+}
+
+// LowBalances returns the categories whose balance is below their
+// threshold at now.
+func (u *User) LowBalances(now time.Time) []LowBalance {
+	var low []LowBalance
+	for _, categoryType := range slices.Sorted(maps.Keys(u.Categories)) {
+		category := u.Categories[categoryType]
+		threshold, ok := u.lowBalanceThreshold(category, now)
+		if !ok {
+			continue
+		}
+		if balance := category.BalanceIn(threshold.Currency); balance.Amount.LessThan(threshold.Amount) {
+			low = append(low, LowBalance{Category: categoryType, Balance: balance, Threshold: threshold})
+		}
+	}
+	return low
+}
+
+func lowBalanceInboxItems(user *User, now time.Time) []InboxItem {
+	var items []InboxItem
+	for _, low := range user.LowBalances(now) {
+		items = append(items, InboxItem{
+			Kind:      InboxLowBalance,
+			Reference: low.Category.Code(),
+			Title: fmt.Sprintf("%s is down to %s, below %s",
+				low.Category, low.Balance.Format(LocaleEnUS), low.Threshold.Format(LocaleEnUS)),
+			Priority: LowBalancePriority,
+		})
+	}
+	return items
+}
+
+// publishLowBalances announces the categories the recorded expenses took
+// below their thresholds, once per category however many expenses it took.
+func (s *FinanceService) publishLowBalances(user *User, recorded []Transaction) {
+	now := s.now()
+	for _, categoryType := range slices.Sorted(maps.Keys(user.Categories)) {
+		category := user.Categories[categoryType]
+		threshold, ok := user.lowBalanceThreshold(category, now)
+		if !ok {
+			continue
+		}
+		debited := NewMoneyZero(threshold.Currency)
+		var last string
+		for _, tx := range recorded {
+			if !tx.Amount.IsNegative() || !tx.Counts() {
+				continue
+			}
+			for _, deduction := range tx.Deductions {
+				if deduction.Category == categoryType && deduction.Amount.Currency == threshold.Currency {
+					debited = debited.Add(deduction.Amount)
+					last = tx.ID
+				}
+			}
+		}
+		if !debited.Amount.IsPositive() {
+			continue
+		}
+		balance := category.BalanceIn(threshold.Currency)
+		if balance.Amount.LessThan(threshold.Amount) && !balance.Add(debited).Amount.LessThan(threshold.Amount) {
+			s.publish(user.ID, EventLowBalance, LowBalance{
+				Category:      categoryType,
+				Balance:       balance,
+				Threshold:     threshold,
+				TransactionID: last,
+			})
+		}
+	}
+}
+
+// SetLowBalanceThreshold sets the balance below which the category is low,
+// such as 100 USD or 20% of the month's budget; nil removes it. Expenses
+// taking the category below it publish EventLowBalance, and the category
+// shows in the inbox while it stays there.
+func (s *FinanceService) SetLowBalanceThreshold(ctx context.Context, userID string, categoryType CategoryType, threshold *LowBalanceThreshold) error {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	category, exists := user.Categories[categoryType]
+	if !exists {
+		return &CategoryNotFoundError{Category: categoryType}
+	}
+	if err := category.SetLowBalance(threshold); err != nil {
+		return err
+	}
+
+	if err := s.save(ctx, user, "set_low_balance_threshold"); err != nil {
+		return err
+	}
+	s.Telemetry.Track(ctx, "alerts", "set_low_balance", userID, map[string]string{"category": categoryType.Code()})
+	return nil
+}
@@ -0,0 +1,407 @@
+package arus
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// DataStore is the repositories of everything a database holds: the users
+// with every part of them, the exchange rate history and the admin action
+// log. A nil Rates or AdminActions leaves that part out of migrations.
+type DataStore struct {
+	Users        *AggregateUserRepository
+	Rates        RateRepository
+	AdminActions AdminActionLog
+}
+
+// Tables a DataDigest covers, in the order Diff reports them
+const (
+	TableUsers           = "users"
+	TableTransactions    = "transactions"
+	TableStatements      = "statements"
+	TableReconciliations = "reconciliations"
+	TableGoals           = "goals"
+	TableRecurringRules  = "recurring_rules"
+	TableExchangeRates   = "exchange_rates"
+	TableAdminActions    = "admin_actions"
+)
+
+var digestTables = []string{
+	TableUsers, TableTransactions, TableStatements, TableReconciliations,
+	TableGoals, TableRecurringRules, TableExchangeRates, TableAdminActions,
+}
+
+// TableDigest counts the rows of a table and sums their hashes, so two
+// tables match only when they hold the same rows, in any order.
+type TableDigest struct {
+	Rows int
+	Sum  [sha256.Size]byte
+}
+
+func (t *TableDigest) add(row any) error {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(data)
+	carry := 0
+	for i := len(t.Sum) - 1; i >= 0; i-- {
+		sum := int(t.Sum[i]) + int(hash[i]) + carry
+		t.Sum[i], carry = byte(sum), sum>>8
+	}
+	t.Rows++
+	return nil
+}
+
+// DataDigest summarizes a data store's contents so two stores can be
+// compared after a migration.
+type DataDigest struct {
+	// Per table, by name
+	Tables map[string]*TableDigest
+	// Total category balance per currency
+	Balances map[string]decimal.Decimal
+}
+
+func NewDataDigest() DataDigest {
+	tables := make(map[string]*TableDigest, len(digestTables))
+	for _, table := range digestTables {
+		tables[table] = &TableDigest{}
+	}
+	return DataDigest{Tables: tables, Balances: make(map[string]decimal.Decimal)}
+}
+
+// Rows returns the number of rows counted in table.
+func (d DataDigest) Rows(table string) int {
+	if t := d.Tables[table]; t != nil {
+		return t.Rows
+	}
+	return 0
+}
+
+// Row of a part of a user kept in a table of its own, in list order
+type userPartRow struct {
+	UserID   string
+	Position int
+	Data     any
+}
+
+// Add counts the user and each of its parts, as rows of the tables they
+// are stored in. The user must hold all of its transactions.
+func (d *DataDigest) Add(user *User) error {
+	document := *user
+	document.Incomes, document.Expenses = nil, nil
+	document.StatementHistory, document.OpenReconciliations = nil, nil
+	document.Goals, document.ScheduledIncomes = nil, nil
+	if err := d.Tables[TableUsers].add(document); err != nil {
+		return fmt.Errorf("encoding user %s: %w", user.ID, err)
+	}
+
+	for _, kind := range []TransactionKind{TransactionIncome, TransactionExpense} {
+		for _, tx := range user.transactionsOf(kind) {
+			if err := d.Tables[TableTransactions].add(userPartRow{UserID: user.ID, Data: struct {
+				Kind        TransactionKind
+				Transaction Transaction
+			}{kind, tx}}); err != nil {
+				return fmt.Errorf("encoding transaction %s: %w", tx.ID, err)
+			}
+		}
+	}
+	parts := []struct {
+		table string
+		rows  int
+		row   func(i int) any
+	}{
+		{TableStatements, len(user.StatementHistory), func(i int) any { return user.StatementHistory[i] }},
+		{TableReconciliations, len(user.OpenReconciliations), func(i int) any { return user.OpenReconciliations[i] }},
+		{TableGoals, len(user.Goals), func(i int) any { return user.Goals[i] }},
+		{TableRecurringRules, len(user.ScheduledIncomes), func(i int) any { return user.ScheduledIncomes[i] }},
+	}
+	for _, part := range parts {
+		for i := range part.rows {
+			if err := d.Tables[part.table].add(userPartRow{UserID: user.ID, Position: i, Data: part.row(i)}); err != nil {
+				return fmt.Errorf("encoding %s of user %s: %w", part.table, user.ID, err)
+			}
+		}
+	}
+
+	for _, category := range user.Categories {
+		currency := category.Balance.Currency
+		d.Balances[currency] = d.Balances[currency].Add(category.Balance.Amount)
+	}
+	return nil
+}
+
+func (d *DataDigest) AddRate(rate ExchangeRate) error {
+	return d.Tables[TableExchangeRates].add(rate)
+}
+
+func (d *DataDigest) AddAdminAction(action AdminAction) error {
+	return d.Tables[TableAdminActions].add(action)
+}
+
+// Diff describes how other differs from d, or returns nil if they match.
+func (d DataDigest) Diff(other DataDigest) error {
+	var errs []error
+	for _, table := range digestTables {
+		ours, theirs := d.Tables[table], other.Tables[table]
+		switch {
+		case ours.Rows != theirs.Rows:
+			errs = append(errs, fmt.Errorf("%s row count %d != %d", table, ours.Rows, theirs.Rows))
+		case ours.Sum != theirs.Sum:
+			errs = append(errs, fmt.Errorf("%s rows differ", table))
+		}
+	}
+
+	currencies := make(map[string]struct{})
+	for currency := range d.Balances {
+		currencies[currency] = struct{}{}
+	}
+	for currency := range other.Balances {
+		currencies[currency] = struct{}{}
+	}
+	sorted := make([]string, 0, len(currencies))
+	for currency := range currencies {
+		sorted = append(sorted, currency)
+	}
+	sort.Strings(sorted)
+
+	for _, currency := range sorted {
+		if !d.Balances[currency].Equal(other.Balances[currency]) {
+			errs = append(errs, fmt.Errorf("%s balance %s != %s",
+				currency, d.Balances[currency].String(), other.Balances[currency].String()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// MigrateData copies every user, with all of its transactions and other
+// parts, every exchange rate and every admin action from one data store
+// into another. It then reads the copies back and verifies that each table
+// holds the same rows as the source, by count and digest. Users, rates and
+// admin actions the destination already held are left out of the
+// verification; those of its users are replaced.
+func MigrateData(ctx context.Context, from, to DataStore, progress func(user *User)) (DataDigest, error) {
+	source := NewDataDigest()
+	migrated := make(map[string]struct{})
+	err := from.Users.ForEach(ctx, func(user *User) error {
+		if err := from.Users.loadTransactions(ctx, user, TransactionQuery{}); err != nil {
+			return err
+		}
+		if err := to.Users.replace(ctx, user); err != nil {
+			return fmt.Errorf("saving user %s: %w", user.ID, err)
+		}
+		if err := source.Add(user); err != nil {
+			return err
+		}
+		migrated[user.ID] = struct{}{}
+		if progress != nil {
+			progress(user)
+		}
+		return nil
+	})
+	if err != nil {
+		return source, err
+	}
+
+	rates, err := migrateRates(ctx, from.Rates, to.Rates, &source)
+	if err != nil {
+		return source, fmt.Errorf("migrating exchange rates: %w", err)
+	}
+	actions, err := migrateAdminActions(ctx, from.AdminActions, to.AdminActions, &source)
+	if err != nil {
+		return source, fmt.Errorf("migrating admin actions: %w", err)
+	}
+
+	destination := NewDataDigest()
+	err = to.Users.ForEach(ctx, func(user *User) error {
+		if _, ok := migrated[user.ID]; !ok {
+			return nil
+		}
+		if err := to.Users.loadTransactions(ctx, user, TransactionQuery{}); err != nil {
+			return err
+		}
+		return destination.Add(user)
+	})
+	if err != nil {
+		return source, fmt.Errorf("reading back destination: %w", err)
+	}
+	if to.Rates != nil {
+		stored, err := to.Rates.Rates(ctx)
+		if err != nil {
+			return source, fmt.Errorf("reading back destination: %w", err)
+		}
+		for _, rate := range stored {
+			if _, ok := rates[rateKey(rate.From, rate.To)+rate.Date.Format(time.DateOnly)]; ok {
+				if err := destination.AddRate(rate); err != nil {
+					return source, err
+				}
+			}
+		}
+	}
+	if to.AdminActions != nil {
+		stored, err := to.AdminActions.Actions(ctx)
+		if err != nil {
+			return source, fmt.Errorf("reading back destination: %w", err)
+		}
+		for _, action := range stored {
+			if _, ok := actions[action.ID]; ok {
+				if err := destination.AddAdminAction(action); err != nil {
+					return source, err
+				}
+			}
+		}
+	}
+
+	if err := source.Diff(destination); err != nil {
+		return source, fmt.Errorf("verification failed: %w", err)
+	}
+	return source, nil
+}
+
+// migrateRates copies every rate of from into to, adding them to digest,
+// and returns the currency pairs and days copied.
+func migrateRates(ctx context.Context, from, to RateRepository, digest *DataDigest) (map[string]struct{}, error) {
+	copied := make(map[string]struct{})
+	if from == nil || to == nil {
+		return copied, nil
+	}
+	rates, err := from.Rates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(rates) == 0 {
+		return copied, nil
+	}
+	if err := to.SaveRates(ctx, rates...); err != nil {
+		return nil, err
+	}
+	for _, rate := range rates {
+		if err := digest.AddRate(rate); err != nil {
+			return nil, err
+		}
+		copied[rateKey(rate.From, rate.To)+rate.Date.Format(time.DateOnly)] = struct{}{}
+	}
+	return copied, nil
+}
+
+// migrateAdminActions records every action of from in to, unless to holds
+// it already, adding them to digest, and returns the IDs copied.
+func migrateAdminActions(ctx context.Context, from, to AdminActionLog, digest *DataDigest) (map[string]struct{}, error) {
+	copied := make(map[string]struct{})
+	if from == nil || to == nil {
+		return copied, nil
+	}
+	actions, err := from.Actions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	held, err := to.Actions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	recorded := make(map[string]AdminAction, len(held))
+	for _, action := range held {
+		recorded[action.ID] = action
+	}
+	for _, action := range actions {
+		if _, ok := recorded[action.ID]; !ok {
+			if err := to.Record(ctx, action); err != nil {
+				return nil, fmt.Errorf("recording action %s: %w", action.ID, err)
+			}
+		}
+		if err := digest.AddAdminAction(action); err != nil {
+			return nil, err
+		}
+		copied[action.ID] = struct{}{}
+	}
+	return copied, nil
+}
+
+// Storage backends selectable from the command line
+var sqlBackends = map[string]struct {
+	driver     string
+	dialect    SQLDialect
+	defaultDSN string
+}{
+	"sqlite":   {driver: "sqlite", dialect: SQLiteDialect, defaultDSN: "arus.db"},
+	"postgres": {driver: "pgx", dialect: PostgresDialect, defaultDSN: os.Getenv("DATABASE_URL")},
+}
+
+// OpenSQLDatabase opens the database of a named backend (sqlite or
+// postgres). An empty dsn uses the backend's default. The caller closes the
+// returned database.
+func OpenSQLDatabase(name, dsn string) (*sql.DB, SQLDialect, error) {
+	backend, ok := sqlBackends[name]
+	if !ok {
+		return nil, SQLDialect{}, fmt.Errorf("unknown backend %q", name)
+	}
+	if dsn == "" {
+		dsn = backend.defaultDSN
+	}
+	if dsn == "" {
+		return nil, SQLDialect{}, fmt.Errorf("no connection string given for backend %s", name)
+	}
+
+	db, err := sql.Open(backend.driver, dsn)
+	if err != nil {
+		return nil, SQLDialect{}, err
+	}
+	return db, backend.dialect, nil
+}
+
+// SQLBackendOptions changes how OpenSQLBackend opens a backend.
+type SQLBackendOptions struct {
+	// Apply pending schema migrations on open, rather than failing with
+	// ErrSchemaOutdated
+	AutoMigrate bool
+	// Encrypts bank account numbers at rest; nil leaves them as stored
+	Keys KeyManager
+}
+
+// OpenSQLBackend opens the data store of a named backend, as
+// OpenSQLDatabase does, with every part of users in its own table. The
+// caller closes the returned database.
+func OpenSQLBackend(ctx context.Context, name, dsn string, opts SQLBackendOptions) (DataStore, *sql.DB, error) {
+	db, dialect, err := OpenSQLDatabase(name, dsn)
+	if err != nil {
+		return DataStore{}, nil, err
+	}
+	store, err := openSQLDataStore(ctx, db, dialect, opts)
+	if err != nil {
+		db.Close()
+		return DataStore{}, nil, err
+	}
+	return store, db, nil
+}
+
+func openSQLDataStore(ctx context.Context, db *sql.DB, dialect SQLDialect, opts SQLBackendOptions) (DataStore, error) {
+	if opts.AutoMigrate {
+		if _, err := Migrate(ctx, db, dialect); err != nil {
+			return DataStore{}, err
+		}
+	}
+	var store DataStore
+	var err error
+	if store.Users, err = NewSQLAggregateUserRepository(ctx, db, dialect, opts.Keys); err != nil {
+		return DataStore{}, err
+	}
+	if store.Rates, err = NewSQLRateRepository(ctx, db, dialect); err != nil {
+		return DataStore{}, err
+	}
+	if store.AdminActions, err = NewSQLAdminActionLog(ctx, db, dialect); err != nil {
+		return DataStore{}, err
+	}
+	return store, nil
+}
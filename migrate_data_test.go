@@ -0,0 +1,187 @@
+package arus
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fillDataStore stores two users with two years of transactions and other
+// parts, a rate and an admin action.
+func fillDataStore(t *testing.T, store DataStore) {
+	t.Helper()
+	ctx := context.Background()
+	start := time.Date(2022, time.January, 5, 0, 0, 0, 0, time.UTC)
+	for _, id := range []string{"u1", "u2"} {
+		user := newFundedUser(t, id, "100", start)
+		for month := 1; month < 24; month++ {
+			date := start.AddDate(0, month, 0)
+			if err := user.AllocateIncome(money(t, "100", "USD"), date, "salary"); err != nil {
+				t.Fatal(err)
+			}
+			if err := user.ProcessExpense(NewExpense(money(t, "30", "USD"), date.AddDate(0, 0, 1), "rent")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		user.Goals = []Goal{{ID: "g1", Name: "Car", Category: Savings, Target: money(t, "5000", "USD"), Priority: 1}}
+		user.StatementHistory = []StatementRecord{{
+			BankAccount: user.Categories[Expense].Accounts[0].BankAccount,
+			Period:      CreateMonthlyPeriod(2023, time.December),
+		}}
+		if err := store.Users.Save(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rate := ExchangeRate{From: "USD", To: "EUR", Rate: money(t, "0.9", "EUR").Amount, Date: start, FetchedAt: start}
+	if err := store.Rates.SaveRates(ctx, rate); err != nil {
+		t.Fatal(err)
+	}
+	action := AdminAction{ID: "a1", Admin: "root", Action: "disable_user", UserID: "u1", At: start, Detail: "abuse"}
+	if err := store.AdminActions.Record(ctx, action); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateData(t *testing.T) {
+	ctx := context.Background()
+	keys, err := NewLocalKeyManager(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		// Encryption of the source and the destination
+		from, to SQLBackendOptions
+		// Changes the destination holds before the migration
+		prepare func(t *testing.T, to DataStore)
+	}{
+		{name: "empty destination"},
+		{name: "encrypted source", from: SQLBackendOptions{Keys: keys}},
+		{name: "encrypted destination", to: SQLBackendOptions{Keys: keys}},
+		{name: "migrated before", prepare: fillDataStore},
+		{name: "destination with other data", prepare: func(t *testing.T, to DataStore) {
+			if err := to.Users.Save(ctx, newFundedUser(t, "other", "10", time.Now())); err != nil {
+				t.Fatal(err)
+			}
+			if err := to.AdminActions.Record(ctx, AdminAction{ID: "other", Admin: "root", Action: "create_user", At: time.Now()}); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{name: "destination with stale transactions", prepare: func(t *testing.T, to DataStore) {
+			stale := NewExpense(money(t, "1", "USD"), time.Date(2021, time.June, 1, 0, 0, 0, 0, time.UTC), "stale")
+			if err := to.Users.Transactions.SaveTransactions(ctx, "u1", TransactionExpense, stale); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to := openTestStore(t, tt.from), openTestStore(t, tt.to)
+			fillDataStore(t, from)
+			if tt.prepare != nil {
+				tt.prepare(t, to)
+			}
+
+			var migrated []string
+			digest, err := MigrateData(ctx, from, to, func(user *User) { migrated = append(migrated, user.ID) })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(migrated) != 2 {
+				t.Errorf("migrated users %v, want u1 and u2", migrated)
+			}
+			want := map[string]int{
+				TableUsers: 2, TableTransactions: 94, TableStatements: 2, TableReconciliations: 0,
+				TableGoals: 2, TableRecurringRules: 0, TableExchangeRates: 1, TableAdminActions: 1,
+			}
+			for table, rows := range want {
+				if got := digest.Rows(table); got != rows {
+					t.Errorf("%s: migrated %d rows, want %d", table, got, rows)
+				}
+			}
+
+			// The destination reads back what the source holds
+			user, err := to.Users.GetByID(ctx, "u1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := user.TransactionCount(); got != 47 {
+				t.Errorf("migrated user has %d transactions, want 47", got)
+			}
+			if got := user.Categories[Savings].Accounts[0].BankAccount.AccountNumber; got != "SAV123" {
+				t.Errorf("migrated account number %q, want SAV123", got)
+			}
+		})
+	}
+}
+
+// digestOf digests everything the data store holds.
+func digestOf(t *testing.T, store DataStore) DataDigest {
+	t.Helper()
+	ctx := context.Background()
+	digest := NewDataDigest()
+	err := store.Users.ForEach(ctx, func(user *User) error {
+		if err := store.Users.loadTransactions(ctx, user, TransactionQuery{}); err != nil {
+			return err
+		}
+		return digest.Add(user)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rates, err := store.Rates.Rates(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rate := range rates {
+		if err := digest.AddRate(rate); err != nil {
+			t.Fatal(err)
+		}
+	}
+	actions, err := store.AdminActions.Actions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range actions {
+		if err := digest.AddAdminAction(action); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return digest
+}
+
+func TestMigrateDataDetectsDifferences(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		// Statement run on the destination after copying, before reading
+		// it back
+		tamper string
+		want   string
+	}{
+		{"lost transaction", `DELETE FROM transactions WHERE id IN (SELECT id FROM transactions LIMIT 1)`, "transactions row count"},
+		{"changed transaction", `UPDATE transactions SET data = replace(data, 'rent', 'Rent') WHERE id IN (SELECT id FROM transactions WHERE data LIKE '%rent%' LIMIT 1)`, "transactions rows differ"},
+		{"changed goal", `UPDATE goals SET data = replace(data, 'Car', 'Boat')`, "goals rows differ"},
+		{"lost statement", `DELETE FROM statements`, "statements row count"},
+		{"changed rate", `UPDATE exchange_rates SET rate = '0.8'`, "exchange_rates rows differ"},
+		{"lost admin action", `DELETE FROM admin_actions`, "admin_actions row count"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to := openTestStore(t, SQLBackendOptions{}), openTestStore(t, SQLBackendOptions{})
+			fillDataStore(t, from)
+			if _, err := MigrateData(ctx, from, to, nil); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := to.Users.db.ExecContext(ctx, tt.tamper); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := digestOf(t, from).Diff(digestOf(t, to)); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Diff = %v, want it to report %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package arus
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrSchemaOutdated is returned by the SQL repositories' constructors when
+// the database has migrations left to apply.
+var ErrSchemaOutdated = errors.New("database schema is out of date; run arus migrate")
+
+// Schema migrations shipped in the binary, named <version>_<name>.sql.
+// Statements end with a semicolon at the end of a line.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migration is one step of the SQL schema.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// MigrationState is a migration and when it was applied; AppliedAt is zero
+// while it is pending.
+type MigrationState struct {
+	Migration
+	AppliedAt time.Time
+}
+
+func (s MigrationState) Pending() bool {
+	return s.AppliedAt.IsZero()
+}
+
+// Migrations returns the embedded migrations, oldest first.
+func Migrations() ([]Migration, error) {
+	names, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	migrations := make([]Migration, 0, len(names))
+	for _, name := range names {
+		base := strings.TrimSuffix(path.Base(name), ".sql")
+		number, label, found := strings.Cut(base, "_")
+		version, err := strconv.Atoi(number)
+		if !found || err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s is not named <version>_<name>.sql", name)
+		}
+		data, err := migrationFiles.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: version, Name: label, SQL: string(data)})
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return a.Version - b.Version })
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("two migrations have version %d", migrations[i].Version)
+		}
+	}
+	return migrations, nil
+}
+
+// statements splits the migration into its statements.
+func (m Migration) statements() []string {
+	var statements []string
+	for _, statement := range strings.SplitAfter(m.SQL, ";\n") {
+		statement = strings.TrimSpace(statement)
+		// Skip what is left after the last statement, such as comments
+		code := slices.DeleteFunc(strings.Split(statement, "\n"), func(line string) bool {
+			line = strings.TrimSpace(line)
+			return line == "" || strings.HasPrefix(line, "--")
+		})
+		if len(code) > 0 {
+			statements = append(statements, strings.TrimSuffix(statement, ";"))
+		}
+	}
+	return statements
+}
+
+// sqlQuerier is a *sql.DB or a *sql.Conn.
+type sqlQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func createMigrationsTable(ctx context.Context, db sqlQuerier) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("creating schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// MigrationStatus returns every embedded migration and whether it has been
+// applied to db.
+func MigrationStatus(ctx context.Context, db *sql.DB) ([]MigrationState, error) {
+	return migrationStatus(ctx, db)
+}
+
+func migrationStatus(ctx context.Context, db sqlQuerier) ([]MigrationState, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := createMigrationsTable(ctx, db); err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at string
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		if applied[version], err = time.Parse(sqlDateLayout, at); err != nil {
+			return nil, fmt.Errorf("decoding migration %d time: %w", version, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, len(migrations))
+	for i, migration := range migrations {
+		states[i] = MigrationState{Migration: migration, AppliedAt: applied[migration.Version]}
+	}
+	return states, nil
+}
+
+// Arbitrary key of the Postgres advisory lock that keeps two processes from
+// migrating at once
+const migrationLockKey = 4_372_911
+
+// Migrate applies the pending migrations to db in order, each in its own
+// transaction, and returns the ones it applied. On Postgres it holds an
+// advisory lock meanwhile, so instances starting together can all migrate
+// on startup.
+func Migrate(ctx context.Context, db *sql.DB, dialect SQLDialect) ([]Migration, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if dialect.Name == PostgresDialect.Name {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+			return nil, fmt.Errorf("locking migrations: %w", err)
+		}
+		defer conn.ExecContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+	}
+
+	// Read the status under the lock, as another process may have just
+	// migrated
+	states, err := migrationStatus(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	var applied []Migration
+	for _, state := range states {
+		if !state.Pending() {
+			continue
+		}
+		if err := applyMigration(ctx, conn, dialect, state.Migration); err != nil {
+			return applied, fmt.Errorf("migration %d %s: %w", state.Version, state.Name, err)
+		}
+		applied = append(applied, state.Migration)
+	}
+	return applied, nil
+}
+
+func applyMigration(ctx context.Context, conn *sql.Conn, dialect SQLDialect, migration Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range migration.statements() {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	if backfill, ok := migrationBackfills[migration.Version]; ok {
+		if err := backfill(ctx, tx, dialect); err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, dialect.rebind(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`),
+		migration.Version, migration.Name, time.Now().UTC().Format(sqlDateLayout))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Data changes SQL alone can't make, run in the transaction of the
+// migration of that version after its statements
+var migrationBackfills = map[int]func(ctx context.Context, tx *sql.Tx, dialect SQLDialect) error{
+	5: indexStoredTransactions,
+}
+
+// Transactions indexed per query of indexStoredTransactions
+const backfillBatchSize = 500
+
+// indexStoredTransactions fills in the amount, bank, tags and categories of
+// the transactions stored before they were indexed, from their data.
+func indexStoredTransactions(ctx context.Context, tx *sql.Tx, dialect SQLDialect) error {
+	// saveIndex only uses the dialect
+	repo := &SQLTransactionRepository{dialect: dialect}
+	var lastUser, lastID string
+	for {
+		rows, err := tx.QueryContext(ctx, dialect.rebind(`SELECT user_id, id, data FROM transactions
+			WHERE user_id > ? OR (user_id = ? AND id > ?) ORDER BY user_id, id LIMIT ?`),
+			lastUser, lastUser, lastID, backfillBatchSize)
+		if err != nil {
+			return err
+		}
+		type stored struct {
+			userID, id string
+			tx         Transaction
+		}
+		var batch []stored
+		for rows.Next() {
+			var userID, id, data string
+			if err := rows.Scan(&userID, &id, &data); err != nil {
+				rows.Close()
+				return err
+			}
+			var t Transaction
+			if err := json.Unmarshal([]byte(data), &t); err != nil {
+				rows.Close()
+				return fmt.Errorf("decoding transaction %s of user %s: %w", id, userID, err)
+			}
+			batch = append(batch, stored{userID: userID, id: id, tx: t})
+			lastUser, lastID = userID, id
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, row := range batch {
+			var bank any
+			if row.tx.Bank != "" {
+				bank = row.tx.Bank
+			}
+			_, err := tx.ExecContext(ctx, dialect.rebind(`UPDATE transactions SET amount = ?, bank = ? WHERE user_id = ? AND id = ?`),
+				row.tx.Amount.Amount.Abs().String(), bank, row.userID, row.id)
+			if err != nil {
+				return err
+			}
+			if err := repo.saveIndex(ctx, tx, row.userID, row.tx); err != nil {
+				return err
+			}
+		}
+		if len(batch) < backfillBatchSize {
+			return nil
+		}
+	}
+}
+
+// checkSchema reports ErrSchemaOutdated when db has pending migrations.
+func checkSchema(ctx context.Context, db *sql.DB) error {
+	states, err := MigrationStatus(ctx, db)
+	if err != nil {
+		return err
+	}
+	pending := 0
+	for _, state := range states {
+		if state.Pending() {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return fmt.Errorf("%w: %d migrations pending", ErrSchemaOutdated, pending)
+	}
+	return nil
+}
@@ -0,0 +1,5 @@
+-- Each user aggregate as a JSON document
+CREATE TABLE IF NOT EXISTS users (
+	id TEXT PRIMARY KEY,
+	data TEXT NOT NULL
+);
@@ -0,0 +1,12 @@
+-- Users' transactions apart from the user document, by date
+CREATE TABLE IF NOT EXISTS transactions (
+	user_id TEXT NOT NULL,
+	id TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	date TEXT NOT NULL,
+	data TEXT NOT NULL,
+	PRIMARY KEY (user_id, id)
+);
+
+CREATE INDEX IF NOT EXISTS transactions_by_date
+	ON transactions (user_id, kind, date, id);
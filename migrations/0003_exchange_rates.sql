@@ -0,0 +1,9 @@
+-- Historical daily exchange rates
+CREATE TABLE IF NOT EXISTS exchange_rates (
+	from_currency TEXT NOT NULL,
+	to_currency TEXT NOT NULL,
+	day TEXT NOT NULL,
+	rate TEXT NOT NULL,
+	fetched_at TEXT NOT NULL,
+	PRIMARY KEY (from_currency, to_currency, day)
+);
@@ -0,0 +1,29 @@
+-- Parts of users kept apart from the user document, one JSON document per
+-- row in list order
+CREATE TABLE IF NOT EXISTS statements (
+	user_id TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	data TEXT NOT NULL,
+	PRIMARY KEY (user_id, position)
+);
+
+CREATE TABLE IF NOT EXISTS reconciliations (
+	user_id TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	data TEXT NOT NULL,
+	PRIMARY KEY (user_id, position)
+);
+
+CREATE TABLE IF NOT EXISTS goals (
+	user_id TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	data TEXT NOT NULL,
+	PRIMARY KEY (user_id, position)
+);
+
+CREATE TABLE IF NOT EXISTS recurring_rules (
+	user_id TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	data TEXT NOT NULL,
+	PRIMARY KEY (user_id, position)
+);
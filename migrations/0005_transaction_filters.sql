@@ -0,0 +1,24 @@
+-- What transaction queries filter and sort on besides the date. Rows saved
+-- before this migration are indexed from their data when it is applied, by
+-- indexStoredTransactions.
+ALTER TABLE transactions ADD COLUMN amount NUMERIC;
+
+ALTER TABLE transactions ADD COLUMN bank TEXT;
+
+CREATE INDEX IF NOT EXISTS transactions_by_amount
+	ON transactions (user_id, kind, amount, date, id);
+
+-- Tags and categories of each transaction, one per row
+CREATE TABLE IF NOT EXISTS transaction_tags (
+	user_id TEXT NOT NULL,
+	transaction_id TEXT NOT NULL,
+	tag TEXT NOT NULL,
+	PRIMARY KEY (user_id, transaction_id, tag)
+);
+
+CREATE TABLE IF NOT EXISTS transaction_categories (
+	user_id TEXT NOT NULL,
+	transaction_id TEXT NOT NULL,
+	category TEXT NOT NULL,
+	PRIMARY KEY (user_id, transaction_id, category)
+);
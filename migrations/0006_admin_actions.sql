@@ -0,0 +1,12 @@
+-- Administrator actions, recorded before each change is made
+CREATE TABLE IF NOT EXISTS admin_actions (
+	id TEXT PRIMARY KEY,
+	admin TEXT NOT NULL,
+	action TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	at TEXT NOT NULL,
+	detail TEXT NOT NULL,
+	error TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS admin_actions_by_time ON admin_actions (at, id);
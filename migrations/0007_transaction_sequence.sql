@@ -0,0 +1,6 @@
+-- Order each user's transactions were first saved in, which orders those
+-- of the same date. Rows saved before this migration have none and come
+-- first within their date, by ID.
+ALTER TABLE transactions ADD COLUMN seq INTEGER;
+
+CREATE INDEX IF NOT EXISTS transactions_by_seq ON transactions (user_id, seq);
@@ -0,0 +1,206 @@
+package arus
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Locale describes how money is written in a region.
+type Locale struct {
+	Tag               string
+	ThousandSeparator string
+	DecimalSeparator  string
+	// Place the currency symbol after the amount ("1.000,50 €")
+	SymbolAfter bool
+	// Put a space between symbol and amount
+	SymbolSpace bool
+	// Currency assumed when parsing amounts without a symbol
+	DefaultCurrency string
+}
+
+var (
+	LocaleEnUS = Locale{Tag: "en-US", ThousandSeparator: ",", DecimalSeparator: ".", DefaultCurrency: "USD"}
+	LocaleEnGB = Locale{Tag: "en-GB", ThousandSeparator: ",", DecimalSeparator: ".", DefaultCurrency: "GBP"}
+	LocaleIdID = Locale{Tag: "id-ID", ThousandSeparator: ".", DecimalSeparator: ",", DefaultCurrency: "IDR"}
+	LocaleDeDE = Locale{Tag: "de-DE", ThousandSeparator: ".", DecimalSeparator: ",", SymbolAfter: true, SymbolSpace: true, DefaultCurrency: "EUR"}
+	LocaleFrFR = Locale{Tag: "fr-FR", ThousandSeparator: " ", DecimalSeparator: ",", SymbolAfter: true, SymbolSpace: true, DefaultCurrency: "EUR"}
+	LocaleJaJP = Locale{Tag: "ja-JP", ThousandSeparator: ",", DecimalSeparator: ".", DefaultCurrency: "JPY"}
+)
+
+var locales = map[string]Locale{
+	LocaleEnUS.Tag: LocaleEnUS,
+	LocaleEnGB.Tag: LocaleEnGB,
+	LocaleIdID.Tag: LocaleIdID,
+	LocaleDeDE.Tag: LocaleDeDE,
+	LocaleFrFR.Tag: LocaleFrFR,
+	LocaleJaJP.Tag: LocaleJaJP,
+}
+
+// LookupLocale finds a locale by its BCP 47 tag ("id-ID").
+func LookupLocale(tag string) (Locale, bool) {
+	locale, ok := locales[tag]
+	return locale, ok
+}
+
+// Format renders m the way locale writes money, e.g. "$1,000.50" or
+// "Rp1.000.000". Amounts are rounded to the currency's minor unit.
+func (m Money) Format(locale Locale) string {
+	rounded := m.Round()
+	digits := rounded.Amount.Abs().StringFixed(MinorUnits(m.Currency))
+
+	integer, fraction, _ := strings.Cut(digits, ".")
+	var b strings.Builder
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteString(locale.ThousandSeparator)
+		}
+		b.WriteRune(digit)
+	}
+	if fraction != "" {
+		b.WriteString(locale.DecimalSeparator)
+		b.WriteString(fraction)
+	}
+	number := b.String()
+
+	symbol := m.Currency
+	if currency, ok := LookupCurrency(m.Currency); ok && currency.Symbol != "" {
+		symbol = currency.Symbol
+	}
+	space := ""
+	if locale.SymbolSpace {
+		space = " "
+	}
+
+	sign := ""
+	if rounded.IsNegative() {
+		sign = "-"
+	}
+	if locale.SymbolAfter {
+		return sign + number + space + symbol
+	}
+	return sign + symbol + space + number
+}
+
+// ParseMoney reads an amount written in locale's conventions. The currency is
+// taken from a leading or trailing symbol or ISO code, and defaults to the
+// locale's currency when there is none. Negative amounts may use a minus sign
+// or accounting parentheses.
+func ParseMoney(s string, locale Locale) (Money, error) {
+	text := strings.TrimSpace(s)
+	if text == "" {
+		return Money{}, errors.New("empty amount")
+	}
+
+	negative := false
+	if strings.HasPrefix(text, "(") && strings.HasSuffix(text, ")") {
+		negative = true
+		text = strings.TrimSpace(text[1 : len(text)-1])
+	}
+	if strings.HasPrefix(text, "-") {
+		negative = !negative
+		text = strings.TrimSpace(text[1:])
+	}
+
+	currency, text := stripCurrency(text, locale)
+	if strings.HasPrefix(text, "-") {
+		negative = !negative
+		text = strings.TrimSpace(text[1:])
+	}
+
+	number, ok := ungroup(text, locale)
+	if !ok {
+		return Money{}, fmt.Errorf("invalid amount %q for locale %s", s, locale.Tag)
+	}
+
+	amount, err := decimal.NewFromString(number)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount %q for locale %s", s, locale.Tag)
+	}
+	if negative {
+		amount = amount.Neg()
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// ungroup turns an amount written the locale's way into decimal notation,
+// checking its digits are grouped in threes: "1,5" is not fifteen in en-US.
+// Plain, non-breaking and narrow spaces all count as the separator of
+// locales that group with a space.
+func ungroup(text string, locale Locale) (string, bool) {
+	integer, fraction, hasFraction := strings.Cut(text, locale.DecimalSeparator)
+	if hasFraction && !isDigits(fraction) {
+		return "", false
+	}
+
+	groups := []string{integer}
+	if separator := locale.ThousandSeparator; separator != "" {
+		if strings.TrimSpace(separator) == "" {
+			integer = strings.NewReplacer(" ", separator, "\u00a0", separator, "\u202f", separator).Replace(integer)
+		}
+		groups = strings.Split(integer, separator)
+	}
+	for i, group := range groups {
+		// ".5" has no integer digits at all
+		if len(groups) == 1 && group == "" && hasFraction {
+			continue
+		}
+		if !isDigits(group) || len(groups) > 1 && (len(group) > 3 || i > 0 && len(group) < 3) {
+			return "", false
+		}
+	}
+
+	number := strings.Join(groups, "")
+	if hasFraction {
+		number += "." + fraction
+	}
+	return number, true
+}
+
+func isDigits(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
+
+// stripCurrency removes a currency symbol or code from either end of text
+// and returns the currency it denotes.
+func stripCurrency(text string, locale Locale) (string, string) {
+	type marker struct {
+		text     string
+		currency string
+	}
+
+	currencyMu.RLock()
+	markers := make([]marker, 0, 2*len(currencies))
+	for code, currency := range currencies {
+		markers = append(markers, marker{text: code, currency: code})
+		if currency.Symbol != "" {
+			markers = append(markers, marker{text: currency.Symbol, currency: code})
+		}
+	}
+	currencyMu.RUnlock()
+
+	// Longest markers first so "A$" wins over "$", and the locale's own
+	// currency wins when several share a symbol.
+	sort.Slice(markers, func(i, j int) bool {
+		if len(markers[i].text) != len(markers[j].text) {
+			return len(markers[i].text) > len(markers[j].text)
+		}
+		if (markers[i].currency == locale.DefaultCurrency) != (markers[j].currency == locale.DefaultCurrency) {
+			return markers[i].currency == locale.DefaultCurrency
+		}
+		return markers[i].currency < markers[j].currency
+	})
+
+	for _, m := range markers {
+		if rest, ok := strings.CutPrefix(text, m.text); ok {
+			return m.currency, strings.TrimSpace(rest)
+		}
+		if rest, ok := strings.CutSuffix(text, m.text); ok {
+			return m.currency, strings.TrimSpace(rest)
+		}
+	}
+	return locale.DefaultCurrency, text
+}
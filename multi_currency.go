@@ -0,0 +1,158 @@
+package arus
+
+import (
+	"context"
+	"errors"
+	"slices"
+)
+
+// HoldCurrency lets the category hold a balance in currency alongside its
+// main one.
+func (c *Category) HoldCurrency(currency string) {
+	if currency == "" || currency == c.Balance.Currency {
+		return
+	}
+	if _, held := c.Foreign[currency]; held {
+		return
+	}
+	if c.Foreign == nil {
+		c.Foreign = make(map[string]Money)
+	}
+	c.Foreign[currency] = NewMoneyZero(currency)
+}
+
+// Currencies returns the currencies the category holds, its main one first.
+func (c *Category) Currencies() []string {
+	currencies := []string{c.Balance.Currency}
+	for currency := range c.Foreign {
+		currencies = append(currencies, currency)
+	}
+	slices.Sort(currencies[1:])
+	return currencies
+}
+
+// BalanceIn returns the category's sub-balance in currency, which is zero
+// for currencies it does not hold.
+func (c *Category) BalanceIn(currency string) Money {
+	if currency == c.Balance.Currency {
+		return c.Balance
+	}
+	if balance, held := c.Foreign[currency]; held {
+		return balance
+	}
+	return NewMoneyZero(currency)
+}
+
+// Balances returns the category's sub-balance in each currency it holds,
+// its main one first.
+func (c *Category) Balances() []Money {
+	currencies := c.Currencies()
+	balances := make([]Money, len(currencies))
+	for i, currency := range currencies {
+		balances[i] = c.BalanceIn(currency)
+	}
+	return balances
+}
+
+func (c *Category) setBalance(balance Money) {
+	if balance.Currency == c.Balance.Currency || c.Balance.Currency == "" {
+		c.Balance = balance
+		return
+	}
+	c.HoldCurrency(balance.Currency)
+	c.Foreign[balance.Currency] = balance
+}
+
+// accountsIn returns the category's backing accounts in currency.
+func (c *Category) accountsIn(currency string) []*CategoryAccount {
+	var accounts []*CategoryAccount
+	for _, account := range c.Accounts {
+		if account.Balance.Currency == currency || account.Balance.Currency == "" && currency == c.Balance.Currency {
+			accounts = append(accounts, account)
+		}
+	}
+	return accounts
+}
+
+// ValueIn converts every sub-balance of the category into currency and
+// adds them up.
+func (c *Category) ValueIn(ctx context.Context, rates ExchangeRateProvider, currency string) (Money, error) {
+	total := NewMoneyZero(currency)
+	for _, balance := range c.Balances() {
+		if balance.Currency == currency || balance.IsZero() {
+			total = total.Add(Money{Amount: balance.Amount, Currency: currency})
+			continue
+		}
+		if rates == nil {
+			return Money{}, errors.New("no exchange rates configured to convert " + balance.Currency)
+		}
+		rate, err := rates.Rate(ctx, balance.Currency, currency)
+		if err != nil {
+			return Money{}, err
+		}
+		converted, err := rate.Convert(balance)
+		if err != nil {
+			return Money{}, err
+		}
+		total = total.Add(converted)
+	}
+	return total, nil
+}
+
+// ConvertedBalances returns each category's balance with every currency it
+// holds converted into currency, for reports.
+func (u *User) ConvertedBalances(ctx context.Context, rates ExchangeRateProvider, currency string) (map[CategoryType]Money, error) {
+	balances := make(map[CategoryType]Money, len(u.Categories))
+	for categoryType, category := range u.Categories {
+		value, err := category.ValueIn(ctx, rates, currency)
+		if err != nil {
+			return nil, err
+		}
+		balances[categoryType] = value
+	}
+	return balances, nil
+}
+
+// HoldCurrency lets one of the user's categories hold money in another
+// currency than its main one.
+func (s *FinanceService) HoldCurrency(ctx context.Context, userID string, categoryType CategoryType, currency string) error {
+	if _, known := LookupCurrency(currency); !known {
+		return errors.New("unknown currency " + currency)
+	}
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	category, exists := user.Categories[categoryType]
+	if !exists {
+		return &CategoryNotFoundError{Category: categoryType}
+	}
+	category.HoldCurrency(currency)
+
+	return s.save(ctx, user, "hold_currency")
+}
+
+// ConvertedBalances returns the user's category balances converted into
+// currency, or into the user's currency when empty, at the service's
+// exchange rates.
+func (s *FinanceService) ConvertedBalances(ctx context.Context, userID, currency string) (map[CategoryType]Money, error) {
+	user, err := s.readUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if currency == "" {
+		currency = user.Currency()
+	}
+	return user.ConvertedBalances(ctx, s.Rates, currency)
+}
+
+// readUser loads a copy of the user under the read lock, for callers that
+// go on to do slow work, such as fetching exchange rates, without holding
+// the user.
+func (s *FinanceService) readUser(ctx context.Context, userID string) (*User, error) {
+	defer s.readLockUser(userID)()
+	return s.UserRepo.GetByID(ctx, userID)
+}
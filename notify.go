@@ -0,0 +1,37 @@
+package arus
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Notification is a message delivered to a user.
+type Notification struct {
+	Subject string
+	Body    string
+}
+
+// Notifier delivers notifications to a user over one channel.
+type Notifier interface {
+	Notify(ctx context.Context, userID string, notification Notification) error
+}
+
+// WriterNotifier writes notifications to w, e.g. stdout or a log file.
+type WriterNotifier struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterNotifier(w io.Writer) *WriterNotifier {
+	return &WriterNotifier{w: w}
+}
+
+func (n *WriterNotifier) Notify(ctx context.Context, userID string, notification Notification) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	_, err := fmt.Fprintf(n.w, "[%s] %s\n%s\n", userID, notification.Subject, notification.Body)
+	return err
+}
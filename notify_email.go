@@ -0,0 +1,68 @@
+package arus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// ErrNoRecipient is returned by Recipients that have no address for a user.
+var ErrNoRecipient = errors.New("no recipient for user")
+
+// Recipients looks up where a user is reached on a channel: an email
+// address or a push device token.
+type Recipients interface {
+	Recipient(ctx context.Context, userID string) (string, error)
+}
+
+// StaticRecipients is a fixed table of recipients by user ID.
+type StaticRecipients map[string]string
+
+func (r StaticRecipients) Recipient(ctx context.Context, userID string) (string, error) {
+	recipient, ok := r[userID]
+	if !ok {
+		return "", fmt.Errorf("%w %s", ErrNoRecipient, userID)
+	}
+	return recipient, nil
+}
+
+// EmailNotifier sends notifications as plain-text email through an SMTP
+// server.
+type EmailNotifier struct {
+	// SMTP server as host:port
+	Addr string
+	// Nil sends without authenticating
+	Auth smtp.Auth
+	From string
+	To   Recipients
+}
+
+func (n *EmailNotifier) Notify(ctx context.Context, userID string, notification Notification) error {
+	to, err := n.To.Recipient(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return smtp.SendMail(n.Addr, n.Auth, n.From, []string{to}, n.message(to, notification))
+}
+
+func (n *EmailNotifier) message(to string, notification Notification) []byte {
+	// Header values must not break out of their line
+	header := strings.NewReplacer("\r", "", "\n", " ")
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", header.Replace(n.From))
+	fmt.Fprintf(&b, "To: %s\r\n", header.Replace(to))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", header.Replace(notification.Subject)))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(notification.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,73 @@
+package arus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// PushNotifier sends notifications to a user's device by POSTing a
+// Firebase Cloud Messaging style payload to URL, such as FCM's send
+// endpoint or a webhook of the user's own.
+type PushNotifier struct {
+	URL string
+	// Added to every request, e.g. Authorization
+	Header http.Header
+	// Nil uses http.DefaultClient
+	Client *http.Client
+	// Device tokens by user
+	Tokens Recipients
+}
+
+type pushMessage struct {
+	To           string            `json:"to"`
+	Notification pushNotification  `json:"notification"`
+	Data         map[string]string `json:"data"`
+}
+
+type pushNotification struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+func (n *PushNotifier) Notify(ctx context.Context, userID string, notification Notification) error {
+	token, err := n.Tokens.Recipient(ctx, userID)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(pushMessage{
+		To:           token,
+		Notification: pushNotification{Title: notification.Subject, Body: notification.Body},
+		Data:         map[string]string{"user_id": userID},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	for key, values := range n.Header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("push to %s failed: %s", n.URL, resp.Status)
+	}
+	return nil
+}
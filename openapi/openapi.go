@@ -0,0 +1,295 @@
+// Package openapi describes the HTTP API as an OpenAPI 3 document, so client
+// SDKs can be generated from it. Handlers describe their own routes; the
+// schemas of their DTOs are derived from the Go types by reflection:
+//
+//	doc := openapi.New("arus", "1.0").
+//		Mount("/graphql", graphqlHandler).
+//		Mount("/", attachmentHandler).
+//		Mount("/events", streamHandler)
+//	mux.Handle("GET /openapi.json", openapi.NewHandler(doc))
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/shopspring/decimal"
+)
+
+// Version of the OpenAPI specification documents follow
+const Version = "3.0.3"
+
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+
+	// Go types already named in Components, so each is described once
+	named map[reflect.Type]string
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// PathItem is the operations on one path, by lowercase HTTP method.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string              `json:"operationId,omitempty"`
+	Summary     string              `json:"summary,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+}
+
+// Parameter is a path, query or header parameter, as In says.
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Description string               `json:"description,omitempty"`
+	Required    bool                 `json:"required,omitempty"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is the subset of JSON Schema OpenAPI uses. Ref points to a schema
+// in Components instead.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty"`
+}
+
+// Describer is implemented by handlers that can describe their routes.
+// Prefix is the path the handler is mounted under, without a trailing
+// slash.
+type Describer interface {
+	Describe(doc *Document, prefix string)
+}
+
+func New(title, version string) *Document {
+	return &Document{
+		OpenAPI:    Version,
+		Info:       Info{Title: title, Version: version},
+		Paths:      make(map[string]PathItem),
+		Components: Components{Schemas: make(map[string]*Schema)},
+		named:      make(map[reflect.Type]string),
+	}
+}
+
+// Mount describes the handler's routes under prefix.
+func (d *Document) Mount(prefix string, handler Describer) *Document {
+	handler.Describe(d, strings.TrimSuffix(prefix, "/"))
+	return d
+}
+
+var pathParameter = regexp.MustCompile(`\{([^}.]+)(?:\.\.\.)?\}`)
+
+// Add describes the operation at method and path, which take the form of
+// http.ServeMux patterns. Path parameters not listed in op.Parameters are
+// added as required strings.
+func (d *Document) Add(method, path string, op Operation) {
+	path = pathParameter.ReplaceAllString(path, "{$1}")
+	for _, match := range pathParameter.FindAllStringSubmatch(path, -1) {
+		name := match[1]
+		declared := slices.ContainsFunc(op.Parameters, func(p Parameter) bool {
+			return p.In == "path" && p.Name == name
+		})
+		if !declared {
+			op.Parameters = append(op.Parameters, Parameter{Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+	}
+	if op.Responses == nil {
+		op.Responses = map[string]Response{"default": {Description: "Unexpected error"}}
+	}
+	if d.Paths[path] == nil {
+		d.Paths[path] = make(PathItem)
+	}
+	d.Paths[path][strings.ToLower(method)] = &op
+}
+
+// JSON returns JSON content of the schema of v's type.
+func (d *Document) JSON(v any) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: d.SchemaOf(v)}}
+}
+
+// SchemaOf returns the schema of v's type as encoding/json serializes it.
+// Named struct types are added to Components and referenced.
+func (d *Document) SchemaOf(v any) *Schema {
+	return d.schema(reflect.TypeOf(v))
+}
+
+var (
+	timeType          = reflect.TypeFor[time.Time]()
+	decimalType       = reflect.TypeFor[decimal.Decimal]()
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+func (d *Document) schema(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case decimalType:
+		return &Schema{Type: "string", Format: "decimal"}
+	}
+	if t.Kind() != reflect.Struct && t.Kind() != reflect.Pointer &&
+		(t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType)) {
+		// Enums serialize as their codes
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Pointer:
+		schema := d.schema(t.Elem())
+		if schema.Ref != "" {
+			// OpenAPI 3.0 ignores the siblings of $ref, so references
+			// can't be marked nullable
+			return schema
+		}
+		nullable := *schema
+		nullable.Nullable = true
+		return &nullable
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: d.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.object(t)
+		}
+		return d.ref(t)
+	}
+	// Interfaces hold anything
+	return &Schema{}
+}
+
+// ref adds the named struct type to Components, once, and references it.
+func (d *Document) ref(t reflect.Type) *Schema {
+	name, exists := d.named[t]
+	if !exists {
+		name = schemaName(t)
+		if _, taken := d.Components.Schemas[name]; taken {
+			name = schemaName(t) + "_" + strings.ReplaceAll(t.PkgPath(), "/", "_")
+		}
+		d.named[t] = name
+		// Reserve the name first: the type may refer to itself
+		d.Components.Schemas[name] = &Schema{}
+		*d.Components.Schemas[name] = *d.object(t)
+	}
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+func schemaName(t reflect.Type) string {
+	name := []rune(t.Name())
+	name[0] = unicode.ToUpper(name[0])
+	return string(name)
+}
+
+// object describes a struct's JSON fields, inlining embedded structs as
+// encoding/json does. Fields without omitempty are always present, so
+// they are required.
+func (d *Document) object(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for _, field := range reflect.VisibleFields(t) {
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		embedded := field.Type
+		if embedded.Kind() == reflect.Pointer {
+			embedded = embedded.Elem()
+		}
+		if field.Anonymous && embedded.Kind() == reflect.Struct && name == "" {
+			// Its fields are visible themselves
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "-" && options == "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if _, exists := schema.Properties[name]; exists {
+			continue
+		}
+		schema.Properties[name] = d.schema(field.Type)
+		if !slices.Contains(strings.Split(options, ","), "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return schema
+}
+
+// Handler serves a document as JSON, typically at /openapi.json.
+type Handler struct {
+	Document *Document
+}
+
+func NewHandler(doc *Document) *Handler {
+	return &Handler{Document: doc}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Document)
+}
@@ -0,0 +1,184 @@
+package arus
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+)
+
+// OverdraftMode is what happens to an expense the categories in its
+// deduction order cannot cover.
+type OverdraftMode int
+
+const (
+	// The expense fails with an InsufficientFundsError
+	OverdraftReject OverdraftMode = iota
+	// The shortfall overdraws the Expense category, down to the policy's
+	// Limit below zero
+	OverdraftExpense
+	// The shortfall is parked in the Owed category, whose balance goes
+	// negative, and announced with EventOverdrawn
+	OverdraftPark
+)
+
+var overdraftModeCodes = enumCodes[OverdraftMode]{
+	name: "overdraft mode",
+	codes: map[OverdraftMode]string{
+		OverdraftReject:  "reject",
+		OverdraftExpense: "negative-expense",
+		OverdraftPark:    "park",
+	},
+	unknown: OverdraftReject,
+}
+
+// ParseOverdraftMode reads an overdraft mode code, returning OverdraftReject
+// for codes this version does not know.
+func ParseOverdraftMode(code string) OverdraftMode {
+	return overdraftModeCodes.parse(code)
+}
+
+func (m OverdraftMode) Code() string {
+	return overdraftModeCodes.code(m)
+}
+
+func (m OverdraftMode) String() string {
+	return m.Code()
+}
+
+func (m OverdraftMode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.Code())
+}
+
+func (m *OverdraftMode) UnmarshalJSON(data []byte) error {
+	value, err := overdraftModeCodes.unmarshalJSON(data)
+	*m = value
+	return err
+}
+
+func (m OverdraftMode) Value() (driver.Value, error) {
+	return m.Code(), nil
+}
+
+func (m *OverdraftMode) Scan(src any) error {
+	value, err := overdraftModeCodes.scan(src)
+	*m = value
+	return err
+}
+
+// OverdraftPolicy is what a user's expenses do when their categories run
+// out of money.
+type OverdraftPolicy struct {
+	Mode OverdraftMode
+	// How far below zero OverdraftExpense lets the Expense category go;
+	// only expenses in its currency can overdraw it
+	Limit Money
+}
+
+func (p OverdraftPolicy) Validate() error {
+	if p.Mode == OverdraftExpense && (p.Limit.Currency == "" || p.Limit.Amount.IsNegative()) {
+		return errors.New("overdraft limit must be a non-negative amount")
+	}
+	return nil
+}
+
+// checkOverdraft reports whether the user's overdraft policy covers an
+// expense of needed when the categories hold only available.
+func (u *User) checkOverdraft(needed, available Money) error {
+	insufficient := &InsufficientFundsError{Needed: needed, Available: available}
+	policy := u.OverdraftPolicy
+	if policy == nil {
+		return insufficient
+	}
+	switch policy.Mode {
+	case OverdraftExpense:
+		expense := u.Categories[Expense]
+		if expense == nil || expense.checkCurrency(needed) != nil || policy.Limit.Currency != needed.Currency {
+			return insufficient
+		}
+		// Room left above the limit, less what is overdrawn already
+		headroom := policy.Limit.Amount
+		if balance := expense.BalanceIn(needed.Currency).Amount; balance.IsNegative() {
+			headroom = headroom.Add(balance)
+		}
+		if needed.Amount.Sub(available.Amount).GreaterThan(headroom) {
+			if headroom.IsPositive() {
+				insufficient.Available.Amount = available.Amount.Add(headroom)
+			}
+			return insufficient
+		}
+		return nil
+	case OverdraftPark:
+		return nil
+	}
+	return insufficient
+}
+
+// overdraw takes the shortfall of an expense checkOverdraft accepted from
+// the category the policy sends it to.
+func (u *User) overdraw(shortfall Money) (Deduction, error) {
+	if u.OverdraftPolicy == nil || u.OverdraftPolicy.Mode == OverdraftReject {
+		return Deduction{}, &InsufficientFundsError{Needed: shortfall, Available: NewMoneyZero(shortfall.Currency)}
+	}
+	categoryType := Expense
+	if u.OverdraftPolicy.Mode == OverdraftPark {
+		categoryType = Owed
+		if _, exists := u.Categories[Owed]; !exists {
+			u.Categories[Owed] = NewCategory(Owed, shortfall.Currency)
+		}
+		u.Categories[Owed].HoldCurrency(shortfall.Currency)
+	}
+	category := u.Categories[categoryType]
+	if err := category.checkCurrency(shortfall); err != nil {
+		return Deduction{}, err
+	}
+	if accounts := category.accountsIn(shortfall.Currency); len(accounts) > 0 {
+		accounts[0].Balance = accounts[0].Balance.Subtract(shortfall)
+	}
+	category.setBalance(category.BalanceIn(shortfall.Currency).Subtract(shortfall))
+	return Deduction{Category: categoryType, Amount: shortfall, Overdraft: true}, nil
+}
+
+// Owes returns what the user owes for expenses parked in the Owed category,
+// as positive amounts, one per currency.
+func (u *User) Owes() []Money {
+	category, exists := u.Categories[Owed]
+	if !exists {
+		return nil
+	}
+	var owed []Money
+	for _, balance := range category.Balances() {
+		if balance.IsNegative() {
+			owed = append(owed, balance.Abs())
+		}
+	}
+	return owed
+}
+
+// SetOverdraftPolicy replaces the user's overdraft policy; nil rejects
+// expenses the categories cannot cover.
+func (s *FinanceService) SetOverdraftPolicy(ctx context.Context, userID string, policy *OverdraftPolicy) error {
+	if policy != nil {
+		if err := policy.Validate(); err != nil {
+			return err
+		}
+	}
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	user.OverdraftPolicy = policy
+
+	if err := s.save(ctx, user, "set_overdraft_policy"); err != nil {
+		return err
+	}
+	mode := OverdraftReject
+	if policy != nil {
+		mode = policy.Mode
+	}
+	s.Telemetry.Track(ctx, "overdraft", "set_policy", userID, map[string]string{"mode": mode.Code()})
+	return nil
+}
@@ -0,0 +1,67 @@
+package arus
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+)
+
+// A page of transactions. NextCursor is empty on the last page.
+type TransactionPage struct {
+	Transactions []Transaction
+	NextCursor   string
+	// Number of transactions across all pages
+	TotalCount int
+}
+
+// PageTransactions returns up to limit transactions starting at cursor. An
+// empty cursor starts from the first transaction.
+func PageTransactions(transactions []Transaction, cursor string, limit int) (TransactionPage, error) {
+	page, next, err := paginate(transactions, cursor, limit)
+	if err != nil {
+		return TransactionPage{}, err
+	}
+	return TransactionPage{Transactions: page, NextCursor: next, TotalCount: len(transactions)}, nil
+}
+
+// paginate returns up to limit items starting at the offset encoded in
+// cursor, and the cursor of the next page.
+func paginate[T any](items []T, cursor string, limit int) ([]T, string, error) {
+	if limit <= 0 {
+		return nil, "", errors.New("page limit must be positive")
+	}
+
+	offset, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	if offset > len(items) {
+		return nil, "", errors.New("cursor is past the end")
+	}
+
+	end := min(offset+limit, len(items))
+	next := ""
+	if end < len(items) {
+		next = encodeCursor(end)
+	}
+	return items[offset:end], next, nil
+}
+
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errors.New("invalid cursor")
+	}
+	offset, err := strconv.Atoi(string(raw))
+	if err != nil || offset < 0 {
+		return 0, errors.New("invalid cursor")
+	}
+	return offset, nil
+}
@@ -0,0 +1,96 @@
+package arus
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Letter-sized pages of monospaced text
+const (
+	pdfPageWidth   = 612
+	pdfPageHeight  = 792
+	pdfMargin      = 50
+	pdfFontSize    = 9
+	pdfLineHeight  = 12
+	pdfLinesOnPage = (pdfPageHeight - 2*pdfMargin) / pdfLineHeight
+)
+
+// writeTextPDF writes lines as a plain PDF document in Courier, starting a
+// new page whenever one fills up. Characters outside the font's
+// WinAnsi encoding are printed as "?".
+func writeTextPDF(w io.Writer, title string, lines []string) error {
+	var pages [][]string
+	for len(lines) > pdfLinesOnPage {
+		pages = append(pages, lines[:pdfLinesOnPage])
+		lines = lines[pdfLinesOnPage:]
+	}
+	pages = append(pages, lines)
+
+	var b bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, b.Len())
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	b.WriteString("%PDF-1.4\n")
+	// Objects 1 to 4 are the catalog, page tree, font and document info;
+	// each page is then a page object followed by its content stream
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	object(fmt.Sprintf("<< /Title %s /Producer (arus) >>", pdfString(title)))
+	for i, page := range pages {
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "BT /F1 %d Tf %d TL %d %d Td\n", pdfFontSize, pdfLineHeight, pdfMargin, pdfPageHeight-pdfMargin)
+		for _, line := range page {
+			fmt.Fprintf(&content, "%s Tj T*\n", pdfString(line))
+		}
+		content.WriteString("ET")
+
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.Bytes()))
+	}
+
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R /Info 4 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// pdfString encodes s as a PDF literal string in WinAnsi encoding.
+func pdfString(s string) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= ' ' && r < 0x7f:
+			b.WriteRune(r)
+		case r == '€':
+			b.WriteString(`\200`)
+		case r == '…':
+			b.WriteString(`\205`)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, `\%03o`, r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
@@ -0,0 +1,261 @@
+package arus
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// TransactionStatus is where a transaction is in the bank's settlement.
+type TransactionStatus int
+
+const (
+	// Settled by the bank; the status of everything recorded by hand
+	Posted TransactionStatus = iota
+	// Authorized but not settled yet, e.g. a card hold. It already counts
+	// against the budget and is replaced by its posted version.
+	Pending
+	// Never settled; it no longer counts
+	Voided
+)
+
+var transactionStatusCodes = enumCodes[TransactionStatus]{
+	name: "transaction status",
+	codes: map[TransactionStatus]string{
+		Posted:  "posted",
+		Pending: "pending",
+		Voided:  "voided",
+	},
+	unknown: Posted,
+}
+
+func (t TransactionStatus) Code() string {
+	return transactionStatusCodes.code(t)
+}
+
+func (t TransactionStatus) String() string {
+	return t.Code()
+}
+
+func (t TransactionStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Code())
+}
+
+func (t *TransactionStatus) UnmarshalJSON(data []byte) error {
+	value, err := transactionStatusCodes.unmarshalJSON(data)
+	*t = value
+	return err
+}
+
+func (t TransactionStatus) Value() (driver.Value, error) {
+	return t.Code(), nil
+}
+
+func (t *TransactionStatus) Scan(src any) error {
+	value, err := transactionStatusCodes.scan(src)
+	*t = value
+	return err
+}
+
+// How far apart a pending transaction and its posted version may be dated
+const pendingMatchWindow = 5 * 24 * time.Hour
+
+// Pending transactions older than this that never posted are voided by
+// ExpirePending
+const DefaultPendingExpiry = 14 * 24 * time.Hour
+
+// Counts reports whether the transaction counts towards totals.
+func (tx Transaction) Counts() bool {
+	return tx.Status != Voided
+}
+
+// matchesPending reports whether posted is the settled version of pending:
+// dated close to it and either for the same amount or with the same
+// description, as when a tip is added to a restaurant hold.
+func matchesPending(pending, posted Transaction) bool {
+	if pending.Status != Pending || pending.Amount.Currency != posted.Amount.Currency {
+		return false
+	}
+	if posted.Date.Sub(pending.Date).Abs() > pendingMatchWindow {
+		return false
+	}
+	sameAmount := pending.Amount.Amount.Abs().Equal(posted.Amount.Amount.Abs())
+	sameDescription := posted.Description != "" &&
+		strings.EqualFold(strings.TrimSpace(pending.Description), strings.TrimSpace(posted.Description))
+	return sameAmount || sameDescription
+}
+
+// recordedAs reports whether the transaction was recorded from the line or
+// request of that ID: its own, or that of the posted line settling it.
+func (tx Transaction) recordedAs(id string) bool {
+	return tx.ID == id || (tx.PostedID != "" && tx.PostedID == id)
+}
+
+// pendingExpenseFor returns the index of the oldest pending expense the
+// posted expense settles, or -1.
+func (u *User) pendingExpenseFor(posted Transaction) int {
+	match := -1
+	for i, expense := range u.Expenses {
+		if matchesPending(expense, posted) && (match < 0 || expense.Date.Before(u.Expenses[match].Date)) {
+			match = i
+		}
+	}
+	return match
+}
+
+// refund credits an expense's deductions back to their categories.
+func (u *User) refund(expense Transaction) error {
+	for _, deduction := range expense.Deductions {
+		category, exists := u.Categories[deduction.Category]
+		if !exists {
+			return &CategoryNotFoundError{Category: deduction.Category}
+		}
+		if err := category.Credit(deduction.Amount.Abs()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postExpense settles the pending expense at index i with its posted
+// version, remembering the posted line's ID so importing it again does not
+// record it twice. A changed amount is deducted again, drawing on the
+// categories that covered the hold first.
+func (u *User) postExpense(i int, posted Transaction) error {
+	expense := u.Expenses[i]
+	if !expense.Amount.Amount.Equal(posted.Amount.Amount) {
+		if err := u.refund(expense); err != nil {
+			return err
+		}
+		var order []CategoryType
+		for _, deduction := range expense.Deductions {
+			order = append(order, deduction.Category)
+		}
+		for _, categoryType := range DefaultDeductionOrder {
+			if !slices.Contains(order, categoryType) {
+				order = append(order, categoryType)
+			}
+		}
+		deductions, err := u.deduct(posted.Amount.Abs(), order)
+		if err != nil {
+			return err
+		}
+		expense.Amount = posted.Amount
+		expense.Deductions = deductions
+	}
+	expense.Status = Posted
+	expense.Date = posted.Date
+	if posted.ID != expense.ID {
+		expense.PostedID = posted.ID
+	}
+	u.Expenses[i] = expense
+	u.RebuildTotals()
+	return nil
+}
+
+// pendingIDs returns the IDs of the user's pending expenses.
+func (u *User) pendingIDs() map[string]bool {
+	ids := make(map[string]bool)
+	for _, expense := range u.Expenses {
+		if expense.Status == Pending {
+			ids[expense.ID] = true
+		}
+	}
+	return ids
+}
+
+// settledSince returns the expenses that were pending, per pendingIDs, and
+// no longer are.
+func (u *User) settledSince(pending map[string]bool) []Transaction {
+	var settled []Transaction
+	for _, expense := range u.Expenses {
+		if pending[expense.ID] && expense.Status != Pending {
+			settled = append(settled, expense)
+		}
+	}
+	return settled
+}
+
+// VoidTransaction voids a pending expense that will not settle, giving its
+// amount back to the categories that covered it.
+func (u *User) VoidTransaction(id string) (Transaction, error) {
+	expense, err := u.Expense(id)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if expense.Status != Pending {
+		return Transaction{}, fmt.Errorf("only pending transactions can be voided, %s is %s", id, expense.Status)
+	}
+	if err := u.refund(*expense); err != nil {
+		return Transaction{}, err
+	}
+	expense.Status = Voided
+	u.RebuildTotals()
+	return *expense, nil
+}
+
+// ExpirePending voids the pending expenses dated more than expiry before
+// now, returning them.
+func (u *User) ExpirePending(now time.Time, expiry time.Duration) ([]Transaction, error) {
+	var voided []Transaction
+	for _, expense := range u.Expenses {
+		if expense.Status != Pending || now.Sub(expense.Date) <= expiry {
+			continue
+		}
+		tx, err := u.VoidTransaction(expense.ID)
+		if err != nil {
+			return voided, err
+		}
+		voided = append(voided, tx)
+	}
+	return voided, nil
+}
+
+func (s *FinanceService) VoidTransaction(ctx context.Context, userID, transactionID string) error {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.loadTransactionIDs(ctx, user, transactionID); err != nil {
+		return err
+	}
+	voided, err := user.VoidTransaction(transactionID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.save(ctx, user, "void_transaction"); err != nil {
+		return err
+	}
+	s.log().InfoContext(ctx, "voided transaction", LogKeyUserID, userID, LogKeyTransactionID, transactionID)
+	s.publishLedger(user, voided)
+	return nil
+}
+
+// ExpirePending voids the user's pending expenses older than
+// DefaultPendingExpiry, e.g. after a sync in which they did not post.
+func (s *FinanceService) ExpirePending(ctx context.Context, userID string) ([]Transaction, error) {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	voided, err := user.ExpirePending(s.now(), DefaultPendingExpiry)
+	if err != nil || len(voided) == 0 {
+		return nil, err
+	}
+
+	if err := s.save(ctx, user, "expire_pending"); err != nil {
+		return nil, err
+	}
+	s.log().InfoContext(ctx, "expired pending transactions", LogKeyUserID, userID, "voided", len(voided))
+	s.publishLedger(user, voided...)
+	return voided, nil
+}
@@ -0,0 +1,200 @@
+package arus
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"time"
+)
+
+// Period is a time range including both StartDate and EndDate. Periods built
+// by the constructors below end on the last instant before the next period
+// starts, so every moment of the final day is included.
+type Period struct {
+	StartDate time.Time
+	EndDate   time.Time
+}
+
+func (p Period) Contains(date time.Time) bool {
+	return !date.Before(p.StartDate) && !date.After(p.EndDate)
+}
+
+// Overlaps reports whether the two periods share at least one instant.
+func (p Period) Overlaps(other Period) bool {
+	return !p.EndDate.Before(other.StartDate) && !other.EndDate.Before(p.StartDate)
+}
+
+func (p Period) Equal(other Period) bool {
+	return p.StartDate.Equal(other.StartDate) && p.EndDate.Equal(other.EndDate)
+}
+
+// Next returns the period of the same length right after p. Periods spanning
+// whole months or days (such as those built by the constructors here) step
+// by calendar months or days, so the month after February is all of March.
+// Other periods step by their exact duration.
+func (p Period) Next() Period {
+	return p.shift(1)
+}
+
+// Previous returns the period of the same length right before p.
+func (p Period) Previous() Period {
+	return p.shift(-1)
+}
+
+func (p Period) shift(n int) Period {
+	start := p.StartDate
+	end := p.EndDate.Add(time.Nanosecond)
+
+	months := (end.Year()-start.Year())*12 + int(end.Month()) - int(start.Month())
+	if months > 0 && start.AddDate(0, months, 0).Equal(end) {
+		return periodUntil(start.AddDate(0, n*months, 0), start.AddDate(0, (n+1)*months, 0))
+	}
+	// Round to whole days so daylight saving shifts do not break weeks
+	days := int(end.Sub(start).Round(24*time.Hour) / (24 * time.Hour))
+	if days > 0 && start.AddDate(0, 0, days).Equal(end) {
+		return periodUntil(start.AddDate(0, 0, n*days), start.AddDate(0, 0, (n+1)*days))
+	}
+	length := end.Sub(start)
+	return periodUntil(start.Add(time.Duration(n)*length), start.Add(time.Duration(n+1)*length))
+}
+
+// Months yields the calendar months in loc that overlap p, in order.
+func (p Period) Months(loc *time.Location) iter.Seq[Period] {
+	start := p.StartDate.In(locationOrUTC(loc))
+	return p.each(CreateMonthlyPeriodIn(start.Year(), start.Month(), loc))
+}
+
+// Weeks yields the weeks starting on weekStart in loc that overlap p, in
+// order.
+func (p Period) Weeks(weekStart time.Weekday, loc *time.Location) iter.Seq[Period] {
+	return p.each(CreateWeeklyPeriod(p.StartDate, weekStart, loc))
+}
+
+func (p Period) each(first Period) iter.Seq[Period] {
+	return func(yield func(Period) bool) {
+		for current := first; current.Overlaps(p); current = current.Next() {
+			if !yield(current) {
+				return
+			}
+		}
+	}
+}
+
+// periodUntil returns the period from start up to, but excluding, end.
+func periodUntil(start, end time.Time) Period {
+	return Period{StartDate: start, EndDate: end.Add(-time.Nanosecond)}
+}
+
+func locationOrUTC(loc *time.Location) *time.Location {
+	if loc == nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// CreateMonthlyPeriod returns the calendar month in UTC.
+func CreateMonthlyPeriod(year int, month time.Month) Period {
+	return CreateMonthlyPeriodIn(year, month, time.UTC)
+}
+
+// CreateMonthlyPeriodIn returns the calendar month in loc.
+func CreateMonthlyPeriodIn(year int, month time.Month, loc *time.Location) Period {
+	start := time.Date(year, month, 1, 0, 0, 0, 0, locationOrUTC(loc))
+	return periodUntil(start, start.AddDate(0, 1, 0))
+}
+
+// CreateWeeklyPeriod returns the week containing date, starting on
+// weekStart, in loc.
+func CreateWeeklyPeriod(date time.Time, weekStart time.Weekday, loc *time.Location) Period {
+	date = date.In(locationOrUTC(loc))
+	start := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	start = start.AddDate(0, 0, -((int(start.Weekday()) - int(weekStart) + 7) % 7))
+	return periodUntil(start, start.AddDate(0, 0, 7))
+}
+
+// CreateQuarterlyPeriod returns the calendar quarter (1-4) in loc.
+func CreateQuarterlyPeriod(year, quarter int, loc *time.Location) (Period, error) {
+	if quarter < 1 || quarter > 4 {
+		return Period{}, fmt.Errorf("quarter %d is out of range", quarter)
+	}
+	start := time.Date(year, time.Month(3*(quarter-1)+1), 1, 0, 0, 0, 0, locationOrUTC(loc))
+	return periodUntil(start, start.AddDate(0, 3, 0)), nil
+}
+
+// CreateYearlyPeriod returns the calendar year in loc.
+func CreateYearlyPeriod(year int, loc *time.Location) Period {
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, locationOrUTC(loc))
+	return periodUntil(start, start.AddDate(1, 0, 0))
+}
+
+// CreateFiscalMonthPeriod returns the fiscal month of year/month for months
+// starting on startDay (1-28), e.g. from the 25th of month to the 24th of
+// the next month.
+func CreateFiscalMonthPeriod(year int, month time.Month, startDay int, loc *time.Location) (Period, error) {
+	if startDay < 1 || startDay > 28 {
+		return Period{}, fmt.Errorf("fiscal month start day %d must be between 1 and 28", startDay)
+	}
+	start := time.Date(year, month, startDay, 0, 0, 0, 0, locationOrUTC(loc))
+	return periodUntil(start, start.AddDate(0, 1, 0)), nil
+}
+
+// Location returns the user's time zone, or UTC when it is unset or unknown.
+func (u *User) Location() *time.Location {
+	if u.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// MonthlyPeriod returns the user's month in their time zone, honouring
+// their fiscal month start day.
+func (u *User) MonthlyPeriod(year int, month time.Month) Period {
+	if u.FiscalMonthStart > 1 {
+		if period, err := CreateFiscalMonthPeriod(year, month, u.FiscalMonthStart, u.Location()); err == nil {
+			return period
+		}
+	}
+	return CreateMonthlyPeriodIn(year, month, u.Location())
+}
+
+// MonthlyPeriodOf returns the user's month that contains date.
+func (u *User) MonthlyPeriodOf(date time.Time) Period {
+	local := date.In(u.Location())
+	period := u.MonthlyPeriod(local.Year(), local.Month())
+	if local.Before(period.StartDate) {
+		previous := period.StartDate.AddDate(0, -1, 0)
+		period = u.MonthlyPeriod(previous.Year(), previous.Month())
+	}
+	return period
+}
+
+// SetPeriodSettings changes the time zone (an IANA name such as
+// "Asia/Jakarta") and fiscal month start day used for the user's periods. A
+// start day of 0 or 1 means calendar months.
+func (s *FinanceService) SetPeriodSettings(ctx context.Context, userID, timezone string, fiscalMonthStart int) error {
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return fmt.Errorf("unknown time zone %q: %w", timezone, err)
+	}
+	if fiscalMonthStart < 0 || fiscalMonthStart > 28 {
+		return fmt.Errorf("fiscal month start day %d must be between 1 and 28", fiscalMonthStart)
+	}
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.loadHistory(ctx, user); err != nil {
+		return err
+	}
+	user.Timezone = timezone
+	user.FiscalMonthStart = fiscalMonthStart
+	user.RebuildTotals()
+
+	return s.save(ctx, user, "set_period_settings")
+}
@@ -0,0 +1,580 @@
+package arus
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/shopspring/decimal"
+)
+
+// PlaintextTransaction is a transaction read from a Beancount or
+// ledger-cli file.
+type PlaintextTransaction struct {
+	// Line of the file the transaction starts on
+	Line        int
+	Date        time.Time
+	Description string
+	Tags        []string
+	Postings    []PlaintextPosting
+}
+
+// PlaintextPosting is one leg of a plaintext transaction. Amounts without a
+// commodity have an empty currency.
+type PlaintextPosting struct {
+	Account string
+	Amount  Money
+}
+
+// Amounts in plaintext files use a decimal point whatever the user's locale
+var plaintextLocale = Locale{Tag: "plaintext", ThousandSeparator: ",", DecimalSeparator: "."}
+
+// Dated Beancount directives other than transactions
+var beancountDirectives = map[string]bool{
+	"open": true, "close": true, "commodity": true, "balance": true, "pad": true, "note": true,
+	"document": true, "event": true, "query": true, "custom": true, "price": true,
+}
+
+var (
+	plaintextDate      = regexp.MustCompile(`^(\d{4})[-/.](\d{1,2})[-/.](\d{1,2})(=\S+)?\s+(.*)$`)
+	plaintextCommodity = regexp.MustCompile(`^[A-Z][A-Z0-9'._-]*$`)
+)
+
+// ParsePlaintextLedger reads the transactions of a Beancount or ledger-cli
+// file. Other directives, such as open, price or balance, and automated or
+// periodic ledger-cli transactions are skipped. A posting without an amount
+// takes what balances the transaction. Costs, prices and balance
+// assertions on postings are ignored.
+func ParsePlaintextLedger(r io.Reader) ([]PlaintextTransaction, error) {
+	var transactions []PlaintextTransaction
+	var current *PlaintextTransaction
+	inBlock := false
+
+	finish := func() error {
+		if current == nil {
+			return nil
+		}
+		tx := *current
+		current = nil
+		if err := tx.balance(); err != nil {
+			return fmt.Errorf("line %d: %w", tx.Line, err)
+		}
+		transactions = append(transactions, tx)
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := stripPlaintextComment(scanner.Text())
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if !unicode.IsSpace(rune(line[0])) {
+			if err := finish(); err != nil {
+				return nil, err
+			}
+			inBlock = false
+			match := plaintextDate.FindStringSubmatch(line)
+			if match == nil {
+				// Automated and periodic transactions have postings of
+				// their own to skip
+				inBlock = line[0] == '=' || line[0] == '~'
+				continue
+			}
+			tx, ok, err := parsePlaintextHeader(match)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			if !ok {
+				inBlock = true
+				continue
+			}
+			tx.Line = lineNumber
+			current = &tx
+			continue
+		}
+
+		if current == nil || inBlock {
+			continue
+		}
+		posting, ok, err := parsePlaintextPosting(strings.TrimSpace(line))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		if ok {
+			current.Postings = append(current.Postings, posting)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := finish(); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+// stripPlaintextComment removes a comment, which starts with a semicolon in
+// both formats, or a hash at the start of a ledger-cli line.
+func stripPlaintextComment(line string) string {
+	if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "%") || strings.HasPrefix(line, "*") {
+		return ""
+	}
+	inString := false
+	for i, r := range line {
+		switch {
+		case r == '"':
+			inString = !inString
+		case r == ';' && !inString:
+			return strings.TrimRight(line[:i], " \t")
+		}
+	}
+	return strings.TrimRight(line, " \t")
+}
+
+// parsePlaintextHeader reads the first line of a dated entry. It reports
+// false for dated directives that are not transactions.
+func parsePlaintextHeader(match []string) (PlaintextTransaction, bool, error) {
+	year, _ := strconv.Atoi(match[1])
+	month, _ := strconv.Atoi(match[2])
+	day, _ := strconv.Atoi(match[3])
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if date.Month() != time.Month(month) || date.Day() != day {
+		return PlaintextTransaction{}, false, fmt.Errorf("invalid date %s-%s-%s", match[1], match[2], match[3])
+	}
+
+	rest := strings.TrimSpace(match[5])
+	word, _, _ := strings.Cut(rest, " ")
+	switch word {
+	case "*", "!", "txn":
+		rest = strings.TrimSpace(strings.TrimPrefix(rest, word))
+	default:
+		if beancountDirectives[word] {
+			return PlaintextTransaction{}, false, nil
+		}
+	}
+	// A ledger-cli transaction code, such as a check number
+	if strings.HasPrefix(rest, "(") {
+		if end := strings.Index(rest, ")"); end >= 0 {
+			rest = strings.TrimSpace(rest[end+1:])
+		}
+	}
+
+	tx := PlaintextTransaction{Date: date}
+	var texts []string
+	for rest != "" {
+		switch {
+		case rest[0] == '"':
+			text, remaining, err := cutQuoted(rest)
+			if err != nil {
+				return PlaintextTransaction{}, false, err
+			}
+			texts = append(texts, text)
+			rest = strings.TrimSpace(remaining)
+		case rest[0] == '#' || rest[0] == '^':
+			word, remaining, _ := strings.Cut(rest, " ")
+			if rest[0] == '#' {
+				tx.Tags = append(tx.Tags, word[1:])
+			}
+			rest = strings.TrimSpace(remaining)
+		default:
+			// ledger-cli payees are unquoted
+			texts = append(texts, rest)
+			rest = ""
+		}
+	}
+	// Beancount puts the payee before the narration
+	slices.Reverse(texts)
+	for _, text := range texts {
+		if text != "" {
+			tx.Description = text
+			break
+		}
+	}
+	return tx, true, nil
+}
+
+// cutQuoted splits a string literal off the start of text, which starts
+// with a double quote.
+func cutQuoted(text string) (quoted, rest string, err error) {
+	var b strings.Builder
+	for i := 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			if i+1 < len(text) {
+				i++
+				b.WriteByte(text[i])
+			}
+		case '"':
+			return b.String(), text[i+1:], nil
+		default:
+			b.WriteByte(text[i])
+		}
+	}
+	return "", "", errors.New("unterminated string")
+}
+
+// parsePlaintextPosting reads a posting line. It reports false for
+// Beancount metadata lines.
+func parsePlaintextPosting(line string) (PlaintextPosting, bool, error) {
+	if strings.HasPrefix(line, "* ") || strings.HasPrefix(line, "! ") {
+		line = strings.TrimSpace(line[2:])
+	}
+	if line == "" || !unicode.IsUpper(rune(line[0])) && line[0] != '[' && line[0] != '(' {
+		return PlaintextPosting{}, false, nil
+	}
+
+	// ledger-cli accounts may contain single spaces and end at a tab or
+	// two spaces; Beancount accounts have no spaces at all
+	account, amount := line, ""
+	end := strings.Index(line, "  ")
+	if tab := strings.IndexByte(line, '\t'); tab >= 0 && (end < 0 || tab < end) {
+		end = tab
+	}
+	if end >= 0 {
+		account, amount = line[:end], line[end:]
+	} else if i := strings.IndexByte(line, ' '); i >= 0 {
+		if _, err := parsePlaintextAmount(withoutCost(line[i:])); err == nil {
+			account, amount = line[:i], line[i:]
+		}
+	}
+	// Virtual postings are written in brackets or parentheses
+	account = strings.Trim(strings.TrimSpace(account), "[]()")
+
+	posting := PlaintextPosting{Account: account}
+	amount = withoutCost(amount)
+	if amount == "" {
+		return posting, true, nil
+	}
+	money, err := parsePlaintextAmount(amount)
+	if err != nil {
+		return PlaintextPosting{}, false, err
+	}
+	posting.Amount = money
+	return posting, true, nil
+}
+
+// withoutCost strips the cost, price or balance assertion that may follow
+// a posting's amount.
+func withoutCost(amount string) string {
+	if i := strings.IndexAny(amount, "@{="); i >= 0 {
+		amount = amount[:i]
+	}
+	return strings.TrimSpace(amount)
+}
+
+func parsePlaintextAmount(text string) (Money, error) {
+	fields := strings.Fields(text)
+	if len(fields) == 2 {
+		for i, field := range fields {
+			if !plaintextCommodity.MatchString(field) {
+				continue
+			}
+			number, err := decimal.NewFromString(strings.ReplaceAll(fields[1-i], ",", ""))
+			if err != nil {
+				break
+			}
+			return Money{Amount: number, Currency: field}, nil
+		}
+	}
+	return ParseMoney(text, plaintextLocale)
+}
+
+// balance fills in the amount of a posting without one.
+func (tx *PlaintextTransaction) balance() error {
+	missing := -1
+	total := decimal.Zero
+	var currencies []string
+	for i, posting := range tx.Postings {
+		if posting.Amount.Amount.IsZero() && posting.Amount.Currency == "" {
+			if missing >= 0 {
+				return errors.New("more than one posting has no amount")
+			}
+			missing = i
+			continue
+		}
+		if !slices.Contains(currencies, posting.Amount.Currency) {
+			currencies = append(currencies, posting.Amount.Currency)
+		}
+		total = total.Add(posting.Amount.Amount)
+	}
+	if missing < 0 {
+		return nil
+	}
+	if len(currencies) != 1 {
+		return errors.New("cannot infer a posting amount across commodities")
+	}
+	tx.Postings[missing].Amount = Money{Amount: total.Neg(), Currency: currencies[0]}
+	return nil
+}
+
+// PlaintextSkip is a transaction an import did not record, and why.
+type PlaintextSkip struct {
+	Line        int
+	Description string
+	Reason      string
+}
+
+// PlaintextImportReport is what an import of a plaintext ledger recorded.
+type PlaintextImportReport struct {
+	Incomes  []Transaction
+	Expenses []Transaction
+	Skipped  []PlaintextSkip
+}
+
+// Tag put on incomes imported from opening balances
+const OpeningBalanceTag = "opening-balance"
+
+// plaintextRoot returns the class of a plaintext account from its first
+// component, as named by either tool.
+func plaintextRoot(account string) (LedgerClass, bool) {
+	root, _, _ := strings.Cut(account, ":")
+	switch strings.ToLower(root) {
+	case "assets", "asset":
+		return LedgerAssets, true
+	case "liabilities", "liability":
+		return LedgerLiabilities, true
+	case "equity":
+		return LedgerEquity, true
+	case "income", "revenue", "revenues":
+		return LedgerIncome, true
+	case "expenses", "expense":
+		return LedgerExpenses, true
+	}
+	return 0, false
+}
+
+// PlaintextCategory maps an asset account to a category: the one given for
+// its longest matching prefix in accounts, or else one guessed from its
+// name, with Expense for everyday accounts. Other accounts map to none.
+func PlaintextCategory(account string, accounts map[string]CategoryType) (CategoryType, bool) {
+	best := -1
+	var category CategoryType
+	for prefix, mapped := range accounts {
+		if (account == prefix || strings.HasPrefix(account, prefix+":")) && len(prefix) > best {
+			best, category = len(prefix), mapped
+		}
+	}
+	if best >= 0 {
+		return category, true
+	}
+	if class, ok := plaintextRoot(account); !ok || class != LedgerAssets {
+		return 0, false
+	}
+	name := strings.ToLower(account)
+	switch {
+	case strings.Contains(name, "emergency"):
+		return Emergency, true
+	case strings.Contains(name, "saving"):
+		return Savings, true
+	case strings.Contains(name, "invest"), strings.Contains(name, "broker"), strings.Contains(name, "retire"):
+		return Investment, true
+	}
+	return Expense, true
+}
+
+// ImportPlaintext records plaintext transactions in date order, mapping
+// asset accounts to categories with PlaintextCategory:
+//   - money coming into categories is an income allocated as posted;
+//     opening balances from equity are tagged OpeningBalanceTag
+//   - money leaving categories is an expense deducted as posted
+//   - expenses charged to a liability, such as a credit card, are deducted
+//     in DefaultDeductionOrder; paying the liability off later is skipped,
+//     as the charges already counted
+//
+// Transfers between categories and transactions touching no category are
+// skipped, as are those that cannot be recorded, such as ones in an
+// archived period.
+func (u *User) ImportPlaintext(transactions []PlaintextTransaction, accounts map[string]CategoryType) PlaintextImportReport {
+	var report PlaintextImportReport
+	sorted := slices.Clone(transactions)
+	slices.SortStableFunc(sorted, func(a, b PlaintextTransaction) int { return a.Date.Compare(b.Date) })
+
+	for _, plaintext := range sorted {
+		skip := func(reason string) {
+			report.Skipped = append(report.Skipped, PlaintextSkip{Line: plaintext.Line, Description: plaintext.Description, Reason: reason})
+		}
+		kind, tx, err := u.importPlaintext(plaintext, accounts)
+		switch {
+		case err != nil:
+			skip(err.Error())
+		case kind == TransactionIncome:
+			report.Incomes = append(report.Incomes, tx)
+		case kind == TransactionExpense:
+			report.Expenses = append(report.Expenses, tx)
+		default:
+			skip("no category changes")
+		}
+	}
+	return report
+}
+
+func (u *User) importPlaintext(plaintext PlaintextTransaction, accounts map[string]CategoryType) (TransactionKind, Transaction, error) {
+	var deltas []Allocation
+	var funding []LedgerClass
+	for _, posting := range plaintext.Postings {
+		amount := posting.Amount
+		if amount.Currency == "" {
+			amount.Currency = u.Currency()
+		}
+		if category, ok := PlaintextCategory(posting.Account, accounts); ok {
+			i := slices.IndexFunc(deltas, func(a Allocation) bool {
+				return a.Category == category && a.Amount.Currency == amount.Currency
+			})
+			if i < 0 {
+				deltas = append(deltas, Allocation{Category: category, Amount: amount})
+			} else {
+				deltas[i].Amount = deltas[i].Amount.Add(amount)
+			}
+			continue
+		}
+		if class, ok := plaintextRoot(posting.Account); ok {
+			funding = append(funding, class)
+		}
+	}
+	deltas = slices.DeleteFunc(deltas, func(a Allocation) bool { return a.Amount.IsZero() })
+	if slices.ContainsFunc(deltas, func(a Allocation) bool { return a.Amount.Currency != deltas[0].Amount.Currency }) {
+		return "", Transaction{}, errors.New("transaction changes categories in several currencies")
+	}
+
+	if len(deltas) == 0 {
+		if slices.Contains(funding, LedgerExpenses) && slices.Contains(funding, LedgerLiabilities) {
+			return u.importCharge(plaintext, accounts)
+		}
+		return "", Transaction{}, nil
+	}
+	if err := u.checkNotArchived(plaintext.Date); err != nil {
+		return "", Transaction{}, err
+	}
+
+	incoming := deltas[0].Amount.Amount.IsPositive()
+	for _, delta := range deltas {
+		if delta.Amount.Amount.IsPositive() != incoming {
+			return "", Transaction{}, errors.New("transfers between categories are not imported")
+		}
+		category, exists := u.Categories[delta.Category]
+		if !exists {
+			return "", Transaction{}, &CategoryNotFoundError{Category: delta.Category}
+		}
+		if err := category.checkCurrency(delta.Amount); err != nil {
+			return "", Transaction{}, err
+		}
+		if !incoming && category.BalanceIn(delta.Amount.Currency).Amount.LessThan(delta.Amount.Amount.Abs()) {
+			return "", Transaction{}, &InsufficientFundsError{
+				Category:  &delta.Category,
+				Needed:    delta.Amount.Abs(),
+				Available: category.BalanceIn(delta.Amount.Currency),
+			}
+		}
+	}
+	if !incoming && len(funding) > 0 && !slices.Contains(funding, LedgerExpenses) && slices.Contains(funding, LedgerLiabilities) {
+		return "", Transaction{}, errors.New("liability payments are not imported")
+	}
+
+	total := NewMoneyZero(deltas[0].Amount.Currency)
+	for _, delta := range deltas {
+		total = total.Add(delta.Amount)
+	}
+	tx := NewTransaction(total, plaintext.Date, plaintext.Description)
+	tx.Tags = slices.Clone(plaintext.Tags)
+
+	if incoming {
+		if slices.Contains(funding, LedgerEquity) && !slices.Contains(funding, LedgerIncome) {
+			tx.Tags = append(tx.Tags, OpeningBalanceTag)
+		}
+		for _, delta := range deltas {
+			if err := u.Categories[delta.Category].Credit(delta.Amount); err != nil {
+				return "", Transaction{}, err
+			}
+		}
+		tx.Allocations = deltas
+		u.Incomes = append(u.Incomes, tx)
+		u.recordTotals(tx, false)
+		return TransactionIncome, tx, nil
+	}
+
+	for _, delta := range deltas {
+		if err := u.Categories[delta.Category].Debit(delta.Amount); err != nil {
+			return "", Transaction{}, err
+		}
+		tx.Deductions = append(tx.Deductions, Deduction{Category: delta.Category, Amount: delta.Amount.Abs()})
+	}
+	u.Expenses = append(u.Expenses, tx)
+	u.recordTotals(tx, true)
+	u.classifyExpense(len(u.Expenses) - 1)
+	return TransactionExpense, tx, nil
+}
+
+// importCharge records an expense charged to a liability.
+func (u *User) importCharge(plaintext PlaintextTransaction, accounts map[string]CategoryType) (TransactionKind, Transaction, error) {
+	var amount Money
+	for _, posting := range plaintext.Postings {
+		if class, _ := plaintextRoot(posting.Account); class != LedgerExpenses {
+			continue
+		}
+		if posting.Amount.Currency == "" {
+			posting.Amount.Currency = u.Currency()
+		}
+		if amount.Currency != "" && amount.Currency != posting.Amount.Currency {
+			return "", Transaction{}, errors.New("charge spans several currencies")
+		}
+		amount = Money{Amount: amount.Amount.Add(posting.Amount.Amount), Currency: posting.Amount.Currency}
+	}
+	if !amount.Amount.IsPositive() {
+		return "", Transaction{}, nil
+	}
+	expense := NewExpense(amount, plaintext.Date, plaintext.Description)
+	expense.Tags = slices.Clone(plaintext.Tags)
+	if err := u.ProcessExpense(expense); err != nil {
+		return "", Transaction{}, err
+	}
+	return TransactionExpense, u.Expenses[len(u.Expenses)-1], nil
+}
+
+// ImportPlaintext reads a Beancount or ledger-cli file and records its
+// transactions for the user, see User.ImportPlaintext. accounts maps
+// account prefixes to categories; accounts it does not cover are guessed.
+func (s *FinanceService) ImportPlaintext(ctx context.Context, userID string, r io.Reader, accounts map[string]CategoryType) (_ PlaintextImportReport, err error) {
+	ctx, span := s.startSpan(ctx, "ImportPlaintext", userID)
+	defer endSpan(span, &err)
+
+	transactions, err := ParsePlaintextLedger(r)
+	if err != nil {
+		return PlaintextImportReport{}, err
+	}
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return PlaintextImportReport{}, err
+	}
+	if err := s.quotaFor(userID).Check(QuotaTransactions, user.TransactionCount(), len(transactions)); err != nil {
+		return PlaintextImportReport{}, err
+	}
+	report := user.ImportPlaintext(transactions, accounts)
+	if len(report.Incomes) == 0 && len(report.Expenses) == 0 {
+		return report, nil
+	}
+
+	if err := s.save(ctx, user, "import_plaintext"); err != nil {
+		return PlaintextImportReport{}, err
+	}
+	s.log().InfoContext(ctx, "imported plaintext ledger", LogKeyUserID, userID,
+		"incomes", len(report.Incomes), "expenses", len(report.Expenses), "skipped", len(report.Skipped))
+	s.publishLedger(user, slices.Concat(report.Incomes, report.Expenses)...)
+	s.Telemetry.Track(ctx, "import", "plaintext", userID, map[string]string{
+		"transactions": strconv.Itoa(len(report.Incomes) + len(report.Expenses)),
+	})
+	return report, nil
+}
@@ -0,0 +1,197 @@
+package arus
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// IncomePreview is what allocating an income would record, worked out on a
+// copy of the user so nothing changes.
+type IncomePreview struct {
+	Income Money
+	// Credit to each category exactly as AllocateIncome records it: the
+	// windfall first, then the rules' shares with leftover cents spread
+	// across them
+	Allocations []Allocation
+	// Part of the income left out because the rules add up to less than
+	// 100%
+	Unallocated Money
+	// Net amount rounded away, booked to the rounding ledger
+	RoundingDifference Money
+	// Category balances right after the allocation
+	Balances map[CategoryType]Money
+}
+
+// AllocateIncomePreview returns what AllocateIncome would do with the
+// income on date, failing the same way, without changing the user.
+func (u *User) AllocateIncomePreview(income Money, date time.Time) (IncomePreview, error) {
+	trial, err := u.clone()
+	if err != nil {
+		return IncomePreview{}, err
+	}
+	rounded := len(trial.Rounding.Entries)
+	if err := trial.AllocateIncome(income, date, ""); err != nil {
+		return IncomePreview{}, err
+	}
+
+	recorded := trial.Incomes[len(trial.Incomes)-1]
+	preview := IncomePreview{
+		Income:             income,
+		Allocations:        recorded.Allocations,
+		Unallocated:        income,
+		RoundingDifference: NewMoneyZero(income.Currency),
+		Balances:           NewBalancesSnapshot(trial).Balances,
+	}
+	for _, allocation := range recorded.Allocations {
+		preview.Unallocated.Amount = preview.Unallocated.Amount.Sub(allocation.Amount.Amount)
+	}
+	for _, entry := range trial.Rounding.Entries[rounded:] {
+		preview.RoundingDifference.Amount = preview.RoundingDifference.Amount.Add(entry.Residue.Amount)
+	}
+	return preview, nil
+}
+
+// AllocateIncomePreview returns what AllocateIncome would do with the
+// income now, for clients to confirm before committing it.
+func (s *FinanceService) AllocateIncomePreview(ctx context.Context, userID string, income Money) (_ IncomePreview, err error) {
+	ctx, span := s.startSpan(ctx, "AllocateIncomePreview", userID)
+	defer endSpan(span, &err)
+
+	user, err := s.readUser(ctx, userID)
+	if err != nil {
+		return IncomePreview{}, err
+	}
+	if err := s.loadIncomeBaseline(ctx, user, income.Currency); err != nil {
+		return IncomePreview{}, err
+	}
+	if err := s.quotaFor(userID).Check(QuotaTransactions, user.TransactionCount(), 1); err != nil {
+		return IncomePreview{}, err
+	}
+	return user.AllocateIncomePreview(income, s.now())
+}
+
+// ExpensePreview is what processing a statement would do with one of its
+// debit lines.
+type ExpensePreview struct {
+	Line StatementLine
+	// The expense as it would be recorded, with the deductions covering it;
+	// zero for card payments, which are not expenses
+	Expense Transaction
+	Status  BatchItemStatus
+	Reason  string `json:",omitempty"`
+	// Set when the categories could not cover the expense
+	InsufficientFunds bool
+}
+
+// StatementPreview is what processing an account statement would do.
+// Every debit line is tried against the balances the lines before it would
+// leave, so all failures are listed; the statement only applies when
+// Failed is zero.
+type StatementPreview struct {
+	Expenses []ExpensePreview
+	Applied  int
+	Skipped  int
+	Failed   int
+}
+
+func (p *StatementPreview) add(item ExpensePreview, err error) {
+	if err != nil {
+		item.Status, item.Reason = BatchFailed, err.Error()
+		item.InsufficientFunds = errors.Is(err, ErrInsufficientFunds)
+	}
+	p.Expenses = append(p.Expenses, item)
+	switch item.Status {
+	case BatchApplied:
+		p.Applied++
+	case BatchSkipped:
+		p.Skipped++
+	case BatchFailed:
+		p.Failed++
+	}
+}
+
+// ProcessAccountStatementPreview returns what ProcessAccountStatement would
+// do with the statement, expense by expense, without changing the user.
+// Card statements list only the charges not recorded yet.
+func (u *User) ProcessAccountStatementPreview(ctx context.Context, statement AccountStatement) (StatementPreview, error) {
+	if err := statement.Validate(); err != nil {
+		return StatementPreview{}, err
+	}
+	trial, err := u.clone()
+	if err != nil {
+		return StatementPreview{}, err
+	}
+
+	var preview StatementPreview
+	recorded := func(item ExpensePreview) ExpensePreview {
+		if expense, err := trial.Expense(item.Expense.ID); err == nil {
+			item.Expense = *expense
+		}
+		return item
+	}
+
+	if trial.creditCard(statement.BankAccount) != nil {
+		match, err := trial.MatchCardStatement(statement)
+		if err != nil {
+			return StatementPreview{}, err
+		}
+		for _, line := range match.Missing {
+			item := ExpensePreview{Line: line, Expense: statement.transaction(line), Status: BatchApplied, Reason: "charged to the card"}
+			err := trial.ChargeCard(statement.BankAccount, item.Expense)
+			preview.add(recorded(item), err)
+		}
+		return preview, nil
+	}
+	if _, err := trial.RouteAccount(statement.BankAccount); err != nil {
+		return StatementPreview{}, err
+	}
+
+	deductionOrder := trial.deductionOrderFor(statement.BankAccount)
+	for _, line := range statement.Lines {
+		if err := ctx.Err(); err != nil {
+			return StatementPreview{}, err
+		}
+		if !line.IsDebit() {
+			continue
+		}
+		if card := trial.cardPayment(line); card != nil {
+			err := trial.payStatementCard(card, line, statement.transaction(line))
+			preview.add(ExpensePreview{Line: line, Status: BatchApplied, Reason: "pays off a credit card"}, err)
+			continue
+		}
+		if trial.walletTopUp(statement.BankAccount, line) != nil {
+			preview.add(ExpensePreview{Line: line, Status: BatchApplied, Reason: "tops up an e-wallet"}, nil)
+			continue
+		}
+		if isCashWithdrawal(line) {
+			err := trial.withdrawStatementCash(statement.BankAccount, line, statement.transaction(line))
+			preview.add(ExpensePreview{Line: line, Status: BatchApplied, Reason: "withdraws cash"}, err)
+			continue
+		}
+		item := ExpensePreview{Line: line, Expense: statement.transaction(line)}
+		result, err := trial.applyExpense(item.Expense, deductionOrder)
+		item.Expense.ID, item.Status, item.Reason = result.TransactionID, result.Status, result.Reason
+		preview.add(recorded(item), err)
+	}
+	return preview, nil
+}
+
+// ProcessAccountStatementPreview returns what ProcessAccountStatement would
+// do with the statement, for clients to review before importing it.
+func (s *FinanceService) ProcessAccountStatementPreview(ctx context.Context, userID string, statement AccountStatement) (_ StatementPreview, err error) {
+	ctx, span := s.startSpan(ctx, "ProcessAccountStatementPreview", userID)
+	defer endSpan(span, &err)
+
+	user, err := s.readUser(ctx, userID)
+	if err != nil {
+		return StatementPreview{}, err
+	}
+	if err := s.loadStatement(ctx, user, statement.BankAccount, statement.Lines); err != nil {
+		return StatementPreview{}, err
+	}
+	if err := s.quotaFor(userID).Check(QuotaTransactions, user.TransactionCount(), len(statement.Expenses())); err != nil {
+		return StatementPreview{}, err
+	}
+	return user.ProcessAccountStatementPreview(ctx, statement)
+}
@@ -0,0 +1,73 @@
+// Package probe serves the liveness and readiness endpoints orchestrators
+// such as Kubernetes poll before routing traffic to an instance.
+package probe
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dnswd/arus"
+	"github.com/dnswd/arus/openapi"
+)
+
+// Handler serves the probes:
+//
+//	GET /healthz  200 while the process is serving requests at all
+//	GET /readyz   200 when every readiness check passes, 503 otherwise
+//
+// Both are meant to be reachable without authentication.
+type Handler struct {
+	Readiness *arus.Readiness
+
+	mux *http.ServeMux
+}
+
+func NewHandler(readiness *arus.Readiness) *Handler {
+	h := &Handler{Readiness: readiness, mux: http.NewServeMux()}
+	h.mux.HandleFunc("GET /healthz", h.healthz)
+	h.mux.HandleFunc("GET /readyz", h.readyz)
+	return h
+}
+
+// Describe adds the probes to doc.
+func (h *Handler) Describe(doc *openapi.Document, prefix string) {
+	tags := []string{"probes"}
+	doc.Add(http.MethodGet, prefix+"/healthz", openapi.Operation{
+		OperationID: "healthz",
+		Summary:     "Whether the process is alive",
+		Tags:        tags,
+		Responses: map[string]openapi.Response{
+			"200": {Description: "Alive"},
+		},
+	})
+	doc.Add(http.MethodGet, prefix+"/readyz", openapi.Operation{
+		OperationID: "readyz",
+		Summary:     "Whether the repository, migrations and connector tokens are usable",
+		Tags:        tags,
+		Responses: map[string]openapi.Response{
+			"200": {Description: "Ready", Content: doc.JSON(arus.ReadinessReport{})},
+			"503": {Description: "A check failed", Content: doc.JSON(arus.ReadinessReport{})},
+		},
+	})
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+func (h *Handler) readyz(w http.ResponseWriter, r *http.Request) {
+	report := h.Readiness.Check(r.Context())
+	status := http.StatusOK
+	if !report.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
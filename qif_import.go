@@ -0,0 +1,216 @@
+package arus
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QIF section types holding account transactions; investment accounts and
+// the category, class and memorized lists are skipped
+var qifAccountTypes = map[string]bool{"bank": true, "cash": true, "ccard": true, "oth a": true, "oth l": true}
+
+// Numbers of a QIF date, such as 12/31'99, 1/ 5'02 or 31.12.1999
+var qifDate = regexp.MustCompile(`^(\d{1,4})\s*[/.-]\s*(\d{1,2})\s*([/.'-])\s*(\d{1,4})$`)
+
+// First bytes of the database files MS Money keeps accounts in
+var msMoneySignature = []byte("MSISAM Database")
+
+// QIFOptions says how a QIF file writes what the format leaves open.
+type QIFOptions struct {
+	// Conventions amounts are written in and the currency they are in; the
+	// zero Locale means en-US
+	Locale Locale
+	// Dates are day first, as in exports from outside the US
+	DayFirst bool
+}
+
+// ParseQIF reads the bank, cash and credit card accounts of a Quicken
+// Interchange Format file, as exported by Quicken and MS Money, into one
+// statement per account. A statement's BankAccount is named by the
+// account's name in the file, empty for transactions before any account
+// header; callers map it to the linked account.
+//
+// Each line gets an ID derived from the account, its fields and how many
+// identical lines came before it, so importing the same history twice
+// records it once.
+func ParseQIF(r io.Reader, options QIFOptions) ([]AccountStatement, error) {
+	if options.Locale.Tag == "" {
+		options.Locale = LocaleEnUS
+	}
+	reader := bufio.NewReader(r)
+	if head, _ := reader.Peek(64); bytes.Contains(head, msMoneySignature) {
+		return nil, errors.New("MS Money .mny files can't be read; export the accounts from Money as QIF")
+	}
+
+	var statements []AccountStatement
+	var statement *AccountStatement
+	var accountName, section string
+	inAccount := false
+	record := make(map[byte]string)
+	seen := make(map[string]int)
+	lineNumber, recordLine := 0, 0
+
+	finish := func() error {
+		defer clear(record)
+		if inAccount {
+			accountName, inAccount = record['N'], false
+			return nil
+		}
+		if !qifAccountTypes[section] || len(record) == 0 {
+			return nil
+		}
+		line, err := qifLine(record, options)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", recordLine, err)
+		}
+		if statement == nil || statement.BankAccount.AccountNumber != accountName {
+			statements = append(statements, AccountStatement{BankAccount: BankAccount{AccountNumber: accountName}})
+			statement = &statements[len(statements)-1]
+		}
+		line.ID = derivedLineID("qif-", accountName, *line, seen)
+		statement.Lines = append(statement.Lines, *line)
+		return nil
+	}
+
+	for {
+		text, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if text != "" {
+			lineNumber++
+			text = strings.TrimRight(text, "\r\n")
+		}
+		switch {
+		case strings.TrimSpace(text) == "":
+		case strings.HasPrefix(text, "!"):
+			if err := finish(); err != nil {
+				return nil, err
+			}
+			header := strings.ToLower(strings.TrimSpace(text[1:]))
+			switch {
+			case header == "account":
+				inAccount = true
+			case strings.HasPrefix(header, "type:"):
+				section = strings.TrimSpace(strings.TrimPrefix(header, "type:"))
+			}
+		case text[0] == '^':
+			if err := finish(); err != nil {
+				return nil, err
+			}
+		default:
+			if len(record) == 0 {
+				recordLine = lineNumber
+			}
+			// Splits and address lines repeat; the first of each is kept
+			if _, ok := record[text[0]]; !ok {
+				record[text[0]] = strings.TrimSpace(text[1:])
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if err := finish(); err != nil {
+		return nil, err
+	}
+	return statements, nil
+}
+
+// qifLine reads one transaction record, keyed by field letter.
+func qifLine(record map[byte]string, options QIFOptions) (*StatementLine, error) {
+	date, err := parseQIFDate(record['D'], options.DayFirst)
+	if err != nil {
+		return nil, err
+	}
+	amountText := record['T']
+	if amountText == "" {
+		amountText = record['U']
+	}
+	amount, err := ParseMoney(amountText, options.Locale)
+	if err != nil {
+		return nil, err
+	}
+	description := record['P']
+	if description == "" {
+		description = record['M']
+	}
+	return &StatementLine{
+		Date:        date,
+		Description: description,
+		Amount:      amount,
+		Reference:   record['N'],
+	}, nil
+}
+
+// parseQIFDate reads the dates Quicken and MS Money write. Two-digit years
+// after an apostrophe are in the 2000s; after a slash, years before 70 are
+// too and the rest in the 1900s.
+func parseQIFDate(text string, dayFirst bool) (time.Time, error) {
+	match := qifDate.FindStringSubmatch(strings.TrimSpace(text))
+	if match == nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", text)
+	}
+	first, _ := strconv.Atoi(match[1])
+	second, _ := strconv.Atoi(match[2])
+	last, _ := strconv.Atoi(match[4])
+
+	var year, month, day int
+	switch {
+	case len(match[1]) == 4:
+		year, month, day = first, second, last
+	case dayFirst:
+		day, month, year = first, second, last
+	default:
+		month, day, year = first, second, last
+	}
+	if len(match[1]) != 4 && len(match[4]) <= 2 {
+		switch {
+		case match[3] == "'" || year < 70:
+			year += 2000
+		default:
+			year += 1900
+		}
+	}
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if date.Day() != day || int(date.Month()) != month {
+		return time.Time{}, fmt.Errorf("invalid date %q", text)
+	}
+	return date, nil
+}
+
+// ImportQIF reads a QIF file and processes each of its accounts like
+// ProcessAccountStatement, into the linked account accounts maps its name
+// to. Accounts are processed one at a time, each all or nothing; lines
+// imported before are skipped. It returns the number of lines of the
+// accounts processed.
+func (s *FinanceService) ImportQIF(ctx context.Context, userID string, r io.Reader, options QIFOptions, accounts map[string]BankAccount) (int, error) {
+	statements, err := ParseQIF(r, options)
+	if err != nil {
+		return 0, err
+	}
+	for _, statement := range statements {
+		if _, ok := accounts[statement.BankAccount.AccountNumber]; !ok {
+			return 0, fmt.Errorf("QIF account %q is not mapped to a bank account", statement.BankAccount.AccountNumber)
+		}
+	}
+
+	lines := 0
+	for _, statement := range statements {
+		name := statement.BankAccount.AccountNumber
+		statement.BankAccount = accounts[name]
+		if err := s.ProcessAccountStatement(ctx, userID, statement); err != nil {
+			return lines, fmt.Errorf("QIF account %q: %w", name, err)
+		}
+		lines += len(statement.Lines)
+	}
+	return lines, nil
+}
@@ -0,0 +1,138 @@
+package arus
+
+import (
+	"context"
+	"fmt"
+)
+
+// Resources a quota can limit
+type QuotaResource string
+
+const (
+	QuotaTransactions   QuotaResource = "transactions"
+	QuotaLinkedAccounts QuotaResource = "linked accounts"
+	QuotaWebhooks       QuotaResource = "webhooks"
+)
+
+// Quota limits what a single user may store. Zero means unlimited.
+type Quota struct {
+	MaxTransactions   int
+	MaxLinkedAccounts int
+	MaxWebhooks       int
+}
+
+func (q Quota) Limit(resource QuotaResource) int {
+	switch resource {
+	case QuotaTransactions:
+		return q.MaxTransactions
+	case QuotaLinkedAccounts:
+		return q.MaxLinkedAccounts
+	case QuotaWebhooks:
+		return q.MaxWebhooks
+	default:
+		return 0
+	}
+}
+
+// Check reports a *QuotaExceededError if adding more of resource on top of
+// current would exceed the limit.
+func (q Quota) Check(resource QuotaResource, current, adding int) error {
+	limit := q.Limit(resource)
+	if limit <= 0 || current+adding <= limit {
+		return nil
+	}
+	return &QuotaExceededError{Resource: resource, Limit: limit, Current: current, Requested: adding}
+}
+
+type QuotaExceededError struct {
+	Resource  QuotaResource
+	Limit     int
+	Current   int
+	Requested int
+}
+
+func (e *QuotaExceededError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("quota exceeded: %s limit is %d, %d in use, %d requested",
+		e.Resource, e.Limit, e.Current, e.Requested)
+}
+
+// QuotaPolicy decides the quota applying to a user, e.g. based on their tier.
+type QuotaPolicy interface {
+	QuotaFor(userID string) Quota
+}
+
+// Tiered quotas: users are assigned to named tiers, everyone else gets Default.
+type TieredQuotas struct {
+	Default Quota
+	Tiers   map[string]Quota
+	// User ID to tier name
+	Users map[string]string
+}
+
+func (t TieredQuotas) QuotaFor(userID string) Quota {
+	if tier, ok := t.Users[userID]; ok {
+		if quota, ok := t.Tiers[tier]; ok {
+			return quota
+		}
+	}
+	return t.Default
+}
+
+// TransactionCount counts every transaction of the user, including those
+// not loaded and those moved to cold storage.
+func (u *User) TransactionCount() int {
+	count := len(u.Incomes) + len(u.Expenses) + u.unloaded - len(u.archivedLeftovers())
+	for _, archived := range u.ArchivedPeriods {
+		count += archived.Incomes + archived.Expenses
+	}
+	return count
+}
+
+func (u *User) LinkedAccountCount() int {
+	count := 0
+	for _, category := range u.Categories {
+		count += len(category.Accounts)
+	}
+	return count + len(u.CreditCards)
+}
+
+func (s *FinanceService) quotaFor(userID string) Quota {
+	if s.Quotas == nil {
+		return Quota{}
+	}
+	return s.Quotas.QuotaFor(userID)
+}
+
+// LinkBankAccount adds a bank account to one of the user's categories.
+func (s *FinanceService) LinkBankAccount(ctx context.Context, userID string, categoryType CategoryType, account BankAccount) error {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	category, exists := user.Categories[categoryType]
+	if !exists {
+		return &CategoryNotFoundError{Category: categoryType}
+	}
+	if category.Account(account) != nil {
+		return nil
+	}
+	if err := s.quotaFor(userID).Check(QuotaLinkedAccounts, user.LinkedAccountCount(), 1); err != nil {
+		return err
+	}
+
+	category.AddAccount(account)
+	if err := s.save(ctx, user, "link_bank_account"); err != nil {
+		return err
+	}
+	s.Telemetry.Track(ctx, "accounts", "link", userID, map[string]string{
+		"category": categoryType.String(),
+	})
+	return nil
+}
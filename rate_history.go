@@ -0,0 +1,525 @@
+package arus
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// How far back a historical rate is looked for when the day itself has
+// none, e.g. over weekends and bank holidays
+const DefaultRateLookback = 7 * 24 * time.Hour
+
+// rateDay returns the calendar day of t at midnight UTC, the key historical
+// rates are stored under.
+func rateDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// DailyRateSource fetches the published daily rates for the days from to to,
+// inclusive, such as the ECB's reference rates.
+type DailyRateSource interface {
+	DailyRates(ctx context.Context, from, to time.Time) ([]ExchangeRate, error)
+}
+
+// ECB reference rate feeds, all quoted against EUR
+const (
+	ECBDailyURL      = "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml"
+	ECBHistory90dURL = "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-hist-90d.xml"
+	ECBHistoryURL    = "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-hist.xml"
+)
+
+// ECBRates reads the European Central Bank's euro reference rates, which
+// are published for every working day since 1999.
+type ECBRates struct {
+	// Feed to read; empty picks the smallest ECB feed covering the days
+	// asked for
+	URL string
+	// Nil uses http.DefaultClient
+	Client *http.Client
+	// Source of the current time for picking a feed; nil uses the wall
+	// clock
+	Clock Clock
+}
+
+type ecbEnvelope struct {
+	Days []struct {
+		Time  string `xml:"time,attr"`
+		Rates []struct {
+			Currency string `xml:"currency,attr"`
+			Rate     string `xml:"rate,attr"`
+		} `xml:"Cube"`
+	} `xml:"Cube>Cube"`
+}
+
+func (e *ECBRates) DailyRates(ctx context.Context, from, to time.Time) ([]ExchangeRate, error) {
+	url := e.URL
+	if url == "" {
+		now := clockOrSystem(e.Clock).Now()
+		switch {
+		case !rateDay(from).Before(rateDay(now)):
+			url = ECBDailyURL
+		case now.Sub(from) < 90*24*time.Hour:
+			url = ECBHistory90dURL
+		default:
+			url = ECBHistoryURL
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ecb rates: %s", resp.Status)
+	}
+
+	var envelope ecbEnvelope
+	if err := xml.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return nil, fmt.Errorf("decoding ecb rates: %w", err)
+	}
+	fetchedAt := clockOrSystem(e.Clock).Now()
+	var rates []ExchangeRate
+	for _, day := range envelope.Days {
+		date, err := time.Parse(time.DateOnly, day.Time)
+		if err != nil {
+			return nil, fmt.Errorf("decoding ecb rates: %w", err)
+		}
+		if date.Before(rateDay(from)) || date.After(rateDay(to)) {
+			continue
+		}
+		for _, quote := range day.Rates {
+			rate, err := decimal.NewFromString(quote.Rate)
+			if err != nil {
+				return nil, fmt.Errorf("decoding ecb rate for %s on %s: %w", quote.Currency, day.Time, err)
+			}
+			rates = append(rates, ExchangeRate{From: "EUR", To: quote.Currency, Rate: rate, FetchedAt: fetchedAt, Date: date})
+		}
+	}
+	return rates, nil
+}
+
+// RateRepository stores historical daily rates.
+type RateRepository interface {
+	SaveRates(ctx context.Context, rates ...ExchangeRate) error
+	// LatestRate returns the From to To rate of the latest day on or before
+	// day, or ErrRateUnavailable when there is none.
+	LatestRate(ctx context.Context, from, to string, day time.Time) (ExchangeRate, error)
+	// Rates returns every stored rate, by currency pair and then day.
+	Rates(ctx context.Context) ([]ExchangeRate, error)
+}
+
+type InMemoryRateRepository struct {
+	// Rates per currency pair, oldest first
+	rates map[string][]ExchangeRate
+	mu    sync.RWMutex
+}
+
+func NewInMemoryRateRepository() *InMemoryRateRepository {
+	return &InMemoryRateRepository{rates: make(map[string][]ExchangeRate)}
+}
+
+func (r *InMemoryRateRepository) SaveRates(ctx context.Context, rates ...ExchangeRate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, rate := range rates {
+		rate.Date = rateDay(rate.Date)
+		key := rateKey(rate.From, rate.To)
+		days := r.rates[key]
+		i, found := slices.BinarySearchFunc(days, rate.Date, func(stored ExchangeRate, day time.Time) int {
+			return stored.Date.Compare(day)
+		})
+		if found {
+			days[i] = rate
+			continue
+		}
+		r.rates[key] = slices.Insert(days, i, rate)
+	}
+	return nil
+}
+
+func (r *InMemoryRateRepository) LatestRate(ctx context.Context, from, to string, day time.Time) (ExchangeRate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	days := r.rates[rateKey(from, to)]
+	i, found := slices.BinarySearchFunc(days, rateDay(day), func(stored ExchangeRate, day time.Time) int {
+		return stored.Date.Compare(day)
+	})
+	if found {
+		return days[i], nil
+	}
+	if i == 0 {
+		return ExchangeRate{}, fmt.Errorf("%w: %s to %s on %s", ErrRateUnavailable, from, to, day.Format(time.DateOnly))
+	}
+	return days[i-1], nil
+}
+
+func (r *InMemoryRateRepository) Rates(ctx context.Context) ([]ExchangeRate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var rates []ExchangeRate
+	for _, key := range slices.Sorted(maps.Keys(r.rates)) {
+		rates = append(rates, r.rates[key]...)
+	}
+	return rates, nil
+}
+
+// SQLRateRepository stores one row per currency pair and day.
+type SQLRateRepository struct {
+	db      *sql.DB
+	dialect SQLDialect
+}
+
+func NewSQLRateRepository(ctx context.Context, db *sql.DB, dialect SQLDialect) (*SQLRateRepository, error) {
+	r := &SQLRateRepository{db: db, dialect: dialect}
+	if err := checkSchema(ctx, db); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *SQLRateRepository) SaveRates(ctx context.Context, rates ...ExchangeRate) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, r.dialect.rebind(`INSERT INTO exchange_rates (from_currency, to_currency, day, rate, fetched_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (from_currency, to_currency, day) DO UPDATE SET rate = excluded.rate, fetched_at = excluded.fetched_at`))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, rate := range rates {
+		_, err := stmt.ExecContext(ctx, rate.From, rate.To, rateDay(rate.Date).Format(time.DateOnly),
+			rate.Rate.String(), rate.FetchedAt.UTC().Format(sqlDateLayout))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *SQLRateRepository) LatestRate(ctx context.Context, from, to string, day time.Time) (ExchangeRate, error) {
+	var stored, rate, fetchedAt string
+	err := r.db.QueryRowContext(ctx, r.dialect.rebind(`SELECT day, rate, fetched_at FROM exchange_rates
+		WHERE from_currency = ? AND to_currency = ? AND day <= ?
+		ORDER BY day DESC LIMIT 1`), from, to, rateDay(day).Format(time.DateOnly)).Scan(&stored, &rate, &fetchedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ExchangeRate{}, fmt.Errorf("%w: %s to %s on %s", ErrRateUnavailable, from, to, day.Format(time.DateOnly))
+	}
+	if err != nil {
+		return ExchangeRate{}, err
+	}
+
+	result := ExchangeRate{From: from, To: to}
+	if result.Date, err = time.Parse(time.DateOnly, stored); err != nil {
+		return ExchangeRate{}, fmt.Errorf("decoding rate day: %w", err)
+	}
+	if result.Rate, err = decimal.NewFromString(rate); err != nil {
+		return ExchangeRate{}, fmt.Errorf("decoding rate: %w", err)
+	}
+	if result.FetchedAt, err = time.Parse(sqlDateLayout, fetchedAt); err != nil {
+		return ExchangeRate{}, fmt.Errorf("decoding rate fetch time: %w", err)
+	}
+	return result, nil
+}
+
+func (r *SQLRateRepository) Rates(ctx context.Context) ([]ExchangeRate, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT from_currency, to_currency, day, rate, fetched_at FROM exchange_rates
+		ORDER BY from_currency, to_currency, day`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rates []ExchangeRate
+	for rows.Next() {
+		var result ExchangeRate
+		var day, rate, fetchedAt string
+		if err := rows.Scan(&result.From, &result.To, &day, &rate, &fetchedAt); err != nil {
+			return nil, err
+		}
+		if result.Date, err = time.Parse(time.DateOnly, day); err != nil {
+			return nil, fmt.Errorf("decoding rate day: %w", err)
+		}
+		if result.Rate, err = decimal.NewFromString(rate); err != nil {
+			return nil, fmt.Errorf("decoding rate: %w", err)
+		}
+		if result.FetchedAt, err = time.Parse(sqlDateLayout, fetchedAt); err != nil {
+			return nil, fmt.Errorf("decoding rate fetch time: %w", err)
+		}
+		rates = append(rates, result)
+	}
+	return rates, rows.Err()
+}
+
+// HistoricalRateProvider looks up the rate between two currencies as it
+// was on a given day.
+type HistoricalRateProvider interface {
+	RateOn(ctx context.Context, from, to string, day time.Time) (ExchangeRate, error)
+}
+
+// RateHistory keeps daily rates from Source in Repo and answers lookups for
+// any pair from them: directly, through the inverse rate, or crossed
+// through Base when the source only quotes against one currency, as the
+// ECB quotes against EUR.
+type RateHistory struct {
+	Source DailyRateSource
+	Repo   RateRepository
+	// Currency the source quotes against; empty uses EUR
+	Base string
+	// How far before the day a rate may be; zero uses DefaultRateLookback
+	Lookback time.Duration
+	// Source of the current time for Rate and Run; nil uses the wall clock
+	Clock Clock
+}
+
+func NewRateHistory(source DailyRateSource, repo RateRepository) *RateHistory {
+	return &RateHistory{Source: source, Repo: repo}
+}
+
+// Sync fetches the rates of the days from to to and stores them, returning
+// how many rates were stored.
+func (h *RateHistory) Sync(ctx context.Context, from, to time.Time) (int, error) {
+	rates, err := h.Source.DailyRates(ctx, from, to)
+	if err != nil {
+		return 0, err
+	}
+	if len(rates) == 0 {
+		return 0, nil
+	}
+	if err := h.Repo.SaveRates(ctx, rates...); err != nil {
+		return 0, err
+	}
+	return len(rates), nil
+}
+
+// Run syncs the last lookback's worth of rates every interval until ctx is
+// cancelled, so rates published late or corrected are picked up too.
+func (h *RateHistory) Run(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := clockOrSystem(h.Clock).Now()
+			if _, err := h.Sync(ctx, now.Add(-h.lookback()), now); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+func (h *RateHistory) lookback() time.Duration {
+	if h.Lookback > 0 {
+		return h.Lookback
+	}
+	return DefaultRateLookback
+}
+
+// RateOn returns the rate from from to to on day, using the latest stored
+// rate within the lookback when the day itself has none.
+func (h *RateHistory) RateOn(ctx context.Context, from, to string, day time.Time) (ExchangeRate, error) {
+	day = rateDay(day)
+	if from == to {
+		return ExchangeRate{From: from, To: to, Rate: decimal.NewFromInt(1), FetchedAt: day, Date: day}, nil
+	}
+	if rate, err := h.stored(ctx, from, to, day); err == nil || !errors.Is(err, ErrRateUnavailable) {
+		return rate, err
+	}
+	if inverse, err := h.stored(ctx, to, from, day); err == nil {
+		return invertRate(inverse), nil
+	} else if !errors.Is(err, ErrRateUnavailable) {
+		return ExchangeRate{}, err
+	}
+
+	base := h.Base
+	if base == "" {
+		base = "EUR"
+	}
+	if from == base || to == base {
+		return ExchangeRate{}, fmt.Errorf("%w: %s to %s on %s", ErrRateUnavailable, from, to, day.Format(time.DateOnly))
+	}
+	fromBase, err := h.RateOn(ctx, base, from, day)
+	if err != nil {
+		return ExchangeRate{}, fmt.Errorf("%s to %s through %s: %w", from, to, base, err)
+	}
+	toBase, err := h.RateOn(ctx, base, to, day)
+	if err != nil {
+		return ExchangeRate{}, fmt.Errorf("%s to %s through %s: %w", from, to, base, err)
+	}
+	// The cross rate is as old as the older of its legs
+	cross := ExchangeRate{
+		From:      from,
+		To:        to,
+		Rate:      toBase.Rate.Div(fromBase.Rate),
+		FetchedAt: fromBase.FetchedAt,
+		Date:      fromBase.Date,
+	}
+	if toBase.Date.Before(cross.Date) {
+		cross.Date = toBase.Date
+	}
+	if toBase.FetchedAt.Before(cross.FetchedAt) {
+		cross.FetchedAt = toBase.FetchedAt
+	}
+	return cross, nil
+}
+
+// Rate returns today's rate, so a RateHistory can also serve as the
+// service's current rates.
+func (h *RateHistory) Rate(ctx context.Context, from, to string) (ExchangeRate, error) {
+	return h.RateOn(ctx, from, to, clockOrSystem(h.Clock).Now())
+}
+
+// stored returns the stored rate on or shortly before day.
+func (h *RateHistory) stored(ctx context.Context, from, to string, day time.Time) (ExchangeRate, error) {
+	rate, err := h.Repo.LatestRate(ctx, from, to, day)
+	if err != nil {
+		return ExchangeRate{}, err
+	}
+	if day.Sub(rate.Date) > h.lookback() {
+		return ExchangeRate{}, fmt.Errorf("%w: %s to %s on %s, latest is from %s",
+			ErrRateUnavailable, from, to, day.Format(time.DateOnly), rate.Date.Format(time.DateOnly))
+	}
+	return rate, nil
+}
+
+func invertRate(rate ExchangeRate) ExchangeRate {
+	rate.From, rate.To = rate.To, rate.From
+	rate.Rate = decimal.NewFromInt(1).Div(rate.Rate)
+	return rate
+}
+
+// ConvertedPeriodSummary summarizes period with every amount converted into
+// currency at the rate of the day it was recorded, so past periods are
+// reported at the rates of their time rather than today's.
+func (u *User) ConvertedPeriodSummary(ctx context.Context, rates HistoricalRateProvider, period Period, currency string) (PeriodSummary, error) {
+	summary := u.GetPeriodSummary(period)
+	converted := PeriodSummary{
+		Period:       period,
+		TotalIncome:  NewMoneyZero(currency),
+		TotalExpense: NewMoneyZero(currency),
+		Deductions:   make(map[CategoryType]Money),
+	}
+
+	convert := func(amount Money, day time.Time) (Money, error) {
+		if amount.Amount.IsZero() {
+			return NewMoneyZero(currency), nil
+		}
+		if amount.Currency == currency {
+			return amount, nil
+		}
+		rate, err := rates.RateOn(ctx, amount.Currency, currency, day)
+		if err != nil {
+			return Money{}, err
+		}
+		return rate.Convert(amount)
+	}
+	convertTransaction := func(tx Transaction) (Transaction, error) {
+		var err error
+		if tx.Amount, err = convert(tx.Amount, tx.Date); err != nil {
+			return Transaction{}, err
+		}
+		tx.Allocations = slices.Clone(tx.Allocations)
+		for i := range tx.Allocations {
+			if tx.Allocations[i].Amount, err = convert(tx.Allocations[i].Amount, tx.Date); err != nil {
+				return Transaction{}, err
+			}
+		}
+		tx.Deductions = slices.Clone(tx.Deductions)
+		for i := range tx.Deductions {
+			if tx.Deductions[i].Amount, err = convert(tx.Deductions[i].Amount, tx.Date); err != nil {
+				return Transaction{}, err
+			}
+		}
+		if tx.FX != nil {
+			fx := *tx.FX
+			if fx.Gain, err = convert(fx.Gain, tx.Date); err != nil {
+				return Transaction{}, err
+			}
+			tx.FX = &fx
+		}
+		return tx, nil
+	}
+
+	for _, income := range summary.Incomes {
+		income, err := convertTransaction(income)
+		if err != nil {
+			return PeriodSummary{}, err
+		}
+		converted.Incomes = append(converted.Incomes, income)
+		converted.TotalIncome = converted.TotalIncome.Add(income.Amount)
+	}
+	for _, expense := range summary.Expenses {
+		expense, err := convertTransaction(expense)
+		if err != nil {
+			return PeriodSummary{}, err
+		}
+		converted.Expenses = append(converted.Expenses, expense)
+		converted.TotalExpense = converted.TotalExpense.Add(expense.Amount)
+		for _, deduction := range expense.Deductions {
+			total, ok := converted.Deductions[deduction.Category]
+			if !ok {
+				total = NewMoneyZero(currency)
+			}
+			converted.Deductions[deduction.Category] = total.Add(deduction.Amount)
+		}
+	}
+	// Rounding is booked throughout the period, so it is converted at the
+	// rate of its end
+	rounding, err := convert(summary.RoundingDifference, period.EndDate)
+	if err != nil {
+		return PeriodSummary{}, err
+	}
+	converted.RoundingDifference = rounding
+	converted.FXGainLoss = fxGainLoss(currency, converted.Incomes, converted.Expenses, period)
+	converted.TotalIncome = converted.TotalIncome.Round()
+	converted.TotalExpense = converted.TotalExpense.Round()
+	converted.Net = converted.TotalIncome.Add(converted.TotalExpense).Round()
+	return converted, nil
+}
+
+// ConvertedPeriodSummary returns the user's summary of period converted
+// into currency at the historical rates of each transaction's day.
+func (s *FinanceService) ConvertedPeriodSummary(ctx context.Context, userID string, period Period, currency string) (PeriodSummary, error) {
+	if s.HistoricalRates == nil {
+		return PeriodSummary{}, errors.New("no historical exchange rates configured")
+	}
+	user, err := s.readUserFor(ctx, userID, period)
+	if err != nil {
+		return PeriodSummary{}, err
+	}
+	if currency == "" {
+		currency = user.Currency()
+	}
+	return user.ConvertedPeriodSummary(ctx, s.HistoricalRates, period, currency)
+}
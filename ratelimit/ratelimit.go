@@ -0,0 +1,184 @@
+// Package ratelimit throttles HTTP clients with token buckets, per user and
+// per IP address, so one client cannot starve the others.
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dnswd/arus"
+)
+
+// How often buckets of idle clients are dropped
+const sweepInterval = time.Minute
+
+// Limit allows Requests per Per, in bursts of up to Requests. Zero Requests
+// means unlimited.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+func PerMinute(requests int) Limit {
+	return Limit{Requests: requests, Per: time.Minute}
+}
+
+func (l Limit) unlimited() bool {
+	return l.Requests <= 0 || l.Per <= 0
+}
+
+// Tokens regained per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+type bucket struct {
+	limit   Limit
+	tokens  float64
+	updated time.Time
+}
+
+// refill adds the tokens earned since the last request, up to the burst.
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(b.limit.Requests), b.tokens+elapsed*b.limit.rate())
+		b.updated = now
+	}
+}
+
+// wait is how long until the bucket holds a whole token.
+func (b *bucket) wait() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.limit.rate() * float64(time.Second))
+}
+
+// Limiter is HTTP middleware enforcing PerIP on every request and PerUser on
+// requests UserID attributes to a user. Routes sets stricter limits for
+// expensive endpoints, such as statement import and reconciliation, keyed
+// by URL path and counted per user, or per IP for anonymous requests.
+type Limiter struct {
+	PerUser Limit
+	PerIP   Limit
+	Routes  map[string]Limit
+	// UserID identifies the user of a request; an error counts the request
+	// as anonymous. Nil limits by IP only.
+	UserID func(r *http.Request) (string, error)
+	// ClientIP identifies the client address; nil uses the connection's
+	// remote address, which is the proxy's when behind one.
+	ClientIP func(r *http.Request) string
+	Clock    arus.Clock
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+func NewLimiter(perUser, perIP Limit, userID func(r *http.Request) (string, error)) *Limiter {
+	return &Limiter{PerUser: perUser, PerIP: perIP, UserID: userID}
+}
+
+// Handler wraps next, answering 429 Too Many Requests with a Retry-After
+// header to clients over their limit.
+func (l *Limiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wait, ok := l.Allow(r); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Allow takes a token from every bucket the request counts against. When
+// any of them is empty it takes none and reports how long to wait.
+func (l *Limiter) Allow(r *http.Request) (wait time.Duration, ok bool) {
+	client := "ip:" + l.clientIP(r)
+	limits := map[string]Limit{client: l.PerIP}
+	if l.UserID != nil {
+		if userID, err := l.UserID(r); err == nil && userID != "" {
+			client = "user:" + userID
+			limits[client] = l.PerUser
+		}
+	}
+	if limit, ok := l.Routes[r.URL.Path]; ok {
+		limits["route:"+r.URL.Path+":"+client] = limit
+	}
+
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	buckets := make([]*bucket, 0, len(limits))
+	for key, limit := range limits {
+		if limit.unlimited() {
+			continue
+		}
+		b := l.bucket(key, limit, now)
+		b.refill(now)
+		wait = max(wait, b.wait())
+		buckets = append(buckets, b)
+	}
+	if wait > 0 {
+		return wait, false
+	}
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return 0, true
+}
+
+func (l *Limiter) bucket(key string, limit Limit, now time.Time) *bucket {
+	if l.buckets == nil {
+		l.buckets = make(map[string]*bucket)
+	}
+	b, exists := l.buckets[key]
+	if !exists || b.limit != limit {
+		b = &bucket{limit: limit, tokens: float64(limit.Requests), updated: now}
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// sweep forgets buckets that have refilled completely, since a new bucket
+// would start out the same.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < sweepInterval {
+		return
+	}
+	l.swept = now
+	for key, b := range l.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Requests) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func (l *Limiter) clientIP(r *http.Request) string {
+	if l.ClientIP != nil {
+		return l.ClientIP(r)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (l *Limiter) now() time.Time {
+	if l.Clock == nil {
+		return time.Now()
+	}
+	return l.Clock.Now()
+}
@@ -0,0 +1,165 @@
+package arus
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// How long a readiness check may take when Readiness sets no timeout
+const DefaultReadinessTimeout = 5 * time.Second
+
+// ID looked up by RepositoryCheck, which no user has
+const readinessProbeUserID = "readiness-probe"
+
+// ReadinessCheck verifies a dependency the service needs to serve
+// requests, such as its database.
+type ReadinessCheck interface {
+	Check(ctx context.Context) error
+}
+
+// ReadinessCheckFunc adapts a function to a ReadinessCheck.
+type ReadinessCheckFunc func(ctx context.Context) error
+
+func (f ReadinessCheckFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// CredentialChecker is implemented by connectors that reach their provider
+// with a token, to report whether the provider still accepts it. Connectors
+// reading exports the user uploads have nothing to check.
+type CredentialChecker interface {
+	CheckCredentials(ctx context.Context) error
+}
+
+// RepositoryCheck checks the repository can be reached by looking up a user
+// that does not exist.
+func RepositoryCheck(repo UserRepository) ReadinessCheck {
+	return ReadinessCheckFunc(func(ctx context.Context) error {
+		_, err := repo.GetByID(ctx, readinessProbeUserID)
+		if err == nil || errors.Is(err, ErrUserNotFound) {
+			return nil
+		}
+		return err
+	})
+}
+
+// SchemaCheck checks db can be reached and has no migrations left to
+// apply, failing with ErrSchemaOutdated otherwise.
+func SchemaCheck(db *sql.DB) ReadinessCheck {
+	return ReadinessCheckFunc(func(ctx context.Context) error {
+		return checkSchema(ctx, db)
+	})
+}
+
+// ConnectorCheck checks the token of each connector that is a
+// CredentialChecker. It returns nil, a check Readiness skips, when none of
+// them is.
+func ConnectorCheck(connectors ...EWalletConnector) ReadinessCheck {
+	var checkers []EWalletConnector
+	for _, connector := range connectors {
+		if _, ok := connector.(CredentialChecker); ok {
+			checkers = append(checkers, connector)
+		}
+	}
+	if len(checkers) == 0 {
+		return nil
+	}
+	return ReadinessCheckFunc(func(ctx context.Context) error {
+		var errs []error
+		for _, connector := range checkers {
+			if err := connector.(CredentialChecker).CheckCredentials(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", connector.Provider(), err))
+			}
+		}
+		return errors.Join(errs...)
+	})
+}
+
+// CheckResult is the outcome of one readiness check. Why a check failed is
+// logged rather than reported, as it can name hosts or connection details.
+type CheckResult struct {
+	Name string
+	OK   bool
+}
+
+// ReadinessReport is the outcome of every readiness check, by name. The
+// service is ready when all of them passed.
+type ReadinessReport struct {
+	Ready  bool
+	Checks []CheckResult
+}
+
+// Readiness reports whether the service's dependencies are usable, for
+// orchestrators to hold traffic back until they are. Nil checks are
+// skipped.
+type Readiness struct {
+	Checks map[string]ReadinessCheck
+	// How long each check may take; zero means DefaultReadinessTimeout
+	Timeout time.Duration
+	// Where failed checks are logged; nil discards them
+	Logger *slog.Logger
+}
+
+// NewReadiness checks the service's user repository and the tokens of the
+// default e-wallet connectors that use one, logging failures to the
+// service's logger. Deployments on SQL add SchemaCheck, so instances are
+// not ready before their migrations are applied.
+func NewReadiness(s *FinanceService) *Readiness {
+	return &Readiness{
+		Checks: map[string]ReadinessCheck{
+			"repository": RepositoryCheck(s.UserRepo),
+			"connectors": ConnectorCheck(DefaultEWalletConnectors...),
+		},
+		Logger: s.Logger,
+	}
+}
+
+// Check runs the checks at once, each within the timeout.
+func (r *Readiness) Check(ctx context.Context) ReadinessReport {
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = DefaultReadinessTimeout
+	}
+	logger := r.Logger
+	if logger == nil {
+		logger = discardLogger
+	}
+
+	results := make([]CheckResult, 0, len(r.Checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range r.Checks {
+		if check == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			result := CheckResult{Name: name, OK: true}
+			if err := check.Check(ctx); err != nil {
+				result.OK = false
+				logger.WarnContext(ctx, "readiness check failed", "check", name, "error", err)
+			}
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	slices.SortFunc(results, func(a, b CheckResult) int { return cmp.Compare(a.Name, b.Name) })
+	report := ReadinessReport{Ready: true, Checks: results}
+	for _, result := range results {
+		report.Ready = report.Ready && result.OK
+	}
+	return report
+}
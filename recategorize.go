@@ -0,0 +1,130 @@
+package arus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Recategorization records part of an expense's deduction moved from one
+// category to another after the fact, such as an expense that was really
+// covered by Savings. The move is a compensating transfer: To is debited
+// and From credited back by Amount.
+type Recategorization struct {
+	ID        string
+	ExpenseID string
+	At        time.Time
+	From      CategoryType
+	To        CategoryType
+	Amount    Money
+}
+
+// RecategorizeExpense moves amount of the expense's deduction from one
+// category to another, crediting from and debiting to so balances stay
+// consistent with the corrected deductions. A zero amount moves all of
+// from's deduction. Locked expenses are rejected with a
+// TransactionLockedError.
+func (u *User) RecategorizeExpense(id string, from, to CategoryType, amount Money, now time.Time) (Recategorization, error) {
+	expense, err := u.Expense(id)
+	if err != nil {
+		return Recategorization{}, err
+	}
+	if u.IsLocked(*expense, now) {
+		return Recategorization{}, &TransactionLockedError{TransactionID: id, LockedSince: u.LockedAt(*expense)}
+	}
+	if !expense.Counts() {
+		return Recategorization{}, fmt.Errorf("expense %s is %s", id, expense.Status)
+	}
+	if from == to {
+		return Recategorization{}, errors.New("expense must be moved to a different category")
+	}
+	i := slices.IndexFunc(expense.Deductions, func(d Deduction) bool { return d.Category == from })
+	if i < 0 {
+		return Recategorization{}, fmt.Errorf("expense %s was not deducted from %s", id, from)
+	}
+	deducted := expense.Deductions[i].Amount.Abs()
+	if amount.IsZero() {
+		amount = deducted
+	}
+	if !amount.Amount.IsPositive() {
+		return Recategorization{}, errors.New("moved amount must be positive")
+	}
+	if amount.Amount.GreaterThan(deducted.Amount) {
+		return Recategorization{}, fmt.Errorf("expense %s only took %s from %s", id, deducted.StringFixed(), from)
+	}
+	source, exists := u.Categories[from]
+	if !exists {
+		return Recategorization{}, &CategoryNotFoundError{Category: from}
+	}
+	target, exists := u.Categories[to]
+	if !exists {
+		return Recategorization{}, &CategoryNotFoundError{Category: to}
+	}
+	if err := source.checkCurrency(amount); err != nil {
+		return Recategorization{}, err
+	}
+
+	// Debit first so a target that can't cover it leaves everything as is
+	if err := target.Debit(amount); err != nil {
+		return Recategorization{}, err
+	}
+	if err := source.Credit(amount); err != nil {
+		return Recategorization{}, err
+	}
+
+	if remaining := deducted.Amount.Sub(amount.Amount); remaining.IsZero() {
+		expense.Deductions = slices.Delete(expense.Deductions, i, i+1)
+	} else {
+		expense.Deductions[i].Amount = Money{Amount: remaining, Currency: deducted.Currency}
+	}
+	if j := slices.IndexFunc(expense.Deductions, func(d Deduction) bool { return d.Category == to }); j >= 0 {
+		expense.Deductions[j].Amount = expense.Deductions[j].Amount.Add(amount)
+	} else {
+		expense.Deductions = append(expense.Deductions, Deduction{Category: to, Amount: amount})
+	}
+	u.RebuildTotals()
+
+	recategorization := Recategorization{
+		ID:        NewID(),
+		ExpenseID: id,
+		At:        now,
+		From:      from,
+		To:        to,
+		Amount:    amount,
+	}
+	u.Recategorizations = append(u.Recategorizations, recategorization)
+	return recategorization, nil
+}
+
+// RecategorizeExpense moves amount of an expense's deduction from one
+// category to another; a zero amount moves all of it. See
+// User.RecategorizeExpense.
+func (s *FinanceService) RecategorizeExpense(ctx context.Context, userID, expenseID string, from, to CategoryType, amount Money) (Recategorization, error) {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return Recategorization{}, err
+	}
+	if err := s.loadTransactionIDs(ctx, user, expenseID); err != nil {
+		return Recategorization{}, err
+	}
+	recategorization, err := user.RecategorizeExpense(expenseID, from, to, amount, s.now())
+	if err != nil {
+		return Recategorization{}, err
+	}
+
+	if err := s.save(ctx, user, "recategorize_expense"); err != nil {
+		return Recategorization{}, err
+	}
+	expense, _ := user.Expense(expenseID)
+	s.log().InfoContext(ctx, "recategorized expense",
+		LogKeyUserID, userID, LogKeyTransactionID, expenseID,
+		"from", from.String(), "to", to.String(), "amount", recategorization.Amount.String())
+	s.publish(userID, EventTransactionUpdated, *expense)
+	s.publish(userID, EventBalancesUpdated, NewBalancesSnapshot(user))
+	s.Telemetry.Track(ctx, "transactions", "recategorize", userID, nil)
+	return recategorization, nil
+}
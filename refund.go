@@ -0,0 +1,168 @@
+package arus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// IsRefund reports whether the transaction gives money back for an
+// expense.
+func (tx Transaction) IsRefund() bool {
+	return tx.RefundOf != ""
+}
+
+// refundable returns how much of the expense each category covered that
+// has not been refunded yet, in the order the categories covered it.
+func (u *User) refundable(expense Transaction) []Deduction {
+	remaining := slices.Clone(expense.Deductions)
+	for _, refund := range u.Expenses {
+		if refund.RefundOf != expense.ID {
+			continue
+		}
+		for _, credited := range refund.Deductions {
+			for i := range remaining {
+				if remaining[i].Category == credited.Category && remaining[i].Overdraft == credited.Overdraft {
+					remaining[i].Amount = remaining[i].Amount.Add(credited.Amount)
+					break
+				}
+			}
+		}
+	}
+	return slices.DeleteFunc(remaining, func(d Deduction) bool { return !d.Amount.Amount.IsPositive() })
+}
+
+// RefundExpense records amount given back for the expense, such as a
+// returned purchase. Rather than being allocated like income, it is
+// credited back to the categories that covered the expense, the last one
+// the expense reached first, so a partial refund restores Emergency before
+// Expense. The refund is recorded among the expenses with a positive
+// amount, so it reduces the period's spending, and its deductions are the
+// negative amounts credited back.
+func (u *User) RefundExpense(expenseID string, amount Money, date time.Time, description string) (Transaction, error) {
+	if err := u.checkNotArchived(date); err != nil {
+		return Transaction{}, err
+	}
+	expense, err := u.Expense(expenseID)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if expense.IsRefund() || expense.Status != Posted {
+		return Transaction{}, fmt.Errorf("only posted expenses can be refunded, %s is not one", expenseID)
+	}
+	if !amount.Amount.IsPositive() {
+		return Transaction{}, errors.New("refund amount must be positive")
+	}
+	if amount.Currency != expense.Amount.Currency {
+		return Transaction{}, &CurrencyMismatchError{Expected: expense.Amount.Currency, Got: amount.Currency}
+	}
+
+	refund := NewTransaction(amount, date, description)
+	refund.Merchant = expense.Merchant
+	refund.RefundOf = expense.ID
+	if err := u.creditBack(*expense, &refund); err != nil {
+		return Transaction{}, err
+	}
+
+	u.Expenses = append(u.Expenses, refund)
+	u.recordTotals(refund, true)
+	return refund, nil
+}
+
+// creditBack credits the refund's amount to the categories that covered
+// the expense, the last one the expense reached first, recording what each
+// got back as the refund's deductions.
+func (u *User) creditBack(expense Transaction, refund *Transaction) error {
+	remaining := u.refundable(expense)
+	left := decimal.Zero
+	for _, deduction := range remaining {
+		left = left.Add(deduction.Amount.Amount)
+	}
+	if refund.Amount.Amount.GreaterThan(left) {
+		return fmt.Errorf("refund of %s exceeds the %s of expense %s left to refund",
+			refund.Amount.StringFixed(), Money{Amount: left, Currency: refund.Amount.Currency}.StringFixed(), expense.ID)
+	}
+
+	toCredit := refund.Amount
+	for i := len(remaining) - 1; i >= 0 && toCredit.Amount.IsPositive(); i-- {
+		credited := remaining[i].Amount
+		if credited.Amount.GreaterThan(toCredit.Amount) {
+			credited = toCredit
+		}
+		category, exists := u.Categories[remaining[i].Category]
+		if !exists {
+			return &CategoryNotFoundError{Category: remaining[i].Category}
+		}
+		if err := category.Credit(credited); err != nil {
+			return err
+		}
+		refund.Deductions = append(refund.Deductions, Deduction{
+			Category:  remaining[i].Category,
+			Amount:    Money{Amount: credited.Amount.Neg(), Currency: credited.Currency},
+			Overdraft: remaining[i].Overdraft,
+		})
+		toCredit = toCredit.Subtract(credited)
+	}
+	return nil
+}
+
+// Refunds returns the refunds recorded for the expense, oldest first.
+func (u *User) Refunds(expenseID string) []Transaction {
+	var refunds []Transaction
+	for _, tx := range u.Expenses {
+		if tx.RefundOf == expenseID {
+			refunds = append(refunds, tx)
+		}
+	}
+	return refunds
+}
+
+// RefundExpense records a refund of the user's expense, crediting it back
+// to the categories that covered the expense.
+func (s *FinanceService) RefundExpense(ctx context.Context, userID, expenseID string, amount Money, description string) (_ Transaction, err error) {
+	ctx, span := s.startSpan(ctx, "RefundExpense", userID)
+	defer endSpan(span, &err)
+
+	claim, err := s.claimIdempotencyKey(ctx, userID, "refund_expense", expenseID, amount.Amount.String(), amount.Currency)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if claim.isReplay() {
+		// The refund was recorded by the first request
+		var refund Transaction
+		return refund, claim.replay(&refund)
+	}
+	defer claim.settle(ctx, &err)
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if err := s.loadExpense(ctx, user, expenseID); err != nil {
+		return Transaction{}, err
+	}
+	if err := s.quotaFor(userID).Check(QuotaTransactions, user.TransactionCount(), 1); err != nil {
+		return Transaction{}, err
+	}
+
+	refund, err := user.RefundExpense(expenseID, amount, s.now(), description)
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	if err := s.save(ctx, user, "refund_expense"); err != nil {
+		return Transaction{}, err
+	}
+	claim.keep(refund)
+	s.log().InfoContext(ctx, "refunded expense",
+		LogKeyUserID, userID, LogKeyTransactionID, refund.ID, "expense", expenseID, "amount", amount.String())
+	s.publishLedger(user, refund)
+	s.Telemetry.Track(ctx, "expenses", "refund", userID, nil)
+	return refund, nil
+}
@@ -0,0 +1,260 @@
+package arus
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Tag added to expenses marked reimbursable
+const BusinessTag = "business"
+
+// ReimbursementStatus is how far an expense's reimbursement claim has got.
+type ReimbursementStatus int
+
+const (
+	// Marked as a business expense to claim back, not submitted yet
+	Reimbursable ReimbursementStatus = iota
+	// Claimed from whoever reimburses it
+	ReimbursementSubmitted
+	// Agreed to be paid
+	ReimbursementApproved
+	// Paid back to the categories that covered the expense
+	Reimbursed
+)
+
+var reimbursementStatusCodes = enumCodes[ReimbursementStatus]{
+	name: "reimbursement status",
+	codes: map[ReimbursementStatus]string{
+		Reimbursable:           "reimbursable",
+		ReimbursementSubmitted: "submitted",
+		ReimbursementApproved:  "approved",
+		Reimbursed:             "paid",
+	},
+	unknown: Reimbursable,
+}
+
+func (r ReimbursementStatus) Code() string {
+	return reimbursementStatusCodes.code(r)
+}
+
+func (r ReimbursementStatus) String() string {
+	return r.Code()
+}
+
+func (r ReimbursementStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.Code())
+}
+
+func (r *ReimbursementStatus) UnmarshalJSON(data []byte) error {
+	value, err := reimbursementStatusCodes.unmarshalJSON(data)
+	*r = value
+	return err
+}
+
+// Reimbursement is the claim for a business expense the user paid and
+// someone else, such as their employer, pays back.
+type Reimbursement struct {
+	// Who pays the expense back
+	From   string
+	Status ReimbursementStatus
+	// When the claim last changed status
+	Updated time.Time
+	// ID of the transaction crediting the payment back, once paid
+	PaymentID string `json:",omitempty"`
+}
+
+// reimbursable returns the expense of that ID marked reimbursable.
+func (u *User) reimbursable(expenseID string) (*Transaction, error) {
+	expense, err := u.Expense(expenseID)
+	if err != nil {
+		return nil, err
+	}
+	if expense.Reimbursement == nil {
+		return nil, fmt.Errorf("expense %s is not marked reimbursable", expenseID)
+	}
+	return expense, nil
+}
+
+// MarkReimbursable marks the expense as a business expense from will pay
+// back, tagging it BusinessTag.
+func (u *User) MarkReimbursable(expenseID, from string, date time.Time) (Transaction, error) {
+	from = strings.TrimSpace(from)
+	if from == "" {
+		return Transaction{}, errors.New("reimbursement must name who pays it")
+	}
+	expense, err := u.Expense(expenseID)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if expense.IsRefund() || expense.Status != Posted {
+		return Transaction{}, fmt.Errorf("only posted expenses can be reimbursed, %s is not one", expenseID)
+	}
+	if expense.Reimbursement != nil {
+		return Transaction{}, fmt.Errorf("expense %s is already %s", expenseID, expense.Reimbursement.Status)
+	}
+	expense.Reimbursement = &Reimbursement{From: from, Status: Reimbursable, Updated: date}
+	if !slices.ContainsFunc(expense.Tags, func(tag string) bool { return strings.EqualFold(tag, BusinessTag) }) {
+		expense.Tags = append(expense.Tags, BusinessTag)
+	}
+	return *expense, nil
+}
+
+// AdvanceReimbursement moves the expense's claim on to status, which must
+// be later than its current one; claims are paid with PayReimbursement.
+func (u *User) AdvanceReimbursement(expenseID string, status ReimbursementStatus, date time.Time) (Transaction, error) {
+	if status == Reimbursed {
+		return Transaction{}, errors.New("reimbursements are paid with PayReimbursement")
+	}
+	expense, err := u.reimbursable(expenseID)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if status <= expense.Reimbursement.Status {
+		return Transaction{}, fmt.Errorf("reimbursement of expense %s is already %s", expenseID, expense.Reimbursement.Status)
+	}
+	expense.Reimbursement.Status = status
+	expense.Reimbursement.Updated = date
+	return *expense, nil
+}
+
+// PayReimbursement records amount paid back for the submitted or approved
+// expense. Like a refund, it is credited back to the categories that
+// covered the expense rather than allocated as income, so the business
+// expense no longer counts as the user's spending.
+func (u *User) PayReimbursement(expenseID string, amount Money, date time.Time) (Transaction, error) {
+	expense, err := u.reimbursable(expenseID)
+	if err != nil {
+		return Transaction{}, err
+	}
+	claim := expense.Reimbursement
+	if claim.Status != ReimbursementSubmitted && claim.Status != ReimbursementApproved {
+		return Transaction{}, fmt.Errorf("reimbursement of expense %s is %s, not submitted", expenseID, claim.Status)
+	}
+	from := claim.From
+	payment, err := u.RefundExpense(expenseID, amount, date, "Reimbursement from "+from)
+	if err != nil {
+		return Transaction{}, err
+	}
+	// RefundExpense may have grown u.Expenses, so the expense is looked up
+	// again
+	expense, _ = u.Expense(expenseID)
+	expense.Reimbursement.Status = Reimbursed
+	expense.Reimbursement.Updated = date
+	expense.Reimbursement.PaymentID = payment.ID
+	return payment, nil
+}
+
+// OutstandingReimbursements returns the expenses marked reimbursable that
+// have not been paid back, oldest first.
+func (u *User) OutstandingReimbursements() []Transaction {
+	var outstanding []Transaction
+	for _, expense := range u.Expenses {
+		if expense.Reimbursement != nil && expense.Reimbursement.Status != Reimbursed {
+			outstanding = append(outstanding, expense)
+		}
+	}
+	slices.SortStableFunc(outstanding, func(a, b Transaction) int {
+		return cmp.Or(a.Date.Compare(b.Date), cmp.Compare(a.ID, b.ID))
+	})
+	return outstanding
+}
+
+// updateReimbursement applies change to the user's expense, saving and
+// announcing the updated expense.
+func (s *FinanceService) updateReimbursement(ctx context.Context, userID, expenseID, operation string, change func(*User) (Transaction, error)) (Transaction, error) {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if err := s.loadExpense(ctx, user, expenseID); err != nil {
+		return Transaction{}, err
+	}
+	expense, err := change(user)
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	if err := s.save(ctx, user, operation); err != nil {
+		return Transaction{}, err
+	}
+	s.log().InfoContext(ctx, "updated reimbursement",
+		LogKeyUserID, userID, LogKeyTransactionID, expenseID, "status", expense.Reimbursement.Status.String())
+	s.publish(userID, EventTransactionUpdated, expense)
+	s.Telemetry.Track(ctx, "reimbursements", expense.Reimbursement.Status.Code(), userID, nil)
+	return expense, nil
+}
+
+// MarkReimbursable marks the user's expense as a business expense that
+// from, such as their employer, will pay back.
+func (s *FinanceService) MarkReimbursable(ctx context.Context, userID, expenseID, from string) (Transaction, error) {
+	return s.updateReimbursement(ctx, userID, expenseID, "mark_reimbursable", func(user *User) (Transaction, error) {
+		return user.MarkReimbursable(expenseID, from, s.now())
+	})
+}
+
+func (s *FinanceService) SubmitReimbursement(ctx context.Context, userID, expenseID string) (Transaction, error) {
+	return s.updateReimbursement(ctx, userID, expenseID, "submit_reimbursement", func(user *User) (Transaction, error) {
+		return user.AdvanceReimbursement(expenseID, ReimbursementSubmitted, s.now())
+	})
+}
+
+func (s *FinanceService) ApproveReimbursement(ctx context.Context, userID, expenseID string) (Transaction, error) {
+	return s.updateReimbursement(ctx, userID, expenseID, "approve_reimbursement", func(user *User) (Transaction, error) {
+		return user.AdvanceReimbursement(expenseID, ReimbursementApproved, s.now())
+	})
+}
+
+// PayReimbursement records the reimbursement of the user's expense being
+// paid, crediting it back to the categories that covered the expense.
+func (s *FinanceService) PayReimbursement(ctx context.Context, userID, expenseID string, amount Money) (_ Transaction, err error) {
+	ctx, span := s.startSpan(ctx, "PayReimbursement", userID)
+	defer endSpan(span, &err)
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if err := s.loadExpense(ctx, user, expenseID); err != nil {
+		return Transaction{}, err
+	}
+	if err := s.quotaFor(userID).Check(QuotaTransactions, user.TransactionCount(), 1); err != nil {
+		return Transaction{}, err
+	}
+
+	payment, err := user.PayReimbursement(expenseID, amount, s.now())
+	if err != nil {
+		return Transaction{}, err
+	}
+	expense, _ := user.Expense(expenseID)
+
+	if err := s.save(ctx, user, "pay_reimbursement"); err != nil {
+		return Transaction{}, err
+	}
+	s.log().InfoContext(ctx, "paid reimbursement",
+		LogKeyUserID, userID, LogKeyTransactionID, payment.ID, "expense", expenseID, "amount", amount.String())
+	s.publish(userID, EventTransactionUpdated, *expense)
+	s.publishLedger(user, payment)
+	s.Telemetry.Track(ctx, "reimbursements", "paid", userID, nil)
+	return payment, nil
+}
+
+func (s *FinanceService) OutstandingReimbursements(ctx context.Context, userID string) ([]Transaction, error) {
+	user, err := s.readUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.loadHistory(ctx, user); err != nil {
+		return nil, err
+	}
+	return user.OutstandingReimbursements(), nil
+}
@@ -0,0 +1,477 @@
+package arus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Reports a user can subscribe to
+type ReportKind int
+
+const (
+	WeeklySpendingDigest ReportKind = iota
+	MonthlySankey
+	QuarterlyNetWorth
+	// Accounts whose statements for the last period are missing or partial
+	MissingStatements
+	// Recap of the month that just closed
+	MonthlyDigest
+	// Financial health score of the month that just closed, with its trend
+	MonthlyHealthScore
+)
+
+const UnknownReport ReportKind = -1
+
+var reportKindCodes = enumCodes[ReportKind]{
+	name: "report kind",
+	codes: map[ReportKind]string{
+		WeeklySpendingDigest: "weekly-spending-digest",
+		MonthlySankey:        "monthly-sankey",
+		QuarterlyNetWorth:    "quarterly-net-worth",
+		MissingStatements:    "missing-statements",
+		MonthlyDigest:        "monthly-digest",
+		MonthlyHealthScore:   "monthly-health-score",
+	},
+	unknown: UnknownReport,
+}
+
+func (k ReportKind) String() string {
+	return reportKindCodes.code(k)
+}
+
+func (k ReportKind) MarshalText() ([]byte, error) {
+	return []byte(reportKindCodes.code(k)), nil
+}
+
+func (k *ReportKind) UnmarshalText(text []byte) error {
+	*k = reportKindCodes.parse(string(text))
+	return nil
+}
+
+func (k *ReportKind) UnmarshalJSON(data []byte) error {
+	value, err := reportKindCodes.unmarshalJSON(data)
+	*k = value
+	return err
+}
+
+func (k ReportKind) MarshalJSON() ([]byte, error) {
+	return json.Marshal(reportKindCodes.code(k))
+}
+
+// How often a scheduled job runs
+type ScheduleInterval int
+
+const (
+	Weekly ScheduleInterval = iota
+	Monthly
+	Quarterly
+)
+
+// ReportSchedule describes when a report is delivered. Times are in UTC.
+type ReportSchedule struct {
+	Interval ScheduleInterval
+	// Day of the week for weekly schedules
+	Weekday time.Weekday
+	// Day of the month (1-28) for monthly and quarterly schedules; quarterly
+	// schedules run in January, April, July and October
+	Day  int
+	Hour int
+}
+
+// DefaultReportSchedule is used when a subscription does not specify one.
+func DefaultReportSchedule(kind ReportKind) ReportSchedule {
+	switch kind {
+	case MonthlySankey, MissingStatements, MonthlyDigest, MonthlyHealthScore:
+		return ReportSchedule{Interval: Monthly, Day: 1, Hour: 8}
+	case QuarterlyNetWorth:
+		return ReportSchedule{Interval: Quarterly, Day: 1, Hour: 8}
+	default:
+		return ReportSchedule{Interval: Weekly, Weekday: time.Monday, Hour: 8}
+	}
+}
+
+func (s ReportSchedule) Validate() error {
+	if s.Hour < 0 || s.Hour > 23 {
+		return fmt.Errorf("schedule hour %d is out of range", s.Hour)
+	}
+	switch s.Interval {
+	case Weekly:
+		if s.Weekday < time.Sunday || s.Weekday > time.Saturday {
+			return fmt.Errorf("schedule weekday %d is out of range", s.Weekday)
+		}
+	case Monthly, Quarterly:
+		if s.Day < 1 || s.Day > 28 {
+			return fmt.Errorf("schedule day %d must be between 1 and 28", s.Day)
+		}
+	default:
+		return fmt.Errorf("unknown schedule interval %d", s.Interval)
+	}
+	return nil
+}
+
+// Next returns the first run strictly after after.
+func (s ReportSchedule) Next(after time.Time) time.Time {
+	after = after.UTC()
+	switch s.Interval {
+	case Weekly:
+		day := time.Date(after.Year(), after.Month(), after.Day(), s.Hour, 0, 0, 0, time.UTC)
+		day = day.AddDate(0, 0, (int(s.Weekday)-int(day.Weekday())+7)%7)
+		if !day.After(after) {
+			day = day.AddDate(0, 0, 7)
+		}
+		return day
+	default:
+		step := 1
+		if s.Interval == Quarterly {
+			step = 3
+		}
+		month := after.Month()
+		if s.Interval == Quarterly {
+			// Round down to the first month of the quarter
+			month = month - (month-1)%3
+		}
+		run := time.Date(after.Year(), month, s.Day, s.Hour, 0, 0, 0, time.UTC)
+		for !run.After(after) {
+			run = run.AddDate(0, step, 0)
+		}
+		return run
+	}
+}
+
+// ReportSubscription delivers a report to the user on a schedule through a
+// named notification channel.
+type ReportSubscription struct {
+	ID        string
+	Report    ReportKind
+	Schedule  ReportSchedule
+	Channel   string
+	NextRun   time.Time
+	LastRun   time.Time
+	LastError string
+}
+
+func (u *User) reportSubscription(id string) (int, error) {
+	for i, subscription := range u.ReportSubscriptions {
+		if subscription.ID == id {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("report subscription %s not found", id)
+}
+
+// GenerateReport renders a report for the user as of at.
+func GenerateReport(user *User, kind ReportKind, at time.Time) (Notification, error) {
+	switch kind {
+	case WeeklySpendingDigest:
+		return spendingDigest(user, Period{StartDate: at.AddDate(0, 0, -7), EndDate: at}), nil
+	case MonthlySankey:
+		return sankeyReport(user, user.MonthlyPeriodOf(at).Previous()), nil
+	case QuarterlyNetWorth:
+		return netWorthReport(user, at), nil
+	case MissingStatements:
+		return missingStatementsReport(user, user.MonthlyPeriodOf(at).Previous()), nil
+	case MonthlyDigest:
+		return monthlyDigestReport(user, user.MonthlyPeriodOf(at).Previous()), nil
+	case MonthlyHealthScore:
+		return healthReport(user, user.MonthlyPeriodOf(at).Previous()), nil
+	default:
+		return Notification{}, fmt.Errorf("unknown report %q", kind.String())
+	}
+}
+
+// reportsSince returns the earliest date the reports generated at look at:
+// the health score's three months before at, and the spending averaged
+// over the months before each.
+func reportsSince(user *User, at time.Time) time.Time {
+	period := user.MonthlyPeriodOf(at).Previous()
+	for range 2 + coverageLookback {
+		period = period.Previous()
+	}
+	return period.StartDate
+}
+
+func spendingDigest(user *User, period Period) Notification {
+	summary := user.GetPeriodSummary(period)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "You spent %s across %d expenses between %s and %s.\n",
+		summary.TotalExpense.Abs().Format(user.Locale()), len(summary.Expenses),
+		period.StartDate.Format("2006-01-02"), period.EndDate.Format("2006-01-02"))
+
+	byTag := make(map[string]Money)
+	for _, expense := range summary.Expenses {
+		tag := "untagged"
+		if len(expense.Tags) > 0 {
+			tag = expense.Tags[0]
+		}
+		total, ok := byTag[tag]
+		if !ok {
+			total = NewMoneyZero(expense.Amount.Currency)
+		}
+		byTag[tag] = total.Add(expense.Amount.Abs())
+	}
+	tags := make([]string, 0, len(byTag))
+	for tag := range byTag {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return byTag[tags[i]].Amount.GreaterThan(byTag[tags[j]].Amount)
+	})
+	for _, tag := range tags {
+		fmt.Fprintf(&b, " - %s: %s\n", tag, byTag[tag].Format(user.Locale()))
+	}
+
+	largest := slices.Clone(summary.Expenses)
+	sort.Slice(largest, func(i, j int) bool {
+		return largest[i].Amount.Abs().Amount.GreaterThan(largest[j].Amount.Abs().Amount)
+	})
+	if len(largest) > 0 {
+		b.WriteString("Largest expenses:\n")
+	}
+	for _, expense := range largest[:min(5, len(largest))] {
+		fmt.Fprintf(&b, " - %s: %s on %s\n", expense.Description,
+			expense.Amount.Abs().Format(user.Locale()), expense.Date.Format("2006-01-02"))
+	}
+
+	return Notification{Subject: "Your weekly spending digest", Body: b.String()}
+}
+
+func sankeyReport(user *User, period Period) Notification {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Money flows for %s:\n", period.StartDate.Format("January 2006"))
+	for _, flow := range user.SankeyFlows(period) {
+		fmt.Fprintf(&b, " - %s -> %s: %s\n", flow.Source, flow.Target, flow.Value.Format(user.Locale()))
+	}
+	return Notification{Subject: "Your monthly money flows", Body: b.String()}
+}
+
+func netWorthReport(user *User, at time.Time) Notification {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Net worth as of %s:\n", at.Format("2006-01-02"))
+
+	total := NewMoneyZero(user.Currency())
+	for _, categoryType := range slices.Concat(DefaultDeductionOrder, []CategoryType{Investment, ToBudget}) {
+		category, exists := user.Categories[categoryType]
+		if !exists {
+			continue
+		}
+		fmt.Fprintf(&b, " - %s: %s\n", categoryType.String(), category.Balance.Format(user.Locale()))
+		total = total.Add(category.Balance)
+	}
+	if debt := user.TotalDebt(total.Currency); debt.Amount.IsPositive() {
+		fmt.Fprintf(&b, " - Debt: -%s\n", debt.Format(user.Locale()))
+		total = total.Subtract(debt)
+	}
+	fmt.Fprintf(&b, "Total: %s\n", total.Format(user.Locale()))
+
+	return Notification{Subject: "Your quarterly net worth", Body: b.String()}
+}
+
+// SubscribeReport subscribes the user to a report delivered through channel.
+// A nil schedule uses the default schedule of the user's country profile, or
+// the report's default schedule.
+func (s *FinanceService) SubscribeReport(ctx context.Context, userID string, kind ReportKind, channel string, schedule *ReportSchedule) (ReportSubscription, error) {
+	if kind == UnknownReport {
+		return ReportSubscription{}, errors.New("unknown report")
+	}
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return ReportSubscription{}, err
+	}
+
+	effective := DefaultReportSchedule(kind)
+	if profile, ok := user.Profile(); ok {
+		effective = profile.ReportSchedule(kind)
+	}
+	// Monthly reports cover the period that just closed, so they go out
+	// when the user's fiscal month turns over
+	if effective.Interval == Monthly && user.FiscalMonthStart > 1 {
+		effective.Day = min(user.FiscalMonthStart, 28)
+	}
+	if schedule != nil {
+		effective = *schedule
+	}
+	if err := effective.Validate(); err != nil {
+		return ReportSubscription{}, err
+	}
+
+	subscription := ReportSubscription{
+		ID:       NewID(),
+		Report:   kind,
+		Schedule: effective,
+		Channel:  channel,
+		NextRun:  effective.Next(s.now()),
+	}
+	user.ReportSubscriptions = append(user.ReportSubscriptions, subscription)
+
+	if err := s.save(ctx, user, "subscribe_report"); err != nil {
+		return ReportSubscription{}, err
+	}
+	s.Telemetry.Track(ctx, "reports", "subscribe", userID, map[string]string{"report": kind.String()})
+	return subscription, nil
+}
+
+func (s *FinanceService) ReportSubscriptions(ctx context.Context, userID string) ([]ReportSubscription, error) {
+	defer s.readLockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return user.ReportSubscriptions, nil
+}
+
+func (s *FinanceService) UpdateReportSchedule(ctx context.Context, userID, subscriptionID string, schedule ReportSchedule) error {
+	if err := schedule.Validate(); err != nil {
+		return err
+	}
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	i, err := user.reportSubscription(subscriptionID)
+	if err != nil {
+		return err
+	}
+	user.ReportSubscriptions[i].Schedule = schedule
+	user.ReportSubscriptions[i].NextRun = schedule.Next(s.now())
+
+	return s.save(ctx, user, "update_report_schedule")
+}
+
+func (s *FinanceService) UnsubscribeReport(ctx context.Context, userID, subscriptionID string) error {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	i, err := user.reportSubscription(subscriptionID)
+	if err != nil {
+		return err
+	}
+	user.ReportSubscriptions = slices.Delete(user.ReportSubscriptions, i, i+1)
+
+	return s.save(ctx, user, "unsubscribe_report")
+}
+
+// ReportScheduler delivers due report subscriptions.
+type ReportScheduler struct {
+	Service *FinanceService
+	Users   UserIterator
+	// Notification channels by name, as referenced by subscriptions
+	Notifiers map[string]Notifier
+}
+
+// RunDue delivers every subscription due at now. Failed deliveries are
+// recorded on the subscription and retried at its next run.
+func (r *ReportScheduler) RunDue(ctx context.Context, now time.Time) error {
+	var due []string
+	err := r.Users.ForEach(ctx, func(user *User) error {
+		if user.Archived() {
+			return nil
+		}
+		for _, subscription := range user.ReportSubscriptions {
+			if !subscription.NextRun.After(now) {
+				due = append(due, user.ID)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, userID := range due {
+		failures, err := r.runUser(ctx, userID, now)
+		if err != nil {
+			return err
+		}
+		errs = append(errs, failures...)
+	}
+	return errors.Join(errs...)
+}
+
+// runUser delivers the user's due reports, holding the user so the
+// schedule update does not race with other changes. It returns the delivery
+// failures, and an error only when the user cannot be loaded or saved.
+func (r *ReportScheduler) runUser(ctx context.Context, userID string, now time.Time) (failures []error, err error) {
+	defer r.Service.lockUser(userID)()
+
+	user, err := r.Service.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	delivered := false
+	for i := range user.ReportSubscriptions {
+		subscription := &user.ReportSubscriptions[i]
+		if subscription.NextRun.After(now) {
+			continue
+		}
+
+		if err := r.Service.loadSince(ctx, user, reportsSince(user, now)); err != nil {
+			return nil, err
+		}
+
+		subscription.LastError = ""
+		if err := r.deliver(ctx, user, *subscription, now); err != nil {
+			subscription.LastError = err.Error()
+			r.Service.log().WarnContext(ctx, "report delivery failed",
+				LogKeyUserID, user.ID, "subscription_id", subscription.ID, "error", err)
+			failures = append(failures, fmt.Errorf("user %s report %s: %w", user.ID, subscription.Report, err))
+		}
+		subscription.LastRun = now
+		subscription.NextRun = subscription.Schedule.Next(now)
+		delivered = true
+	}
+	if !delivered {
+		return nil, nil
+	}
+	return failures, r.Service.save(ctx, user, "deliver_reports")
+}
+
+func (r *ReportScheduler) deliver(ctx context.Context, user *User, subscription ReportSubscription, now time.Time) error {
+	notifier, ok := r.Notifiers[subscription.Channel]
+	if !ok {
+		return fmt.Errorf("unknown notification channel %q", subscription.Channel)
+	}
+	notification, err := GenerateReport(user, subscription.Report, now)
+	if err != nil {
+		return err
+	}
+	return notifier.Notify(ctx, user.ID, notification)
+}
+
+// Run calls RunDue every interval until ctx is cancelled. Due times are
+// checked against the service's clock rather than the ticker's.
+func (r *ReportScheduler) Run(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.RunDue(ctx, r.Service.now()); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
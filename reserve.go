@@ -0,0 +1,80 @@
+package arus
+
+import (
+	"context"
+	"errors"
+)
+
+// spendable returns what the deduction cascade may take from the category's
+// balance in currency: all of it above the floor, and nothing when the
+// balance is at or below it.
+func (c *Category) spendable(currency string) Money {
+	balance := c.BalanceIn(currency)
+	if c.Floor != nil && c.Floor.Currency == currency {
+		balance.Amount = balance.Amount.Sub(c.Floor.Amount)
+	}
+	if balance.Amount.IsNegative() {
+		return NewMoneyZero(currency)
+	}
+	return balance
+}
+
+// holdsBack reports whether the category's floor keeps part of its balance
+// in currency from the deduction cascade.
+func (c *Category) holdsBack(currency string) bool {
+	return c.Floor != nil && c.Floor.Currency == currency && c.Floor.Amount.IsPositive() &&
+		c.BalanceIn(currency).Amount.IsPositive()
+}
+
+// SetFloor sets the reserve the deduction cascade leaves in the category;
+// nil removes it. The floor must be in a currency the category holds.
+func (c *Category) SetFloor(floor *Money) error {
+	if floor != nil {
+		if floor.Amount.IsNegative() {
+			return errors.New("reserve floor must not be negative")
+		}
+		if err := c.checkCurrency(*floor); err != nil {
+			return err
+		}
+	}
+	c.Floor = floor
+	return nil
+}
+
+// floorsHolding returns the categories in deductionOrder whose floors keep
+// money in currency from the cascade.
+func (u *User) floorsHolding(currency string, deductionOrder []CategoryType) []CategoryType {
+	var floors []CategoryType
+	for _, categoryType := range deductionOrder {
+		if category := u.Categories[categoryType]; category != nil && category.holdsBack(currency) {
+			floors = append(floors, categoryType)
+		}
+	}
+	return floors
+}
+
+// SetCategoryFloor sets the reserve expenses never take a category below,
+// such as keeping $2,000 in Emergency; nil removes it. Expenses the
+// categories can only cover by dipping into a reserve fail with an
+// InsufficientFundsError naming the floors in the way.
+func (s *FinanceService) SetCategoryFloor(ctx context.Context, userID string, categoryType CategoryType, floor *Money) error {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	category, exists := user.Categories[categoryType]
+	if !exists {
+		return &CategoryNotFoundError{Category: categoryType}
+	}
+	if err := category.SetFloor(floor); err != nil {
+		return err
+	}
+
+	if err := s.save(ctx, user, "set_category_floor"); err != nil {
+		return err
+	}
+	s.Telemetry.Track(ctx, "reserve", "set_floor", userID, map[string]string{"category": categoryType.Code()})
+	return nil
+}
@@ -0,0 +1,103 @@
+package arus
+
+import (
+	"sort"
+	"time"
+)
+
+// Where a rounding difference came from
+type RoundingSource string
+
+const (
+	RoundingAllocation RoundingSource = "allocation"
+	RoundingFX         RoundingSource = "fx"
+	RoundingInterest   RoundingSource = "interest"
+)
+
+// RoundingEntry records a sub-minor-unit amount that was rounded away.
+// A positive residue means the unrounded amount was larger than what was
+// booked.
+type RoundingEntry struct {
+	Date      time.Time
+	Source    RoundingSource
+	Residue   Money
+	Reference string
+}
+
+// RoundingLedger is the account rounding differences are booked to, so they
+// stay visible instead of being absorbed by whichever category happened to
+// receive the rounded amount.
+type RoundingLedger struct {
+	Entries []RoundingEntry
+}
+
+// Record books the difference between exact and its rounded form, if any,
+// and returns the rounded amount.
+func (l *RoundingLedger) Record(exact Money, date time.Time, source RoundingSource, reference string) Money {
+	rounded := exact.Round()
+	residue := Money{Amount: exact.Amount.Sub(rounded.Amount), Currency: exact.Currency}
+	if !residue.IsZero() {
+		l.Entries = append(l.Entries, RoundingEntry{
+			Date:      date,
+			Source:    source,
+			Residue:   residue,
+			Reference: reference,
+		})
+	}
+	return rounded
+}
+
+// Totals returns the net rounding difference per currency within period.
+func (l RoundingLedger) Totals(period Period) []Money {
+	totals := make(map[string]Money)
+	for _, entry := range l.Entries {
+		if !period.Contains(entry.Date) {
+			continue
+		}
+		total, ok := totals[entry.Residue.Currency]
+		if !ok {
+			total = NewMoneyZero(entry.Residue.Currency)
+		}
+		totals[entry.Residue.Currency] = total.Add(entry.Residue)
+	}
+
+	result := make([]Money, 0, len(totals))
+	for _, total := range totals {
+		result = append(result, total)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Currency < result[j].Currency
+	})
+	return result
+}
+
+// Total returns the net rounding difference in currency within period.
+func (l RoundingLedger) Total(period Period, currency string) Money {
+	for _, total := range l.Totals(period) {
+		if total.Currency == currency {
+			return total
+		}
+	}
+	return NewMoneyZero(currency)
+}
+
+// ConvertExact converts amount without rounding, for callers that book the
+// rounding difference themselves.
+func (r ExchangeRate) ConvertExact(amount Money) (Money, error) {
+	if amount.Currency != r.From {
+		return Money{}, &CurrencyMismatchError{Expected: r.From, Got: amount.Currency}
+	}
+	return Money{Amount: amount.Amount.Mul(r.Rate), Currency: r.To}, nil
+}
+
+// ConvertIncome converts foreign-currency income at rate and allocates the
+// result, booking the conversion's rounding difference to the user's
+// rounding ledger.
+func (u *User) ConvertIncome(income Money, rate ExchangeRate, date time.Time, description string) error {
+	exact, err := rate.ConvertExact(income)
+	if err != nil {
+		return err
+	}
+	converted := u.Rounding.Record(exact, date, RoundingFX, description)
+	return u.AllocateIncome(converted, date, description)
+}
@@ -0,0 +1,98 @@
+package arus
+
+import (
+	"context"
+	"sort"
+)
+
+// Node names used in flow reports besides category names
+const (
+	FlowIncome   = "Income"
+	FlowSpending = "Spending"
+	FlowFXGain   = "FX gain"
+	FlowFXLoss   = "FX loss"
+	// Realized gains and losses on sales of holdings
+	FlowCapitalGains  = "Capital gains"
+	FlowCapitalLosses = "Capital losses"
+)
+
+// SankeyFlow is a (source, target, value) tuple of a Sankey diagram.
+type SankeyFlow struct {
+	Source string
+	Target string
+	Value  Money
+}
+
+// SankeyFlows returns how money moved in period, from the ledger entries
+// of the user's Journal: income into categories, categories into spending,
+// or debt for loan payments, money assigned between envelopes, and
+// liquidated investments into other categories, with realized gains flowing
+// in from Capital gains. Once any income of the period has a Source,
+// incomes flow into Income from nodes named after their sources. The
+// period's net realized gain on currency conversions flows from FX gain
+// into Income, and a net loss from Income into FX loss.
+func (u *User) SankeyFlows(period Period) []SankeyFlow {
+	totals := make(map[[2]string]Money)
+	add := func(source, target string, amount Money) {
+		key := [2]string{source, target}
+		total, ok := totals[key]
+		if !ok {
+			total = NewMoneyZero(amount.Currency)
+		}
+		totals[key] = total.Add(amount.Abs())
+	}
+
+	sources := make(map[string]IncomeSource)
+	sourced := false
+	for _, income := range u.Incomes {
+		if period.Contains(income.Date) {
+			sources[income.ID] = income.Source
+			sourced = sourced || income.Source != UnspecifiedSource
+		}
+	}
+
+	fx := NewMoneyZero(u.Currency())
+	for _, entry := range u.Journal() {
+		if !period.Contains(entry.Date) {
+			continue
+		}
+		switch {
+		case entry.Credit == FXGainAccount:
+			fx = fx.Add(entry.Amount)
+		case entry.Debit == FXGainAccount:
+			fx = Money{Amount: fx.Amount.Sub(entry.Amount.Amount), Currency: fx.Currency}
+		default:
+			add(entry.Credit.Name, entry.Debit.Name, entry.Amount)
+			if source, ok := sources[entry.Source]; ok && sourced && entry.Credit == IncomeAccount {
+				add(source.Name(), FlowIncome, entry.Amount)
+			}
+		}
+	}
+	// Gains and losses are netted over the period
+	if fx.Amount.IsPositive() {
+		add(FlowFXGain, FlowIncome, fx)
+	} else if fx.IsNegative() {
+		add(FlowIncome, FlowFXLoss, fx)
+	}
+
+	flows := make([]SankeyFlow, 0, len(totals))
+	for key, value := range totals {
+		flows = append(flows, SankeyFlow{Source: key[0], Target: key[1], Value: value})
+	}
+	sort.Slice(flows, func(i, j int) bool {
+		if flows[i].Source != flows[j].Source {
+			return flows[i].Source < flows[j].Source
+		}
+		return flows[i].Target < flows[j].Target
+	})
+	return flows
+}
+
+// SankeyFlows returns the user's flows in period, see User.SankeyFlows.
+func (s *FinanceService) SankeyFlows(ctx context.Context, userID string, period Period) ([]SankeyFlow, error) {
+	user, err := s.readUserFor(ctx, userID, period)
+	if err != nil {
+		return nil, err
+	}
+	return user.SankeyFlows(period), nil
+}
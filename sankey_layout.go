@@ -0,0 +1,124 @@
+package arus
+
+import "context"
+
+// Columns of a SankeyLayout
+const (
+	// Where money comes from: incomes and liquidated investments
+	SankeySourceColumn = iota
+	// The categories holding it
+	SankeyCategoryColumn
+	// Where it goes: spending and debt
+	SankeyOutflowColumn
+)
+
+// SankeyNode is a node of a SankeyLayout. Names are unique within a column
+// only: Investment is a source when holdings are liquidated and a category
+// when income is put into it.
+type SankeyNode struct {
+	Name   string
+	Column int
+}
+
+// SankeyLink is a flow between two nodes of a SankeyLayout, by index.
+type SankeyLink struct {
+	Source int
+	Target int
+	Value  Money
+}
+
+// SankeyTimelineEntry is the plain monthly accounting of one period of a
+// SankeyLayout, to show beside the diagram.
+type SankeyTimelineEntry struct {
+	Period   Period
+	Income   Money
+	Expenses Money
+	Net      Money
+}
+
+// SankeyLayout is a Sankey diagram of a period laid out in columns. A
+// month's spending is mostly funded by the previous month's income, so the
+// first column has the incomes of both months, each its own node, beside
+// the investments liquidated in the period. The categories they flow into
+// are in the second column and the period's spending in the third. The
+// diagram spans two months and does not add up to either, so Timeline has
+// each month's own totals.
+type SankeyLayout struct {
+	Period   Period
+	Nodes    []SankeyNode
+	Links    []SankeyLink
+	Timeline []SankeyTimelineEntry
+}
+
+// SankeyIncomeNode names the income node of the month starting on period's
+// start date, such as "Income Jan 2024".
+func SankeyIncomeNode(period Period) string {
+	return FlowIncome + " " + period.StartDate.Format("Jan 2006")
+}
+
+// SankeyLayout lays out the flows of period and the incomes of the period
+// before it, from the user's Journal. Envelope assignments, which move
+// money within the category column, and realized gains are left out.
+func (u *User) SankeyLayout(period Period) SankeyLayout {
+	previous := period.Previous()
+	layout := SankeyLayout{Period: period}
+
+	nodes := make(map[SankeyNode]int)
+	node := func(name string, column int) int {
+		key := SankeyNode{Name: name, Column: column}
+		i, exists := nodes[key]
+		if !exists {
+			i = len(layout.Nodes)
+			nodes[key] = i
+			layout.Nodes = append(layout.Nodes, key)
+		}
+		return i
+	}
+	links := make(map[[2]int]int)
+	link := func(source, target int, amount Money) {
+		key := [2]int{source, target}
+		if i, exists := links[key]; exists {
+			layout.Links[i].Value = layout.Links[i].Value.Add(amount)
+			return
+		}
+		links[key] = len(layout.Links)
+		layout.Links = append(layout.Links, SankeyLink{Source: source, Target: target, Value: amount})
+	}
+
+	investment := CategoryLedgerAccount(Investment)
+	for _, entry := range u.Journal() {
+		switch {
+		case entry.Credit == IncomeAccount && entry.Debit.Class == LedgerAssets:
+			for _, p := range []Period{previous, period} {
+				if p.Contains(entry.Date) {
+					link(node(SankeyIncomeNode(p), SankeySourceColumn), node(entry.Debit.Name, SankeyCategoryColumn), entry.Amount)
+				}
+			}
+		case !period.Contains(entry.Date):
+		case entry.Credit == investment && entry.Debit.Class == LedgerAssets:
+			link(node(investment.Name, SankeySourceColumn), node(entry.Debit.Name, SankeyCategoryColumn), entry.Amount)
+		case entry.Credit.Class == LedgerAssets && (entry.Debit == SpendingAccount || entry.Debit == DebtAccount):
+			link(node(entry.Credit.Name, SankeyCategoryColumn), node(entry.Debit.Name, SankeyOutflowColumn), entry.Amount)
+		}
+	}
+
+	for _, p := range []Period{previous, period} {
+		summary := u.GetPeriodSummary(p)
+		layout.Timeline = append(layout.Timeline, SankeyTimelineEntry{
+			Period:   p,
+			Income:   summary.TotalIncome,
+			Expenses: summary.TotalExpense.Abs(),
+			Net:      summary.Net,
+		})
+	}
+	return layout
+}
+
+// SankeyLayout lays out the user's flows in period, see User.SankeyLayout.
+func (s *FinanceService) SankeyLayout(ctx context.Context, userID string, period Period) (SankeyLayout, error) {
+	user, err := s.readUserFor(ctx, userID, period.Previous(), period)
+	if err != nil {
+		return SankeyLayout{}, err
+	}
+	return user.SankeyLayout(period), nil
+}
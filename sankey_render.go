@@ -0,0 +1,112 @@
+package arus
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// SankeyFormat is a chart format Sankey flows can be rendered in.
+type SankeyFormat string
+
+const (
+	// {"nodes": [{"name"}], "links": [{"source", "target", "value"}]} as
+	// read by d3-sankey, links referring to nodes by index
+	SankeyD3 SankeyFormat = "d3"
+	// A Plotly figure with a single sankey trace
+	SankeyPlotly SankeyFormat = "plotly"
+	// Mermaid sankey-beta diagram source
+	SankeyMermaid SankeyFormat = "mermaid"
+)
+
+// sankeyNodes returns the distinct nodes of flows in order of appearance
+// and the index of each.
+func sankeyNodes(flows []SankeyFlow) ([]string, map[string]int) {
+	var nodes []string
+	index := make(map[string]int)
+	for _, flow := range flows {
+		for _, node := range []string{flow.Source, flow.Target} {
+			if _, exists := index[node]; !exists {
+				index[node] = len(nodes)
+				nodes = append(nodes, node)
+			}
+		}
+	}
+	return nodes, index
+}
+
+// RenderSankey writes flows as a chart in format. Values are written as
+// plain decimal numbers; charts do not mix currencies, so flows are
+// expected to be in one.
+func RenderSankey(w io.Writer, flows []SankeyFlow, format SankeyFormat) error {
+	nodes, index := sankeyNodes(flows)
+	values := make([]json.Number, len(flows))
+	for i, flow := range flows {
+		values[i] = json.Number(flow.Value.StringFixed())
+	}
+
+	switch format {
+	case SankeyD3:
+		type node struct {
+			Name string `json:"name"`
+		}
+		type link struct {
+			Source int         `json:"source"`
+			Target int         `json:"target"`
+			Value  json.Number `json:"value"`
+		}
+		chart := struct {
+			Nodes []node `json:"nodes"`
+			Links []link `json:"links"`
+		}{Nodes: make([]node, len(nodes)), Links: make([]link, len(flows))}
+		for i, name := range nodes {
+			chart.Nodes[i] = node{Name: name}
+		}
+		for i, flow := range flows {
+			chart.Links[i] = link{Source: index[flow.Source], Target: index[flow.Target], Value: values[i]}
+		}
+		return json.NewEncoder(w).Encode(chart)
+
+	case SankeyPlotly:
+		type trace struct {
+			Type string `json:"type"`
+			Node struct {
+				Label []string `json:"label"`
+			} `json:"node"`
+			Link struct {
+				Source []int         `json:"source"`
+				Target []int         `json:"target"`
+				Value  []json.Number `json:"value"`
+			} `json:"link"`
+		}
+		sankey := trace{Type: "sankey"}
+		sankey.Node.Label = nodes
+		sankey.Link.Source = make([]int, len(flows))
+		sankey.Link.Target = make([]int, len(flows))
+		sankey.Link.Value = values
+		for i, flow := range flows {
+			sankey.Link.Source[i] = index[flow.Source]
+			sankey.Link.Target[i] = index[flow.Target]
+		}
+		if sankey.Node.Label == nil {
+			sankey.Node.Label = []string{}
+		}
+		return json.NewEncoder(w).Encode(struct {
+			Data []trace `json:"data"`
+		}{Data: []trace{sankey}})
+
+	case SankeyMermaid:
+		// The diagram's body is CSV, quoted the same way
+		if _, err := io.WriteString(w, "sankey-beta\n\n"); err != nil {
+			return err
+		}
+		out := csv.NewWriter(w)
+		for i, flow := range flows {
+			out.Write([]string{flow.Source, flow.Target, string(values[i])})
+		}
+		out.Flush()
+		return out.Error()
+	}
+	return fmt.Errorf("unknown sankey format %q", format)
+}
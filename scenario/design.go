@@ -0,0 +1,107 @@
+package scenario
+
+import (
+	"time"
+
+	"github.com/dnswd/arus"
+)
+
+var expenseAccount = arus.BankAccount{AccountNumber: "EXP123", BankName: "Expense Bank"}
+
+func halfExpenseHalfSavings() Step {
+	return Rules(Rule(arus.Expense, "0.5"), Rule(arus.Savings, "0.5"))
+}
+
+// DesignScenarios encode the business rules agreed in the cmd/main.go design
+// discussion as executable specifications.
+func DesignScenarios() []*Scenario {
+	jan := Epoch
+
+	return []*Scenario{
+		New("expenses use funds incrementally: expense, then emergency, then savings").
+			Given(
+				Rules(Rule(arus.Expense, "0.5"), Rule(arus.Emergency, "0.3"), Rule(arus.Savings, "0.2")),
+			).
+			When(
+				Income(jan, "1000"),
+				Expense(jan.AddDate(0, 0, 14), "900"),
+			).
+			Then(
+				Balance(arus.Expense, "0"),
+				Balance(arus.Emergency, "0"),
+				Balance(arus.Savings, "100"),
+				Covered(2024, time.January, arus.Expense, "500"),
+				Covered(2024, time.January, arus.Emergency, "300"),
+				Covered(2024, time.January, arus.Savings, "100"),
+				Status(2024, time.January, arus.SavingsUsed),
+			),
+
+		New("spending beyond every fund is rejected").
+			Given(halfExpenseHalfSavings()).
+			When(
+				Income(jan, "100"),
+				Failing(Expense(jan.AddDate(0, 0, 1), "150"), arus.ErrInsufficientFunds),
+			).
+			Then(TotalExpense(2024, time.January, "0")),
+
+		New("sankey flows are (source, target, value) tuples from income through funds to spending").
+			Given(halfExpenseHalfSavings()).
+			When(
+				Income(jan, "1000"),
+				Expense(jan.AddDate(0, 0, 9), "700"),
+			).
+			Then(
+				Flow(2024, time.January, arus.FlowIncome, "Expense", "500"),
+				Flow(2024, time.January, arus.FlowIncome, "Savings", "500"),
+				Flow(2024, time.January, "Expense", arus.FlowSpending, "500"),
+				Flow(2024, time.January, "Savings", arus.FlowSpending, "200"),
+			),
+
+		New("periods are numerically correct monthly accounting").
+			Given(halfExpenseHalfSavings()).
+			When(
+				Income(jan.AddDate(0, 0, 30), "1000"),
+				Expense(jan.AddDate(0, 1, 0), "300"),
+			).
+			Then(
+				TotalIncome(2024, time.January, "1000"),
+				TotalExpense(2024, time.January, "0"),
+				TotalIncome(2024, time.February, "0"),
+				Net(2024, time.February, "-300"),
+			),
+
+		New("imported bank statements are processed as expenses").
+			Given(halfExpenseHalfSavings()).
+			When(
+				Income(jan, "1000"),
+				Import(arus.AccountStatement{
+					BankAccount: expenseAccount,
+					Lines: []arus.StatementLine{
+						{Date: jan.AddDate(0, 0, 3), Description: "Groceries", Amount: money("-120")},
+						{Date: jan.AddDate(0, 0, 5), Description: "Refund", Amount: money("20")},
+					},
+				}),
+			).
+			Then(
+				TotalExpense(2024, time.January, "120"),
+				Balance(arus.Expense, "380"),
+			),
+
+		New("reconciliation differences are a gentle notice, not an error").
+			Given(halfExpenseHalfSavings()).
+			When(
+				Income(jan, "1000"),
+				Reconcile(expenseAccount, "480"),
+			).
+			Then(Notices(arus.InboxReconciliation, 1)),
+
+		New("reconciling to a matching balance clears the notice").
+			Given(halfExpenseHalfSavings()).
+			When(
+				Income(jan, "1000"),
+				Reconcile(expenseAccount, "480"),
+				Reconcile(expenseAccount, "500"),
+			).
+			Then(Notices(arus.InboxReconciliation, 0)),
+	}
+}
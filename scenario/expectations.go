@@ -0,0 +1,129 @@
+package scenario
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dnswd/arus"
+)
+
+func equalMoney(got arus.Money, want string) error {
+	expected := money(want)
+	if !got.Amount.Equal(expected.Amount) || got.Currency != expected.Currency {
+		return fmt.Errorf("got %s, want %s", got, expected)
+	}
+	return nil
+}
+
+func Balance(category arus.CategoryType, amount string) Expectation {
+	return Expectation{
+		Description: fmt.Sprintf("%s balance is %s", category, amount),
+		Check: func(env *Env) error {
+			user, err := env.User()
+			if err != nil {
+				return err
+			}
+			c, exists := user.Categories[category]
+			if !exists {
+				return &arus.CategoryNotFoundError{Category: category}
+			}
+			return equalMoney(c.Balance, amount)
+		},
+	}
+}
+
+// Summary checks the user's month with check.
+func Summary(year int, month time.Month, description string, check func(summary arus.PeriodSummary) error) Expectation {
+	return Expectation{
+		Description: fmt.Sprintf("%s %d: %s", month, year, description),
+		Check: func(env *Env) error {
+			user, err := env.User()
+			if err != nil {
+				return err
+			}
+			return check(user.GetPeriodSummary(user.MonthlyPeriod(year, month)))
+		},
+	}
+}
+
+func Net(year int, month time.Month, amount string) Expectation {
+	return Summary(year, month, "net is "+amount, func(summary arus.PeriodSummary) error {
+		return equalMoney(summary.Net, amount)
+	})
+}
+
+func TotalIncome(year int, month time.Month, amount string) Expectation {
+	return Summary(year, month, "income is "+amount, func(summary arus.PeriodSummary) error {
+		return equalMoney(summary.TotalIncome, amount)
+	})
+}
+
+// TotalExpense checks the month's spending as a positive amount.
+func TotalExpense(year int, month time.Month, amount string) Expectation {
+	return Summary(year, month, "spending is "+amount, func(summary arus.PeriodSummary) error {
+		return equalMoney(summary.TotalExpense.Abs(), amount)
+	})
+}
+
+// Covered checks how much of the month's spending category covered.
+func Covered(year int, month time.Month, category arus.CategoryType, amount string) Expectation {
+	return Summary(year, month, fmt.Sprintf("%s covered %s", category, amount), func(summary arus.PeriodSummary) error {
+		covered, ok := summary.Deductions[category]
+		if !ok {
+			covered = arus.NewMoneyZero(Currency)
+		}
+		return equalMoney(covered, amount)
+	})
+}
+
+func Status(year int, month time.Month, kind arus.IncomeStatusKind) Expectation {
+	return Expectation{
+		Description: fmt.Sprintf("%s %d status is %s", month, year, kind),
+		Check: func(env *Env) error {
+			user, err := env.User()
+			if err != nil {
+				return err
+			}
+			if got := user.CheckIncomeStatus(user.MonthlyPeriod(year, month)).Kind; got != kind {
+				return fmt.Errorf("got %s", got)
+			}
+			return nil
+		},
+	}
+}
+
+// Flow checks a (source, target, value) tuple of the month's Sankey diagram.
+func Flow(year int, month time.Month, source, target, amount string) Expectation {
+	return Expectation{
+		Description: fmt.Sprintf("%s %d flows %s from %s to %s", month, year, amount, source, target),
+		Check: func(env *Env) error {
+			user, err := env.User()
+			if err != nil {
+				return err
+			}
+			for _, flow := range user.SankeyFlows(user.MonthlyPeriod(year, month)) {
+				if flow.Source == source && flow.Target == target {
+					return equalMoney(flow.Value, amount)
+				}
+			}
+			return fmt.Errorf("no flow from %s to %s", source, target)
+		},
+	}
+}
+
+// Notices checks how many inbox items of a kind the user has.
+func Notices(kind arus.InboxItemKind, count int) Expectation {
+	return Expectation{
+		Description: fmt.Sprintf("%d %s notices", count, kind),
+		Check: func(env *Env) error {
+			inbox, err := env.Service.Inbox(env.Ctx, env.UserID)
+			if err != nil {
+				return err
+			}
+			if got := inbox.Counts[kind]; got != count {
+				return fmt.Errorf("got %d", got)
+			}
+			return nil
+		},
+	}
+}
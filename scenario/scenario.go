@@ -0,0 +1,159 @@
+// Package scenario runs end-to-end specifications against the service
+// layer: given a user's setup, when incomes, expenses and imports happen,
+// then balances, summaries and notices are as expected.
+//
+//	scenario.New("emergency fund covers overspending").
+//		Given(scenario.Rules(scenario.Rule(arus.Expense, "0.5"), scenario.Rule(arus.Emergency, "0.5"))).
+//		When(
+//			scenario.Income(scenario.Epoch, "1000"),
+//			scenario.Expense(scenario.Epoch.AddDate(0, 0, 9), "700"),
+//		).
+//		Then(scenario.Balance(arus.Emergency, "300"))
+package scenario
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/dnswd/arus"
+)
+
+// Env is the world a scenario runs in: a fresh service with one user and a
+// fake clock.
+type Env struct {
+	Ctx     context.Context
+	Service *arus.FinanceService
+	Clock   *arus.FakeClock
+	UserID  string
+}
+
+// User loads the scenario's user.
+func (e *Env) User() (*arus.User, error) {
+	return e.Service.UserRepo.GetByID(e.Ctx, e.UserID)
+}
+
+// Step is a setup or an event of a scenario.
+type Step struct {
+	Description string
+	Do          func(env *Env) error
+}
+
+// Expectation is an outcome a scenario checks once all steps ran.
+type Expectation struct {
+	Description string
+	Check       func(env *Env) error
+}
+
+type Scenario struct {
+	Name  string
+	given []Step
+	when  []Step
+	then  []Expectation
+}
+
+func New(name string) *Scenario {
+	return &Scenario{Name: name}
+}
+
+func (s *Scenario) Given(steps ...Step) *Scenario {
+	s.given = append(s.given, steps...)
+	return s
+}
+
+func (s *Scenario) When(steps ...Step) *Scenario {
+	s.when = append(s.when, steps...)
+	return s
+}
+
+func (s *Scenario) Then(expectations ...Expectation) *Scenario {
+	s.then = append(s.then, expectations...)
+	return s
+}
+
+// Result of running a scenario. Failures is empty when it passed.
+type Result struct {
+	Scenario string
+	Failures []string
+}
+
+func (r Result) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// Run plays the scenario against a fresh in-memory service. A failing step
+// stops the scenario; failing expectations are all reported.
+func Run(ctx context.Context, s *Scenario) Result {
+	result := Result{Scenario: s.Name}
+
+	user := arus.NewUser("scenario-user")
+	clock := arus.NewFakeClock(Epoch)
+	service := &arus.FinanceService{UserRepo: arus.NewInMemoryUserRepository(), Clock: clock}
+	if err := service.UserRepo.Save(ctx, user); err != nil {
+		result.Failures = append(result.Failures, err.Error())
+		return result
+	}
+	env := &Env{Ctx: ctx, Service: service, Clock: clock, UserID: user.ID}
+
+	for _, phase := range []struct {
+		name  string
+		steps []Step
+	}{{"given", s.given}, {"when", s.when}} {
+		for _, step := range phase.steps {
+			if err := step.Do(env); err != nil {
+				result.Failures = append(result.Failures, fmt.Sprintf("%s %s: %v", phase.name, step.Description, err))
+				return result
+			}
+		}
+	}
+
+	for _, expectation := range s.then {
+		if err := expectation.Check(env); err != nil {
+			result.Failures = append(result.Failures, fmt.Sprintf("then %s: %v", expectation.Description, err))
+		}
+	}
+	return result
+}
+
+// RunAll runs every scenario and writes a PASS/FAIL line for each to w. It
+// reports whether all of them passed.
+func RunAll(ctx context.Context, w io.Writer, scenarios ...*Scenario) bool {
+	passed := true
+	for _, s := range scenarios {
+		result := Run(ctx, s)
+		if result.Passed() {
+			fmt.Fprintf(w, "PASS %s\n", result.Scenario)
+			continue
+		}
+		passed = false
+		fmt.Fprintf(w, "FAIL %s\n", result.Scenario)
+		for _, failure := range result.Failures {
+			fmt.Fprintf(w, "     %s\n", failure)
+		}
+	}
+	return passed
+}
+
+// updateUser applies fn to the stored user and saves it.
+func updateUser(env *Env, fn func(user *arus.User) error) error {
+	user, err := env.User()
+	if err != nil {
+		return err
+	}
+	if err := fn(user); err != nil {
+		return err
+	}
+	return env.Service.UserRepo.Save(env.Ctx, user)
+}
+
+// expectError fails unless err matches target.
+func expectError(err, target error) error {
+	if err == nil {
+		return fmt.Errorf("expected %v, got no error", target)
+	}
+	if !errors.Is(err, target) {
+		return fmt.Errorf("expected %v, got %v", target, err)
+	}
+	return nil
+}
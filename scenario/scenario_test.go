@@ -0,0 +1,16 @@
+package scenario
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDesignScenarios(t *testing.T) {
+	for _, s := range DesignScenarios() {
+		t.Run(s.Name, func(t *testing.T) {
+			for _, failure := range Run(context.Background(), s).Failures {
+				t.Error(failure)
+			}
+		})
+	}
+}
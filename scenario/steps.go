@@ -0,0 +1,105 @@
+package scenario
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dnswd/arus"
+	"github.com/shopspring/decimal"
+)
+
+// Currency of the amounts in steps and expectations
+const Currency = "USD"
+
+// Epoch is the time scenario clocks start at.
+var Epoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// money parses amount, e.g. "12.50", in Currency.
+func money(amount string) arus.Money {
+	return arus.NewMoney(decimal.RequireFromString(amount), Currency)
+}
+
+// Rule allocates percentage (e.g. "0.2") of each income to category.
+func Rule(category arus.CategoryType, percentage string) arus.AllocationRule {
+	return arus.AllocationRule{CategoryType: category, Percentage: decimal.RequireFromString(percentage)}
+}
+
+func Rules(rules ...arus.AllocationRule) Step {
+	return Step{
+		Description: "allocation rules",
+		Do: func(env *Env) error {
+			return updateUser(env, func(user *arus.User) error {
+				user.AllocationRules = rules
+				return nil
+			})
+		},
+	}
+}
+
+// Funds credits a category directly, e.g. an existing emergency fund.
+func Funds(category arus.CategoryType, amount string) Step {
+	return Step{
+		Description: fmt.Sprintf("%s funds of %s", category, amount),
+		Do: func(env *Env) error {
+			return updateUser(env, func(user *arus.User) error {
+				c, exists := user.Categories[category]
+				if !exists {
+					return &arus.CategoryNotFoundError{Category: category}
+				}
+				return c.Credit(money(amount))
+			})
+		},
+	}
+}
+
+// Income is received on date and allocated by the user's rules.
+func Income(date time.Time, amount string) Step {
+	return Step{
+		Description: fmt.Sprintf("income of %s on %s", amount, date.Format(time.DateOnly)),
+		Do: func(env *Env) error {
+			env.Clock.Set(date)
+			return env.Service.AllocateIncome(env.Ctx, env.UserID, money(amount))
+		},
+	}
+}
+
+func Expense(date time.Time, amount string) Step {
+	return Step{
+		Description: fmt.Sprintf("expense of %s on %s", amount, date.Format(time.DateOnly)),
+		Do: func(env *Env) error {
+			env.Clock.Set(date)
+			return env.Service.ProcessExpense(env.Ctx, env.UserID, money(amount), date, "Expense", arus.ExpenseOptions{})
+		},
+	}
+}
+
+// Import processes a bank statement.
+func Import(statement arus.AccountStatement) Step {
+	return Step{
+		Description: fmt.Sprintf("import of %d statement lines", len(statement.Lines)),
+		Do: func(env *Env) error {
+			return env.Service.ProcessAccountStatement(env.Ctx, env.UserID, statement)
+		},
+	}
+}
+
+// Reconcile reports the bank's balance of a backing account.
+func Reconcile(account arus.BankAccount, actual string) Step {
+	return Step{
+		Description: fmt.Sprintf("reconciling %s at %s", account.AccountNumber, actual),
+		Do: func(env *Env) error {
+			_, err := env.Service.ReconcileAccount(env.Ctx, env.UserID, account, money(actual))
+			return err
+		},
+	}
+}
+
+// Failing expects step to fail with an error matching target.
+func Failing(step Step, target error) Step {
+	return Step{
+		Description: step.Description + " (failing)",
+		Do: func(env *Env) error {
+			return expectError(step.Do(env), target)
+		},
+	}
+}
@@ -0,0 +1,188 @@
+package arus
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Node name used in flow reports for money others owe the user
+const FlowReceivable = "Receivable"
+
+// ReceivableAccount holds the shares of shared expenses others have not
+// paid back yet.
+var ReceivableAccount = LedgerAccount{Class: LedgerAssets, Name: FlowReceivable}
+
+// ExpenseShare is the part of a shared expense someone else owes the user,
+// who paid all of it.
+type ExpenseShare struct {
+	With   string
+	Amount Money
+}
+
+// Receivable is what someone owes the user for shared expenses in one
+// currency.
+type Receivable struct {
+	With   string
+	Amount Money
+}
+
+// Spent returns the part of the transaction's amount that is the user's
+// own spending: an expense less the shares others owe, and nothing for
+// settlements, which only pay those shares back.
+func (tx Transaction) Spent() Money {
+	if tx.Settles != "" {
+		return NewMoneyZero(tx.Amount.Currency)
+	}
+	spent := tx.Amount
+	for _, share := range tx.Shares {
+		spent = spent.Add(share.Amount.Abs())
+	}
+	return spent
+}
+
+// validateShares checks the shares of a shared expense add up to no more
+// than what was paid, one per person.
+func (tx Transaction) validateShares() error {
+	total := NewMoneyZero(tx.Amount.Currency)
+	for i, share := range tx.Shares {
+		if share.With == "" {
+			return errors.New("expense share must name who owes it")
+		}
+		if slices.ContainsFunc(tx.Shares[:i], func(other ExpenseShare) bool { return other.With == share.With }) {
+			return fmt.Errorf("expense is shared with %s more than once", share.With)
+		}
+		if !share.Amount.Amount.IsPositive() {
+			return errors.New("expense share must be positive")
+		}
+		if share.Amount.Currency != tx.Amount.Currency {
+			return &CurrencyMismatchError{Expected: tx.Amount.Currency, Got: share.Amount.Currency}
+		}
+		total = total.Add(share.Amount)
+	}
+	if total.Amount.GreaterThan(tx.Amount.Amount.Abs()) {
+		return fmt.Errorf("expense shares of %s exceed the %s paid", total.StringFixed(), tx.Amount.Abs().StringFixed())
+	}
+	return nil
+}
+
+// unsettled returns what with still owes for the shared expense.
+func (u *User) unsettled(expense Transaction, with string) Money {
+	owed := NewMoneyZero(expense.Amount.Currency)
+	for _, share := range expense.Shares {
+		if share.With == with {
+			owed = owed.Add(share.Amount)
+		}
+	}
+	for _, tx := range u.Expenses {
+		if tx.RefundOf == expense.ID && tx.Settles == with {
+			owed = Money{Amount: owed.Amount.Sub(tx.Amount.Amount), Currency: owed.Currency}
+		}
+	}
+	return owed
+}
+
+// SettleShare records with paying back amount of their share of the
+// expense. The money is credited back to the categories that covered the
+// expense, like a refund, but the settlement does not change the user's
+// spending, which only ever counted their own share.
+func (u *User) SettleShare(expenseID, with string, amount Money, date time.Time) (Transaction, error) {
+	if err := u.checkNotArchived(date); err != nil {
+		return Transaction{}, err
+	}
+	expense, err := u.Expense(expenseID)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if !slices.ContainsFunc(expense.Shares, func(share ExpenseShare) bool { return share.With == with }) {
+		return Transaction{}, fmt.Errorf("expense %s is not shared with %s", expenseID, with)
+	}
+	if !amount.Amount.IsPositive() {
+		return Transaction{}, errors.New("settled amount must be positive")
+	}
+	if amount.Currency != expense.Amount.Currency {
+		return Transaction{}, &CurrencyMismatchError{Expected: expense.Amount.Currency, Got: amount.Currency}
+	}
+	if owed := u.unsettled(*expense, with); amount.Amount.GreaterThan(owed.Amount) {
+		return Transaction{}, fmt.Errorf("settlement of %s exceeds the %s %s owes", amount.StringFixed(), owed.StringFixed(), with)
+	}
+
+	settlement := NewTransaction(amount, date, "Settlement from "+with)
+	settlement.RefundOf = expense.ID
+	settlement.Settles = with
+	if err := u.creditBack(*expense, &settlement); err != nil {
+		return Transaction{}, err
+	}
+
+	u.Expenses = append(u.Expenses, settlement)
+	u.recordTotals(settlement, true)
+	return settlement, nil
+}
+
+// Receivables returns what others still owe the user for shared expenses,
+// by person and currency, sorted by person.
+func (u *User) Receivables() []Receivable {
+	var receivables []Receivable
+	add := func(with string, amount Money) {
+		for i := range receivables {
+			if receivables[i].With == with && receivables[i].Amount.Currency == amount.Currency {
+				receivables[i].Amount = receivables[i].Amount.Add(amount)
+				return
+			}
+		}
+		receivables = append(receivables, Receivable{With: with, Amount: amount})
+	}
+	for _, tx := range u.Expenses {
+		if !tx.Counts() {
+			continue
+		}
+		for _, share := range tx.Shares {
+			add(share.With, share.Amount)
+		}
+		if tx.Settles != "" {
+			add(tx.Settles, Money{Amount: tx.Amount.Amount.Neg(), Currency: tx.Amount.Currency})
+		}
+	}
+	receivables = slices.DeleteFunc(receivables, func(r Receivable) bool { return r.Amount.IsZero() })
+	slices.SortStableFunc(receivables, func(a, b Receivable) int {
+		return cmp.Or(cmp.Compare(a.With, b.With), cmp.Compare(a.Amount.Currency, b.Amount.Currency))
+	})
+	return receivables
+}
+
+// SettleShare records a payment from someone towards their share of the
+// user's expense.
+func (s *FinanceService) SettleShare(ctx context.Context, userID, expenseID, with string, amount Money) (_ Transaction, err error) {
+	ctx, span := s.startSpan(ctx, "SettleShare", userID)
+	defer endSpan(span, &err)
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if err := s.loadExpense(ctx, user, expenseID); err != nil {
+		return Transaction{}, err
+	}
+	if err := s.quotaFor(userID).Check(QuotaTransactions, user.TransactionCount(), 1); err != nil {
+		return Transaction{}, err
+	}
+
+	settlement, err := user.SettleShare(expenseID, with, amount, s.now())
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	if err := s.save(ctx, user, "settle_share"); err != nil {
+		return Transaction{}, err
+	}
+	s.log().InfoContext(ctx, "settled expense share",
+		LogKeyUserID, userID, LogKeyTransactionID, settlement.ID, "expense", expenseID, "amount", amount.String())
+	s.publishLedger(user, settlement)
+	s.Telemetry.Track(ctx, "expenses", "settle_share", userID, nil)
+	return settlement, nil
+}
@@ -0,0 +1,446 @@
+package arus
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SQL dialect differences the repository cares about
+type SQLDialect struct {
+	Name string
+	// Placeholder returns the bind parameter for the n-th (1-based) argument.
+	Placeholder func(n int) string
+}
+
+var (
+	PostgresDialect = SQLDialect{
+		Name:        "postgres",
+		Placeholder: func(n int) string { return fmt.Sprintf("$%d", n) },
+	}
+	SQLiteDialect = SQLDialect{
+		Name:        "sqlite",
+		Placeholder: func(int) string { return "?" },
+	}
+)
+
+// SQLUserRepository stores each user aggregate as a JSON document.
+type SQLUserRepository struct {
+	// Encrypts bank account numbers at rest; nil stores them in plain
+	Keys KeyManager
+
+	db      *sql.DB
+	dialect SQLDialect
+}
+
+// NewSQLUserRepository returns a repository on db, whose schema must be up
+// to date; see Migrate.
+func NewSQLUserRepository(ctx context.Context, db *sql.DB, dialect SQLDialect) (*SQLUserRepository, error) {
+	r := &SQLUserRepository{db: db, dialect: dialect}
+	if err := checkSchema(ctx, db); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *SQLUserRepository) query(query string) string {
+	return r.dialect.rebind(query)
+}
+
+// rebind replaces the ? placeholders of query with the dialect's.
+func (d SQLDialect) rebind(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString(d.Placeholder(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+type sqlTxContextKey struct{}
+
+// sqlTxContext carries a database transaction for the SQL repositories on
+// db to join.
+type sqlTxContext struct {
+	db *sql.DB
+	tx *sql.Tx
+}
+
+// inSQLTx runs fn in the transaction on db that ctx carries or, if there is
+// none, in a new one it commits once fn succeeds. The ctx passed to fn
+// carries the transaction, so repositories sharing db that fn writes
+// through commit together.
+func inSQLTx(ctx context.Context, db *sql.DB, fn func(ctx context.Context, tx *sql.Tx) error) error {
+	if joined, ok := ctx.Value(sqlTxContextKey{}).(sqlTxContext); ok && joined.db == db {
+		return fn(ctx, joined.tx)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(context.WithValue(ctx, sqlTxContextKey{}, sqlTxContext{db: db, tx: tx}), tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *SQLUserRepository) GetByID(ctx context.Context, id string) (*User, error) {
+	user, err := r.load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user.Archived() {
+		return nil, &UserArchivedError{UserID: id, ArchivedAt: user.ArchivedAt}
+	}
+	return user, nil
+}
+
+// load reads a user whether archived or not.
+func (r *SQLUserRepository) load(ctx context.Context, id string) (*User, error) {
+	var data string
+	err := r.db.QueryRowContext(ctx, r.query(`SELECT data FROM users WHERE id = ?`), id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.decode(ctx, data)
+}
+
+func (r *SQLUserRepository) decode(ctx context.Context, data string) (*User, error) {
+	user, err := decodeUser(data)
+	if err != nil {
+		return nil, err
+	}
+	if r.Keys != nil {
+		if err := decryptAccountNumbers(ctx, r.Keys, user); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+func (r *SQLUserRepository) Save(ctx context.Context, user *User) error {
+	if r.Keys != nil {
+		encrypted, err := encryptAccountNumbers(ctx, r.Keys, user)
+		if err != nil {
+			return err
+		}
+		user = encrypted
+	}
+	data, err := json.Marshal(user)
+	if err != nil {
+		return fmt.Errorf("encoding user %s: %w", user.ID, err)
+	}
+	return inSQLTx(ctx, r.db, func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, r.query(`INSERT INTO users (id, data) VALUES (?, ?)
+			ON CONFLICT (id) DO UPDATE SET data = excluded.data`), user.ID, string(data))
+		return err
+	})
+}
+
+func (r *SQLUserRepository) Archive(ctx context.Context, id string, at time.Time) error {
+	user, err := r.load(ctx, id)
+	if err != nil {
+		return err
+	}
+	if user.Archived() {
+		return &UserArchivedError{UserID: id, ArchivedAt: user.ArchivedAt}
+	}
+	user.ArchivedAt = at
+	return r.Save(ctx, user)
+}
+
+func (r *SQLUserRepository) Restore(ctx context.Context, id string) (*User, error) {
+	user, err := r.load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !user.Archived() {
+		return nil, fmt.Errorf("restoring user %s: %w", id, ErrUserNotArchived)
+	}
+	user.ArchivedAt = time.Time{}
+	if err := r.Save(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *SQLUserRepository) Delete(ctx context.Context, id string) error {
+	return inSQLTx(ctx, r.db, func(ctx context.Context, tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, r.query(`DELETE FROM users WHERE id = ?`), id)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err == nil && n == 0 {
+			return ErrUserNotFound
+		}
+		return nil
+	})
+}
+
+func (r *SQLUserRepository) ForEach(ctx context.Context, fn func(user *User) error) error {
+	rows, err := r.db.QueryContext(ctx, `SELECT data FROM users ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return err
+		}
+		user, err := r.decode(ctx, data)
+		if err != nil {
+			return err
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func decodeUser(data string) (*User, error) {
+	var user User
+	if err := json.Unmarshal([]byte(data), &user); err != nil {
+		return nil, fmt.Errorf("decoding user: %w", err)
+	}
+	user.addNewCategories()
+	user.resolveReviewItems()
+	return &user, nil
+}
+
+// Layout of stored transaction dates: fixed width in UTC, so they sort as
+// text in every dialect
+const sqlDateLayout = "2006-01-02T15:04:05.000000000Z"
+
+// SQLTransactionRepository stores each transaction as a JSON document in a
+// table indexed by user, kind and date.
+type SQLTransactionRepository struct {
+	db      *sql.DB
+	dialect SQLDialect
+}
+
+func NewSQLTransactionRepository(ctx context.Context, db *sql.DB, dialect SQLDialect) (*SQLTransactionRepository, error) {
+	r := &SQLTransactionRepository{db: db, dialect: dialect}
+	if err := checkSchema(ctx, db); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SaveTransactions numbers transactions saved for the first time after the
+// user's others, and keeps the number of those saved again, so queries
+// order transactions of the same date as they were recorded.
+func (r *SQLTransactionRepository) SaveTransactions(ctx context.Context, userID string, kind TransactionKind, transactions ...Transaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+	return inSQLTx(ctx, r.db, func(ctx context.Context, tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, r.dialect.rebind(`INSERT INTO transactions (user_id, id, kind, date, amount, bank, data, seq)
+			VALUES (?, ?, ?, ?, ?, ?, ?, (SELECT COALESCE(MAX(seq), 0) + 1 FROM transactions WHERE user_id = ?))
+			ON CONFLICT (user_id, id) DO UPDATE SET kind = excluded.kind, date = excluded.date,
+				amount = excluded.amount, bank = excluded.bank, data = excluded.data`))
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, t := range transactions {
+			data, err := json.Marshal(t)
+			if err != nil {
+				return fmt.Errorf("encoding transaction %s: %w", t.ID, err)
+			}
+			var bank any
+			if t.Bank != "" {
+				bank = t.Bank
+			}
+			_, err = stmt.ExecContext(ctx, userID, t.ID, string(kind), t.Date.UTC().Format(sqlDateLayout),
+				t.Amount.Amount.Abs().String(), bank, string(data), userID)
+			if err != nil {
+				return err
+			}
+			if err := r.saveIndex(ctx, tx, userID, t); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// saveIndex replaces the tags and categories queries filter the
+// transaction on.
+func (r *SQLTransactionRepository) saveIndex(ctx context.Context, tx *sql.Tx, userID string, t Transaction) error {
+	for _, table := range []string{"transaction_tags", "transaction_categories"} {
+		_, err := tx.ExecContext(ctx, r.dialect.rebind(`DELETE FROM `+table+` WHERE user_id = ? AND transaction_id = ?`), userID, t.ID)
+		if err != nil {
+			return err
+		}
+	}
+	var tags []string
+	for _, tag := range t.Tags {
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	for _, tag := range tags {
+		_, err := tx.ExecContext(ctx, r.dialect.rebind(`INSERT INTO transaction_tags (user_id, transaction_id, tag) VALUES (?, ?, ?)`),
+			userID, t.ID, tag)
+		if err != nil {
+			return err
+		}
+	}
+	for _, category := range t.categories() {
+		_, err := tx.ExecContext(ctx, r.dialect.rebind(`INSERT INTO transaction_categories (user_id, transaction_id, category) VALUES (?, ?, ?)`),
+			userID, t.ID, category.Code())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *SQLTransactionRepository) DeleteTransactions(ctx context.Context, userID string, ids ...string) error {
+	return inSQLTx(ctx, r.db, func(ctx context.Context, tx *sql.Tx) error {
+		tables := map[string]string{
+			"transactions":           "id",
+			"transaction_tags":       "transaction_id",
+			"transaction_categories": "transaction_id",
+		}
+		for table, id := range tables {
+			if len(ids) == 0 {
+				if _, err := tx.ExecContext(ctx, r.dialect.rebind(`DELETE FROM `+table+` WHERE user_id = ?`), userID); err != nil {
+					return err
+				}
+				continue
+			}
+			stmt, err := tx.PrepareContext(ctx, r.dialect.rebind(`DELETE FROM `+table+` WHERE user_id = ? AND `+id+` = ?`))
+			if err != nil {
+				return err
+			}
+			for _, transactionID := range ids {
+				if _, err := stmt.ExecContext(ctx, userID, transactionID); err != nil {
+					stmt.Close()
+					return err
+				}
+			}
+			stmt.Close()
+		}
+		return nil
+	})
+}
+
+func (r *SQLTransactionRepository) QueryTransactions(ctx context.Context, userID string, kind TransactionKind, query TransactionQuery) (TransactionPage, error) {
+	if query.Limit < 0 {
+		return TransactionPage{}, errors.New("page limit must not be negative")
+	}
+	offset, err := decodeCursor(query.Cursor)
+	if err != nil {
+		return TransactionPage{}, err
+	}
+	if query.Limit == 0 && offset > 0 {
+		return TransactionPage{}, errors.New("cursor given without a page limit")
+	}
+
+	where := `user_id = ? AND kind = ?`
+	args := []any{userID, string(kind)}
+	if query.Period != nil {
+		where += ` AND date >= ? AND date <= ?`
+		args = append(args,
+			query.Period.StartDate.UTC().Format(sqlDateLayout),
+			query.Period.EndDate.UTC().Format(sqlDateLayout))
+	}
+	if query.Category != nil {
+		where += ` AND EXISTS (SELECT 1 FROM transaction_categories c
+			WHERE c.user_id = transactions.user_id AND c.transaction_id = transactions.id AND c.category = ?)`
+		args = append(args, query.Category.Code())
+	}
+	if query.Tag != "" {
+		where += ` AND EXISTS (SELECT 1 FROM transaction_tags t
+			WHERE t.user_id = transactions.user_id AND t.transaction_id = transactions.id AND t.tag = ?)`
+		args = append(args, query.Tag)
+	}
+	if query.Bank != "" {
+		where += ` AND bank = ?`
+		args = append(args, query.Bank)
+	}
+	if query.MinAmount != nil {
+		where += ` AND amount >= ?`
+		args = append(args, query.MinAmount.String())
+	}
+	if query.MaxAmount != nil {
+		where += ` AND amount <= ?`
+		args = append(args, query.MaxAmount.String())
+	}
+	if len(query.IDs) > 0 {
+		where += ` AND id IN (?` + strings.Repeat(`, ?`, len(query.IDs)-1) + `)`
+		for _, id := range query.IDs {
+			args = append(args, id)
+		}
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, r.dialect.rebind(`SELECT COUNT(*) FROM transactions WHERE `+where), args...).Scan(&total); err != nil {
+		return TransactionPage{}, err
+	}
+	if offset > total {
+		return TransactionPage{}, errors.New("cursor is past the end")
+	}
+
+	// Transactions saved before they were numbered come first in their date
+	order := []string{`date`, `COALESCE(seq, 0)`, `id`}
+	if query.Sort == SortByAmount {
+		order = slices.Insert(order, 0, `amount`)
+	}
+	if query.Descending {
+		for i := range order {
+			order[i] += ` DESC`
+		}
+	}
+	statement := `SELECT data FROM transactions WHERE ` + where + ` ORDER BY ` + strings.Join(order, `, `)
+	if query.Limit > 0 {
+		statement += ` LIMIT ? OFFSET ?`
+		args = append(args, query.Limit, offset)
+	}
+	rows, err := r.db.QueryContext(ctx, r.dialect.rebind(statement), args...)
+	if err != nil {
+		return TransactionPage{}, err
+	}
+	defer rows.Close()
+
+	page := TransactionPage{TotalCount: total}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return TransactionPage{}, err
+		}
+		var t Transaction
+		if err := json.Unmarshal([]byte(data), &t); err != nil {
+			return TransactionPage{}, fmt.Errorf("decoding transaction: %w", err)
+		}
+		page.Transactions = append(page.Transactions, t)
+	}
+	if err := rows.Err(); err != nil {
+		return TransactionPage{}, err
+	}
+
+	if end := offset + len(page.Transactions); query.Limit > 0 && end < total {
+		page.NextCursor = encodeCursor(end)
+	}
+	return page, nil
+}
@@ -0,0 +1,255 @@
+package arus
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// openTestStore opens a data store on a new sqlite database, closed when
+// the test ends.
+func openTestStore(t *testing.T, opts SQLBackendOptions) DataStore {
+	t.Helper()
+	opts.AutoMigrate = true
+	store, db, err := OpenSQLBackend(context.Background(), "sqlite", filepath.Join(t.TempDir(), "arus.db"), opts)
+	if err != nil {
+		t.Fatalf("opening sqlite store: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return store
+}
+
+func TestSQLUserRepository(t *testing.T) {
+	ctx := context.Background()
+	date := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		// Changes made to the stored user "u1" before reading it back
+		change  func(repo *SQLUserRepository) error
+		wantErr error
+	}{
+		{name: "saved user reads back", change: func(*SQLUserRepository) error { return nil }},
+		{name: "archived user is not read", change: func(repo *SQLUserRepository) error {
+			return repo.Archive(ctx, "u1", date)
+		}, wantErr: ErrUserArchived},
+		{name: "restored user reads back", change: func(repo *SQLUserRepository) error {
+			if err := repo.Archive(ctx, "u1", date); err != nil {
+				return err
+			}
+			_, err := repo.Restore(ctx, "u1")
+			return err
+		}},
+		{name: "deleted user is not found", change: func(repo *SQLUserRepository) error {
+			return repo.Delete(ctx, "u1")
+		}, wantErr: ErrUserNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := openTestStore(t, SQLBackendOptions{})
+			repo := store.Users.Users.(*SQLUserRepository)
+			user := newFundedUser(t, "u1", "1000", date)
+			if err := repo.Save(ctx, user); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.change(repo); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := repo.GetByID(ctx, "u1")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("GetByID = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if balance := got.Categories[Savings].Balance; !balance.Amount.Equal(decimal.NewFromInt(500)) {
+				t.Errorf("savings balance %s, want 500", balance)
+			}
+			if len(got.Incomes) != 1 || got.Incomes[0].ID != user.Incomes[0].ID {
+				t.Errorf("read back incomes %v, want %v", got.Incomes, user.Incomes)
+			}
+		})
+	}
+
+	t.Run("missing user", func(t *testing.T) {
+		store := openTestStore(t, SQLBackendOptions{})
+		if _, err := store.Users.Users.GetByID(ctx, "nobody"); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("GetByID = %v, want ErrUserNotFound", err)
+		}
+	})
+}
+
+func TestTransactionRepositoryQuery(t *testing.T) {
+	ctx := context.Background()
+	day := func(d int) time.Time { return time.Date(2024, time.March, d, 12, 0, 0, 0, time.UTC) }
+	expense := func(id string, amount int64, date time.Time, bank string, category CategoryType, tags ...string) Transaction {
+		return Transaction{
+			ID:         id,
+			Amount:     NewMoney(decimal.NewFromInt(amount), "USD"),
+			Date:       date,
+			Bank:       bank,
+			Tags:       tags,
+			Deductions: []Deduction{{Category: category, Amount: NewMoney(decimal.NewFromInt(amount), "USD")}},
+		}
+	}
+	stored := []Transaction{
+		expense("a", 10, day(1), "Acme", Expense, "food"),
+		expense("b", 50, day(5), "Acme", Expense, "travel"),
+		expense("c", 30, day(10), "Beta", Savings, "food", "gift"),
+		expense("d", 20, day(20), "Beta", Emergency),
+		expense("e", 40, day(25), "Acme", Expense, "food"),
+	}
+	march10 := Period{StartDate: day(10), EndDate: day(31)}
+	savings := Savings
+	low, high := decimal.NewFromInt(20), decimal.NewFromInt(40)
+
+	tests := []struct {
+		name  string
+		query TransactionQuery
+		want  []string
+	}{
+		{"all, oldest first", TransactionQuery{}, []string{"a", "b", "c", "d", "e"}},
+		{"newest first", TransactionQuery{Descending: true}, []string{"e", "d", "c", "b", "a"}},
+		{"by amount", TransactionQuery{Sort: SortByAmount}, []string{"a", "d", "c", "e", "b"}},
+		{"period", TransactionQuery{Period: &march10}, []string{"c", "d", "e"}},
+		{"category", TransactionQuery{Category: &savings}, []string{"c"}},
+		{"tag", TransactionQuery{Tag: "food"}, []string{"a", "c", "e"}},
+		{"bank", TransactionQuery{Bank: "Beta"}, []string{"c", "d"}},
+		{"IDs", TransactionQuery{IDs: []string{"e", "a", "z"}}, []string{"a", "e"}},
+		{"amount bounds", TransactionQuery{MinAmount: &low, MaxAmount: &high}, []string{"c", "d", "e"}},
+		{"filters combine", TransactionQuery{Period: &march10, Tag: "food", Bank: "Acme"}, []string{"e"}},
+		{"first page", TransactionQuery{Limit: 2}, []string{"a", "b"}},
+	}
+	repos := []struct {
+		name string
+		open func(t *testing.T) TransactionRepository
+	}{
+		{"in memory", func(*testing.T) TransactionRepository { return NewInMemoryTransactionRepository() }},
+		{"sqlite", func(t *testing.T) TransactionRepository {
+			return openTestStore(t, SQLBackendOptions{}).Users.Transactions
+		}},
+	}
+	for _, repo := range repos {
+		t.Run(repo.name, func(t *testing.T) {
+			transactions := repo.open(t)
+			if err := transactions.SaveTransactions(ctx, "u1", TransactionExpense, stored...); err != nil {
+				t.Fatal(err)
+			}
+			// Another user's and another kind's transactions stay out
+			if err := transactions.SaveTransactions(ctx, "u2", TransactionExpense, expense("x", 10, day(2), "Acme", Expense, "food")); err != nil {
+				t.Fatal(err)
+			}
+			if err := transactions.SaveTransactions(ctx, "u1", TransactionIncome, expense("y", 10, day(2), "Acme", Expense, "food")); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					page, err := transactions.QueryTransactions(ctx, "u1", TransactionExpense, tt.query)
+					if err != nil {
+						t.Fatal(err)
+					}
+					var got []string
+					for _, tx := range page.Transactions {
+						got = append(got, tx.ID)
+					}
+					if !slices.Equal(got, tt.want) {
+						t.Errorf("got %v, want %v", got, tt.want)
+					}
+					if tt.query.Limit == 0 && page.TotalCount != len(tt.want) {
+						t.Errorf("TotalCount = %d, want %d", page.TotalCount, len(tt.want))
+					}
+				})
+			}
+
+			t.Run("next page", func(t *testing.T) {
+				first, err := transactions.QueryTransactions(ctx, "u1", TransactionExpense, TransactionQuery{Limit: 2})
+				if err != nil {
+					t.Fatal(err)
+				}
+				second, err := transactions.QueryTransactions(ctx, "u1", TransactionExpense, TransactionQuery{Limit: 2, Cursor: first.NextCursor})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(second.Transactions) != 2 || second.Transactions[0].ID != "c" || first.TotalCount != len(stored) {
+					t.Errorf("second page %v of %d, want c and d of %d", second.Transactions, first.TotalCount, len(stored))
+				}
+			})
+
+			t.Run("delete", func(t *testing.T) {
+				if err := transactions.DeleteTransactions(ctx, "u1", "a", "c"); err != nil {
+					t.Fatal(err)
+				}
+				page, err := transactions.QueryTransactions(ctx, "u1", TransactionExpense, TransactionQuery{Tag: "food"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(page.Transactions) != 1 || page.Transactions[0].ID != "e" {
+					t.Errorf("after deleting a and c, food expenses are %v, want e", page.Transactions)
+				}
+			})
+		})
+	}
+}
+
+func TestAggregateUserRepositoryLoadsRecentTransactions(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2022, time.January, 5, 0, 0, 0, 0, time.UTC)
+	now := start.AddDate(2, 0, 0)
+	tests := []struct {
+		name         string
+		window       time.Duration
+		wantLoaded   int
+		wantUnloaded int
+	}{
+		{name: "default window", wantLoaded: 12, wantUnloaded: 12},
+		{name: "short window", window: 60 * 24 * time.Hour, wantLoaded: 2, wantUnloaded: 22},
+		{name: "window longer than the history", window: 5 * 366 * 24 * time.Hour, wantLoaded: 24},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := openTestStore(t, SQLBackendOptions{})
+			store.Users.Window, store.Users.Clock = tt.window, NewFakeClock(now)
+			user := newFundedUser(t, "u1", "100", start)
+			for month := 1; month < 24; month++ {
+				if err := user.AllocateIncome(money(t, "100", "USD"), start.AddDate(0, month, 0), "salary"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := store.Users.Save(ctx, user); err != nil {
+				t.Fatal(err)
+			}
+
+			loaded, err := store.Users.GetByID(ctx, "u1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(loaded.Incomes) != tt.wantLoaded || loaded.unloaded != tt.wantUnloaded {
+				t.Errorf("loaded %d incomes with %d left unloaded, want %d and %d",
+					len(loaded.Incomes), loaded.unloaded, tt.wantLoaded, tt.wantUnloaded)
+			}
+			if count := loaded.TransactionCount(); count != 24 {
+				t.Errorf("TransactionCount = %d, want 24", count)
+			}
+
+			// Saving what was loaded keeps the rest of the history
+			if err := store.Users.Save(ctx, loaded); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Users.loadTransactions(ctx, loaded, TransactionQuery{}); err != nil {
+				t.Fatal(err)
+			}
+			if len(loaded.Incomes) != 24 || loaded.unloaded != 0 {
+				t.Errorf("loaded %d incomes of the full history with %d left, want 24 and none", len(loaded.Incomes), loaded.unloaded)
+			}
+		})
+	}
+}
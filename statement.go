@@ -0,0 +1,146 @@
+package arus
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A single entry on a bank statement. Negative amounts are debits (money
+// leaving the account), positive amounts are credits.
+type StatementLine struct {
+	Date        time.Time
+	Description string
+	Amount      Money
+	Reference   string
+	// Pending for authorizations that have not settled yet
+	Status TransactionStatus
+	// Tags of the transaction the line records; empty leaves them to the
+	// user's classification rules
+	Tags []string `json:",omitempty"`
+	// ID of the transaction the line records; empty generates one.
+	// Importers of files without IDs of their own derive it from the line,
+	// so lines imported twice are recorded once.
+	ID string `json:",omitempty"`
+}
+
+func (l StatementLine) IsDebit() bool {
+	return l.Amount.IsNegative()
+}
+
+func (l StatementLine) Transaction() Transaction {
+	tx := NewTransaction(l.Amount, l.Date, l.Description)
+	tx.Status = l.Status
+	tx.Tags = slices.Clone(l.Tags)
+	if l.ID != "" {
+		tx.ID = l.ID
+	}
+	return tx
+}
+
+// derivedLineID returns an ID for a line of a file without IDs of its own
+// that is the same every time the file is read: a hash of the account, the
+// line's fields and how many identical lines came before it, counted in
+// seen. Lines still pending hash differently, so the posted line settling
+// them is not taken for one already recorded.
+func derivedLineID(prefix, account string, line StatementLine, seen map[string]int) string {
+	fields := []string{account, line.Date.Format(time.DateOnly), line.Amount.String(), line.Description, line.Reference}
+	if line.Status != Posted {
+		fields = append(fields, line.Status.Code())
+	}
+	key := strings.Join(fields, "\x00")
+	sum := sha256.Sum256([]byte(key + "\x00" + strconv.Itoa(seen[key])))
+	seen[key]++
+	return prefix + hex.EncodeToString(sum[:16])
+}
+
+// AccountStatement is a bank account's statement over a period.
+// OpeningBalance and ClosingBalance are optional; when both are present the
+// lines must account for the difference between them.
+type AccountStatement struct {
+	BankAccount    BankAccount
+	Period         Period
+	OpeningBalance Money
+	ClosingBalance Money
+	Lines          []StatementLine
+}
+
+// transaction returns the line as a transaction imported from the
+// statement's bank.
+func (s AccountStatement) transaction(line StatementLine) Transaction {
+	tx := line.Transaction()
+	tx.Bank = s.BankAccount.BankName
+	return tx
+}
+
+// Expenses returns the statement's debit lines as expense transactions.
+func (s AccountStatement) Expenses() []Transaction {
+	var expenses []Transaction
+	for _, line := range s.Lines {
+		if line.IsDebit() {
+			expenses = append(expenses, s.transaction(line))
+		}
+	}
+	return expenses
+}
+
+// Credits returns the statement's credit lines as transactions.
+func (s AccountStatement) Credits() []Transaction {
+	var credits []Transaction
+	for _, line := range s.Lines {
+		if !line.IsDebit() {
+			credits = append(credits, s.transaction(line))
+		}
+	}
+	return credits
+}
+
+func (s AccountStatement) HasBalances() bool {
+	return s.OpeningBalance.Currency != "" && s.ClosingBalance.Currency != ""
+}
+
+// Validate checks that the lines fall within the statement period and, when
+// balances are given, that they add up to the closing balance.
+func (s AccountStatement) Validate() error {
+	hasPeriod := !s.Period.StartDate.IsZero() || !s.Period.EndDate.IsZero()
+	for i, line := range s.Lines {
+		if hasPeriod && !s.Period.Contains(line.Date) {
+			return fmt.Errorf("statement line %d dated %s is outside the statement period",
+				i, line.Date.Format("2006-01-02"))
+		}
+	}
+
+	if !s.HasBalances() {
+		return nil
+	}
+
+	expected := s.OpeningBalance
+	for _, line := range s.Lines {
+		expected = Money{Amount: expected.Amount.Add(line.Amount.Amount), Currency: expected.Currency}
+	}
+	if !expected.Amount.Equal(s.ClosingBalance.Amount) {
+		return fmt.Errorf("statement lines sum to closing balance %s, statement reports %s",
+			expected.StringFixed(), s.ClosingBalance.StringFixed())
+	}
+	return nil
+}
+
+// A page of statement lines. NextCursor is empty on the last page.
+type StatementPage struct {
+	Lines      []StatementLine
+	NextCursor string
+}
+
+// Page returns up to limit lines starting at cursor. An empty cursor starts
+// from the first line.
+func (s AccountStatement) Page(cursor string, limit int) (StatementPage, error) {
+	lines, next, err := paginate(s.Lines, cursor, limit)
+	if err != nil {
+		return StatementPage{}, err
+	}
+	return StatementPage{Lines: lines, NextCursor: next}, nil
+}
@@ -0,0 +1,161 @@
+package arus
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Statements this close to each other, or to the ends of a period, leave
+// no gap: bank statements are dated by day
+const statementSlack = 24 * time.Hour
+
+// StatementRecord is a statement imported for one of the user's accounts.
+type StatementRecord struct {
+	BankAccount BankAccount
+	Period      Period
+}
+
+// StatementGap is a linked account whose statements do not cover a whole
+// period.
+type StatementGap struct {
+	BankAccount BankAccount
+	// Parts of the period covered by statements, oldest first; empty when
+	// no statement was imported for it
+	Covered []Period
+}
+
+func (g StatementGap) Missing() bool {
+	return len(g.Covered) == 0
+}
+
+// coveredPeriod is the period a statement covers: its own, or the span of
+// its lines when it has none.
+func (s AccountStatement) coveredPeriod() (Period, bool) {
+	if !s.Period.StartDate.IsZero() || !s.Period.EndDate.IsZero() {
+		return s.Period, true
+	}
+	if len(s.Lines) == 0 {
+		return Period{}, false
+	}
+	period := Period{StartDate: s.Lines[0].Date, EndDate: s.Lines[0].Date}
+	for _, line := range s.Lines[1:] {
+		if line.Date.Before(period.StartDate) {
+			period.StartDate = line.Date
+		}
+		if line.Date.After(period.EndDate) {
+			period.EndDate = line.Date
+		}
+	}
+	return period, true
+}
+
+// recordStatement remembers the period a processed statement covers.
+func (u *User) recordStatement(statement AccountStatement) {
+	if period, ok := statement.coveredPeriod(); ok {
+		u.StatementHistory = append(u.StatementHistory, StatementRecord{BankAccount: statement.BankAccount, Period: period})
+	}
+}
+
+// linkedAccounts returns every account backing a category, then every
+// credit card.
+func (u *User) linkedAccounts() []BankAccount {
+	var accounts []BankAccount
+	for _, categoryType := range slices.Sorted(maps.Keys(u.Categories)) {
+		for _, account := range u.Categories[categoryType].Accounts {
+			accounts = append(accounts, account.BankAccount)
+		}
+	}
+	for _, card := range u.CreditCards {
+		accounts = append(accounts, card.Account)
+	}
+	return accounts
+}
+
+// StatementGaps returns the linked accounts whose imported statements miss
+// all or part of period.
+func (u *User) StatementGaps(period Period) []StatementGap {
+	var gaps []StatementGap
+	for _, account := range u.linkedAccounts() {
+		var covered []Period
+		for _, record := range u.StatementHistory {
+			if !record.BankAccount.Equal(account) || !record.Period.Overlaps(period) {
+				continue
+			}
+			clipped := record.Period
+			if clipped.StartDate.Before(period.StartDate) {
+				clipped.StartDate = period.StartDate
+			}
+			if clipped.EndDate.After(period.EndDate) {
+				clipped.EndDate = period.EndDate
+			}
+			covered = append(covered, clipped)
+		}
+		covered = mergePeriods(covered)
+
+		complete := len(covered) == 1 &&
+			covered[0].StartDate.Sub(period.StartDate) <= statementSlack &&
+			period.EndDate.Sub(covered[0].EndDate) <= statementSlack
+		if !complete {
+			gaps = append(gaps, StatementGap{BankAccount: account, Covered: covered})
+		}
+	}
+	return gaps
+}
+
+// mergePeriods joins overlapping periods, and ones less than a day apart.
+func mergePeriods(periods []Period) []Period {
+	slices.SortFunc(periods, func(a, b Period) int { return a.StartDate.Compare(b.StartDate) })
+	var merged []Period
+	for _, period := range periods {
+		if n := len(merged); n > 0 && period.StartDate.Sub(merged[n-1].EndDate) <= statementSlack {
+			if period.EndDate.After(merged[n-1].EndDate) {
+				merged[n-1].EndDate = period.EndDate
+			}
+			continue
+		}
+		merged = append(merged, period)
+	}
+	return merged
+}
+
+// missingStatementsReport is the gentle end-of-period notice of accounts
+// whose statements for the last monthly period are missing or partial.
+func missingStatementsReport(user *User, period Period) Notification {
+	gaps := user.StatementGaps(period)
+	month := period.StartDate.Format("January 2006")
+	if len(gaps) == 0 {
+		return Notification{
+			Subject: "Your statements are complete",
+			Body:    fmt.Sprintf("Every linked account has a statement for %s.\n", month),
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Some statements for %s are not in yet, so this month's numbers may be incomplete:\n", month)
+	for _, gap := range gaps {
+		if gap.Missing() {
+			fmt.Fprintf(&b, " - %s at %s: no statement\n", gap.BankAccount.Masked(), gap.BankAccount.BankName)
+			continue
+		}
+		var spans []string
+		for _, covered := range gap.Covered {
+			spans = append(spans, covered.StartDate.Format("Jan 2")+"-"+covered.EndDate.Format("Jan 2"))
+		}
+		fmt.Fprintf(&b, " - %s at %s: only %s\n", gap.BankAccount.Masked(), gap.BankAccount.BankName, strings.Join(spans, ", "))
+	}
+	return Notification{Subject: "Some statements are missing", Body: b.String()}
+}
+
+func (s *FinanceService) StatementGaps(ctx context.Context, userID string, period Period) ([]StatementGap, error) {
+	defer s.readLockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return user.StatementGaps(period), nil
+}
@@ -0,0 +1,370 @@
+package arus
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Largest email ParseStatementEmail reads
+const MaxStatementEmailSize = 25 << 20
+
+// Priority of statements waiting in the inbox to be imported
+const StatementPriority = 70
+
+const InboxStatement InboxItemKind = "statement"
+
+// Content types of attachments that hold CSV statements. Files of other
+// types named *.csv count too, as mail clients often send them as
+// application/octet-stream.
+var StatementContentTypes = []string{"text/csv", "text/comma-separated-values", "application/csv", "application/vnd.ms-excel"}
+
+// "From:" lines of the headers mail clients quote above a forwarded message
+var forwardedFrom = regexp.MustCompile(`(?mi)^[>\s]*From:\s*(.+)$`)
+
+// StatementEmail is an email carrying bank statements, usually one the
+// user forwarded from their bank.
+type StatementEmail struct {
+	From    string
+	To      []string
+	Subject string
+	// Senders of the messages the email forwards, found in attached
+	// messages and quoted headers
+	ForwardedFrom []string
+	Attachments   []EmailAttachment
+}
+
+type EmailAttachment struct {
+	Name        string
+	ContentType string
+	Content     []byte
+}
+
+// QueuedStatement is a statement received by email waiting to be imported
+// into the account it was matched to. Its content lives in the service's
+// BlobStore under Key.
+type QueuedStatement struct {
+	ID          string
+	BankAccount BankAccount
+	Name        string
+	Size        int64
+	// Hex-encoded SHA-256 of the content
+	SHA256     string
+	Key        string
+	From       string
+	Subject    string `json:",omitempty"`
+	ReceivedAt time.Time
+}
+
+// ParseStatementEmail reads an RFC 5322 message, such as the raw MIME an
+// inbound mail provider posts, collecting its attachments and the senders
+// of the messages it forwards.
+func ParseStatementEmail(r io.Reader) (StatementEmail, error) {
+	message, err := mail.ReadMessage(bufio.NewReader(io.LimitReader(r, MaxStatementEmailSize)))
+	if err != nil {
+		return StatementEmail{}, fmt.Errorf("reading email: %w", err)
+	}
+	var email StatementEmail
+	if from, err := mail.ParseAddress(message.Header.Get("From")); err == nil {
+		email.From = strings.ToLower(from.Address)
+	}
+	for _, header := range []string{"To", "Cc", "Delivered-To", "X-Original-To"} {
+		addresses, _ := message.Header.AddressList(header)
+		for _, address := range addresses {
+			if to := strings.ToLower(address.Address); !slices.Contains(email.To, to) {
+				email.To = append(email.To, to)
+			}
+		}
+	}
+	email.Subject, _ = new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+
+	if err := email.readPart(mail.Header(message.Header), message.Body); err != nil {
+		return StatementEmail{}, err
+	}
+	return email, nil
+}
+
+// readPart walks one MIME part, descending into multiparts and forwarded
+// messages.
+func (e *StatementEmail) readPart(header mail.Header, body io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+	if strings.EqualFold(header.Get("Content-Transfer-Encoding"), "base64") {
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	if strings.EqualFold(header.Get("Content-Transfer-Encoding"), "quoted-printable") {
+		body = quotedprintable.NewReader(body)
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		parts := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := parts.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("reading email: %w", err)
+			}
+			if err := e.readPart(mail.Header(part.Header), part); err != nil {
+				return err
+			}
+		}
+	case mediaType == "message/rfc822":
+		forwarded, err := mail.ReadMessage(bufio.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("reading forwarded email: %w", err)
+		}
+		if from, err := mail.ParseAddress(forwarded.Header.Get("From")); err == nil {
+			e.ForwardedFrom = append(e.ForwardedFrom, strings.ToLower(from.Address))
+		}
+		return e.readPart(mail.Header(forwarded.Header), forwarded.Body)
+	}
+
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("reading email: %w", err)
+	}
+	name := params["name"]
+	if _, dispositionParams, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil && dispositionParams["filename"] != "" {
+		name = dispositionParams["filename"]
+	}
+	if name != "" {
+		e.Attachments = append(e.Attachments, EmailAttachment{Name: attachmentName(name), ContentType: mediaType, Content: content})
+		return nil
+	}
+	if mediaType == "text/plain" {
+		for _, match := range forwardedFrom.FindAllSubmatch(content, -1) {
+			if from, err := mail.ParseAddress(string(bytes.TrimSpace(match[1]))); err == nil {
+				e.ForwardedFrom = append(e.ForwardedFrom, strings.ToLower(from.Address))
+			}
+		}
+	}
+	return nil
+}
+
+// Statements returns the attachments that hold CSV statements.
+func (e StatementEmail) Statements() []EmailAttachment {
+	var statements []EmailAttachment
+	for _, attachment := range e.Attachments {
+		if slices.Contains(StatementContentTypes, attachment.ContentType) ||
+			strings.EqualFold(path.Ext(attachment.Name), ".csv") {
+			statements = append(statements, attachment)
+		}
+	}
+	return statements
+}
+
+// UserID returns the tag of the first recipient addressed with one, such
+// as u123 in statements+u123@example.com, which is how users' statement
+// addresses name them.
+func (e StatementEmail) UserID() (string, bool) {
+	for _, to := range e.To {
+		local, _, _ := strings.Cut(to, "@")
+		if _, tag, ok := strings.Cut(local, "+"); ok && tag != "" {
+			return tag, true
+		}
+	}
+	return "", false
+}
+
+// senders returns who may have sent the statements: the senders of
+// forwarded messages first, then the email's own.
+func (e StatementEmail) senders() []string {
+	senders := slices.Clone(e.ForwardedFrom)
+	if e.From != "" {
+		senders = append(senders, e.From)
+	}
+	return senders
+}
+
+// sentBy reports whether address matches sender, either an address or a
+// domain, which matches its subdomains too.
+func sentBy(address, sender string) bool {
+	sender = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(sender), "@"))
+	if strings.Contains(sender, "@") {
+		return address == sender
+	}
+	_, domain, _ := strings.Cut(address, "@")
+	return domain == sender || strings.HasSuffix(domain, "."+sender)
+}
+
+// StatementAccountFor returns the linked account at the bank of the first
+// import profile one of the email's senders matches.
+func (u *User) StatementAccountFor(email StatementEmail) (BankAccount, error) {
+	for _, address := range email.senders() {
+		for _, profile := range u.ImportProfiles {
+			if profile.Bank == "" || !slices.ContainsFunc(profile.Senders, func(sender string) bool { return sentBy(address, sender) }) {
+				continue
+			}
+			for _, account := range u.linkedAccounts() {
+				if strings.EqualFold(account.BankName, profile.Bank) {
+					return account, nil
+				}
+			}
+		}
+	}
+	return BankAccount{}, fmt.Errorf("%w: %s", ErrUnknownSender, strings.Join(email.senders(), ", "))
+}
+
+// QueuedStatement returns the statement of that ID waiting to be imported.
+func (u *User) QueuedStatement(id string) (QueuedStatement, error) {
+	i := slices.IndexFunc(u.QueuedStatements, func(q QueuedStatement) bool { return q.ID == id })
+	if i < 0 {
+		return QueuedStatement{}, fmt.Errorf("%w: %s", ErrStatementNotQueued, id)
+	}
+	return u.QueuedStatements[i], nil
+}
+
+func statementInboxItems(user *User, now time.Time) []InboxItem {
+	items := make([]InboxItem, 0, len(user.QueuedStatements))
+	for _, queued := range user.QueuedStatements {
+		items = append(items, InboxItem{
+			Kind:      InboxStatement,
+			Reference: queued.ID,
+			Title:     fmt.Sprintf("Import %s for account %s at %s", queued.Name, queued.BankAccount.Masked(), queued.BankAccount.BankName),
+			Priority:  StatementPriority,
+		})
+	}
+	return items
+}
+
+// QueueStatementEmail matches the email's sender to one of the user's
+// linked banks, see User.StatementAccountFor, and queues each CSV statement
+// attached for import into the bank's account. Queued statements show up
+// in the user's inbox until imported or discarded.
+func (s *FinanceService) QueueStatementEmail(ctx context.Context, userID string, email StatementEmail) (_ []QueuedStatement, err error) {
+	ctx, span := s.startSpan(ctx, "QueueStatementEmail", userID)
+	defer endSpan(span, &err)
+
+	blobs, err := s.blobs()
+	if err != nil {
+		return nil, err
+	}
+	statements := email.Statements()
+	if len(statements) == 0 {
+		return nil, fmt.Errorf("%w: email has no CSV statement attached", ErrInvalidAttachment)
+	}
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	account, err := user.StatementAccountFor(email)
+	if err != nil {
+		return nil, err
+	}
+
+	queued := make([]QueuedStatement, 0, len(statements))
+	for _, statement := range statements {
+		sum := sha256.Sum256(statement.Content)
+		q := QueuedStatement{
+			ID:          NewID(),
+			BankAccount: account,
+			Name:        statement.Name,
+			Size:        int64(len(statement.Content)),
+			SHA256:      hex.EncodeToString(sum[:]),
+			From:        email.From,
+			Subject:     email.Subject,
+			ReceivedAt:  s.now(),
+		}
+		q.Key = path.Join(userID, "statements", q.ID)
+		if err := blobs.Put(ctx, q.Key, bytes.NewReader(statement.Content), "text/csv"); err != nil {
+			return nil, err
+		}
+		queued = append(queued, q)
+	}
+	user.QueuedStatements = append(user.QueuedStatements, queued...)
+
+	if err := s.save(ctx, user, "queue_statement_email"); err != nil {
+		// Don't leave blobs nothing refers to
+		for _, q := range queued {
+			blobs.Delete(context.WithoutCancel(ctx), q.Key)
+		}
+		return nil, err
+	}
+	s.log().InfoContext(ctx, "queued emailed statements",
+		LogKeyUserID, userID, "bank", account.BankName, "statements", len(queued))
+	s.Telemetry.Track(ctx, "import", "queue_email", userID, map[string]string{"bank": account.BankName})
+	return queued, nil
+}
+
+// ImportQueuedStatement imports a statement received by email into the
+// account it was matched to, reading it with the bank's import profile,
+// and takes it off the queue. A failed import leaves it queued.
+func (s *FinanceService) ImportQueuedStatement(ctx context.Context, userID, id string) (ImportProgress, error) {
+	blobs, err := s.blobs()
+	if err != nil {
+		return ImportProgress{}, err
+	}
+	user, err := s.readUser(ctx, userID)
+	if err != nil {
+		return ImportProgress{}, err
+	}
+	queued, err := user.QueuedStatement(id)
+	if err != nil {
+		return ImportProgress{}, err
+	}
+
+	content, err := blobs.Get(ctx, queued.Key)
+	if err != nil {
+		return ImportProgress{}, err
+	}
+	defer content.Close()
+	statement := NewCSVStatementReader(content, LocaleEnUS)
+	if profile, ok := user.ImportProfileFor(queued.BankAccount.BankName); ok {
+		if statement, err = NewCSVStatementReaderFor(content, profile); err != nil {
+			return ImportProgress{}, err
+		}
+	}
+	progress, err := NewStatementImport(s).Run(ctx, userID, queued.BankAccount, statement)
+	if err != nil {
+		return progress, err
+	}
+	return progress, s.DiscardQueuedStatement(ctx, userID, id)
+}
+
+// DiscardQueuedStatement takes a statement received by email off the queue
+// without importing it, and deletes its content.
+func (s *FinanceService) DiscardQueuedStatement(ctx context.Context, userID, id string) error {
+	blobs, err := s.blobs()
+	if err != nil {
+		return err
+	}
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	queued, err := user.QueuedStatement(id)
+	if err != nil {
+		return err
+	}
+	user.QueuedStatements = slices.DeleteFunc(user.QueuedStatements, func(q QueuedStatement) bool { return q.ID == id })
+
+	if err := s.save(ctx, user, "discard_queued_statement"); err != nil {
+		return err
+	}
+	return blobs.Delete(ctx, queued.Key)
+}
@@ -0,0 +1,140 @@
+// Package stream pushes ledger changes to dashboards as Server-Sent Events,
+// so they update without polling.
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dnswd/arus"
+	"github.com/dnswd/arus/openapi"
+)
+
+// How many events a slow client may fall behind before it misses some
+const clientBuffer = 64
+
+// Handler streams the ledger events of the requesting user. UserID
+// identifies that user, typically from the authenticated session; the
+// handler does no authentication of its own.
+type Handler struct {
+	Service *arus.FinanceService
+	UserID  func(r *http.Request) (string, error)
+	// Interval of keep-alive comments that stop proxies from closing idle
+	// streams; zero uses 30 seconds
+	Heartbeat time.Duration
+}
+
+func NewHandler(service *arus.FinanceService, userID func(r *http.Request) (string, error)) *Handler {
+	return &Handler{Service: service, UserID: userID}
+}
+
+// Describe adds the event stream to doc at prefix. OpenAPI has no way to
+// describe the events themselves; each is named after an arus event type
+// and carries its data as JSON.
+func (h *Handler) Describe(doc *openapi.Document, prefix string) {
+	if prefix == "" {
+		prefix = "/"
+	}
+	doc.Add(http.MethodGet, prefix, openapi.Operation{
+		OperationID: "streamEvents",
+		Summary:     "Stream the user's ledger events, starting with their balances",
+		Tags:        []string{"events"},
+		Responses: map[string]openapi.Response{
+			"200": {Description: "Server-Sent Events", Content: map[string]openapi.MediaType{
+				"text/event-stream": {Schema: &openapi.Schema{Type: "string"}},
+			}},
+			"401": {Description: "No user could be identified"},
+			"404": {Description: "The event stream is not enabled, or the user does not exist"},
+		},
+	})
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.Service.Events == nil {
+		http.Error(w, "event stream is not enabled", http.StatusNotFound)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// An empty ID would subscribe to every user's events
+	userID, err := h.UserID(r)
+	if err != nil || userID == "" {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	// Subscribe before reading the user so no change falls in between
+	events, cancel := h.Service.Events.Subscribe(userID, clientBuffer)
+	defer cancel()
+
+	balances, err := h.Service.Balances(r.Context(), userID)
+	if errors.Is(err, arus.ErrUserNotFound) {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "reading balances failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	// Start every stream with the current balances
+	initial := arus.Event{Type: arus.EventBalancesUpdated, UserID: userID, At: time.Now(), Data: balances}
+	if err := writeEvent(w, initial); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	heartbeat := h.Heartbeat
+	if heartbeat <= 0 {
+		heartbeat = 30 * time.Second
+	}
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent sends the event as its owner may see it.
+func writeEvent(w http.ResponseWriter, event arus.Event) error {
+	event = arus.NewEventView(event, arus.AudienceOwner)
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	if event.ID != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", event.ID); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	return err
+}
@@ -0,0 +1,132 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dnswd/arus"
+)
+
+// newTestHandler streams the events of the user named in a request's X-User
+// header, from a service holding user "u1". The service has no event bus
+// unless events is set.
+func newTestHandler(t *testing.T, events bool) (*Handler, *arus.FinanceService) {
+	t.Helper()
+	repo := arus.NewInMemoryUserRepository()
+	if err := repo.Save(context.Background(), arus.NewUser("u1")); err != nil {
+		t.Fatal(err)
+	}
+	service := &arus.FinanceService{UserRepo: repo}
+	if events {
+		service.Events = arus.NewEventBus()
+	}
+	return NewHandler(service, func(r *http.Request) (string, error) {
+		if id := r.Header.Get("X-User"); id != "" {
+			return id, nil
+		}
+		return "", errors.New("not signed in")
+	}), service
+}
+
+func TestHandlerRefusesStream(t *testing.T) {
+	tests := []struct {
+		name   string
+		events bool
+		user   string
+		want   int
+	}{
+		{name: "events disabled", user: "u1", want: http.StatusNotFound},
+		{name: "not signed in", events: true, want: http.StatusUnauthorized},
+		{name: "unknown user", events: true, user: "u2", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandler(t, tt.events)
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.user != "" {
+				req.Header.Set("X-User", tt.user)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status %d %s, want %d", rec.Code, rec.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerStreamsEvents(t *testing.T) {
+	expense := arus.Transaction{ID: "tx1", Description: "groceries"}
+	tests := []struct {
+		name      string
+		published []arus.Event
+		// Event names streamed after the initial balances, in order
+		want []string
+	}{
+		{
+			name:      "the user's events",
+			published: []arus.Event{{ID: "e1", Type: arus.EventTransactionRecorded, UserID: "u1", Data: expense}},
+			want:      []string{arus.EventTransactionRecorded},
+		},
+		{
+			name: "other users' events are left out",
+			published: []arus.Event{
+				{ID: "e1", Type: arus.EventTransactionRecorded, UserID: "u2", Data: expense},
+				{ID: "e2", Type: arus.EventGoalReached, UserID: "u1", Data: arus.Goal{ID: "g1"}},
+			},
+			want: []string{arus.EventGoalReached},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, service := newTestHandler(t, true)
+			server := httptest.NewServer(h)
+			defer server.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("X-User", "u1")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+				t.Fatalf("Content-Type %q, want text/event-stream", got)
+			}
+
+			// The handler has subscribed once the first event arrives
+			lines := bufio.NewScanner(resp.Body)
+			next := func() string {
+				for lines.Scan() {
+					if name, ok := strings.CutPrefix(lines.Text(), "event: "); ok {
+						return name
+					}
+				}
+				t.Fatalf("stream ended: %v", lines.Err())
+				return ""
+			}
+			if got := next(); got != arus.EventBalancesUpdated {
+				t.Fatalf("first event %s, want %s", got, arus.EventBalancesUpdated)
+			}
+			for _, event := range tt.published {
+				service.Events.Publish(event)
+			}
+			for _, want := range tt.want {
+				if got := next(); got != want {
+					t.Errorf("streamed %s, want %s", got, want)
+				}
+			}
+		})
+	}
+}
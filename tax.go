@@ -0,0 +1,270 @@
+package arus
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Tags marking an expense as tax-deductible for users who have not chosen
+// their own
+var DefaultDeductibleTags = []string{"deductible"}
+
+// TaxGrouping is how a tax summary groups deductible expenses.
+type TaxGrouping string
+
+const (
+	// By the expense's first tag besides the deductible one, such as
+	// "medical" or "charity"
+	GroupByTag TaxGrouping = "tag"
+	// By merchant, or description when the merchant is unknown
+	GroupByMerchant TaxGrouping = "merchant"
+)
+
+// TaxGroup is the deductible expenses sharing a tag or merchant.
+type TaxGroup struct {
+	Key      string
+	Total    Money
+	Expenses []Transaction
+}
+
+// TaxSummary is the income and deductible expenses of a tax year.
+// Deductible amounts are positive.
+type TaxSummary struct {
+	Year       Period
+	GroupBy    TaxGrouping
+	Income     Money
+	Incomes    []Transaction
+	Deductible Money
+	Groups     []TaxGroup
+}
+
+// TaxYear returns the user's tax year starting in the given calendar year,
+// in the user's time zone. The start is the user's TaxYearStartMonth and
+// TaxYearStartDay, else their country profile's, else January 1.
+func (u *User) TaxYear(year int) Period {
+	month, day := u.TaxYearStartMonth, u.TaxYearStartDay
+	if month == 0 {
+		month, day = time.January, 1
+		if profile, ok := u.Profile(); ok && profile.TaxYearStartMonth != 0 {
+			month, day = profile.TaxYearStartMonth, profile.TaxYearStartDay
+		}
+	}
+	start := time.Date(year, month, max(day, 1), 0, 0, 0, 0, u.Location())
+	return periodUntil(start, start.AddDate(1, 0, 0))
+}
+
+// TaxYearOf returns the user's tax year containing date.
+func (u *User) TaxYearOf(date time.Time) Period {
+	year := u.TaxYear(date.In(u.Location()).Year())
+	if date.Before(year.StartDate) {
+		return year.Previous()
+	}
+	return year
+}
+
+// SetTaxYearStart sets the first day of the user's tax year, for
+// jurisdictions whose tax year is not the calendar year. A zero month goes
+// back to the country profile's.
+func (u *User) SetTaxYearStart(month time.Month, day int) error {
+	if month == 0 {
+		u.TaxYearStartMonth, u.TaxYearStartDay = 0, 0
+		return nil
+	}
+	if month < time.January || month > time.December {
+		return fmt.Errorf("invalid tax year start month %d", month)
+	}
+	// Day 28 is the latest every year has, so tax years never skip a day
+	if day < 1 || day > 28 {
+		return errors.New("tax year start day must be between 1 and 28")
+	}
+	u.TaxYearStartMonth, u.TaxYearStartDay = month, day
+	return nil
+}
+
+func (u *User) deductibleTags() []string {
+	if len(u.DeductibleTags) > 0 {
+		return u.DeductibleTags
+	}
+	return DefaultDeductibleTags
+}
+
+// deductibleTag returns the tag making the expense deductible, if any.
+func (u *User) deductibleTag(expense Transaction) (string, bool) {
+	for _, tag := range expense.Tags {
+		for _, deductible := range u.deductibleTags() {
+			if strings.EqualFold(tag, deductible) {
+				return tag, true
+			}
+		}
+	}
+	return "", false
+}
+
+// taxGroupKey returns the group of a deductible expense.
+func (u *User) taxGroupKey(expense Transaction, deductible string, groupBy TaxGrouping) string {
+	if groupBy == GroupByMerchant {
+		if expense.Merchant != "" {
+			return expense.Merchant
+		}
+		return strings.TrimSpace(expense.Description)
+	}
+	for _, tag := range expense.Tags {
+		if !slices.ContainsFunc(u.deductibleTags(), func(d string) bool { return strings.EqualFold(tag, d) }) {
+			return strings.ToLower(tag)
+		}
+	}
+	return strings.ToLower(deductible)
+}
+
+// TaxSummary totals the income and the deductible expenses (those tagged
+// with one of the user's DeductibleTags) of a tax year. Groups are ordered
+// by total, largest first.
+func (u *User) TaxSummary(year Period, groupBy TaxGrouping) (TaxSummary, error) {
+	if groupBy != GroupByTag && groupBy != GroupByMerchant {
+		return TaxSummary{}, fmt.Errorf("unknown tax grouping %q", groupBy)
+	}
+	summary := TaxSummary{
+		Year:       year,
+		GroupBy:    groupBy,
+		Income:     NewMoneyZero(u.Currency()),
+		Deductible: NewMoneyZero(u.Currency()),
+	}
+	for _, income := range u.Incomes {
+		if year.Contains(income.Date) && income.Counts() {
+			summary.Income = summary.Income.Add(income.Amount)
+			summary.Incomes = append(summary.Incomes, income)
+		}
+	}
+
+	groups := make(map[string]*TaxGroup)
+	for _, expense := range u.Expenses {
+		if !year.Contains(expense.Date) || !expense.Counts() {
+			continue
+		}
+		tag, ok := u.deductibleTag(expense)
+		if !ok {
+			continue
+		}
+		key := u.taxGroupKey(expense, tag, groupBy)
+		group, exists := groups[key]
+		if !exists {
+			group = &TaxGroup{Key: key, Total: NewMoneyZero(u.Currency())}
+			groups[key] = group
+		}
+		group.Total = group.Total.Add(expense.Amount.Abs())
+		group.Expenses = append(group.Expenses, expense)
+		summary.Deductible = summary.Deductible.Add(expense.Amount.Abs())
+	}
+	for _, group := range groups {
+		group.Total = group.Total.Round()
+		summary.Groups = append(summary.Groups, *group)
+	}
+	slices.SortFunc(summary.Groups, func(a, b TaxGroup) int {
+		if c := b.Total.Amount.Cmp(a.Total.Amount); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+	summary.Income = summary.Income.Round()
+	summary.Deductible = summary.Deductible.Round()
+	return summary, nil
+}
+
+// WriteCSV writes every income and deductible expense of the summary, one
+// per row, with plain decimal amounts for spreadsheets and tax software.
+func (s TaxSummary) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"section", "group", "date", "description", "merchant", "amount", "currency"})
+	for _, income := range s.Incomes {
+		out.Write([]string{"income", "", income.Date.Format(time.DateOnly), income.Description, income.Merchant,
+			income.Amount.StringFixed(), income.Amount.Currency})
+	}
+	for _, group := range s.Groups {
+		for _, expense := range group.Expenses {
+			out.Write([]string{"deductible", group.Key, expense.Date.Format(time.DateOnly), expense.Description, expense.Merchant,
+				expense.Amount.Abs().StringFixed(), expense.Amount.Currency})
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// lines renders the summary as text: totals, then each group's expenses.
+func (s TaxSummary) lines(locale Locale) []string {
+	end := s.Year.EndDate.Format(time.DateOnly)
+	lines := []string{
+		fmt.Sprintf("Tax summary %s to %s", s.Year.StartDate.Format(time.DateOnly), end),
+		"",
+		fmt.Sprintf("%-40s %20s", fmt.Sprintf("Income (%d)", len(s.Incomes)), s.Income.Format(locale)),
+		fmt.Sprintf("%-40s %20s", "Deductible expenses", s.Deductible.Format(locale)),
+	}
+	for _, group := range s.Groups {
+		lines = append(lines, "", fmt.Sprintf("%-40s %20s", truncate(group.Key, 40), group.Total.Format(locale)))
+		for _, expense := range group.Expenses {
+			lines = append(lines, fmt.Sprintf("  %s  %-26s %20s",
+				expense.Date.Format(time.DateOnly), truncate(expense.Description, 26), expense.Amount.Abs().Format(locale)))
+		}
+	}
+	return lines
+}
+
+// WritePDF writes the summary as a printable PDF document.
+func (s TaxSummary) WritePDF(w io.Writer, locale Locale) error {
+	return writeTextPDF(w, "Tax summary "+s.Year.StartDate.Format(time.DateOnly), s.lines(locale))
+}
+
+// truncate shortens s to at most n characters.
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// TaxSummary returns the user's tax summary for the tax year starting in
+// the given calendar year.
+func (s *FinanceService) TaxSummary(ctx context.Context, userID string, year int, groupBy TaxGrouping) (TaxSummary, error) {
+	user, err := s.readUser(ctx, userID)
+	if err != nil {
+		return TaxSummary{}, err
+	}
+	period := user.TaxYear(year)
+	if err := s.rehydrate(ctx, user, period); err != nil {
+		return TaxSummary{}, err
+	}
+	return user.TaxSummary(period, groupBy)
+}
+
+func (s *FinanceService) SetTaxYearStart(ctx context.Context, userID string, month time.Month, day int) error {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := user.SetTaxYearStart(month, day); err != nil {
+		return err
+	}
+	return s.save(ctx, user, "set_tax_year_start")
+}
+
+// SetDeductibleTags sets the tags marking the user's expenses as
+// tax-deductible; none goes back to DefaultDeductibleTags.
+func (s *FinanceService) SetDeductibleTags(ctx context.Context, userID string, tags []string) error {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	user.DeductibleTags = slices.Clone(tags)
+	return s.save(ctx, user, "set_deductible_tags")
+}
@@ -0,0 +1,113 @@
+package arus
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// UsageEvent records that a feature was used. It never carries amounts,
+// descriptions or account numbers; the user is identified only by a salted
+// hash that cannot be reversed without the instance's salt.
+type UsageEvent struct {
+	Feature    string
+	Action     string
+	Subject    string
+	Time       time.Time
+	Properties map[string]string
+}
+
+// TelemetrySink receives usage events, e.g. to forward them to an analytics
+// backend.
+type TelemetrySink interface {
+	Emit(ctx context.Context, event UsageEvent) error
+}
+
+// Telemetry is disabled unless Enabled is set by the operator.
+type Telemetry struct {
+	Enabled bool
+	Sink    TelemetrySink
+	// Instance secret used to anonymize user IDs
+	Salt string
+	// Source of event timestamps; nil uses the wall clock
+	Clock Clock
+}
+
+// Track emits a usage event if telemetry is enabled. Sink failures are
+// ignored so analytics can never break the operation being tracked.
+func (t *Telemetry) Track(ctx context.Context, feature, action, userID string, properties map[string]string) {
+	if t == nil || !t.Enabled || t.Sink == nil {
+		return
+	}
+	_ = t.Sink.Emit(ctx, UsageEvent{
+		Feature:    feature,
+		Action:     action,
+		Subject:    t.anonymize(userID),
+		Time:       clockOrSystem(t.Clock).Now().UTC(),
+		Properties: properties,
+	})
+}
+
+func (t *Telemetry) anonymize(userID string) string {
+	if userID == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(t.Salt))
+	mac.Write([]byte(userID))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// JSONLinesSink writes each event as a JSON line, e.g. to a local file.
+type JSONLinesSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewJSONLinesSink(w io.Writer) *JSONLinesSink {
+	return &JSONLinesSink{w: w}
+}
+
+func (s *JSONLinesSink) Emit(ctx context.Context, event UsageEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return json.NewEncoder(s.w).Encode(event)
+}
+
+// MemorySink keeps events in memory, e.g. for a usage dashboard.
+type MemorySink struct {
+	mu     sync.Mutex
+	events []UsageEvent
+}
+
+func (s *MemorySink) Emit(ctx context.Context, event UsageEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *MemorySink) Events() []UsageEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]UsageEvent(nil), s.events...)
+}
+
+// Counts of events per feature
+func (s *MemorySink) FeatureCounts() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[string]int)
+	for _, event := range s.events {
+		counts[event.Feature]++
+	}
+	return counts
+}
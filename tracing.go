@@ -0,0 +1,124 @@
+package arus
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Instrumentation name of the spans arus creates
+const tracerName = "github.com/dnswd/arus"
+
+// tracerOrGlobal returns tracer, falling back to the globally registered
+// provider, which does nothing until the application installs one.
+func tracerOrGlobal(tracer trace.Tracer) trace.Tracer {
+	if tracer == nil {
+		return otel.Tracer(tracerName)
+	}
+	return tracer
+}
+
+func (s *FinanceService) startSpan(ctx context.Context, name, userID string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, attribute.String("arus.user_id", userID))
+	return tracerOrGlobal(s.Tracer).Start(ctx, "FinanceService."+name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records *err on the span and ends it. Call it deferred with the
+// address of a named error result.
+func endSpan(span trace.Span, err *error) {
+	if *err != nil {
+		span.RecordError(*err)
+		span.SetStatus(codes.Error, (*err).Error())
+	}
+	span.End()
+}
+
+// TracedUserRepository wraps a repository with a span per call.
+type TracedUserRepository struct {
+	Repo   UserRepository
+	Tracer trace.Tracer
+}
+
+func NewTracedUserRepository(repo UserRepository, tracer trace.Tracer) *TracedUserRepository {
+	return &TracedUserRepository{Repo: repo, Tracer: tracer}
+}
+
+func (r *TracedUserRepository) start(ctx context.Context, name, userID string) (context.Context, trace.Span) {
+	return tracerOrGlobal(r.Tracer).Start(ctx, "UserRepository."+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("arus.user_id", userID)))
+}
+
+func (r *TracedUserRepository) GetByID(ctx context.Context, id string) (_ *User, err error) {
+	ctx, span := r.start(ctx, "GetByID", id)
+	defer endSpan(span, &err)
+
+	return r.Repo.GetByID(ctx, id)
+}
+
+func (r *TracedUserRepository) Save(ctx context.Context, user *User) (err error) {
+	ctx, span := r.start(ctx, "Save", user.ID)
+	defer endSpan(span, &err)
+
+	span.SetAttributes(attribute.Int("arus.transactions", user.TransactionCount()))
+	return r.Repo.Save(ctx, user)
+}
+
+// ForEach is traced as a single span; it fails when the wrapped repository
+// cannot iterate users.
+func (r *TracedUserRepository) ForEach(ctx context.Context, fn func(user *User) error) (err error) {
+	ctx, span := tracerOrGlobal(r.Tracer).Start(ctx, "UserRepository.ForEach", trace.WithSpanKind(trace.SpanKindClient))
+	defer endSpan(span, &err)
+
+	iterator, ok := r.Repo.(UserIterator)
+	if !ok {
+		return errors.New("repository does not support iterating users")
+	}
+	return iterator.ForEach(ctx, fn)
+}
+
+func (r *TracedUserRepository) archive() (UserArchive, error) {
+	archive, ok := r.Repo.(UserArchive)
+	if !ok {
+		return nil, errors.New("repository does not support archiving users")
+	}
+	return archive, nil
+}
+
+func (r *TracedUserRepository) Archive(ctx context.Context, id string, at time.Time) (err error) {
+	ctx, span := r.start(ctx, "Archive", id)
+	defer endSpan(span, &err)
+
+	archive, err := r.archive()
+	if err != nil {
+		return err
+	}
+	return archive.Archive(ctx, id, at)
+}
+
+func (r *TracedUserRepository) Restore(ctx context.Context, id string) (_ *User, err error) {
+	ctx, span := r.start(ctx, "Restore", id)
+	defer endSpan(span, &err)
+
+	archive, err := r.archive()
+	if err != nil {
+		return nil, err
+	}
+	return archive.Restore(ctx, id)
+}
+
+func (r *TracedUserRepository) Delete(ctx context.Context, id string) (err error) {
+	ctx, span := r.start(ctx, "Delete", id)
+	defer endSpan(span, &err)
+
+	archive, err := r.archive()
+	if err != nil {
+		return err
+	}
+	return archive.Delete(ctx, id)
+}
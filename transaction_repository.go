@@ -0,0 +1,473 @@
+package arus
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Kinds of transactions a TransactionRepository holds
+type TransactionKind string
+
+const (
+	TransactionIncome  TransactionKind = "income"
+	TransactionExpense TransactionKind = "expense"
+)
+
+// TransactionSort is the order a TransactionQuery returns transactions in.
+type TransactionSort int
+
+const (
+	SortByDate TransactionSort = iota
+	// By the size of the amount, whether income or expense; transactions of
+	// the same size are ordered by date
+	SortByAmount
+)
+
+var transactionSortCodes = enumCodes[TransactionSort]{
+	name: "transaction sort",
+	codes: map[TransactionSort]string{
+		SortByDate:   "date",
+		SortByAmount: "amount",
+	},
+	unknown: SortByDate,
+}
+
+// ParseTransactionSort reads a transaction sort code, returning SortByDate
+// for codes this version does not know.
+func ParseTransactionSort(code string) TransactionSort {
+	return transactionSortCodes.parse(code)
+}
+
+func (s TransactionSort) Code() string {
+	return transactionSortCodes.code(s)
+}
+
+func (s TransactionSort) String() string {
+	return s.Code()
+}
+
+func (s TransactionSort) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Code())
+}
+
+func (s *TransactionSort) UnmarshalJSON(data []byte) error {
+	value, err := transactionSortCodes.unmarshalJSON(data)
+	*s = value
+	return err
+}
+
+// TransactionQuery selects transactions of one kind, oldest first unless
+// Sort and Descending say otherwise. A nil Period selects all of them and a
+// zero Limit returns them in one page. The other filters are ignored when
+// zero.
+type TransactionQuery struct {
+	Period *Period
+	// Transactions the category covered or received part of
+	Category *CategoryType
+	Tag      string
+	// Name of the bank the transactions were imported from
+	Bank string
+	// Transactions with one of these IDs; empty matches any
+	IDs []string
+	// Bounds on the size of the amount, inclusive
+	MinAmount  *decimal.Decimal
+	MaxAmount  *decimal.Decimal
+	Sort       TransactionSort
+	Descending bool
+	Cursor     string
+	Limit      int
+}
+
+// filtered reports whether the query filters on more than the period.
+func (q TransactionQuery) filtered() bool {
+	return q.Category != nil || q.Tag != "" || q.Bank != "" || q.MinAmount != nil || q.MaxAmount != nil || len(q.IDs) > 0
+}
+
+// matches reports whether the transaction passes the query's filters
+// besides the period.
+func (q TransactionQuery) matches(tx Transaction) bool {
+	if q.Category != nil && !slices.Contains(tx.categories(), *q.Category) {
+		return false
+	}
+	if q.Tag != "" && !slices.Contains(tx.Tags, q.Tag) {
+		return false
+	}
+	if q.Bank != "" && tx.Bank != q.Bank {
+		return false
+	}
+	if len(q.IDs) > 0 && !slices.Contains(q.IDs, tx.ID) {
+		return false
+	}
+	size := tx.Amount.Amount.Abs()
+	if q.MinAmount != nil && size.LessThan(*q.MinAmount) {
+		return false
+	}
+	if q.MaxAmount != nil && size.GreaterThan(*q.MaxAmount) {
+		return false
+	}
+	return true
+}
+
+// compare orders transactions as the query returns them, sorting stably
+// transactions already in the order of their dates and recording.
+func (q TransactionQuery) compare(a, b Transaction) int {
+	c := 0
+	if q.Sort == SortByAmount {
+		c = a.Amount.Amount.Abs().Cmp(b.Amount.Amount.Abs())
+	}
+	if c == 0 {
+		c = compareTransactions(a, b)
+	}
+	if q.Descending {
+		return -c
+	}
+	return c
+}
+
+// categories returns the categories that covered or received part of the
+// transaction, each once.
+func (tx Transaction) categories() []CategoryType {
+	var categories []CategoryType
+	for _, deduction := range tx.Deductions {
+		if !slices.Contains(categories, deduction.Category) {
+			categories = append(categories, deduction.Category)
+		}
+	}
+	for _, allocation := range tx.Allocations {
+		if !slices.Contains(categories, allocation.Category) {
+			categories = append(categories, allocation.Category)
+		}
+	}
+	return categories
+}
+
+// TransactionRepository stores users' transactions apart from the user
+// document, indexed by date, so long histories can be read one page or one
+// period at a time.
+type TransactionRepository interface {
+	// SaveTransactions inserts the transactions, replacing any stored under
+	// the same ID.
+	SaveTransactions(ctx context.Context, userID string, kind TransactionKind, transactions ...Transaction) error
+	QueryTransactions(ctx context.Context, userID string, kind TransactionKind, query TransactionQuery) (TransactionPage, error)
+	// DeleteTransactions removes the user's transactions with the given
+	// IDs, or every transaction of the user when no IDs are given, e.g.
+	// when the user is deleted.
+	DeleteTransactions(ctx context.Context, userID string, ids ...string) error
+}
+
+// InMemoryTransactionRepository keeps transactions in memory. Like
+// InMemoryUserRepository it stores and returns deep copies.
+type InMemoryTransactionRepository struct {
+	mu   sync.RWMutex
+	data map[string]map[TransactionKind][]Transaction
+	// When each transaction was first saved, by user and ID, which orders
+	// those of the same date
+	seqs map[string]map[string]int
+	seq  int
+}
+
+func NewInMemoryTransactionRepository() *InMemoryTransactionRepository {
+	return &InMemoryTransactionRepository{
+		data: make(map[string]map[TransactionKind][]Transaction),
+		seqs: make(map[string]map[string]int),
+	}
+}
+
+// compareTransactions orders transactions by date. Sorted stably, those of
+// the same date keep the order they were recorded in.
+func compareTransactions(a, b Transaction) int {
+	return a.Date.Compare(b.Date)
+}
+
+// compareStored orders the user's stored transactions by date, then by
+// when they were first saved.
+func (r *InMemoryTransactionRepository) compareStored(userID string) func(a, b Transaction) int {
+	seqs := r.seqs[userID]
+	return func(a, b Transaction) int {
+		if c := compareTransactions(a, b); c != 0 {
+			return c
+		}
+		return cmp.Compare(seqs[a.ID], seqs[b.ID])
+	}
+}
+
+func (r *InMemoryTransactionRepository) SaveTransactions(ctx context.Context, userID string, kind TransactionKind, transactions ...Transaction) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	transactions, err := copyTransactions(transactions)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.data == nil {
+		r.data = make(map[string]map[TransactionKind][]Transaction)
+		r.seqs = make(map[string]map[string]int)
+	}
+	kinds, exists := r.data[userID]
+	if !exists {
+		kinds = make(map[TransactionKind][]Transaction)
+		r.data[userID] = kinds
+		r.seqs[userID] = make(map[string]int)
+	}
+
+	stored, seqs, compare := kinds[kind], r.seqs[userID], r.compareStored(userID)
+	for _, tx := range transactions {
+		if _, saved := seqs[tx.ID]; saved {
+			stored = slices.DeleteFunc(stored, func(t Transaction) bool { return t.ID == tx.ID })
+		} else {
+			r.seq++
+			seqs[tx.ID] = r.seq
+		}
+		i, _ := slices.BinarySearchFunc(stored, tx, compare)
+		stored = slices.Insert(stored, i, tx)
+	}
+	kinds[kind] = stored
+	return nil
+}
+
+func (r *InMemoryTransactionRepository) QueryTransactions(ctx context.Context, userID string, kind TransactionKind, query TransactionQuery) (TransactionPage, error) {
+	if err := ctx.Err(); err != nil {
+		return TransactionPage{}, err
+	}
+
+	r.mu.RLock()
+	stored := r.data[userID][kind]
+	if query.Period != nil {
+		// Transactions are sorted by date, so the period is a contiguous run
+		start, _ := slices.BinarySearchFunc(stored, query.Period.StartDate, func(t Transaction, date time.Time) int {
+			return t.Date.Compare(date)
+		})
+		end := start
+		for end < len(stored) && query.Period.Contains(stored[end].Date) {
+			end++
+		}
+		stored = stored[start:end]
+	}
+	transactions, err := copyTransactions(stored)
+	r.mu.RUnlock()
+	if err != nil {
+		return TransactionPage{}, err
+	}
+
+	return pageQuery(transactions, query)
+}
+
+// copyTransactions deep-copies transactions, so a stored copy shares no
+// slices with the caller's.
+func copyTransactions(transactions []Transaction) ([]Transaction, error) {
+	if len(transactions) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(transactions)
+	if err != nil {
+		return nil, err
+	}
+	var copied []Transaction
+	if err := json.Unmarshal(data, &copied); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
+
+func (r *InMemoryTransactionRepository) DeleteTransactions(ctx context.Context, userID string, ids ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(ids) == 0 {
+		delete(r.data, userID)
+		delete(r.seqs, userID)
+		return nil
+	}
+	for kind, stored := range r.data[userID] {
+		r.data[userID][kind] = slices.DeleteFunc(stored, func(t Transaction) bool { return slices.Contains(ids, t.ID) })
+	}
+	for _, id := range ids {
+		delete(r.seqs[userID], id)
+	}
+	return nil
+}
+
+// pageQuery filters and sorts transactions that already match the query's
+// period, in date order, and pages them.
+func pageQuery(transactions []Transaction, query TransactionQuery) (TransactionPage, error) {
+	if query.filtered() {
+		transactions = slices.DeleteFunc(transactions, func(t Transaction) bool { return !query.matches(t) })
+	}
+	if query.Descending {
+		// So transactions of the same date come latest recorded first
+		slices.Reverse(transactions)
+	}
+	if query.Sort != SortByDate || query.Descending {
+		slices.SortStableFunc(transactions, query.compare)
+	}
+	if query.Limit < 0 {
+		return TransactionPage{}, errors.New("page limit must not be negative")
+	}
+	if query.Limit == 0 {
+		if query.Cursor != "" {
+			return TransactionPage{}, errors.New("cursor given without a page limit")
+		}
+		return TransactionPage{Transactions: transactions, TotalCount: len(transactions)}, nil
+	}
+	return PageTransactions(transactions, query.Cursor, query.Limit)
+}
+
+// transactionsOf returns the user's in-memory history of a kind.
+func (u *User) transactionsOf(kind TransactionKind) []Transaction {
+	if kind == TransactionIncome {
+		return u.Incomes
+	}
+	return u.Expenses
+}
+
+// historyLoader is implemented by user repositories that keep users'
+// transactions in a TransactionRepository and load only the recent ones.
+type historyLoader interface {
+	transactionRepository() TransactionRepository
+	loadTransactions(ctx context.Context, user *User, query TransactionQuery) error
+}
+
+// loadTransactions adds the user's stored transactions matching query to
+// those the repository loaded, when it left some out.
+func (s *FinanceService) loadTransactions(ctx context.Context, user *User, query TransactionQuery) error {
+	loader, ok := s.UserRepo.(historyLoader)
+	if !ok || user.historyFrom.IsZero() {
+		return nil
+	}
+	return loader.loadTransactions(ctx, user, query)
+}
+
+// loadHistory loads every transaction of the user, for changes and
+// reports spanning it all.
+func (s *FinanceService) loadHistory(ctx context.Context, user *User) error {
+	return s.loadTransactions(ctx, user, TransactionQuery{})
+}
+
+// loadSince loads the user's transactions dated from since on.
+func (s *FinanceService) loadSince(ctx context.Context, user *User, since time.Time) error {
+	if !since.Before(user.historyFrom) {
+		return nil
+	}
+	return s.loadTransactions(ctx, user, TransactionQuery{Period: &Period{StartDate: since, EndDate: endOfTime}})
+}
+
+// loadPeriods loads the user's transactions of periods still in the
+// transaction repository; see readUserFor for archived ones.
+func (s *FinanceService) loadPeriods(ctx context.Context, user *User, periods ...Period) error {
+	for _, period := range periods {
+		if !period.StartDate.Before(user.historyFrom) {
+			continue
+		}
+		if err := s.loadTransactions(ctx, user, TransactionQuery{Period: &period}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadAround loads the user's transactions that transactions dated as
+// given may duplicate or settle: those from the earliest date on, less the
+// longest a posted transaction trails what it settles.
+func (s *FinanceService) loadAround(ctx context.Context, user *User, dates ...time.Time) error {
+	if len(dates) == 0 {
+		return nil
+	}
+	since := slices.MinFunc(dates, time.Time.Compare)
+	return s.loadSince(ctx, user, since.Add(-max(pendingMatchWindow, cardPostingLag)))
+}
+
+// loadStatement loads the user's transactions the lines of a statement of
+// account may duplicate, settle or match, those of the card cycles they
+// fall in too.
+func (s *FinanceService) loadStatement(ctx context.Context, user *User, account BankAccount, lines []StatementLine) error {
+	dates := make([]time.Time, 0, len(lines)+1)
+	for _, line := range lines {
+		dates = append(dates, line.Date)
+	}
+	if card := user.creditCard(account); card != nil && len(dates) > 0 {
+		dates = append(dates, card.cycleOf(slices.MinFunc(dates, time.Time.Compare)).StartDate)
+	}
+	return s.loadAround(ctx, user, dates...)
+}
+
+// loadTransactionIDs loads the user's transactions of the IDs, those a
+// change looks up or an import may already have recorded.
+func (s *FinanceService) loadTransactionIDs(ctx context.Context, user *User, ids ...string) error {
+	missing := slices.DeleteFunc(slices.Clone(ids), func(id string) bool {
+		_, err := user.transaction(id)
+		return err == nil
+	})
+	if len(missing) == 0 {
+		return nil
+	}
+	return s.loadTransactions(ctx, user, TransactionQuery{IDs: missing})
+}
+
+// loadExpense loads the user's expense and what was recorded against it
+// since, such as its refunds and settlements.
+func (s *FinanceService) loadExpense(ctx context.Context, user *User, expenseID string) error {
+	if err := s.loadTransactionIDs(ctx, user, expenseID); err != nil {
+		return err
+	}
+	if expense, err := user.Expense(expenseID); err == nil {
+		return s.loadSince(ctx, user, expense.Date)
+	}
+	return nil
+}
+
+// QueryTransactions returns a page of the user's transactions of a kind,
+// from the transaction repository when the user repository keeps them in
+// one and from the user's history otherwise.
+func (s *FinanceService) QueryTransactions(ctx context.Context, userID string, kind TransactionKind, query TransactionQuery) (TransactionPage, error) {
+	if loader, ok := s.UserRepo.(historyLoader); ok {
+		if transactions := loader.transactionRepository(); transactions != nil {
+			return transactions.QueryTransactions(ctx, userID, kind, query)
+		}
+	}
+
+	defer s.readLockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return TransactionPage{}, err
+	}
+	transactions := slices.SortedStableFunc(slices.Values(user.transactionsOf(kind)), compareTransactions)
+	if query.Period != nil {
+		transactions = slices.DeleteFunc(transactions, func(t Transaction) bool {
+			return !query.Period.Contains(t.Date)
+		})
+	}
+	return pageQuery(transactions, query)
+}
+
+// BackfillTransactions moves the transactions a user document still
+// carries into the transaction repository, for users recorded before the
+// user repository kept them apart.
+func (s *FinanceService) BackfillTransactions(ctx context.Context, userID string) error {
+	loader, ok := s.UserRepo.(historyLoader)
+	if !ok || loader.transactionRepository() == nil {
+		return errors.New("no transaction repository is configured")
+	}
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return s.save(ctx, user, "backfill_transactions")
+}
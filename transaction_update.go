@@ -0,0 +1,90 @@
+package arus
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+)
+
+// UpdateTransaction applies patch to the descriptive fields of a
+// transaction (description, tags, merchant and notes) and returns it.
+// Amounts, dates and balances are never touched. Locked transactions are
+// rejected with a TransactionLockedError; amend them instead. Each update
+// is recorded in the audit log, see TransactionHistory.
+func (s *FinanceService) UpdateTransaction(ctx context.Context, userID, transactionID string, patch TransactionEdit) (Transaction, error) {
+	if patch.IsEmpty() {
+		return Transaction{}, errors.New("transaction update changes nothing")
+	}
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if err := s.loadTransactionIDs(ctx, user, transactionID); err != nil {
+		return Transaction{}, err
+	}
+	if err := user.EditTransaction(transactionID, patch, s.now()); err != nil {
+		return Transaction{}, err
+	}
+	updated, err := user.transaction(transactionID)
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	if err := s.save(ctx, user, "update_transaction"); err != nil {
+		return Transaction{}, err
+	}
+	s.log().InfoContext(ctx, "updated transaction", LogKeyUserID, userID, LogKeyTransactionID, transactionID)
+	s.publish(userID, EventTransactionUpdated, *updated)
+	s.Telemetry.Track(ctx, "transactions", "edit", userID, nil)
+	return *updated, nil
+}
+
+// TransactionRevision is a transaction as it was after an operation that
+// recorded or changed its details.
+type TransactionRevision struct {
+	At          time.Time
+	Operation   string
+	Transaction Transaction
+}
+
+func sameDetails(a, b Transaction) bool {
+	return a.Description == b.Description && a.Merchant == b.Merchant && a.Notes == b.Notes && slices.Equal(a.Tags, b.Tags)
+}
+
+// TransactionHistory returns the revisions of a transaction's details,
+// oldest first, read back from the audit log: the transaction when first
+// recorded and after each change to its description, tags, merchant or
+// notes. It returns ErrNoHistory when no audit log is configured.
+func (s *FinanceService) TransactionHistory(ctx context.Context, userID, transactionID string) ([]TransactionRevision, error) {
+	if s.Audit == nil {
+		return nil, ErrNoHistory
+	}
+	entries, err := s.Audit.Entries(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var revisions []TransactionRevision
+	for _, entry := range entries {
+		state, err := entry.User()
+		if err != nil {
+			return nil, err
+		}
+		tx, err := state.transaction(transactionID)
+		if err != nil {
+			continue
+		}
+		if n := len(revisions); n > 0 && sameDetails(revisions[n-1].Transaction, *tx) {
+			continue
+		}
+		revisions = append(revisions, TransactionRevision{At: entry.At, Operation: entry.Operation, Transaction: *tx})
+	}
+	if len(revisions) == 0 {
+		return nil, ErrTransactionNotFound
+	}
+	return revisions, nil
+}
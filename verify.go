@@ -0,0 +1,217 @@
+package arus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// BalanceDrift is a category sub-balance that does not match what the
+// user's history adds up to.
+type BalanceDrift struct {
+	Category CategoryType
+	// Balance recomputed from the history
+	Expected Money
+	// Balance the category holds
+	Stored Money
+}
+
+// Drift is how far the stored balance is off: positive when the category
+// holds more than its history accounts for.
+func (d BalanceDrift) Drift() Money {
+	return Money{Amount: d.Stored.Amount.Sub(d.Expected.Amount), Currency: d.Stored.Currency}
+}
+
+func (d BalanceDrift) String() string {
+	return fmt.Sprintf("%s: stored %s, expected %s", d.Category, d.Stored.StringFixed(), d.Expected.StringFixed())
+}
+
+// BalanceAdjustment is an entry correcting a category's balance for drift
+// found by VerifyBalances. Amount is signed: positive credits the category.
+// Adjustments cancel changes the history does not explain, so they are
+// kept as an audit trail rather than replayed.
+type BalanceAdjustment struct {
+	ID       string
+	Date     time.Time
+	Category CategoryType
+	Amount   Money
+	Reason   string `json:",omitempty"`
+}
+
+// VerifyBalances recomputes every category balance from the user's Journal
+// and returns the sub-balances that drifted from it. The transactions of
+// archived periods must be read back first; FinanceService.VerifyBalances
+// does so.
+func (u *User) VerifyBalances() []BalanceDrift {
+	return u.balanceDrifts(nil, nil)
+}
+
+func (u *User) balanceDrifts(archivedIncomes, archivedExpenses []Transaction) []BalanceDrift {
+	totals := ledgerTotals(u.journal(slices.Concat(archivedIncomes, u.Incomes), slices.Concat(archivedExpenses, u.Expenses)))
+
+	var drifts []BalanceDrift
+	for _, categoryType := range slices.Sorted(maps.Keys(u.Categories)) {
+		category := u.Categories[categoryType]
+		expected := totals[CategoryLedgerAccount(categoryType)]
+		currencies := category.Currencies()
+		for currency := range expected {
+			if !slices.Contains(currencies, currency) {
+				currencies = append(currencies, currency)
+			}
+		}
+		for _, currency := range currencies {
+			want, exists := expected[currency]
+			if !exists {
+				want = NewMoneyZero(currency)
+			}
+			stored := category.BalanceIn(currency)
+			if !stored.Amount.Equal(want.Amount) {
+				drifts = append(drifts, BalanceDrift{Category: categoryType, Expected: want, Stored: stored})
+			}
+		}
+	}
+	return drifts
+}
+
+// RepairBalances records an adjustment for each drift, bringing the stored
+// balance to the expected one, and returns the adjustments.
+func (u *User) RepairBalances(drifts []BalanceDrift, date time.Time, reason string) ([]BalanceAdjustment, error) {
+	var adjustments []BalanceAdjustment
+	for _, drift := range drifts {
+		category, exists := u.Categories[drift.Category]
+		if !exists {
+			return adjustments, &CategoryNotFoundError{Category: drift.Category}
+		}
+		amount := Money{Amount: drift.Expected.Amount.Sub(drift.Stored.Amount), Currency: drift.Expected.Currency}
+		var err error
+		if amount.Amount.IsPositive() {
+			err = category.Credit(amount)
+		} else if amount.Amount.IsNegative() {
+			err = category.Debit(amount)
+		}
+		if err != nil {
+			return adjustments, err
+		}
+		adjustment := BalanceAdjustment{
+			ID:       NewID(),
+			Date:     date,
+			Category: drift.Category,
+			Amount:   amount,
+			Reason:   reason,
+		}
+		u.BalanceAdjustments = append(u.BalanceAdjustments, adjustment)
+		adjustments = append(adjustments, adjustment)
+	}
+	return adjustments, nil
+}
+
+// allArchivedTransactions reads back the transactions of every archived
+// period of the user.
+func (s *FinanceService) allArchivedTransactions(ctx context.Context, user *User) (incomes, expenses []Transaction, err error) {
+	if len(user.ArchivedPeriods) == 0 {
+		return nil, nil, nil
+	}
+	periods := make([]Period, len(user.ArchivedPeriods))
+	for i, archived := range user.ArchivedPeriods {
+		periods[i] = archived.Period
+	}
+	return s.archivedTransactions(ctx, user, periods...)
+}
+
+// VerifyBalances recomputes the user's category balances from their
+// history, archived periods included, and returns any drift.
+func (s *FinanceService) VerifyBalances(ctx context.Context, userID string) (_ []BalanceDrift, err error) {
+	ctx, span := s.startSpan(ctx, "VerifyBalances", userID)
+	defer endSpan(span, &err)
+
+	user, err := s.readUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.loadHistory(ctx, user); err != nil {
+		return nil, err
+	}
+	incomes, expenses, err := s.allArchivedTransactions(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	return user.balanceDrifts(incomes, expenses), nil
+}
+
+// RepairBalances verifies the user's balances and corrects any drift with
+// adjustment entries, which are returned.
+func (s *FinanceService) RepairBalances(ctx context.Context, userID, reason string) (_ []BalanceAdjustment, err error) {
+	ctx, span := s.startSpan(ctx, "RepairBalances", userID)
+	defer endSpan(span, &err)
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.loadHistory(ctx, user); err != nil {
+		return nil, err
+	}
+	incomes, expenses, err := s.allArchivedTransactions(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	drifts := user.balanceDrifts(incomes, expenses)
+	if len(drifts) == 0 {
+		return nil, nil
+	}
+	adjustments, err := user.RepairBalances(drifts, s.now(), reason)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.save(ctx, user, "repair_balances"); err != nil {
+		return nil, err
+	}
+	s.log().WarnContext(ctx, "repaired balance drift", LogKeyUserID, userID, "adjustments", len(adjustments))
+	s.publish(userID, EventBalancesUpdated, NewBalancesSnapshot(user))
+	s.Telemetry.Track(ctx, "balances", "repair", userID, map[string]string{
+		"adjustments": strconv.Itoa(len(adjustments)),
+	})
+	return adjustments, nil
+}
+
+// VerifyAllBalances runs VerifyBalances for every active user and returns
+// the drift found, by user. Users that could not be verified are reported
+// in the error.
+func (s *FinanceService) VerifyAllBalances(ctx context.Context) (map[string][]BalanceDrift, error) {
+	iterator, ok := s.UserRepo.(UserIterator)
+	if !ok {
+		return nil, errors.New("repository does not support iterating users")
+	}
+
+	var userIDs []string
+	err := iterator.ForEach(ctx, func(user *User) error {
+		if !user.Archived() {
+			userIDs = append(userIDs, user.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	drifted := make(map[string][]BalanceDrift)
+	var errs []error
+	for _, userID := range userIDs {
+		drifts, err := s.VerifyBalances(ctx, userID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("verifying balances of user %s: %w", userID, err))
+			continue
+		}
+		if len(drifts) > 0 {
+			drifted[userID] = drifts
+		}
+	}
+	return drifted, errors.Join(errs...)
+}
@@ -0,0 +1,159 @@
+package arus
+
+import (
+	"slices"
+	"time"
+)
+
+// Audience is who a serialized view is for. Views only carry what their
+// audience may see; serialize them instead of domain types, which hold full
+// account numbers and histories.
+type Audience int
+
+const (
+	// The user themselves: everything, with account numbers masked
+	AudienceOwner Audience = iota
+	// Financial advisors and operators: balances, plans and monthly totals,
+	// without accounts or individual transactions
+	AudienceAdvisor
+	// Third-party webhook receivers: amounts and categories only
+	AudienceWebhook
+)
+
+type AccountView struct {
+	AccountNumber string
+	BankName      string
+	Type          AccountType
+	Balance       Money
+}
+
+type CategoryView struct {
+	Type    CategoryType
+	Balance Money
+	// Balances in the other currencies the category holds
+	Foreign  []Money       `json:",omitempty"`
+	Accounts []AccountView `json:",omitempty"`
+}
+
+type TransactionView struct {
+	ID          string
+	Date        time.Time
+	Amount      Money
+	Status      TransactionStatus `json:",omitempty"`
+	Description string            `json:",omitempty"`
+	Tags        []string          `json:",omitempty"`
+	Allocations []Allocation      `json:",omitempty"`
+	Deductions  []Deduction       `json:",omitempty"`
+}
+
+type UserView struct {
+	ID              string
+	Country         string `json:",omitempty"`
+	Timezone        string `json:",omitempty"`
+	Categories      []CategoryView
+	AllocationMode  AllocationMode    `json:",omitempty"`
+	AllocationRules []AllocationRule  `json:",omitempty"`
+	MonthlyTotals   []PeriodTotals    `json:",omitempty"`
+	Holdings        []Holding         `json:",omitempty"`
+	Incomes         []TransactionView `json:",omitempty"`
+	Expenses        []TransactionView `json:",omitempty"`
+}
+
+type ReconciliationView struct {
+	Category    CategoryType
+	BankAccount string
+	Tracked     Money
+	Actual      Money
+	Difference  Money
+}
+
+func NewTransactionView(tx Transaction, audience Audience) TransactionView {
+	view := TransactionView{
+		ID:          tx.ID,
+		Date:        tx.Date,
+		Amount:      tx.Amount,
+		Status:      tx.Status,
+		Allocations: tx.Allocations,
+		Deductions:  tx.Deductions,
+	}
+	if audience == AudienceOwner {
+		view.Description = tx.Description
+		view.Tags = tx.Tags
+	}
+	return view
+}
+
+func NewReconciliationView(r Reconciliation) ReconciliationView {
+	return ReconciliationView{
+		Category:    r.Category,
+		BankAccount: r.BankAccount.Masked(),
+		Tracked:     r.Tracked,
+		Actual:      r.Actual,
+		Difference:  r.Difference,
+	}
+}
+
+func NewUserView(user *User, audience Audience) UserView {
+	view := UserView{ID: user.ID}
+
+	types := make([]CategoryType, 0, len(user.Categories))
+	for categoryType := range user.Categories {
+		types = append(types, categoryType)
+	}
+	slices.Sort(types)
+	for _, categoryType := range types {
+		category := user.Categories[categoryType]
+		categoryView := CategoryView{Type: category.Type, Balance: category.Balance, Foreign: category.Balances()[1:]}
+		if audience == AudienceOwner {
+			for _, account := range category.Accounts {
+				categoryView.Accounts = append(categoryView.Accounts, AccountView{
+					AccountNumber: account.BankAccount.Masked(),
+					BankName:      account.BankAccount.BankName,
+					Type:          DetectAccountType(account.BankAccount),
+					Balance:       account.Balance,
+				})
+			}
+		}
+		view.Categories = append(view.Categories, categoryView)
+	}
+
+	if audience == AudienceWebhook {
+		return view
+	}
+
+	view.Country = user.Country
+	view.Timezone = user.Timezone
+	view.AllocationMode = user.AllocationMode
+	view.AllocationRules = user.AllocationRules
+	view.Holdings = user.Holdings
+	if user.totalsCurrent() {
+		for _, totals := range user.Totals.Months {
+			view.MonthlyTotals = append(view.MonthlyTotals, totals)
+		}
+		slices.SortFunc(view.MonthlyTotals, func(a, b PeriodTotals) int {
+			return a.Period.StartDate.Compare(b.Period.StartDate)
+		})
+	}
+
+	if audience == AudienceOwner {
+		for _, income := range user.Incomes {
+			view.Incomes = append(view.Incomes, NewTransactionView(income, audience))
+		}
+		for _, expense := range user.Expenses {
+			view.Expenses = append(view.Expenses, NewTransactionView(expense, audience))
+		}
+	}
+	return view
+}
+
+// NewEventView returns a copy of the event whose data is a view for the
+// audience.
+func NewEventView(event Event, audience Audience) Event {
+	switch data := event.Data.(type) {
+	case Transaction:
+		event.Data = NewTransactionView(data, audience)
+	case Reconciliation:
+		event.Data = NewReconciliationView(data)
+	}
+	return event
+}
@@ -0,0 +1,207 @@
+package arus
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// Header carrying the signature of a webhook delivery: "sha256=" and the
+// hex HMAC-SHA256 of the body under the webhook's secret
+const WebhookSignatureHeader = "X-Arus-Signature"
+
+// Events buffered for the webhook dispatcher before it starts missing them
+const webhookBuffer = 256
+
+// Webhook delivers a user's ledger events to a URL of theirs, such as an
+// automation service. Payloads carry only what AudienceWebhook may see.
+type Webhook struct {
+	ID  string
+	URL string
+	// Event types delivered; empty delivers every event
+	Events []string `json:",omitempty"`
+	// Key deliveries are signed with, for the receiver to check they came
+	// from this instance
+	Secret  string
+	Created time.Time
+}
+
+// wants reports whether the webhook takes events of the type.
+func (w Webhook) wants(eventType string) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, eventType)
+}
+
+// AddWebhook registers a webhook delivering the event types to rawURL,
+// which must be an absolute http or https URL.
+func (u *User) AddWebhook(rawURL string, events []string, now time.Time) (Webhook, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "https" && target.Scheme != "http") || target.Host == "" {
+		return Webhook{}, fmt.Errorf("webhook URL %q is not an absolute http or https URL", rawURL)
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return Webhook{}, err
+	}
+	webhook := Webhook{
+		ID:      NewID(),
+		URL:     target.String(),
+		Events:  slices.Clone(events),
+		Secret:  hex.EncodeToString(secret),
+		Created: now,
+	}
+	u.Webhooks = append(u.Webhooks, webhook)
+	return webhook, nil
+}
+
+func (u *User) RemoveWebhook(id string) error {
+	i := slices.IndexFunc(u.Webhooks, func(w Webhook) bool { return w.ID == id })
+	if i < 0 {
+		return fmt.Errorf("webhook %s not found", id)
+	}
+	u.Webhooks = slices.Delete(u.Webhooks, i, i+1)
+	return nil
+}
+
+// RegisterWebhook adds a webhook to the user, within their QuotaWebhooks.
+// The returned webhook holds the secret its deliveries are signed with.
+func (s *FinanceService) RegisterWebhook(ctx context.Context, userID, rawURL string, events []string) (_ Webhook, err error) {
+	ctx, span := s.startSpan(ctx, "RegisterWebhook", userID)
+	defer endSpan(span, &err)
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return Webhook{}, err
+	}
+	if err := s.quotaFor(userID).Check(QuotaWebhooks, len(user.Webhooks), 1); err != nil {
+		return Webhook{}, err
+	}
+
+	webhook, err := user.AddWebhook(rawURL, events, s.now())
+	if err != nil {
+		return Webhook{}, err
+	}
+	if err := s.save(ctx, user, "register_webhook"); err != nil {
+		return Webhook{}, err
+	}
+	s.log().InfoContext(ctx, "registered webhook", LogKeyUserID, userID, "webhook", webhook.ID)
+	s.Telemetry.Track(ctx, "webhooks", "register", userID, nil)
+	return webhook, nil
+}
+
+func (s *FinanceService) Webhooks(ctx context.Context, userID string) ([]Webhook, error) {
+	user, err := s.readUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return user.Webhooks, nil
+}
+
+func (s *FinanceService) RemoveWebhook(ctx context.Context, userID, webhookID string) error {
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := user.RemoveWebhook(webhookID); err != nil {
+		return err
+	}
+	if err := s.save(ctx, user, "remove_webhook"); err != nil {
+		return err
+	}
+	s.Telemetry.Track(ctx, "webhooks", "remove", userID, nil)
+	return nil
+}
+
+// WebhookDispatcher POSTs every user's ledger events to their webhooks as
+// JSON, signed in WebhookSignatureHeader.
+type WebhookDispatcher struct {
+	Service *FinanceService
+	// Nil uses http.DefaultClient
+	Client *http.Client
+	// Told about failed deliveries; nil ignores them
+	OnError func(error)
+}
+
+// Run delivers events until ctx is cancelled. Like AlertDispatcher it runs
+// outside the ledger, so past webhookBuffer pending events new ones are
+// missed.
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	events, cancel := d.Service.Events.SubscribeAll(webhookBuffer)
+	defer cancel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			if err := d.dispatch(ctx, event); err != nil && d.OnError != nil {
+				d.OnError(fmt.Errorf("delivering %s of user %s to webhooks: %w", event.Type, event.UserID, err))
+			}
+		}
+	}
+}
+
+func (d *WebhookDispatcher) dispatch(ctx context.Context, event Event) error {
+	webhooks, err := d.Service.Webhooks(ctx, event.UserID)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(NewEventView(event, AudienceWebhook))
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, webhook := range webhooks {
+		if webhook.wants(event.Type) {
+			if err := d.deliver(ctx, webhook, body); err != nil {
+				errs = append(errs, fmt.Errorf("webhook %s: %w", webhook.ID, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (d *WebhookDispatcher) deliver(ctx context.Context, webhook Webhook, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(webhook.Secret, body))
+
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("delivery failed: %s", resp.Status)
+	}
+	return nil
+}
+
+// SignWebhook returns the WebhookSignatureHeader value of body under
+// secret, for receivers to compare against with hmac.Equal.
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
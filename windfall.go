@@ -0,0 +1,135 @@
+package arus
+
+import (
+	"context"
+	"errors"
+
+	"github.com/shopspring/decimal"
+)
+
+// Number of preceding incomes averaged for the windfall baseline by default
+const DefaultWindfallLookback = 3
+
+// WindfallRule routes Percentage of the part of an income above the user's
+// trailing-average income straight to Category, before the regular
+// allocation rules split the rest.
+type WindfallRule struct {
+	Category   CategoryType
+	Percentage decimal.Decimal
+	// How many preceding incomes make up the baseline; zero uses
+	// DefaultWindfallLookback
+	Lookback int
+}
+
+func (r WindfallRule) Validate() error {
+	if r.Percentage.IsNegative() || r.Percentage.GreaterThan(decimal.NewFromInt(1)) {
+		return errors.New("windfall percentage must be between 0 and 100%")
+	}
+	if r.Lookback < 0 {
+		return errors.New("windfall lookback must not be negative")
+	}
+	return nil
+}
+
+// IncomeBaseline is the average of the last lookback incomes in currency,
+// not counting accrued interest.
+// It returns false when there are no such incomes yet.
+func (u *User) IncomeBaseline(currency string, lookback int) (Money, bool) {
+	total := NewMoneyZero(currency)
+	count := 0
+	for i := len(u.Incomes) - 1; i >= 0 && count < lookback; i-- {
+		if u.Incomes[i].Amount.Currency != currency || isInterest(u.Incomes[i]) {
+			continue
+		}
+		total = total.Add(u.Incomes[i].Amount)
+		count++
+	}
+	if count == 0 {
+		return Money{}, false
+	}
+	return Money{Amount: total.Amount.Div(decimal.NewFromInt(int64(count))), Currency: currency}, true
+}
+
+// windfall returns the part of income the windfall rule routes to its
+// category, rounded to the currency's minor unit. It is zero when there is
+// no rule, no baseline yet, or the income does not exceed the baseline.
+func (u *User) windfall(income Money) (Money, error) {
+	zero := NewMoneyZero(income.Currency)
+	rule := u.WindfallRule
+	if rule == nil {
+		return zero, nil
+	}
+	if err := rule.Validate(); err != nil {
+		return Money{}, err
+	}
+	category, exists := u.Categories[rule.Category]
+	if !exists {
+		return Money{}, &CategoryNotFoundError{Category: rule.Category}
+	}
+	if err := category.checkCurrency(income); err != nil {
+		return Money{}, err
+	}
+
+	lookback := rule.Lookback
+	if lookback == 0 {
+		lookback = DefaultWindfallLookback
+	}
+	baseline, ok := u.IncomeBaseline(income.Currency, lookback)
+	if !ok || !income.Amount.GreaterThan(baseline.Amount) {
+		return zero, nil
+	}
+
+	excess := income.Amount.Sub(baseline.Amount)
+	return Money{Amount: excess.Mul(rule.Percentage), Currency: income.Currency}.Round(), nil
+}
+
+// loadIncomeBaseline loads the user's whole history when the windfall rule
+// looks back over more incomes in currency than were loaded.
+func (s *FinanceService) loadIncomeBaseline(ctx context.Context, user *User, currency string) error {
+	rule := user.WindfallRule
+	if rule == nil {
+		return nil
+	}
+	lookback := rule.Lookback
+	if lookback == 0 {
+		lookback = DefaultWindfallLookback
+	}
+	loaded := 0
+	for _, income := range user.Incomes {
+		if income.Amount.Currency == currency && !isInterest(income) {
+			loaded++
+		}
+	}
+	if loaded >= lookback {
+		return nil
+	}
+	return s.loadHistory(ctx, user)
+}
+
+// SetWindfallRule replaces the user's windfall rule; nil removes it.
+func (s *FinanceService) SetWindfallRule(ctx context.Context, userID string, rule *WindfallRule) error {
+	if rule != nil {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	}
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if rule != nil {
+		if _, exists := user.Categories[rule.Category]; !exists {
+			return &CategoryNotFoundError{Category: rule.Category}
+		}
+	}
+	user.WindfallRule = rule
+
+	if err := s.save(ctx, user, "set_windfall_rule"); err != nil {
+		return err
+	}
+	s.Telemetry.Track(ctx, "windfall", "set_rule", userID, nil)
+	return nil
+}
@@ -0,0 +1,209 @@
+package arus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Tag of the incomes recording accrued interest
+const InterestTag = "interest"
+
+// YieldRule pays interest on a category's balance at APY, the annual
+// percentage yield of the bank accounts behind it, compounded once per
+// period.
+type YieldRule struct {
+	Category CategoryType
+	APY      decimal.Decimal
+	// Interest has been accrued for everything before this instant
+	AccruedUntil time.Time
+}
+
+func (r YieldRule) Validate() error {
+	if !r.APY.IsPositive() || r.APY.GreaterThan(decimal.NewFromInt(1)) {
+		return errors.New("APY must be above 0 and at most 100%")
+	}
+	return nil
+}
+
+// periodRate is the interest earned over the part of period from since,
+// compounding the APY over that fraction of a year.
+func (r YieldRule) periodRate(period Period, since time.Time) decimal.Decimal {
+	start := period.StartDate
+	if since.After(start) {
+		start = since
+	}
+	elapsed := period.EndDate.Add(time.Nanosecond).Sub(start)
+	if elapsed <= 0 {
+		return decimal.Zero
+	}
+	years := decimal.NewFromInt(int64(elapsed)).Div(decimal.NewFromInt(int64(365 * 24 * time.Hour)))
+	return decimal.NewFromInt(1).Add(r.APY).Pow(years).Sub(decimal.NewFromInt(1))
+}
+
+func isInterest(tx Transaction) bool {
+	return slices.Contains(tx.Tags, InterestTag)
+}
+
+// AccrueYield pays interest for every period that ended by now and has not
+// been accrued yet, on the category's balance at the time of accrual. Each
+// payment is recorded as an income allocated entirely to the category,
+// dated at the end of its period, and returned.
+func (u *User) AccrueYield(now time.Time) ([]Transaction, error) {
+	var accrued []Transaction
+	for i := range u.YieldRules {
+		rule := &u.YieldRules[i]
+		category, exists := u.Categories[rule.Category]
+		if !exists {
+			return accrued, &CategoryNotFoundError{Category: rule.Category}
+		}
+		if rule.AccruedUntil.IsZero() {
+			rule.AccruedUntil = now
+			continue
+		}
+
+		for period := u.MonthlyPeriodOf(rule.AccruedUntil); !period.EndDate.After(now); period = period.Next() {
+			rate := rule.periodRate(period, rule.AccruedUntil)
+			rule.AccruedUntil = period.EndDate.Add(time.Nanosecond)
+			if !category.Balance.Amount.IsPositive() || !rate.IsPositive() {
+				continue
+			}
+
+			exact := Money{Amount: category.Balance.Amount.Mul(rate), Currency: category.Balance.Currency}
+			interest := NewTransaction(exact.Round(), period.EndDate, "Interest on "+rule.Category.String())
+			if !interest.Amount.Amount.IsPositive() {
+				continue
+			}
+			if err := category.Credit(interest.Amount); err != nil {
+				return accrued, err
+			}
+			interest.Tags = []string{InterestTag}
+			interest.Allocations = []Allocation{{Category: rule.Category, Amount: interest.Amount}}
+			u.Rounding.Record(exact, period.EndDate, RoundingInterest, interest.ID)
+
+			u.Incomes = append(u.Incomes, interest)
+			u.recordTotals(interest, false)
+			accrued = append(accrued, interest)
+		}
+	}
+	return accrued, nil
+}
+
+// SetYieldRule sets the APY paid on the category's balance; zero removes the
+// rule. Interest accrues from now on, the first period pro rata; changing
+// the APY of an existing rule applies to periods not accrued yet.
+func (s *FinanceService) SetYieldRule(ctx context.Context, userID string, categoryType CategoryType, apy decimal.Decimal) error {
+	rule := YieldRule{Category: categoryType, APY: apy}
+	if !apy.IsZero() {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	}
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if _, exists := user.Categories[categoryType]; !exists {
+		return &CategoryNotFoundError{Category: categoryType}
+	}
+
+	i := slices.IndexFunc(user.YieldRules, func(r YieldRule) bool { return r.Category == categoryType })
+	switch {
+	case apy.IsZero() && i >= 0:
+		user.YieldRules = slices.Delete(user.YieldRules, i, i+1)
+	case apy.IsZero():
+		return nil
+	case i >= 0:
+		user.YieldRules[i].APY = apy
+	default:
+		rule.AccruedUntil = s.now()
+		user.YieldRules = append(user.YieldRules, rule)
+	}
+
+	if err := s.save(ctx, user, "set_yield_rule"); err != nil {
+		return err
+	}
+	s.Telemetry.Track(ctx, "yield", "set_rule", userID, map[string]string{
+		"category": categoryType.String(),
+	})
+	return nil
+}
+
+// AccrueYield pays the user's interest for the periods that have ended since
+// it was last accrued, returning the recorded incomes.
+func (s *FinanceService) AccrueYield(ctx context.Context, userID string) (_ []Transaction, err error) {
+	ctx, span := s.startSpan(ctx, "AccrueYield", userID)
+	defer endSpan(span, &err)
+
+	defer s.lockUser(userID)()
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(user.YieldRules) == 0 {
+		return nil, nil
+	}
+
+	accrued, err := user.AccrueYield(s.now())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.save(ctx, user, "accrue_yield"); err != nil {
+		return nil, err
+	}
+	if len(accrued) == 0 {
+		return nil, nil
+	}
+	for _, interest := range accrued {
+		s.log().InfoContext(ctx, "accrued interest",
+			LogKeyUserID, userID, LogKeyTransactionID, interest.ID, "amount", interest.Amount.String(),
+			"category", interest.Allocations[0].Category.String())
+	}
+	s.publishLedger(user, accrued...)
+	s.Telemetry.Track(ctx, "yield", "accrue", userID, map[string]string{
+		"payments": strconv.Itoa(len(accrued)),
+	})
+	return accrued, nil
+}
+
+// AccrueAllYield accrues interest for every active user with yield rules,
+// e.g. from a daily job. It returns how many interest payments were
+// recorded; users that fail are reported together after the rest ran.
+func (s *FinanceService) AccrueAllYield(ctx context.Context) (int, error) {
+	iterator, ok := s.UserRepo.(UserIterator)
+	if !ok {
+		return 0, errors.New("repository does not support iterating users")
+	}
+
+	var userIDs []string
+	err := iterator.ForEach(ctx, func(user *User) error {
+		if len(user.YieldRules) > 0 && !user.Archived() {
+			userIDs = append(userIDs, user.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	payments := 0
+	var errs []error
+	for _, userID := range userIDs {
+		accrued, err := s.AccrueYield(ctx, userID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("accruing interest for user %s: %w", userID, err))
+			continue
+		}
+		payments += len(accrued)
+	}
+	return payments, errors.Join(errs...)
+}